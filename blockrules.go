@@ -0,0 +1,297 @@
+package httpcloak
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// BlockRule recognizes the block or challenge page of one protection
+// vendor. A response matches when every condition that is set matches.
+type BlockRule struct {
+	Vendor string `json:"vendor"`
+	Name   string `json:"name,omitempty"`
+
+	// Status lists the status codes the rule applies to; empty means any
+	Status []int `json:"status,omitempty"`
+
+	// Headers maps lowercase header names to a regular expression that one
+	// of the header's values must match. An empty pattern only requires the
+	// header to be present.
+	Headers map[string]string `json:"headers,omitempty"`
+
+	// Body is a regular expression the response body must match. The body is
+	// only read when the status and headers already match.
+	Body string `json:"body,omitempty"`
+
+	// Challenge marks pages that can be passed (JavaScript or cookie
+	// challenges) as opposed to outright blocks
+	Challenge bool `json:"challenge,omitempty"`
+}
+
+// BlockRuleSet is the file format read by LoadBlockClassifier, in YAML or JSON:
+//
+//	rules:
+//	  - vendor: cloudflare
+//	    name: managed-challenge
+//	    status: [403, 503]
+//	    headers:
+//	      cf-mitigated: ^challenge$
+//	    challenge: true
+//	  - vendor: akamai
+//	    status: [403]
+//	    headers:
+//	      server: AkamaiGHost
+//	    body: Access Denied
+type BlockRuleSet struct {
+	Rules []BlockRule `json:"rules"`
+}
+
+// BlockMatch is the rule a response matched
+type BlockMatch struct {
+	Vendor    string
+	Rule      string
+	Challenge bool
+}
+
+// DefaultBlockRules returns rules for the block pages of common vendors
+func DefaultBlockRules() []BlockRule {
+	return []BlockRule{
+		{Vendor: "cloudflare", Name: "challenge", Headers: map[string]string{"cf-mitigated": "^challenge$"}, Challenge: true},
+		{Vendor: "cloudflare", Name: "interstitial", Status: []int{403, 503}, Headers: map[string]string{"server": "(?i)^cloudflare"}, Body: `(?i)<title>Just a moment\.\.\.</title>`, Challenge: true},
+		{Vendor: "cloudflare", Name: "block", Status: []int{403}, Headers: map[string]string{"server": "(?i)^cloudflare"}, Body: `(?i)cf-error-details|Attention Required!`},
+		{Vendor: "datadome", Name: "captcha", Status: []int{403}, Headers: map[string]string{"x-datadome": ""}, Challenge: true},
+		{Vendor: "akamai", Name: "access-denied", Status: []int{403}, Headers: map[string]string{"server": "^AkamaiGHost$"}, Body: `(?i)<title>Access Denied</title>`},
+		{Vendor: "perimeterx", Name: "captcha", Status: []int{403}, Body: `px-captcha|_pxAppId`, Challenge: true},
+		{Vendor: "imperva", Name: "incident", Body: `_Incapsula_Resource|Incapsula incident ID`},
+		{Vendor: "aws-waf", Name: "challenge", Status: []int{202, 405}, Headers: map[string]string{"x-amzn-waf-action": "^(challenge|captcha)$"}, Challenge: true},
+	}
+}
+
+// BlockClassifier tells block and challenge pages apart from real content
+// using BlockRules. Classifiers loaded from a file can pick up edits with
+// Reload or Watch without restarting; patterns are compiled once and reused
+// across reloads while they stay the same.
+//
+// Example:
+//
+//	rules, err := httpcloak.LoadBlockClassifier("/etc/scraper/block-rules.yaml")
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	go rules.Watch(ctx, 30*time.Second, func(err error) { log.Print(err) })
+//
+//	exp := &httpcloak.Experiment{Variants: variants, URLs: urls, Blocked: rules.Blocked}
+type BlockClassifier struct {
+	path string
+
+	mu       sync.RWMutex
+	rules    []compiledBlockRule
+	patterns map[string]*regexp.Regexp // compiled patterns by source
+	modTime  time.Time
+	size     int64
+}
+
+type compiledBlockRule struct {
+	BlockRule
+	status  map[int]bool
+	headers map[string]*regexp.Regexp
+	body    *regexp.Regexp
+}
+
+// NewBlockClassifier compiles rules into a classifier
+func NewBlockClassifier(rules []BlockRule) (*BlockClassifier, error) {
+	c := &BlockClassifier{}
+	if err := c.setRules(rules); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// LoadBlockClassifier reads a BlockRuleSet from a YAML or JSON file (.json
+// is JSON, anything else YAML)
+func LoadBlockClassifier(path string) (*BlockClassifier, error) {
+	c := &BlockClassifier{path: path}
+	if _, err := c.reload(true); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Reload re-reads the rules file if it changed since the last load. On
+// errors the current rules stay in place. It reports whether new rules
+// were loaded; classifiers not loaded from a file never reload.
+func (c *BlockClassifier) Reload() (bool, error) {
+	if c.path == "" {
+		return false, nil
+	}
+	return c.reload(false)
+}
+
+// Watch calls Reload every interval until ctx is done, passing errors to
+// onError (which may be nil)
+func (c *BlockClassifier) Watch(ctx context.Context, interval time.Duration, onError func(error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := c.Reload(); err != nil && onError != nil {
+				onError(err)
+			}
+		}
+	}
+}
+
+func (c *BlockClassifier) reload(force bool) (bool, error) {
+	info, err := os.Stat(c.path)
+	if err != nil {
+		return false, err
+	}
+	c.mu.RLock()
+	unchanged := info.ModTime().Equal(c.modTime) && info.Size() == c.size
+	c.mu.RUnlock()
+	if unchanged && !force {
+		return false, nil
+	}
+
+	data, err := os.ReadFile(c.path)
+	if err != nil {
+		return false, err
+	}
+	var set BlockRuleSet
+	if err := decodeConfigFile(data, strings.EqualFold(filepath.Ext(c.path), ".json"), &set); err != nil {
+		return false, fmt.Errorf("%s: %w", c.path, err)
+	}
+	if err := c.setRules(set.Rules); err != nil {
+		return false, fmt.Errorf("%s: %w", c.path, err)
+	}
+
+	c.mu.Lock()
+	c.modTime, c.size = info.ModTime(), info.Size()
+	c.mu.Unlock()
+	return true, nil
+}
+
+// setRules compiles rules and swaps them in, keeping previously compiled
+// patterns that are still used
+func (c *BlockClassifier) setRules(rules []BlockRule) error {
+	c.mu.RLock()
+	old := c.patterns
+	c.mu.RUnlock()
+
+	patterns := make(map[string]*regexp.Regexp)
+	compile := func(pattern string) (*regexp.Regexp, error) {
+		if re, ok := patterns[pattern]; ok {
+			return re, nil
+		}
+		re, ok := old[pattern]
+		if !ok {
+			var err error
+			if re, err = regexp.Compile(pattern); err != nil {
+				return nil, err
+			}
+		}
+		patterns[pattern] = re
+		return re, nil
+	}
+
+	compiled := make([]compiledBlockRule, 0, len(rules))
+	for i, rule := range rules {
+		if rule.Vendor == "" {
+			return fmt.Errorf("rule %d: vendor is required", i)
+		}
+		if len(rule.Status) == 0 && len(rule.Headers) == 0 && rule.Body == "" {
+			return fmt.Errorf("rule %d (%s): needs a status, header or body condition", i, rule.Vendor)
+		}
+		cr := compiledBlockRule{BlockRule: rule, headers: make(map[string]*regexp.Regexp, len(rule.Headers))}
+		if len(rule.Status) > 0 {
+			cr.status = make(map[int]bool, len(rule.Status))
+			for _, code := range rule.Status {
+				cr.status[code] = true
+			}
+		}
+		for name, pattern := range rule.Headers {
+			re, err := compile(pattern)
+			if err != nil {
+				return fmt.Errorf("rule %d (%s): header %s: %w", i, rule.Vendor, name, err)
+			}
+			cr.headers[strings.ToLower(name)] = re
+		}
+		if rule.Body != "" {
+			re, err := compile(rule.Body)
+			if err != nil {
+				return fmt.Errorf("rule %d (%s): body: %w", i, rule.Vendor, err)
+			}
+			cr.body = re
+		}
+		compiled = append(compiled, cr)
+	}
+
+	c.mu.Lock()
+	c.rules, c.patterns = compiled, patterns
+	c.mu.Unlock()
+	return nil
+}
+
+// Classify returns the first rule resp matches, or nil. The body is read
+// (and cached on resp) only when a rule with a body pattern needs it.
+func (c *BlockClassifier) Classify(resp *Response) (*BlockMatch, error) {
+	c.mu.RLock()
+	rules := c.rules
+	c.mu.RUnlock()
+
+	for i := range rules {
+		rule := &rules[i]
+		if rule.status != nil && !rule.status[resp.StatusCode] {
+			continue
+		}
+		if !rule.matchHeaders(resp) {
+			continue
+		}
+		if rule.body != nil {
+			body, err := resp.Bytes()
+			if err != nil {
+				return nil, err
+			}
+			if !rule.body.Match(body) {
+				continue
+			}
+		}
+		return &BlockMatch{Vendor: rule.Vendor, Rule: rule.Name, Challenge: rule.Challenge}, nil
+	}
+	return nil, nil
+}
+
+// Blocked reports whether resp matches any rule, for use as Experiment.Blocked
+func (c *BlockClassifier) Blocked(resp *Response) bool {
+	match, _ := c.Classify(resp)
+	return match != nil
+}
+
+func (r *compiledBlockRule) matchHeaders(resp *Response) bool {
+	for name, re := range r.headers {
+		values := resp.GetHeaders(name)
+		if len(values) == 0 {
+			return false
+		}
+		matched := false
+		for _, v := range values {
+			if re.MatchString(v) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,123 @@
+package httpcloak
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testResponse(status int, headers map[string][]string, body string) *Response {
+	return &Response{StatusCode: status, Headers: headers, Body: io.NopCloser(strings.NewReader(body))}
+}
+
+func TestDefaultBlockRules(t *testing.T) {
+	c, err := NewBlockClassifier(DefaultBlockRules())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		resp *Response
+		want string
+	}{
+		{"cloudflare challenge", testResponse(403, map[string][]string{"cf-mitigated": {"challenge"}}, ""), "cloudflare"},
+		{"cloudflare interstitial", testResponse(503, map[string][]string{"server": {"cloudflare"}}, "<title>Just a moment...</title>"), "cloudflare"},
+		{"akamai", testResponse(403, map[string][]string{"server": {"AkamaiGHost"}}, "<HTML><HEAD><TITLE>Access Denied</TITLE>"), "akamai"},
+		{"cloudflare page", testResponse(200, map[string][]string{"server": {"cloudflare"}}, "<title>Shop</title>"), ""},
+		{"plain 403", testResponse(403, nil, "forbidden"), ""},
+	}
+	for _, tt := range tests {
+		match, err := c.Classify(tt.resp)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		got := ""
+		if match != nil {
+			got = match.Vendor
+		}
+		if got != tt.want {
+			t.Errorf("%s: vendor = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestBlockClassifierReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.yaml")
+	write := func(content string, mtime time.Time) {
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		os.Chtimes(path, mtime, mtime)
+	}
+	start := time.Now().Add(-time.Hour)
+	write("rules:\n  - vendor: acme\n    status: [418]\n    body: teapot\n", start)
+
+	c, err := LoadBlockClassifier(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !c.Blocked(testResponse(418, nil, "I'm a teapot")) {
+		t.Error("rule from file did not match")
+	}
+	teapot := c.patterns["teapot"]
+
+	if loaded, err := c.Reload(); loaded || err != nil {
+		t.Errorf("Reload of unchanged file = %v, %v; want false, nil", loaded, err)
+	}
+
+	write("rules:\n  - vendor: acme\n    status: [418]\n    body: teapot\n  - vendor: acme\n    status: [429]\n", start.Add(time.Minute))
+	if loaded, err := c.Reload(); !loaded || err != nil {
+		t.Fatalf("Reload = %v, %v; want true, nil", loaded, err)
+	}
+	if !c.Blocked(testResponse(429, nil, "")) {
+		t.Error("reloaded rule did not match")
+	}
+	if c.patterns["teapot"] != teapot {
+		t.Error("unchanged pattern was recompiled")
+	}
+
+	write("rules:\n  - vendor: acme\n    body: '('\n", start.Add(2*time.Minute))
+	if _, err := c.Reload(); err == nil {
+		t.Error("Reload accepted an invalid pattern")
+	}
+	if !c.Blocked(testResponse(429, nil, "")) {
+		t.Error("failed reload dropped the previous rules")
+	}
+}
+
+// FuzzBlockClassifier checks rule files and responses from misbehaving
+// servers against the classifier
+func FuzzBlockClassifier(f *testing.F) {
+	f.Add([]byte(`{"rules":[{"vendor":"acme","status":[418],"headers":{"server":"^tea"},"body":"pot"}]}`), 418, "server", "teapot", "I'm a teapot")
+	f.Add([]byte(`{"rules":[]}`), 403, "cf-mitigated", "challenge", "<title>Just a moment...</title>")
+	f.Add([]byte(`{"rules":[{"vendor":"x","body":"("}]}`), 0, "", "", "")
+
+	defaults, err := NewBlockClassifier(DefaultBlockRules())
+	if err != nil {
+		f.Fatal(err)
+	}
+	f.Fuzz(func(t *testing.T, rules []byte, status int, header, value, body string) {
+		resp := func() *Response {
+			return testResponse(status, map[string][]string{header: {value}}, body)
+		}
+		if _, err := defaults.Classify(resp()); err != nil {
+			t.Fatal(err)
+		}
+
+		var set BlockRuleSet
+		if err := decodeConfigFile(rules, true, &set); err != nil {
+			return
+		}
+		c, err := NewBlockClassifier(set.Rules)
+		if err != nil {
+			return
+		}
+		if match, _ := c.Classify(resp()); match != nil && match.Vendor == "" {
+			t.Fatal("match without a vendor")
+		}
+	})
+}
@@ -574,7 +574,10 @@ func (r *Response) IsServerError() bool {
 
 // Do executes an HTTP request
 // Tries HTTP/3 first, falls back to HTTP/2 if HTTP/3 fails
-func (c *Client) Do(ctx context.Context, req *Request) (*Response, error) {
+// A panic in a hook or while executing the request is returned as a *transport.PanicError
+func (c *Client) Do(ctx context.Context, req *Request) (resp *Response, err error) {
+	defer transport.RecoverPanic(&resp, &err)
+
 	// Handle retries
 	if c.config.RetryEnabled && !req.DisableRetry {
 		return c.doWithRetry(ctx, req)
@@ -1047,6 +1050,7 @@ func (c *Client) doOnce(ctx context.Context, req *Request, redirectHistory []*Re
 	}
 
 	timing.Total = float64(time.Since(startTime).Milliseconds())
+	timing.Server = protocol.ParseServerTiming(headers["server-timing"])
 
 	response := &Response{
 		StatusCode:      resp.StatusCode,
@@ -1472,8 +1476,10 @@ func applyTLSOnlyHeaders(httpReq *http.Request, preset *fingerprint.Preset, req
 	}
 
 	// Set pseudo-header order based on browser type
-	// Safari/iOS uses m,s,p,a; Chrome uses m,a,s,p
-	if preset.HTTP2Settings.NoRFC7540Priorities {
+	// Safari/iOS uses m,s,p,a; Chrome uses m,a,s,p; presets may override
+	if len(preset.HTTP2Settings.PseudoHeaderOrder) > 0 {
+		httpReq.Header[http.PHeaderOrderKey] = preset.HTTP2Settings.PseudoHeaderOrder
+	} else if preset.HTTP2Settings.NoRFC7540Priorities {
 		httpReq.Header[http.PHeaderOrderKey] = []string{":method", ":scheme", ":path", ":authority"}
 	} else {
 		httpReq.Header[http.PHeaderOrderKey] = []string{":method", ":authority", ":scheme", ":path"}
@@ -1564,8 +1570,10 @@ func applyModeHeaders(httpReq *http.Request, preset *fingerprint.Preset, req *Re
 	}
 
 	// Set pseudo-header order based on browser type
-	// Safari/iOS uses m,s,p,a; Chrome uses m,a,s,p
-	if preset.HTTP2Settings.NoRFC7540Priorities {
+	// Safari/iOS uses m,s,p,a; Chrome uses m,a,s,p; presets may override
+	if len(preset.HTTP2Settings.PseudoHeaderOrder) > 0 {
+		httpReq.Header[http.PHeaderOrderKey] = preset.HTTP2Settings.PseudoHeaderOrder
+	} else if preset.HTTP2Settings.NoRFC7540Priorities {
 		httpReq.Header[http.PHeaderOrderKey] = []string{":method", ":scheme", ":path", ":authority"}
 	} else {
 		httpReq.Header[http.PHeaderOrderKey] = []string{":method", ":authority", ":scheme", ":path"}
@@ -1766,6 +1774,12 @@ func applyOrganicJitter(req *http.Request) {
 
 // decompress decompresses response body based on Content-Encoding
 func decompress(data []byte, encoding string) ([]byte, error) {
+	if decoder, ok := transport.GetDecoder(encoding); ok {
+		reader := decoder(bytes.NewReader(data))
+		defer reader.Close()
+		return io.ReadAll(reader)
+	}
+
 	switch strings.ToLower(encoding) {
 	case "gzip":
 		reader, err := gzip.NewReader(bytes.NewReader(data))
@@ -16,6 +16,7 @@ import (
 	"github.com/klauspost/compress/zstd"
 	"github.com/sardanioss/httpcloak/fingerprint"
 	"github.com/sardanioss/httpcloak/protocol"
+	"github.com/sardanioss/httpcloak/transport"
 )
 
 // extractHost extracts the hostname from a URL string
@@ -119,6 +120,7 @@ func processResponse(resp *http.Response, originalURL string, startTime time.Tim
 		copy(headerValues, values)
 		headers[lowerKey] = headerValues
 	}
+	timing.Server = protocol.ParseServerTiming(headers["server-timing"])
 
 	return &Response{
 		StatusCode: resp.StatusCode,
@@ -132,7 +134,14 @@ func processResponse(resp *http.Response, originalURL string, startTime time.Tim
 }
 
 // Decompress decompresses response body based on Content-Encoding
+// Decoders registered via transport.RegisterDecoder take precedence over built-ins.
 func Decompress(data []byte, encoding string) ([]byte, error) {
+	if decoder, ok := transport.GetDecoder(encoding); ok {
+		reader := decoder(bytes.NewReader(data))
+		defer reader.Close()
+		return io.ReadAll(reader)
+	}
+
 	switch strings.ToLower(encoding) {
 	case "gzip":
 		reader, err := gzip.NewReader(bytes.NewReader(data))
@@ -208,6 +208,7 @@ func (c *HTTP3Client) Do(ctx context.Context, req *Request) (*Response, error) {
 		copy(headerValues, values)
 		headers[lowerKey] = headerValues
 	}
+	timing.Server = protocol.ParseServerTiming(headers["server-timing"])
 
 	return &Response{
 		StatusCode: resp.StatusCode,
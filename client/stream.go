@@ -15,6 +15,7 @@ import (
 	"github.com/andybalholm/brotli"
 	"github.com/klauspost/compress/zstd"
 	"github.com/sardanioss/httpcloak/protocol"
+	"github.com/sardanioss/httpcloak/transport"
 )
 
 // StreamResponse represents a streaming HTTP response
@@ -254,6 +255,7 @@ func (c *Client) DoStream(ctx context.Context, req *Request) (*StreamResponse, e
 	reader, decompressor := setupDecompressor(resp.Body, resp.Header.Get("Content-Encoding"))
 
 	timing.FirstByte = float64(time.Since(startTime).Milliseconds())
+	timing.Server = protocol.ParseServerTiming(headers["server-timing"])
 
 	return &StreamResponse{
 		StatusCode:    resp.StatusCode,
@@ -272,6 +274,11 @@ func (c *Client) DoStream(ctx context.Context, req *Request) (*StreamResponse, e
 
 // setupDecompressor creates a decompression reader based on Content-Encoding
 func setupDecompressor(body io.ReadCloser, encoding string) (io.ReadCloser, io.Closer) {
+	if decoder, ok := transport.GetDecoder(encoding); ok {
+		reader := decoder(body)
+		return reader, reader
+	}
+
 	switch strings.ToLower(encoding) {
 	case "gzip":
 		reader, err := gzip.NewReader(body)
@@ -0,0 +1,381 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/sardanioss/httpcloak/fingerprint"
+	tls "github.com/sardanioss/utls"
+)
+
+// capture is what a browser was seen sending
+type capture struct {
+	clientHello []byte // Handshake message, nil without a pcap
+	protocol    string // "h1", "h2" or "h3"; "" when unknown
+	h2          *fingerprint.H2Spec
+	headers     []fingerprint.HeaderPair // First request's regular headers, in order
+	qlog        *qlogInfo
+}
+
+// perRequestHeaders vary with each request and don't belong in a preset
+var perRequestHeaders = map[string]bool{
+	"host": true, "cookie": true, "content-length": true, "content-type": true,
+	"referer": true, "origin": true, "authorization": true,
+	"if-none-match": true, "if-modified-since": true, "cache-control": true,
+}
+
+// loadPcap reads the first TLS connection of a capture. With a key log the
+// connection's first request is decrypted (TLS 1.3 only) for its HTTP/2
+// fingerprint and headers.
+func loadPcap(path, keyLogPath string) (*capture, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	segments, err := readPcap(f)
+	if err != nil {
+		return nil, err
+	}
+	streams := reassemble(segments)
+
+	var client, server []byte
+	for _, seg := range segments {
+		if s := streams[seg.flow]; isClientHelloStream(s) {
+			client, server = s, streams[seg.reverse]
+			break
+		}
+	}
+	if client == nil {
+		return nil, errors.New("pcap: no TLS ClientHello found")
+	}
+	clientRecords := tlsRecords(client)
+	hello, err := firstHandshakeMessage(clientRecords, handshakeClientHello)
+	if err != nil {
+		return nil, err
+	}
+	c := &capture{clientHello: hello}
+	if keyLogPath == "" {
+		return c, nil
+	}
+
+	kf, err := os.Open(keyLogPath)
+	if err != nil {
+		return nil, err
+	}
+	defer kf.Close()
+	secrets, err := readKeyLog(kf)
+	if err != nil {
+		return nil, err
+	}
+	secret, ok := secrets[hex.EncodeToString(clientRandom(hello))]
+	if !ok {
+		return nil, errors.New("keylog: no CLIENT_TRAFFIC_SECRET_0 for the captured connection")
+	}
+	shMsg, err := firstHandshakeMessage(tlsRecords(server), handshakeServerHello)
+	if err != nil {
+		return nil, err
+	}
+	sh, err := parseServerHello(shMsg)
+	if err != nil {
+		return nil, err
+	}
+	data, err := decryptClientData(clientRecords, sh, secret)
+	if err != nil {
+		return nil, err
+	}
+
+	if bytes.HasPrefix(data, []byte("PRI * HTTP/2.0")) {
+		spec, headers, err := fingerprint.ParseH2Preface(data)
+		if err != nil {
+			return nil, err
+		}
+		c.protocol, c.h2, c.headers = "h2", &spec, headers
+		return c, nil
+	}
+	headers, err := parseHTTP1Headers(data)
+	if err != nil {
+		return nil, err
+	}
+	c.protocol, c.headers = "h1", headers
+	return c, nil
+}
+
+// parseHTTP1Headers returns the headers of the first HTTP/1.x request in data
+func parseHTTP1Headers(data []byte) ([]fingerprint.HeaderPair, error) {
+	end := bytes.Index(data, []byte("\r\n\r\n"))
+	if end < 0 {
+		return nil, errors.New("http/1.1: request headers incomplete")
+	}
+	lines := strings.Split(string(data[:end]), "\r\n")
+	if !strings.Contains(lines[0], " HTTP/1.") {
+		return nil, fmt.Errorf("http/1.1: not a request line: %q", lines[0])
+	}
+	var headers []fingerprint.HeaderPair
+	for _, line := range lines[1:] {
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			return nil, fmt.Errorf("http/1.1: malformed header %q", line)
+		}
+		headers = append(headers, fingerprint.HeaderPair{Key: strings.ToLower(name), Value: strings.TrimSpace(value)})
+	}
+	return headers, nil
+}
+
+// helloSummary is the part of a ClientHello a preset can express
+type helloSummary struct {
+	ja4          string
+	cipherSuites []uint16 // Without GREASE
+	alpn         []string
+}
+
+func summarizeHello(hello []byte, quic bool) (helloSummary, error) {
+	var s helloSummary
+	ja4, err := fingerprint.JA4(hello, quic)
+	if err != nil {
+		return s, err
+	}
+	spec, err := fingerprint.FromRawClientHello(hello)
+	if err != nil {
+		return s, err
+	}
+	s.ja4 = ja4
+	for _, suite := range spec.CipherSuites {
+		if suite&0x0f0f != 0x0a0a {
+			s.cipherSuites = append(s.cipherSuites, suite)
+		}
+	}
+	for _, ext := range spec.Extensions {
+		if alpn, ok := ext.(*tls.ALPNExtension); ok {
+			s.alpn = alpn.AlpnProtocols
+		}
+	}
+	return s, nil
+}
+
+// presetClientHello builds the ClientHello a preset sends on TCP
+func presetClientHello(p *fingerprint.Preset) ([]byte, error) {
+	spec, err := tls.UTLSIdToSpec(p.ClientHelloID)
+	if err != nil {
+		return nil, err
+	}
+	p.ApplyTLSOverrides(&spec)
+
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+	conn := tls.UClient(client, &tls.Config{ServerName: "example.com"}, tls.HelloCustom)
+	if err := conn.ApplyPreset(&spec); err != nil {
+		return nil, err
+	}
+	if err := conn.BuildHandshakeState(); err != nil {
+		return nil, err
+	}
+	return conn.HandshakeState.Hello.Raw, nil
+}
+
+// presetFile returns a candidate preset definition for the capture, based
+// on base when set. notes lists what the definition can't express.
+func (c *capture) presetFile(name, base string) (file *fingerprint.PresetFile, notes []string, err error) {
+	file = &fingerprint.PresetFile{Name: name, Base: base}
+
+	if c.clientHello != nil {
+		hello, err := summarizeHello(c.clientHello, false)
+		if err != nil {
+			return nil, nil, err
+		}
+		file.CipherSuites = hello.cipherSuites
+		file.ALPN = hello.alpn
+		notes = append(notes, fmt.Sprintf("captured JA4 %s: pick a clientHello ID that produces it, or send the capture with WithCustomClientHello", hello.ja4))
+	}
+
+	for _, h := range c.headers {
+		if h.Key == "user-agent" {
+			file.UserAgent = h.Value
+		}
+		if perRequestHeaders[h.Key] {
+			continue
+		}
+		file.HeaderOrder = append(file.HeaderOrder, h.Key)
+		if h.Key != "user-agent" {
+			file.Headers = append(file.Headers, fingerprint.PresetFileHeader{Name: h.Key, Value: h.Value})
+		}
+	}
+
+	if c.h2 != nil {
+		settings, h2Notes := http2Overrides(*c.h2)
+		notes = append(notes, h2Notes...)
+		if file.HTTP2, err = json.Marshal(settings); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if c.protocol == "h3" || c.qlog != nil {
+		http3 := true
+		file.HTTP3 = &http3
+	}
+	if c.qlog != nil {
+		notes = append(notes, qlogNotes(c.qlog)...)
+	}
+	return file, notes, nil
+}
+
+// http2Overrides converts a captured HTTP/2 fingerprint to PresetFile http2
+// overrides
+func http2Overrides(spec fingerprint.H2Spec) (map[string]any, []string) {
+	var notes []string
+	settings := map[string]any{"connectionWindowUpdate": spec.ConnectionWindowUpdate}
+	order := make([]uint16, 0, len(spec.Settings))
+	for _, s := range spec.Settings {
+		order = append(order, s.ID)
+		switch s.ID {
+		case fingerprint.H2SettingHeaderTableSize:
+			settings["headerTableSize"] = s.Value
+		case fingerprint.H2SettingEnablePush:
+			settings["enablePush"] = s.Value != 0
+		case fingerprint.H2SettingMaxConcurrentStreams:
+			settings["maxConcurrentStreams"] = s.Value
+		case fingerprint.H2SettingInitialWindowSize:
+			settings["initialWindowSize"] = s.Value
+		case fingerprint.H2SettingMaxFrameSize:
+			settings["maxFrameSize"] = s.Value
+		case fingerprint.H2SettingMaxHeaderListSize:
+			settings["maxHeaderListSize"] = s.Value
+		case fingerprint.H2SettingNoRFC7540Priorities:
+			settings["noRFC7540Priorities"] = s.Value != 0
+		default:
+			notes = append(notes, fmt.Sprintf("SETTINGS %d=%d has no preset field", s.ID, s.Value))
+		}
+	}
+	settings["settingsOrder"] = order
+	if len(spec.PseudoHeaderOrder) > 0 {
+		settings["pseudoHeaderOrder"] = spec.PseudoHeaderOrder
+	}
+	if p := spec.HeaderPriority; p != nil {
+		settings["streamWeight"] = p.Weight
+		settings["streamExclusive"] = p.Exclusive
+		if p.DependsOn != 0 {
+			notes = append(notes, fmt.Sprintf("HEADERS depend on stream %d, which only an H2Spec can express", p.DependsOn))
+		}
+	} else {
+		notes = append(notes, "HEADERS carry no priority, which only an H2Spec can express")
+	}
+	if len(spec.PriorityFrames) > 0 || len(notes) > 0 {
+		notes = append(notes, fmt.Sprintf("for the exact HTTP/2 fingerprint use WithAkamai(%q)", spec.Akamai()))
+	}
+	return settings, notes
+}
+
+func qlogNotes(info *qlogInfo) []string {
+	var notes []string
+	for _, group := range []struct {
+		name   string
+		params map[string]any
+	}{{"QUIC transport parameter", info.transportParams}, {"HTTP/3 setting", info.h3Settings}} {
+		keys := make([]string, 0, len(group.params))
+		for k := range group.params {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			notes = append(notes, fmt.Sprintf("%s %s = %v", group.name, k, group.params[k]))
+		}
+	}
+	return notes
+}
+
+// diffPreset lists where preset differs from the capture
+func diffPreset(p *fingerprint.Preset, c *capture) ([]string, error) {
+	var diffs []string
+	differs := func(field string, preset, captured any) {
+		diffs = append(diffs, fmt.Sprintf("%s: preset %v, capture %v", field, preset, captured))
+	}
+
+	if c.clientHello != nil {
+		captured, err := summarizeHello(c.clientHello, false)
+		if err != nil {
+			return nil, err
+		}
+		raw, err := presetClientHello(p)
+		if err != nil {
+			return nil, fmt.Errorf("building %s ClientHello: %w", p.Name, err)
+		}
+		own, err := summarizeHello(raw, false)
+		if err != nil {
+			return nil, err
+		}
+		if own.ja4 != captured.ja4 {
+			differs("ja4", own.ja4, captured.ja4)
+		}
+		if !slices.Equal(own.cipherSuites, captured.cipherSuites) {
+			differs("cipher suites", hexList(own.cipherSuites), hexList(captured.cipherSuites))
+		}
+		if !slices.Equal(own.alpn, captured.alpn) {
+			differs("alpn", own.alpn, captured.alpn)
+		}
+	}
+
+	if len(c.headers) > 0 {
+		var presetOrder, capturedOrder []string
+		presetValues := make(map[string]string)
+		for _, h := range p.HeaderOrder {
+			presetOrder = append(presetOrder, h.Key)
+			presetValues[h.Key] = h.Value
+		}
+		presetValues["user-agent"] = p.UserAgent
+		for _, h := range c.headers {
+			if perRequestHeaders[h.Key] {
+				continue
+			}
+			capturedOrder = append(capturedOrder, h.Key)
+			value, ok := presetValues[h.Key]
+			switch {
+			case !ok:
+				differs("header "+h.Key, "(not sent)", fmt.Sprintf("%q", h.Value))
+			case value != h.Value:
+				differs("header "+h.Key, fmt.Sprintf("%q", value), fmt.Sprintf("%q", h.Value))
+			}
+		}
+		if !slices.Equal(presetOrder, capturedOrder) {
+			differs("header order", strings.Join(presetOrder, ","), strings.Join(capturedOrder, ","))
+		}
+	}
+
+	if c.h2 != nil {
+		own := p.H2()
+		if own.Akamai() != c.h2.Akamai() {
+			differs("akamai", own.Akamai(), c.h2.Akamai())
+		}
+		if ownPrio, capPrio := priorityString(own.HeaderPriority), priorityString(c.h2.HeaderPriority); ownPrio != capPrio {
+			differs("HEADERS priority", ownPrio, capPrio)
+		}
+	}
+
+	if http3 := c.protocol == "h3" || c.qlog != nil; http3 && !p.SupportHTTP3 {
+		differs("http3", false, true)
+	}
+	return diffs, nil
+}
+
+func priorityString(p *fingerprint.H2Priority) string {
+	if p == nil {
+		return "none"
+	}
+	return fmt.Sprintf("weight %d, exclusive %t, depends on %d", p.Weight, p.Exclusive, p.DependsOn)
+}
+
+func hexList(values []uint16) string {
+	parts := make([]string, len(values))
+	for i, v := range values {
+		parts[i] = fmt.Sprintf("%04x", v)
+	}
+	return strings.Join(parts, ",")
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/sardanioss/httpcloak/fingerprint"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/hpack"
+)
+
+// tcpFrame builds an Ethernet/IPv4/TCP frame
+func tcpFrame(src, dst byte, srcPort, dstPort uint16, seq uint32, syn bool, payload []byte) []byte {
+	tcp := make([]byte, 20, 20+len(payload))
+	binary.BigEndian.PutUint16(tcp[0:], srcPort)
+	binary.BigEndian.PutUint16(tcp[2:], dstPort)
+	binary.BigEndian.PutUint32(tcp[4:], seq)
+	tcp[12] = 5 << 4
+	tcp[13] = 0x10
+	if syn {
+		tcp[13] = 0x02
+	}
+	tcp = append(tcp, payload...)
+
+	ip := make([]byte, 20, 20+len(tcp))
+	ip[0] = 0x45
+	binary.BigEndian.PutUint16(ip[2:], uint16(20+len(tcp)))
+	ip[9] = 6
+	copy(ip[12:], []byte{10, 0, 0, src})
+	copy(ip[16:], []byte{10, 0, 0, dst})
+	ip = append(ip, tcp...)
+
+	eth := make([]byte, 14, 14+len(ip))
+	binary.BigEndian.PutUint16(eth[12:], 0x0800)
+	return append(eth, ip...)
+}
+
+func writePcap(t *testing.T, frames [][]byte) string {
+	t.Helper()
+	var buf bytes.Buffer
+	header := make([]byte, 24)
+	binary.LittleEndian.PutUint32(header[0:], 0xa1b2c3d4)
+	binary.LittleEndian.PutUint16(header[4:], 2)
+	binary.LittleEndian.PutUint16(header[6:], 4)
+	binary.LittleEndian.PutUint32(header[16:], 65535)
+	binary.LittleEndian.PutUint32(header[20:], linkEthernet)
+	buf.Write(header)
+	for _, f := range frames {
+		record := make([]byte, 16)
+		binary.LittleEndian.PutUint32(record[8:], uint32(len(f)))
+		binary.LittleEndian.PutUint32(record[12:], uint32(len(f)))
+		buf.Write(record)
+		buf.Write(f)
+	}
+	path := filepath.Join(t.TempDir(), "capture.pcap")
+	if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func tlsRecordBytes(typ byte, body []byte) []byte {
+	r := []byte{typ, 3, 3, 0, 0}
+	binary.BigEndian.PutUint16(r[3:], uint16(len(body)))
+	return append(r, body...)
+}
+
+// h2Request is the client side of an HTTP/2 connection up to its first request
+func h2Request(t *testing.T, spec fingerprint.H2Spec, headers []hpack.HeaderField) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	buf.WriteString(http2.ClientPreface)
+	fr := http2.NewFramer(&buf, nil)
+	var settings []http2.Setting
+	for _, s := range spec.Settings {
+		settings = append(settings, http2.Setting{ID: http2.SettingID(s.ID), Val: s.Value})
+	}
+	fr.WriteSettings(settings...)
+	fr.WriteWindowUpdate(0, spec.ConnectionWindowUpdate)
+
+	var block bytes.Buffer
+	enc := hpack.NewEncoder(&block)
+	for _, h := range headers {
+		enc.WriteField(h)
+	}
+	p := spec.HeaderPriority
+	fr.WriteHeaders(http2.HeadersFrameParam{
+		StreamID:      1,
+		BlockFragment: block.Bytes(),
+		EndStream:     true,
+		EndHeaders:    true,
+		Priority:      http2.PriorityParam{Weight: uint8(p.Weight - 1), Exclusive: p.Exclusive, StreamDep: p.DependsOn},
+	})
+	return buf.Bytes()
+}
+
+func TestLoadPcapWithKeyLog(t *testing.T) {
+	preset := fingerprint.Get("chrome-latest")
+	hello, err := presetClientHello(preset)
+	if err != nil {
+		t.Fatal(err)
+	}
+	spec := preset.H2()
+	fields := []hpack.HeaderField{
+		{Name: ":method", Value: "GET"}, {Name: ":authority", Value: "example.com"},
+		{Name: ":scheme", Value: "https"}, {Name: ":path", Value: "/"},
+		{Name: "user-agent", Value: preset.UserAgent}, {Name: "accept", Value: "*/*"},
+		{Name: "cookie", Value: "a=1"},
+	}
+	plaintext := h2Request(t, spec, fields)
+
+	// Encrypt the request as TLS_AES_128_GCM_SHA256 record 0
+	secret := bytes.Repeat([]byte{7}, 32)
+	key, _ := expandLabel(sha256.New, secret, "key", 16)
+	iv, _ := expandLabel(sha256.New, secret, "iv", 12)
+	block, _ := aes.NewCipher(key)
+	aead, _ := cipher.NewGCM(block)
+	inner := append(append([]byte(nil), plaintext...), recordApplicationData)
+	header := []byte{recordApplicationData, 3, 3, 0, 0}
+	binary.BigEndian.PutUint16(header[3:], uint16(len(inner)+aead.Overhead()))
+	appRecord := append(header, aead.Seal(nil, iv, inner, header)...)
+
+	helloRecord := tlsRecordBytes(recordHandshake, hello)
+	finished := tlsRecordBytes(recordApplicationData, bytes.Repeat([]byte{1}, 53)) // handshake-key record
+	client := append(append(append([]byte(nil), helloRecord...), finished...), appRecord...)
+
+	sh := []byte{handshakeServerHello, 0, 0, 0, 3, 3}
+	sh = append(sh, make([]byte, 32)...)                         // random
+	sh = append(sh, 0, 0x13, 0x01, 0, 0, 6, 0, 0x2b, 0, 2, 3, 4) // session ID, suite, compression, supported_versions
+	sh[3] = byte(len(sh) - 4)
+	server := tlsRecordBytes(recordHandshake, sh)
+
+	// The client stream arrives in two segments, out of order
+	split := len(helloRecord) / 2
+	path := writePcap(t, [][]byte{
+		tcpFrame(1, 2, 50000, 443, 999, true, nil),
+		tcpFrame(2, 1, 443, 50000, 4999, true, nil),
+		tcpFrame(1, 2, 50000, 443, 1000+uint32(split), false, client[split:]),
+		tcpFrame(1, 2, 50000, 443, 1000, false, client[:split]),
+		tcpFrame(2, 1, 443, 50000, 5000, false, server),
+	})
+	keyLog := filepath.Join(t.TempDir(), "keys.log")
+	line := "CLIENT_TRAFFIC_SECRET_0 " + hex.EncodeToString(clientRandom(hello)) + " " + hex.EncodeToString(secret) + "\n"
+	if err := os.WriteFile(keyLog, []byte(line), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := loadPcap(path, keyLog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(c.clientHello, hello) {
+		t.Error("ClientHello not reassembled")
+	}
+	if c.protocol != "h2" || c.h2 == nil {
+		t.Fatalf("protocol %q, HTTP/2 spec %v", c.protocol, c.h2)
+	}
+	if got, want := c.h2.Akamai(), spec.Akamai(); got != want {
+		t.Errorf("Akamai = %q, want %q", got, want)
+	}
+	var names []string
+	for _, h := range c.headers {
+		names = append(names, h.Key)
+	}
+	if want := []string{"user-agent", "accept", "cookie"}; !slices.Equal(names, want) {
+		t.Errorf("headers = %v, want %v", names, want)
+	}
+
+	diffs, err := diffPreset(preset, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, d := range diffs {
+		if strings.HasPrefix(d, "ja4") || strings.HasPrefix(d, "akamai") || strings.HasPrefix(d, "cipher") {
+			t.Errorf("unexpected difference %s", d)
+		}
+	}
+}
+
+func TestDiffPreset(t *testing.T) {
+	preset := fingerprint.Get("firefox-133")
+	spec := preset.H2()
+	c := &capture{h2: &spec, protocol: "h2"}
+	for _, h := range preset.HeaderOrder {
+		value := h.Value
+		if h.Key == "user-agent" {
+			value = preset.UserAgent
+		}
+		c.headers = append(c.headers, fingerprint.HeaderPair{Key: h.Key, Value: value})
+	}
+	if diffs, err := diffPreset(preset, c); err != nil || len(diffs) > 0 {
+		t.Fatalf("preset differs from its own fingerprint: %v %v", diffs, err)
+	}
+
+	changed := spec
+	changed.ConnectionWindowUpdate++
+	c.h2 = &changed
+	c.headers = append(c.headers, fingerprint.HeaderPair{Key: "dnt", Value: "1"})
+	diffs, err := diffPreset(preset, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diffs) != 3 { // akamai, dnt value, header order
+		t.Errorf("diffs = %q, want akamai, header dnt and header order", diffs)
+	}
+
+	file, _, err := c.presetFile("firefox-next", "firefox-133")
+	if err != nil {
+		t.Fatal(err)
+	}
+	built, err := file.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := built.H2().Akamai(); got != changed.Akamai() {
+		t.Errorf("candidate Akamai = %q, want %q", got, changed.Akamai())
+	}
+}
+
+func TestReadHARAndQlog(t *testing.T) {
+	har := `{"log":{"entries":[
+		{"request":{"method":"GET","url":"https://cdn.example.com/a.js","httpVersion":"h3","headers":[]}},
+		{"request":{"method":"GET","url":"https://example.com/","httpVersion":"HTTP/2.0","headers":[
+			{"name":":method","value":"GET"},{"name":"User-Agent","value":"UA"},{"name":"Accept","value":"*/*"}]}}]}}`
+	req, err := readHAR(strings.NewReader(har), "://example.com/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.protocol != "h2" || len(req.headers) != 2 || req.headers[0].Key != "user-agent" {
+		t.Errorf("HAR request = %+v", req)
+	}
+
+	sqlog := "\x1e{\"qlog_version\":\"0.3\",\"qlog_format\":\"JSON-SEQ\"}\n" +
+		"\x1e{\"time\":0,\"name\":\"transport:parameters_set\",\"data\":{\"owner\":\"local\",\"initial_max_data\":15728640}}\n" +
+		"\x1e{\"time\":1,\"name\":\"transport:parameters_set\",\"data\":{\"owner\":\"remote\",\"initial_max_data\":1}}\n" +
+		"\x1e{\"time\":2,\"name\":\"http:parameters_set\",\"data\":{\"owner\":\"local\",\"settings\":[{\"name\":\"SETTINGS_QPACK_MAX_TABLE_CAPACITY\",\"value\":65536}]}}\n"
+	info, err := readQlog(strings.NewReader(sqlog))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.transportParams["initial_max_data"] != float64(15728640) {
+		t.Errorf("transport parameters = %v", info.transportParams)
+	}
+	if info.h3Settings["SETTINGS_QPACK_MAX_TABLE_CAPACITY"] != float64(65536) {
+		t.Errorf("HTTP/3 settings = %v", info.h3Settings)
+	}
+}
+
+// FuzzReadHAR checks that malformed HAR files fail cleanly
+func FuzzReadHAR(f *testing.F) {
+	f.Add(`{"log":{"entries":[{"request":{"method":"GET","url":"https://example.com/","httpVersion":"HTTP/2.0","headers":[{"name":"Accept","value":"*/*"}]}}]}}`, "example.com")
+	f.Add(`{"log":{"entries":[]}}`, "")
+	f.Add(`{"log":{"entries":[{"request":null}]}}`, "")
+
+	f.Fuzz(func(t *testing.T, har, match string) {
+		req, err := readHAR(strings.NewReader(har), match)
+		if err == nil && !strings.Contains(req.url, match) {
+			t.Fatalf("picked %q for match %q", req.url, match)
+		}
+	})
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/sardanioss/httpcloak/fingerprint"
+)
+
+type harFile struct {
+	Log struct {
+		Entries []struct {
+			Request struct {
+				Method      string `json:"method"`
+				URL         string `json:"url"`
+				HTTPVersion string `json:"httpVersion"`
+				Headers     []struct {
+					Name  string `json:"name"`
+					Value string `json:"value"`
+				} `json:"headers"`
+			} `json:"request"`
+		} `json:"entries"`
+	} `json:"log"`
+}
+
+// harRequest is the request picked from a HAR file
+type harRequest struct {
+	url      string
+	protocol string // "h1", "h2" or "h3"
+	headers  []fingerprint.HeaderPair
+}
+
+// readHAR returns the first request whose URL contains match. Pseudo-headers
+// are dropped: browsers don't record them in wire order.
+func readHAR(r io.Reader, match string) (*harRequest, error) {
+	var file harFile
+	if err := json.NewDecoder(r).Decode(&file); err != nil {
+		return nil, fmt.Errorf("har: %w", err)
+	}
+	for _, e := range file.Log.Entries {
+		if !strings.Contains(e.Request.URL, match) {
+			continue
+		}
+		req := &harRequest{url: e.Request.URL, protocol: harProtocol(e.Request.HTTPVersion)}
+		for _, h := range e.Request.Headers {
+			if !strings.HasPrefix(h.Name, ":") {
+				req.headers = append(req.headers, fingerprint.HeaderPair{Key: strings.ToLower(h.Name), Value: h.Value})
+			}
+		}
+		return req, nil
+	}
+	if match != "" {
+		return nil, fmt.Errorf("har: no request to a URL containing %q", match)
+	}
+	return nil, errors.New("har: no requests")
+}
+
+func harProtocol(version string) string {
+	switch strings.ToLower(version) {
+	case "h2", "http/2", "http/2.0":
+		return "h2"
+	case "h3", "http/3", "http/3.0", "h3-29":
+		return "h3"
+	}
+	return "h1"
+}
@@ -0,0 +1,181 @@
+// Command preset-capture turns a capture of a real browser into a candidate
+// httpcloak preset and shows how an existing preset differs from it.
+//
+// Inputs, in any combination:
+//
+//   - -pcap: a pcap or pcapng file with the browser's first TLS connection,
+//     for the ClientHello. With -keylog (an SSLKEYLOGFILE written by the
+//     browser) the connection's first request is decrypted for the HTTP/2
+//     fingerprint and header order; only TLS 1.3 can be decrypted.
+//   - -har: a HAR export, for the request headers of the first entry whose
+//     URL contains -url
+//   - -qlog: a qlog of an HTTP/3 connection, for the QUIC transport
+//     parameters and HTTP/3 SETTINGS
+//   - -akamai: an Akamai HTTP/2 fingerprint string (e.g. from tls.peet.ws)
+//     when the capture has no decrypted HTTP/2
+//
+// The candidate definition (see fingerprint.PresetFile) is written to -o or
+// stdout, differences from -preset to stderr. With -check the command exits
+// with status 1 when there are differences, so stored captures can serve as
+// snapshot tests for the presets:
+//
+//	SSLKEYLOGFILE=keys.log chrome --user-data-dir=$(mktemp -d) https://example.com
+//	preset-capture -pcap chrome.pcapng -keylog keys.log -preset chrome-latest -name chrome-146 -o chrome-146.json
+//	preset-capture -har firefox.har -qlog firefox.sqlog -preset firefox-133 -check
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/sardanioss/httpcloak/fingerprint"
+)
+
+func main() {
+	code, err := run(os.Args[1:], os.Stdout, os.Stderr)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "preset-capture:", err)
+	}
+	os.Exit(code)
+}
+
+func run(args []string, stdout, stderr io.Writer) (int, error) {
+	fs := flag.NewFlagSet("preset-capture", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	pcapPath := fs.String("pcap", "", "pcap or pcapng capture of the browser's TLS connection")
+	keyLogPath := fs.String("keylog", "", "SSLKEYLOGFILE to decrypt the captured connection with")
+	harPath := fs.String("har", "", "HAR export with the browser's requests")
+	urlMatch := fs.String("url", "", "use the first HAR request whose URL contains this")
+	qlogPath := fs.String("qlog", "", "qlog of the browser's HTTP/3 connection")
+	akamai := fs.String("akamai", "", "Akamai HTTP/2 fingerprint of the browser")
+	presetName := fs.String("preset", "", "existing preset to compare against and base the candidate on")
+	name := fs.String("name", "", "name of the candidate preset (default: <preset>-capture)")
+	out := fs.String("o", "", "write the candidate preset here instead of stdout")
+	check := fs.Bool("check", false, "exit with status 1 when the preset differs from the capture")
+	if err := fs.Parse(args); err != nil {
+		return 2, nil
+	}
+	if *pcapPath == "" && *harPath == "" && *qlogPath == "" && *akamai == "" {
+		fs.Usage()
+		return 2, errors.New("need at least one of -pcap, -har, -qlog and -akamai")
+	}
+
+	var preset *fingerprint.Preset
+	if *presetName != "" {
+		var ok bool
+		if preset, ok = fingerprint.Lookup(*presetName); !ok {
+			return 2, fmt.Errorf("unknown preset %q", *presetName)
+		}
+	}
+
+	c, err := load(*pcapPath, *keyLogPath, *harPath, *urlMatch, *qlogPath, *akamai)
+	if err != nil {
+		return 1, err
+	}
+
+	candidate := *name
+	if candidate == "" {
+		candidate = "capture"
+		if *presetName != "" {
+			candidate = *presetName + "-capture"
+		}
+	}
+	file, notes, err := c.presetFile(candidate, *presetName)
+	if err != nil {
+		return 1, err
+	}
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return 1, err
+	}
+	data = append(data, '\n')
+	if *out != "" {
+		err = os.WriteFile(*out, data, 0o644)
+	} else {
+		_, err = stdout.Write(data)
+	}
+	if err != nil {
+		return 1, err
+	}
+	for _, note := range notes {
+		fmt.Fprintln(stderr, "note:", note)
+	}
+
+	if preset == nil {
+		return 0, nil
+	}
+	diffs, err := diffPreset(preset, c)
+	if err != nil {
+		return 1, err
+	}
+	if len(diffs) == 0 {
+		fmt.Fprintf(stderr, "%s matches the capture\n", *presetName)
+		return 0, nil
+	}
+	fmt.Fprintf(stderr, "%s differs from the capture:\n", *presetName)
+	for _, d := range diffs {
+		fmt.Fprintln(stderr, " ", d)
+	}
+	if *check {
+		return 1, nil
+	}
+	return 0, nil
+}
+
+// load merges the given inputs into one capture. A decrypted pcap wins over
+// HAR headers and an Akamai string.
+func load(pcapPath, keyLogPath, harPath, urlMatch, qlogPath, akamai string) (*capture, error) {
+	c := &capture{}
+	if pcapPath != "" {
+		var err error
+		if c, err = loadPcap(pcapPath, keyLogPath); err != nil {
+			return nil, err
+		}
+	} else if keyLogPath != "" {
+		return nil, errors.New("-keylog needs -pcap")
+	}
+
+	if harPath != "" {
+		f, err := os.Open(harPath)
+		if err != nil {
+			return nil, err
+		}
+		req, err := readHAR(f, urlMatch)
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+		if c.headers == nil {
+			c.headers = req.headers
+		}
+		if c.protocol == "" {
+			c.protocol = req.protocol
+		}
+	}
+
+	if akamai != "" && c.h2 == nil {
+		spec, err := fingerprint.ParseAkamaiSpec(akamai)
+		if err != nil {
+			return nil, err
+		}
+		c.h2 = spec
+	}
+
+	if qlogPath != "" {
+		f, err := os.Open(qlogPath)
+		if err != nil {
+			return nil, err
+		}
+		info, err := readQlog(f)
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+		c.qlog = info
+	}
+	return c, nil
+}
@@ -0,0 +1,292 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+)
+
+// Link types handled by readPcap (https://www.tcpdump.org/linktypes.html)
+const (
+	linkNull     = 0
+	linkEthernet = 1
+	linkRaw      = 101
+	linkRawAlt   = 12
+	linkLinuxSLL = 113
+	linkLoop     = 108
+	linkSLL2     = 276
+)
+
+// tcpSegment is a TCP segment with payload, or a SYN
+type tcpSegment struct {
+	flow    string // "src:port->dst:port"
+	reverse string
+	seq     uint32
+	syn     bool
+	payload []byte
+}
+
+// readPcap reads the TCP segments of a pcap or pcapng file
+func readPcap(r io.Reader) ([]tcpSegment, error) {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(4)
+	if err != nil {
+		return nil, fmt.Errorf("pcap: %w", err)
+	}
+	if binary.BigEndian.Uint32(magic) == 0x0a0d0d0a {
+		return readPcapNG(br)
+	}
+	return readClassicPcap(br)
+}
+
+func readClassicPcap(r io.Reader) ([]tcpSegment, error) {
+	var header [24]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, fmt.Errorf("pcap: %w", err)
+	}
+	var order binary.ByteOrder
+	switch binary.LittleEndian.Uint32(header[:4]) {
+	case 0xa1b2c3d4, 0xa1b23c4d:
+		order = binary.LittleEndian
+	case 0xd4c3b2a1, 0x4d3cb2a1:
+		order = binary.BigEndian
+	default:
+		return nil, errors.New("pcap: not a pcap or pcapng file")
+	}
+	linkType := order.Uint32(header[20:24]) & 0x0fffffff
+
+	var segments []tcpSegment
+	var record [16]byte
+	for {
+		if _, err := io.ReadFull(r, record[:]); err == io.EOF {
+			return segments, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("pcap: %w", err)
+		}
+		data := make([]byte, order.Uint32(record[8:12]))
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, fmt.Errorf("pcap: %w", err)
+		}
+		if seg, ok := decodeFrame(linkType, data); ok {
+			segments = append(segments, seg)
+		}
+	}
+}
+
+func readPcapNG(r io.Reader) ([]tcpSegment, error) {
+	var order binary.ByteOrder = binary.LittleEndian
+	var linkTypes []uint32
+	var segments []tcpSegment
+	var header [8]byte
+	for {
+		if _, err := io.ReadFull(r, header[:]); err == io.EOF {
+			return segments, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("pcapng: %w", err)
+		}
+		blockType := order.Uint32(header[:4])
+		if binary.BigEndian.Uint32(header[:4]) == 0x0a0d0d0a {
+			// Section header: the byte-order magic follows the block length
+			var bom [4]byte
+			if _, err := io.ReadFull(r, bom[:]); err != nil {
+				return nil, fmt.Errorf("pcapng: %w", err)
+			}
+			if binary.LittleEndian.Uint32(bom[:]) == 0x1a2b3c4d {
+				order = binary.LittleEndian
+			} else {
+				order = binary.BigEndian
+			}
+			linkTypes = linkTypes[:0]
+			length := order.Uint32(header[4:8])
+			if length < 16 {
+				return nil, errors.New("pcapng: invalid section header")
+			}
+			if _, err := io.CopyN(io.Discard, r, int64(length)-12); err != nil {
+				return nil, fmt.Errorf("pcapng: %w", err)
+			}
+			continue
+		}
+		length := order.Uint32(header[4:8])
+		if length < 12 || length%4 != 0 {
+			return nil, fmt.Errorf("pcapng: invalid block length %d", length)
+		}
+		body := make([]byte, length-8)
+		if _, err := io.ReadFull(r, body); err != nil {
+			return nil, fmt.Errorf("pcapng: %w", err)
+		}
+		body = body[:len(body)-4] // trailing block length
+
+		switch blockType {
+		case 1: // Interface description
+			if len(body) >= 2 {
+				linkTypes = append(linkTypes, uint32(order.Uint16(body[:2])))
+			}
+		case 6: // Enhanced packet
+			if len(body) < 20 {
+				continue
+			}
+			iface := order.Uint32(body[:4])
+			captured := order.Uint32(body[12:16])
+			if int(iface) >= len(linkTypes) || int(captured) > len(body)-20 {
+				continue
+			}
+			if seg, ok := decodeFrame(linkTypes[iface], body[20:20+captured]); ok {
+				segments = append(segments, seg)
+			}
+		case 3: // Simple packet, on the first interface
+			if len(body) < 4 || len(linkTypes) == 0 {
+				continue
+			}
+			if seg, ok := decodeFrame(linkTypes[0], body[4:]); ok {
+				segments = append(segments, seg)
+			}
+		}
+	}
+}
+
+// decodeFrame extracts the TCP segment of a captured frame
+func decodeFrame(linkType uint32, data []byte) (tcpSegment, bool) {
+	var etherType uint16
+	switch linkType {
+	case linkEthernet:
+		if len(data) < 14 {
+			return tcpSegment{}, false
+		}
+		etherType, data = binary.BigEndian.Uint16(data[12:14]), data[14:]
+		for etherType == 0x8100 && len(data) >= 4 { // 802.1Q VLAN tags
+			etherType, data = binary.BigEndian.Uint16(data[2:4]), data[4:]
+		}
+	case linkLinuxSLL:
+		if len(data) < 16 {
+			return tcpSegment{}, false
+		}
+		etherType, data = binary.BigEndian.Uint16(data[14:16]), data[16:]
+	case linkSLL2:
+		if len(data) < 20 {
+			return tcpSegment{}, false
+		}
+		etherType, data = binary.BigEndian.Uint16(data[:2]), data[20:]
+	case linkNull, linkLoop:
+		if len(data) < 4 {
+			return tcpSegment{}, false
+		}
+		data = data[4:]
+	case linkRaw, linkRawAlt:
+	default:
+		return tcpSegment{}, false
+	}
+	if len(data) == 0 {
+		return tcpSegment{}, false
+	}
+	switch {
+	case etherType == 0x0800 || (etherType == 0 && data[0]>>4 == 4):
+		return decodeIPv4(data)
+	case etherType == 0x86dd || (etherType == 0 && data[0]>>4 == 6):
+		return decodeIPv6(data)
+	}
+	return tcpSegment{}, false
+}
+
+func decodeIPv4(data []byte) (tcpSegment, bool) {
+	if len(data) < 20 || data[9] != 6 {
+		return tcpSegment{}, false
+	}
+	ihl := int(data[0]&0x0f) * 4
+	total := int(binary.BigEndian.Uint16(data[2:4]))
+	if ihl < 20 || total < ihl || len(data) < total {
+		return tcpSegment{}, false
+	}
+	return decodeTCP(net.IP(data[12:16]), net.IP(data[16:20]), data[ihl:total])
+}
+
+func decodeIPv6(data []byte) (tcpSegment, bool) {
+	if len(data) < 40 || data[6] != 6 {
+		return tcpSegment{}, false
+	}
+	end := 40 + int(binary.BigEndian.Uint16(data[4:6]))
+	if len(data) < end {
+		return tcpSegment{}, false
+	}
+	return decodeTCP(net.IP(data[8:24]), net.IP(data[24:40]), data[40:end])
+}
+
+func decodeTCP(src, dst net.IP, data []byte) (tcpSegment, bool) {
+	if len(data) < 20 {
+		return tcpSegment{}, false
+	}
+	offset := int(data[12]>>4) * 4
+	if offset < 20 || offset > len(data) {
+		return tcpSegment{}, false
+	}
+	from := net.JoinHostPort(src.String(), strconv.Itoa(int(binary.BigEndian.Uint16(data[0:2]))))
+	to := net.JoinHostPort(dst.String(), strconv.Itoa(int(binary.BigEndian.Uint16(data[2:4]))))
+	seg := tcpSegment{
+		flow:    from + "->" + to,
+		reverse: to + "->" + from,
+		seq:     binary.BigEndian.Uint32(data[4:8]),
+		syn:     data[13]&0x02 != 0,
+		payload: data[offset:],
+	}
+	if !seg.syn && len(seg.payload) == 0 {
+		return tcpSegment{}, false
+	}
+	return seg, true
+}
+
+// reassemble returns each flow's byte stream, up to the first gap
+func reassemble(segments []tcpSegment) map[string][]byte {
+	type flowState struct {
+		isn     uint32
+		haveISN bool
+		parts   []tcpSegment
+	}
+	flows := make(map[string]*flowState)
+	for _, seg := range segments {
+		f := flows[seg.flow]
+		if f == nil {
+			f = &flowState{}
+			flows[seg.flow] = f
+		}
+		if seg.syn {
+			f.isn, f.haveISN = seg.seq+1, true
+			continue
+		}
+		f.parts = append(f.parts, seg)
+	}
+
+	streams := make(map[string][]byte, len(flows))
+	for name, f := range flows {
+		if len(f.parts) == 0 {
+			continue
+		}
+		if !f.haveISN {
+			// Capture started mid-connection: the earliest sequence number wins
+			f.isn = f.parts[0].seq
+			for _, p := range f.parts {
+				if int32(p.seq-f.isn) < 0 {
+					f.isn = p.seq
+				}
+			}
+		}
+		sort.SliceStable(f.parts, func(a, b int) bool {
+			return f.parts[a].seq-f.isn < f.parts[b].seq-f.isn
+		})
+		var stream []byte
+		for _, p := range f.parts {
+			off := int(p.seq - f.isn)
+			if off > len(stream) {
+				break
+			}
+			if end := off + len(p.payload); end > len(stream) {
+				stream = append(stream, p.payload[len(stream)-off:]...)
+			}
+		}
+		streams[name] = stream
+	}
+	return streams
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// qlogInfo is the client's own QUIC and HTTP/3 configuration from a qlog
+type qlogInfo struct {
+	transportParams map[string]any
+	h3Settings      map[string]any
+}
+
+type qlogEvent struct {
+	Name string         `json:"name"`
+	Data map[string]any `json:"data"`
+}
+
+// readQlog reads a qlog file (JSON, or JSON-SEQ / NDJSON as streamed by
+// neqo and quic-go) and returns the transport parameters and HTTP/3
+// SETTINGS the local endpoint sent
+func readQlog(r io.Reader) (*qlogInfo, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var events []qlogEvent
+	var file struct {
+		Traces []struct {
+			Events []qlogEvent `json:"events"`
+		} `json:"traces"`
+	}
+	if json.Unmarshal(data, &file) == nil && len(file.Traces) > 0 {
+		for _, trace := range file.Traces {
+			events = append(events, trace.Events...)
+		}
+	} else {
+		// JSON-SEQ separates records with RS (0x1e); NDJSON with newlines
+		dec := json.NewDecoder(bytes.NewReader(bytes.ReplaceAll(data, []byte{0x1e}, []byte{'\n'})))
+		for {
+			var e qlogEvent
+			if err := dec.Decode(&e); err == io.EOF {
+				break
+			} else if err != nil {
+				return nil, fmt.Errorf("qlog: %w", err)
+			}
+			events = append(events, e)
+		}
+	}
+
+	info := &qlogInfo{}
+	for _, e := range events {
+		if e.Data["owner"] != "local" {
+			continue
+		}
+		switch e.Name {
+		case "transport:parameters_set", "quic:parameters_set":
+			info.transportParams = qlogParams(e.Data, info.transportParams)
+		case "http:parameters_set", "h3:parameters_set":
+			info.h3Settings = qlogParams(e.Data, info.h3Settings)
+		}
+	}
+	if info.transportParams == nil && info.h3Settings == nil {
+		return nil, errors.New("qlog: no local transport parameters or HTTP/3 settings")
+	}
+	return info, nil
+}
+
+// qlogParams merges the parameters of a parameters_set event into params.
+// HTTP/3 settings come either as fields or as a "settings" list of
+// name/value pairs.
+func qlogParams(data map[string]any, params map[string]any) map[string]any {
+	if params == nil {
+		params = make(map[string]any)
+	}
+	for k, v := range data {
+		switch k {
+		case "owner":
+		case "settings":
+			list, _ := v.([]any)
+			for _, item := range list {
+				if s, ok := item.(map[string]any); ok {
+					if name, ok := s["name"].(string); ok {
+						params[name] = s["value"]
+					}
+				}
+			}
+		default:
+			params[k] = v
+		}
+	}
+	return params
+}
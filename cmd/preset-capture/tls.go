@@ -0,0 +1,230 @@
+package main
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hkdf"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"strings"
+
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+const (
+	recordChangeCipherSpec = 20
+	recordHandshake        = 22
+	recordApplicationData  = 23
+
+	handshakeClientHello = 1
+	handshakeServerHello = 2
+
+	extSupportedVersions = 0x002b
+)
+
+type tlsRecord struct {
+	typ    byte
+	header []byte
+	body   []byte
+}
+
+// tlsRecords splits a TLS byte stream into records, dropping a trailing
+// partial one
+func tlsRecords(stream []byte) []tlsRecord {
+	var records []tlsRecord
+	for len(stream) >= 5 {
+		n := int(binary.BigEndian.Uint16(stream[3:5]))
+		if len(stream) < 5+n {
+			break
+		}
+		records = append(records, tlsRecord{typ: stream[0], header: stream[:5], body: stream[5 : 5+n]})
+		stream = stream[5+n:]
+	}
+	return records
+}
+
+// isClientHelloStream reports whether stream starts with a ClientHello record
+func isClientHelloStream(stream []byte) bool {
+	return len(stream) > 5 && stream[0] == recordHandshake && stream[1] == 3 && stream[5] == handshakeClientHello
+}
+
+// firstHandshakeMessage returns the first handshake message of the stream
+// (which may span several records) if it has type typ
+func firstHandshakeMessage(records []tlsRecord, typ byte) ([]byte, error) {
+	var msg []byte
+	for _, r := range records {
+		if r.typ != recordHandshake {
+			break
+		}
+		msg = append(msg, r.body...)
+		if len(msg) >= 4 {
+			if msg[0] != typ {
+				return nil, fmt.Errorf("tls: handshake message %d, want %d", msg[0], typ)
+			}
+			if n := 4 + (int(msg[1])<<16 | int(msg[2])<<8 | int(msg[3])); len(msg) >= n {
+				return msg[:n], nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("tls: handshake message %d incomplete", typ)
+}
+
+// serverHello is what decryption needs from the ServerHello
+type serverHello struct {
+	cipherSuite uint16
+	tls13       bool
+}
+
+func parseServerHello(msg []byte) (serverHello, error) {
+	errShort := errors.New("tls: truncated ServerHello")
+	b := msg[4:]
+	if len(b) < 35 {
+		return serverHello{}, errShort
+	}
+	b = b[34:] // version and random
+	sid := int(b[0])
+	if len(b) < 1+sid+3 {
+		return serverHello{}, errShort
+	}
+	b = b[1+sid:]
+	sh := serverHello{cipherSuite: binary.BigEndian.Uint16(b)}
+	b = b[3:]
+	if len(b) < 2 {
+		return sh, nil
+	}
+	b = b[2:]
+	for len(b) >= 4 {
+		typ, n := binary.BigEndian.Uint16(b), int(binary.BigEndian.Uint16(b[2:]))
+		if len(b) < 4+n {
+			return serverHello{}, errShort
+		}
+		if typ == extSupportedVersions && n == 2 && binary.BigEndian.Uint16(b[4:]) == 0x0304 {
+			sh.tls13 = true
+		}
+		b = b[4+n:]
+	}
+	return sh, nil
+}
+
+// clientRandom returns the random of a ClientHello handshake message
+func clientRandom(hello []byte) []byte {
+	if len(hello) < 38 {
+		return nil
+	}
+	return hello[6:38]
+}
+
+// readKeyLog reads the client application traffic secrets of an
+// SSLKEYLOGFILE, keyed by hex client random
+func readKeyLog(r io.Reader) (map[string][]byte, error) {
+	secrets := make(map[string][]byte)
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) != 3 || fields[0] != "CLIENT_TRAFFIC_SECRET_0" {
+			continue
+		}
+		secret, err := hex.DecodeString(fields[2])
+		if err != nil {
+			return nil, fmt.Errorf("keylog: %w", err)
+		}
+		secrets[strings.ToLower(fields[1])] = secret
+	}
+	return secrets, sc.Err()
+}
+
+// decryptClientData decrypts the application data the client sent on a
+// TLS 1.3 connection
+func decryptClientData(records []tlsRecord, sh serverHello, secret []byte) ([]byte, error) {
+	if !sh.tls13 {
+		return nil, errors.New("tls: only TLS 1.3 connections can be decrypted")
+	}
+	var newHash func() hash.Hash
+	keyLen := 16
+	switch sh.cipherSuite {
+	case 0x1301:
+		newHash = sha256.New
+	case 0x1302:
+		newHash, keyLen = sha512.New384, 32
+	case 0x1303:
+		newHash, keyLen = sha256.New, 32
+	default:
+		return nil, fmt.Errorf("tls: unsupported cipher suite %#04x", sh.cipherSuite)
+	}
+	key, err := expandLabel(newHash, secret, "key", keyLen)
+	if err != nil {
+		return nil, err
+	}
+	iv, err := expandLabel(newHash, secret, "iv", 12)
+	if err != nil {
+		return nil, err
+	}
+	var aead cipher.AEAD
+	if sh.cipherSuite == 0x1303 {
+		aead, err = chacha20poly1305.New(key)
+	} else {
+		var block cipher.Block
+		if block, err = aes.NewCipher(key); err == nil {
+			aead, err = cipher.NewGCM(block)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// The client's first encrypted records (its Finished) use handshake
+	// keys; application data starts at the first record the traffic secret
+	// opens
+	var data []byte
+	var seq uint64
+	started := false
+	nonce := make([]byte, 12)
+	for _, r := range records {
+		if r.typ != recordApplicationData {
+			continue
+		}
+		copy(nonce, iv)
+		for i := 0; i < 8; i++ {
+			nonce[4+i] ^= byte(seq >> (56 - 8*i))
+		}
+		plain, err := aead.Open(nil, nonce, r.body, r.header)
+		if err != nil {
+			if started {
+				return nil, fmt.Errorf("tls: record %d: %w", seq, err)
+			}
+			continue
+		}
+		started = true
+		seq++
+		// Strip padding; the last non-zero byte is the real content type
+		i := len(plain) - 1
+		for i >= 0 && plain[i] == 0 {
+			i--
+		}
+		if i >= 0 && plain[i] == recordApplicationData {
+			data = append(data, plain[:i]...)
+		}
+	}
+	if !started {
+		return nil, errors.New("tls: no record opened with the key log secret")
+	}
+	return data, nil
+}
+
+// expandLabel is HKDF-Expand-Label from RFC 8446 section 7.1
+func expandLabel(newHash func() hash.Hash, secret []byte, label string, length int) ([]byte, error) {
+	full := "tls13 " + label
+	info := make([]byte, 0, 4+len(full))
+	info = binary.BigEndian.AppendUint16(info, uint16(length))
+	info = append(info, byte(len(full)))
+	info = append(info, full...)
+	info = append(info, 0) // empty context
+	return hkdf.Expand(newHash, secret, string(info), length)
+}
@@ -0,0 +1,105 @@
+package httpcloak
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeConfig(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadSessionConfig(t *testing.T) {
+	t.Setenv("HTTPCLOAK_TEST_PROXY", "http://proxy.example.com:8080")
+
+	yamlPath := writeConfig(t, "session.yaml", `
+preset: chrome-latest
+proxy: ${HTTPCLOAK_TEST_PROXY}
+timeout: 20s
+http_version: ${HTTPCLOAK_TEST_VERSION:-h2}
+retry:
+  count: 3
+  wait_min: 500ms
+  wait_max: 5
+  on_status: [429, 503]
+headers:
+  Accept-Language: de-DE
+`)
+	jsonPath := writeConfig(t, "session.json", `{
+	"preset": "chrome-latest",
+	"proxy": "${HTTPCLOAK_TEST_PROXY}",
+	"timeout": "20s",
+	"http_version": "h2",
+	"retry": {"count": 3, "wait_min": "500ms", "wait_max": 5, "on_status": [429, 503]},
+	"headers": {"Accept-Language": "de-DE"}
+}`)
+
+	for _, path := range []string{yamlPath, jsonPath} {
+		cfg, err := LoadSessionConfig(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cfg.Preset != "chrome-latest" || cfg.Proxy != "http://proxy.example.com:8080" || cfg.HTTPVersion != "h2" {
+			t.Errorf("%s: got %+v", filepath.Base(path), cfg)
+		}
+		if time.Duration(cfg.Timeout) != 20*time.Second || cfg.Retry == nil ||
+			time.Duration(cfg.Retry.WaitMin) != 500*time.Millisecond || time.Duration(cfg.Retry.WaitMax) != 5*time.Second {
+			t.Errorf("%s: durations not parsed: %+v", filepath.Base(path), cfg)
+		}
+		if cfg.Headers["Accept-Language"] != "de-DE" {
+			t.Errorf("%s: headers = %v", filepath.Base(path), cfg.Headers)
+		}
+	}
+}
+
+func TestLoadSessionConfigErrors(t *testing.T) {
+	for name, content := range map[string]string{
+		"unknown key":   "preset: chrome-latest\ntimout: 5s\n",
+		"missing env":   "preset: chrome-latest\nproxy: ${HTTPCLOAK_TEST_UNSET}\n",
+		"no preset":     "timeout: 5s\n",
+		"bad duration":  "preset: chrome-latest\ntimeout: soon\n",
+		"bad http mode": "preset: chrome-latest\nhttp_version: h4\n",
+	} {
+		if _, err := NewSessionFromConfig(writeConfig(t, "session.yaml", content)); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestNewSessionFromConfigHeaders(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Header.Get("X-Team") + "," + r.Header.Get("X-Run")))
+	}))
+	defer srv.Close()
+
+	path := writeConfig(t, "session.yaml", "preset: chrome-latest\nhttp_version: h1\nheaders:\n  X-Team: scraping\n  X-Run: nightly\n")
+	s, err := NewSessionFromConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	resp, err := s.Do(context.Background(), &Request{Method: "GET", URL: srv.URL, Headers: map[string][]string{"x-run": {"manual"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Close()
+	body, err := resp.Text()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.TrimSpace(body); got != "scraping,manual" {
+		t.Errorf("headers seen by server = %q, want session default and request override", got)
+	}
+}
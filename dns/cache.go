@@ -3,7 +3,9 @@ package dns
 import (
 	"context"
 	"encoding/base64"
+	"fmt"
 	"net"
+	"strings"
 	"sync"
 	"time"
 
@@ -22,6 +24,49 @@ func (e *Entry) IsExpired() bool {
 	return time.Now().After(e.ExpiresAt)
 }
 
+// IPFamily restricts resolved addresses to one address family
+type IPFamily int
+
+const (
+	IPFamilyAny  IPFamily = iota // IPv4 and IPv6 (default)
+	IPFamilyIPv4                 // IPv4 only
+	IPFamilyIPv6                 // IPv6 only
+)
+
+// ParseIPFamily parses "ipv4", "ipv6" or "" (any)
+func ParseIPFamily(name string) (IPFamily, error) {
+	switch strings.ToLower(name) {
+	case "":
+		return IPFamilyAny, nil
+	case "ipv4":
+		return IPFamilyIPv4, nil
+	case "ipv6":
+		return IPFamilyIPv6, nil
+	}
+	return IPFamilyAny, fmt.Errorf("unknown IP family %q (want ipv4 or ipv6)", name)
+}
+
+// matches reports whether ip belongs to the family
+func (f IPFamily) matches(ip net.IP) bool {
+	switch f {
+	case IPFamilyIPv4:
+		return ip.To4() != nil
+	case IPFamilyIPv6:
+		return ip.To4() == nil
+	}
+	return true
+}
+
+func (f IPFamily) String() string {
+	switch f {
+	case IPFamilyIPv4:
+		return "IPv4"
+	case IPFamilyIPv6:
+		return "IPv6"
+	}
+	return "any"
+}
+
 // Cache provides TTL-aware DNS caching
 type Cache struct {
 	entries    map[string]*Entry
@@ -30,6 +75,13 @@ type Cache struct {
 	defaultTTL time.Duration
 	minTTL     time.Duration
 	preferIPv4 bool // If true, prefer IPv4 over IPv6
+	family     IPFamily
+
+	// overrides pin hosts to addresses instead of resolving them
+	overrides map[string][]net.IP
+
+	// addressFilter rejects resolved addresses (e.g., SSRF protection)
+	addressFilter func(host string, ip net.IP) error
 }
 
 // NewCache creates a new DNS cache
@@ -63,11 +115,99 @@ func (c *Cache) PreferIPv4() bool {
 	return c.preferIPv4
 }
 
+// SetIPFamily restricts the addresses Resolve returns to one family. Cached
+// entries keep every address, so the family can be changed at any time.
+func (c *Cache) SetIPFamily(family IPFamily) {
+	c.mu.Lock()
+	c.family = family
+	c.mu.Unlock()
+}
+
+// IPFamily returns the address family resolution is restricted to
+func (c *Cache) IPFamily() IPFamily {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.family
+}
+
+// SetAddressFilter installs a check run on every resolved address before it is
+// returned. If the filter rejects any address, resolution fails with its error,
+// so callers never dial an address the filter hasn't approved. Pass nil to remove.
+func (c *Cache) SetAddressFilter(filter func(host string, ip net.IP) error) {
+	c.mu.Lock()
+	c.addressFilter = filter
+	c.mu.Unlock()
+}
+
 // Resolve looks up the IP addresses for a hostname
 // Returns cached result if available and not expired
 func (c *Cache) Resolve(ctx context.Context, host string) ([]net.IP, error) {
-	// Check cache first
+	ips, err := c.resolve(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+
 	c.mu.RLock()
+	filter := c.addressFilter
+	family := c.family
+	c.mu.RUnlock()
+	if family != IPFamilyAny {
+		var matching []net.IP
+		for _, ip := range ips {
+			if family.matches(ip) {
+				matching = append(matching, ip)
+			}
+		}
+		if len(matching) == 0 {
+			return nil, &net.DNSError{Err: "no " + family.String() + " addresses found", Name: host, IsNotFound: true}
+		}
+		ips = matching
+	}
+	if filter != nil {
+		for _, ip := range ips {
+			if err := filter(host, ip); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return ips, nil
+}
+
+// SetOverride pins host to ips instead of resolving it, like an /etc/hosts
+// entry. Nil ips removes the override. Overrides survive Clear and still go
+// through the address family and filter.
+func (c *Cache) SetOverride(host string, ips []net.IP) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(ips) == 0 {
+		delete(c.overrides, host)
+		return
+	}
+	if c.overrides == nil {
+		c.overrides = make(map[string][]net.IP)
+	}
+	c.overrides[host] = ips
+}
+
+// Overrides returns the addresses pinned with SetOverride, keyed by host
+func (c *Cache) Overrides() map[string][]net.IP {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	result := make(map[string][]net.IP, len(c.overrides))
+	for host, ips := range c.overrides {
+		result[host] = ips
+	}
+	return result
+}
+
+// resolve returns cached or freshly looked up addresses without filtering
+func (c *Cache) resolve(ctx context.Context, host string) ([]net.IP, error) {
+	// Check overrides, then the cache
+	c.mu.RLock()
+	if ips, ok := c.overrides[host]; ok {
+		c.mu.RUnlock()
+		return ips, nil
+	}
 	entry, exists := c.entries[host]
 	c.mu.RUnlock()
 
@@ -225,6 +365,34 @@ func (c *Cache) ResolveIPv6First(ctx context.Context, host string) (ipv6 []net.I
 	return ipv6, ipv4, nil
 }
 
+// Snapshot returns the unexpired cached addresses per hostname
+func (c *Cache) Snapshot() map[string][]net.IP {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	result := make(map[string][]net.IP, len(c.entries))
+	for host, entry := range c.entries {
+		if !entry.IsExpired() {
+			result[host] = entry.IPs
+		}
+	}
+	return result
+}
+
+// Seed caches addresses for host for ttl, e.g. ones another process resolved.
+// Existing unexpired entries are kept.
+func (c *Cache) Seed(host string, ips []net.IP, ttl time.Duration) {
+	if len(ips) == 0 || ttl <= 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if entry, ok := c.entries[host]; ok && !entry.IsExpired() {
+		return
+	}
+	now := time.Now()
+	c.entries[host] = &Entry{IPs: ips, ExpiresAt: now.Add(ttl), LookupAt: now}
+}
+
 // Invalidate removes a hostname from the cache
 func (c *Cache) Invalidate(host string) {
 	c.mu.Lock()
@@ -367,8 +535,13 @@ func FetchECHConfigs(ctx context.Context, hostname string) ([]byte, error) {
 	return echConfigList, nil
 }
 
-// queryECHFromDNS queries HTTPS records and extracts ECH config
+// queryECHFromDNS queries HTTPS records and extracts ECH config, over DoH
+// first and plain DNS if every DoH server fails
 func queryECHFromDNS(ctx context.Context, hostname string) ([]byte, uint32, error) {
+	if echConfig, ttl, err := queryECHFromDoH(ctx, hostname); err == nil {
+		return echConfig, ttl, nil
+	}
+
 	// Create DNS client with short timeout - ECH is optional, shouldn't block connections
 	client := &dns.Client{
 		Timeout: 500 * time.Millisecond, // Short timeout - ECH is optional
@@ -394,23 +567,9 @@ func queryECHFromDNS(ctx context.Context, hostname string) ([]byte, uint32, erro
 			continue
 		}
 
-		// Parse HTTPS records for ECH config
-		for _, answer := range resp.Answer {
-			if https, ok := answer.(*dns.HTTPS); ok {
-				for _, kv := range https.Value {
-					if kv.Key() == dns.SVCB_ECHCONFIG {
-						// ECH config is base64 encoded in the SVCB record
-						echParam, ok := kv.(*dns.SVCBECHConfig)
-						if ok && len(echParam.ECH) > 0 {
-							return echParam.ECH, https.Hdr.Ttl, nil
-						}
-					}
-				}
-			}
-		}
-
-		// No ECH found in this response, but query succeeded
-		return nil, 300, nil
+		// Parse HTTPS records for ECH config (nil if the query succeeded without one)
+		echConfig, ttl := echFromResponse(resp)
+		return echConfig, ttl, nil
 	}
 
 	return nil, 0, lastErr
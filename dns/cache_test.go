@@ -0,0 +1,52 @@
+package dns
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestIPFamily(t *testing.T) {
+	c := NewCache()
+	c.Seed("dual.example", []net.IP{net.ParseIP("2001:db8::1"), net.ParseIP("192.0.2.1")}, time.Minute)
+	c.Seed("v4.example", []net.IP{net.ParseIP("192.0.2.2")}, time.Minute)
+	ctx := context.Background()
+
+	if ips, _ := c.ResolveAllSorted(ctx, "dual.example"); len(ips) != 2 || ips[0].To4() != nil {
+		t.Errorf("default order = %v, want IPv6 first", ips)
+	}
+
+	c.SetIPFamily(IPFamilyIPv4)
+	if ips, err := c.ResolveAllSorted(ctx, "dual.example"); err != nil || len(ips) != 1 || !ips[0].Equal(net.ParseIP("192.0.2.1")) {
+		t.Errorf("IPv4 only = %v, %v", ips, err)
+	}
+
+	c.SetIPFamily(IPFamilyIPv6)
+	if ip, err := c.ResolveOne(ctx, "dual.example"); err != nil || ip.To4() != nil {
+		t.Errorf("IPv6 only = %v, %v", ip, err)
+	}
+	var dnsErr *net.DNSError
+	if _, err := c.Resolve(ctx, "v4.example"); !errors.As(err, &dnsErr) || !dnsErr.IsNotFound {
+		t.Errorf("err = %v, want a not-found DNS error", err)
+	}
+
+	if _, err := ParseIPFamily("ipv5"); err == nil {
+		t.Error("ParseIPFamily accepted ipv5")
+	}
+}
+
+func TestOverride(t *testing.T) {
+	c := NewCache()
+	c.Seed("pinned.example", []net.IP{net.ParseIP("192.0.2.1")}, time.Minute)
+	c.SetOverride("pinned.example", []net.IP{net.ParseIP("192.0.2.9")})
+	c.Clear()
+	if ips, err := c.Resolve(context.Background(), "pinned.example"); err != nil || len(ips) != 1 || !ips[0].Equal(net.ParseIP("192.0.2.9")) {
+		t.Errorf("overridden = %v, %v", ips, err)
+	}
+	c.SetOverride("pinned.example", nil)
+	if len(c.Overrides()) != 0 {
+		t.Error("override not removed")
+	}
+}
@@ -0,0 +1,141 @@
+package dns
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// Default DoH (RFC 8484) resolvers for ECH queries. Browsers only use ECH with
+// secure DNS, and an HTTPS record fetched over plain UDP leaks the very
+// hostname ECH is meant to hide.
+var (
+	echDoHServers   = []string{"https://cloudflare-dns.com/dns-query", "https://dns.google/dns-query"}
+	echDoHServersMu sync.RWMutex
+)
+
+// dohClient is shared so repeated ECH lookups reuse the resolver connection
+var dohClient = &http.Client{Timeout: 2 * time.Second}
+
+// retryConfigTTL is how long ECH retry_configs from a server are trusted
+const retryConfigTTL = time.Hour
+
+// SetECHDoHServers sets the DoH resolver URLs used for ECH config queries.
+// They are tried before the plain DNS servers (see SetECHDNSServers).
+// Pass an empty, non-nil slice to use plain DNS only, or nil to reset to defaults.
+func SetECHDoHServers(urls []string) {
+	echDoHServersMu.Lock()
+	defer echDoHServersMu.Unlock()
+	if urls == nil {
+		echDoHServers = []string{"https://cloudflare-dns.com/dns-query", "https://dns.google/dns-query"}
+	} else {
+		echDoHServers = append([]string{}, urls...)
+	}
+}
+
+// GetECHDoHServers returns the DoH resolver URLs used for ECH config queries.
+func GetECHDoHServers() []string {
+	echDoHServersMu.RLock()
+	defer echDoHServersMu.RUnlock()
+	return append([]string(nil), echDoHServers...)
+}
+
+// StoreECHConfigs caches an ECHConfigList for hostname, e.g. the retry_configs
+// a server sent after rejecting a stale config. A zero ttl uses one hour.
+func StoreECHConfigs(hostname string, configList []byte, ttl time.Duration) {
+	if ttl <= 0 {
+		ttl = retryConfigTTL
+	}
+	echCacheMu.Lock()
+	defer echCacheMu.Unlock()
+	echCache[hostname] = &ECHEntry{
+		ConfigList: configList,
+		ExpiresAt:  time.Now().Add(ttl),
+	}
+}
+
+// queryECHFromDoH queries the HTTPS record of hostname over DoH
+func queryECHFromDoH(ctx context.Context, hostname string) ([]byte, uint32, error) {
+	servers := GetECHDoHServers()
+	if len(servers) == 0 {
+		return nil, 0, errors.New("no DoH servers configured")
+	}
+
+	msg := new(dns.Msg)
+	msg.SetQuestion(dns.Fqdn(hostname), dns.TypeHTTPS)
+	msg.RecursionDesired = true
+	msg.Id = 0 // RFC 8484: use ID 0 for cache friendliness
+	query, err := msg.Pack()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var lastErr error
+	for _, server := range servers {
+		resp, err := exchangeDoH(ctx, server, query)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if resp.Rcode != dns.RcodeSuccess {
+			lastErr = fmt.Errorf("DoH %s: %s", server, dns.RcodeToString[resp.Rcode])
+			continue
+		}
+		echConfig, ttl := echFromResponse(resp)
+		return echConfig, ttl, nil
+	}
+	return nil, 0, lastErr
+}
+
+// exchangeDoH POSTs a wire-format DNS query to a DoH server
+func exchangeDoH(ctx context.Context, server string, query []byte) (*dns.Msg, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, server, bytes.NewReader(query))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/dns-message")
+	req.Header.Set("Accept", "application/dns-message")
+
+	resp, err := dohClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("DoH %s: HTTP %d", server, resp.StatusCode)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if err != nil {
+		return nil, err
+	}
+
+	msg := new(dns.Msg)
+	if err := msg.Unpack(body); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// echFromResponse extracts the ECHConfigList from HTTPS records. A response
+// without one returns nil with a 5 minute TTL.
+func echFromResponse(resp *dns.Msg) ([]byte, uint32) {
+	for _, answer := range resp.Answer {
+		https, ok := answer.(*dns.HTTPS)
+		if !ok {
+			continue
+		}
+		for _, kv := range https.Value {
+			if echParam, ok := kv.(*dns.SVCBECHConfig); ok && len(echParam.ECH) > 0 {
+				return echParam.ECH, https.Hdr.Ttl
+			}
+		}
+	}
+	return nil, 300
+}
@@ -0,0 +1,59 @@
+package dns
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestQueryECHFromDoH(t *testing.T) {
+	echConfig := []byte{0x00, 0x04, 0xfe, 0x0d, 0x00, 0x00}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Type") != "application/dns-message" {
+			t.Errorf("Content-Type = %q", r.Header.Get("Content-Type"))
+		}
+		body, _ := io.ReadAll(r.Body)
+		req := new(dns.Msg)
+		if err := req.Unpack(body); err != nil {
+			t.Errorf("unpack query: %v", err)
+			return
+		}
+		resp := new(dns.Msg)
+		resp.SetReply(req)
+		resp.Answer = append(resp.Answer, &dns.HTTPS{SVCB: dns.SVCB{
+			Hdr:      dns.RR_Header{Name: req.Question[0].Name, Rrtype: dns.TypeHTTPS, Class: dns.ClassINET, Ttl: 120},
+			Priority: 1,
+			Target:   ".",
+			Value:    []dns.SVCBKeyValue{&dns.SVCBECHConfig{ECH: echConfig}},
+		}})
+		out, _ := resp.Pack()
+		w.Header().Set("Content-Type", "application/dns-message")
+		w.Write(out)
+	}))
+	defer srv.Close()
+
+	SetECHDoHServers([]string{srv.URL})
+	defer SetECHDoHServers(nil)
+
+	got, ttl, err := queryECHFromDoH(context.Background(), "example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, echConfig) || ttl != 120 {
+		t.Errorf("got %x (ttl %d), want %x (ttl 120)", got, ttl, echConfig)
+	}
+}
+
+func TestStoreECHConfigs(t *testing.T) {
+	StoreECHConfigs("retry.example", []byte{1, 2, 3}, 0)
+	got, err := FetchECHConfigs(context.Background(), "retry.example")
+	if err != nil || !bytes.Equal(got, []byte{1, 2, 3}) {
+		t.Errorf("FetchECHConfigs = %x, %v", got, err)
+	}
+}
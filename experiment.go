@@ -0,0 +1,178 @@
+package httpcloak
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Variant is one arm of an Experiment: a preset plus session options
+type Variant struct {
+	Name    string // Label in the results (defaults to the preset name)
+	Preset  string
+	Options []SessionOption
+}
+
+// Experiment compares how targets treat different fingerprints. All variants
+// request each URL at the same time, so differences in block rate or latency
+// come from the variant rather than from when it ran. A round requests every
+// URL once; Samples rounds are run.
+//
+// Example:
+//
+//	exp := &httpcloak.Experiment{
+//	    Variants: []httpcloak.Variant{
+//	        {Preset: "chrome-latest"},
+//	        {Preset: "firefox-latest"},
+//	        {Name: "chrome-h1", Preset: "chrome-latest", Options: []httpcloak.SessionOption{httpcloak.WithForceHTTP1()}},
+//	    },
+//	    URLs:    []string{"https://example.com/", "https://example.com/search?q=test"},
+//	    Samples: 20,
+//	}
+//	results, err := exp.Run(ctx)
+//	for _, r := range results {
+//	    fmt.Printf("%-16s block=%.0f%% p50=%v\n", r.Name, 100*r.BlockRate(), r.Latency(0.5))
+//	}
+type Experiment struct {
+	Variants []Variant
+	URLs     []string
+
+	// Samples is how many times each URL is requested per variant (default 1)
+	Samples int
+
+	// Delay is the pause between rounds. The URLs within a round are
+	// requested back to back.
+	Delay time.Duration
+
+	// FreshSessions gives every request a new session instead of one session
+	// per variant, measuring first-visit treatment without cookies or resumption
+	FreshSessions bool
+
+	// Blocked reports whether a response means the variant was blocked.
+	// The body may be read. Nil counts 403, 429 and 503 as blocked;
+	// BlockClassifier.Blocked recognizes vendor block pages instead.
+	Blocked func(resp *Response) bool
+}
+
+// VariantResult summarizes the requests made by one variant
+type VariantResult struct {
+	Name      string
+	Requests  int
+	Errors    int         // Requests that failed without a response
+	Blocked   int         // Responses the Blocked check flagged
+	Statuses  map[int]int // Status code distribution
+	Latencies []time.Duration
+}
+
+// BlockRate is the fraction of requests that were blocked or failed
+func (r *VariantResult) BlockRate() float64 {
+	if r.Requests == 0 {
+		return 0
+	}
+	return float64(r.Blocked+r.Errors) / float64(r.Requests)
+}
+
+// Latency returns the latency at quantile q (0.5 = median) of successful requests
+func (r *VariantResult) Latency(q float64) time.Duration {
+	if len(r.Latencies) == 0 {
+		return 0
+	}
+	sorted := slices.Clone(r.Latencies)
+	slices.Sort(sorted)
+	i := int(q * float64(len(sorted)-1))
+	return sorted[max(0, min(i, len(sorted)-1))]
+}
+
+// Run executes the experiment and returns one result per variant, in order.
+// It stops early, returning the results so far, if ctx is cancelled.
+func (e *Experiment) Run(ctx context.Context) ([]*VariantResult, error) {
+	if len(e.Variants) == 0 || len(e.URLs) == 0 {
+		return nil, errors.New("experiment needs at least one variant and one URL")
+	}
+	samples := max(e.Samples, 1)
+	blocked := e.Blocked
+	if blocked == nil {
+		blocked = defaultBlocked
+	}
+
+	results := make([]*VariantResult, len(e.Variants))
+	sessions := make([]*Session, len(e.Variants))
+	for i, v := range e.Variants {
+		name := v.Name
+		if name == "" {
+			name = v.Preset
+		}
+		results[i] = &VariantResult{Name: name, Statuses: make(map[int]int)}
+		if !e.FreshSessions {
+			sessions[i] = NewSession(v.Preset, v.Options...)
+		}
+	}
+	defer func() {
+		for _, s := range sessions {
+			if s != nil {
+				s.Close()
+			}
+		}
+	}()
+
+	for round := 0; round < samples; round++ {
+		for _, url := range e.URLs {
+			if err := ctx.Err(); err != nil {
+				return results, err
+			}
+
+			var wg sync.WaitGroup
+			for i, v := range e.Variants {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					sess := sessions[i]
+					if sess == nil {
+						sess = NewSession(v.Preset, v.Options...)
+						defer sess.Close()
+					}
+					results[i].record(ctx, sess, url, blocked)
+				}()
+			}
+			wg.Wait()
+		}
+
+		if e.Delay > 0 && round < samples-1 {
+			select {
+			case <-time.After(e.Delay):
+			case <-ctx.Done():
+				return results, ctx.Err()
+			}
+		}
+	}
+	return results, nil
+}
+
+// record makes one request and adds its outcome to the result.
+// Each result is only touched by its own variant's goroutine.
+func (r *VariantResult) record(ctx context.Context, sess *Session, url string, blocked func(*Response) bool) {
+	r.Requests++
+	start := time.Now()
+	resp, err := sess.Get(ctx, url)
+	if err != nil {
+		r.Errors++
+		return
+	}
+	defer resp.Close()
+
+	r.Latencies = append(r.Latencies, time.Since(start))
+	r.Statuses[resp.StatusCode]++
+	if blocked(resp) {
+		r.Blocked++
+	}
+}
+
+func defaultBlocked(resp *Response) bool {
+	switch resp.StatusCode {
+	case 403, 429, 503:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,139 @@
+package httpcloak
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestExperimentRun(t *testing.T) {
+	var withCookie atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := r.Cookie("seen"); err == nil {
+			withCookie.Add(1)
+		}
+		http.SetCookie(w, &http.Cookie{Name: "seen", Value: "1", Path: "/"})
+		switch {
+		case r.URL.Path == "/limited":
+			w.WriteHeader(http.StatusTooManyRequests)
+		case strings.Contains(r.UserAgent(), "Firefox"):
+			w.WriteHeader(http.StatusForbidden)
+		}
+	}))
+	defer srv.Close()
+
+	exp := &Experiment{
+		Variants: []Variant{
+			{Preset: "chrome-latest", Options: []SessionOption{WithForceHTTP1()}},
+			{Name: "firefox", Preset: "firefox-latest", Options: []SessionOption{WithForceHTTP1()}},
+		},
+		URLs:    []string{srv.URL + "/page", srv.URL + "/limited"},
+		Samples: 2,
+	}
+	results, err := exp.Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	chrome, firefox := results[0], results[1]
+	if chrome.Name != "chrome-latest" || firefox.Name != "firefox" {
+		t.Errorf("names = %q, %q", chrome.Name, firefox.Name)
+	}
+	for _, r := range results {
+		if r.Requests != 4 || r.Errors != 0 || len(r.Latencies) != 4 {
+			t.Errorf("%s: %d requests, %d errors, %d latencies, want 4, 0, 4", r.Name, r.Requests, r.Errors, len(r.Latencies))
+		}
+	}
+	if chrome.Statuses[200] != 2 || chrome.Statuses[429] != 2 || chrome.Blocked != 2 || chrome.BlockRate() != 0.5 {
+		t.Errorf("chrome: statuses %v, %d blocked", chrome.Statuses, chrome.Blocked)
+	}
+	if firefox.Statuses[403] != 2 || firefox.Statuses[429] != 2 || firefox.Blocked != 4 || firefox.BlockRate() != 1 {
+		t.Errorf("firefox: statuses %v, %d blocked", firefox.Statuses, firefox.Blocked)
+	}
+	// One session per variant: every request after the first sends the cookie
+	if n := withCookie.Swap(0); n != 6 {
+		t.Errorf("%d requests with the cookie, want 6", n)
+	}
+
+	// FreshSessions never carries state over, and a custom check replaces
+	// the default statuses
+	exp.FreshSessions = true
+	exp.Blocked = func(resp *Response) bool { return resp.StatusCode == 403 }
+	results, err = exp.Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := withCookie.Load(); n != 0 {
+		t.Errorf("FreshSessions: %d requests with the cookie, want 0", n)
+	}
+	if results[0].Blocked != 0 || results[1].Blocked != 2 {
+		t.Errorf("custom Blocked: chrome %d, firefox %d, want 0 and 2", results[0].Blocked, results[1].Blocked)
+	}
+
+	// Requests that fail without a response count as errors
+	dead := httptest.NewServer(http.NotFoundHandler())
+	dead.Close()
+	results, err = (&Experiment{Variants: exp.Variants[:1], URLs: []string{dead.URL}}).Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r := results[0]; r.Requests != 1 || r.Errors != 1 || r.BlockRate() != 1 || r.Latency(0.5) != 0 {
+		t.Errorf("failed request: %+v", r)
+	}
+
+	if _, err := (&Experiment{URLs: exp.URLs}).Run(context.Background()); err == nil {
+		t.Error("expected an error without variants")
+	}
+}
+
+func TestExperimentDelay(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+	variants := []Variant{{Preset: "chrome-latest", Options: []SessionOption{WithForceHTTP1()}}}
+	urls := []string{srv.URL + "/1", srv.URL + "/2", srv.URL + "/3"}
+
+	// The delay comes between rounds, not after every URL
+	started := time.Now()
+	exp := &Experiment{Variants: variants, URLs: urls, Samples: 2, Delay: 300 * time.Millisecond}
+	if _, err := exp.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(started); elapsed < 300*time.Millisecond || elapsed > time.Second {
+		t.Errorf("2 rounds took %v, want one 300ms delay", elapsed)
+	}
+
+	// Cancelling during the delay returns the rounds so far
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(200*time.Millisecond, cancel)
+	started = time.Now()
+	exp.Delay = 5 * time.Second
+	results, err := exp.Run(ctx)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("err = %v, want context.Canceled", err)
+	}
+	if time.Since(started) > 2*time.Second {
+		t.Errorf("Run took %v after cancel", time.Since(started))
+	}
+	if results[0].Requests != len(urls) {
+		t.Errorf("%d requests before cancel, want one round of %d", results[0].Requests, len(urls))
+	}
+}
+
+func TestVariantResultLatency(t *testing.T) {
+	r := &VariantResult{Latencies: []time.Duration{5, 1, 3, 2, 4}}
+	for _, c := range []struct {
+		q    float64
+		want time.Duration
+	}{{0, 1}, {0.5, 3}, {0.9, 4}, {1, 5}, {2, 5}, {-1, 1}} {
+		if got := r.Latency(c.q); got != c.want {
+			t.Errorf("Latency(%v) = %v, want %v", c.q, got, c.want)
+		}
+	}
+	if got := (&VariantResult{}).Latency(0.5); got != 0 {
+		t.Errorf("Latency without requests = %v, want 0", got)
+	}
+}
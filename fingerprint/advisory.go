@@ -0,0 +1,102 @@
+package fingerprint
+
+import (
+	"slices"
+	"strings"
+	"sync"
+)
+
+// PresetStatus is machine-readable deprecation metadata for a preset.
+// Stale presets imitate browser versions that have been replaced by auto-update
+// and are now rare in real traffic, which makes them stand out.
+type PresetStatus struct {
+	Current     bool   `json:"current"`
+	Reason      string `json:"reason,omitempty"`      // Why the preset is stale
+	Replacement string `json:"replacement,omitempty"` // Preset to migrate to
+}
+
+// staleVersion marks every preset of a browser version as stale
+type staleVersion struct {
+	browser     string // Name token, e.g. "chrome"
+	version     string // Stale major version
+	replacement string // Major version to migrate to
+	reason      string
+}
+
+// staleVersions lists browser versions that are past end of life
+var staleVersions = []staleVersion{
+	{"chrome", "133", "145", "Chrome 133 is end of life"},
+	{"chrome", "141", "145", "Chrome 141 is end of life"},
+	{"chrome", "143", "145", "Chrome 143 is end of life"},
+	{"chrome", "144", "145", "Chrome 144 is end of life"},
+	{"firefox", "133", "147", "Firefox 133 is end of life"},
+	{"safari", "17", "18", "Safari 17 is end of life"},
+}
+
+var (
+	deprecationsMu sync.RWMutex
+	deprecations   = map[string]PresetStatus{} // Set with Deprecate
+)
+
+// Status returns the deprecation metadata of a preset and whether the preset exists.
+// Version names are matched against the built-in end-of-life list; the -latest
+// aliases are always current.
+//
+// Example:
+//
+//	if status, ok := fingerprint.Status(name); ok && !status.Current {
+//	    log.Printf("%s: %s, switch to %s", name, status.Reason, status.Replacement)
+//	}
+func Status(name string) (PresetStatus, bool) {
+	if _, ok := lookup(name); !ok {
+		return PresetStatus{}, false
+	}
+
+	deprecationsMu.RLock()
+	status, ok := deprecations[name]
+	deprecationsMu.RUnlock()
+	if ok {
+		return status, true
+	}
+
+	tokens := strings.Split(name, "-")
+	for _, stale := range staleVersions {
+		for i, token := range tokens {
+			if token != stale.version || !slices.Contains(tokens, stale.browser) {
+				continue
+			}
+			replaced := append([]string(nil), tokens...)
+			replaced[i] = stale.replacement
+			replacement := strings.Join(replaced, "-")
+			if _, ok := lookup(replacement); !ok {
+				replacement = stale.browser + "-latest"
+			}
+			return PresetStatus{Reason: stale.reason, Replacement: replacement}, true
+		}
+	}
+	return PresetStatus{Current: true}, true
+}
+
+// IsCurrent reports whether a preset still imitates a browser version in wide
+// use, and if not, which preset to migrate to. Unknown presets are not current
+// and have no replacement.
+func IsCurrent(name string) (current bool, replacement string) {
+	status, ok := Status(name)
+	if !ok {
+		return false, ""
+	}
+	return status.Current, status.Replacement
+}
+
+// Deprecate marks a preset (typically a registered custom one) as stale,
+// overriding the built-in metadata. An empty reason and replacement marks
+// it as current again.
+func Deprecate(name, replacement, reason string) {
+	deprecationsMu.Lock()
+	defer deprecationsMu.Unlock()
+	deprecations[name] = PresetStatus{
+		Current:     reason == "" && replacement == "",
+		Reason:      reason,
+		Replacement: replacement,
+	}
+}
@@ -0,0 +1,58 @@
+package fingerprint
+
+import "testing"
+
+func TestIsCurrent(t *testing.T) {
+	tests := []struct {
+		name        string
+		current     bool
+		replacement string
+	}{
+		{"chrome-145", true, ""},
+		{"chrome-latest", true, ""},
+		{"firefox-147", true, ""},
+		{"chrome-133", false, "chrome-145"},
+		{"chrome-143-windows", false, "chrome-145-windows"},
+		{"chrome-144-android-tablet", false, "chrome-145-android-tablet"},
+		{"ios-safari-17", false, "ios-safari-18"},
+		{"firefox-133", false, "firefox-147"},
+		{"no-such-preset", false, ""},
+	}
+	for _, tt := range tests {
+		current, replacement := IsCurrent(tt.name)
+		if current != tt.current || replacement != tt.replacement {
+			t.Errorf("IsCurrent(%q) = %v, %q; want %v, %q", tt.name, current, replacement, tt.current, tt.replacement)
+		}
+	}
+
+	// Every suggested replacement must exist and be current itself
+	for _, name := range Available() {
+		if _, replacement := IsCurrent(name); replacement != "" {
+			if ok, _ := IsCurrent(replacement); !ok {
+				t.Errorf("%s: replacement %s is not a current preset", name, replacement)
+			}
+		}
+	}
+}
+
+func TestDeprecate(t *testing.T) {
+	p, err := NewBuilder("custom-advisory").From("chrome-145").Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	Register("custom-advisory", p)
+	defer Unregister("custom-advisory")
+
+	if current, _ := IsCurrent("custom-advisory"); !current {
+		t.Fatal("custom preset should be current until deprecated")
+	}
+	Deprecate("custom-advisory", "chrome-latest", "superseded")
+	status, _ := Status("custom-advisory")
+	if status.Current || status.Replacement != "chrome-latest" || status.Reason != "superseded" {
+		t.Errorf("unexpected status after Deprecate: %+v", status)
+	}
+	Deprecate("custom-advisory", "", "")
+	if current, _ := IsCurrent("custom-advisory"); !current {
+		t.Error("Deprecate with empty values should mark the preset current again")
+	}
+}
@@ -93,25 +93,179 @@ func ParseAkamai(akamai string) (*HTTP2Settings, []string, error) {
 	}
 
 	// Parse pseudo-header order
+	pseudoOrder, err := parseAkamaiPseudoOrder(parts[3])
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return settings, pseudoOrder, nil
+}
+
+// parseAkamaiPseudoOrder parses the pseudo-header field ("m,a,s,p")
+func parseAkamaiPseudoOrder(field string) ([]string, error) {
+	if field == "" {
+		return nil, nil
+	}
 	var pseudoOrder []string
-	if parts[3] != "" {
-		chars := strings.Split(strings.TrimSpace(parts[3]), ",")
-		for _, ch := range chars {
-			ch = strings.TrimSpace(ch)
-			switch ch {
-			case "m":
-				pseudoOrder = append(pseudoOrder, ":method")
-			case "a":
-				pseudoOrder = append(pseudoOrder, ":authority")
-			case "s":
-				pseudoOrder = append(pseudoOrder, ":scheme")
-			case "p":
-				pseudoOrder = append(pseudoOrder, ":path")
-			default:
-				return nil, nil, fmt.Errorf("akamai: unknown pseudo-header identifier %q", ch)
+	chars := strings.Split(strings.TrimSpace(field), ",")
+	for _, ch := range chars {
+		ch = strings.TrimSpace(ch)
+		switch ch {
+		case "m":
+			pseudoOrder = append(pseudoOrder, ":method")
+		case "a":
+			pseudoOrder = append(pseudoOrder, ":authority")
+		case "s":
+			pseudoOrder = append(pseudoOrder, ":scheme")
+		case "p":
+			pseudoOrder = append(pseudoOrder, ":path")
+		default:
+			return nil, fmt.Errorf("akamai: unknown pseudo-header identifier %q", ch)
+		}
+	}
+	return pseudoOrder, nil
+}
+
+// ParseAkamaiSpec parses an Akamai HTTP/2 fingerprint string into the exact
+// wire form it describes. Unlike ParseAkamai, the SETTINGS frame keeps the
+// string's order and contains only the listed identifiers (unknown ones
+// included), and the PRIORITY field may list PRIORITY frames as
+// "stream:exclusive:dependency:weight" pairs separated by commas, as in
+// Firefox's legacy "3:0:0:201,5:0:0:101,...". "0" means no PRIORITY frames;
+// a bare weight such as "42" is read as the HEADERS priority weight, like
+// ParseAkamai does. The HEADERS priority is otherwise not part of the string
+// and is left nil.
+//
+// Example (Chrome): "1:65536;2:0;4:6291456;6:262144|15663105|0|m,a,s,p"
+func ParseAkamaiSpec(akamai string) (*H2Spec, error) {
+	parts := strings.Split(akamai, "|")
+	if len(parts) != 4 {
+		return nil, fmt.Errorf("akamai: expected 4 pipe-separated fields, got %d", len(parts))
+	}
+
+	spec := &H2Spec{}
+	for _, pair := range strings.Split(parts[0], ";") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		kv := strings.SplitN(pair, ":", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("akamai: invalid settings pair %q", pair)
+		}
+		id, err := strconv.ParseUint(strings.TrimSpace(kv[0]), 10, 16)
+		if err != nil {
+			return nil, fmt.Errorf("akamai: invalid settings id %q: %w", kv[0], err)
+		}
+		val, err := strconv.ParseUint(strings.TrimSpace(kv[1]), 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("akamai: invalid settings value %q: %w", kv[1], err)
+		}
+		spec.Settings = append(spec.Settings, H2Setting{ID: uint16(id), Value: uint32(val)})
+	}
+
+	if field := strings.TrimSpace(parts[1]); field != "" {
+		windowUpdate, err := strconv.ParseUint(field, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("akamai: invalid window update %q: %w", parts[1], err)
+		}
+		spec.ConnectionWindowUpdate = uint32(windowUpdate)
+	}
+
+	if field := strings.TrimSpace(parts[2]); field != "" && field != "0" {
+		if !strings.Contains(field, ":") {
+			weight, err := strconv.ParseUint(field, 10, 16)
+			if err != nil {
+				return nil, fmt.Errorf("akamai: invalid priority weight %q: %w", field, err)
+			}
+			spec.HeaderPriority = &H2Priority{Weight: uint16(weight), Exclusive: true}
+		} else {
+			for _, frame := range strings.Split(field, ",") {
+				f, err := parseAkamaiPriorityFrame(strings.TrimSpace(frame))
+				if err != nil {
+					return nil, err
+				}
+				spec.PriorityFrames = append(spec.PriorityFrames, f)
 			}
 		}
 	}
 
-	return settings, pseudoOrder, nil
+	pseudoOrder, err := parseAkamaiPseudoOrder(parts[3])
+	if err != nil {
+		return nil, err
+	}
+	spec.PseudoHeaderOrder = pseudoOrder
+
+	if err := spec.Validate(); err != nil {
+		return nil, fmt.Errorf("akamai: %w", err)
+	}
+	return spec, nil
+}
+
+// parseAkamaiPriorityFrame parses "stream:exclusive:dependency:weight"
+func parseAkamaiPriorityFrame(s string) (H2PriorityFrame, error) {
+	fields := strings.Split(s, ":")
+	if len(fields) != 4 {
+		return H2PriorityFrame{}, fmt.Errorf("akamai: invalid priority frame %q", s)
+	}
+	var nums [4]uint64
+	for i, field := range fields {
+		n, err := strconv.ParseUint(field, 10, 32)
+		if err != nil {
+			return H2PriorityFrame{}, fmt.Errorf("akamai: invalid priority frame %q: %w", s, err)
+		}
+		nums[i] = n
+	}
+	if nums[1] > 1 || nums[3] > 256 {
+		return H2PriorityFrame{}, fmt.Errorf("akamai: invalid priority frame %q", s)
+	}
+	return H2PriorityFrame{
+		StreamID: uint32(nums[0]),
+		Priority: H2Priority{Weight: uint16(nums[3]), Exclusive: nums[1] == 1, DependsOn: uint32(nums[2])},
+	}, nil
+}
+
+// Akamai returns the spec's Akamai HTTP/2 fingerprint string: the SETTINGS
+// frame in order, the connection WINDOW_UPDATE increment, the PRIORITY frames
+// ("0" when none are sent) and the pseudo-header order. The HEADERS priority
+// is not part of the string. Specs parsed by ParseAkamaiSpec format back to
+// the same string.
+func (s H2Spec) Akamai() string {
+	var b strings.Builder
+	for i, setting := range s.Settings {
+		if i > 0 {
+			b.WriteByte(';')
+		}
+		fmt.Fprintf(&b, "%d:%d", setting.ID, setting.Value)
+	}
+	fmt.Fprintf(&b, "|%d|", s.ConnectionWindowUpdate)
+
+	frames := s.PriorityFrames
+	if !s.SendsPriorityFraming() {
+		frames = nil
+	}
+	if len(frames) == 0 {
+		b.WriteByte('0')
+	}
+	for i, f := range frames {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		exclusive := 0
+		if f.Priority.Exclusive {
+			exclusive = 1
+		}
+		fmt.Fprintf(&b, "%d:%d:%d:%d", f.StreamID, exclusive, f.Priority.DependsOn, f.Priority.Weight)
+	}
+
+	b.WriteByte('|')
+	for i, name := range s.PseudoHeaderOrder {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		if len(name) > 1 {
+			b.WriteByte(name[1])
+		}
+	}
+	return b.String()
 }
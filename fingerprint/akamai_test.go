@@ -1,6 +1,7 @@
 package fingerprint
 
 import (
+	"reflect"
 	"testing"
 )
 
@@ -247,3 +248,66 @@ func TestParseAkamai_WithMaxFrameSize(t *testing.T) {
 		t.Errorf("MaxFrameSize: expected 16384, got %d", settings.MaxFrameSize)
 	}
 }
+
+func TestParseAkamaiSpec(t *testing.T) {
+	spec, err := ParseAkamaiSpec("1:65536;3:1000;4:6291456;9:1|15663105|3:0:0:201,9:1:7:1|m,p,a,s")
+	if err != nil {
+		t.Fatalf("ParseAkamaiSpec failed: %v", err)
+	}
+	wantSettings := []H2Setting{{1, 65536}, {3, 1000}, {4, 6291456}, {9, 1}}
+	if !reflect.DeepEqual(spec.Settings, wantSettings) {
+		t.Errorf("Settings = %v, want %v", spec.Settings, wantSettings)
+	}
+	if spec.ConnectionWindowUpdate != 15663105 {
+		t.Errorf("ConnectionWindowUpdate = %d, want 15663105", spec.ConnectionWindowUpdate)
+	}
+	wantFrames := []H2PriorityFrame{
+		{StreamID: 3, Priority: H2Priority{Weight: 201}},
+		{StreamID: 9, Priority: H2Priority{Weight: 1, Exclusive: true, DependsOn: 7}},
+	}
+	if !reflect.DeepEqual(spec.PriorityFrames, wantFrames) {
+		t.Errorf("PriorityFrames = %v, want %v", spec.PriorityFrames, wantFrames)
+	}
+	if spec.HeaderPriority != nil {
+		t.Errorf("HeaderPriority = %v, want nil", spec.HeaderPriority)
+	}
+	if want := []string{":method", ":path", ":authority", ":scheme"}; !reflect.DeepEqual(spec.PseudoHeaderOrder, want) {
+		t.Errorf("PseudoHeaderOrder = %v, want %v", spec.PseudoHeaderOrder, want)
+	}
+
+	weighted, err := ParseAkamaiSpec("1:65536|12517377|42|m,a,s,p")
+	if err != nil {
+		t.Fatalf("ParseAkamaiSpec failed: %v", err)
+	}
+	if p := weighted.HeaderPriority; p == nil || p.Weight != 42 || !p.Exclusive {
+		t.Errorf("bare weight: HeaderPriority = %v, want exclusive weight 42", p)
+	}
+
+	for _, bad := range []string{
+		"1:65536;1:4096|0|0|m,a,s,p",
+		"1:65536|0|3:0:0|m,a,s,p",
+		"1:65536|0|3:2:0:1|m,a,s,p",
+		"1:65536|0|3:0:0:0|m,a,s,p",
+		"1:65536|0|0|m,a,s",
+	} {
+		if _, err := ParseAkamaiSpec(bad); err == nil {
+			t.Errorf("ParseAkamaiSpec(%q): expected an error", bad)
+		}
+	}
+}
+
+func TestH2SpecAkamaiRoundTrip(t *testing.T) {
+	for _, s := range []string{
+		"1:65536;2:0;4:6291456;6:262144|15663105|0|m,a,s,p",
+		"1:65536;4:131072;5:16384|12517377|3:0:0:201,5:0:0:101,7:0:0:1,9:0:7:1,11:0:3:1,13:0:0:241|m,p,a,s",
+		"2:0;3:100;4:2097152;9:1|10420225|0|m,s,a,p",
+	} {
+		spec, err := ParseAkamaiSpec(s)
+		if err != nil {
+			t.Fatalf("%s: %v", s, err)
+		}
+		if got := spec.Akamai(); got != s {
+			t.Errorf("Akamai() = %q, want %q", got, s)
+		}
+	}
+}
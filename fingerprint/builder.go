@@ -0,0 +1,287 @@
+package fingerprint
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	tls "github.com/sardanioss/utls"
+)
+
+// Builder composes a custom Preset programmatically, either from scratch or
+// starting from an existing preset. Use it to track browser builds that ship
+// before the library adds a preset for them, then make the result available
+// by name with Register.
+//
+// Example:
+//
+//	preset, err := fingerprint.NewBuilder("chrome-146").
+//	    From("chrome-145").
+//	    UserAgent("Mozilla/5.0 ... Chrome/146.0.0.0 Safari/537.36").
+//	    Header("sec-ch-ua", `"Chromium";v="146", "Google Chrome";v="146", "Not-A.Brand";v="24"`).
+//	    Build()
+type Builder struct {
+	preset *Preset
+	err    error
+}
+
+// NewBuilder starts a new preset with the given name and Chrome-like HTTP/2 defaults.
+// Call From to inherit everything from an existing preset instead.
+func NewBuilder(name string) *Builder {
+	return &Builder{
+		preset: &Preset{
+			Name:    name,
+			Headers: make(map[string]string),
+			HTTP2Settings: HTTP2Settings{
+				HeaderTableSize:        65536,
+				InitialWindowSize:      6291456,
+				MaxFrameSize:           16384,
+				MaxHeaderListSize:      262144,
+				ConnectionWindowUpdate: 15663105,
+				StreamWeight:           256,
+				StreamExclusive:        true,
+			},
+		},
+	}
+}
+
+// From copies every setting from a built-in or registered preset, keeping the builder's name.
+func (b *Builder) From(base string) *Builder {
+	fn, ok := lookup(base)
+	if !ok {
+		b.err = errors.New("unknown base preset: " + base)
+		return b
+	}
+	name := b.preset.Name
+	b.preset = clonePreset(fn())
+	b.preset.Name = name
+	return b
+}
+
+// ClientHelloID sets the TLS fingerprint for TCP connections.
+func (b *Builder) ClientHelloID(id tls.ClientHelloID) *Builder {
+	b.preset.ClientHelloID = id
+	return b
+}
+
+// PSKClientHelloID sets the TLS fingerprint used when resuming sessions over TCP.
+func (b *Builder) PSKClientHelloID(id tls.ClientHelloID) *Builder {
+	b.preset.PSKClientHelloID = id
+	return b
+}
+
+// QUICClientHelloID sets the TLS fingerprints used for HTTP/3 and enables HTTP/3.
+func (b *Builder) QUICClientHelloID(id, pskID tls.ClientHelloID) *Builder {
+	b.preset.QUICClientHelloID = id
+	b.preset.QUICPSKClientHelloID = pskID
+	b.preset.SupportHTTP3 = true
+	return b
+}
+
+// CipherSuites overrides the cipher suite order of the ClientHelloID.
+func (b *Builder) CipherSuites(suites ...uint16) *Builder {
+	b.preset.CipherSuites = append([]uint16(nil), suites...)
+	return b
+}
+
+// ALPN overrides the ALPN protocols advertised over TCP (e.g., "h2", "http/1.1").
+func (b *Builder) ALPN(protocols ...string) *Builder {
+	b.preset.ALPN = append([]string(nil), protocols...)
+	return b
+}
+
+// PostQuantum sets whether X25519MLKEM768 is offered first in supported_groups
+// and key_share over TCP.
+func (b *Builder) PostQuantum(enabled bool) *Builder {
+	b.preset.PostQuantum = enabled
+	return b
+}
+
+// UserAgent sets the User-Agent header value.
+func (b *Builder) UserAgent(ua string) *Builder {
+	b.preset.UserAgent = ua
+	return b
+}
+
+// Header sets a default header. New headers are appended to the header order;
+// existing ones keep their position with the new value.
+func (b *Builder) Header(key, value string) *Builder {
+	lower := strings.ToLower(key)
+	for k := range b.preset.Headers {
+		if strings.ToLower(k) == lower {
+			delete(b.preset.Headers, k)
+		}
+	}
+	b.preset.Headers[key] = value
+
+	for i, hp := range b.preset.HeaderOrder {
+		if hp.Key == lower {
+			b.preset.HeaderOrder[i].Value = value
+			return b
+		}
+	}
+	b.preset.HeaderOrder = append(b.preset.HeaderOrder, HeaderPair{Key: lower, Value: value})
+	return b
+}
+
+// RemoveHeader removes a default header.
+func (b *Builder) RemoveHeader(key string) *Builder {
+	lower := strings.ToLower(key)
+	for k := range b.preset.Headers {
+		if strings.ToLower(k) == lower {
+			delete(b.preset.Headers, k)
+		}
+	}
+	order := b.preset.HeaderOrder[:0]
+	for _, hp := range b.preset.HeaderOrder {
+		if hp.Key != lower {
+			order = append(order, hp)
+		}
+	}
+	b.preset.HeaderOrder = order
+	return b
+}
+
+// HeaderOrder sets the wire order of headers (lowercase names).
+// Headers not listed keep their relative order after the listed ones.
+// Names without a default value (e.g., "user-agent", "cookie") act as ordering slots.
+func (b *Builder) HeaderOrder(keys ...string) *Builder {
+	values := make(map[string]string, len(b.preset.HeaderOrder))
+	for _, hp := range b.preset.HeaderOrder {
+		values[hp.Key] = hp.Value
+	}
+
+	order := make([]HeaderPair, 0, len(keys)+len(b.preset.HeaderOrder))
+	seen := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		lower := strings.ToLower(key)
+		if seen[lower] {
+			continue
+		}
+		seen[lower] = true
+		order = append(order, HeaderPair{Key: lower, Value: values[lower]})
+	}
+	for _, hp := range b.preset.HeaderOrder {
+		if !seen[hp.Key] {
+			order = append(order, hp)
+		}
+	}
+	b.preset.HeaderOrder = order
+	return b
+}
+
+// HTTP2Settings replaces the HTTP/2 SETTINGS and connection parameters.
+func (b *Builder) HTTP2Settings(settings HTTP2Settings) *Builder {
+	b.preset.HTTP2Settings = settings
+	return b
+}
+
+// H2Spec sets the exact HTTP/2 fingerprint: SETTINGS values and order,
+// connection WINDOW_UPDATE, HEADERS priority and pseudo-header order.
+// It takes precedence over HTTP2Settings on HTTP/2 connections.
+func (b *Builder) H2Spec(spec H2Spec) *Builder {
+	b.preset.H2Spec = &spec
+	return b
+}
+
+// H3Settings sets the HTTP/3 SETTINGS frame, replacing the defaults for the
+// browser type (see Preset.H3).
+func (b *Builder) H3Settings(settings H3Settings) *Builder {
+	if err := settings.Validate(); err != nil && b.err == nil {
+		b.err = fmt.Errorf("preset %s: %w", b.preset.Name, err)
+	}
+	settings.Additional = append([]H3Setting(nil), settings.Additional...)
+	b.preset.H3Settings = &settings
+	return b
+}
+
+// HTTP3 enables or disables HTTP/3 support.
+func (b *Builder) HTTP3(enabled bool) *Builder {
+	b.preset.SupportHTTP3 = enabled
+	return b
+}
+
+// Build validates and returns the composed preset.
+// The builder can be reused; later changes don't affect returned presets.
+func (b *Builder) Build() (*Preset, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+	if b.preset.Name == "" {
+		return nil, errors.New("preset name is required")
+	}
+	if b.preset.ClientHelloID.Client == "" {
+		return nil, errors.New("preset " + b.preset.Name + ": ClientHelloID is required")
+	}
+	if b.preset.SupportHTTP3 && b.preset.QUICClientHelloID.Client == "" {
+		return nil, errors.New("preset " + b.preset.Name + ": HTTP/3 requires a QUIC ClientHelloID")
+	}
+	return clonePreset(b.preset), nil
+}
+
+// clonePreset returns a deep copy of a preset
+func clonePreset(p *Preset) *Preset {
+	c := *p
+	c.Headers = make(map[string]string, len(p.Headers))
+	for k, v := range p.Headers {
+		c.Headers[k] = v
+	}
+	c.HeaderOrder = append([]HeaderPair(nil), p.HeaderOrder...)
+	c.CipherSuites = append([]uint16(nil), p.CipherSuites...)
+	c.ALPN = append([]string(nil), p.ALPN...)
+	// Nil and empty orders mean different things, so they're cloned as is
+	c.HTTP2Settings.SettingsOrder = slices.Clone(p.HTTP2Settings.SettingsOrder)
+	c.HTTP2Settings.PseudoHeaderOrder = slices.Clone(p.HTTP2Settings.PseudoHeaderOrder)
+	if p.H2Spec != nil {
+		spec := *p.H2Spec
+		spec.Settings = slices.Clone(spec.Settings)
+		spec.PseudoHeaderOrder = slices.Clone(spec.PseudoHeaderOrder)
+		spec.PriorityFrames = slices.Clone(spec.PriorityFrames)
+		if spec.HeaderPriority != nil {
+			priority := *spec.HeaderPriority
+			spec.HeaderPriority = &priority
+		}
+		c.H2Spec = &spec
+	}
+	if p.H3Settings != nil {
+		settings := *p.H3Settings
+		settings.Additional = slices.Clone(settings.Additional)
+		c.H3Settings = &settings
+	}
+	return &c
+}
+
+// HasTLSOverrides reports whether the preset customizes the ClientHelloID's
+// cipher suites, ALPN or post-quantum key exchange.
+func (p *Preset) HasTLSOverrides() bool {
+	return len(p.CipherSuites) > 0 || len(p.ALPN) > 0 || p.PostQuantum
+}
+
+// ApplyTLSOverrides rewrites a ClientHelloSpec generated from the preset's
+// ClientHelloID with the preset's cipher suite, ALPN and post-quantum overrides.
+func (p *Preset) ApplyTLSOverrides(spec *tls.ClientHelloSpec) {
+	if spec == nil {
+		return
+	}
+	if len(p.CipherSuites) > 0 {
+		suites := make([]uint16, 0, len(p.CipherSuites)+1)
+		// Keep the leading GREASE value so the hello still looks like the original browser
+		if len(spec.CipherSuites) > 0 && isGREASE(spec.CipherSuites[0]) {
+			suites = append(suites, spec.CipherSuites[0])
+		}
+		suites = append(suites, p.CipherSuites...)
+		spec.CipherSuites = suites
+	}
+	if len(p.ALPN) > 0 {
+		for _, ext := range spec.Extensions {
+			if alpn, ok := ext.(*tls.ALPNExtension); ok {
+				alpn.AlpnProtocols = append([]string(nil), p.ALPN...)
+				break
+			}
+		}
+	}
+	if p.PostQuantum {
+		SetPostQuantum(spec, true)
+	}
+}
@@ -0,0 +1,208 @@
+package fingerprint
+
+import (
+	"slices"
+	"sync"
+
+	tls "github.com/sardanioss/utls"
+)
+
+// ShuffleMode controls how the TLS extension order varies
+type ShuffleMode int
+
+const (
+	// ShufflePerSession picks one random extension order per session and
+	// reuses it for every connection, like Chrome (default)
+	ShufflePerSession ShuffleMode = iota
+
+	// ShufflePerConnection picks a new extension order for every TCP connection.
+	// HTTP/3 caches its ClientHello per session and keeps one order.
+	ShufflePerConnection
+
+	// ShuffleOff sends extensions in the ClientHelloID's canonical order
+	ShuffleOff
+)
+
+// ExtensionControl fine-tunes the GREASE values and extension order of the
+// ClientHellos generated from a preset. Some detectors look at how much the
+// extension order varies across a session; the zero value keeps the default
+// behavior of one shuffled order per session.
+type ExtensionControl struct {
+	Shuffle ShuffleMode
+
+	// DisableGREASE removes GREASE cipher suites, extensions, groups, key
+	// shares and versions (RFC 8701). Only useful to imitate non-browser clients.
+	DisableGREASE bool
+
+	// PinnedPositions moves extensions (by ID) to fixed positions in the
+	// extension list after shuffling. Negative positions count from the end
+	// (-1 is last). Positions count GREASE and padding extensions.
+	//
+	// Example: {0x0000: 1, 0x0029: -1} puts server_name second and
+	// pre_shared_key last.
+	PinnedPositions map[uint16]int
+}
+
+// Spec returns the ClientHelloSpec for id with the control applied. seed is
+// the session's shuffle seed. A nil control behaves like the zero value.
+func (c *ExtensionControl) Spec(id tls.ClientHelloID, seed int64) (tls.ClientHelloSpec, error) {
+	mode := ShufflePerSession
+	if c != nil {
+		mode = c.Shuffle
+	}
+
+	spec, err := tls.UTLSIdToSpec(id)
+	if err != nil {
+		return spec, err
+	}
+	switch mode {
+	case ShufflePerConnection:
+		spec.Extensions = tls.ShuffleChromeTLSExtensions(spec.Extensions)
+	case ShuffleOff:
+		canonicalizeExtensions(id, spec.Extensions)
+	default:
+		// Some ClientHelloIDs come back already shuffled; start the seeded
+		// shuffle from a fixed order so the seed alone decides the result
+		canonicalizeExtensions(id, spec.Extensions)
+		spec.Extensions = tls.ShuffleChromeTLSExtensionsWithSeed(spec.Extensions, seed)
+	}
+	c.Apply(&spec)
+	return spec, nil
+}
+
+// randomizedIDs caches whether a ClientHelloID's spec has a random extension order
+var randomizedIDs sync.Map // tls.ClientHelloID -> bool
+
+// canonicalizeExtensions sorts the shufflable extensions of a randomized
+// ClientHelloID by ID, leaving GREASE, padding and pre_shared_key in place.
+// Specs with a fixed order are left alone.
+func canonicalizeExtensions(id tls.ClientHelloID, exts []tls.TLSExtension) {
+	randomized, ok := randomizedIDs.Load(id)
+	if !ok {
+		a, errA := tls.UTLSIdToSpec(id)
+		b, errB := tls.UTLSIdToSpec(id)
+		randomized = errA == nil && errB == nil && !slices.Equal(extensionIDs(a.Extensions), extensionIDs(b.Extensions))
+		randomizedIDs.Store(id, randomized)
+	}
+	if !randomized.(bool) {
+		return
+	}
+
+	var movable []int
+	for i, ext := range exts {
+		switch ext.(type) {
+		case *tls.UtlsGREASEExtension, *tls.UtlsPaddingExtension, tls.PreSharedKeyExtension:
+		default:
+			movable = append(movable, i)
+		}
+	}
+	sorted := make([]tls.TLSExtension, len(movable))
+	for i, idx := range movable {
+		sorted[i] = exts[idx]
+	}
+	slices.SortStableFunc(sorted, func(a, b tls.TLSExtension) int {
+		idA, _ := extensionID(a)
+		idB, _ := extensionID(b)
+		return int(idA) - int(idB)
+	})
+	for i, idx := range movable {
+		exts[idx] = sorted[i]
+	}
+}
+
+func extensionIDs(exts []tls.TLSExtension) []uint16 {
+	ids := make([]uint16, len(exts))
+	for i, ext := range exts {
+		ids[i], _ = extensionID(ext)
+	}
+	return ids
+}
+
+// Apply removes GREASE and pins extension positions in an existing spec
+// (e.g., one built from JA3 or a raw ClientHello). Shuffle is not applied.
+func (c *ExtensionControl) Apply(spec *tls.ClientHelloSpec) {
+	if c == nil || spec == nil {
+		return
+	}
+	if c.DisableGREASE {
+		removeGREASE(spec)
+	}
+	if len(c.PinnedPositions) > 0 {
+		spec.Extensions = pinExtensions(spec.Extensions, c.PinnedPositions)
+	}
+}
+
+// removeGREASE strips GREASE placeholders from every part of the spec
+func removeGREASE(spec *tls.ClientHelloSpec) {
+	spec.CipherSuites = deleteGREASE(spec.CipherSuites, func(v uint16) uint16 { return v })
+
+	exts := spec.Extensions[:0]
+	for _, ext := range spec.Extensions {
+		switch e := ext.(type) {
+		case *tls.UtlsGREASEExtension:
+			continue
+		case *tls.SupportedCurvesExtension:
+			e.Curves = deleteGREASE(e.Curves, func(v tls.CurveID) uint16 { return uint16(v) })
+		case *tls.KeyShareExtension:
+			e.KeyShares = deleteGREASE(e.KeyShares, func(v tls.KeyShare) uint16 { return uint16(v.Group) })
+		case *tls.SupportedVersionsExtension:
+			e.Versions = deleteGREASE(e.Versions, func(v uint16) uint16 { return v })
+		}
+		exts = append(exts, ext)
+	}
+	spec.Extensions = exts
+}
+
+func deleteGREASE[T any](values []T, id func(T) uint16) []T {
+	kept := values[:0]
+	for _, v := range values {
+		if !isGREASE(id(v)) {
+			kept = append(kept, v)
+		}
+	}
+	return kept
+}
+
+// pinExtensions moves the pinned extensions to their positions, keeping the
+// relative order of the rest. Pins that collide take the next free slot.
+func pinExtensions(exts []tls.TLSExtension, pins map[uint16]int) []tls.TLSExtension {
+	n := len(exts)
+	slots := make([]tls.TLSExtension, n)
+	var rest []tls.TLSExtension
+	for _, ext := range exts {
+		id, ok := extensionID(ext)
+		pos, pinned := pins[id]
+		if !ok || !pinned {
+			rest = append(rest, ext)
+			continue
+		}
+		if pos < 0 {
+			pos += n
+		}
+		pos = max(0, min(pos, n-1))
+		for slots[pos] != nil {
+			pos = (pos + 1) % n
+		}
+		slots[pos] = ext
+	}
+	for i := range slots {
+		if slots[i] == nil {
+			slots[i], rest = rest[0], rest[1:]
+		}
+	}
+	return slots
+}
+
+// extensionID returns the wire ID of an extension. GREASE and padding have
+// no fixed ID and can't be pinned.
+func extensionID(ext tls.TLSExtension) (uint16, bool) {
+	switch ext.(type) {
+	case *tls.UtlsGREASEExtension, *tls.UtlsPaddingExtension:
+		return 0, false
+	}
+	buf := make([]byte, ext.Len())
+	if n, _ := ext.Read(buf); n < 2 {
+		return 0, false
+	}
+	return uint16(buf[0])<<8 | uint16(buf[1]), true
+}
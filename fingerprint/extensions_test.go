@@ -0,0 +1,78 @@
+package fingerprint
+
+import (
+	"net"
+	"slices"
+	"testing"
+
+	tls "github.com/sardanioss/utls"
+)
+
+// rawHelloFromSpec marshals the ClientHello utls sends for spec
+func rawHelloFromSpec(t *testing.T, spec tls.ClientHelloSpec) []byte {
+	t.Helper()
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	conn := tls.UClient(client, &tls.Config{ServerName: "example.com"}, tls.HelloCustom)
+	if err := conn.ApplyPreset(&spec); err != nil {
+		t.Fatalf("ApplyPreset: %v", err)
+	}
+	if err := conn.BuildHandshakeState(); err != nil {
+		t.Fatalf("BuildHandshakeState: %v", err)
+	}
+	return conn.HandshakeState.Hello.Raw
+}
+
+// helloFromSpec parses the ClientHello utls sends for spec
+func helloFromSpec(t *testing.T, spec tls.ClientHelloSpec) *clientHelloFields {
+	t.Helper()
+	hello, err := parseClientHello(rawHelloFromSpec(t, spec))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return hello
+}
+
+func TestExtensionControl(t *testing.T) {
+	id := tls.HelloChrome_133
+
+	ctl := &ExtensionControl{
+		Shuffle:         ShuffleOff,
+		DisableGREASE:   true,
+		PinnedPositions: map[uint16]int{extServerName: 0, extALPN: -1},
+	}
+	spec, err := ctl.Spec(id, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hello := helloFromSpec(t, spec)
+
+	if slices.ContainsFunc(hello.cipherSuites, isGREASE) || slices.ContainsFunc(hello.extensions, isGREASE) ||
+		slices.ContainsFunc(hello.supportedVersions, isGREASE) {
+		t.Errorf("GREASE left in ClientHello: ciphers %x, extensions %x", hello.cipherSuites, hello.extensions)
+	}
+	if hello.extensions[0] != extServerName {
+		t.Errorf("first extension = %#04x, want server_name", hello.extensions[0])
+	}
+	if last := hello.extensions[len(hello.extensions)-1]; last != extALPN {
+		t.Errorf("last extension = %#04x, want ALPN", last)
+	}
+
+	// Unshuffled order is stable across connections
+	again, _ := ctl.Spec(id, 2)
+	if got := helloFromSpec(t, again); !slices.Equal(got.extensions, hello.extensions) {
+		t.Errorf("ShuffleOff order changed: %x vs %x", got.extensions, hello.extensions)
+	}
+
+	// Per-session shuffle reuses the seed's order; a nil control matches the default
+	var nilCtl *ExtensionControl
+	a, _ := nilCtl.Spec(id, 42)
+	b, _ := (&ExtensionControl{}).Spec(id, 42)
+	orderA := slices.DeleteFunc(helloFromSpec(t, a).extensions, isGREASE)
+	orderB := slices.DeleteFunc(helloFromSpec(t, b).extensions, isGREASE)
+	if !slices.Equal(orderA, orderB) {
+		t.Error("per-session shuffle with the same seed produced different orders")
+	}
+}
@@ -0,0 +1,122 @@
+package fingerprint
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"math/rand"
+	"net"
+	"testing"
+
+	tls "github.com/sardanioss/utls"
+)
+
+// The golden tests pin the exact bytes the fingerprint code produces, so a
+// difference in encoding between architectures (arm64, big-endian s390x)
+// shows up as a failure rather than a fingerprint that quietly changed.
+// They run under `make test-arch`.
+
+// seededClientHello marshals the ClientHello for id with a fixed shuffle
+// seed and random source
+func seededClientHello(t *testing.T, id tls.ClientHelloID) []byte {
+	t.Helper()
+	spec, err := (*ExtensionControl)(nil).Spec(id, 42)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	conn := tls.UClient(client, &tls.Config{ServerName: "example.com", Rand: rand.New(rand.NewSource(1))}, tls.HelloCustom)
+	if err := conn.ApplyPreset(&spec); err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.BuildHandshakeState(); err != nil {
+		t.Fatalf("BuildHandshakeState: %v", err)
+	}
+	return conn.HandshakeState.Hello.Raw
+}
+
+// canonicalHello strips what stays random however the hello is seeded: the
+// key shares' public keys are zeroed, and the GREASE ECH payload and the
+// padding that depends on its length are dropped, leaving each extension's
+// type. The handshake header and extension lengths go with them.
+func canonicalHello(t *testing.T, raw []byte) []byte {
+	t.Helper()
+	fail := func() []byte {
+		t.Fatalf("malformed ClientHello % x", raw)
+		return nil
+	}
+	if len(raw) < 4+2+32+1 {
+		return fail()
+	}
+	body := raw[4:]
+	rest := body[2+32:]
+	rest = rest[1+int(rest[0]):] // session ID
+	if len(rest) < 2 {
+		return fail()
+	}
+	rest = rest[2+int(binary.BigEndian.Uint16(rest)):] // cipher suites
+	rest = rest[1+int(rest[0]):]                       // compression methods
+	exts := rest[2:]
+	out := bytes.Clone(body[:len(body)-len(rest)])
+
+	for len(exts) >= 4 {
+		id := binary.BigEndian.Uint16(exts)
+		length := int(binary.BigEndian.Uint16(exts[2:]))
+		if len(exts) < 4+length {
+			return fail()
+		}
+		data := bytes.Clone(exts[4 : 4+length])
+		exts = exts[4+length:]
+
+		out = binary.BigEndian.AppendUint16(out, id)
+		switch id {
+		case 0xfe0d, 0x0015: // encrypted_client_hello, padding
+			continue
+		case 0x0033: // key_share
+			shares := data[2:]
+			for len(shares) >= 4 {
+				n := int(binary.BigEndian.Uint16(shares[2:]))
+				clear(shares[4 : 4+n])
+				shares = shares[4+n:]
+			}
+		}
+		out = append(out, data...)
+	}
+	return out
+}
+
+func TestClientHelloGolden(t *testing.T) {
+	tests := []struct {
+		id   tls.ClientHelloID
+		ja4  string
+		hash string
+	}{
+		{tls.HelloChrome_133, "t13d1516h2_8daaf6152771_d8a2da3f94cd", "12d221dc055c6acf926303f7f51d843848f3bf5e4bcb32b6551114b1f7b32914"},
+		{tls.HelloFirefox_120, "t13d1715h2_5b57614c22b0_5c2c66f702b0", "1cb1acc854c61813f701bd1238f00517d63663537777f7a109b8ad1d2a4e4a2a"},
+		{tls.HelloSafari_Auto, "t13d2013h2_a09f3c656075_7f0f34a4126d", "225e5c66f03f6aa57e7bf92f05c102e2cc08d7f381c856d3fe8329a4c40c89e3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.id.Str(), func(t *testing.T) {
+			raw := seededClientHello(t, tt.id)
+			canon := canonicalHello(t, raw)
+			if again := canonicalHello(t, seededClientHello(t, tt.id)); !bytes.Equal(canon, again) {
+				t.Fatal("ClientHello not reproducible with a fixed seed")
+			}
+			sum := sha256.Sum256(canon)
+			if hash := hex.EncodeToString(sum[:]); hash != tt.hash {
+				t.Errorf("ClientHello SHA-256 = %s, want %s", hash, tt.hash)
+			}
+			ja4, err := JA4(raw, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ja4 != tt.ja4 {
+				t.Errorf("JA4 = %s, want %s", ja4, tt.ja4)
+			}
+		})
+	}
+}
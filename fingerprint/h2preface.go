@@ -0,0 +1,137 @@
+package fingerprint
+
+import (
+	"encoding/binary"
+	"errors"
+
+	"github.com/sardanioss/net/http2/hpack"
+)
+
+// HTTP/2 frame types and flags read by ParseH2Preface (RFC 9113 section 6)
+const (
+	h2FrameHeaders      = 0x1
+	h2FramePriority     = 0x2
+	h2FrameSettings     = 0x4
+	h2FrameWindowUpdate = 0x8
+	h2FrameContinuation = 0x9
+
+	h2FlagAck        = 0x1
+	h2FlagEndHeaders = 0x4
+	h2FlagPadded     = 0x8
+	h2FlagPriority   = 0x20
+)
+
+const h2ClientPreface = "PRI * HTTP/2.0\r\n\r\nSM\r\n\r\n"
+
+// ErrH2PrefaceIncomplete is returned by ParseH2Preface when data ends before
+// the first request's header block does
+var ErrH2PrefaceIncomplete = errors.New("http2: preface incomplete")
+
+// ParseH2Preface reads the client side of an HTTP/2 connection, from the
+// connection preface to the end of the first request's header block, and
+// returns the fingerprint it shows along with the request's regular headers
+// in wire order. It returns ErrH2PrefaceIncomplete when more data is needed.
+func ParseH2Preface(data []byte) (H2Spec, []HeaderPair, error) {
+	var spec H2Spec
+	if len(data) < len(h2ClientPreface) {
+		return spec, nil, ErrH2PrefaceIncomplete
+	}
+	if string(data[:len(h2ClientPreface)]) != h2ClientPreface {
+		return spec, nil, errors.New("http2: missing client connection preface")
+	}
+	data = data[len(h2ClientPreface):]
+
+	var block []byte
+	inHeaders := false
+	for len(data) >= 9 {
+		length := int(data[0])<<16 | int(data[1])<<8 | int(data[2])
+		typ, flags := data[3], data[4]
+		streamID := binary.BigEndian.Uint32(data[5:9]) & (1<<31 - 1)
+		if len(data) < 9+length {
+			return spec, nil, ErrH2PrefaceIncomplete
+		}
+		payload := data[9 : 9+length]
+		data = data[9+length:]
+
+		if inHeaders && typ != h2FrameContinuation {
+			return spec, nil, errors.New("http2: header block interrupted")
+		}
+		switch typ {
+		case h2FrameSettings:
+			if flags&h2FlagAck != 0 || streamID != 0 {
+				continue
+			}
+			for ; len(payload) >= 6; payload = payload[6:] {
+				spec.Settings = append(spec.Settings, H2Setting{
+					ID:    binary.BigEndian.Uint16(payload),
+					Value: binary.BigEndian.Uint32(payload[2:]),
+				})
+			}
+		case h2FrameWindowUpdate:
+			if streamID == 0 && len(payload) == 4 {
+				spec.ConnectionWindowUpdate = binary.BigEndian.Uint32(payload) & (1<<31 - 1)
+			}
+		case h2FramePriority:
+			if len(payload) == 5 {
+				spec.PriorityFrames = append(spec.PriorityFrames, H2PriorityFrame{
+					StreamID: streamID,
+					Priority: parseH2Priority(payload),
+				})
+			}
+		case h2FrameHeaders:
+			if flags&h2FlagPadded != 0 {
+				if len(payload) < 1 || int(payload[0]) >= len(payload) {
+					return spec, nil, errors.New("http2: invalid HEADERS padding")
+				}
+				payload = payload[1 : len(payload)-int(payload[0])]
+			}
+			if flags&h2FlagPriority != 0 {
+				if len(payload) < 5 {
+					return spec, nil, errors.New("http2: short HEADERS priority")
+				}
+				p := parseH2Priority(payload)
+				spec.HeaderPriority = &p
+				payload = payload[5:]
+			}
+			block = append(block, payload...)
+			inHeaders = flags&h2FlagEndHeaders == 0
+		case h2FrameContinuation:
+			block = append(block, payload...)
+			inHeaders = flags&h2FlagEndHeaders == 0
+		}
+		if (typ == h2FrameHeaders || typ == h2FrameContinuation) && !inHeaders {
+			headers, err := decodeH2Headers(&spec, block)
+			return spec, headers, err
+		}
+	}
+	return spec, nil, ErrH2PrefaceIncomplete
+}
+
+func parseH2Priority(p []byte) H2Priority {
+	dep := binary.BigEndian.Uint32(p)
+	return H2Priority{
+		Weight:    uint16(p[4]) + 1,
+		Exclusive: dep>>31 == 1,
+		DependsOn: dep & (1<<31 - 1),
+	}
+}
+
+// decodeH2Headers sets spec.PseudoHeaderOrder from a request header block
+// and returns the regular headers
+func decodeH2Headers(spec *H2Spec, block []byte) ([]HeaderPair, error) {
+	var headers []HeaderPair
+	dec := hpack.NewDecoder(1<<20, func(f hpack.HeaderField) {
+		if f.IsPseudo() {
+			spec.PseudoHeaderOrder = append(spec.PseudoHeaderOrder, f.Name)
+		} else {
+			headers = append(headers, HeaderPair{Key: f.Name, Value: f.Value})
+		}
+	})
+	if _, err := dec.Write(block); err != nil {
+		return nil, err
+	}
+	if err := dec.Close(); err != nil {
+		return nil, err
+	}
+	return headers, nil
+}
@@ -0,0 +1,230 @@
+package fingerprint
+
+import (
+	"errors"
+	"fmt"
+)
+
+// H2Setting is one parameter of the HTTP/2 SETTINGS frame
+type H2Setting struct {
+	ID    uint16
+	Value uint32
+}
+
+// H2Priority is the stream priority carried in HEADERS frames (RFC 7540 section 5.3)
+type H2Priority struct {
+	Weight    uint16 // 1-256; sent on the wire as Weight-1
+	Exclusive bool
+	DependsOn uint32
+}
+
+// H2PriorityFrame is a PRIORITY frame sent after the connection preface,
+// typically to build a tree of idle streams that later requests depend on
+type H2PriorityFrame struct {
+	StreamID uint32
+	Priority H2Priority
+}
+
+// H2PriorityScheme selects how HTTP/2 requests signal their priority
+type H2PriorityScheme string
+
+const (
+	// H2PriorityDefault sends what the spec configures: HEADERS priority,
+	// PRIORITY frames and the preset's Priority header alike
+	H2PriorityDefault H2PriorityScheme = ""
+	// H2PriorityRFC7540 signals priority only in HTTP/2 framing (HEADERS
+	// priority and PRIORITY frames) and drops the Priority header, like
+	// browsers from before RFC 9218
+	H2PriorityRFC7540 H2PriorityScheme = "rfc7540"
+	// H2PriorityRFC9218 signals priority only with the Priority header; HEADERS
+	// frames carry no priority and no PRIORITY frames are sent
+	H2PriorityRFC9218 H2PriorityScheme = "rfc9218"
+)
+
+// H2Spec is the complete HTTP/2 fingerprint of a client in wire form: the
+// parts of the connection preface and request framing that Akamai-style
+// fingerprints hash. Set Preset.H2Spec to send exactly this instead of the
+// values derived from HTTP2Settings.
+type H2Spec struct {
+	// Settings is the SETTINGS frame, in wire order. Only these are sent.
+	Settings []H2Setting
+
+	// ConnectionWindowUpdate is the WINDOW_UPDATE increment sent on stream 0
+	// after the preface; 0 sends none
+	ConnectionWindowUpdate uint32
+
+	// HeaderPriority is sent in every HEADERS frame. Nil clears the PRIORITY
+	// flag, as browsers implementing RFC 9218 priorities do.
+	HeaderPriority *H2Priority
+
+	// PseudoHeaderOrder is the order of :method, :authority, :scheme and :path
+	PseudoHeaderOrder []string
+
+	// PriorityFrames are sent right after the preface, before any request.
+	// Note that HeaderPriority is the same for every stream of a connection;
+	// per-request weights like Chrome's are not reproduced.
+	PriorityFrames []H2PriorityFrame
+
+	// PriorityScheme chooses between HTTP/2 priority framing and the RFC 9218
+	// Priority header
+	PriorityScheme H2PriorityScheme
+}
+
+// FirefoxPriorityTree returns the spec with the idle-stream priority tree
+// Firefox built before it adopted RFC 9218 (Akamai:
+// 3:0:0:201,5:0:0:101,7:0:0:1,9:0:7:1,11:0:3:1,13:0:0:241). Requests
+// depend on stream 13 with weight 42 and the Priority header is dropped.
+func (s H2Spec) FirefoxPriorityTree() H2Spec {
+	s.PriorityFrames = []H2PriorityFrame{
+		{StreamID: 3, Priority: H2Priority{Weight: 201}},
+		{StreamID: 5, Priority: H2Priority{Weight: 101}},
+		{StreamID: 7, Priority: H2Priority{Weight: 1}},
+		{StreamID: 9, Priority: H2Priority{Weight: 1, DependsOn: 7}},
+		{StreamID: 11, Priority: H2Priority{Weight: 1, DependsOn: 3}},
+		{StreamID: 13, Priority: H2Priority{Weight: 241}},
+	}
+	s.HeaderPriority = &H2Priority{Weight: 42, DependsOn: 13}
+	s.PriorityScheme = H2PriorityRFC7540
+	return s
+}
+
+// SendsPriorityFraming reports whether HEADERS priority and PRIORITY frames
+// go on the wire
+func (s H2Spec) SendsPriorityFraming() bool {
+	return s.PriorityScheme != H2PriorityRFC9218
+}
+
+// SendsPriorityHeader reports whether HTTP/2 requests keep the Priority header
+func (s H2Spec) SendsPriorityHeader() bool {
+	return s.PriorityScheme != H2PriorityRFC7540
+}
+
+// Validate reports specs that can't be put on the wire
+func (s H2Spec) Validate() error {
+	seen := make(map[uint16]bool, len(s.Settings))
+	for _, setting := range s.Settings {
+		if seen[setting.ID] {
+			return fmt.Errorf("duplicate HTTP/2 setting %d", setting.ID)
+		}
+		seen[setting.ID] = true
+	}
+	if s.ConnectionWindowUpdate > 1<<31-1 {
+		return errors.New("HTTP/2 window update increment exceeds 2^31-1")
+	}
+	if p := s.HeaderPriority; p != nil {
+		if err := p.validate(); err != nil {
+			return err
+		}
+	}
+	for _, f := range s.PriorityFrames {
+		if f.StreamID == 0 || f.StreamID > 1<<31-1 {
+			return fmt.Errorf("invalid PRIORITY frame stream %d", f.StreamID)
+		}
+		if f.StreamID == f.Priority.DependsOn {
+			return fmt.Errorf("stream %d can't depend on itself", f.StreamID)
+		}
+		if err := f.Priority.validate(); err != nil {
+			return err
+		}
+	}
+	switch s.PriorityScheme {
+	case H2PriorityDefault, H2PriorityRFC7540, H2PriorityRFC9218:
+	default:
+		return fmt.Errorf("unknown HTTP/2 priority scheme %q", s.PriorityScheme)
+	}
+	if len(s.PseudoHeaderOrder) > 0 {
+		if err := ValidatePseudoHeaderOrder(s.PseudoHeaderOrder); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ValidatePseudoHeaderOrder checks that order lists :method, :authority,
+// :scheme and :path exactly once each
+func ValidatePseudoHeaderOrder(order []string) error {
+	want := map[string]bool{":method": true, ":authority": true, ":scheme": true, ":path": true}
+	for _, name := range order {
+		if !want[name] {
+			return fmt.Errorf("invalid or repeated pseudo-header %q", name)
+		}
+		delete(want, name)
+	}
+	if len(want) > 0 {
+		return errors.New("pseudo-header order must list :method, :authority, :scheme and :path")
+	}
+	return nil
+}
+
+func (p H2Priority) validate() error {
+	if p.Weight < 1 || p.Weight > 256 {
+		return fmt.Errorf("HTTP/2 priority weight %d is outside 1-256", p.Weight)
+	}
+	if p.DependsOn > 1<<31-1 {
+		return errors.New("HTTP/2 priority dependency exceeds 2^31-1")
+	}
+	return nil
+}
+
+// H2 returns the HTTP/2 fingerprint the preset sends: H2Spec when set,
+// otherwise the spec derived from HTTP2Settings
+func (p *Preset) H2() H2Spec {
+	if p.H2Spec != nil {
+		return *p.H2Spec
+	}
+	return p.HTTP2Settings.Spec()
+}
+
+// SetH2PriorityScheme switches the preset's HTTP/2 fingerprint to scheme
+func (p *Preset) SetH2PriorityScheme(scheme H2PriorityScheme) {
+	spec := p.H2()
+	spec.PriorityScheme = scheme
+	p.H2Spec = &spec
+}
+
+// Spec returns the wire form of the settings. Without SettingsOrder the
+// SETTINGS frame follows Chrome: HEADER_TABLE_SIZE, ENABLE_PUSH,
+// INITIAL_WINDOW_SIZE and MAX_HEADER_LIST_SIZE, then MAX_CONCURRENT_STREAMS,
+// MAX_FRAME_SIZE and NO_RFC7540_PRIORITIES when set. Without
+// PseudoHeaderOrder, presets with NoRFC7540Priorities use Safari's
+// pseudo-header order and others Chrome's.
+func (s HTTP2Settings) Spec() H2Spec {
+	order := s.SettingsOrder
+	if len(order) == 0 {
+		order = []uint16{H2SettingHeaderTableSize, H2SettingEnablePush, H2SettingInitialWindowSize, H2SettingMaxHeaderListSize}
+		if s.MaxConcurrentStreams > 0 {
+			order = append(order, H2SettingMaxConcurrentStreams)
+		}
+		if s.MaxFrameSize > 0 {
+			order = append(order, H2SettingMaxFrameSize)
+		}
+		if s.NoRFC7540Priorities {
+			order = append(order, H2SettingNoRFC7540Priorities)
+		}
+	}
+	spec := H2Spec{
+		Settings:               make([]H2Setting, 0, len(order)),
+		ConnectionWindowUpdate: s.ConnectionWindowUpdate,
+		PseudoHeaderOrder:      s.PseudoHeaderOrder,
+		PriorityScheme:         s.PriorityScheme,
+	}
+	for _, id := range order {
+		spec.Settings = append(spec.Settings, H2Setting{ID: id, Value: s.SettingValue(id)})
+	}
+
+	// A zero StreamWeight has always gone out as 256
+	weight := s.StreamWeight
+	if weight == 0 {
+		weight = 256
+	}
+	spec.HeaderPriority = &H2Priority{Weight: weight, Exclusive: s.StreamExclusive}
+
+	if len(spec.PseudoHeaderOrder) == 0 {
+		if s.NoRFC7540Priorities {
+			spec.PseudoHeaderOrder = []string{":method", ":scheme", ":path", ":authority"}
+		} else {
+			spec.PseudoHeaderOrder = []string{":method", ":authority", ":scheme", ":path"}
+		}
+	}
+	return spec
+}
@@ -0,0 +1,94 @@
+package fingerprint
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestHTTP2SettingsSpec(t *testing.T) {
+	settings := HTTP2Settings{
+		HeaderTableSize:        65536,
+		InitialWindowSize:      6291456,
+		MaxHeaderListSize:      262144,
+		ConnectionWindowUpdate: 15663105,
+		StreamWeight:           256,
+		StreamExclusive:        true,
+	}
+	want := H2Spec{
+		Settings: []H2Setting{
+			{H2SettingHeaderTableSize, 65536},
+			{H2SettingEnablePush, 0},
+			{H2SettingInitialWindowSize, 6291456},
+			{H2SettingMaxHeaderListSize, 262144},
+		},
+		ConnectionWindowUpdate: 15663105,
+		HeaderPriority:         &H2Priority{Weight: 256, Exclusive: true},
+		PseudoHeaderOrder:      []string{":method", ":authority", ":scheme", ":path"},
+	}
+	if got := settings.Spec(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Spec() = %+v, want %+v", got, want)
+	}
+
+	settings.NoRFC7540Priorities = true
+	spec := settings.Spec()
+	if last := spec.Settings[len(spec.Settings)-1]; last != (H2Setting{H2SettingNoRFC7540Priorities, 1}) {
+		t.Errorf("last setting = %+v, want NO_RFC7540_PRIORITIES=1", last)
+	}
+	if !reflect.DeepEqual(spec.PseudoHeaderOrder, []string{":method", ":scheme", ":path", ":authority"}) {
+		t.Errorf("pseudo-header order = %v, want Safari's", spec.PseudoHeaderOrder)
+	}
+}
+
+func TestPresetH2(t *testing.T) {
+	p := Get("chrome-latest")
+	if !reflect.DeepEqual(p.H2(), p.HTTP2Settings.Spec()) {
+		t.Error("H2() without H2Spec should derive from HTTP2Settings")
+	}
+	custom := H2Spec{Settings: []H2Setting{{H2SettingInitialWindowSize, 1 << 20}}}
+	p.H2Spec = &custom
+	if !reflect.DeepEqual(p.H2(), custom) {
+		t.Error("H2() should return H2Spec when set")
+	}
+}
+
+func TestH2SpecValidate(t *testing.T) {
+	valid := Get("chrome-latest").H2()
+	if err := valid.Validate(); err != nil {
+		t.Fatalf("preset spec invalid: %v", err)
+	}
+	if err := valid.FirefoxPriorityTree().Validate(); err != nil {
+		t.Fatalf("Firefox priority tree invalid: %v", err)
+	}
+	for name, spec := range map[string]H2Spec{
+		"duplicate setting": {Settings: []H2Setting{{1, 4096}, {1, 65536}}},
+		"zero weight":       {HeaderPriority: &H2Priority{Weight: 0}},
+		"weight over 256":   {HeaderPriority: &H2Priority{Weight: 257}},
+		"window too large":  {ConnectionWindowUpdate: 1 << 31},
+		"missing pseudo":    {PseudoHeaderOrder: []string{":method", ":path", ":authority"}},
+		"repeated pseudo":   {PseudoHeaderOrder: []string{":method", ":path", ":path", ":authority"}},
+		"priority stream 0": {PriorityFrames: []H2PriorityFrame{{StreamID: 0, Priority: H2Priority{Weight: 1}}}},
+		"self dependency":   {PriorityFrames: []H2PriorityFrame{{StreamID: 3, Priority: H2Priority{Weight: 1, DependsOn: 3}}}},
+		"unknown scheme":    {PriorityScheme: "rfc9999"},
+	} {
+		if spec.Validate() == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestH2PriorityScheme(t *testing.T) {
+	p := Get("chrome-latest")
+	p.SetH2PriorityScheme(H2PriorityRFC9218)
+	spec := p.H2()
+	if spec.SendsPriorityFraming() || !spec.SendsPriorityHeader() {
+		t.Error("RFC 9218 should send only the Priority header")
+	}
+	if spec.HeaderPriority == nil {
+		t.Error("SetH2PriorityScheme should keep the rest of the spec")
+	}
+
+	tree := spec.FirefoxPriorityTree()
+	if !tree.SendsPriorityFraming() || tree.SendsPriorityHeader() {
+		t.Error("the Firefox tree should use RFC 7540 priorities only")
+	}
+}
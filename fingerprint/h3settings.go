@@ -0,0 +1,163 @@
+package fingerprint
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+)
+
+// HTTP/3 SETTINGS identifiers (RFC 9114, RFC 9204, RFC 9297)
+const (
+	H3SettingQPACKMaxTableCapacity uint64 = 0x01
+	H3SettingMaxFieldSectionSize   uint64 = 0x06
+	H3SettingQPACKBlockedStreams   uint64 = 0x07
+	H3SettingH3Datagram            uint64 = 0x33
+)
+
+// H3Setting is one parameter of the HTTP/3 SETTINGS frame
+type H3Setting struct {
+	ID    uint64
+	Value uint64
+}
+
+// H3Settings is the SETTINGS frame a preset sends on the HTTP/3 control
+// stream. Settings go out in the order QPACK_MAX_TABLE_CAPACITY,
+// MAX_FIELD_SECTION_SIZE, QPACK_BLOCKED_STREAMS and H3_DATAGRAM, followed by
+// Additional and the GREASE setting; the HTTP/3 stack doesn't keep the
+// relative order of those last two.
+type H3Settings struct {
+	// QPACKMaxTableCapacity is the QPACK dynamic table size; 0 omits it
+	QPACKMaxTableCapacity uint64
+
+	// MaxFieldSectionSize limits response header size; 0 omits it
+	MaxFieldSectionSize uint64
+
+	// QPACKBlockedStreams is how many streams may wait on QPACK table
+	// updates; 0 omits it
+	QPACKBlockedStreams uint64
+
+	// Datagram sends H3_DATAGRAM=1
+	Datagram bool
+
+	// Grease adds a reserved setting (0x1f*N+0x21) with a random non-zero
+	// value, as Chrome does. The setting is picked again whenever the HTTP/3
+	// transport is created.
+	Grease bool
+
+	// GreaseFrames follows SETTINGS with a reserved frame type and a
+	// PRIORITY_UPDATE frame on the control stream, as Chrome does
+	GreaseFrames bool
+
+	// Additional settings to send, such as a fixed reserved setting
+	Additional []H3Setting
+}
+
+// Validate reports settings that can't be put on the wire
+func (s H3Settings) Validate() error {
+	seen := map[uint64]bool{
+		H3SettingQPACKMaxTableCapacity: true,
+		H3SettingMaxFieldSectionSize:   true,
+		H3SettingQPACKBlockedStreams:   true,
+		H3SettingH3Datagram:            true,
+	}
+	for _, setting := range s.Additional {
+		switch {
+		case setting.ID >= 0x02 && setting.ID <= 0x05:
+			return fmt.Errorf("HTTP/3 setting %#x is reserved for HTTP/2", setting.ID)
+		case seen[setting.ID]:
+			return fmt.Errorf("duplicate HTTP/3 setting %#x", setting.ID)
+		case setting.ID >= 1<<62 || setting.Value >= 1<<62:
+			return fmt.Errorf("HTTP/3 setting %#x exceeds 2^62-1", setting.ID)
+		}
+		seen[setting.ID] = true
+	}
+	for _, v := range []uint64{s.QPACKMaxTableCapacity, s.MaxFieldSectionSize, s.QPACKBlockedStreams} {
+		if v >= 1<<62 {
+			return fmt.Errorf("HTTP/3 setting value %d exceeds 2^62-1", v)
+		}
+	}
+	return nil
+}
+
+// AdditionalSettings returns the settings in the form http3.Transport takes
+// them, with a freshly picked GREASE setting when Grease is set
+func (s H3Settings) AdditionalSettings() map[uint64]uint64 {
+	settings := make(map[uint64]uint64, 5+len(s.Additional))
+	if s.QPACKMaxTableCapacity > 0 {
+		settings[H3SettingQPACKMaxTableCapacity] = s.QPACKMaxTableCapacity
+	}
+	if s.MaxFieldSectionSize > 0 {
+		settings[H3SettingMaxFieldSectionSize] = s.MaxFieldSectionSize
+	}
+	if s.QPACKBlockedStreams > 0 {
+		settings[H3SettingQPACKBlockedStreams] = s.QPACKBlockedStreams
+	}
+	if s.Datagram {
+		settings[H3SettingH3Datagram] = 1
+	}
+	for _, setting := range s.Additional {
+		settings[setting.ID] = setting.Value
+	}
+	if s.Grease {
+		// Chrome uses large N, producing 10-11 digit IDs, and never sends 0
+		id := 0x1f*uint64(1000000000+rand.Int63n(9000000000)) + 0x21
+		settings[id] = uint64(1 + rand.Uint32()%(1<<32-1))
+	}
+	return settings
+}
+
+// Fingerprint returns the settings and pseudo-header order in the text form
+// browserleaks.com hashes into its h3_hash, e.g.
+// "1:65536;6:262144;7:100;51:1;GREASE|m,a,s,p"
+func (s H3Settings) Fingerprint(pseudoOrder []string) string {
+	var parts []string
+	add := func(id, value uint64) {
+		parts = append(parts, strconv.FormatUint(id, 10)+":"+strconv.FormatUint(value, 10))
+	}
+	if s.QPACKMaxTableCapacity > 0 {
+		add(H3SettingQPACKMaxTableCapacity, s.QPACKMaxTableCapacity)
+	}
+	if s.MaxFieldSectionSize > 0 {
+		add(H3SettingMaxFieldSectionSize, s.MaxFieldSectionSize)
+	}
+	if s.QPACKBlockedStreams > 0 {
+		add(H3SettingQPACKBlockedStreams, s.QPACKBlockedStreams)
+	}
+	if s.Datagram {
+		add(H3SettingH3Datagram, 1)
+	}
+	for _, setting := range s.Additional {
+		add(setting.ID, setting.Value)
+	}
+	if s.Grease {
+		parts = append(parts, "GREASE")
+	}
+
+	pseudo := make([]string, 0, len(pseudoOrder))
+	for _, name := range pseudoOrder {
+		if len(name) > 1 {
+			pseudo = append(pseudo, name[1:2])
+		}
+	}
+	return strings.Join(parts, ";") + "|" + strings.Join(pseudo, ",")
+}
+
+// H3 returns the HTTP/3 SETTINGS the preset sends: H3Settings when set,
+// otherwise Chrome's, or Safari's for presets with NoRFC7540Priorities
+func (p *Preset) H3() H3Settings {
+	if p.H3Settings != nil {
+		return *p.H3Settings
+	}
+	if p.HTTP2Settings.NoRFC7540Priorities {
+		return H3Settings{QPACKMaxTableCapacity: 16383, QPACKBlockedStreams: 100, Grease: true, GreaseFrames: true}
+	}
+	return H3Settings{
+		QPACKMaxTableCapacity: 65536,
+		MaxFieldSectionSize:   262144,
+		QPACKBlockedStreams:   100,
+		Datagram:              true,
+		Grease:                true,
+		GreaseFrames:          true,
+	}
+}
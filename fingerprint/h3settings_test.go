@@ -0,0 +1,68 @@
+package fingerprint
+
+import "testing"
+
+func TestH3SettingsDefaults(t *testing.T) {
+	tests := []struct {
+		preset string
+		want   string
+	}{
+		{"chrome-145", "1:65536;6:262144;7:100;51:1;GREASE|m,a,s,p"},
+		{"safari-18", "1:16383;7:100;GREASE|m,s,p,a"},
+	}
+	for _, tt := range tests {
+		p := Get(tt.preset)
+		if got := p.H3().Fingerprint(p.H2().PseudoHeaderOrder); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.preset, got, tt.want)
+		}
+	}
+}
+
+func TestH3SettingsAdditionalSettings(t *testing.T) {
+	s := H3Settings{
+		QPACKMaxTableCapacity: 4096,
+		QPACKBlockedStreams:   16,
+		Grease:                true,
+		Additional:            []H3Setting{{ID: 0x2b603742, Value: 1}},
+	}
+	settings := s.AdditionalSettings()
+	if len(settings) != 4 || settings[H3SettingQPACKMaxTableCapacity] != 4096 || settings[H3SettingQPACKBlockedStreams] != 16 || settings[0x2b603742] != 1 {
+		t.Fatalf("unexpected settings %v", settings)
+	}
+	if _, ok := settings[H3SettingH3Datagram]; ok {
+		t.Error("H3_DATAGRAM sent without Datagram")
+	}
+	for id, value := range settings {
+		if id > 0x2b603742 && ((id-0x21)%0x1f != 0 || value == 0) {
+			t.Errorf("invalid GREASE setting %d=%d", id, value)
+		}
+	}
+
+	for _, bad := range []H3Settings{
+		{Additional: []H3Setting{{ID: 0x4, Value: 1}}},
+		{Additional: []H3Setting{{ID: H3SettingQPACKBlockedStreams, Value: 1}}},
+		{Additional: []H3Setting{{ID: 0x21, Value: 1}, {ID: 0x21, Value: 2}}},
+		{QPACKMaxTableCapacity: 1 << 62},
+	} {
+		if bad.Validate() == nil {
+			t.Errorf("expected error for %+v", bad)
+		}
+	}
+}
+
+func TestParsePresetH3Settings(t *testing.T) {
+	preset, err := ParsePreset([]byte(`{
+		"name": "chrome-h3-test",
+		"base": "chrome-145",
+		"http3Settings": {"qpackBlockedStreams": 20, "datagram": false}
+	}`))
+	if err != nil {
+		t.Fatalf("ParsePreset failed: %v", err)
+	}
+	if got := preset.H3().Fingerprint(nil); got != "1:65536;6:262144;7:20;GREASE|" {
+		t.Errorf("settings not merged onto base: %q", got)
+	}
+	if _, err := ParsePreset([]byte(`{"name": "x", "base": "chrome-145", "http3Settings": {"blockedStreams": 1}}`)); err == nil {
+		t.Error("expected error for unknown http3 setting")
+	}
+}
@@ -0,0 +1,364 @@
+package fingerprint
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// TLS extension IDs that JA4 treats specially
+const (
+	extServerName          uint16 = 0x0000
+	extSignatureAlgorithms uint16 = 0x000d
+	extALPN                uint16 = 0x0010
+	extSupportedVersions   uint16 = 0x002b
+)
+
+var errShortClientHello = errors.New("ja4: truncated ClientHello")
+
+// clientHelloFields holds the ClientHello fields JA4 is computed from
+type clientHelloFields struct {
+	version           uint16
+	cipherSuites      []uint16
+	extensions        []uint16 // In wire order
+	alpn              []string
+	supportedVersions []uint16
+	signatureAlgs     []uint16
+}
+
+// JA4 computes the JA4 fingerprint (e.g., "t13d1516h2_8daaf6152771_d8a2da3f94cd")
+// of a raw ClientHello. clientHello is the handshake message, optionally still
+// inside its TLS record. Set quic for ClientHellos sent over QUIC.
+func JA4(clientHello []byte, quic bool) (string, error) {
+	hello, err := parseClientHello(clientHello)
+	if err != nil {
+		return "", err
+	}
+
+	var ciphers, extensions []string
+	for _, c := range hello.cipherSuites {
+		if !isGREASE(c) {
+			ciphers = append(ciphers, fmt.Sprintf("%04x", c))
+		}
+	}
+	sni := "i"
+	extCount := 0
+	for _, e := range hello.extensions {
+		if isGREASE(e) {
+			continue
+		}
+		extCount++
+		switch e {
+		case extServerName:
+			sni = "d"
+		case extALPN:
+		default:
+			extensions = append(extensions, fmt.Sprintf("%04x", e))
+		}
+	}
+
+	version := hello.version
+	for _, v := range hello.supportedVersions {
+		if !isGREASE(v) && v > version {
+			version = v
+		}
+	}
+
+	transport := "t"
+	if quic {
+		transport = "q"
+	}
+	a := fmt.Sprintf("%s%s%s%02d%02d%s", transport, ja4Version(version), sni,
+		min(len(ciphers), 99), min(extCount, 99), ja4ALPN(hello.alpn))
+
+	slices.Sort(ciphers)
+	slices.Sort(extensions)
+	c := strings.Join(extensions, ",")
+	if len(hello.signatureAlgs) > 0 {
+		algs := make([]string, 0, len(hello.signatureAlgs))
+		for _, alg := range hello.signatureAlgs {
+			if !isGREASE(alg) {
+				algs = append(algs, fmt.Sprintf("%04x", alg))
+			}
+		}
+		c += "_" + strings.Join(algs, ",")
+	}
+
+	return a + "_" + ja4Hash(strings.Join(ciphers, ","), len(ciphers) == 0) + "_" + ja4Hash(c, len(extensions) == 0), nil
+}
+
+// JA4H computes the JA4H HTTP client fingerprint of a request. proto is the
+// protocol the request is sent with ("HTTP/1.1", "h2" or "h3"); headers are the
+// regular (non-pseudo) headers in the order they are sent.
+func JA4H(method, proto string, headers []HeaderPair) string {
+	// Header names are hashed straight from a stack buffer; JA4H runs on
+	// every request, so it avoids allocating per header
+	var namesBuf [512]byte
+	names := namesBuf[:0]
+	var cookies []string
+	nameCount := 0
+	hasCookie, hasReferer := byte('n'), byte('n')
+	language := [4]byte{'0', '0', '0', '0'}
+	for _, h := range headers {
+		switch {
+		case strings.EqualFold(h.Key, "cookie"):
+			hasCookie = 'c'
+			for _, c := range strings.Split(h.Value, ";") {
+				if c = strings.TrimSpace(c); c != "" {
+					cookies = append(cookies, c)
+				}
+			}
+			continue
+		case strings.EqualFold(h.Key, "referer"):
+			hasReferer = 'r'
+			continue
+		case strings.EqualFold(h.Key, "accept-language"):
+			language = ja4Language(h.Value)
+		}
+		if nameCount > 0 {
+			names = append(names, ',')
+		}
+		names = append(names, h.Key...)
+		nameCount++
+	}
+
+	version := "11"
+	switch strings.ToLower(proto) {
+	case "h2", "http/2", "http/2.0":
+		version = "20"
+	case "h3", "http/3", "http/3.0":
+		version = "30"
+	case "http/1.0":
+		version = "10"
+	}
+
+	out := make([]byte, 0, 64)
+	for i := 0; i < len(method) && i < 2; i++ {
+		out = append(out, lowerASCII(method[i]))
+	}
+	out = append(out, version...)
+	out = append(out, hasCookie, hasReferer)
+	count := min(nameCount, 99)
+	out = append(out, byte('0'+count/10), byte('0'+count%10))
+	out = append(out, language[:]...)
+
+	out = append(out, '_')
+	out = appendJA4Hash(out, names, nameCount == 0)
+
+	cookieNames := make([]string, len(cookies))
+	for i, c := range cookies {
+		cookieNames[i], _, _ = strings.Cut(c, "=")
+	}
+	slices.Sort(cookieNames)
+	slices.Sort(cookies)
+	out = append(out, '_')
+	out = appendJA4Hash(out, []byte(strings.Join(cookieNames, ",")), len(cookies) == 0)
+	out = append(out, '_')
+	out = appendJA4Hash(out, []byte(strings.Join(cookies, ",")), len(cookies) == 0)
+	return string(out)
+}
+
+// ja4Language returns the first four characters of the primary
+// Accept-Language tag, lowercased without dashes ("en-US,en" gives "enus")
+func ja4Language(value string) [4]byte {
+	lang := [4]byte{'0', '0', '0', '0'}
+	n := 0
+	for i := 0; i < len(value) && n < 4; i++ {
+		c := value[i]
+		if c == ',' || c == ';' {
+			break
+		}
+		if c != '-' {
+			lang[n] = lowerASCII(c)
+			n++
+		}
+	}
+	return lang
+}
+
+func lowerASCII(c byte) byte {
+	if c >= 'A' && c <= 'Z' {
+		return c + 'a' - 'A'
+	}
+	return c
+}
+
+// appendJA4Hash appends ja4Hash of data to dst
+func appendJA4Hash(dst, data []byte, empty bool) []byte {
+	if empty {
+		return append(dst, "000000000000"...)
+	}
+	sum := sha256.Sum256(data)
+	var h [12]byte
+	hex.Encode(h[:], sum[:6])
+	return append(dst, h[:]...)
+}
+
+// ja4Hash returns the first 12 hex characters of the SHA-256 of s, or zeros if empty
+func ja4Hash(s string, empty bool) string {
+	if empty {
+		return "000000000000"
+	}
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])[:12]
+}
+
+func ja4Version(v uint16) string {
+	switch v {
+	case 0x0304:
+		return "13"
+	case 0x0303:
+		return "12"
+	case 0x0302:
+		return "11"
+	case 0x0301:
+		return "10"
+	case 0x0300:
+		return "s3"
+	}
+	return "00"
+}
+
+// ja4ALPN returns the first and last character of the first ALPN value,
+// falling back to hex digits for non-alphanumeric values
+func ja4ALPN(alpn []string) string {
+	if len(alpn) == 0 || alpn[0] == "" {
+		return "00"
+	}
+	first, last := alpn[0][0], alpn[0][len(alpn[0])-1]
+	if isAlphanumeric(first) && isAlphanumeric(last) {
+		return string([]byte{first, last})
+	}
+	h := hex.EncodeToString([]byte{first, last})
+	return h[:1] + h[3:]
+}
+
+func isAlphanumeric(c byte) bool {
+	return c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// parseClientHello extracts the fields JA4 needs from a ClientHello message
+func parseClientHello(data []byte) (*clientHelloFields, error) {
+	// Strip the TLS record header if present
+	if len(data) >= 5 && data[0] == 0x16 && data[1] == 0x03 {
+		data = data[5:]
+	}
+	if len(data) < 4 || data[0] != 0x01 {
+		return nil, errors.New("ja4: not a ClientHello")
+	}
+	r := helloReader(data[4:])
+
+	hello := &clientHelloFields{}
+	var ok bool
+	if hello.version, ok = r.uint16(); !ok {
+		return nil, errShortClientHello
+	}
+	if !r.skip(32) || !r.skipVector(1) {
+		return nil, errShortClientHello
+	}
+	suites, ok := r.vector(2)
+	if !ok {
+		return nil, errShortClientHello
+	}
+	for len(suites) >= 2 {
+		hello.cipherSuites = append(hello.cipherSuites, binary.BigEndian.Uint16(suites))
+		suites = suites[2:]
+	}
+	if !r.skipVector(1) {
+		return nil, errShortClientHello
+	}
+
+	exts, ok := r.vector(2)
+	if !ok {
+		// No extensions (legal for old clients)
+		return hello, nil
+	}
+	for len(exts) > 0 {
+		er := helloReader(exts)
+		id, ok := er.uint16()
+		if !ok {
+			return nil, errShortClientHello
+		}
+		body, ok := er.vector(2)
+		if !ok {
+			return nil, errShortClientHello
+		}
+		exts = er
+		hello.extensions = append(hello.extensions, id)
+
+		switch id {
+		case extALPN:
+			br := helloReader(body)
+			list, _ := br.vector(2)
+			for lr := helloReader(list); len(lr) > 0; {
+				proto, ok := lr.vector(1)
+				if !ok {
+					break
+				}
+				hello.alpn = append(hello.alpn, string(proto))
+			}
+		case extSupportedVersions:
+			br := helloReader(body)
+			list, _ := br.vector(1)
+			for len(list) >= 2 {
+				hello.supportedVersions = append(hello.supportedVersions, binary.BigEndian.Uint16(list))
+				list = list[2:]
+			}
+		case extSignatureAlgorithms:
+			br := helloReader(body)
+			list, _ := br.vector(2)
+			for len(list) >= 2 {
+				hello.signatureAlgs = append(hello.signatureAlgs, binary.BigEndian.Uint16(list))
+				list = list[2:]
+			}
+		}
+	}
+	return hello, nil
+}
+
+// helloReader consumes big-endian fields from a ClientHello
+type helloReader []byte
+
+func (r *helloReader) uint16() (uint16, bool) {
+	if len(*r) < 2 {
+		return 0, false
+	}
+	v := binary.BigEndian.Uint16(*r)
+	*r = (*r)[2:]
+	return v, true
+}
+
+func (r *helloReader) skip(n int) bool {
+	if len(*r) < n {
+		return false
+	}
+	*r = (*r)[n:]
+	return true
+}
+
+// vector reads a length-prefixed field with a lenBytes-byte length
+func (r *helloReader) vector(lenBytes int) ([]byte, bool) {
+	if len(*r) < lenBytes {
+		return nil, false
+	}
+	n := 0
+	for _, b := range (*r)[:lenBytes] {
+		n = n<<8 | int(b)
+	}
+	*r = (*r)[lenBytes:]
+	if len(*r) < n {
+		return nil, false
+	}
+	v := (*r)[:n]
+	*r = (*r)[n:]
+	return v, true
+}
+
+func (r *helloReader) skipVector(lenBytes int) bool {
+	_, ok := r.vector(lenBytes)
+	return ok
+}
@@ -0,0 +1,121 @@
+package fingerprint
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"math/big"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	tls "github.com/sardanioss/utls"
+)
+
+// buildClientHello marshals the ClientHello utls sends for id
+func buildClientHello(t *testing.T, id tls.ClientHelloID, serverName string) []byte {
+	t.Helper()
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	conn := tls.UClient(client, &tls.Config{ServerName: serverName}, id)
+	if err := conn.BuildHandshakeState(); err != nil {
+		t.Fatalf("BuildHandshakeState: %v", err)
+	}
+	return conn.HandshakeState.Hello.Raw
+}
+
+func TestJA4(t *testing.T) {
+	raw := buildClientHello(t, tls.HelloChrome_133, "example.com")
+
+	ja4, err := JA4(raw, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Chrome's published JA4 (the same for every recent build)
+	if ja4 != "t13d1516h2_8daaf6152771_d8a2da3f94cd" {
+		t.Errorf("JA4 = %s, want t13d1516h2_8daaf6152771_d8a2da3f94cd", ja4)
+	}
+
+	// Extension shuffling and GREASE must not change the fingerprint
+	again, _ := JA4(buildClientHello(t, tls.HelloChrome_133, "example.com"), false)
+	if again != ja4 {
+		t.Errorf("JA4 not stable: %s vs %s", ja4, again)
+	}
+
+	// No SNI for IP addresses; QUIC prefix
+	ipJA4, _ := JA4(buildClientHello(t, tls.HelloChrome_133, "192.0.2.1"), true)
+	if !strings.HasPrefix(ipJA4, "q13i") {
+		t.Errorf("JA4 without SNI over QUIC = %s, want q13i*", ipJA4)
+	}
+
+	if _, err := JA4([]byte{0x01, 0x00, 0x00, 0x10, 0x03}, false); err == nil {
+		t.Error("expected an error for a truncated ClientHello")
+	}
+}
+
+func TestJA4H(t *testing.T) {
+	headers := []HeaderPair{
+		{"user-agent", "Mozilla/5.0"},
+		{"accept", "*/*"},
+		{"referer", "https://example.com/"},
+		{"accept-language", "en-US,en;q=0.9"},
+		{"cookie", "b=2; a=1"},
+	}
+	got := JA4H("GET", "h2", headers)
+	parts := strings.Split(got, "_")
+	if len(parts) != 4 {
+		t.Fatalf("JA4H = %s, want 4 parts", got)
+	}
+	if parts[0] != "ge20cr03enus" {
+		t.Errorf("JA4H_a = %s, want ge20cr03enus", parts[0])
+	}
+	if parts[2] != ja4Hash("a,b", false) || parts[3] != ja4Hash("a=1,b=2", false) {
+		t.Errorf("cookie hashes don't match sorted cookies: %s", got)
+	}
+
+	bare := JA4H("POST", "HTTP/1.1", nil)
+	if bare != "po11nn000000_000000000000_000000000000_000000000000" {
+		t.Errorf("JA4H without headers = %s", bare)
+	}
+}
+
+func TestJA4X(t *testing.T) {
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{Country: []string{"US"}, CommonName: "example.com"},
+		NotAfter:     time.Now().Add(time.Hour),
+		DNSNames:     []string{"example.com"},
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// countryName (2.5.4.6) then commonName (2.5.4.3) for issuer and subject
+	names := ja4Hash("550406,550403", false)
+	var exts []string
+	for _, ext := range cert.Extensions {
+		exts = append(exts, oidHex(ext.Id))
+	}
+	want := names + "_" + names + "_" + ja4Hash(strings.Join(exts, ","), false)
+	if got := JA4X(cert); got != want {
+		t.Errorf("JA4X = %s, want %s", got, want)
+	}
+	if got := oidHex(asn1.ObjectIdentifier{2, 5, 29, 17}); got != "551d11" {
+		t.Errorf("oidHex(subjectAltName) = %s, want 551d11", got)
+	}
+}
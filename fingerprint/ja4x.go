@@ -0,0 +1,49 @@
+package fingerprint
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/hex"
+	"strings"
+)
+
+// JA4X computes the JA4X fingerprint of a certificate: hashes of the issuer
+// RDN, subject RDN and extension OIDs in certificate order (e.g.,
+// "a373a9f83c6b_2bab15409345_7bf9a7bf7029"). It identifies how a
+// certificate was generated rather than who it belongs to.
+func JA4X(cert *x509.Certificate) string {
+	issuer := rdnOIDs(cert.RawIssuer)
+	subject := rdnOIDs(cert.RawSubject)
+	extensions := make([]string, 0, len(cert.Extensions))
+	for _, ext := range cert.Extensions {
+		extensions = append(extensions, oidHex(ext.Id))
+	}
+	return ja4Hash(strings.Join(issuer, ","), len(issuer) == 0) +
+		"_" + ja4Hash(strings.Join(subject, ","), len(subject) == 0) +
+		"_" + ja4Hash(strings.Join(extensions, ","), len(extensions) == 0)
+}
+
+// rdnOIDs lists the attribute type OIDs of a DER-encoded distinguished name
+func rdnOIDs(raw []byte) []string {
+	var rdns pkix.RDNSequence
+	if _, err := asn1.Unmarshal(raw, &rdns); err != nil {
+		return nil
+	}
+	var oids []string
+	for _, rdn := range rdns {
+		for _, attr := range rdn {
+			oids = append(oids, oidHex(attr.Type))
+		}
+	}
+	return oids
+}
+
+// oidHex returns the hex of an OID's DER content bytes (2.5.4.3 is "550403")
+func oidHex(oid asn1.ObjectIdentifier) string {
+	der, err := asn1.Marshal(oid)
+	if err != nil || len(der) < 2 {
+		return ""
+	}
+	return hex.EncodeToString(der[2:])
+}
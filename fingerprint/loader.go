@@ -0,0 +1,203 @@
+package fingerprint
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	tls "github.com/sardanioss/utls"
+	"gopkg.in/yaml.v3"
+)
+
+// PresetFile is the JSON schema for presets loaded with LoadFile and ParsePreset.
+// LoadFile also reads it as YAML, with the same keys. Every field except name
+// is optional when base is set; unset fields inherit from the base preset.
+//
+// Example:
+//
+//	{
+//	  "name": "chrome-146",
+//	  "base": "chrome-145",
+//	  "clientHello": "Chrome-145_Linux",
+//	  "userAgent": "Mozilla/5.0 ... Chrome/146.0.0.0 Safari/537.36",
+//	  "headers": [
+//	    {"name": "sec-ch-ua", "value": "\"Chromium\";v=\"146\", \"Google Chrome\";v=\"146\""}
+//	  ],
+//	  "http2": {"initialWindowSize": 6291456, "connectionWindowUpdate": 15663105},
+//	  "http3": true
+//	}
+type PresetFile struct {
+	Name string `json:"name"`
+	Base string `json:"base,omitempty"` // Preset to inherit from
+
+	// ClientHello IDs in utls "Client-Version" form, e.g. "Chrome-145_Linux",
+	// "Firefox-120", "iOS-18_QUIC". Presets don't carry QUIC versions: they
+	// must match transport parameters that quic-go sets process-wide, so
+	// they're configured with transport.SetQUICVersions instead.
+	ClientHello        string `json:"clientHello,omitempty"`
+	PSKClientHello     string `json:"pskClientHello,omitempty"`
+	QUICClientHello    string `json:"quicClientHello,omitempty"`
+	QUICPSKClientHello string `json:"quicPskClientHello,omitempty"`
+
+	CipherSuites []uint16 `json:"cipherSuites,omitempty"`
+	ALPN         []string `json:"alpn,omitempty"`
+
+	UserAgent string `json:"userAgent,omitempty"`
+
+	// Headers are set in order; new headers are appended to the header order
+	Headers []PresetFileHeader `json:"headers,omitempty"`
+
+	// HeaderOrder reorders headers (lowercase names), see Builder.HeaderOrder
+	HeaderOrder []string `json:"headerOrder,omitempty"`
+
+	// HTTP2 overrides individual HTTP2Settings fields, keyed by camelCase
+	// field name (e.g., "headerTableSize", "settingsOrder", "pseudoHeaderOrder")
+	HTTP2 json.RawMessage `json:"http2,omitempty"`
+
+	HTTP3 *bool `json:"http3,omitempty"`
+
+	// HTTP3Settings overrides individual H3Settings fields of the base, keyed
+	// by camelCase field name (e.g., "qpackMaxTableCapacity", "datagram")
+	HTTP3Settings json.RawMessage `json:"http3Settings,omitempty"`
+}
+
+// PresetFileHeader is a default header in a PresetFile
+type PresetFileHeader struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// LoadFile reads a preset definition from a JSON file, or a YAML file when
+// the extension is .yaml or .yml. The returned preset is not registered; pass
+// it to Register to make it available by name.
+//
+// Example:
+//
+//	preset, err := fingerprint.LoadFile("presets/chrome-146.json")
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	fingerprint.Register(preset.Name, preset)
+func LoadFile(path string) (*Preset, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read preset file: %w", err)
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		if data, err = yamlToJSON(data); err != nil {
+			return nil, fmt.Errorf("preset file %s: invalid YAML: %w", path, err)
+		}
+	}
+	preset, err := ParsePreset(data)
+	if err != nil {
+		return nil, fmt.Errorf("preset file %s: %w", path, err)
+	}
+	return preset, nil
+}
+
+// ParsePreset builds a preset from a JSON definition (see PresetFile).
+// Unknown fields are rejected so typos don't silently fall back to defaults.
+func ParsePreset(data []byte) (*Preset, error) {
+	var file PresetFile
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&file); err != nil {
+		return nil, fmt.Errorf("invalid preset definition: %w", err)
+	}
+	return file.Build()
+}
+
+// yamlToJSON converts a YAML preset definition to JSON, so both formats share
+// the json tags and the unknown field check of ParsePreset
+func yamlToJSON(data []byte) ([]byte, error) {
+	var doc interface{}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	return json.Marshal(doc)
+}
+
+// Build converts the definition into a Preset
+func (f *PresetFile) Build() (*Preset, error) {
+	b := NewBuilder(f.Name)
+	if f.Base != "" {
+		b.From(f.Base)
+	}
+
+	ids := []struct {
+		value string
+		set   func(tls.ClientHelloID)
+	}{
+		{f.ClientHello, func(id tls.ClientHelloID) { b.ClientHelloID(id) }},
+		{f.PSKClientHello, func(id tls.ClientHelloID) { b.PSKClientHelloID(id) }},
+		{f.QUICClientHello, func(id tls.ClientHelloID) { b.preset.QUICClientHelloID = id }},
+		{f.QUICPSKClientHello, func(id tls.ClientHelloID) { b.preset.QUICPSKClientHelloID = id }},
+	}
+	for _, entry := range ids {
+		if entry.value == "" {
+			continue
+		}
+		id, err := ParseClientHelloID(entry.value)
+		if err != nil {
+			return nil, err
+		}
+		entry.set(id)
+	}
+
+	if f.CipherSuites != nil {
+		b.CipherSuites(f.CipherSuites...)
+	}
+	if f.ALPN != nil {
+		b.ALPN(f.ALPN...)
+	}
+	if f.UserAgent != "" {
+		b.UserAgent(f.UserAgent)
+	}
+	for _, h := range f.Headers {
+		b.Header(h.Name, h.Value)
+	}
+	if len(f.HeaderOrder) > 0 {
+		b.HeaderOrder(f.HeaderOrder...)
+	}
+	if len(f.HTTP2) > 0 {
+		settings := b.preset.HTTP2Settings
+		dec := json.NewDecoder(bytes.NewReader(f.HTTP2))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&settings); err != nil {
+			return nil, fmt.Errorf("invalid http2 settings: %w", err)
+		}
+		b.HTTP2Settings(settings)
+	}
+	if f.HTTP3 != nil {
+		b.HTTP3(*f.HTTP3)
+	}
+	if len(f.HTTP3Settings) > 0 {
+		settings := b.preset.H3()
+		dec := json.NewDecoder(bytes.NewReader(f.HTTP3Settings))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&settings); err != nil {
+			return nil, fmt.Errorf("invalid http3 settings: %w", err)
+		}
+		b.H3Settings(settings)
+	}
+	return b.Build()
+}
+
+// ParseClientHelloID parses a utls ClientHelloID in its "Client-Version" string
+// form (as returned by ClientHelloID.Str), e.g. "Chrome-145_Linux". The ID must
+// be one utls can build a ClientHello for.
+func ParseClientHelloID(s string) (tls.ClientHelloID, error) {
+	i := strings.LastIndex(s, "-")
+	if i <= 0 || i == len(s)-1 {
+		return tls.ClientHelloID{}, fmt.Errorf("invalid ClientHello ID %q: want Client-Version, e.g. Chrome-145_Linux", s)
+	}
+	id := tls.ClientHelloID{Client: s[:i], Version: s[i+1:]}
+	if _, err := tls.UTLSIdToSpec(id); err != nil {
+		return tls.ClientHelloID{}, fmt.Errorf("unknown ClientHello ID %q: %w", s, err)
+	}
+	return id, nil
+}
@@ -0,0 +1,59 @@
+package fingerprint
+
+import (
+	"slices"
+
+	tls "github.com/sardanioss/utls"
+)
+
+// isPostQuantum reports whether a group is a hybrid post-quantum key exchange
+func isPostQuantum(group tls.CurveID) bool {
+	return group == tls.X25519MLKEM768 || group == tls.X25519Kyber768Draft00
+}
+
+// SetPostQuantum adds or removes the X25519MLKEM768 hybrid key exchange in a
+// spec, in both supported_groups and key_share. Chrome offers it by default;
+// its 1.2KB key share makes the ClientHello span two TCP segments, which some
+// middleboxes reject. When adding, the group goes first after GREASE, where
+// Chrome puts it. Specs without a key_share extension (TLS 1.2) are unchanged.
+func SetPostQuantum(spec *tls.ClientHelloSpec, enabled bool) {
+	if spec == nil {
+		return
+	}
+	var curves *tls.SupportedCurvesExtension
+	var keyShares *tls.KeyShareExtension
+	for _, ext := range spec.Extensions {
+		switch e := ext.(type) {
+		case *tls.SupportedCurvesExtension:
+			curves = e
+		case *tls.KeyShareExtension:
+			keyShares = e
+		}
+	}
+	if keyShares == nil {
+		return
+	}
+
+	if !enabled {
+		keyShares.KeyShares = slices.DeleteFunc(keyShares.KeyShares, func(ks tls.KeyShare) bool { return isPostQuantum(ks.Group) })
+		if curves != nil {
+			curves.Curves = slices.DeleteFunc(curves.Curves, isPostQuantum)
+		}
+		return
+	}
+
+	if !slices.ContainsFunc(keyShares.KeyShares, func(ks tls.KeyShare) bool { return isPostQuantum(ks.Group) }) {
+		i := 0
+		for i < len(keyShares.KeyShares) && isGREASE(uint16(keyShares.KeyShares[i].Group)) {
+			i++
+		}
+		keyShares.KeyShares = slices.Insert(keyShares.KeyShares, i, tls.KeyShare{Group: tls.X25519MLKEM768})
+	}
+	if curves != nil && !slices.ContainsFunc(curves.Curves, isPostQuantum) {
+		i := 0
+		for i < len(curves.Curves) && isGREASE(uint16(curves.Curves[i])) {
+			i++
+		}
+		curves.Curves = slices.Insert(curves.Curves, i, tls.X25519MLKEM768)
+	}
+}
@@ -0,0 +1,44 @@
+package fingerprint
+
+import (
+	"testing"
+
+	tls "github.com/sardanioss/utls"
+)
+
+func TestSetPostQuantum(t *testing.T) {
+	spec, err := tls.UTLSIdToSpec(tls.HelloChrome_133)
+	if err != nil {
+		t.Fatal(err)
+	}
+	withPQ := rawHelloFromSpec(t, spec)
+
+	spec, _ = tls.UTLSIdToSpec(tls.HelloChrome_133)
+	SetPostQuantum(&spec, false)
+	without := rawHelloFromSpec(t, spec)
+	if len(without) >= len(withPQ)-1000 {
+		t.Errorf("ClientHello without PQ is %d bytes, want about 1.2KB less than %d", len(without), len(withPQ))
+	}
+
+	// JA4 doesn't cover groups or key shares
+	ja4With, _ := JA4(withPQ, false)
+	ja4Without, _ := JA4(without, false)
+	if ja4With != ja4Without {
+		t.Errorf("JA4 changed: %s vs %s", ja4With, ja4Without)
+	}
+
+	// Adding it back restores Chrome's position, right after GREASE
+	SetPostQuantum(&spec, true)
+	for _, ext := range spec.Extensions {
+		switch e := ext.(type) {
+		case *tls.KeyShareExtension:
+			if e.KeyShares[1].Group != tls.X25519MLKEM768 {
+				t.Errorf("key shares = %v, want X25519MLKEM768 after GREASE", e.KeyShares)
+			}
+		case *tls.SupportedCurvesExtension:
+			if e.Curves[1] != tls.X25519MLKEM768 {
+				t.Errorf("groups = %v, want X25519MLKEM768 after GREASE", e.Curves)
+			}
+		}
+	}
+}
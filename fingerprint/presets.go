@@ -2,6 +2,8 @@ package fingerprint
 
 import (
 	"runtime"
+	"strings"
+	"sync"
 
 	tls "github.com/sardanioss/utls"
 )
@@ -17,7 +19,13 @@ type PlatformInfo struct {
 
 // GetPlatformInfo returns platform-specific info based on runtime OS
 func GetPlatformInfo() PlatformInfo {
-	switch runtime.GOOS {
+	return PlatformInfoFor(runtime.GOOS)
+}
+
+// PlatformInfoFor returns platform-specific info for a GOOS value
+// ("windows", "darwin", "linux"). Other values get Linux info.
+func PlatformInfoFor(goos string) PlatformInfo {
+	switch goos {
 	case "windows":
 		return PlatformInfo{
 			UserAgentOS:        "(Windows NT 10.0; Win64; x64)",
@@ -63,6 +71,20 @@ type Preset struct {
 	HeaderOrder       []HeaderPair      // Ordered headers for HTTP/2 and HTTP/3
 	HTTP2Settings     HTTP2Settings
 	SupportHTTP3      bool
+
+	// H2Spec, when set, is sent on HTTP/2 connections instead of the
+	// fingerprint derived from HTTP2Settings (see H2)
+	H2Spec *H2Spec
+
+	// H3Settings, when set, replaces the HTTP/3 SETTINGS derived from the
+	// browser type (see H3)
+	H3Settings *H3Settings
+
+	// Optional TLS overrides applied on top of ClientHelloID for TCP connections
+	// (HTTP/1.1, HTTP/2). Nil keeps the ClientHelloID's own values.
+	CipherSuites []uint16 // Cipher suite order (GREASE is preserved if the ClientHelloID uses it)
+	ALPN         []string // ALPN protocols (HTTP/1.1-only connections still force "http/1.1")
+	PostQuantum  bool     // Offer X25519MLKEM768 first in supported_groups and key_share (see SetPostQuantum)
 }
 
 // HTTP2Settings contains HTTP/2 connection settings
@@ -79,13 +101,113 @@ type HTTP2Settings struct {
 	StreamExclusive        bool
 	// RFC 9218 - disables RFC 7540 stream priorities
 	NoRFC7540Priorities bool
+
+	// SettingsOrder lists the SETTINGS identifiers in wire order. When set, only
+	// these settings are sent (e.g., Firefox omits MAX_HEADER_LIST_SIZE).
+	// Nil uses Chrome's order.
+	SettingsOrder []uint16
+
+	// PseudoHeaderOrder overrides the pseudo-header order (e.g., Firefox's
+	// ":method", ":path", ":authority", ":scheme"). Nil uses the browser-type heuristic.
+	PseudoHeaderOrder []string
+
+	// PriorityScheme picks HTTP/2 priority framing, the Priority header or
+	// both (the default)
+	PriorityScheme H2PriorityScheme
+}
+
+// HTTP/2 SETTINGS identifiers (RFC 9113 section 6.5.2) for use in SettingsOrder
+const (
+	H2SettingHeaderTableSize      uint16 = 0x1
+	H2SettingEnablePush           uint16 = 0x2
+	H2SettingMaxConcurrentStreams uint16 = 0x3
+	H2SettingInitialWindowSize    uint16 = 0x4
+	H2SettingMaxFrameSize         uint16 = 0x5
+	H2SettingMaxHeaderListSize    uint16 = 0x6
+	H2SettingNoRFC7540Priorities  uint16 = 0x9
+)
+
+// SettingValue returns the value sent for a SETTINGS identifier
+func (s HTTP2Settings) SettingValue(id uint16) uint32 {
+	switch id {
+	case H2SettingHeaderTableSize:
+		return s.HeaderTableSize
+	case H2SettingEnablePush:
+		if s.EnablePush {
+			return 1
+		}
+		return 0
+	case H2SettingMaxConcurrentStreams:
+		return s.MaxConcurrentStreams
+	case H2SettingInitialWindowSize:
+		return s.InitialWindowSize
+	case H2SettingMaxFrameSize:
+		return s.MaxFrameSize
+	case H2SettingMaxHeaderListSize:
+		return s.MaxHeaderListSize
+	case H2SettingNoRFC7540Priorities:
+		if s.NoRFC7540Priorities {
+			return 1
+		}
+		return 0
+	}
+	return 0
+}
+
+// firefoxHTTP2Settings returns Firefox's HTTP/2 connection preface:
+// SETTINGS 1:65536;2:0;4:131072;5:16384, WINDOW_UPDATE 12517377, no PRIORITY
+// frames, HEADERS weight 42 and pseudo-header order m,p,a,s
+// (Akamai: 1:65536;2:0;4:131072;5:16384|12517377|0|m,p,a,s).
+func firefoxHTTP2Settings() HTTP2Settings {
+	return HTTP2Settings{
+		HeaderTableSize:        65536,
+		EnablePush:             false,
+		InitialWindowSize:      131072,
+		MaxFrameSize:           16384,
+		ConnectionWindowUpdate: 12517377,
+		StreamWeight:           42,
+		StreamExclusive:        false,
+		SettingsOrder: []uint16{
+			H2SettingHeaderTableSize,
+			H2SettingEnablePush,
+			H2SettingInitialWindowSize,
+			H2SettingMaxFrameSize,
+		},
+		PseudoHeaderOrder: []string{":method", ":path", ":authority", ":scheme"},
+	}
+}
+
+// firefoxUserAgent builds a Firefox User-Agent for the given major version
+func firefoxUserAgent(p PlatformInfo, version string) string {
+	os := strings.Replace(p.FirefoxUserAgentOS, "rv:133.0", "rv:"+version+".0", 1)
+	return "Mozilla/5.0 " + os + " Gecko/20100101 Firefox/" + version + ".0"
 }
 
 // Chrome133 returns the Chrome 133 fingerprint preset
 func Chrome133() *Preset {
-	p := GetPlatformInfo()
+	return chrome133(GetPlatformInfo(), "chrome-133")
+}
+
+// Chrome133Windows returns Chrome 133 with Windows platform
+func Chrome133Windows() *Preset {
+	return chrome133(PlatformInfoFor("windows"), "chrome-133-windows")
+}
+
+// Chrome133Linux returns Chrome 133 with Linux platform
+func Chrome133Linux() *Preset {
+	return chrome133(PlatformInfoFor("linux"), "chrome-133-linux")
+}
+
+// Chrome133macOS returns Chrome 133 with macOS platform
+func Chrome133macOS() *Preset {
+	return chrome133(PlatformInfoFor("darwin"), "chrome-133-macos")
+}
+
+// chrome133 builds the Chrome 133 preset for a platform. Chrome 133 has a single
+// TLS fingerprint across platforms, so only the UA and client hints differ.
+func chrome133(p PlatformInfo, name string) *Preset {
 	return &Preset{
-		Name:             "chrome-133",
+		Name:             name,
 		ClientHelloID:    tls.HelloChrome_133,     // Chrome 133 with X25519MLKEM768 (correct post-quantum)
 		PSKClientHelloID: tls.HelloChrome_133_PSK, // PSK for session resumption
 		UserAgent:        "Mozilla/5.0 " + p.UserAgentOS + " AppleWebKit/537.36 (KHTML, like Gecko) Chrome/133.0.0.0 Safari/537.36",
@@ -138,9 +260,29 @@ func Chrome133() *Preset {
 
 // Chrome141 returns the Chrome 141 fingerprint preset
 func Chrome141() *Preset {
-	p := GetPlatformInfo()
+	return chrome141(GetPlatformInfo(), "chrome-141")
+}
+
+// Chrome141Windows returns Chrome 141 with Windows platform
+func Chrome141Windows() *Preset {
+	return chrome141(PlatformInfoFor("windows"), "chrome-141-windows")
+}
+
+// Chrome141Linux returns Chrome 141 with Linux platform
+func Chrome141Linux() *Preset {
+	return chrome141(PlatformInfoFor("linux"), "chrome-141-linux")
+}
+
+// Chrome141macOS returns Chrome 141 with macOS platform
+func Chrome141macOS() *Preset {
+	return chrome141(PlatformInfoFor("darwin"), "chrome-141-macos")
+}
+
+// chrome141 builds the Chrome 141 preset for a platform. Chrome 141 has a single
+// TLS fingerprint across platforms, so only the UA and client hints differ.
+func chrome141(p PlatformInfo, name string) *Preset {
 	return &Preset{
-		Name:             "chrome-141",
+		Name:             name,
 		ClientHelloID:    tls.HelloChrome_133,     // Chrome 133 TLS fingerprint with X25519MLKEM768
 		PSKClientHelloID: tls.HelloChrome_133_PSK, // PSK for session resumption
 		UserAgent:        "Mozilla/5.0 " + p.UserAgentOS + " AppleWebKit/537.36 (KHTML, like Gecko) Chrome/141.0.0.0 Safari/537.36",
@@ -218,21 +360,64 @@ func Firefox133() *Preset {
 			{"sec-fetch-site", "none"},
 			{"sec-fetch-user", "?1"},
 		},
-		HTTP2Settings: HTTP2Settings{
-			HeaderTableSize:        65536,
-			EnablePush:             true,
-			MaxConcurrentStreams:   0,
-			InitialWindowSize:      131072,
-			MaxFrameSize:           16384,
-			MaxHeaderListSize:      0,
-			ConnectionWindowUpdate: 12517377,
-			StreamWeight:           42,
-			StreamExclusive:        false,
+		// Firefox 133 disables push and sends pseudo-headers as m,p,a,s; the
+		// Chrome defaults left for unset SettingsOrder/PseudoHeaderOrder made
+		// Validate flag this preset as a Firefox UA on Chrome's HTTP/2 frames
+		HTTP2Settings: firefoxHTTP2Settings(),
+		SupportHTTP3:  false, // No Firefox QUIC fingerprint in utls
+	}
+}
+
+// firefoxPreset builds a Firefox 128+ preset for the given major version.
+// utls has no ClientHello newer than Firefox 120, which Firefox sends
+// unchanged through 131; from 132 Firefox also offers X25519MLKEM768 first,
+// so postQuantum adds that on top of the Firefox 120 hello.
+func firefoxPreset(name, version string, postQuantum bool) *Preset {
+	p := GetPlatformInfo()
+	const accept = "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8"
+	return &Preset{
+		Name:          name,
+		ClientHelloID: tls.HelloFirefox_120,
+		UserAgent:     firefoxUserAgent(p, version),
+		Headers: map[string]string{
+			"Accept":                    accept,
+			"Accept-Language":           "en-US,en;q=0.5",
+			"Accept-Encoding":           "gzip, deflate, br, zstd",
+			"Upgrade-Insecure-Requests": "1",
+			"Sec-Fetch-Dest":            "document",
+			"Sec-Fetch-Mode":            "navigate",
+			"Sec-Fetch-Site":            "none",
+			"Sec-Fetch-User":            "?1",
+			"Priority":                  "u=0, i",
+		},
+		HeaderOrder: []HeaderPair{
+			{"user-agent", ""},
+			{"accept", accept},
+			{"accept-language", "en-US,en;q=0.5"},
+			{"accept-encoding", "gzip, deflate, br, zstd"},
+			{"upgrade-insecure-requests", "1"},
+			{"sec-fetch-dest", "document"},
+			{"sec-fetch-mode", "navigate"},
+			{"sec-fetch-site", "none"},
+			{"sec-fetch-user", "?1"},
+			{"priority", "u=0, i"},
 		},
-		SupportHTTP3: false, // No Firefox QUIC fingerprint in utls
+		HTTP2Settings: firefoxHTTP2Settings(),
+		SupportHTTP3:  false, // No Firefox QUIC fingerprint in utls
+		PostQuantum:   postQuantum,
 	}
 }
 
+// Firefox128 returns the Firefox 128 ESR fingerprint preset
+func Firefox128() *Preset {
+	return firefoxPreset("firefox-128", "128", false)
+}
+
+// Firefox147 returns the Firefox 147 fingerprint preset
+func Firefox147() *Preset {
+	return firefoxPreset("firefox-147", "147", true)
+}
+
 // Chrome143 returns the Chrome 143 fingerprint preset with platform-specific TLS fingerprint
 func Chrome143() *Preset {
 	p := GetPlatformInfo()
@@ -1371,10 +1556,49 @@ func AndroidChrome145() *Preset {
 	}
 }
 
+// androidTablet converts an Android Chrome phone preset into its tablet variant.
+// Chrome on Android tablets requests desktop-class pages: the UA drops "Mobile"
+// and sec-ch-ua-mobile is ?0. TLS and HTTP/2 behavior is the same as on phones.
+func androidTablet(p *Preset, name string) *Preset {
+	p.Name = name
+	p.UserAgent = strings.Replace(p.UserAgent, " Mobile Safari/", " Safari/", 1)
+	p.Headers["sec-ch-ua-mobile"] = "?0"
+	for i := range p.HeaderOrder {
+		if p.HeaderOrder[i].Key == "sec-ch-ua-mobile" {
+			p.HeaderOrder[i].Value = "?0"
+		}
+	}
+	return p
+}
+
+// AndroidChrome143Tablet returns Chrome 143 on an Android tablet fingerprint preset
+func AndroidChrome143Tablet() *Preset {
+	return androidTablet(AndroidChrome143(), "chrome-143-android-tablet")
+}
+
+// AndroidChrome144Tablet returns Chrome 144 on an Android tablet fingerprint preset
+func AndroidChrome144Tablet() *Preset {
+	return androidTablet(AndroidChrome144(), "chrome-144-android-tablet")
+}
+
+// AndroidChrome145Tablet returns Chrome 145 on an Android tablet fingerprint preset
+func AndroidChrome145Tablet() *Preset {
+	return androidTablet(AndroidChrome145(), "chrome-145-android-tablet")
+}
+
 // presets is a map of all available presets
+// presetsMu guards presets against concurrent Register calls
+var presetsMu sync.RWMutex
+
 var presets = map[string]func() *Preset{
 	"chrome-133":         Chrome133,
+	"chrome-133-windows": Chrome133Windows,
+	"chrome-133-linux":   Chrome133Linux,
+	"chrome-133-macos":   Chrome133macOS,
 	"chrome-141":         Chrome141,
+	"chrome-141-windows": Chrome141Windows,
+	"chrome-141-linux":   Chrome141Linux,
+	"chrome-141-macos":   Chrome141macOS,
 	"chrome-143":         Chrome143,
 	"chrome-143-windows": Chrome143Windows,
 	"chrome-143-linux":   Chrome143Linux,
@@ -1387,7 +1611,9 @@ var presets = map[string]func() *Preset{
 	"chrome-145-windows": Chrome145Windows,
 	"chrome-145-linux":   Chrome145Linux,
 	"chrome-145-macos":   Chrome145macOS,
+	"firefox-128":        Firefox128,
 	"firefox-133":        Firefox133,
+	"firefox-147":        Firefox147,
 	"safari-18":          Safari18,
 	"chrome-143-ios":     IOSChrome143,
 	"chrome-144-ios":     IOSChrome144,
@@ -1398,16 +1624,36 @@ var presets = map[string]func() *Preset{
 	"chrome-144-android": AndroidChrome144,
 	"chrome-145-android": AndroidChrome145,
 
+	"chrome-143-android-tablet": AndroidChrome143Tablet,
+	"chrome-144-android-tablet": AndroidChrome144Tablet,
+	"chrome-145-android-tablet": AndroidChrome145Tablet,
+
 	// -latest aliases (always point to the newest version)
-	"chrome-latest":         Chrome145,
-	"chrome-latest-windows": Chrome145Windows,
-	"chrome-latest-linux":   Chrome145Linux,
-	"chrome-latest-macos":   Chrome145macOS,
-	"firefox-latest":        Firefox133,
-	"safari-latest":         Safari18,
-	"chrome-latest-ios":     IOSChrome145,
-	"safari-latest-ios":     IOSSafari18,
-	"chrome-latest-android": AndroidChrome145,
+	"chrome-latest":                Chrome145,
+	"chrome-latest-windows":        Chrome145Windows,
+	"chrome-latest-linux":          Chrome145Linux,
+	"chrome-latest-win":            Chrome145Windows,
+	"chrome-latest-mac":            Chrome145macOS,
+	"chrome-latest-macos":          Chrome145macOS,
+	"firefox-latest":               Firefox147,
+	"firefox-esr":                  Firefox128,
+	"safari-latest":                Safari18,
+	"chrome-latest-ios":            IOSChrome145,
+	"safari-latest-ios":            IOSSafari18,
+	"chrome-latest-android":        AndroidChrome145,
+	"chrome-latest-android-tablet": AndroidChrome145Tablet,
+
+	// Short OS aliases (chrome-145-win, chrome-145-mac)
+	"chrome-133-win": Chrome133Windows,
+	"chrome-133-mac": Chrome133macOS,
+	"chrome-141-win": Chrome141Windows,
+	"chrome-141-mac": Chrome141macOS,
+	"chrome-143-win": Chrome143Windows,
+	"chrome-143-mac": Chrome143macOS,
+	"chrome-144-win": Chrome144Windows,
+	"chrome-144-mac": Chrome144macOS,
+	"chrome-145-win": Chrome145Windows,
+	"chrome-145-mac": Chrome145macOS,
 
 	// Backwards compatibility aliases (old naming convention)
 	"ios-chrome-143":        IOSChrome143,
@@ -1425,14 +1671,67 @@ var presets = map[string]func() *Preset{
 
 // Get returns a preset by name, or chrome-latest as default
 func Get(name string) *Preset {
-	if fn, ok := presets[name]; ok {
+	if fn, ok := lookup(name); ok {
 		return fn()
 	}
 	return Chrome145()
 }
 
+// Lookup returns a preset by name and whether it exists, without falling back to a default.
+func Lookup(name string) (*Preset, bool) {
+	fn, ok := lookup(name)
+	if !ok {
+		return nil, false
+	}
+	return fn(), true
+}
+
+// lookup returns the constructor for a preset name
+func lookup(name string) (func() *Preset, bool) {
+	presetsMu.RLock()
+	defer presetsMu.RUnlock()
+	fn, ok := presets[name]
+	return fn, ok
+}
+
+// Register makes a custom or patched preset available by name, so it can be
+// used anywhere a preset name is accepted (e.g., httpcloak.NewSession("my-custom")).
+// Registering an existing name replaces it, including built-ins.
+// Each Get returns an independent copy, so the registered preset can't be
+// modified through sessions using it. Panics if name is empty or preset is nil.
+//
+// Example:
+//
+//	preset, _ := fingerprint.NewBuilder("chrome-146").From("chrome-145").Build()
+//	fingerprint.Register("chrome-146", preset)
+//	session := httpcloak.NewSession("chrome-146")
+func Register(name string, preset *Preset) {
+	if name == "" {
+		panic("fingerprint: Register called with empty name")
+	}
+	if preset == nil {
+		panic("fingerprint: Register preset is nil")
+	}
+
+	registered := clonePreset(preset)
+	registered.Name = name
+
+	presetsMu.Lock()
+	defer presetsMu.Unlock()
+	presets[name] = func() *Preset { return clonePreset(registered) }
+}
+
+// Unregister removes a preset registered by name. Built-in presets can be removed too.
+func Unregister(name string) {
+	presetsMu.Lock()
+	defer presetsMu.Unlock()
+	delete(presets, name)
+}
+
 // Available returns a list of available preset names
 func Available() []string {
+	presetsMu.RLock()
+	defer presetsMu.RUnlock()
 	names := make([]string, 0, len(presets))
 	for name := range presets {
 		names = append(names, name)
@@ -1440,21 +1739,32 @@ func Available() []string {
 	return names
 }
 
-// PresetInfo contains metadata about a preset's protocol support.
+// PresetInfo contains metadata about a preset's protocol support and whether
+// it is current (see Status).
 type PresetInfo struct {
-	Protocols []string `json:"protocols"`
+	Protocols   []string `json:"protocols"`
+	Current     bool     `json:"current"`
+	Replacement string   `json:"replacement,omitempty"`
 }
 
 // AvailableWithInfo returns a map of preset names to their supported protocols.
 func AvailableWithInfo() map[string]PresetInfo {
-	result := make(map[string]PresetInfo, len(presets))
+	presetsMu.RLock()
+	fns := make(map[string]func() *Preset, len(presets))
 	for name, presetFn := range presets {
+		fns[name] = presetFn
+	}
+	presetsMu.RUnlock()
+
+	result := make(map[string]PresetInfo, len(fns))
+	for name, presetFn := range fns {
 		p := presetFn()
 		protocols := []string{"h1", "h2"}
 		if p.SupportHTTP3 {
 			protocols = append(protocols, "h3")
 		}
-		result[name] = PresetInfo{Protocols: protocols}
+		status, _ := Status(name)
+		result[name] = PresetInfo{Protocols: protocols, Current: status.Current, Replacement: status.Replacement}
 	}
 	return result
 }
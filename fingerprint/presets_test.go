@@ -1,7 +1,12 @@
 package fingerprint
 
 import (
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+
+	tls "github.com/sardanioss/utls"
 )
 
 func TestAvailableWithInfo(t *testing.T) {
@@ -83,3 +88,297 @@ func TestAvailableWithInfo(t *testing.T) {
 		}
 	}
 }
+
+func TestBuilder(t *testing.T) {
+	preset, err := NewBuilder("chrome-146").
+		From("chrome-145").
+		Header("sec-ch-ua", `"Chromium";v="146"`).
+		Header("x-custom", "1").
+		HeaderOrder("x-custom", "user-agent").
+		ALPN("http/1.1").
+		Build()
+	if err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+
+	if preset.Name != "chrome-146" {
+		t.Errorf("Name = %q, want chrome-146", preset.Name)
+	}
+	if preset.ClientHelloID != Chrome145().ClientHelloID {
+		t.Error("ClientHelloID not inherited from base preset")
+	}
+	if preset.HeaderOrder[0].Key != "x-custom" || preset.HeaderOrder[1].Key != "user-agent" {
+		t.Errorf("Header order not applied: %v", preset.HeaderOrder[:2])
+	}
+	for _, hp := range preset.HeaderOrder {
+		if hp.Key == "sec-ch-ua" && hp.Value != `"Chromium";v="146"` {
+			t.Errorf("sec-ch-ua not replaced in header order: %q", hp.Value)
+		}
+	}
+	if !preset.HasTLSOverrides() {
+		t.Error("Expected ALPN override to be reported")
+	}
+
+	if _, err := NewBuilder("empty").Build(); err == nil {
+		t.Error("Expected error for preset without ClientHelloID")
+	}
+	if _, err := NewBuilder("x").From("does-not-exist").Build(); err == nil {
+		t.Error("Expected error for unknown base preset")
+	}
+}
+
+func TestRegister(t *testing.T) {
+	preset, err := NewBuilder("ignored").From("chrome-145").UserAgent("custom-ua").Build()
+	if err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+	preset.HTTP2Settings.SettingsOrder = []uint16{H2SettingHeaderTableSize}
+	preset.HTTP2Settings.PseudoHeaderOrder = []string{":method", ":path"}
+	preset.H2Spec = &H2Spec{
+		Settings:          []H2Setting{{ID: H2SettingHeaderTableSize, Value: 65536}},
+		HeaderPriority:    &H2Priority{Weight: 256},
+		PseudoHeaderOrder: []string{":method", ":path"},
+		PriorityFrames:    []H2PriorityFrame{{StreamID: 3, Priority: H2Priority{Weight: 201}}},
+	}
+	preset.H3Settings = &H3Settings{Additional: []H3Setting{{ID: 0x21, Value: 1}}}
+	Register("test-custom", preset)
+	defer Unregister("test-custom")
+
+	got, ok := Lookup("test-custom")
+	if !ok {
+		t.Fatal("Registered preset not found")
+	}
+	if got.Name != "test-custom" || got.UserAgent != "custom-ua" {
+		t.Errorf("Unexpected preset: name=%q ua=%q", got.Name, got.UserAgent)
+	}
+
+	// Mutating a returned copy must not affect the registry
+	got.Headers["x-mutated"] = "1"
+	got.HTTP2Settings.SettingsOrder[0] = 0
+	got.HTTP2Settings.PseudoHeaderOrder[0] = "x"
+	got.H2Spec.Settings[0].Value = 0
+	got.H2Spec.HeaderPriority.Weight = 1
+	got.H2Spec.PseudoHeaderOrder[0] = "x"
+	got.H2Spec.PriorityFrames[0].StreamID = 0
+	got.H3Settings.Additional[0].Value = 0
+	fresh := Get("test-custom")
+	if _, exists := fresh.Headers["x-mutated"]; exists {
+		t.Error("Registered preset was mutated through a returned copy")
+	}
+	if fresh.HTTP2Settings.SettingsOrder[0] == 0 || fresh.HTTP2Settings.PseudoHeaderOrder[0] == "x" {
+		t.Errorf("HTTP2Settings shared with a returned copy: %+v", fresh.HTTP2Settings)
+	}
+	if s := fresh.H2Spec; s.Settings[0].Value == 0 || s.HeaderPriority.Weight == 1 || s.PseudoHeaderOrder[0] == "x" || s.PriorityFrames[0].StreamID == 0 {
+		t.Errorf("H2Spec shared with a returned copy: %+v", s)
+	}
+	if fresh.H3Settings.Additional[0].Value == 0 {
+		t.Error("H3Settings shared with a returned copy")
+	}
+
+	Unregister("test-custom")
+	if _, ok := Lookup("test-custom"); ok {
+		t.Error("Preset still available after Unregister")
+	}
+}
+
+func TestFirefoxHTTP2Settings(t *testing.T) {
+	for _, name := range []string{"firefox-esr", "firefox-latest"} {
+		settings := Get(name).HTTP2Settings
+		want := []uint16{H2SettingHeaderTableSize, H2SettingEnablePush, H2SettingInitialWindowSize, H2SettingMaxFrameSize}
+		if len(settings.SettingsOrder) != len(want) {
+			t.Fatalf("%s: SettingsOrder = %v, want %v", name, settings.SettingsOrder, want)
+		}
+		for i, id := range want {
+			if settings.SettingsOrder[i] != id {
+				t.Errorf("%s: SettingsOrder[%d] = %d, want %d", name, i, settings.SettingsOrder[i], id)
+			}
+		}
+		if settings.SettingValue(H2SettingInitialWindowSize) != 131072 || settings.ConnectionWindowUpdate != 12517377 {
+			t.Errorf("%s: unexpected window sizes", name)
+		}
+		if got := settings.PseudoHeaderOrder; len(got) != 4 || got[1] != ":path" {
+			t.Errorf("%s: PseudoHeaderOrder = %v, want m,p,a,s", name, got)
+		}
+	}
+}
+
+func TestAndroidTabletPresets(t *testing.T) {
+	phone := Get("chrome-145-android")
+	tablet := Get("chrome-145-android-tablet")
+
+	if strings.Contains(tablet.UserAgent, "Mobile") {
+		t.Errorf("Tablet UA should not contain Mobile: %s", tablet.UserAgent)
+	}
+	if tablet.Headers["sec-ch-ua-mobile"] != "?0" || phone.Headers["sec-ch-ua-mobile"] != "?1" {
+		t.Error("Unexpected sec-ch-ua-mobile values")
+	}
+	for _, h := range tablet.HeaderOrder {
+		if h.Key == "sec-ch-ua-mobile" && h.Value != "?0" {
+			t.Errorf("HeaderOrder sec-ch-ua-mobile = %q, want ?0", h.Value)
+		}
+	}
+	if tablet.ClientHelloID != phone.ClientHelloID || tablet.HTTP2Settings.InitialWindowSize != phone.HTTP2Settings.InitialWindowSize {
+		t.Error("Tablet should share the phone's TLS and HTTP/2 fingerprint")
+	}
+}
+
+func TestParsePreset(t *testing.T) {
+	data := []byte(`{
+		"name": "chrome-146-test",
+		"base": "chrome-145",
+		"clientHello": "Chrome-145_Windows",
+		"quicClientHello": "Chrome-145_QUIC",
+		"userAgent": "custom-ua",
+		"headers": [{"name": "x-extra", "value": "1"}],
+		"http2": {"initialWindowSize": 1048576, "pseudoHeaderOrder": [":method", ":path", ":authority", ":scheme"]}
+	}`)
+	preset, err := ParsePreset(data)
+	if err != nil {
+		t.Fatalf("ParsePreset failed: %v", err)
+	}
+
+	base := Get("chrome-145")
+	if preset.Name != "chrome-146-test" || preset.UserAgent != "custom-ua" {
+		t.Errorf("Unexpected name/UA: %q %q", preset.Name, preset.UserAgent)
+	}
+	if preset.ClientHelloID != tls.HelloChrome_145_Windows || preset.QUICClientHelloID != tls.HelloChrome_145_QUIC {
+		t.Errorf("Unexpected ClientHello IDs: %s %s", preset.ClientHelloID.Str(), preset.QUICClientHelloID.Str())
+	}
+	if preset.HTTP2Settings.InitialWindowSize != 1048576 || preset.HTTP2Settings.HeaderTableSize != base.HTTP2Settings.HeaderTableSize {
+		t.Errorf("HTTP/2 settings not merged onto base: %+v", preset.HTTP2Settings)
+	}
+	if preset.Headers["x-extra"] != "1" || preset.HeaderOrder[len(preset.HeaderOrder)-1].Key != "x-extra" {
+		t.Error("Header not appended")
+	}
+
+	for _, bad := range []string{
+		`{"name": "x", "base": "chrome-145", "clientHello": "Chrome-999"}`,
+		`{"name": "x", "base": "chrome-145", "userAgnet": "typo"}`,
+		`{"name": "x", "base": "chrome-145", "http2": {"windowSize": 1}}`,
+	} {
+		if _, err := ParsePreset([]byte(bad)); err == nil {
+			t.Errorf("Expected error for %s", bad)
+		}
+	}
+}
+
+func TestLoadFileYAML(t *testing.T) {
+	preset, err := LoadFile("testdata/chrome-146.yaml")
+	if err != nil {
+		t.Fatalf("LoadFile failed: %v", err)
+	}
+	if preset.Name != "chrome-146-yaml" || !strings.Contains(preset.UserAgent, "Chrome/146") {
+		t.Errorf("Unexpected name/UA: %q %q", preset.Name, preset.UserAgent)
+	}
+	if preset.ClientHelloID != tls.HelloChrome_145_Windows || preset.QUICClientHelloID != tls.HelloChrome_145_QUIC {
+		t.Errorf("Unexpected ClientHello IDs: %s %s", preset.ClientHelloID.Str(), preset.QUICClientHelloID.Str())
+	}
+	if preset.HTTP2Settings.InitialWindowSize != 6291456 || preset.HTTP2Settings.HeaderTableSize != Get("chrome-145").HTTP2Settings.HeaderTableSize {
+		t.Errorf("HTTP/2 settings not merged onto base: %+v", preset.HTTP2Settings)
+	}
+	if !strings.Contains(preset.Headers["sec-ch-ua"], `v="146"`) {
+		t.Errorf("sec-ch-ua = %q", preset.Headers["sec-ch-ua"])
+	}
+
+	// YAML gets the same unknown field check as JSON; QUIC versions are
+	// process-wide (transport.SetQUICVersions), not a preset field
+	dir := t.TempDir()
+	for name, body := range map[string]string{
+		"typo.yml":     "name: x\nbase: chrome-145\nuserAgnet: typo\n",
+		"invalid.yaml": "name: [x\n",
+		"quic.yaml":    "name: x\nbase: chrome-145\nquicVersions: [v2]\n",
+	} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(body), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := LoadFile(path); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestOSVariantConsistency(t *testing.T) {
+	uaTokens := map[string]string{
+		`"Windows"`: "Windows NT",
+		`"macOS"`:   "Macintosh",
+		`"Linux"`:   "Linux",
+	}
+	for _, version := range []string{"133", "141", "143", "144", "145"} {
+		for _, suffix := range []string{"-windows", "-linux", "-macos", "-win", "-mac"} {
+			name := "chrome-" + version + suffix
+			preset, ok := Lookup(name)
+			if !ok {
+				t.Errorf("preset %q missing", name)
+				continue
+			}
+			platform := preset.Headers["sec-ch-ua-platform"]
+			token, known := uaTokens[platform]
+			if !known {
+				t.Errorf("%s: unexpected sec-ch-ua-platform %s", name, platform)
+				continue
+			}
+			if !strings.Contains(preset.UserAgent, token) {
+				t.Errorf("%s: UA %q does not match platform %s", name, preset.UserAgent, platform)
+			}
+			for _, h := range preset.HeaderOrder {
+				if h.Key == "sec-ch-ua-platform" && h.Value != platform {
+					t.Errorf("%s: HeaderOrder platform %s != %s", name, h.Value, platform)
+				}
+			}
+		}
+	}
+}
+
+// FuzzParsePreset checks that malformed preset definitions fail cleanly
+func FuzzParsePreset(f *testing.F) {
+	f.Add([]byte(`{"name": "x", "base": "chrome-145", "userAgent": "ua", "headers": [{"name": "x-extra", "value": "1"}]}`))
+	f.Add([]byte(`{"name": "x", "base": "chrome-145", "http2": {"initialWindowSize": 1048576, "pseudoHeaderOrder": [":method", ":path"]}}`))
+	f.Add([]byte(`{"name": "x", "base": "chrome-145", "http3Settings": {"qpackMaxTableCapacity": 0}}`))
+	f.Add([]byte(`{"name": "x", "clientHello": "Chrome-145_Windows", "quicClientHello": "Chrome-145_QUIC"}`))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		preset, err := ParsePreset(data)
+		if err == nil && preset == nil {
+			t.Fatal("nil preset without an error")
+		}
+	})
+}
+
+func TestFirefoxPostQuantum(t *testing.T) {
+	// Firefox 128 ESR sends the Firefox 120 hello unchanged
+	if esr := Get("firefox-esr"); esr.PostQuantum || esr.HasTLSOverrides() {
+		t.Error("firefox-esr changes the Firefox 120 ClientHello")
+	}
+
+	// Firefox 132+ offers X25519MLKEM768 first (Firefox doesn't use GREASE)
+	latest := Get("firefox-latest")
+	if !latest.HasTLSOverrides() {
+		t.Fatal("firefox-latest has no TLS overrides")
+	}
+	spec, err := tls.UTLSIdToSpec(latest.ClientHelloID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	latest.ApplyTLSOverrides(&spec)
+	for _, ext := range spec.Extensions {
+		switch e := ext.(type) {
+		case *tls.KeyShareExtension:
+			if e.KeyShares[0].Group != tls.X25519MLKEM768 {
+				t.Errorf("key shares = %v, want X25519MLKEM768 first", e.KeyShares)
+			}
+		case *tls.SupportedCurvesExtension:
+			if e.Curves[0] != tls.X25519MLKEM768 {
+				t.Errorf("groups = %v, want X25519MLKEM768 first", e.Curves)
+			}
+		}
+	}
+
+	p, err := NewBuilder("firefox-classic").From("firefox-latest").PostQuantum(false).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.HasTLSOverrides() {
+		t.Error("Builder.PostQuantum(false) kept the override")
+	}
+}
@@ -0,0 +1,94 @@
+package fingerprint
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	tls "github.com/sardanioss/utls"
+)
+
+// FromRawClientHello turns a captured ClientHello into a spec that replays its
+// exact cipher suites, extension order and extension contents. Use it to clone
+// clients no preset covers (smart TVs, consoles, native apps).
+//
+// b is the ClientHello handshake message, with or without its TLS record
+// header, as raw bytes or as hex text (e.g., copied from Wireshark's
+// "Copy as Hex Stream"). GREASE values are regenerated per connection and
+// key shares are freshly generated; everything else is sent as captured.
+// Extensions utls doesn't know are replayed byte for byte.
+func FromRawClientHello(b []byte) (*tls.ClientHelloSpec, error) {
+	raw, err := normalizeClientHello(b)
+	if err != nil {
+		return nil, err
+	}
+	f := &tls.Fingerprinter{AllowBluntMimicry: true}
+	spec, err := f.FingerprintClientHello(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ClientHello: %w", err)
+	}
+	return spec, nil
+}
+
+// RawClientHelloHasExtension reports whether a captured ClientHello (in any
+// form FromRawClientHello accepts) contains the given extension
+func RawClientHelloHasExtension(b []byte, id uint16) bool {
+	raw, err := normalizeClientHello(b)
+	if err != nil {
+		return false
+	}
+	hello, err := parseClientHello(raw)
+	if err != nil {
+		return false
+	}
+	return slices.Contains(hello.extensions, id)
+}
+
+// normalizeClientHello decodes hex input and wraps a bare handshake message in
+// the TLS record header utls expects
+func normalizeClientHello(b []byte) ([]byte, error) {
+	if decoded, ok := decodeHexClientHello(b); ok {
+		b = decoded
+	}
+	if len(b) >= 5 && b[0] == 0x16 && b[1] == 0x03 {
+		if _, err := parseClientHello(b); err != nil {
+			return nil, err
+		}
+		return b, nil
+	}
+	if _, err := parseClientHello(b); err != nil {
+		return nil, err
+	}
+	if len(b) > 0xffff {
+		return nil, errors.New("ClientHello too large for a single TLS record")
+	}
+	record := make([]byte, 5, 5+len(b))
+	record[0] = 0x16
+	record[1], record[2] = 0x03, 0x01
+	record[3], record[4] = byte(len(b)>>8), byte(len(b))
+	return append(record, b...), nil
+}
+
+// decodeHexClientHello decodes hex text, ignoring whitespace, colons and 0x prefixes
+func decodeHexClientHello(b []byte) ([]byte, bool) {
+	text := strings.ToLower(string(bytes.TrimSpace(b)))
+	if text == "" {
+		return nil, false
+	}
+	text = strings.ReplaceAll(text, "0x", "")
+	text = strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '\t', '\r', '\n', ':':
+			return -1
+		}
+		return r
+	}, text)
+	decoded, err := hex.DecodeString(text)
+	if err != nil {
+		return nil, false
+	}
+	return decoded, true
+}
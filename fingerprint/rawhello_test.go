@@ -0,0 +1,58 @@
+package fingerprint
+
+import (
+	"encoding/hex"
+	"net"
+	"slices"
+	"testing"
+
+	tls "github.com/sardanioss/utls"
+)
+
+func TestFromRawClientHello(t *testing.T) {
+	captured := buildClientHello(t, tls.HelloFirefox_120, "example.com")
+	want, err := parseClientHello(captured)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, input := range map[string][]byte{
+		"handshake": captured,
+		"record":    append([]byte{0x16, 0x03, 0x01, byte(len(captured) >> 8), byte(len(captured))}, captured...),
+		"hex":       []byte(hex.EncodeToString(captured) + "\n"),
+	} {
+		spec, err := FromRawClientHello(input)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+
+		// Replaying the spec must reproduce the captured layout
+		client, server := net.Pipe()
+		conn := tls.UClient(client, &tls.Config{ServerName: "example.com"}, tls.HelloCustom)
+		if err := conn.ApplyPreset(spec); err != nil {
+			t.Fatalf("%s: ApplyPreset: %v", name, err)
+		}
+		if err := conn.BuildHandshakeState(); err != nil {
+			t.Fatalf("%s: BuildHandshakeState: %v", name, err)
+		}
+		got, err := parseClientHello(conn.HandshakeState.Hello.Raw)
+		client.Close()
+		server.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(got.cipherSuites, want.cipherSuites) {
+			t.Errorf("%s: cipher suites = %x, want %x", name, got.cipherSuites, want.cipherSuites)
+		}
+		if !slices.Equal(got.extensions, want.extensions) {
+			t.Errorf("%s: extensions = %v, want %v", name, got.extensions, want.extensions)
+		}
+	}
+
+	if RawClientHelloHasExtension(captured, 41) {
+		t.Error("fresh ClientHello reported a pre_shared_key extension")
+	}
+	if _, err := FromRawClientHello([]byte("not a client hello")); err == nil {
+		t.Error("expected an error for garbage input")
+	}
+}
@@ -0,0 +1,241 @@
+package fingerprint
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	tls "github.com/sardanioss/utls"
+)
+
+// Mismatch is an inconsistency between two parts of a preset that a server can
+// cross-check, such as a Chrome User-Agent sent with a Firefox ClientHello.
+type Mismatch struct {
+	Field   string // What disagrees, e.g. "sec-ch-ua" or "http2"
+	Message string
+}
+
+func (m Mismatch) String() string {
+	return m.Field + ": " + m.Message
+}
+
+// Browser engine families used to compare the layers of a preset
+const (
+	familyChromium = "chromium"
+	familyFirefox  = "firefox"
+	familyWebKit   = "webkit"
+)
+
+var (
+	uaChromeVersion = regexp.MustCompile(`(?:Chrome|CriOS)/(\d+)`)
+	chUABrand       = regexp.MustCompile(`"([^"]+)";v="(\d+)"`)
+)
+
+// Validate cross-checks the User-Agent, Sec-CH-UA client hints, ClientHelloIDs,
+// ALPN and HTTP/2 settings of a preset and returns every mismatch it finds.
+// A nil result means the layers agree with each other. Run it on custom presets
+// (see Builder and LoadFile) before using them; the built-in presets pass.
+//
+// Example:
+//
+//	for _, m := range fingerprint.Validate(preset) {
+//	    log.Printf("preset %s: %s", preset.Name, m)
+//	}
+func Validate(p *Preset) []Mismatch {
+	var mismatches []Mismatch
+	report := func(field, format string, args ...any) {
+		mismatches = append(mismatches, Mismatch{Field: field, Message: fmt.Sprintf(format, args...)})
+	}
+
+	uaFamily := userAgentFamily(p.UserAgent)
+	tlsFamily := clientHelloFamily(p.ClientHelloID)
+	h2Family := http2Family(p.HTTP2Settings)
+
+	if p.UserAgent == "" {
+		report("user-agent", "User-Agent is empty")
+	}
+	if uaFamily != "" && tlsFamily != "" && uaFamily != tlsFamily {
+		report("clientHello", "User-Agent is %s but ClientHelloID %s is %s", uaFamily, p.ClientHelloID.Str(), tlsFamily)
+	}
+	if uaFamily != "" && h2Family != uaFamily {
+		report("http2", "User-Agent is %s but HTTP/2 settings (pseudo-header order %s) are %s",
+			uaFamily, strings.Join(effectivePseudoOrder(p.HTTP2Settings), ","), h2Family)
+	}
+
+	for _, id := range []struct {
+		field string
+		id    tls.ClientHelloID
+	}{
+		{"pskClientHello", p.PSKClientHelloID},
+		{"quicClientHello", p.QUICClientHelloID},
+		{"quicPskClientHello", p.QUICPSKClientHelloID},
+	} {
+		if family := clientHelloFamily(id.id); family != "" && tlsFamily != "" && family != tlsFamily {
+			report(id.field, "%s is %s but ClientHelloID %s is %s", id.id.Str(), family, p.ClientHelloID.Str(), tlsFamily)
+		}
+	}
+	if p.SupportHTTP3 && p.QUICClientHelloID.Client == "" {
+		report("quicClientHello", "HTTP/3 is enabled without a QUIC ClientHelloID")
+	}
+
+	if alpn := effectiveALPN(p); alpn != nil && !slices.Equal(alpn, []string{"h2", "http/1.1"}) {
+		report("alpn", "browsers offer h2,http/1.1 but the preset offers %s", strings.Join(alpn, ","))
+	}
+
+	validateClientHints(p, uaFamily, report)
+
+	for _, h := range p.HeaderOrder {
+		if h.Value == "" {
+			continue
+		}
+		for key, value := range p.Headers {
+			if strings.EqualFold(key, h.Key) && value != h.Value {
+				report(h.Key, "Headers has %q but HeaderOrder has %q", value, h.Value)
+			}
+		}
+	}
+
+	return mismatches
+}
+
+// validateClientHints checks the Sec-CH-UA headers against the User-Agent.
+// Chromium sends them (except on iOS, where every browser is WebKit); Firefox and Safari don't.
+func validateClientHints(p *Preset, uaFamily string, report func(field, format string, args ...any)) {
+	brands := presetHeader(p, "sec-ch-ua")
+	if uaFamily != familyChromium {
+		if brands != "" {
+			report("sec-ch-ua", "%s User-Agent must not send client hints", uaFamily)
+		}
+		return
+	}
+	if brands == "" {
+		return
+	}
+
+	if m := uaChromeVersion.FindStringSubmatch(p.UserAgent); m != nil {
+		found := false
+		for _, brand := range chUABrand.FindAllStringSubmatch(brands, -1) {
+			if brand[1] == "Chromium" || brand[1] == "Google Chrome" {
+				found = true
+				if brand[2] != m[1] {
+					report("sec-ch-ua", "%s version %s does not match User-Agent version %s", brand[1], brand[2], m[1])
+				}
+			}
+		}
+		if !found {
+			report("sec-ch-ua", "no Chromium brand in %s", brands)
+		}
+	}
+
+	if mobile := presetHeader(p, "sec-ch-ua-mobile"); mobile != "" {
+		uaMobile := strings.Contains(p.UserAgent, " Mobile")
+		if (mobile == "?1") != uaMobile {
+			report("sec-ch-ua-mobile", "%s does not match User-Agent (mobile=%v)", mobile, uaMobile)
+		}
+	}
+
+	if platform := strings.Trim(presetHeader(p, "sec-ch-ua-platform"), `"`); platform != "" {
+		tokens := map[string]string{
+			"Windows": "Windows NT",
+			"macOS":   "Macintosh",
+			"Linux":   "X11; Linux",
+			"Android": "Android",
+		}
+		if token, ok := tokens[platform]; ok && !strings.Contains(p.UserAgent, token) {
+			report("sec-ch-ua-platform", "%q does not match User-Agent", platform)
+		}
+	}
+}
+
+// presetHeader returns a preset header value, preferring HeaderOrder
+func presetHeader(p *Preset, name string) string {
+	for _, h := range p.HeaderOrder {
+		if strings.EqualFold(h.Key, name) && h.Value != "" {
+			return h.Value
+		}
+	}
+	for key, value := range p.Headers {
+		if strings.EqualFold(key, name) {
+			return value
+		}
+	}
+	return ""
+}
+
+// BrowserFamily returns the browser engine the preset's User-Agent claims:
+// "chromium", "firefox", "webkit", or "" if unknown
+func (p *Preset) BrowserFamily() string {
+	return userAgentFamily(p.UserAgent)
+}
+
+// userAgentFamily returns the engine a User-Agent claims, or "" if unknown
+func userAgentFamily(ua string) string {
+	switch {
+	case strings.Contains(ua, "iPhone") || strings.Contains(ua, "iPad"):
+		return familyWebKit // Every iOS browser is WebKit
+	case strings.Contains(ua, "Firefox/"):
+		return familyFirefox
+	case strings.Contains(ua, "Chrome/") || strings.Contains(ua, "Chromium/"):
+		return familyChromium
+	case strings.Contains(ua, "Safari/"):
+		return familyWebKit
+	}
+	return ""
+}
+
+// clientHelloFamily returns the engine a ClientHelloID imitates, or "" if unknown
+func clientHelloFamily(id tls.ClientHelloID) string {
+	switch id.Client {
+	case "Chrome", "Edge", "360Browser", "QQBrowser":
+		return familyChromium
+	case "Firefox":
+		return familyFirefox
+	case "Safari", "iOS":
+		return familyWebKit
+	}
+	return ""
+}
+
+// http2Family identifies the engine from the pseudo-header order the transport will send
+func http2Family(s HTTP2Settings) string {
+	switch strings.Join(effectivePseudoOrder(s), ",") {
+	case ":method,:path,:authority,:scheme":
+		return familyFirefox
+	case ":method,:scheme,:path,:authority":
+		return familyWebKit
+	case ":method,:authority,:scheme,:path":
+		return familyChromium
+	}
+	return ""
+}
+
+// effectivePseudoOrder mirrors the transport's pseudo-header order selection
+func effectivePseudoOrder(s HTTP2Settings) []string {
+	switch {
+	case len(s.PseudoHeaderOrder) > 0:
+		return s.PseudoHeaderOrder
+	case s.NoRFC7540Priorities:
+		return []string{":method", ":scheme", ":path", ":authority"}
+	default:
+		return []string{":method", ":authority", ":scheme", ":path"}
+	}
+}
+
+// effectiveALPN returns the ALPN list sent on TCP connections, or nil if the
+// ClientHelloID can't be expanded into a spec
+func effectiveALPN(p *Preset) []string {
+	if len(p.ALPN) > 0 {
+		return p.ALPN
+	}
+	spec, err := tls.UTLSIdToSpec(p.ClientHelloID)
+	if err != nil {
+		return nil
+	}
+	for _, ext := range spec.Extensions {
+		if alpn, ok := ext.(*tls.ALPNExtension); ok {
+			return alpn.AlpnProtocols
+		}
+	}
+	return nil
+}
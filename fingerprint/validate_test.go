@@ -0,0 +1,50 @@
+package fingerprint
+
+import (
+	"strings"
+	"testing"
+
+	tls "github.com/sardanioss/utls"
+)
+
+func TestValidateBuiltinPresets(t *testing.T) {
+	for _, name := range Available() {
+		for _, m := range Validate(Get(name)) {
+			t.Errorf("%s: %s", name, m)
+		}
+	}
+}
+
+func TestValidateMismatches(t *testing.T) {
+	p, err := NewBuilder("bad").
+		From("chrome-145-windows").
+		ClientHelloID(tls.HelloFirefox_120).
+		ALPN("http/1.1", "h2").
+		Header("sec-ch-ua", `"Google Chrome";v="140", "Chromium";v="140"`).
+		Header("sec-ch-ua-platform", `"macOS"`).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := map[string]bool{}
+	for _, m := range Validate(p) {
+		got[m.Field] = true
+	}
+	for _, field := range []string{"clientHello", "pskClientHello", "alpn", "sec-ch-ua", "sec-ch-ua-platform"} {
+		if !got[field] {
+			t.Errorf("expected a %s mismatch, got %v", field, Validate(p))
+		}
+	}
+
+	p.HTTP2Settings = firefoxHTTP2Settings()
+	found := false
+	for _, m := range Validate(p) {
+		if m.Field == "http2" && strings.Contains(m.Message, "firefox") {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("expected an http2 mismatch for Firefox settings on a Chrome User-Agent")
+	}
+}
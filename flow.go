@@ -0,0 +1,743 @@
+package httpcloak
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sardanioss/httpcloak/fingerprint"
+	"golang.org/x/net/html"
+)
+
+// Flow is a declarative sequence of requests run through one session, such
+// as a login or checkout: load a page, extract a token, post it back and
+// check the outcome. Each step is sent with the headers a browser would use
+// for it (Referer, Origin and Sec-Fetch-* relative to the page the flow is
+// on), so multi-step flows don't need hand-written header bookkeeping.
+//
+// Flows can be read from YAML or JSON with LoadFlow:
+//
+//	name: login
+//	vars:
+//	  user: ${LOGIN_USER}
+//	steps:
+//	  - name: login page
+//	    url: https://example.com/login
+//	    extract:
+//	      - var: csrf
+//	        css: form#login input[name=csrf]
+//	        attr: value
+//	  - name: submit
+//	    method: POST
+//	    url: /session
+//	    form:
+//	      username: "{{user}}"
+//	      password: ${LOGIN_PASS}
+//	      csrf: "{{csrf}}"
+//	    expect:
+//	      status: [200]
+//	  - name: profile
+//	    kind: fetch
+//	    url: /api/me
+//	    extract:
+//	      - var: user_id
+//	        json: data.id
+//
+// or built in Go:
+//
+//	flow := httpcloak.NewFlow("login").
+//	    Get("https://example.com/login").
+//	    Extract(httpcloak.FlowExtract{Var: "csrf", CSS: "input[name=csrf]", Attr: "value"}).
+//	    PostForm("/session", map[string]string{"username": "{{user}}", "csrf": "{{csrf}}"}).
+//	    ExpectStatus(200)
+//	result, err := flow.Run(ctx, sess, map[string]string{"user": "alice"})
+//
+// {{name}} in URLs, headers, bodies and expectations is replaced with the
+// variable name: from Vars, the vars passed to Run, or an earlier extraction.
+type Flow struct {
+	Name  string            `json:"name,omitempty"`
+	Vars  map[string]string `json:"vars,omitempty"`
+	Steps []FlowStep        `json:"steps"`
+}
+
+// FlowStepKind selects the headers a step is sent with
+type FlowStepKind string
+
+const (
+	// FlowNavigate is a top-level page load or form submission. The page it
+	// ends on (after redirects) becomes the referrer of later steps.
+	FlowNavigate FlowStepKind = "navigate"
+	// FlowFetch is a fetch()/XHR call made by the current page
+	FlowFetch FlowStepKind = "fetch"
+)
+
+// FlowStep is one request of a Flow
+type FlowStep struct {
+	Name string `json:"name,omitempty"`
+
+	// Method defaults to GET, or POST when the step has a body
+	Method string `json:"method,omitempty"`
+
+	// URL may be relative to the page the flow is on
+	URL string `json:"url"`
+
+	// Kind defaults to FlowNavigate
+	Kind FlowStepKind `json:"kind,omitempty"`
+
+	// Headers are sent on top of the generated ones and win over them
+	Headers map[string]string `json:"headers,omitempty"`
+
+	// At most one body: Form is sent URL-encoded (fields sorted by name),
+	// JSON is marshaled, Body is sent as is
+	Form map[string]string `json:"form,omitempty"`
+	JSON interface{}       `json:"json,omitempty"`
+	Body string            `json:"body,omitempty"`
+
+	// Extract stores values from the response in variables
+	Extract []FlowExtract `json:"extract,omitempty"`
+
+	// Expect fails the flow when the response doesn't match
+	Expect *FlowExpect `json:"expect,omitempty"`
+}
+
+// FlowExtract stores one value of a response in the variable Var. Exactly
+// one source is set: CSS (text of the first matching element, or its
+// attribute Attr), JSON (a dotted path such as data.items[0].id), Regex (the
+// first capture group, or the whole match), Header or Cookie.
+type FlowExtract struct {
+	Var string `json:"var"`
+
+	CSS    string `json:"css,omitempty"`
+	Attr   string `json:"attr,omitempty"`
+	JSON   string `json:"json,omitempty"`
+	Regex  string `json:"regex,omitempty"`
+	Header string `json:"header,omitempty"`
+	Cookie string `json:"cookie,omitempty"`
+
+	// Optional steps don't fail when nothing matches; Var is set to Default
+	Optional bool   `json:"optional,omitempty"`
+	Default  string `json:"default,omitempty"`
+}
+
+// FlowExpect is what a step's response must look like
+type FlowExpect struct {
+	// Status lists the accepted status codes; empty accepts any
+	Status []int `json:"status,omitempty"`
+
+	// BodyContains must appear in the body
+	BodyContains string `json:"body_contains,omitempty"`
+
+	// URLContains must appear in the final URL (after redirects)
+	URLContains string `json:"url_contains,omitempty"`
+}
+
+// FlowResult is the outcome of Flow.Run
+type FlowResult struct {
+	// Vars holds the variables after the last step that ran
+	Vars  map[string]string
+	Steps []FlowStepResult
+}
+
+// FlowStepResult describes one step that was sent
+type FlowStepResult struct {
+	Name       string
+	Method     string
+	URL        string
+	FinalURL   string
+	StatusCode int
+	Duration   time.Duration
+}
+
+// FlowError is returned by Flow.Run when a step fails
+type FlowError struct {
+	Step int // index into Flow.Steps
+	Name string
+	URL  string
+	Err  error
+}
+
+func (e *FlowError) Error() string {
+	name := e.Name
+	if name == "" {
+		name = e.URL
+	}
+	return fmt.Sprintf("flow step %d (%s): %v", e.Step+1, name, e.Err)
+}
+
+func (e *FlowError) Unwrap() error {
+	return e.Err
+}
+
+// NewFlow returns an empty flow to add steps to
+func NewFlow(name string) *Flow {
+	return &Flow{Name: name}
+}
+
+// LoadFlow reads a Flow from a YAML or JSON file (.json is JSON, anything
+// else YAML). ${VAR} references are expanded from the environment as in
+// session config files; {{name}} flow variables are left for Run.
+func LoadFlow(path string) (*Flow, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if data, err = expandEnv(data); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	var flow Flow
+	if err := decodeConfigFile(data, strings.EqualFold(filepath.Ext(path), ".json"), &flow); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if err := flow.Validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &flow, nil
+}
+
+// Step appends a step
+func (f *Flow) Step(step FlowStep) *Flow {
+	f.Steps = append(f.Steps, step)
+	return f
+}
+
+// Get appends a page load of url
+func (f *Flow) Get(url string) *Flow {
+	return f.Step(FlowStep{Method: "GET", URL: url})
+}
+
+// PostForm appends a form submission to url
+func (f *Flow) PostForm(url string, form map[string]string) *Flow {
+	return f.Step(FlowStep{Method: "POST", URL: url, Form: form})
+}
+
+// Fetch appends a fetch()/XHR call; body, when not nil, is sent as JSON
+func (f *Flow) Fetch(method, url string, body interface{}) *Flow {
+	return f.Step(FlowStep{Method: method, URL: url, Kind: FlowFetch, JSON: body})
+}
+
+// Extract adds an extraction to the last step
+func (f *Flow) Extract(extract FlowExtract) *Flow {
+	if last := f.last(); last != nil {
+		last.Extract = append(last.Extract, extract)
+	}
+	return f
+}
+
+// ExpectStatus makes the last step fail unless its status is one of codes
+func (f *Flow) ExpectStatus(codes ...int) *Flow {
+	if last := f.last(); last != nil {
+		if last.Expect == nil {
+			last.Expect = &FlowExpect{}
+		}
+		last.Expect.Status = codes
+	}
+	return f
+}
+
+func (f *Flow) last() *FlowStep {
+	if len(f.Steps) == 0 {
+		return nil
+	}
+	return &f.Steps[len(f.Steps)-1]
+}
+
+// Validate reports steps that can't run, such as bad selectors or several
+// bodies on one step
+func (f *Flow) Validate() error {
+	if len(f.Steps) == 0 {
+		return fmt.Errorf("flow %s has no steps", f.Name)
+	}
+	for i := range f.Steps {
+		if err := f.Steps[i].validate(); err != nil {
+			return &FlowError{Step: i, Name: f.Steps[i].Name, URL: f.Steps[i].URL, Err: err}
+		}
+	}
+	return nil
+}
+
+func (s *FlowStep) validate() error {
+	if s.URL == "" {
+		return fmt.Errorf("url is required")
+	}
+	switch s.Kind {
+	case "", FlowNavigate, FlowFetch:
+	default:
+		return fmt.Errorf("unknown kind %q", s.Kind)
+	}
+	bodies := 0
+	for _, set := range []bool{s.Form != nil, s.JSON != nil, s.Body != ""} {
+		if set {
+			bodies++
+		}
+	}
+	if bodies > 1 {
+		return fmt.Errorf("only one of form, json and body can be set")
+	}
+	for _, ex := range s.Extract {
+		if ex.Var == "" {
+			return fmt.Errorf("extract needs a var")
+		}
+		sources := 0
+		for _, src := range []string{ex.CSS, ex.JSON, ex.Regex, ex.Header, ex.Cookie} {
+			if src != "" {
+				sources++
+			}
+		}
+		if sources != 1 {
+			return fmt.Errorf("extract %s: set exactly one of css, json, regex, header and cookie", ex.Var)
+		}
+		if ex.CSS != "" {
+			if _, err := parseSelector(ex.CSS); err != nil {
+				return err
+			}
+		}
+		if ex.Regex != "" {
+			if _, err := regexp.Compile(ex.Regex); err != nil {
+				return fmt.Errorf("extract %s: %w", ex.Var, err)
+			}
+		}
+		if ex.JSON != "" {
+			if _, err := parseJSONPath(ex.JSON); err != nil {
+				return fmt.Errorf("extract %s: %w", ex.Var, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Run sends the steps in order through sess, stopping at the first failure.
+// vars are added to Flow.Vars (and win over them) for this run only, so one
+// Flow can run concurrently with different inputs. The result covers the
+// steps sent so far, also when an error (a *FlowError) is returned.
+func (f *Flow) Run(ctx context.Context, sess *Session, vars map[string]string) (*FlowResult, error) {
+	result := &FlowResult{Vars: make(map[string]string, len(f.Vars)+len(vars))}
+	for k, v := range f.Vars {
+		result.Vars[k] = v
+	}
+	for k, v := range vars {
+		result.Vars[k] = v
+	}
+	if err := f.Validate(); err != nil {
+		return result, err
+	}
+
+	page := ""
+	for i := range f.Steps {
+		step := &f.Steps[i]
+		stepResult, finalURL, err := step.run(ctx, sess, page, result.Vars)
+		if stepResult != nil {
+			result.Steps = append(result.Steps, *stepResult)
+		}
+		if err != nil {
+			return result, &FlowError{Step: i, Name: step.Name, URL: step.URL, Err: err}
+		}
+		if step.Kind != FlowFetch {
+			page = finalURL
+		}
+	}
+	return result, nil
+}
+
+// run sends one step from page and returns the final URL of its response
+func (s *FlowStep) run(ctx context.Context, sess *Session, page string, vars map[string]string) (*FlowStepResult, string, error) {
+	rawURL, err := expandFlowVars(s.URL, vars)
+	if err != nil {
+		return nil, "", err
+	}
+	target, err := resolveFlowURL(page, rawURL)
+	if err != nil {
+		return nil, "", err
+	}
+
+	body, contentType, err := s.body(vars)
+	if err != nil {
+		return nil, "", err
+	}
+	method := strings.ToUpper(s.Method)
+	if method == "" {
+		method = "GET"
+		if body != nil {
+			method = "POST"
+		}
+	}
+
+	headers := flowHeaders(s.Kind, method, page, target, contentType)
+	for name, value := range s.Headers {
+		if value, err = expandFlowVars(value, vars); err != nil {
+			return nil, "", err
+		}
+		for key := range headers {
+			if strings.EqualFold(key, name) {
+				delete(headers, key)
+			}
+		}
+		headers[name] = []string{value}
+	}
+
+	req := &Request{Method: method, URL: target, Headers: headers}
+	if body != nil {
+		req.Body = bytes.NewReader(body)
+	}
+	start := time.Now()
+	resp, err := sess.Do(ctx, req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Close()
+	respBody, err := resp.Bytes()
+	stepResult := &FlowStepResult{
+		Name:       s.Name,
+		Method:     method,
+		URL:        target,
+		FinalURL:   resp.FinalURL,
+		StatusCode: resp.StatusCode,
+		Duration:   time.Since(start),
+	}
+	if err != nil {
+		return stepResult, resp.FinalURL, err
+	}
+	finalURL := resp.FinalURL
+	if finalURL == "" {
+		finalURL = target
+	}
+
+	if err := s.check(resp, respBody, vars); err != nil {
+		return stepResult, finalURL, err
+	}
+	var doc *html.Node
+	for _, ex := range s.Extract {
+		value, ok, err := ex.extract(sess, resp, respBody, &doc)
+		if err != nil {
+			return stepResult, finalURL, err
+		}
+		if !ok {
+			if !ex.Optional {
+				return stepResult, finalURL, fmt.Errorf("extract %s: no match", ex.Var)
+			}
+			value = ex.Default
+		}
+		vars[ex.Var] = value
+	}
+	return stepResult, finalURL, nil
+}
+
+// body returns the encoded request body and its Content-Type
+func (s *FlowStep) body(vars map[string]string) ([]byte, string, error) {
+	switch {
+	case s.Form != nil:
+		names := make([]string, 0, len(s.Form))
+		for name := range s.Form {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		fields := make([]FormField, 0, len(names))
+		for _, name := range names {
+			value, err := expandFlowVars(s.Form[name], vars)
+			if err != nil {
+				return nil, "", err
+			}
+			fields = append(fields, FormField{Name: name, Value: value})
+		}
+		return []byte(formURLEncode(fields)), "application/x-www-form-urlencoded", nil
+	case s.JSON != nil:
+		data, err := json.Marshal(s.JSON)
+		if err != nil {
+			return nil, "", err
+		}
+		var doc interface{}
+		if err := json.Unmarshal(data, &doc); err != nil {
+			return nil, "", err
+		}
+		if doc, err = expandFlowJSON(doc, vars); err != nil {
+			return nil, "", err
+		}
+		data, err = json.Marshal(doc)
+		return data, "application/json", err
+	case s.Body != "":
+		body, err := expandFlowVars(s.Body, vars)
+		return []byte(body), "", err
+	}
+	return nil, "", nil
+}
+
+// check applies the step's expectations
+func (s *FlowStep) check(resp *Response, body []byte, vars map[string]string) error {
+	expect := s.Expect
+	if expect == nil {
+		return nil
+	}
+	if len(expect.Status) > 0 {
+		ok := false
+		for _, code := range expect.Status {
+			ok = ok || code == resp.StatusCode
+		}
+		if !ok {
+			return fmt.Errorf("status %d, want %v", resp.StatusCode, expect.Status)
+		}
+	}
+	if expect.BodyContains != "" {
+		want, err := expandFlowVars(expect.BodyContains, vars)
+		if err != nil {
+			return err
+		}
+		if !bytes.Contains(body, []byte(want)) {
+			return fmt.Errorf("body does not contain %q", want)
+		}
+	}
+	if expect.URLContains != "" {
+		want, err := expandFlowVars(expect.URLContains, vars)
+		if err != nil {
+			return err
+		}
+		if !strings.Contains(resp.FinalURL, want) {
+			return fmt.Errorf("final URL %s does not contain %q", resp.FinalURL, want)
+		}
+	}
+	return nil
+}
+
+// extract returns the value the extraction selects; doc caches the parsed
+// HTML across the extractions of a step
+func (ex *FlowExtract) extract(sess *Session, resp *Response, body []byte, doc **html.Node) (string, bool, error) {
+	switch {
+	case ex.CSS != "":
+		sel, err := parseSelector(ex.CSS)
+		if err != nil {
+			return "", false, err
+		}
+		if *doc == nil {
+			if *doc, err = html.Parse(bytes.NewReader(body)); err != nil {
+				return "", false, fmt.Errorf("extract %s: %w", ex.Var, err)
+			}
+		}
+		n := sel.first(*doc)
+		if n == nil {
+			return "", false, nil
+		}
+		if ex.Attr != "" {
+			value, ok := lookupAttr(n, strings.ToLower(ex.Attr))
+			return value, ok, nil
+		}
+		return htmlText(n), true, nil
+	case ex.JSON != "":
+		path, err := parseJSONPath(ex.JSON)
+		if err != nil {
+			return "", false, err
+		}
+		var v interface{}
+		dec := json.NewDecoder(bytes.NewReader(body))
+		dec.UseNumber()
+		if err := dec.Decode(&v); err != nil {
+			return "", false, fmt.Errorf("extract %s: response is not JSON: %w", ex.Var, err)
+		}
+		return lookupJSONPath(v, path)
+	case ex.Regex != "":
+		re, err := regexp.Compile(ex.Regex)
+		if err != nil {
+			return "", false, err
+		}
+		m := re.FindSubmatch(body)
+		if m == nil {
+			return "", false, nil
+		}
+		if len(m) > 1 {
+			return string(m[1]), true, nil
+		}
+		return string(m[0]), true, nil
+	case ex.Header != "":
+		values := resp.GetHeaders(ex.Header)
+		if len(values) == 0 {
+			return "", false, nil
+		}
+		return values[0], true, nil
+	case ex.Cookie != "":
+		value, ok := sess.GetCookies()[ex.Cookie]
+		return value, ok, nil
+	}
+	return "", false, nil
+}
+
+// flowHeaders returns the browser headers for a step sent from page
+func flowHeaders(kind FlowStepKind, method, page, target, contentType string) map[string][]string {
+	var reqCtx fingerprint.RequestContext
+	if kind == FlowFetch {
+		reqCtx = fingerprint.XHRContext(page, target)
+	} else {
+		reqCtx = fingerprint.NavigationContext()
+		if page != "" {
+			reqCtx.Site = fingerprint.XHRContext(page, target).Site
+		}
+	}
+	secFetch := fingerprint.GenerateSecFetchHeaders(reqCtx)
+
+	headers := map[string][]string{
+		"Sec-Fetch-Site": {secFetch.Site},
+		"Sec-Fetch-Mode": {secFetch.Mode},
+		"Sec-Fetch-Dest": {secFetch.Dest},
+	}
+	if kind == FlowFetch {
+		headers["Accept"] = []string{"*/*"}
+	}
+	if page != "" {
+		headers["Referer"] = []string{page}
+		// Browsers send Origin with every non-GET request and with CORS
+		// requests to other origins
+		if origin := flowOrigin(page); origin != "" && (method != "GET" && method != "HEAD" || kind == FlowFetch && secFetch.Site != string(fingerprint.FetchSiteSameOrigin)) {
+			headers["Origin"] = []string{origin}
+		}
+	}
+	if contentType != "" {
+		headers["Content-Type"] = []string{contentType}
+	}
+	if kind != FlowFetch && method == "POST" {
+		headers["Cache-Control"] = []string{"max-age=0"}
+	}
+	return headers
+}
+
+func flowOrigin(page string) string {
+	u, err := url.Parse(page)
+	if err != nil || u.Host == "" {
+		return ""
+	}
+	return u.Scheme + "://" + u.Host
+}
+
+// resolveFlowURL resolves ref against the page the flow is on
+func resolveFlowURL(page, ref string) (string, error) {
+	u, err := url.Parse(ref)
+	if err != nil {
+		return "", err
+	}
+	if u.IsAbs() {
+		return ref, nil
+	}
+	if page == "" {
+		return "", fmt.Errorf("relative URL %s before any page was loaded", ref)
+	}
+	base, err := url.Parse(page)
+	if err != nil {
+		return "", err
+	}
+	return base.ResolveReference(u).String(), nil
+}
+
+var flowVarRef = regexp.MustCompile(`\{\{\s*([A-Za-z_][A-Za-z0-9_.-]*)\s*\}\}`)
+
+// expandFlowVars replaces {{name}} with flow variables
+func expandFlowVars(s string, vars map[string]string) (string, error) {
+	var missing []string
+	out := flowVarRef.ReplaceAllStringFunc(s, func(ref string) string {
+		name := flowVarRef.FindStringSubmatch(ref)[1]
+		value, ok := vars[name]
+		if !ok {
+			missing = append(missing, name)
+		}
+		return value
+	})
+	if len(missing) > 0 {
+		return "", fmt.Errorf("undefined flow variable %s", strings.Join(missing, ", "))
+	}
+	return out, nil
+}
+
+// expandFlowJSON replaces flow variables in the strings of a decoded JSON value
+func expandFlowJSON(v interface{}, vars map[string]string) (interface{}, error) {
+	var err error
+	switch v := v.(type) {
+	case string:
+		return expandFlowVars(v, vars)
+	case []interface{}:
+		for i := range v {
+			if v[i], err = expandFlowJSON(v[i], vars); err != nil {
+				return nil, err
+			}
+		}
+	case map[string]interface{}:
+		for k := range v {
+			if v[k], err = expandFlowJSON(v[k], vars); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return v, nil
+}
+
+// parseJSONPath splits a path such as $.data.items[0].id into object keys
+// (strings) and array indexes (ints)
+func parseJSONPath(path string) ([]interface{}, error) {
+	path = strings.TrimPrefix(strings.TrimPrefix(path, "$"), ".")
+	var parts []interface{}
+	for _, segment := range strings.Split(path, ".") {
+		key := segment
+		if i := strings.IndexByte(segment, '['); i >= 0 {
+			key = segment[:i]
+		}
+		if key != "" {
+			parts = append(parts, key)
+		}
+		for rest := segment[len(key):]; rest != ""; {
+			end := strings.IndexByte(rest, ']')
+			if rest[0] != '[' || end < 0 {
+				return nil, fmt.Errorf("invalid JSON path %q", path)
+			}
+			idx, err := strconv.Atoi(rest[1:end])
+			if err != nil || idx < 0 {
+				return nil, fmt.Errorf("invalid index in JSON path %q", path)
+			}
+			parts = append(parts, idx)
+			rest = rest[end+1:]
+		}
+		if key == "" && !strings.HasPrefix(segment, "[") {
+			return nil, fmt.Errorf("invalid JSON path %q", path)
+		}
+	}
+	return parts, nil
+}
+
+// lookupJSONPath returns the value at path as a string: strings as is,
+// numbers and booleans in JSON form, objects and arrays as JSON
+func lookupJSONPath(v interface{}, path []interface{}) (string, bool, error) {
+	for _, part := range path {
+		switch p := part.(type) {
+		case string:
+			obj, ok := v.(map[string]interface{})
+			if !ok {
+				return "", false, nil
+			}
+			if v, ok = obj[p]; !ok {
+				return "", false, nil
+			}
+		case int:
+			arr, ok := v.([]interface{})
+			if !ok || p >= len(arr) {
+				return "", false, nil
+			}
+			v = arr[p]
+		}
+	}
+	switch v := v.(type) {
+	case nil:
+		return "", false, nil
+	case string:
+		return v, true, nil
+	case json.Number:
+		return v.String(), true, nil
+	case bool:
+		return strconv.FormatBool(v), true, nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", false, err
+	}
+	return string(data), true, nil
+}
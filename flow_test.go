@@ -0,0 +1,115 @@
+package httpcloak
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFlowRun(t *testing.T) {
+	var posted, fetched http.Header
+	var form string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/login":
+			w.Write([]byte(`<html><body><form id="login"><input type="hidden" name="csrf" value="tok-123"></form></body></html>`))
+		case "/session":
+			posted = r.Header.Clone()
+			r.ParseForm()
+			form = r.PostForm.Encode()
+			http.SetCookie(w, &http.Cookie{Name: "sid", Value: "s1"})
+			http.Redirect(w, r, "/home", http.StatusFound)
+		case "/home":
+			w.Write([]byte(`<h1 class="title">Welcome, alice</h1>`))
+		case "/api/me":
+			fetched = r.Header.Clone()
+			w.Write([]byte(`{"data": {"items": [{"id": 42}]}}`))
+		}
+	}))
+	defer srv.Close()
+
+	sess := NewSession("chrome-latest", WithForceHTTP1())
+	defer sess.Close()
+
+	flow := NewFlow("login").
+		Get(srv.URL+"/login").
+		Extract(FlowExtract{Var: "csrf", CSS: `form#login input[name="csrf"]`, Attr: "value"}).
+		PostForm("/session", map[string]string{"user": "{{user}}", "csrf": "{{csrf}}"}).
+		ExpectStatus(200).
+		Extract(FlowExtract{Var: "greeting", CSS: "h1.title"}).
+		Extract(FlowExtract{Var: "sid", Cookie: "sid"}).
+		Fetch("GET", "/api/me", nil).
+		Extract(FlowExtract{Var: "id", JSON: "data.items[0].id"})
+
+	result, err := flow.Run(context.Background(), sess, map[string]string{"user": "alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]string{"csrf": "tok-123", "greeting": "Welcome, alice", "sid": "s1", "id": "42"} {
+		if got := result.Vars[name]; got != want {
+			t.Errorf("var %s = %q, want %q", name, got, want)
+		}
+	}
+	if form != "csrf=tok-123&user=alice" {
+		t.Errorf("form = %q", form)
+	}
+	if posted.Get("Referer") != srv.URL+"/login" || posted.Get("Origin") != srv.URL || posted.Get("Sec-Fetch-Site") != "same-origin" || posted.Get("Sec-Fetch-Mode") != "navigate" {
+		t.Errorf("form submission headers: %v", posted)
+	}
+	if fetched.Get("Referer") != srv.URL+"/home" || fetched.Get("Sec-Fetch-Mode") != "cors" || fetched.Get("Sec-Fetch-Dest") != "empty" {
+		t.Errorf("fetch headers: %v", fetched)
+	}
+	if len(result.Steps) != 3 || result.Steps[1].FinalURL != srv.URL+"/home" {
+		t.Errorf("steps = %+v", result.Steps)
+	}
+
+	// A failed expectation stops the flow with the step attached
+	_, err = NewFlow("fail").Get(srv.URL+"/login").ExpectStatus(204).Get("/home").Run(context.Background(), sess, nil)
+	var flowErr *FlowError
+	if !errors.As(err, &flowErr) || flowErr.Step != 0 {
+		t.Errorf("expected a FlowError for step 0, got %v", err)
+	}
+}
+
+func TestLoadFlow(t *testing.T) {
+	t.Setenv("FLOW_PASS", "secret")
+	path := filepath.Join(t.TempDir(), "flow.yaml")
+	os.WriteFile(path, []byte(`name: login
+steps:
+  - url: https://example.com/login
+    extract:
+      - var: csrf
+        css: meta[name=csrf-token]
+        attr: content
+  - method: POST
+    url: /session
+    form:
+      password: ${FLOW_PASS}
+      csrf: "{{csrf}}"
+    expect:
+      status: [200, 302]
+`), 0o600)
+	flow, err := LoadFlow(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(flow.Steps) != 2 || flow.Steps[1].Form["password"] != "secret" || flow.Steps[1].Expect.Status[1] != 302 {
+		t.Errorf("unexpected flow %+v", flow)
+	}
+
+	for _, bad := range []string{
+		"steps: []\n",
+		"steps:\n  - url: /x\n    extract:\n      - var: a\n        css: 'div['\n",
+		"steps:\n  - url: /x\n    form: {a: b}\n    body: c\n",
+		"steps:\n  - url: /x\n    extract:\n      - var: a\n",
+	} {
+		os.WriteFile(path, []byte(bad), 0o600)
+		if _, err := LoadFlow(path); err == nil {
+			t.Errorf("expected an error for %q", bad)
+		}
+	}
+}
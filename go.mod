@@ -17,15 +17,16 @@ require (
 	github.com/sardanioss/quic-go v1.2.18
 	github.com/sardanioss/udpbara v1.1.0
 	github.com/sardanioss/utls v1.10.2
+	golang.org/x/crypto v0.46.0
 	golang.org/x/net v0.48.0
+	golang.org/x/sys v0.39.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
 	github.com/sardanioss/qpack v0.6.2 // indirect
-	golang.org/x/crypto v0.46.0 // indirect
 	golang.org/x/mod v0.30.0 // indirect
 	golang.org/x/sync v0.19.0 // indirect
-	golang.org/x/sys v0.39.0 // indirect
 	golang.org/x/text v0.32.0 // indirect
 	golang.org/x/tools v0.39.0 // indirect
 )
@@ -0,0 +1,252 @@
+package httpcloak
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RequestGroup runs requests of one session concurrently under shared
+// limits, with errgroup semantics: every task gets a context derived from
+// the group's, the first fatal error cancels the tasks still running, and
+// Wait returns the first error.
+//
+// Example:
+//
+//	sess.Warmup(ctx, "https://example.com")
+//	g := httpcloak.Group(ctx, sess).Tabs(4).HostLimit(2).Rate(10, time.Second)
+//	for _, u := range urls {
+//	    g.Get(u, func(resp *httpcloak.Response) error {
+//	        body, err := resp.Bytes()
+//	        // ...
+//	        return err
+//	    })
+//	}
+//	if err := g.Wait(); err != nil {
+//	    log.Fatal(err)
+//	}
+//
+// Configure the group before starting tasks.
+type RequestGroup struct {
+	ctx    context.Context
+	cancel context.CancelCauseFunc
+	sess   *Session
+
+	limit     chan struct{} // Task slots, nil without Limit
+	hostLimit int
+	interval  time.Duration // Between task starts, 0 without Rate
+	timeout   time.Duration
+	fatal     func(err error) bool
+	tabs      []*Session
+
+	mu        sync.Mutex
+	hostSlots map[string]chan struct{}
+	nextStart time.Time
+	nextTab   int
+
+	wg      sync.WaitGroup
+	errOnce sync.Once
+	err     error
+}
+
+// Group returns a RequestGroup running requests of sess under ctx
+func Group(ctx context.Context, sess *Session) *RequestGroup {
+	ctx, cancel := context.WithCancelCause(ctx)
+	return &RequestGroup{ctx: ctx, cancel: cancel, sess: sess, hostSlots: make(map[string]chan struct{})}
+}
+
+// Limit caps the tasks running at once; Go blocks while the group is full
+func (g *RequestGroup) Limit(n int) *RequestGroup {
+	if n > 0 {
+		g.limit = make(chan struct{}, n)
+	}
+	return g
+}
+
+// HostLimit caps the requests in flight per host
+func (g *RequestGroup) HostLimit(n int) *RequestGroup {
+	g.hostLimit = n
+	return g
+}
+
+// Rate spaces task starts evenly so at most n start per period
+func (g *RequestGroup) Rate(n int, per time.Duration) *RequestGroup {
+	if n > 0 && per > 0 {
+		g.interval = per / time.Duration(n)
+	}
+	return g
+}
+
+// Timeout bounds each task with its own deadline
+func (g *RequestGroup) Timeout(d time.Duration) *RequestGroup {
+	g.timeout = d
+	return g
+}
+
+// Fatal decides which task errors cancel the group (default: all). Other
+// errors are still returned by Wait if no fatal one happens first.
+func (g *RequestGroup) Fatal(fatal func(err error) bool) *RequestGroup {
+	g.fatal = fatal
+	return g
+}
+
+// Tabs forks the session into n tabs (see Session.Fork) that tasks use in
+// turn, so requests run on separate connections like browser tabs. Wait
+// closes them.
+func (g *RequestGroup) Tabs(n int) *RequestGroup {
+	if n > 0 {
+		g.tabs = g.sess.Fork(n)
+	}
+	return g
+}
+
+// Context returns the group's context, cancelled by the first fatal error
+// (its cause) or when Wait returns
+func (g *RequestGroup) Context() context.Context {
+	return g.ctx
+}
+
+// Go runs fn in a new goroutine with a task context and the session or tab
+// to use
+func (g *RequestGroup) Go(fn func(ctx context.Context, sess *Session) error) {
+	if g.limit != nil {
+		select {
+		case g.limit <- struct{}{}:
+		case <-g.ctx.Done():
+			g.fail(context.Cause(g.ctx))
+			return
+		}
+	}
+	sess := g.session()
+
+	g.wg.Add(1)
+	go func() {
+		defer g.wg.Done()
+		if g.limit != nil {
+			defer func() { <-g.limit }()
+		}
+		if err := g.waitRate(); err != nil {
+			g.fail(err)
+			return
+		}
+		ctx := g.ctx
+		if g.timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, g.timeout)
+			defer cancel()
+		}
+		if err := fn(ctx, sess); err != nil {
+			g.fail(err)
+		}
+	}()
+}
+
+// Do sends req as a task and passes the response to handle (which may be
+// nil), closing it afterwards. A request error or handle's error is the
+// task's error.
+func (g *RequestGroup) Do(req *Request, handle func(resp *Response) error) {
+	g.Go(func(ctx context.Context, sess *Session) error {
+		release, err := g.acquireHost(ctx, req.URL)
+		if err != nil {
+			return err
+		}
+		defer release()
+
+		resp, err := sess.Do(ctx, req)
+		if err != nil {
+			return err
+		}
+		defer resp.Close()
+		if handle == nil {
+			return nil
+		}
+		return handle(resp)
+	})
+}
+
+// Get is Do for a GET request
+func (g *RequestGroup) Get(url string, handle func(resp *Response) error) {
+	g.Do(&Request{Method: "GET", URL: url}, handle)
+}
+
+// Wait blocks until every task has returned, closes the tabs and returns
+// the first error
+func (g *RequestGroup) Wait() error {
+	g.wg.Wait()
+	g.cancel(context.Canceled)
+	for _, tab := range g.tabs {
+		tab.Close()
+	}
+	g.tabs = nil
+	return g.err
+}
+
+// fail records err and cancels the group if it is fatal
+func (g *RequestGroup) fail(err error) {
+	g.errOnce.Do(func() { g.err = err })
+	if g.fatal == nil || g.fatal(err) {
+		g.cancel(err)
+	}
+}
+
+// session returns the session for the next task
+func (g *RequestGroup) session() *Session {
+	if len(g.tabs) == 0 {
+		return g.sess
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	tab := g.tabs[g.nextTab%len(g.tabs)]
+	g.nextTab++
+	return tab
+}
+
+// waitRate blocks until the task's start slot under Rate
+func (g *RequestGroup) waitRate() error {
+	if g.interval == 0 {
+		return g.ctx.Err()
+	}
+	g.mu.Lock()
+	start := time.Now()
+	if g.nextStart.After(start) {
+		start = g.nextStart
+	}
+	g.nextStart = start.Add(g.interval)
+	g.mu.Unlock()
+
+	timer := time.NewTimer(time.Until(start))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-g.ctx.Done():
+		return context.Cause(g.ctx)
+	}
+}
+
+// acquireHost takes a request slot for the URL's host under HostLimit
+func (g *RequestGroup) acquireHost(ctx context.Context, rawURL string) (func(), error) {
+	if g.hostLimit <= 0 {
+		return func() {}, nil
+	}
+	host := rawURL
+	if u, err := url.Parse(rawURL); err == nil {
+		host = strings.ToLower(u.Hostname())
+	}
+	g.mu.Lock()
+	slots, ok := g.hostSlots[host]
+	if !ok {
+		slots = make(chan struct{}, g.hostLimit)
+		g.hostSlots[host] = slots
+	}
+	g.mu.Unlock()
+
+	select {
+	case slots <- struct{}{}:
+		return func() { <-slots }, nil
+	case <-ctx.Done():
+		return nil, context.Cause(ctx)
+	}
+}
@@ -0,0 +1,75 @@
+package httpcloak
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRequestGroup(t *testing.T) {
+	var inFlight, maxInFlight atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for m := maxInFlight.Load(); n > m && !maxInFlight.CompareAndSwap(m, n); m = maxInFlight.Load() {
+		}
+		select {
+		case <-time.After(50 * time.Millisecond):
+		case <-r.Context().Done():
+		}
+		if r.URL.Path == "/slow" {
+			select {
+			case <-time.After(5 * time.Second):
+			case <-r.Context().Done():
+			}
+		}
+	}))
+	defer srv.Close()
+
+	sess := NewSession("chrome-latest", WithForceHTTP1())
+	defer sess.Close()
+
+	// Host limit across tabs
+	g := Group(context.Background(), sess).Tabs(3).HostLimit(2)
+	var done atomic.Int32
+	for i := 0; i < 8; i++ {
+		g.Get(srv.URL, func(resp *Response) error {
+			done.Add(1)
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil || done.Load() != 8 {
+		t.Fatalf("err = %v after %d responses", err, done.Load())
+	}
+	if m := maxInFlight.Load(); m != 2 {
+		t.Errorf("max in flight = %d, want 2", m)
+	}
+
+	// The first fatal error cancels the slow request instead of waiting for it
+	errBlocked := errors.New("blocked")
+	g = Group(context.Background(), sess)
+	g.Get(srv.URL+"/slow", nil)
+	g.Get(srv.URL, func(resp *Response) error { return errBlocked })
+	started := time.Now()
+	if err := g.Wait(); !errors.Is(err, errBlocked) {
+		t.Errorf("Wait = %v, want the handler's error", err)
+	}
+	if time.Since(started) > 2*time.Second || !errors.Is(context.Cause(g.Context()), errBlocked) {
+		t.Errorf("slow request not cancelled (%v)", time.Since(started))
+	}
+
+	// Rate spaces starts
+	g = Group(context.Background(), sess).Rate(10, time.Second)
+	started = time.Now()
+	for i := 0; i < 3; i++ {
+		g.Go(func(ctx context.Context, sess *Session) error { return nil })
+	}
+	g.Wait()
+	if elapsed := time.Since(started); elapsed < 200*time.Millisecond {
+		t.Errorf("3 tasks at 10/s started within %v", elapsed)
+	}
+}
@@ -0,0 +1,276 @@
+package httpcloak
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// cssSelector is a parsed CSS selector group. It supports the subset needed
+// to pick values out of pages: type, #id, .class and attribute selectors
+// ([a], [a=v], [a~=v], [a^=v], [a$=v], [a*=v]), the descendant and child
+// (>) combinators, and comma-separated alternatives.
+type cssSelector [][]cssCompound
+
+type cssCompound struct {
+	combinator byte // ' ' or '>' to the previous compound; 0 for the first
+	tag        string
+	id         string
+	classes    []string
+	attrs      []cssAttr
+}
+
+type cssAttr struct {
+	name, op, value string
+}
+
+// parseSelector parses a selector group such as `form#login input[name="csrf"]`
+func parseSelector(s string) (cssSelector, error) {
+	var group cssSelector
+	for _, part := range strings.Split(s, ",") {
+		chain, err := parseSelectorChain(strings.TrimSpace(part))
+		if err != nil {
+			return nil, fmt.Errorf("selector %q: %w", s, err)
+		}
+		group = append(group, chain)
+	}
+	return group, nil
+}
+
+func parseSelectorChain(s string) ([]cssCompound, error) {
+	if s == "" {
+		return nil, fmt.Errorf("empty selector")
+	}
+	var chain []cssCompound
+	combinator := byte(0)
+	for i := 0; i < len(s); {
+		switch c := s[i]; {
+		case c == ' ' || c == '\t' || c == '\n':
+			if combinator == 0 && len(chain) > 0 {
+				combinator = ' '
+			}
+			i++
+			continue
+		case c == '>':
+			if len(chain) == 0 {
+				return nil, fmt.Errorf("unexpected '>'")
+			}
+			combinator = '>'
+			i++
+			continue
+		}
+		compound, n, err := parseCompound(s[i:])
+		if err != nil {
+			return nil, err
+		}
+		if len(chain) > 0 {
+			compound.combinator = combinator
+		}
+		chain = append(chain, compound)
+		combinator = 0
+		i += n
+	}
+	if combinator == '>' {
+		return nil, fmt.Errorf("selector ends with '>'")
+	}
+	return chain, nil
+}
+
+// parseCompound parses one compound selector and returns how many bytes it used
+func parseCompound(s string) (cssCompound, int, error) {
+	var c cssCompound
+	i := 0
+	ident := func() string {
+		start := i
+		for i < len(s) && isSelectorIdent(s[i]) {
+			i++
+		}
+		return s[start:i]
+	}
+	if i < len(s) && s[i] == '*' {
+		i++
+	} else {
+		c.tag = strings.ToLower(ident())
+	}
+	for i < len(s) {
+		switch s[i] {
+		case '#':
+			i++
+			if c.id = ident(); c.id == "" {
+				return c, 0, fmt.Errorf("empty id")
+			}
+		case '.':
+			i++
+			class := ident()
+			if class == "" {
+				return c, 0, fmt.Errorf("empty class")
+			}
+			c.classes = append(c.classes, class)
+		case '[':
+			end := strings.IndexByte(s[i:], ']')
+			if end < 0 {
+				return c, 0, fmt.Errorf("unterminated attribute selector")
+			}
+			attr, err := parseAttrSelector(s[i+1 : i+end])
+			if err != nil {
+				return c, 0, err
+			}
+			c.attrs = append(c.attrs, attr)
+			i += end + 1
+		default:
+			if i == 0 {
+				return c, 0, fmt.Errorf("unexpected %q", s[i])
+			}
+			return c, i, nil
+		}
+	}
+	return c, i, nil
+}
+
+func parseAttrSelector(s string) (cssAttr, error) {
+	for _, op := range []string{"~=", "^=", "$=", "*=", "="} {
+		if idx := strings.Index(s, op); idx > 0 {
+			value := strings.TrimSpace(s[idx+len(op):])
+			if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+				value = value[1 : len(value)-1]
+			}
+			return cssAttr{name: strings.ToLower(strings.TrimSpace(s[:idx])), op: op, value: value}, nil
+		}
+	}
+	name := strings.ToLower(strings.TrimSpace(s))
+	if name == "" {
+		return cssAttr{}, fmt.Errorf("empty attribute selector")
+	}
+	return cssAttr{name: name}, nil
+}
+
+func isSelectorIdent(c byte) bool {
+	return c == '-' || c == '_' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= 0x80
+}
+
+// first returns the first element under root, in document order, that
+// matches the selector
+func (sel cssSelector) first(root *html.Node) *html.Node {
+	var found *html.Node
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		for c := n.FirstChild; c != nil && found == nil; c = c.NextSibling {
+			if c.Type == html.ElementNode && sel.matches(c) {
+				found = c
+				return
+			}
+			walk(c)
+		}
+	}
+	walk(root)
+	return found
+}
+
+func (sel cssSelector) matches(n *html.Node) bool {
+	for _, chain := range sel {
+		if matchChain(n, chain) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchChain matches n against the last compound of chain and its ancestors
+// against the rest
+func matchChain(n *html.Node, chain []cssCompound) bool {
+	last := chain[len(chain)-1]
+	if !last.matches(n) {
+		return false
+	}
+	if len(chain) == 1 {
+		return true
+	}
+	rest := chain[:len(chain)-1]
+	for p := n.Parent; p != nil && p.Type == html.ElementNode; p = p.Parent {
+		if matchChain(p, rest) {
+			return true
+		}
+		if last.combinator == '>' {
+			break
+		}
+	}
+	return false
+}
+
+func (c cssCompound) matches(n *html.Node) bool {
+	if c.tag != "" && n.Data != c.tag {
+		return false
+	}
+	if c.id != "" && htmlAttr(n, "id") != c.id {
+		return false
+	}
+	for _, class := range c.classes {
+		if !containsField(htmlAttr(n, "class"), class) {
+			return false
+		}
+	}
+	for _, a := range c.attrs {
+		value, ok := lookupAttr(n, a.name)
+		if !ok {
+			return false
+		}
+		switch a.op {
+		case "=":
+			ok = value == a.value
+		case "~=":
+			ok = containsField(value, a.value)
+		case "^=":
+			ok = a.value != "" && strings.HasPrefix(value, a.value)
+		case "$=":
+			ok = a.value != "" && strings.HasSuffix(value, a.value)
+		case "*=":
+			ok = a.value != "" && strings.Contains(value, a.value)
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func containsField(list, value string) bool {
+	for _, f := range strings.Fields(list) {
+		if f == value {
+			return true
+		}
+	}
+	return false
+}
+
+func lookupAttr(n *html.Node, name string) (string, bool) {
+	for _, a := range n.Attr {
+		if a.Namespace == "" && a.Key == name {
+			return a.Val, true
+		}
+	}
+	return "", false
+}
+
+// htmlAttr returns the value of n's attribute name, or ""
+func htmlAttr(n *html.Node, name string) string {
+	value, _ := lookupAttr(n, name)
+	return value
+}
+
+// htmlText returns the text content of n with whitespace collapsed
+func htmlText(n *html.Node) string {
+	var b strings.Builder
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			b.WriteString(n.Data)
+			b.WriteByte(' ')
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+	return strings.Join(strings.Fields(b.String()), " ")
+}
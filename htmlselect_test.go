@@ -0,0 +1,44 @@
+package httpcloak
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+func TestCSSSelector(t *testing.T) {
+	doc, err := html.Parse(strings.NewReader(`<div id="a" class="box main"><p>one</p><span><p data-x="yes">two</p></span></div><p class="x">three</p>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := map[string]string{
+		"p":                   "one",
+		"div > span > p":      "two",
+		"#a p[data-x]":        "two",
+		"div.main.box > p":    "one",
+		"body > p":            "three",
+		"p[data-x^=y]":        "two",
+		"nav, .x":             "three",
+		"div > p[data-x=yes]": "",
+		"[class~=box] span *": "two",
+	}
+	for selector, want := range tests {
+		sel, err := parseSelector(selector)
+		if err != nil {
+			t.Fatalf("%s: %v", selector, err)
+		}
+		got := ""
+		if n := sel.first(doc); n != nil {
+			got = htmlText(n)
+		}
+		if got != want {
+			t.Errorf("%s = %q, want %q", selector, got, want)
+		}
+	}
+	for _, bad := range []string{"", "div >", "p[", "a,", "#"} {
+		if _, err := parseSelector(bad); err == nil {
+			t.Errorf("expected an error for %q", bad)
+		}
+	}
+}
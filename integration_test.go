@@ -0,0 +1,343 @@
+//go:build integration
+
+package httpcloak
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+	"github.com/sardanioss/httpcloak/transport"
+)
+
+// The integration tests run against the servers and proxies of
+// testdata/integration/docker-compose.yml, which TestMain starts and stops:
+//
+//	make integration
+//
+// Set HTTPCLOAK_INTEGRATION_KEEP=1 to leave the containers running after the
+// tests, and HTTPCLOAK_INTEGRATION_NO_COMPOSE=1 to reuse running ones.
+const integrationDir = "testdata/integration"
+
+// integrationBody is the content of www/text.txt, served plain and
+// precompressed as text.txt.gz, .br and .zst
+var integrationBody = strings.Repeat("httpcloak integration fixture\n", 64)
+
+func TestMain(m *testing.M) {
+	os.Exit(runIntegration(m))
+}
+
+func runIntegration(m *testing.M) int {
+	if err := writeIntegrationFiles(); err != nil {
+		fmt.Fprintln(os.Stderr, "integration setup:", err)
+		return 1
+	}
+	// Trust the generated CA in place of the system roots
+	os.Setenv("SSL_CERT_FILE", filepath.Join(integrationDir, "certs", "ca.pem"))
+
+	if os.Getenv("HTTPCLOAK_INTEGRATION_NO_COMPOSE") == "" {
+		if err := compose("up", "-d", "--wait"); err != nil {
+			fmt.Fprintln(os.Stderr, "docker compose up:", err)
+			return 1
+		}
+		if os.Getenv("HTTPCLOAK_INTEGRATION_KEEP") == "" {
+			defer compose("down", "--volumes")
+		}
+	}
+	for _, port := range []string{"18080", "18443", "19443", "20443", "13128", "11080"} {
+		if err := waitForPort(net.JoinHostPort("127.0.0.1", port), 30*time.Second); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	}
+	return m.Run()
+}
+
+func compose(args ...string) error {
+	cmd := exec.Command("docker", append([]string{"compose", "-f", filepath.Join(integrationDir, "docker-compose.yml")}, args...)...)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+func waitForPort(addr string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		conn, err := net.DialTimeout("tcp", addr, time.Second)
+		if err == nil {
+			conn.Close()
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("%s not ready: %w", addr, err)
+		}
+		time.Sleep(250 * time.Millisecond)
+	}
+}
+
+// writeIntegrationFiles generates the certificates and site files the
+// containers mount
+func writeIntegrationFiles() error {
+	certs := filepath.Join(integrationDir, "certs")
+	www := filepath.Join(integrationDir, "www")
+	for _, dir := range []string{certs, www} {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return err
+		}
+	}
+
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+	ca := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "httpcloak integration CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, ca, ca, &caKey.PublicKey, caKey)
+	if err != nil {
+		return err
+	}
+	if err := writePEM(filepath.Join(certs, "ca.pem"), "CERTIFICATE", caDER); err != nil {
+		return err
+	}
+
+	leaves := []struct {
+		name     string
+		dnsNames []string
+		ips      []net.IP
+		notAfter time.Time
+	}{
+		{"localhost", []string{"localhost", "nginx", "caddy", "h2o"},
+			[]net.IP{net.ParseIP("127.0.0.1"), net.ParseIP("172.28.0.10"), net.ParseIP("172.28.0.11"), net.ParseIP("172.28.0.12")},
+			time.Now().Add(24 * time.Hour)},
+		{"expired", []string{"localhost"}, []net.IP{net.ParseIP("127.0.0.1")}, time.Now().Add(-time.Hour)},
+		{"wronghost", []string{"wrong.invalid"}, nil, time.Now().Add(24 * time.Hour)},
+	}
+	for i, leaf := range leaves {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			return err
+		}
+		tmpl := &x509.Certificate{
+			SerialNumber: big.NewInt(int64(i + 2)),
+			Subject:      pkix.Name{CommonName: leaf.dnsNames[0]},
+			DNSNames:     leaf.dnsNames,
+			IPAddresses:  leaf.ips,
+			NotBefore:    time.Now().Add(-2 * time.Hour),
+			NotAfter:     leaf.notAfter,
+			KeyUsage:     x509.KeyUsageDigitalSignature,
+			ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		}
+		der, err := x509.CreateCertificate(rand.Reader, tmpl, ca, &key.PublicKey, caKey)
+		if err != nil {
+			return err
+		}
+		keyDER, err := x509.MarshalECPrivateKey(key)
+		if err != nil {
+			return err
+		}
+		if err := writePEM(filepath.Join(certs, leaf.name+".pem"), "CERTIFICATE", der); err != nil {
+			return err
+		}
+		if err := writePEM(filepath.Join(certs, leaf.name+"-key.pem"), "EC PRIVATE KEY", keyDER); err != nil {
+			return err
+		}
+	}
+
+	files := map[string][]byte{"index.html": []byte("ok\n"), "text.txt": []byte(integrationBody)}
+	var gz bytes.Buffer
+	gw := gzip.NewWriter(&gz)
+	gw.Write([]byte(integrationBody))
+	gw.Close()
+	files["text.txt.gz"] = gz.Bytes()
+	var br bytes.Buffer
+	bw := brotli.NewWriter(&br)
+	bw.Write([]byte(integrationBody))
+	bw.Close()
+	files["text.txt.br"] = br.Bytes()
+	zw, _ := zstd.NewWriter(nil)
+	files["text.txt.zst"] = zw.EncodeAll([]byte(integrationBody), nil)
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(www, name), data, 0o644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writePEM(path, blockType string, der []byte) error {
+	// World-readable, keys included, for the containers' users
+	return os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0o644)
+}
+
+func integrationGet(t *testing.T, url string, opts ...SessionOption) *Response {
+	t.Helper()
+	sess := NewSession("chrome-latest", append([]SessionOption{WithSessionTimeout(15 * time.Second), WithoutRetry()}, opts...)...)
+	t.Cleanup(sess.Close)
+	resp, err := sess.Get(context.Background(), url)
+	if err != nil {
+		t.Fatalf("GET %s: %v", url, err)
+	}
+	t.Cleanup(func() { resp.Close() })
+	return resp
+}
+
+func TestIntegrationProtocols(t *testing.T) {
+	tests := []struct {
+		server string
+		url    string
+		force  SessionOption
+		want   string
+	}{
+		{"nginx", "http://127.0.0.1:18080/", nil, "h1"},
+		{"nginx", "https://localhost:18443/", WithForceHTTP1(), "h1"},
+		{"nginx", "https://localhost:18443/", WithForceHTTP2(), "h2"},
+		{"nginx", "https://localhost:18443/", WithForceHTTP3(), "h3"},
+		{"caddy", "https://localhost:19443/", WithForceHTTP1(), "h1"},
+		{"caddy", "https://localhost:19443/", WithForceHTTP2(), "h2"},
+		{"caddy", "https://localhost:19443/", WithForceHTTP3(), "h3"},
+		{"h2o", "https://localhost:20443/", WithForceHTTP1(), "h1"},
+		{"h2o", "https://localhost:20443/", WithForceHTTP2(), "h2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.server+" "+tt.want, func(t *testing.T) {
+			var opts []SessionOption
+			if tt.force != nil {
+				opts = append(opts, tt.force)
+			}
+			resp := integrationGet(t, tt.url, opts...)
+			if resp.StatusCode != 200 || resp.Protocol != tt.want {
+				t.Errorf("status %d over %s, want 200 over %s", resp.StatusCode, resp.Protocol, tt.want)
+			}
+		})
+	}
+}
+
+func TestIntegrationFallback(t *testing.T) {
+	// ALPN offers http/1.1 only
+	if resp := integrationGet(t, "https://localhost:18447/"); resp.Protocol != "h1" {
+		t.Errorf("HTTP/1.1-only server: protocol %s", resp.Protocol)
+	}
+
+	// h2o has no QUIC listener
+	sess := NewSession("chrome-latest", WithForceHTTP3(), WithSessionTimeout(5*time.Second), WithoutRetry())
+	defer sess.Close()
+	if resp, err := sess.Get(context.Background(), "https://localhost:20443/"); err == nil {
+		resp.Close()
+		t.Error("forced HTTP/3 to a server without QUIC succeeded")
+	}
+}
+
+func TestIntegrationProxies(t *testing.T) {
+	tests := []struct {
+		name  string
+		proxy string
+		url   string
+	}{
+		{"squid connect", "http://127.0.0.1:13128", "https://caddy/"},
+		{"squid plain", "http://127.0.0.1:13128", "http://nginx/"},
+		{"dante socks5h", "socks5h://127.0.0.1:11080", "https://caddy/"},
+		{"dante socks5", "socks5://127.0.0.1:11080", "https://172.28.0.10/"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := integrationGet(t, tt.url, WithSessionProxy(tt.proxy))
+			if body, _ := resp.Text(); resp.StatusCode != 200 || body != "ok\n" {
+				t.Errorf("status %d, body %q", resp.StatusCode, body)
+			}
+		})
+	}
+}
+
+func TestIntegrationDecompression(t *testing.T) {
+	tests := []struct {
+		url      string
+		encoding string
+	}{
+		{"https://localhost:18443/text.txt", "gzip"},
+		{"https://localhost:19443/text.txt", "gzip"},
+		{"https://localhost:19443/text.txt", "br"},
+		{"https://localhost:19443/text.txt", "zstd"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url+" "+tt.encoding, func(t *testing.T) {
+			sess := NewSession("chrome-latest", WithSessionTimeout(15*time.Second))
+			defer sess.Close()
+			resp, err := sess.Do(context.Background(), &Request{
+				Method:  "GET",
+				URL:     tt.url,
+				Headers: map[string][]string{"Accept-Encoding": {tt.encoding}},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Close()
+			body, err := resp.Text()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if body != integrationBody {
+				t.Errorf("body of %d bytes doesn't match the fixture", len(body))
+			}
+		})
+	}
+}
+
+func TestIntegrationBrokenTLS(t *testing.T) {
+	tests := []struct {
+		name     string
+		url      string
+		insecure bool // whether InsecureSkipVerify gets through
+	}{
+		{"expired certificate", "https://localhost:18444/", true},
+		{"wrong host", "https://localhost:18445/", true},
+		{"tls 1.0 only", "https://localhost:18446/", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sess := NewSession("chrome-latest", WithSessionTimeout(10*time.Second), WithoutRetry())
+			defer sess.Close()
+			resp, err := sess.Get(context.Background(), tt.url)
+			if err == nil {
+				resp.Close()
+				t.Fatal("request succeeded")
+			}
+			if !transport.IsTLSError(err) {
+				t.Errorf("not a TLS error: %v", err)
+			}
+
+			insecure := NewSession("chrome-latest", WithSessionTimeout(10*time.Second), WithoutRetry(), WithInsecureSkipVerify())
+			defer insecure.Close()
+			resp, err = insecure.Get(context.Background(), tt.url)
+			if err == nil {
+				resp.Close()
+			}
+			if (err == nil) != tt.insecure {
+				t.Errorf("with InsecureSkipVerify: err = %v", err)
+			}
+		})
+	}
+}
@@ -320,6 +320,39 @@ func TestCustomJA3ReproducibilityE2E(t *testing.T) {
 	}
 }
 
+// TestWithJA3E2E verifies that WithJA3 sends the requested JA3 and rejects
+// malformed strings before any request is sent.
+//
+// Run with: go test -tags e2e -run TestWithJA3E2E -v -count=1
+func TestWithJA3E2E(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	bad := NewSession("chrome-145", WithJA3("771,not-a-cipher"))
+	if _, err := bad.Get(ctx, "https://tls.peet.ws/api/tls"); err == nil {
+		t.Error("expected an error for a malformed JA3 string")
+	}
+	bad.Close()
+
+	ja3 := "771,4865-4866-4867-49195-49199-49196-49200-52393-52392-49171-49172-156-157-47-53,0-23-65281-10-11-35-16-5-34-51-43-13-45-28-18-27-17513-65037,29-23-24,0"
+	sess := NewSession("chrome-145", WithJA3(ja3), WithForceHTTP1())
+	defer sess.Close()
+
+	resp, err := sess.Get(ctx, "https://tls.peet.ws/api/tls")
+	if err != nil {
+		t.Fatalf("request to tls.peet.ws failed: %v", err)
+	}
+	defer resp.Close()
+
+	var result tlsPeetResponse
+	if err := resp.JSON(&result); err != nil {
+		t.Fatalf("failed to parse response JSON: %v", err)
+	}
+	if got, want := filterJA3GREASE(result.TLS.JA3), filterJA3GREASE(ja3); got != want {
+		t.Errorf("JA3 mismatch (after GREASE filtering):\n  sent:     %s\n  received: %s", want, got)
+	}
+}
+
 // parseSettingsMap parses an Akamai SETTINGS string like "1:65536;2:0;4:6291456"
 func parseSettingsMap(settings string) map[string]string {
 	m := make(map[string]string)
@@ -0,0 +1,562 @@
+package httpcloak
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"mime/multipart"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// ErrLoginFailed is returned by Session.Login when the form was submitted
+// but the checks in LoginOptions say the login didn't succeed
+var ErrLoginFailed = errors.New("login failed")
+
+// FormField is one name/value pair a form submits
+type FormField struct {
+	Name  string
+	Value string
+}
+
+// HTMLForm is a form parsed from a page, with the fields a browser would
+// submit in document order: inputs with their current values (hidden ones
+// included), checked checkboxes and radios, selected options and textareas.
+// Disabled controls and buttons are left out.
+type HTMLForm struct {
+	ID      string
+	Action  string // resolved against the page URL
+	Method  string // GET or POST
+	Enctype string
+	Fields  []FormField
+
+	// Submitter is the form's first named submit button; browsers add it to
+	// the fields when it is clicked
+	Submitter *FormField
+
+	// HasPassword reports whether the form has a password input
+	HasPassword bool
+}
+
+// Get returns the value of the first field called name
+func (f *HTMLForm) Get(name string) (string, bool) {
+	for _, field := range f.Fields {
+		if field.Name == name {
+			return field.Value, true
+		}
+	}
+	return "", false
+}
+
+// Set replaces the value of the field called name (the first one, removing
+// any others), or appends the field when the form has none
+func (f *HTMLForm) Set(name, value string) {
+	fields := f.Fields[:0]
+	found := false
+	for _, field := range f.Fields {
+		if field.Name != name {
+			fields = append(fields, field)
+		} else if !found {
+			fields = append(fields, FormField{Name: name, Value: value})
+			found = true
+		}
+	}
+	if !found {
+		fields = append(fields, FormField{Name: name, Value: value})
+	}
+	f.Fields = fields
+}
+
+// Encode returns the body the form is submitted with and its Content-Type,
+// encoded as browsers do: application/x-www-form-urlencoded by default, or
+// multipart/form-data with a WebKit-style boundary. The Submitter is
+// included when withSubmitter is set. Line breaks are normalized to CRLF.
+func (f *HTMLForm) Encode(withSubmitter bool) ([]byte, string, error) {
+	fields := f.Fields
+	if withSubmitter && f.Submitter != nil {
+		fields = append(fields[:len(fields):len(fields)], *f.Submitter)
+	}
+	if strings.EqualFold(f.Enctype, "multipart/form-data") {
+		return encodeMultipartForm(fields)
+	}
+	return []byte(formURLEncode(fields)), "application/x-www-form-urlencoded", nil
+}
+
+// ParseForms returns the forms of an HTML page loaded from pageURL
+func ParseForms(body []byte, pageURL string) ([]*HTMLForm, error) {
+	doc, err := html.Parse(bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	base, err := documentBase(doc, pageURL)
+	if err != nil {
+		return nil, err
+	}
+
+	var forms []*HTMLForm
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			if c.Type == html.ElementNode && c.Data == "form" {
+				forms = append(forms, parseForm(c, base))
+				continue
+			}
+			walk(c)
+		}
+	}
+	walk(doc)
+	return forms, nil
+}
+
+// documentBase returns the URL relative links on the page resolve against:
+// its <base href>, or the page URL
+func documentBase(doc *html.Node, pageURL string) (*url.URL, error) {
+	base, err := url.Parse(pageURL)
+	if err != nil {
+		return nil, err
+	}
+	if n := findElement(doc, "base"); n != nil {
+		if href, ok := lookupAttr(n, "href"); ok {
+			if u, err := base.Parse(href); err == nil {
+				base = u
+			}
+		}
+	}
+	return base, nil
+}
+
+func parseForm(n *html.Node, base *url.URL) *HTMLForm {
+	form := &HTMLForm{
+		ID:      htmlAttr(n, "id"),
+		Method:  "GET",
+		Enctype: "application/x-www-form-urlencoded",
+		Action:  base.String(),
+	}
+	if strings.EqualFold(htmlAttr(n, "method"), "post") {
+		form.Method = "POST"
+	}
+	if strings.EqualFold(htmlAttr(n, "enctype"), "multipart/form-data") {
+		form.Enctype = "multipart/form-data"
+	}
+	if action := strings.TrimSpace(htmlAttr(n, "action")); action != "" {
+		if u, err := base.Parse(action); err == nil {
+			form.Action = u.String()
+		}
+	}
+
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			if c.Type != html.ElementNode {
+				continue
+			}
+			name := htmlAttr(c, "name")
+			_, disabled := lookupAttr(c, "disabled")
+			switch c.Data {
+			case "input":
+				typ := strings.ToLower(htmlAttr(c, "type"))
+				if typ == "password" {
+					form.HasPassword = true
+				}
+				if name == "" || disabled {
+					continue
+				}
+				value, hasValue := lookupAttr(c, "value")
+				switch typ {
+				case "submit", "image":
+					if form.Submitter == nil && typ == "submit" {
+						form.Submitter = &FormField{Name: name, Value: value}
+					}
+				case "button", "reset", "file":
+				case "checkbox", "radio":
+					if _, checked := lookupAttr(c, "checked"); checked {
+						if !hasValue {
+							value = "on"
+						}
+						form.Fields = append(form.Fields, FormField{Name: name, Value: value})
+					}
+				default:
+					form.Fields = append(form.Fields, FormField{Name: name, Value: value})
+				}
+			case "button":
+				typ := strings.ToLower(htmlAttr(c, "type"))
+				if name != "" && !disabled && form.Submitter == nil && (typ == "" || typ == "submit") {
+					form.Submitter = &FormField{Name: name, Value: htmlAttr(c, "value")}
+				}
+			case "select":
+				if name != "" && !disabled {
+					form.Fields = append(form.Fields, selectFields(c, name)...)
+				}
+			case "textarea":
+				if name != "" && !disabled {
+					form.Fields = append(form.Fields, FormField{Name: name, Value: textContent(c)})
+				}
+			default:
+				walk(c)
+			}
+		}
+	}
+	walk(n)
+	return form
+}
+
+// selectFields returns the selected options of a select element, or its
+// first option for single selects without a selection
+func selectFields(n *html.Node, name string) []FormField {
+	_, multiple := lookupAttr(n, "multiple")
+	var fields []FormField
+	var first *html.Node
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			if c.Type != html.ElementNode {
+				continue
+			}
+			if c.Data != "option" {
+				walk(c)
+				continue
+			}
+			if first == nil {
+				first = c
+			}
+			if _, selected := lookupAttr(c, "selected"); selected {
+				fields = append(fields, FormField{Name: name, Value: optionValue(c)})
+			}
+		}
+	}
+	walk(n)
+	if !multiple && len(fields) > 1 {
+		fields = fields[len(fields)-1:]
+	}
+	if !multiple && len(fields) == 0 && first != nil {
+		fields = []FormField{{Name: name, Value: optionValue(first)}}
+	}
+	return fields
+}
+
+func optionValue(n *html.Node) string {
+	if value, ok := lookupAttr(n, "value"); ok {
+		return value
+	}
+	return htmlText(n)
+}
+
+// textContent returns the raw text under n
+func textContent(n *html.Node) string {
+	var b strings.Builder
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == html.TextNode {
+			b.WriteString(c.Data)
+		}
+	}
+	return b.String()
+}
+
+func findElement(n *html.Node, tag string) *html.Node {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == html.ElementNode && c.Data == tag {
+			return c
+		}
+		if found := findElement(c, tag); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// CSRFToken is an anti-forgery token found on a page
+type CSRFToken struct {
+	// Name is the form field the token is submitted in, when the page says
+	// (a hidden input, or Rails' csrf-param meta tag)
+	Name  string
+	Value string
+
+	// Meta reports whether the token came from a <meta> tag; such tokens are
+	// usually sent by scripts in a header such as X-CSRF-Token
+	Meta bool
+}
+
+var csrfNamePattern = regexp.MustCompile(`(?i)(csrf|xsrf|authenticity_token|requestverificationtoken|^_token$|nonce)`)
+
+// FindCSRFToken looks for an anti-forgery token in an HTML page: first in
+// hidden inputs with a CSRF-like name (csrf, xsrf, _token,
+// authenticity_token, __RequestVerificationToken, ...), then in meta tags
+// such as <meta name="csrf-token">.
+func FindCSRFToken(body []byte) (*CSRFToken, bool) {
+	doc, err := html.Parse(bytes.NewReader(body))
+	if err != nil {
+		return nil, false
+	}
+	var input, meta *html.Node
+	var param string
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			if c.Type != html.ElementNode {
+				continue
+			}
+			switch c.Data {
+			case "input":
+				if input == nil && strings.EqualFold(htmlAttr(c, "type"), "hidden") && csrfNamePattern.MatchString(htmlAttr(c, "name")) && htmlAttr(c, "value") != "" {
+					input = c
+				}
+			case "meta":
+				name := strings.ToLower(htmlAttr(c, "name"))
+				switch {
+				case name == "csrf-param":
+					param = htmlAttr(c, "content")
+				case meta == nil && csrfNamePattern.MatchString(name) && htmlAttr(c, "content") != "":
+					meta = c
+				}
+			}
+			walk(c)
+		}
+	}
+	walk(doc)
+
+	if input != nil {
+		return &CSRFToken{Name: htmlAttr(input, "name"), Value: htmlAttr(input, "value")}, true
+	}
+	if meta != nil {
+		return &CSRFToken{Name: param, Value: htmlAttr(meta, "content"), Meta: true}, true
+	}
+	return nil, false
+}
+
+// LoginOptions configures Session.Login
+type LoginOptions struct {
+	// URL is the page with the login form
+	URL string
+
+	// FormSelector is a CSS selector for the form to submit. By default the
+	// first form with a password input is used.
+	FormSelector string
+
+	// Fields are filled into the form, replacing its values (usually the
+	// username and password)
+	Fields map[string]string
+
+	// CSRFHeader, when set, also sends the page's CSRF token in this header,
+	// as sites that submit their login form from JavaScript do
+	CSRFHeader string
+
+	// SuccessCookies must all be in the session after submitting
+	SuccessCookies []string
+
+	// FailureText marks a failed login when it appears in the response body,
+	// e.g. "Invalid password"
+	FailureText string
+}
+
+// LoginResult is the outcome of Session.Login
+type LoginResult struct {
+	Form      *HTMLForm
+	CSRFToken *CSRFToken
+
+	// Response is the response to the form submission, after redirects. Its
+	// body has been read and can still be used through Bytes and Text.
+	Response *Response
+}
+
+// Login loads the login page, fills in and submits its form the way a
+// browser does (hidden fields and CSRF tokens included, fields in document
+// order, Origin, Referer and Sec-Fetch-* set for a same-page submission),
+// then checks that the login worked. It returns an error wrapping
+// ErrLoginFailed when the response is an error status, shows FailureText, or
+// a SuccessCookie is missing.
+//
+// Example:
+//
+//	result, err := sess.Login(ctx, httpcloak.LoginOptions{
+//	    URL:            "https://example.com/login",
+//	    Fields:         map[string]string{"email": user, "password": pass},
+//	    SuccessCookies: []string{"session_id"},
+//	})
+func (s *Session) Login(ctx context.Context, opts LoginOptions) (*LoginResult, error) {
+	page, err := s.Do(ctx, &Request{Method: "GET", URL: opts.URL, Headers: flowHeaders(FlowNavigate, "GET", "", opts.URL, "")})
+	if err != nil {
+		return nil, err
+	}
+	defer page.Close()
+	body, err := page.Bytes()
+	if err != nil {
+		return nil, err
+	}
+	pageURL := page.FinalURL
+	if pageURL == "" {
+		pageURL = opts.URL
+	}
+
+	form, err := selectLoginForm(body, pageURL, opts.FormSelector)
+	if err != nil {
+		return nil, err
+	}
+	result := &LoginResult{Form: form}
+	result.CSRFToken, _ = FindCSRFToken(body)
+	if token := result.CSRFToken; token != nil && token.Meta && token.Name != "" {
+		if _, ok := form.Get(token.Name); !ok {
+			form.Set(token.Name, token.Value)
+		}
+	}
+	for name, value := range opts.Fields {
+		form.Set(name, value)
+	}
+
+	reqBody, contentType, err := form.Encode(true)
+	if err != nil {
+		return nil, err
+	}
+	target := form.Action
+	req := &Request{Method: form.Method, Headers: flowHeaders(FlowNavigate, form.Method, pageURL, target, "")}
+	if form.Method == "GET" {
+		u, err := url.Parse(target)
+		if err != nil {
+			return nil, err
+		}
+		u.RawQuery = string(reqBody)
+		req.URL = u.String()
+	} else {
+		req.URL = target
+		req.Headers["Content-Type"] = []string{contentType}
+		req.Body = bytes.NewReader(reqBody)
+	}
+	if opts.CSRFHeader != "" && result.CSRFToken != nil {
+		req.Headers[opts.CSRFHeader] = []string{result.CSRFToken.Value}
+	}
+
+	resp, err := s.Do(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Close()
+	result.Response = resp
+	respBody, err := resp.Bytes()
+	if err != nil {
+		return result, err
+	}
+
+	if resp.StatusCode >= 400 {
+		return result, fmt.Errorf("%w: status %d", ErrLoginFailed, resp.StatusCode)
+	}
+	if opts.FailureText != "" && bytes.Contains(respBody, []byte(opts.FailureText)) {
+		return result, fmt.Errorf("%w: response contains %q", ErrLoginFailed, opts.FailureText)
+	}
+	cookies := s.GetCookies()
+	for _, name := range opts.SuccessCookies {
+		if _, ok := cookies[name]; !ok {
+			return result, fmt.Errorf("%w: cookie %s not set", ErrLoginFailed, name)
+		}
+	}
+	return result, nil
+}
+
+// selectLoginForm picks the form matching selector, or the first form with
+// a password input
+func selectLoginForm(body []byte, pageURL, selector string) (*HTMLForm, error) {
+	if selector != "" {
+		sel, err := parseSelector(selector)
+		if err != nil {
+			return nil, err
+		}
+		doc, err := html.Parse(bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		n := sel.first(doc)
+		if n == nil || n.Data != "form" {
+			return nil, fmt.Errorf("no form matches %q on %s", selector, pageURL)
+		}
+		base, err := documentBase(doc, pageURL)
+		if err != nil {
+			return nil, err
+		}
+		return parseForm(n, base), nil
+	}
+
+	forms, err := ParseForms(body, pageURL)
+	if err != nil {
+		return nil, err
+	}
+	for _, form := range forms {
+		if form.HasPassword {
+			return form, nil
+		}
+	}
+	return nil, fmt.Errorf("no login form with a password field on %s", pageURL)
+}
+
+// formURLEncode serializes fields as application/x-www-form-urlencoded the
+// way browsers do: only ASCII alphanumerics and *-._ stay as they are,
+// spaces become + and everything else is percent-encoded in upper case
+func formURLEncode(fields []FormField) string {
+	var b strings.Builder
+	for i, field := range fields {
+		if i > 0 {
+			b.WriteByte('&')
+		}
+		writeFormComponent(&b, field.Name)
+		b.WriteByte('=')
+		writeFormComponent(&b, field.Value)
+	}
+	return b.String()
+}
+
+func writeFormComponent(b *strings.Builder, s string) {
+	const hex = "0123456789ABCDEF"
+	s = normalizeNewlines(s)
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '*', c == '-', c == '.', c == '_':
+			b.WriteByte(c)
+		case c == ' ':
+			b.WriteByte('+')
+		default:
+			b.WriteByte('%')
+			b.WriteByte(hex[c>>4])
+			b.WriteByte(hex[c&15])
+		}
+	}
+}
+
+func normalizeNewlines(s string) string {
+	if !strings.ContainsRune(s, '\n') && !strings.ContainsRune(s, '\r') {
+		return s
+	}
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	s = strings.ReplaceAll(s, "\r", "\n")
+	return strings.ReplaceAll(s, "\n", "\r\n")
+}
+
+// encodeMultipartForm encodes fields as multipart/form-data with a boundary
+// like Chromium's and WebKit's ----WebKitFormBoundary plus 16 characters
+func encodeMultipartForm(fields []FormField) ([]byte, string, error) {
+	const alphabet = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789AB"
+	random := make([]byte, 16)
+	if _, err := rand.Read(random); err != nil {
+		return nil, "", err
+	}
+	for i, c := range random {
+		random[i] = alphabet[c&63]
+	}
+
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+	if err := w.SetBoundary("----WebKitFormBoundary" + string(random)); err != nil {
+		return nil, "", err
+	}
+	for _, field := range fields {
+		if err := w.WriteField(field.Name, normalizeNewlines(field.Value)); err != nil {
+			return nil, "", err
+		}
+	}
+	if err := w.Close(); err != nil {
+		return nil, "", err
+	}
+	return buf.Bytes(), w.FormDataContentType(), nil
+}
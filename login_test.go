@@ -0,0 +1,121 @@
+package httpcloak
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const testLoginPage = `<html><head><meta name="csrf-param" content="authenticity_token"><meta name="csrf-token" content="meta-tok"></head>
+<body>
+<form action="/search"><input name="q"></form>
+<form id="login" method="post" action="/session">
+  <input type="hidden" name="_csrf" value="tok 1~">
+  <input type="email" name="email">
+  <input type="password" name="password">
+  <input type="checkbox" name="remember" checked>
+  <input type="checkbox" name="spam">
+  <select name="lang"><option value="en">English</option><option value="de" selected>Deutsch</option></select>
+  <input name="disabled" value="x" disabled>
+  <button type="submit" name="commit" value="Log in">Log in</button>
+</form>
+</body></html>`
+
+func TestParseFormsAndCSRF(t *testing.T) {
+	forms, err := ParseForms([]byte(testLoginPage), "https://example.com/login?next=/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(forms) != 2 {
+		t.Fatalf("got %d forms, want 2", len(forms))
+	}
+	form := forms[1]
+	if form.Action != "https://example.com/session" || form.Method != "POST" || !form.HasPassword || form.Submitter == nil {
+		t.Errorf("unexpected form %+v", form)
+	}
+	body, contentType, err := form.Encode(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "_csrf=tok+1%7E&email=&password=&remember=on&lang=de&commit=Log+in"
+	if string(body) != want || contentType != "application/x-www-form-urlencoded" {
+		t.Errorf("encoded form = %q (%s), want %q", body, contentType, want)
+	}
+
+	token, ok := FindCSRFToken([]byte(testLoginPage))
+	if !ok || token.Name != "_csrf" || token.Value != "tok 1~" || token.Meta {
+		t.Errorf("token = %+v", token)
+	}
+	token, ok = FindCSRFToken([]byte(`<meta name="csrf-param" content="authenticity_token"><meta name="csrf-token" content="meta-tok">`))
+	if !ok || token.Name != "authenticity_token" || token.Value != "meta-tok" || !token.Meta {
+		t.Errorf("meta token = %+v", token)
+	}
+
+	form.Enctype = "multipart/form-data"
+	body, contentType, err = form.Encode(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(contentType, "multipart/form-data; boundary=----WebKitFormBoundary") || !strings.Contains(string(body), `name="lang"`+"\r\n\r\nde\r\n") {
+		t.Errorf("multipart form: %s\n%s", contentType, body)
+	}
+}
+
+func TestSessionLogin(t *testing.T) {
+	var posted *http.Request
+	var postedBody string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/login":
+			w.Write([]byte(testLoginPage))
+		case "/session":
+			posted = r
+			data, _ := io.ReadAll(r.Body)
+			postedBody = string(data)
+			if strings.Contains(postedBody, "password=hunter2") {
+				http.SetCookie(w, &http.Cookie{Name: "sid", Value: "ok"})
+				http.Redirect(w, r, "/account", http.StatusSeeOther)
+				return
+			}
+			w.Write([]byte("Invalid password"))
+		case "/account":
+			w.Write([]byte("welcome"))
+		}
+	}))
+	defer srv.Close()
+
+	sess := NewSession("chrome-latest", WithForceHTTP1())
+	defer sess.Close()
+
+	result, err := sess.Login(context.Background(), LoginOptions{
+		URL:            srv.URL + "/login",
+		Fields:         map[string]string{"email": "a@b.c", "password": "hunter2"},
+		CSRFHeader:     "X-CSRF-Token",
+		SuccessCookies: []string{"sid"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "_csrf=tok+1%7E&email=a%40b.c&password=hunter2&remember=on&lang=de&commit=Log+in"; postedBody != want {
+		t.Errorf("posted %q, want %q", postedBody, want)
+	}
+	if posted.Header.Get("Origin") != srv.URL || posted.Header.Get("Referer") != srv.URL+"/login" || posted.Header.Get("X-CSRF-Token") != "tok 1~" {
+		t.Errorf("submission headers: %v", posted.Header)
+	}
+	if text, _ := result.Response.Text(); text != "welcome" {
+		t.Errorf("final page = %q", text)
+	}
+
+	_, err = sess.Login(context.Background(), LoginOptions{
+		URL:         srv.URL + "/login",
+		Fields:      map[string]string{"password": "wrong"},
+		FailureText: "Invalid password",
+	})
+	if !errors.Is(err, ErrLoginFailed) {
+		t.Errorf("expected ErrLoginFailed, got %v", err)
+	}
+}
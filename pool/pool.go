@@ -412,6 +412,9 @@ func (p *HostPool) createConn(ctx context.Context) (*Conn, error) {
 		Settings:       buildHTTP2Settings(settings),
 		SettingsOrder:  buildHTTP2SettingsOrder(settings),
 		PseudoHeaderOrder: func() []string {
+			if len(settings.PseudoHeaderOrder) > 0 {
+				return settings.PseudoHeaderOrder
+			}
 			// Safari/iOS uses m,s,p,a order; Chrome uses m,a,s,p
 			if settings.NoRFC7540Priorities {
 				return []string{":method", ":scheme", ":path", ":authority"} // Safari order (m,s,p,a)
@@ -814,8 +817,23 @@ func (p *HostPool) dialSOCKS5Proxy(ctx context.Context, proxy *proxyConfig) (net
 	targetPort, _ := parsePort(p.port)
 	var connectReq []byte
 
+	// socks5:// resolves the target locally, socks5h:// leaves it to the proxy
+	targetHost := p.host
+	if proxy.Scheme == "socks5" && net.ParseIP(targetHost) == nil {
+		ips, err := p.dnsCache.ResolveAllSorted(ctx, targetHost)
+		if err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("failed to resolve %s: %w", targetHost, err)
+		}
+		if len(ips) == 0 {
+			conn.Close()
+			return nil, fmt.Errorf("no IP addresses found for %s", targetHost)
+		}
+		targetHost = ips[0].String()
+	}
+
 	// Try to parse as IP address first
-	if ip := net.ParseIP(p.host); ip != nil {
+	if ip := net.ParseIP(targetHost); ip != nil {
 		if ip4 := ip.To4(); ip4 != nil {
 			// IPv4
 			connectReq = append([]byte{0x05, 0x01, 0x00, 0x01}, ip4...)
@@ -825,8 +843,8 @@ func (p *HostPool) dialSOCKS5Proxy(ctx context.Context, proxy *proxyConfig) (net
 		}
 	} else {
 		// Domain name
-		connectReq = []byte{0x05, 0x01, 0x00, 0x03, byte(len(p.host))}
-		connectReq = append(connectReq, []byte(p.host)...)
+		connectReq = []byte{0x05, 0x01, 0x00, 0x03, byte(len(targetHost))}
+		connectReq = append(connectReq, []byte(targetHost)...)
 	}
 
 	// Append port (big endian)
@@ -1303,6 +1321,14 @@ func boolToUint32(b bool) uint32 {
 
 // buildHTTP2Settings creates the settings map based on preset configuration
 func buildHTTP2Settings(settings fingerprint.HTTP2Settings) map[http2.SettingID]uint32 {
+	// Preset spells out exactly which settings to send (e.g., Firefox)
+	if len(settings.SettingsOrder) > 0 {
+		values := make(map[http2.SettingID]uint32, len(settings.SettingsOrder))
+		for _, id := range settings.SettingsOrder {
+			values[http2.SettingID(id)] = settings.SettingValue(id)
+		}
+		return values
+	}
 	// Safari/iOS uses different settings than Chrome
 	if settings.NoRFC7540Priorities {
 		// Safari/iOS settings: ENABLE_PUSH, INITIAL_WINDOW_SIZE, MAX_CONCURRENT_STREAMS, NO_RFC7540_PRIORITIES
@@ -1324,6 +1350,13 @@ func buildHTTP2Settings(settings fingerprint.HTTP2Settings) map[http2.SettingID]
 
 // buildHTTP2SettingsOrder creates the settings order based on preset configuration
 func buildHTTP2SettingsOrder(settings fingerprint.HTTP2Settings) []http2.SettingID {
+	if len(settings.SettingsOrder) > 0 {
+		order := make([]http2.SettingID, len(settings.SettingsOrder))
+		for i, id := range settings.SettingsOrder {
+			order[i] = http2.SettingID(id)
+		}
+		return order
+	}
 	// Safari/iOS uses different order than Chrome
 	if settings.NoRFC7540Priorities {
 		// Safari/iOS order: 2, 4, 3, 9
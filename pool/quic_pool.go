@@ -22,14 +22,6 @@ import (
 	utls "github.com/sardanioss/utls"
 )
 
-// HTTP/3 SETTINGS identifiers (Chrome-like)
-const (
-	settingQPACKMaxTableCapacity = 0x1
-	settingMaxFieldSectionSize   = 0x6
-	settingQPACKBlockedStreams   = 0x7
-	settingH3Datagram            = 0x33
-)
-
 // QUIC Transport Parameter IDs
 const (
 	transportParamVersionInfo  = 0x11   // version_information
@@ -444,32 +436,10 @@ func (p *QUICHostPool) createConn(ctx context.Context) (*QUICConn, error) {
 		port = 443
 	}
 
-	// Generate large GREASE setting ID like Chrome (0x1f * N + 0x21 where N is large)
-	greaseSettingN := uint64(1000000000 + rand.Int63n(9000000000))
-	greaseSettingID := 0x1f*greaseSettingN + 0x21
-	// Generate non-zero random 32-bit value (Chrome never sends 0)
-	greaseSettingValue := uint64(1 + rand.Uint32()%(1<<32-1))
-
-	// HTTP/3 QPACK settings - Safari/iOS uses different values than Chrome
-	// Safari/iOS: QPACK_MAX_TABLE_CAPACITY=16383 (0x3fff)
-	// Chrome: QPACK_MAX_TABLE_CAPACITY=65536 (0x10000)
-	qpackMaxTableCapacity := uint64(65536) // Chrome default
-	if p.preset != nil && p.preset.HTTP2Settings.NoRFC7540Priorities {
-		// Safari/iOS uses smaller QPACK table
-		qpackMaxTableCapacity = 16383
-	}
-
-	// HTTP/3 additional settings
-	additionalSettings := map[uint64]uint64{
-		settingQPACKMaxTableCapacity: qpackMaxTableCapacity, // Browser-specific QPACK table capacity
-		settingQPACKBlockedStreams:   100,                   // Both Chrome and Safari use 100
-		greaseSettingID:              greaseSettingValue,    // Random non-zero GREASE value
-	}
-
-	// Add Chrome-specific settings (not sent by Safari/iOS)
-	if p.preset == nil || !p.preset.HTTP2Settings.NoRFC7540Priorities {
-		additionalSettings[settingMaxFieldSectionSize] = 262144 // Chrome's MAX_FIELD_SECTION_SIZE
-		additionalSettings[settingH3Datagram] = 1               // Chrome enables H3_DATAGRAM
+	// HTTP/3 SETTINGS for the preset (Chrome's without one)
+	h3Settings := (&fingerprint.Preset{}).H3()
+	if p.preset != nil {
+		h3Settings = p.preset.H3()
 	}
 
 	// Order IPs based on preference
@@ -490,9 +460,9 @@ func (p *QUICHostPool) createConn(ctx context.Context) (*QUICConn, error) {
 		TLSClientConfig:        tlsConfig,
 		QUICConfig:             quicConfig,
 		EnableDatagrams:        true,       // Chrome enables H3_DATAGRAM
-		AdditionalSettings:     additionalSettings,
+		AdditionalSettings:     h3Settings.AdditionalSettings(),
 		MaxResponseHeaderBytes: 262144,     // Chrome's MAX_FIELD_SECTION_SIZE (256KB)
-		SendGreaseFrames:       true,       // Chrome sends GREASE frames
+		SendGreaseFrames:       h3Settings.GreaseFrames,
 		Dial: func(ctx context.Context, addr string, tlsCfg *tls.Config, cfg *quic.Config) (*quic.Conn, error) {
 			// Combine all IPs, preferred first
 			allIPs := append(preferredIPs, fallbackIPs...)
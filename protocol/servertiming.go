@@ -0,0 +1,100 @@
+package protocol
+
+import (
+	"strconv"
+	"strings"
+)
+
+// ServerTiming is a single metric from a Server-Timing response header
+type ServerTiming struct {
+	Name        string  `json:"name"`                  // Metric name (e.g., "cdn-cache", "db")
+	Duration    float64 `json:"duration,omitempty"`    // Reported duration in milliseconds
+	Description string  `json:"description,omitempty"` // Optional human-readable description
+}
+
+// ParseServerTiming parses Server-Timing header values into structured entries.
+// Each value may hold several comma-separated metrics, e.g.:
+//
+//	cdn-cache;desc=HIT, edge;dur=12.5, origin;dur=84;desc="db + render"
+//
+// Malformed metrics are skipped; unknown parameters are ignored.
+func ParseServerTiming(values []string) []ServerTiming {
+	var entries []ServerTiming
+	for _, value := range values {
+		for _, metric := range splitUnquoted(value, ',') {
+			params := splitUnquoted(metric, ';')
+			name := strings.TrimSpace(params[0])
+			if name == "" {
+				continue
+			}
+
+			// First occurrence of a parameter wins per the spec, even when
+			// it's 0, empty or invalid
+			entry := ServerTiming{Name: name}
+			var durSeen, descSeen bool
+			for _, param := range params[1:] {
+				key, val, _ := strings.Cut(param, "=")
+				key = strings.ToLower(strings.TrimSpace(key))
+				val = unquote(strings.TrimSpace(val))
+				switch key {
+				case "dur":
+					if !durSeen {
+						durSeen = true
+						if d, err := strconv.ParseFloat(val, 64); err == nil {
+							entry.Duration = d
+						}
+					}
+				case "desc":
+					if !descSeen {
+						descSeen = true
+						entry.Description = val
+					}
+				}
+			}
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// splitUnquoted splits s on sep, ignoring separators inside double-quoted strings
+func splitUnquoted(s string, sep byte) []string {
+	var parts []string
+	inQuotes := false
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			if inQuotes {
+				i++
+			}
+		case '"':
+			inQuotes = !inQuotes
+		case sep:
+			if !inQuotes {
+				parts = append(parts, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// unquote strips surrounding double quotes and resolves backslash escapes
+func unquote(s string) string {
+	if len(s) < 2 || s[0] != '"' || s[len(s)-1] != '"' {
+		return s
+	}
+	s = s[1 : len(s)-1]
+	if !strings.Contains(s, "\\") {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			i++
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
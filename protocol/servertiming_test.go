@@ -0,0 +1,36 @@
+package protocol
+
+import "testing"
+
+func TestParseServerTiming(t *testing.T) {
+	values := []string{
+		`cdn-cache;desc=HIT, edge;dur=12.5`,
+		`origin;dur=84;desc="db, render", ;dur=1, total;dur=abc`,
+		`miss;dur=0;dur=5;desc="";desc=late, bad;dur=x;dur=7`,
+	}
+
+	got := ParseServerTiming(values)
+	want := []ServerTiming{
+		{Name: "cdn-cache", Description: "HIT"},
+		{Name: "edge", Duration: 12.5},
+		{Name: "origin", Duration: 84, Description: "db, render"},
+		{Name: "total"},
+		{Name: "miss"},
+		{Name: "bad"},
+	}
+
+	if len(got) != len(want) {
+		t.Fatalf("Expected %d entries, got %d: %+v", len(want), len(got), got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("Entry %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestParseServerTiming_Empty(t *testing.T) {
+	if got := ParseServerTiming(nil); got != nil {
+		t.Errorf("Expected nil for no headers, got %+v", got)
+	}
+}
@@ -112,6 +112,9 @@ type Timing struct {
 	TLSHandshake float64 `json:"tlsHandshake"` // TLS handshake time (0 = reused)
 	FirstByte    float64 `json:"firstByte"`    // Time to first response byte
 	Total        float64 `json:"total"`        // Total request time
+
+	// Server contains metrics reported by the origin/CDN via Server-Timing headers
+	Server []ServerTiming `json:"server,omitempty"`
 }
 
 // ErrorInfo contains error details
@@ -136,7 +139,7 @@ type SessionConfig struct {
 	// Base URL for relative paths
 	BaseURL string `json:"baseUrl,omitempty"`
 
-	// Proxy URL (http://, https://, socks5://) - used for all protocols
+	// Proxy URL (http://, https://, socks5://, socks5h://) - used for all protocols
 	Proxy string `json:"proxy,omitempty"`
 
 	// TCPProxy is the proxy URL for TCP-based protocols (HTTP/1.1 and HTTP/2)
@@ -161,6 +164,10 @@ type SessionConfig struct {
 	RetryWaitMax  int   `json:"retryWaitMax,omitempty"`  // Milliseconds
 	RetryOnStatus []int `json:"retryOnStatus,omitempty"` // Status codes to retry
 
+	// MaxAttempts caps round trips per request across retries and redirects
+	// (0 = MaxRedirects + MaxRetries + 1)
+	MaxAttempts int `json:"maxAttempts,omitempty"`
+
 	// TLS options
 	InsecureSkipVerify bool `json:"insecureSkipVerify,omitempty"`
 
@@ -173,6 +180,7 @@ type SessionConfig struct {
 
 	// Network options
 	PreferIPv4   bool   `json:"preferIpv4,omitempty"`   // Prefer IPv4 addresses over IPv6
+	IPFamily     string `json:"ipFamily,omitempty"`     // Only use "ipv4" or "ipv6" addresses
 	LocalAddress string `json:"localAddress,omitempty"` // Local IP to bind outgoing connections (for IPv6 rotation)
 
 	// Domain fronting: request_host -> connect_host mapping
@@ -189,10 +197,18 @@ type SessionConfig struct {
 	// Connections are closed after this duration of inactivity
 	QuicIdleTimeout int `json:"quicIdleTimeout,omitempty"`
 
+	// QUIC keepalive period in milliseconds (default: half the idle
+	// timeout). -1 disables keepalives.
+	QuicKeepAlive int `json:"quicKeepAlive,omitempty"`
+
 	// KeyLogFile is the path to write TLS key log for Wireshark decryption.
 	// If set, overrides the global SSLKEYLOGFILE environment variable for this session.
 	KeyLogFile string `json:"keyLogFile,omitempty"`
 
+	// HARLogFile is the path of an append-only traffic log. Every round trip
+	// (including redirects and retries) is written as one HAR entry per line.
+	HARLogFile string `json:"harLogFile,omitempty"`
+
 	// DisableECH skips ECH (Encrypted Client Hello) DNS lookup for faster first request
 	// ECH adds ~15-20ms to first connection but provides extra privacy
 	DisableECH bool `json:"disableEch,omitempty"`
@@ -210,6 +226,50 @@ type SessionConfig struct {
 	// with TLS session resumption.
 	SwitchProtocol string `json:"switchProtocol,omitempty"`
 
+	// CachePermanentRedirects rewrites requests for URLs that previously returned
+	// 301/308 straight to the remembered location, like browsers do, saving a
+	// round trip per request for moved resources. Nothing is remembered while
+	// it's off; a session keeps up to 256 redirects, dropping the least
+	// recently used first.
+	CachePermanentRedirects bool `json:"cachePermanentRedirects,omitempty"`
+
+	// PartitionHTTPCache keys cached validators (ETag, Last-Modified) by the
+	// top-frame site as well as the URL, like Chrome's partitioned HTTP
+	// cache, so Warmup revalidates cross-site subresources per site
+	PartitionHTTPCache bool `json:"partitionHTTPCache,omitempty"`
+
+	// SSRFProtection blocks requests to private, loopback, link-local and cloud
+	// metadata addresses, checked after DNS resolution to defeat DNS rebinding
+	SSRFProtection bool `json:"ssrfProtection,omitempty"`
+
+	// TargetJA4 / TargetJA4H are the fingerprints the session must produce.
+	// The first TLS handshake and first request are checked against them and
+	// fail with a fingerprint mismatch error if they differ.
+	TargetJA4  string `json:"targetJa4,omitempty"`
+	TargetJA4H string `json:"targetJa4h,omitempty"`
+
+	// StrictConformance reports servers' protocol violations on responses
+	// (see transport.TransportConfig.StrictConformance)
+	StrictConformance bool `json:"strictConformance,omitempty"`
+
+	// FirstByteTimeout in milliseconds aborts requests whose response
+	// headers are late (see transport.TransportConfig.FirstByteTimeout)
+	FirstByteTimeout int `json:"firstByteTimeout,omitempty"`
+
+	// StallTimeout in milliseconds aborts body reads that get no bytes for
+	// that long (see transport.TransportConfig.StallTimeout)
+	StallTimeout int `json:"stallTimeout,omitempty"`
+
+	// TicketRefreshAfter enables background TLS session ticket refresh: hosts
+	// the session uses repeatedly get a fresh handshake (no request) once their
+	// ticket is this many seconds old, keeping PSK resumption available.
+	// HTTP/2 only; 0 disables it.
+	TicketRefreshAfter int `json:"ticketRefreshAfter,omitempty"`
+
+	// CookieSkewTolerance keeps cookies this many seconds past their expiry
+	// (see session.CookieJar.SetSkewTolerance)
+	CookieSkewTolerance int `json:"cookieSkewTolerance,omitempty"`
+
 	// Default authentication (can be overridden per-request)
 	Auth *AuthConfig `json:"auth,omitempty"`
 }
@@ -0,0 +1,153 @@
+package proxy
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Authenticator produces the tokens of one connection-based proxy
+// authentication handshake, such as NTLM or Negotiate. Every leg of the
+// handshake runs on the same connection; use a new Authenticator for each.
+type Authenticator interface {
+	// Scheme is the auth-scheme of the Proxy-Authorization header
+	Scheme() string
+	// Next returns the token for the next leg, given the token of the
+	// proxy's last challenge (nil on the first leg)
+	Next(ctx context.Context, challenge []byte) ([]byte, error)
+}
+
+// NegotiateFunc returns the next SPNEGO token for a Negotiate (Kerberos)
+// handshake with proxyHost, given the proxy's last challenge token (nil on
+// the first leg). It plugs in a Kerberos implementation, such as gokrb5's
+// SPNEGO client or the platform's GSSAPI/SSPI.
+type NegotiateFunc func(ctx context.Context, proxyHost string, challenge []byte) ([]byte, error)
+
+// Credentials are what an HTTP proxy's 407 challenges can be answered with
+type Credentials struct {
+	// Username and Password answer NTLM challenges, and Negotiate ones when
+	// Negotiate is nil. DOMAIN\user sets the NTLM domain.
+	Username string
+	Password string
+
+	// Negotiate answers Negotiate challenges with Kerberos tokens
+	Negotiate NegotiateFunc
+}
+
+type negotiateAuthenticator struct {
+	host      string
+	negotiate NegotiateFunc
+}
+
+func (a *negotiateAuthenticator) Scheme() string { return "Negotiate" }
+
+func (a *negotiateAuthenticator) Next(ctx context.Context, challenge []byte) ([]byte, error) {
+	return a.negotiate(ctx, a.host, challenge)
+}
+
+// ChallengeAuthenticator picks the Authenticator for a 407 response from its
+// Proxy-Authenticate values: Negotiate with Kerberos when creds have a
+// NegotiateFunc, NTLM, then NTLM in place of Kerberos for a proxy that only
+// offers Negotiate, which Windows proxies accept. It returns nil when none
+// of the offered schemes can be answered.
+func ChallengeAuthenticator(challenges []string, proxyHost string, creds Credentials) Authenticator {
+	offers := func(scheme string) bool {
+		for _, c := range challenges {
+			if name, _, _ := strings.Cut(strings.TrimSpace(c), " "); strings.EqualFold(name, scheme) {
+				return true
+			}
+		}
+		return false
+	}
+	switch {
+	case offers("Negotiate") && creds.Negotiate != nil:
+		return &negotiateAuthenticator{host: proxyHost, negotiate: creds.Negotiate}
+	case creds.Username == "":
+		return nil
+	case offers("NTLM"):
+		return NewNTLM("", creds.Username, creds.Password)
+	case offers("Negotiate"):
+		a := NewNTLM("", creds.Username, creds.Password).(*ntlmAuthenticator)
+		a.scheme = "Negotiate"
+		return a
+	}
+	return nil
+}
+
+// AuthenticateConnect answers the 407 a proxy sent for an HTTP CONNECT,
+// repeating the request on the same connection with the tokens of the
+// scheme ChallengeAuthenticator picks. connectReq is the original request;
+// any Proxy-Authorization line in it is replaced. It returns the proxy's
+// final response, or nil when none of the offered schemes can be answered.
+// br must be the reader the 407 was read from, with its body drained.
+func AuthenticateConnect(ctx context.Context, conn net.Conn, br *bufio.Reader, connectReq string, challenges []string, proxyHost string, creds Credentials) (*http.Response, error) {
+	auth := ChallengeAuthenticator(challenges, proxyHost, creds)
+	if auth == nil {
+		return nil, nil
+	}
+
+	var base strings.Builder
+	for _, line := range strings.SplitAfter(connectReq, "\r\n") {
+		if line == "\r\n" || line == "" {
+			break
+		}
+		if name, _, _ := strings.Cut(line, ":"); strings.EqualFold(strings.TrimSpace(name), "Proxy-Authorization") {
+			continue
+		}
+		base.WriteString(line)
+	}
+
+	var challenge []byte
+	// NTLM takes two legs, Kerberos usually one; a few more allow for
+	// mutual authentication
+	for leg := 0; leg < 4; leg++ {
+		token, err := auth.Next(ctx, challenge)
+		if err != nil {
+			return nil, fmt.Errorf("%s proxy authentication: %w", auth.Scheme(), err)
+		}
+		req := base.String() + "Proxy-Authorization: " + auth.Scheme() + " " + base64.StdEncoding.EncodeToString(token) + "\r\n\r\n"
+		if _, err := conn.Write([]byte(req)); err != nil {
+			return nil, fmt.Errorf("failed to send CONNECT request: %w", err)
+		}
+
+		deadline := time.Now().Add(30 * time.Second)
+		if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+			deadline = ctxDeadline
+		}
+		conn.SetReadDeadline(deadline)
+		resp, err := http.ReadResponse(br, nil)
+		if err != nil {
+			conn.SetReadDeadline(time.Time{})
+			return nil, fmt.Errorf("failed to read CONNECT response: %w", err)
+		}
+		if resp.StatusCode != http.StatusProxyAuthRequired {
+			conn.SetReadDeadline(time.Time{})
+			return resp, nil
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		conn.SetReadDeadline(time.Time{})
+
+		challenge = nil
+		for _, value := range resp.Header.Values("Proxy-Authenticate") {
+			name, param, _ := strings.Cut(strings.TrimSpace(value), " ")
+			if strings.EqualFold(name, auth.Scheme()) && param != "" {
+				challenge, err = base64.StdEncoding.DecodeString(strings.TrimSpace(param))
+				if err != nil {
+					return nil, fmt.Errorf("%s proxy authentication: malformed challenge: %w", auth.Scheme(), err)
+				}
+			}
+		}
+		if challenge == nil {
+			// Rejected without a challenge to continue with: bad credentials
+			return resp, nil
+		}
+	}
+	return nil, fmt.Errorf("%s proxy authentication: handshake did not complete", auth.Scheme())
+}
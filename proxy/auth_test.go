@@ -0,0 +1,140 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Test vectors from MS-NLMP 4.2.4 (NTLMv2 authentication)
+func TestNTLMv2Vectors(t *testing.T) {
+	key := ntlmOWFv2("Domain", "User", "Password")
+	if got := hex.EncodeToString(key); got != "0c868a403bfd7a93a3001ef22ef02e3f" {
+		t.Errorf("NTOWFv2 = %s", got)
+	}
+
+	serverChallenge, _ := hex.DecodeString("0123456789abcdef")
+	clientChallenge := bytes.Repeat([]byte{0xaa}, 8)
+	if got := hex.EncodeToString(hmacMD5(key, serverChallenge, clientChallenge)); got != "86c35097ac9cec102554764a57cccc19" {
+		t.Errorf("LMv2 response = %s", got)
+	}
+
+	targetInfo, _ := hex.DecodeString("02000c0044006f006d00610069006e0001000c0053006500720076006500720000000000")
+	resp := ntlmV2Response(key, serverChallenge, clientChallenge, make([]byte, 8), targetInfo)
+	if got := hex.EncodeToString(resp[:16]); got != "68cd0ab851e51c96aabc927bebef6a1c" {
+		t.Errorf("NTProofStr = %s", got)
+	}
+}
+
+// ntlmChallengeMessage builds a CHALLENGE_MESSAGE with no target info
+func ntlmChallengeMessage(challenge []byte) []byte {
+	msg := make([]byte, 48)
+	copy(msg, ntlmSignature)
+	binary.LittleEndian.PutUint32(msg[8:], 2)
+	binary.LittleEndian.PutUint32(msg[20:], ntlmDefaultFlags)
+	copy(msg[24:], challenge)
+	binary.LittleEndian.PutUint32(msg[44:], 48)
+	return msg
+}
+
+// ntlmField returns a security buffer of an AUTHENTICATE_MESSAGE
+func ntlmField(msg []byte, i int) []byte {
+	pos := 12 + i*8
+	length := int(binary.LittleEndian.Uint16(msg[pos:]))
+	offset := int(binary.LittleEndian.Uint32(msg[pos+4:]))
+	return msg[offset : offset+length]
+}
+
+func TestAuthenticateConnectNTLM(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	serverChallenge := []byte("8bytes!!")
+
+	verified := make(chan bool, 1)
+	go func() {
+		defer server.Close()
+		br := bufio.NewReader(server)
+		token := func() []byte {
+			req, err := http.ReadRequest(br)
+			if err != nil {
+				return nil
+			}
+			_, param, _ := strings.Cut(req.Header.Get("Proxy-Authorization"), " ")
+			b, _ := base64.StdEncoding.DecodeString(param)
+			return b
+		}
+
+		if negotiate := token(); len(negotiate) < 12 || binary.LittleEndian.Uint32(negotiate[8:]) != 1 {
+			verified <- false
+			return
+		}
+		server.Write([]byte("HTTP/1.1 407 Proxy Authentication Required\r\nProxy-Authenticate: NTLM " +
+			base64.StdEncoding.EncodeToString(ntlmChallengeMessage(serverChallenge)) + "\r\nContent-Length: 4\r\n\r\ndeny"))
+
+		auth := token()
+		if len(auth) < 64 {
+			verified <- false
+			return
+		}
+		nt := ntlmField(auth, 1)
+		key := ntlmOWFv2("CORP", "alice", "s3cret")
+		ok := string(ntlmField(auth, 2)) == string(ntlmUnicode("CORP")) &&
+			string(ntlmField(auth, 3)) == string(ntlmUnicode("alice")) &&
+			bytes.Equal(nt[:16], hmacMD5(key, serverChallenge, nt[16:]))
+		verified <- ok
+		if ok {
+			server.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\n"))
+		} else {
+			server.Write([]byte("HTTP/1.1 407 Proxy Authentication Required\r\nProxy-Authenticate: NTLM\r\nContent-Length: 0\r\n\r\n"))
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	connectReq := "CONNECT example.com:443 HTTP/1.1\r\nHost: example.com:443\r\nProxy-Authorization: Basic eA==\r\n\r\n"
+	resp, err := AuthenticateConnect(ctx, client, bufio.NewReader(client), connectReq,
+		[]string{"Negotiate", "NTLM", `Basic realm="corp"`}, "proxy.corp", Credentials{Username: `CORP\alice`, Password: "s3cret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !<-verified {
+		t.Error("proxy rejected the NTLM messages")
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("status = %d", resp.StatusCode)
+	}
+}
+
+func TestChallengeAuthenticator(t *testing.T) {
+	creds := Credentials{Username: "alice", Password: "x"}
+	kerberos := Credentials{Negotiate: func(ctx context.Context, host string, challenge []byte) ([]byte, error) { return nil, nil }}
+
+	tests := []struct {
+		challenges []string
+		creds      Credentials
+		want       string
+	}{
+		{[]string{"NTLM", "Negotiate"}, creds, "NTLM"},
+		{[]string{"Negotiate"}, creds, "Negotiate"},
+		{[]string{"NTLM", "Negotiate"}, kerberos, "Negotiate"},
+		{[]string{"NTLM"}, kerberos, ""},
+		{[]string{`Basic realm="x"`}, creds, ""},
+	}
+	for _, tt := range tests {
+		got := ""
+		if a := ChallengeAuthenticator(tt.challenges, "proxy", tt.creds); a != nil {
+			got = a.Scheme()
+		}
+		if got != tt.want {
+			t.Errorf("ChallengeAuthenticator(%q) = %q, want %q", tt.challenges, got, tt.want)
+		}
+	}
+}
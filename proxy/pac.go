@@ -0,0 +1,576 @@
+package proxy
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Selector picks the proxies for a request, in the order to try them, with
+// "" standing for a direct connection. Sessions take one with
+// WithProxySelector. Credentials aren't part of proxy auto-configuration;
+// wrap a Selector to add them to the URLs it returns.
+type Selector interface {
+	Select(ctx context.Context, u *url.URL) ([]string, error)
+}
+
+// PAC is a parsed proxy auto-config file. It runs on a built-in interpreter
+// limited to the standard PAC function set (isPlainHostName, dnsDomainIs,
+// shExpMatch, isInNet, dnsResolve, myIpAddress, weekdayRange, dateRange,
+// timeRange and the rest of Netscape's set) combined with if/else, variables
+// and the script's own functions. Scripts needing more, such as loops, string
+// methods or regular expressions, fail in ParsePAC. A PAC is safe for
+// concurrent use.
+type PAC struct {
+	script *jsBody
+}
+
+// ParsePAC parses a PAC file, which must define FindProxyForURL
+func ParsePAC(script string) (*PAC, error) {
+	body, err := jsParse(script)
+	if err != nil {
+		return nil, err
+	}
+	for _, fn := range body.funcs {
+		if fn.name == "FindProxyForURL" {
+			return &PAC{script: body}, nil
+		}
+	}
+	return nil, errors.New("pac: script does not define FindProxyForURL")
+}
+
+// FindProxyForURL runs the script's FindProxyForURL and returns its result,
+// such as "PROXY proxy.example.com:8080; DIRECT". Like browsers, it passes
+// https URLs without their path and query, which the proxy never sees.
+func (p *PAC) FindProxyForURL(ctx context.Context, rawURL string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", fmt.Errorf("pac: %w", err)
+	}
+	if u.Scheme == "https" || u.Scheme == "wss" {
+		u = &url.URL{Scheme: u.Scheme, Host: u.Host, Path: "/"}
+	}
+
+	run := &jsRun{ctx: ctx}
+	global := &jsEnv{vars: make(map[string]any, len(pacFunctions)), run: run}
+	for name, fn := range pacFunctions {
+		global.vars[name] = &jsNative{name: name, fn: fn}
+	}
+	if _, _, err := p.script.exec(global); err != nil {
+		return "", err
+	}
+	result, err := jsCall(run, global.vars["FindProxyForURL"], "FindProxyForURL", []any{u.String(), u.Hostname()})
+	if err != nil {
+		return "", err
+	}
+	if s, ok := result.(string); ok {
+		return s, nil
+	}
+	if result == nil || result == (jsNull{}) {
+		return "", nil
+	}
+	return "", fmt.Errorf("pac: FindProxyForURL returned a %s", jsTypeof(result))
+}
+
+// Select evaluates FindProxyForURL for u and converts its result with
+// ParseProxyList
+func (p *PAC) Select(ctx context.Context, u *url.URL) ([]string, error) {
+	result, err := p.FindProxyForURL(ctx, u.String())
+	if err != nil {
+		return nil, err
+	}
+	return ParseProxyList(result)
+}
+
+// ParseProxyList converts a FindProxyForURL result into proxy URLs in the
+// order to try them, with "" for DIRECT. PROXY and HTTP entries become
+// http:// URLs, HTTPS entries https:// and SOCKS and SOCKS5 entries
+// socks5://. SOCKS4 isn't supported and is skipped. An empty result means
+// DIRECT.
+func ParseProxyList(result string) ([]string, error) {
+	if strings.TrimSpace(result) == "" {
+		return []string{""}, nil
+	}
+	var proxies []string
+	for _, entry := range strings.Split(result, ";") {
+		fields := strings.Fields(entry)
+		if len(fields) == 0 {
+			continue
+		}
+		kind := strings.ToUpper(fields[0])
+		if kind == "DIRECT" {
+			proxies = append(proxies, "")
+			continue
+		}
+		if len(fields) != 2 {
+			continue
+		}
+		scheme := map[string]string{"PROXY": "http", "HTTP": "http", "HTTPS": "https", "SOCKS": "socks5", "SOCKS5": "socks5"}[kind]
+		if scheme == "" {
+			continue
+		}
+		proxies = append(proxies, scheme+"://"+fields[1])
+	}
+	if len(proxies) == 0 {
+		return nil, fmt.Errorf("pac: no usable proxy in %q", result)
+	}
+	return proxies, nil
+}
+
+// FetchPAC downloads and parses a PAC file from an http, https or file URL.
+// It is fetched directly, not through a proxy.
+func FetchPAC(ctx context.Context, pacURL string) (*PAC, error) {
+	u, err := url.Parse(pacURL)
+	if err != nil {
+		return nil, fmt.Errorf("pac: invalid URL: %w", err)
+	}
+	var script []byte
+	switch u.Scheme {
+	case "file":
+		path := u.Path
+		if runtime.GOOS == "windows" {
+			// file:///C:/proxy.pac
+			path = filepath.FromSlash(strings.TrimPrefix(path, "/"))
+		}
+		script, err = os.ReadFile(path)
+	case "http", "https":
+		script, err = fetchPACHTTP(ctx, pacURL)
+	default:
+		return nil, fmt.Errorf("pac: unsupported URL scheme %q", u.Scheme)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("pac: fetching %s: %w", pacURL, err)
+	}
+	return ParsePAC(string(script))
+}
+
+// pacHTTPClient fetches PAC files without a proxy
+var pacHTTPClient = &http.Client{
+	Transport: &http.Transport{Proxy: nil, DialContext: (&net.Dialer{Timeout: 5 * time.Second}).DialContext},
+	Timeout:   15 * time.Second,
+}
+
+func fetchPACHTTP(ctx context.Context, pacURL string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, pacURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := pacHTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status %d", resp.StatusCode)
+	}
+	const maxPAC = 1 << 20
+	script, err := io.ReadAll(io.LimitReader(resp.Body, maxPAC+1))
+	if err == nil && len(script) > maxPAC {
+		err = errors.New("file larger than 1MB")
+	}
+	return script, err
+}
+
+// AutoConfigURL returns a Selector that evaluates the PAC file at pacURL.
+// The file is fetched on first use and again every hour; while a refetch
+// fails the last good copy stays in use.
+func AutoConfigURL(pacURL string) Selector {
+	return &pacLoader{load: func(ctx context.Context) (*PAC, error) { return FetchPAC(ctx, pacURL) }}
+}
+
+// WPAD returns a Selector that evaluates the PAC file found by
+// DiscoverWPAD, discovering it on first use and again every hour
+func WPAD() Selector {
+	return &pacLoader{load: func(ctx context.Context) (*PAC, error) {
+		_, pac, err := discoverWPAD(ctx)
+		return pac, err
+	}}
+}
+
+const (
+	pacRefresh = time.Hour
+	pacRetry   = 30 * time.Second
+)
+
+// pacLoader caches the PAC file load returns
+type pacLoader struct {
+	load func(ctx context.Context) (*PAC, error)
+
+	mu       sync.Mutex
+	pac      *PAC
+	loadedAt time.Time
+	err      error
+	failedAt time.Time
+}
+
+func (l *pacLoader) Select(ctx context.Context, u *url.URL) ([]string, error) {
+	pac, err := l.current(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return pac.Select(ctx, u)
+}
+
+func (l *pacLoader) current(ctx context.Context) (*PAC, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if l.pac != nil && now.Sub(l.loadedAt) < pacRefresh {
+		return l.pac, nil
+	}
+	if l.err == nil || now.Sub(l.failedAt) >= pacRetry {
+		pac, err := l.load(ctx)
+		if err == nil {
+			l.pac, l.loadedAt, l.err = pac, now, nil
+			return pac, nil
+		}
+		l.err, l.failedAt = err, now
+	}
+	if l.pac != nil {
+		return l.pac, nil
+	}
+	return nil, l.err
+}
+
+// ErrNoWPAD is returned when WPAD discovery finds no PAC file
+var ErrNoWPAD = errors.New("pac: no WPAD server found")
+
+// DiscoverWPAD looks for a PAC file the way WPAD's DNS discovery does: at
+// http://wpad.<domain>/wpad.dat for the machine's domain and each parent
+// domain above the top two labels, then for its DNS search domains. It
+// returns the URL of the first valid PAC file. DHCP discovery isn't
+// supported.
+func DiscoverWPAD(ctx context.Context) (string, error) {
+	pacURL, _, err := discoverWPAD(ctx)
+	return pacURL, err
+}
+
+func discoverWPAD(ctx context.Context) (string, *PAC, error) {
+	for _, domain := range wpadDomains() {
+		if ctx.Err() != nil {
+			return "", nil, ctx.Err()
+		}
+		pacURL := "http://wpad." + domain + "/wpad.dat"
+		fetchCtx, cancel := context.WithTimeout(ctx, 3*time.Second)
+		pac, err := FetchPAC(fetchCtx, pacURL)
+		cancel()
+		if err == nil {
+			return pacURL, pac, nil
+		}
+	}
+	return "", nil, ErrNoWPAD
+}
+
+// wpadDomains lists the domains to try WPAD under, most specific first
+func wpadDomains() []string {
+	var bases []string
+	if host, err := os.Hostname(); err == nil {
+		if _, domain, ok := strings.Cut(host, "."); ok {
+			bases = append(bases, domain)
+		}
+	}
+	if conf, err := os.ReadFile("/etc/resolv.conf"); err == nil {
+		for _, line := range strings.Split(string(conf), "\n") {
+			fields := strings.Fields(line)
+			if len(fields) > 1 && (fields[0] == "search" || fields[0] == "domain") {
+				bases = append(bases, fields[1:]...)
+			}
+		}
+	}
+	return wpadCandidates(bases...)
+}
+
+// wpadCandidates expands domains into themselves and their parents
+func wpadCandidates(bases ...string) []string {
+	var domains []string
+	seen := make(map[string]bool)
+	for _, base := range bases {
+		labels := strings.Split(strings.Trim(strings.ToLower(base), "."), ".")
+		// Never above the registrable domain: wpad.com would be anyone's
+		for i := 0; len(labels)-i >= 2; i++ {
+			domain := strings.Join(labels[i:], ".")
+			if !seen[domain] {
+				seen[domain] = true
+				domains = append(domains, domain)
+			}
+		}
+	}
+	return domains
+}
+
+// PAC functions
+
+var pacFunctions = map[string]func(run *jsRun, args []any) (any, error){
+	"isPlainHostName": func(_ *jsRun, args []any) (any, error) {
+		return !strings.Contains(pacArg(args, 0), "."), nil
+	},
+	"dnsDomainIs": func(_ *jsRun, args []any) (any, error) {
+		return strings.HasSuffix(strings.ToLower(pacArg(args, 0)), strings.ToLower(pacArg(args, 1))), nil
+	},
+	"localHostOrDomainIs": func(_ *jsRun, args []any) (any, error) {
+		host, hostdom := strings.ToLower(pacArg(args, 0)), strings.ToLower(pacArg(args, 1))
+		return host == hostdom || !strings.Contains(host, ".") && strings.HasPrefix(hostdom, host+"."), nil
+	},
+	"isResolvable": func(run *jsRun, args []any) (any, error) {
+		_, ok := pacResolve(run.ctx, pacArg(args, 0))
+		return ok, nil
+	},
+	"dnsResolve": func(run *jsRun, args []any) (any, error) {
+		if ip, ok := pacResolve(run.ctx, pacArg(args, 0)); ok {
+			return ip.String(), nil
+		}
+		return jsNull{}, nil
+	},
+	"isInNet": func(run *jsRun, args []any) (any, error) {
+		ip, ok := pacResolve(run.ctx, pacArg(args, 0))
+		pattern, err1 := netip.ParseAddr(pacArg(args, 1))
+		mask, err2 := netip.ParseAddr(pacArg(args, 2))
+		if !ok || err1 != nil || err2 != nil || !pattern.Is4() || !mask.Is4() {
+			return false, nil
+		}
+		a, p, m := ip.As4(), pattern.As4(), mask.As4()
+		return binary.BigEndian.Uint32(a[:])&binary.BigEndian.Uint32(m[:]) == binary.BigEndian.Uint32(p[:])&binary.BigEndian.Uint32(m[:]), nil
+	},
+	"myIpAddress": func(*jsRun, []any) (any, error) {
+		return myIPAddress(), nil
+	},
+	"dnsDomainLevels": func(_ *jsRun, args []any) (any, error) {
+		return float64(strings.Count(pacArg(args, 0), ".")), nil
+	},
+	"shExpMatch": func(_ *jsRun, args []any) (any, error) {
+		return shExpMatch(pacArg(args, 0), pacArg(args, 1)), nil
+	},
+	"convert_addr": func(_ *jsRun, args []any) (any, error) {
+		ip, err := netip.ParseAddr(pacArg(args, 0))
+		if err != nil || !ip.Is4() {
+			return float64(0), nil
+		}
+		b := ip.As4()
+		return float64(binary.BigEndian.Uint32(b[:])), nil
+	},
+	"weekdayRange": func(_ *jsRun, args []any) (any, error) {
+		return weekdayRange(time.Now(), args), nil
+	},
+	"dateRange": func(_ *jsRun, args []any) (any, error) {
+		return dateRange(time.Now(), args), nil
+	},
+	"timeRange": func(_ *jsRun, args []any) (any, error) {
+		return timeRange(time.Now(), args), nil
+	},
+	"alert": func(*jsRun, []any) (any, error) {
+		return nil, nil
+	},
+}
+
+func pacArg(args []any, i int) string {
+	if i < len(args) {
+		return jsToString(args[i])
+	}
+	return "undefined"
+}
+
+// pacResolve returns host's IPv4 address, resolving it when it isn't one
+func pacResolve(ctx context.Context, host string) (netip.Addr, bool) {
+	if ip, err := netip.ParseAddr(host); err == nil {
+		return ip, ip.Is4()
+	}
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	ips, err := net.DefaultResolver.LookupNetIP(ctx, "ip4", host)
+	if err != nil || len(ips) == 0 {
+		return netip.Addr{}, false
+	}
+	return ips[0].Unmap(), true
+}
+
+// myIPAddress returns the address of the interface that routes to the
+// internet. Connecting a UDP socket sends nothing.
+func myIPAddress() string {
+	conn, err := net.Dial("udp4", "198.51.100.1:80")
+	if err != nil {
+		return "127.0.0.1"
+	}
+	defer conn.Close()
+	return conn.LocalAddr().(*net.UDPAddr).IP.String()
+}
+
+// shExpMatch matches s against a shell expression where * matches any run
+// of characters and ? any one character
+func shExpMatch(s, pattern string) bool {
+	si, pi := 0, 0
+	star, mark := -1, 0
+	for si < len(s) {
+		switch {
+		case pi < len(pattern) && (pattern[pi] == '?' || pattern[pi] == s[si]):
+			si++
+			pi++
+		case pi < len(pattern) && pattern[pi] == '*':
+			star, mark = pi, si
+			pi++
+		case star >= 0:
+			pi = star + 1
+			mark++
+			si = mark
+		default:
+			return false
+		}
+	}
+	for pi < len(pattern) && pattern[pi] == '*' {
+		pi++
+	}
+	return pi == len(pattern)
+}
+
+// pacTimeArgs strips the optional trailing "GMT" of the time functions'
+// arguments and returns now in the zone it selects
+func pacTimeArgs(now time.Time, args []any) (time.Time, []any) {
+	if n := len(args); n > 0 && jsToString(args[n-1]) == "GMT" {
+		return now.UTC(), args[:n-1]
+	}
+	return now, args
+}
+
+var pacWeekdays = map[string]int{"SUN": 0, "MON": 1, "TUE": 2, "WED": 3, "THU": 4, "FRI": 5, "SAT": 6}
+
+var pacMonths = map[string]int{
+	"JAN": 1, "FEB": 2, "MAR": 3, "APR": 4, "MAY": 5, "JUN": 6,
+	"JUL": 7, "AUG": 8, "SEP": 9, "OCT": 10, "NOV": 11, "DEC": 12,
+}
+
+// pacInRange reports whether v lies in [from, to], wrapping around when
+// from is after to
+func pacInRange(v, from, to int) bool {
+	if from <= to {
+		return from <= v && v <= to
+	}
+	return v >= from || v <= to
+}
+
+// weekdayRange(wd1 [, wd2] [, "GMT"])
+func weekdayRange(now time.Time, args []any) bool {
+	now, args = pacTimeArgs(now, args)
+	if len(args) == 0 || len(args) > 2 {
+		return false
+	}
+	from, ok := pacWeekdays[jsToString(args[0])]
+	to := from
+	if len(args) == 2 {
+		var ok2 bool
+		to, ok2 = pacWeekdays[jsToString(args[1])]
+		ok = ok && ok2
+	}
+	return ok && pacInRange(int(now.Weekday()), from, to)
+}
+
+// dateRange takes a day (1-31), month ("JAN"-"DEC") or year, or a range of
+// them as two equally shaped halves, such as (1, "JAN", 15, "MAR"), and an
+// optional "GMT". Ranges are inclusive and may wrap around.
+func dateRange(now time.Time, args []any) bool {
+	now, args = pacTimeArgs(now, args)
+
+	// Each argument becomes a (kind, value) with kinds day 'd', month 'm'
+	// and year 'y'
+	kinds := make([]byte, len(args))
+	values := make([]int, len(args))
+	for i, a := range args {
+		if month, ok := pacMonths[jsToString(a)]; ok {
+			kinds[i], values[i] = 'm', month
+			continue
+		}
+		n := jsToNumber(a)
+		switch {
+		case n >= 1 && n <= 31:
+			kinds[i], values[i] = 'd', int(n)
+		case n > 31:
+			kinds[i], values[i] = 'y', int(n)
+		default:
+			return false
+		}
+	}
+	component := func(kind byte) int {
+		switch kind {
+		case 'd':
+			return now.Day()
+		case 'm':
+			return int(now.Month())
+		}
+		return now.Year()
+	}
+	// key orders a shape's components from year to day into one number
+	key := func(shape []byte, vals []int) int {
+		k := 0
+		for _, kind := range []byte("ymd") {
+			for i, s := range shape {
+				if s == kind {
+					k = k*10000 + vals[i]
+				}
+			}
+		}
+		return k
+	}
+
+	switch n := len(args); {
+	case n == 1:
+		return component(kinds[0]) == values[0]
+	case n == 0 || n%2 == 1 || n > 6:
+		return false
+	}
+	half := len(args) / 2
+	shape := kinds[:half]
+	if string(shape) != string(kinds[half:]) {
+		return false
+	}
+	current := make([]int, half)
+	for i, kind := range shape {
+		current[i] = component(kind)
+	}
+	from, to := key(shape, values[:half]), key(shape, values[half:])
+	return pacInRange(key(shape, current), from, to)
+}
+
+// timeRange(hour), (hour1, hour2), (h1, m1, h2, m2) or (h1, m1, s1, h2, m2,
+// s2), with an optional "GMT". Ranges include their start, not their end,
+// and may wrap around midnight.
+func timeRange(now time.Time, args []any) bool {
+	now, args = pacTimeArgs(now, args)
+	n := make([]int, len(args))
+	for i, a := range args {
+		v := jsToNumber(a)
+		if math.IsNaN(v) {
+			return false
+		}
+		n[i] = int(v)
+	}
+	at := now.Hour()*3600 + now.Minute()*60 + now.Second()
+	var from, to int
+	switch len(n) {
+	case 1:
+		return now.Hour() == n[0]
+	case 2:
+		from, to = n[0]*3600, n[1]*3600
+	case 4:
+		from, to = n[0]*3600+n[1]*60, n[2]*3600+n[3]*60
+	case 6:
+		from, to = n[0]*3600+n[1]*60+n[2], n[3]*3600+n[4]*60+n[5]
+	default:
+		return false
+	}
+	if from <= to {
+		return from <= at && at < to
+	}
+	return at >= from || at < to
+}
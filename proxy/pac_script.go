@@ -0,0 +1,1031 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// This file is the small JavaScript interpreter PAC files run on. It is
+// limited to the standard PAC function set: function declarations,
+// var/let/const, if/else, return, expressions over strings, numbers and
+// booleans, and calls to the standard PAC functions and the script's own
+// functions. Loops, objects, arrays, methods, property access and regular
+// expressions are rejected, so a script relying on them fails to parse
+// instead of being evaluated wrongly.
+
+const (
+	jsMaxSteps = 100000 // statements and calls per evaluation
+	jsMaxDepth = 64     // nested calls
+)
+
+var errJSSteps = errors.New("pac: script exceeded its evaluation budget")
+
+// jsNull is JavaScript's null; undefined is a nil any
+type jsNull struct{}
+
+// jsFunction is a function declared by the script
+type jsFunction struct {
+	decl  *jsFuncDecl
+	scope *jsEnv
+}
+
+// jsNative is a function implemented in Go
+type jsNative struct {
+	name string
+	fn   func(run *jsRun, args []any) (any, error)
+}
+
+type jsFuncDecl struct {
+	name   string
+	params []string
+	body   *jsBody
+}
+
+// jsBody is a script or function body: its function declarations, which
+// are hoisted, and its other statements
+type jsBody struct {
+	funcs []*jsFuncDecl
+	stmts []jsStmt
+}
+
+type jsExpr func(env *jsEnv) (any, error)
+
+// jsStmt executes a statement, reporting whether it returned and with what
+type jsStmt func(env *jsEnv) (returned bool, value any, err error)
+
+// jsRun is the state of one evaluation
+type jsRun struct {
+	ctx   context.Context
+	steps int
+	depth int
+}
+
+func (r *jsRun) step() error {
+	r.steps++
+	if r.steps > jsMaxSteps {
+		return errJSSteps
+	}
+	if r.steps%1000 == 0 {
+		return r.ctx.Err()
+	}
+	return nil
+}
+
+type jsEnv struct {
+	vars   map[string]any
+	parent *jsEnv
+	run    *jsRun
+}
+
+func (e *jsEnv) lookup(name string) (any, bool) {
+	for ; e != nil; e = e.parent {
+		if v, ok := e.vars[name]; ok {
+			return v, true
+		}
+	}
+	return nil, false
+}
+
+// assign sets an existing variable, or a global one as sloppy-mode
+// JavaScript does
+func (e *jsEnv) assign(name string, v any) {
+	for s := e; s != nil; s = s.parent {
+		if _, ok := s.vars[name]; ok {
+			s.vars[name] = v
+			return
+		}
+		if s.parent == nil {
+			s.vars[name] = v
+		}
+	}
+}
+
+// exec hoists the body's functions into e and runs its statements
+func (b *jsBody) exec(e *jsEnv) (bool, any, error) {
+	for _, fn := range b.funcs {
+		e.vars[fn.name] = &jsFunction{decl: fn, scope: e}
+	}
+	for _, stmt := range b.stmts {
+		if err := e.run.step(); err != nil {
+			return false, nil, err
+		}
+		returned, v, err := stmt(e)
+		if err != nil || returned {
+			return returned, v, err
+		}
+	}
+	return false, nil, nil
+}
+
+func jsCall(run *jsRun, callee any, name string, args []any) (any, error) {
+	if err := run.step(); err != nil {
+		return nil, err
+	}
+	switch fn := callee.(type) {
+	case *jsNative:
+		return fn.fn(run, args)
+	case *jsFunction:
+		if run.depth >= jsMaxDepth {
+			return nil, fmt.Errorf("pac: calls nested deeper than %d", jsMaxDepth)
+		}
+		run.depth++
+		defer func() { run.depth-- }()
+		env := &jsEnv{vars: make(map[string]any, len(fn.decl.params)), parent: fn.scope, run: run}
+		for i, param := range fn.decl.params {
+			var v any
+			if i < len(args) {
+				v = args[i]
+			}
+			env.vars[param] = v
+		}
+		_, v, err := fn.decl.body.exec(env)
+		return v, err
+	}
+	return nil, fmt.Errorf("pac: %s is not a function", name)
+}
+
+// Tokens
+
+type jsToken struct {
+	kind byte // 'i' identifier or keyword, 'n' number, 's' string, 'p' punctuation, 0 end
+	text string
+	num  float64
+	line int
+}
+
+var jsPunctuation = []string{
+	"===", "!==", "==", "!=", "<=", ">=", "&&", "||", "+=", "-=",
+	"{", "}", "(", ")", "[", "]", ";", ",", "<", ">", "+", "-", "*", "/", "%", "!", "=", "?", ":", ".",
+}
+
+func isJSIdentByte(c byte) bool {
+	return c == '_' || c == '$' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+func jsTokenize(src string) ([]jsToken, error) {
+	var toks []jsToken
+	line := 1
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == '\n':
+			line++
+			i++
+		case c == ' ' || c == '\t' || c == '\r' || c == '\f' || c == '\v':
+			i++
+		case strings.HasPrefix(src[i:], "\xef\xbb\xbf"): // BOM
+			i += 3
+		case strings.HasPrefix(src[i:], "//"):
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+		case strings.HasPrefix(src[i:], "/*"):
+			end := strings.Index(src[i+2:], "*/")
+			if end < 0 {
+				return nil, fmt.Errorf("pac: line %d: unterminated comment", line)
+			}
+			line += strings.Count(src[i:i+2+end], "\n")
+			i += end + 4
+		case c == '"' || c == '\'':
+			s, n, err := jsUnquote(src[i:])
+			if err != nil {
+				return nil, fmt.Errorf("pac: line %d: %w", line, err)
+			}
+			toks = append(toks, jsToken{kind: 's', text: s, line: line})
+			i += n
+		case c >= '0' && c <= '9' || c == '.' && i+1 < len(src) && src[i+1] >= '0' && src[i+1] <= '9':
+			j := i
+			for j < len(src) && (isJSIdentByte(src[j]) || src[j] == '.') {
+				j++
+			}
+			text := src[i:j]
+			var v float64
+			var err error
+			if len(text) > 2 && (text[:2] == "0x" || text[:2] == "0X") {
+				var u uint64
+				u, err = strconv.ParseUint(text[2:], 16, 64)
+				v = float64(u)
+			} else {
+				v, err = strconv.ParseFloat(text, 64)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("pac: line %d: invalid number %q", line, text)
+			}
+			toks = append(toks, jsToken{kind: 'n', text: text, num: v, line: line})
+			i = j
+		case isJSIdentByte(c):
+			j := i
+			for j < len(src) && isJSIdentByte(src[j]) {
+				j++
+			}
+			toks = append(toks, jsToken{kind: 'i', text: src[i:j], line: line})
+			i = j
+		default:
+			op := ""
+			for _, p := range jsPunctuation {
+				if strings.HasPrefix(src[i:], p) {
+					op = p
+					break
+				}
+			}
+			if op == "" {
+				return nil, fmt.Errorf("pac: line %d: unexpected character %q", line, c)
+			}
+			toks = append(toks, jsToken{kind: 'p', text: op, line: line})
+			i += len(op)
+		}
+	}
+	return append(toks, jsToken{line: line}), nil
+}
+
+// jsUnquote decodes the string literal at the start of s, returning it and
+// the number of bytes it took
+func jsUnquote(s string) (string, int, error) {
+	quote := s[0]
+	var b strings.Builder
+	for i := 1; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == quote:
+			return b.String(), i + 1, nil
+		case c == '\n':
+			return "", 0, errors.New("unterminated string")
+		case c != '\\':
+			b.WriteByte(c)
+			continue
+		}
+		i++
+		if i >= len(s) {
+			break
+		}
+		switch e := s[i]; e {
+		case 'n':
+			b.WriteByte('\n')
+		case 't':
+			b.WriteByte('\t')
+		case 'r':
+			b.WriteByte('\r')
+		case '0':
+			b.WriteByte(0)
+		case '\n':
+			// Line continuation
+		case 'x', 'u':
+			n := 2
+			if e == 'u' {
+				n = 4
+			}
+			if i+n >= len(s) {
+				return "", 0, errors.New("invalid escape")
+			}
+			r, err := strconv.ParseUint(s[i+1:i+1+n], 16, 32)
+			if err != nil {
+				return "", 0, errors.New("invalid escape")
+			}
+			b.WriteRune(rune(r))
+			i += n
+		default:
+			b.WriteByte(e)
+		}
+	}
+	return "", 0, errors.New("unterminated string")
+}
+
+// Parser
+
+type jsParser struct {
+	toks []jsToken
+	pos  int
+
+	// Functions the script declares and the calls it makes, so calls to
+	// anything but these and the standard PAC functions fail to parse
+	declared map[string]bool
+	calls    []jsToken
+}
+
+func jsParse(src string) (*jsBody, error) {
+	toks, err := jsTokenize(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &jsParser{toks: toks, declared: make(map[string]bool)}
+	body := &jsBody{}
+	for p.peek().kind != 0 {
+		if err := p.statement(body, &body.stmts); err != nil {
+			return nil, err
+		}
+	}
+	for _, call := range p.calls {
+		if _, ok := pacFunctions[call.text]; !ok && !p.declared[call.text] {
+			return nil, fmt.Errorf("pac: line %d: %s is not a standard PAC function", call.line, call.text)
+		}
+	}
+	return body, nil
+}
+
+func (p *jsParser) peek() jsToken { return p.toks[p.pos] }
+
+func (p *jsParser) next() jsToken {
+	t := p.toks[p.pos]
+	if t.kind != 0 {
+		p.pos++
+	}
+	return t
+}
+
+// is reports whether the next token is the punctuation or keyword text
+func (p *jsParser) is(text string) bool {
+	t := p.peek()
+	return (t.kind == 'p' || t.kind == 'i') && t.text == text
+}
+
+func (p *jsParser) accept(text string) bool {
+	if p.is(text) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *jsParser) errorf(format string, args ...any) error {
+	return fmt.Errorf("pac: line %d: %s", p.peek().line, fmt.Sprintf(format, args...))
+}
+
+func (p *jsParser) expect(text string) error {
+	if !p.accept(text) {
+		return p.errorf("expected %q, found %s", text, p.describe())
+	}
+	return nil
+}
+
+func (p *jsParser) describe() string {
+	t := p.peek()
+	switch t.kind {
+	case 0:
+		return "end of script"
+	case 's':
+		return strconv.Quote(t.text)
+	}
+	return "\"" + t.text + "\""
+}
+
+func (p *jsParser) ident() (string, error) {
+	t := p.peek()
+	if t.kind != 'i' || jsKeywords[t.text] {
+		return "", p.errorf("expected a name, found %s", p.describe())
+	}
+	p.pos++
+	return t.text, nil
+}
+
+var jsKeywords = map[string]bool{
+	"function": true, "var": true, "let": true, "const": true, "if": true, "else": true, "return": true,
+	"true": true, "false": true, "null": true, "undefined": true, "typeof": true,
+}
+
+// jsUnsupported are statements a PAC script may contain that the
+// interpreter doesn't run
+var jsUnsupported = map[string]bool{
+	"for": true, "while": true, "do": true, "switch": true, "try": true, "throw": true, "new": true,
+	"class": true, "with": true, "break": true, "continue": true, "delete": true, "in": true, "instanceof": true,
+}
+
+// statement parses one statement, adding function declarations to body and
+// anything else to stmts
+func (p *jsParser) statement(body *jsBody, stmts *[]jsStmt) error {
+	t := p.peek()
+	if t.kind == 'i' && jsUnsupported[t.text] {
+		return p.errorf("%q is not supported in PAC scripts", t.text)
+	}
+	switch {
+	case p.accept(";"):
+		return nil
+
+	case p.accept("function"):
+		name, err := p.ident()
+		if err != nil {
+			return err
+		}
+		decl, err := p.function(name)
+		if err != nil {
+			return err
+		}
+		p.declared[name] = true
+		body.funcs = append(body.funcs, decl)
+		return nil
+
+	case p.is("var") || p.is("let") || p.is("const"):
+		p.next()
+		for {
+			name, err := p.ident()
+			if err != nil {
+				return err
+			}
+			var init jsExpr
+			if p.accept("=") {
+				if init, err = p.assignment(); err != nil {
+					return err
+				}
+			}
+			*stmts = append(*stmts, func(env *jsEnv) (bool, any, error) {
+				if init == nil {
+					if _, ok := env.vars[name]; !ok {
+						env.vars[name] = nil
+					}
+					return false, nil, nil
+				}
+				v, err := init(env)
+				env.vars[name] = v
+				return false, nil, err
+			})
+			if !p.accept(",") {
+				break
+			}
+		}
+		p.accept(";")
+		return nil
+
+	case p.accept("if"):
+		if err := p.expect("("); err != nil {
+			return err
+		}
+		cond, err := p.expression()
+		if err != nil {
+			return err
+		}
+		if err := p.expect(")"); err != nil {
+			return err
+		}
+		var then, otherwise []jsStmt
+		if err := p.statement(body, &then); err != nil {
+			return err
+		}
+		if p.accept("else") {
+			if err := p.statement(body, &otherwise); err != nil {
+				return err
+			}
+		}
+		*stmts = append(*stmts, func(env *jsEnv) (bool, any, error) {
+			v, err := cond(env)
+			if err != nil {
+				return false, nil, err
+			}
+			if jsTruthy(v) {
+				return jsExecAll(env, then)
+			}
+			return jsExecAll(env, otherwise)
+		})
+		return nil
+
+	case p.accept("return"):
+		var value jsExpr
+		if !p.is(";") && !p.is("}") && p.peek().kind != 0 && p.peek().line == t.line {
+			var err error
+			if value, err = p.expression(); err != nil {
+				return err
+			}
+		}
+		p.accept(";")
+		*stmts = append(*stmts, func(env *jsEnv) (bool, any, error) {
+			if value == nil {
+				return true, nil, nil
+			}
+			v, err := value(env)
+			return true, v, err
+		})
+		return nil
+
+	case p.accept("{"):
+		var block []jsStmt
+		for !p.accept("}") {
+			if p.peek().kind == 0 {
+				return p.errorf("expected \"}\", found end of script")
+			}
+			if err := p.statement(body, &block); err != nil {
+				return err
+			}
+		}
+		*stmts = append(*stmts, func(env *jsEnv) (bool, any, error) {
+			return jsExecAll(env, block)
+		})
+		return nil
+	}
+
+	expr, err := p.expression()
+	if err != nil {
+		return err
+	}
+	p.accept(";")
+	*stmts = append(*stmts, func(env *jsEnv) (bool, any, error) {
+		_, err := expr(env)
+		return false, nil, err
+	})
+	return nil
+}
+
+func jsExecAll(env *jsEnv, stmts []jsStmt) (bool, any, error) {
+	for _, stmt := range stmts {
+		if err := env.run.step(); err != nil {
+			return false, nil, err
+		}
+		if returned, v, err := stmt(env); err != nil || returned {
+			return returned, v, err
+		}
+	}
+	return false, nil, nil
+}
+
+// function parses a function's parameters and body
+func (p *jsParser) function(name string) (*jsFuncDecl, error) {
+	decl := &jsFuncDecl{name: name, body: &jsBody{}}
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	for !p.accept(")") {
+		param, err := p.ident()
+		if err != nil {
+			return nil, err
+		}
+		decl.params = append(decl.params, param)
+		if !p.is(")") {
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+	for !p.accept("}") {
+		if p.peek().kind == 0 {
+			return nil, p.errorf("expected \"}\", found end of script")
+		}
+		if err := p.statement(decl.body, &decl.body.stmts); err != nil {
+			return nil, err
+		}
+	}
+	return decl, nil
+}
+
+func (p *jsParser) expression() (jsExpr, error) {
+	expr, err := p.assignment()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept(",") {
+		left := expr
+		right, err := p.assignment()
+		if err != nil {
+			return nil, err
+		}
+		expr = func(env *jsEnv) (any, error) {
+			if _, err := left(env); err != nil {
+				return nil, err
+			}
+			return right(env)
+		}
+	}
+	return expr, nil
+}
+
+func (p *jsParser) assignment() (jsExpr, error) {
+	t, op := p.peek(), p.toks[min(p.pos+1, len(p.toks)-1)]
+	if t.kind == 'i' && !jsKeywords[t.text] && op.kind == 'p' && (op.text == "=" || op.text == "+=" || op.text == "-=") {
+		p.pos += 2
+		value, err := p.assignment()
+		if err != nil {
+			return nil, err
+		}
+		name := t.text
+		return func(env *jsEnv) (any, error) {
+			v, err := value(env)
+			if err != nil {
+				return nil, err
+			}
+			if op.text != "=" {
+				old, ok := env.lookup(name)
+				if !ok {
+					return nil, fmt.Errorf("pac: %s is not defined", name)
+				}
+				if op.text == "+=" {
+					v = jsAdd(old, v)
+				} else {
+					v = jsToNumber(old) - jsToNumber(v)
+				}
+			}
+			env.assign(name, v)
+			return v, nil
+		}, nil
+	}
+	return p.conditional()
+}
+
+func (p *jsParser) conditional() (jsExpr, error) {
+	cond, err := p.logical("||")
+	if err != nil || !p.accept("?") {
+		return cond, err
+	}
+	then, err := p.assignment()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect(":"); err != nil {
+		return nil, err
+	}
+	otherwise, err := p.assignment()
+	if err != nil {
+		return nil, err
+	}
+	return func(env *jsEnv) (any, error) {
+		v, err := cond(env)
+		if err != nil {
+			return nil, err
+		}
+		if jsTruthy(v) {
+			return then(env)
+		}
+		return otherwise(env)
+	}, nil
+}
+
+// logical parses || (and through it &&), which yield the deciding operand
+func (p *jsParser) logical(op string) (jsExpr, error) {
+	operand := p.equality
+	if op == "||" {
+		operand = func() (jsExpr, error) { return p.logical("&&") }
+	}
+	left, err := operand()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept(op) {
+		l := left
+		right, err := operand()
+		if err != nil {
+			return nil, err
+		}
+		or := op == "||"
+		left = func(env *jsEnv) (any, error) {
+			v, err := l(env)
+			if err != nil || jsTruthy(v) == or {
+				return v, err
+			}
+			return right(env)
+		}
+	}
+	return left, nil
+}
+
+// binary parses a left-associative level of binary operators
+func (p *jsParser) binary(operand func() (jsExpr, error), ops map[string]func(a, b any) any) (jsExpr, error) {
+	left, err := operand()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t := p.peek()
+		apply, ok := ops[t.text]
+		if t.kind != 'p' || !ok {
+			return left, nil
+		}
+		p.next()
+		l := left
+		right, err := operand()
+		if err != nil {
+			return nil, err
+		}
+		left = func(env *jsEnv) (any, error) {
+			a, err := l(env)
+			if err != nil {
+				return nil, err
+			}
+			b, err := right(env)
+			if err != nil {
+				return nil, err
+			}
+			return apply(a, b), nil
+		}
+	}
+}
+
+var (
+	jsEqualityOps = map[string]func(a, b any) any{
+		"==":  func(a, b any) any { return jsLooseEquals(a, b) },
+		"!=":  func(a, b any) any { return !jsLooseEquals(a, b) },
+		"===": func(a, b any) any { return jsStrictEquals(a, b) },
+		"!==": func(a, b any) any { return !jsStrictEquals(a, b) },
+	}
+	jsRelationalOps = map[string]func(a, b any) any{
+		"<":  func(a, b any) any { return jsCompare(a, b, func(c int) bool { return c < 0 }) },
+		">":  func(a, b any) any { return jsCompare(a, b, func(c int) bool { return c > 0 }) },
+		"<=": func(a, b any) any { return jsCompare(a, b, func(c int) bool { return c <= 0 }) },
+		">=": func(a, b any) any { return jsCompare(a, b, func(c int) bool { return c >= 0 }) },
+	}
+	jsAdditiveOps = map[string]func(a, b any) any{
+		"+": jsAdd,
+		"-": func(a, b any) any { return jsToNumber(a) - jsToNumber(b) },
+	}
+	jsMultiplicativeOps = map[string]func(a, b any) any{
+		"*": func(a, b any) any { return jsToNumber(a) * jsToNumber(b) },
+		"/": func(a, b any) any { return jsToNumber(a) / jsToNumber(b) },
+		"%": func(a, b any) any { return math.Mod(jsToNumber(a), jsToNumber(b)) },
+	}
+)
+
+func (p *jsParser) equality() (jsExpr, error) {
+	return p.binary(p.relational, jsEqualityOps)
+}
+
+func (p *jsParser) relational() (jsExpr, error) {
+	return p.binary(p.additive, jsRelationalOps)
+}
+
+func (p *jsParser) additive() (jsExpr, error) {
+	return p.binary(p.multiplicative, jsAdditiveOps)
+}
+
+func (p *jsParser) multiplicative() (jsExpr, error) {
+	return p.binary(p.unary, jsMultiplicativeOps)
+}
+
+func (p *jsParser) unary() (jsExpr, error) {
+	var apply func(any) any
+	switch {
+	case p.accept("!"):
+		apply = func(v any) any { return !jsTruthy(v) }
+	case p.accept("-"):
+		apply = func(v any) any { return -jsToNumber(v) }
+	case p.accept("+"):
+		apply = func(v any) any { return jsToNumber(v) }
+	case p.accept("typeof"):
+		apply = func(v any) any { return jsTypeof(v) }
+	default:
+		return p.postfix()
+	}
+	operand, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	return func(env *jsEnv) (any, error) {
+		v, err := operand(env)
+		if err != nil {
+			return nil, err
+		}
+		return apply(v), nil
+	}, nil
+}
+
+// postfix parses a call. Only named functions can be called: the standard
+// PAC functions and the script's own, checked once parsing is done. Property
+// access, methods and indexing are rejected.
+func (p *jsParser) postfix() (jsExpr, error) {
+	t := p.peek()
+	expr, err := p.primary()
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case p.is("(") && t.kind == 'i':
+		p.next()
+		p.calls = append(p.calls, t)
+		args, err := p.arguments()
+		if err != nil {
+			return nil, err
+		}
+		callee := expr
+		expr = func(env *jsEnv) (any, error) {
+			fn, err := callee(env)
+			if err != nil {
+				return nil, err
+			}
+			values, err := jsEvalAll(env, args)
+			if err != nil {
+				return nil, err
+			}
+			return jsCall(env.run, fn, t.text, values)
+		}
+	case p.is("("):
+		return nil, p.errorf("only named functions can be called")
+	}
+	if p.is("(") || p.is(".") || p.is("[") {
+		return nil, p.errorf("%s is not supported: PAC scripts may only call the standard PAC functions and their own", p.describe())
+	}
+	return expr, nil
+}
+
+func (p *jsParser) arguments() ([]jsExpr, error) {
+	var args []jsExpr
+	for !p.accept(")") {
+		arg, err := p.assignment()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+		if !p.is(")") {
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return args, nil
+}
+
+func jsEvalAll(env *jsEnv, exprs []jsExpr) ([]any, error) {
+	values := make([]any, len(exprs))
+	for i, expr := range exprs {
+		v, err := expr(env)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = v
+	}
+	return values, nil
+}
+
+func (p *jsParser) primary() (jsExpr, error) {
+	t := p.peek()
+	switch t.kind {
+	case 'n':
+		p.pos++
+		return func(*jsEnv) (any, error) { return t.num, nil }, nil
+	case 's':
+		p.pos++
+		return func(*jsEnv) (any, error) { return t.text, nil }, nil
+	case 'i':
+		var constant any
+		switch t.text {
+		case "true":
+			constant = true
+		case "false":
+			constant = false
+		case "null":
+			constant = jsNull{}
+		case "undefined":
+		default:
+			if jsKeywords[t.text] || jsUnsupported[t.text] {
+				return nil, p.errorf("%q is not supported in an expression", t.text)
+			}
+			p.pos++
+			return func(env *jsEnv) (any, error) {
+				v, ok := env.lookup(t.text)
+				if !ok {
+					return nil, fmt.Errorf("pac: %s is not defined", t.text)
+				}
+				return v, nil
+			}, nil
+		}
+		p.pos++
+		return func(*jsEnv) (any, error) { return constant, nil }, nil
+	}
+	if p.accept("(") {
+		expr, err := p.expression()
+		if err != nil {
+			return nil, err
+		}
+		return expr, p.expect(")")
+	}
+	return nil, p.errorf("unexpected %s", p.describe())
+}
+
+// Values
+
+func jsTruthy(v any) bool {
+	switch v := v.(type) {
+	case nil, jsNull:
+		return false
+	case bool:
+		return v
+	case float64:
+		return v != 0 && !math.IsNaN(v)
+	case string:
+		return v != ""
+	}
+	return true
+}
+
+func jsTypeof(v any) string {
+	switch v.(type) {
+	case nil:
+		return "undefined"
+	case jsNull:
+		return "object"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	}
+	return "function"
+}
+
+func jsToString(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return "undefined"
+	case jsNull:
+		return "null"
+	case bool:
+		return strconv.FormatBool(v)
+	case float64:
+		switch {
+		case math.IsNaN(v):
+			return "NaN"
+		case math.IsInf(v, 1):
+			return "Infinity"
+		case math.IsInf(v, -1):
+			return "-Infinity"
+		case v == math.Trunc(v) && math.Abs(v) < 1e21:
+			return strconv.FormatFloat(v, 'f', -1, 64)
+		}
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	case string:
+		return v
+	case *jsFunction:
+		return "function " + v.decl.name + "() {}"
+	case *jsNative:
+		return "function " + v.name + "() { [native code] }"
+	}
+	return ""
+}
+
+func jsToNumber(v any) float64 {
+	switch v := v.(type) {
+	case jsNull:
+		return 0
+	case bool:
+		if v {
+			return 1
+		}
+		return 0
+	case float64:
+		return v
+	case string:
+		s := strings.TrimSpace(v)
+		if s == "" {
+			return 0
+		}
+		if len(s) > 2 && (s[:2] == "0x" || s[:2] == "0X") {
+			if u, err := strconv.ParseUint(s[2:], 16, 64); err == nil {
+				return float64(u)
+			}
+			return math.NaN()
+		}
+		if f, err := strconv.ParseFloat(s, 64); err == nil && !strings.ContainsAny(s, "_xXpP") {
+			return f
+		}
+	}
+	return math.NaN()
+}
+
+func jsAdd(a, b any) any {
+	_, as := a.(string)
+	_, bs := b.(string)
+	if as || bs {
+		return jsToString(a) + jsToString(b)
+	}
+	return jsToNumber(a) + jsToNumber(b)
+}
+
+func jsStrictEquals(a, b any) bool {
+	if x, ok := a.(float64); ok {
+		y, ok := b.(float64)
+		return ok && x == y
+	}
+	return a == b
+}
+
+func jsLooseEquals(a, b any) bool {
+	nullish := func(v any) bool { return v == nil || v == jsNull{} }
+	if nullish(a) || nullish(b) {
+		return nullish(a) && nullish(b)
+	}
+	if jsTypeof(a) == jsTypeof(b) {
+		return jsStrictEquals(a, b)
+	}
+	if jsTypeof(a) == "function" || jsTypeof(b) == "function" {
+		return false
+	}
+	return jsToNumber(a) == jsToNumber(b)
+}
+
+func jsCompare(a, b any, ok func(int) bool) bool {
+	if x, isString := a.(string); isString {
+		if y, isString := b.(string); isString {
+			return ok(strings.Compare(x, y))
+		}
+	}
+	x, y := jsToNumber(a), jsToNumber(b)
+	switch {
+	case math.IsNaN(x) || math.IsNaN(y):
+		return false
+	case x < y:
+		return ok(-1)
+	case x > y:
+		return ok(1)
+	}
+	return ok(0)
+}
@@ -0,0 +1,206 @@
+package proxy
+
+import (
+	"context"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPAC(t *testing.T) {
+	pac, err := ParsePAC(`
+		// Corporate PAC file
+		var corp = "proxy.corp.example:8080";
+
+		function isInternal(host) {
+			return isPlainHostName(host) || dnsDomainIs(host, ".corp.example") ||
+				isInNet(host, "10.0.0.0", "255.0.0.0");
+		}
+
+		function FindProxyForURL(url, host) {
+			if (isInternal(host))
+				return "DIRECT";
+			if (shExpMatch(url, "http:*") && shExpMatch(host, "*.example.org"))
+				return "PROXY " + corp + "; DIRECT";
+			if (shExpMatch(host, "socks.*")) {
+				return "SOCKS5 socks.corp.example:1080";
+			}
+			var parts = dnsDomainLevels(host) > 2 ? "deep" : "shallow";
+			return parts == "deep" ? "HTTPS secure.corp.example:443" : "PROXY " + corp;
+		}
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		url  string
+		want []string
+	}{
+		{"http://intranet/", []string{""}},
+		{"https://wiki.corp.example/page", []string{""}},
+		{"http://10.1.2.3/", []string{""}},
+		{"http://www.example.org/", []string{"http://proxy.corp.example:8080", ""}},
+		{"https://www.sub.example.org/", []string{"https://secure.corp.example:443"}},
+		{"http://socks.example.com/", []string{"socks5://socks.corp.example:1080"}},
+		{"http://example.com/", []string{"http://proxy.corp.example:8080"}},
+	}
+	for _, tt := range tests {
+		u, _ := url.Parse(tt.url)
+		got, err := pac.Select(context.Background(), u)
+		if err != nil {
+			t.Errorf("%s: %v", tt.url, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: proxies = %q, want %q", tt.url, got, tt.want)
+		}
+	}
+
+	// https URLs reach the script without path and query
+	echo, err := ParsePAC(`function FindProxyForURL(url, host) { return "PROXY " + url; }`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := echo.FindProxyForURL(context.Background(), "https://example.com/secret?token=1"); got != "PROXY https://example.com/" {
+		t.Errorf("https URL passed as %q", got)
+	}
+}
+
+func TestParsePACErrors(t *testing.T) {
+	for _, script := range []string{
+		`function f() { return "DIRECT"; }`,
+		`function FindProxyForURL(url, host) { for (;;) {} }`,
+		// Only the standard PAC functions and the script's own can be called
+		`function FindProxyForURL(url, host) { return host.toLowerCase(); }`,
+		`function FindProxyForURL(url, host) { return url.length > 5 ? "DIRECT" : ""; }`,
+		`function FindProxyForURL(url, host) { return host[0]; }`,
+		`function FindProxyForURL(url, host) { return eval("DIRECT"); }`,
+		`function FindProxyForURL(url, host) { if (false) return fetchProxy(host); return "DIRECT"; }`,
+		`function FindProxyForURL(url, host) { return (dnsResolve)(host); }`,
+		`function FindProxyForURL(url, host) { return "DIRECT"`,
+		`function FindProxyForURL(url, host) { return 'DIRECT; }`,
+	} {
+		if _, err := ParsePAC(script); err == nil {
+			t.Errorf("ParsePAC(%q) succeeded", script)
+		}
+	}
+
+	// Runaway recursion is stopped
+	pac, err := ParsePAC(`function FindProxyForURL(url, host) { return FindProxyForURL(url, host); }`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pac.FindProxyForURL(context.Background(), "http://example.com/"); err == nil {
+		t.Error("unbounded recursion did not fail")
+	}
+}
+
+func TestPACTimeFunctions(t *testing.T) {
+	// Wednesday 2025-03-12 14:30:00 UTC
+	now := time.Date(2025, time.March, 12, 14, 30, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		fn   func(time.Time, []any) bool
+		args []any
+		want bool
+	}{
+		{"weekday", weekdayRange, []any{"WED"}, true},
+		{"weekday range", weekdayRange, []any{"MON", "FRI", "GMT"}, true},
+		{"weekday wrap", weekdayRange, []any{"SAT", "TUE"}, false},
+		{"day", dateRange, []any{12.0}, true},
+		{"month range", dateRange, []any{"JAN", "MAR"}, true},
+		{"month wrap", dateRange, []any{"NOV", "FEB"}, false},
+		{"day month range", dateRange, []any{1.0, "MAR", 11.0, "MAR"}, false},
+		{"year", dateRange, []any{2025.0}, true},
+		{"hour", timeRange, []any{14.0}, true},
+		{"hour range", timeRange, []any{9.0, 17.0}, true},
+		{"minute range", timeRange, []any{14.0, 31.0, 17.0, 0.0, "GMT"}, false},
+		{"overnight", timeRange, []any{22.0, 6.0}, false},
+	}
+	for _, tt := range tests {
+		if got := tt.fn(now, tt.args); got != tt.want {
+			t.Errorf("%s%v = %v, want %v", tt.name, tt.args, got, tt.want)
+		}
+	}
+}
+
+func TestParseProxyList(t *testing.T) {
+	got, err := ParseProxyList("PROXY a:1; SOCKS4 b:2;; HTTPS c:3 ; direct")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"http://a:1", "https://c:3", ""}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseProxyList = %q, want %q", got, want)
+	}
+	if _, err := ParseProxyList("SOCKS4 b:2"); err == nil {
+		t.Error("expected an error for a list without usable proxies")
+	}
+}
+
+func TestSystemSettings(t *testing.T) {
+	windows := &SystemSettings{}
+	windows.parseWindowsProxy("http=proxy:80;https=proxy:443;socks=socks:1080", "*.corp.example;10.*;<local>")
+	if windows.HTTP != "http://proxy:80" || windows.HTTPS != "http://proxy:443" || windows.SOCKS != "socks5://socks:1080" {
+		t.Errorf("Windows proxies = %+v", windows)
+	}
+
+	mac := parseScutilProxy(`<dictionary> {
+  ExceptionsList : <array> {
+    0 : *.local
+    1 : 169.254/16
+  }
+  ExcludeSimpleHostnames : 1
+  HTTPEnable : 1
+  HTTPPort : 3128
+  HTTPProxy : proxy.example.com
+  HTTPSEnable : 0
+  ProxyAutoConfigEnable : 1
+  ProxyAutoConfigURLString : http://config.example.com/proxy.pac
+}`)
+	want := &SystemSettings{
+		HTTP:          "http://proxy.example.com:3128",
+		Bypass:        []string{"*.local", "169.254/16", "<local>"},
+		AutoConfigURL: "http://config.example.com/proxy.pac",
+	}
+	if !reflect.DeepEqual(mac, want) {
+		t.Errorf("scutil settings = %+v, want %+v", mac, want)
+	}
+
+	gsettings := map[string]string{
+		"org.gnome.system.proxy mode":         "'manual'",
+		"org.gnome.system.proxy ignore-hosts": "['localhost', '127.0.0.0/8', '*.corp.example']",
+		"org.gnome.system.proxy.http host":    "'proxy.example.com'",
+		"org.gnome.system.proxy.http port":    "8080",
+		"org.gnome.system.proxy.https port":   "0",
+	}
+	gnome, ok := parseGNOMEProxy(func(schema, key string) string { return gsettings[schema+" "+key] })
+	if !ok || gnome.HTTP != "http://proxy.example.com:8080" || gnome.HTTPS != "" || len(gnome.Bypass) != 3 {
+		t.Errorf("GNOME settings = %+v", gnome)
+	}
+
+	tests := []struct {
+		host string
+		want string
+	}{
+		{"www.example.com", "http://proxy:80"},
+		{"app.corp.example", ""},
+		{"10.20.30.40", ""},
+		{"intranet", ""},
+		{"localhost", ""},
+	}
+	for _, tt := range tests {
+		got := windows.manual(&url.URL{Scheme: "http", Host: tt.host})
+		if len(got) != 1 || got[0] != tt.want {
+			t.Errorf("%s: proxies = %q, want %q", tt.host, got, tt.want)
+		}
+	}
+	if !bypassed("169.254.1.1", mac.Bypass) || bypassed("169.255.1.1", mac.Bypass) {
+		t.Error("shortened CIDR not matched")
+	}
+	if got := strings.Join(wpadCandidates("a.b.corp.example"), " "); got != "a.b.corp.example b.corp.example corp.example" {
+		t.Errorf("WPAD domains = %s", got)
+	}
+}
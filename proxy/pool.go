@@ -0,0 +1,381 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrNoProxy is returned by Pool.Next when the pool is empty or every proxy
+// in it is quarantined
+var ErrNoProxy = errors.New("proxy pool: no proxy available")
+
+// Strategy selects the next proxy from a Pool
+type Strategy int
+
+const (
+	// RoundRobin cycles through the proxies in the order they were added
+	RoundRobin Strategy = iota
+	// StickyPerHost sends every request for a host through the same proxy
+	// until that proxy is quarantined or removed, then moves the host to the
+	// next one, so a site sees one IP per session
+	StickyPerHost
+	// Random picks a proxy uniformly at random
+	Random
+)
+
+// PoolOptions configures a Pool
+type PoolOptions struct {
+	Strategy Strategy
+
+	// MaxFailures is the number of consecutive failures or block pages after
+	// which a proxy is quarantined. Default 3.
+	MaxFailures int
+
+	// Quarantine is how long a quarantined proxy is skipped before it gets
+	// traffic again. Default 1 minute.
+	Quarantine time.Duration
+
+	// Blocked reports a response that is a block page, counted against the
+	// proxy that received it. Nil uses DefaultBlocked.
+	Blocked func(statusCode int, headers map[string][]string) bool
+}
+
+// ProxyStats are the counters of one proxy in a Pool
+type ProxyStats struct {
+	URL              string // Without credentials
+	Successes        int64
+	Failures         int64 // Connection-level failures, including health checks
+	Blocks           int64 // Block pages
+	Quarantined      bool
+	QuarantinedUntil time.Time
+	AvgLatency       time.Duration // Of successful requests
+	LastError        string
+}
+
+// SuccessRate returns the share of successful requests, 0 before the first
+func (s ProxyStats) SuccessRate() float64 {
+	total := s.Successes + s.Failures + s.Blocks
+	if total == 0 {
+		return 0
+	}
+	return float64(s.Successes) / float64(total)
+}
+
+// Pool rotates requests across proxies and keeps failing or blocked ones
+// out of rotation for a while. Sessions take one with WithProxyPool; code
+// that dials on its own reports results with ReportSuccess, ReportFailure
+// and ReportBlocked. All methods are safe for concurrent use.
+type Pool struct {
+	opts PoolOptions
+
+	mu      sync.Mutex
+	proxies []*poolProxy
+	next    int
+	sticky  map[string]*poolProxy
+}
+
+type poolProxy struct {
+	url              string
+	label            string
+	successes        int64
+	failures         int64
+	blocks           int64
+	consecutive      int
+	quarantinedUntil time.Time
+	latencyTotal     time.Duration
+	lastErr          string
+}
+
+// NewPool creates a pool of the given proxy URLs (http, https, socks5 or
+// socks5h). Duplicates are ignored.
+func NewPool(proxyURLs []string, opts PoolOptions) (*Pool, error) {
+	if opts.MaxFailures <= 0 {
+		opts.MaxFailures = 3
+	}
+	if opts.Quarantine <= 0 {
+		opts.Quarantine = time.Minute
+	}
+	if opts.Blocked == nil {
+		opts.Blocked = DefaultBlocked
+	}
+	p := &Pool{opts: opts, sticky: make(map[string]*poolProxy)}
+	for _, u := range proxyURLs {
+		if err := p.Add(u); err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+// Add puts a proxy into rotation
+func (p *Pool) Add(proxyURL string) error {
+	u, err := url.Parse(proxyURL)
+	if err != nil {
+		return fmt.Errorf("proxy pool: invalid proxy URL: %w", err)
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return fmt.Errorf("proxy pool: unsupported proxy scheme %q", u.Scheme)
+	}
+	if u.Host == "" {
+		return fmt.Errorf("proxy pool: proxy URL %q has no host", proxyURL)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.find(proxyURL) == nil {
+		p.proxies = append(p.proxies, &poolProxy{url: proxyURL, label: u.Scheme + "://" + u.Host})
+	}
+	return nil
+}
+
+// Remove takes a proxy out of the pool, reporting whether it was there
+func (p *Pool) Remove(proxyURL string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for i, pp := range p.proxies {
+		if pp.url != proxyURL {
+			continue
+		}
+		p.proxies = append(p.proxies[:i], p.proxies[i+1:]...)
+		for host, sp := range p.sticky {
+			if sp == pp {
+				delete(p.sticky, host)
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// Len returns the number of proxies in the pool, quarantined ones included
+func (p *Pool) Len() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.proxies)
+}
+
+// Next returns the proxy URL for a request to host, skipping quarantined
+// proxies. It returns ErrNoProxy when none is available.
+func (p *Pool) Next(host string) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	host = strings.ToLower(host)
+	if p.opts.Strategy == StickyPerHost {
+		if pp, ok := p.sticky[host]; ok && pp.available(now) {
+			return pp.url, nil
+		}
+	}
+
+	var pp *poolProxy
+	switch p.opts.Strategy {
+	case Random:
+		var available []*poolProxy
+		for _, c := range p.proxies {
+			if c.available(now) {
+				available = append(available, c)
+			}
+		}
+		if len(available) > 0 {
+			pp = available[rand.IntN(len(available))]
+		}
+	default:
+		for range p.proxies {
+			c := p.proxies[p.next%len(p.proxies)]
+			p.next = (p.next + 1) % len(p.proxies)
+			if c.available(now) {
+				pp = c
+				break
+			}
+		}
+	}
+	if pp == nil {
+		return "", ErrNoProxy
+	}
+	if p.opts.Strategy == StickyPerHost {
+		p.sticky[host] = pp
+	}
+	return pp.url, nil
+}
+
+// available reports whether the proxy is out of quarantine. Caller holds p.mu.
+func (pp *poolProxy) available(now time.Time) bool {
+	return !now.Before(pp.quarantinedUntil)
+}
+
+// find returns the proxy with the given URL, nil if it isn't in the pool.
+// Caller holds p.mu.
+func (p *Pool) find(proxyURL string) *poolProxy {
+	for _, pp := range p.proxies {
+		if pp.url == proxyURL {
+			return pp
+		}
+	}
+	return nil
+}
+
+// ReportSuccess records a request served through the proxy
+func (p *Pool) ReportSuccess(proxyURL string, latency time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if pp := p.find(proxyURL); pp != nil {
+		pp.successes++
+		pp.consecutive = 0
+		pp.latencyTotal += latency
+	}
+}
+
+// ReportFailure records a connection-level failure of the proxy
+func (p *Pool) ReportFailure(proxyURL string, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if pp := p.find(proxyURL); pp != nil {
+		pp.failures++
+		if err != nil {
+			pp.lastErr = err.Error()
+		}
+		p.strike(pp)
+	}
+}
+
+// ReportBlocked records a block page received through the proxy
+func (p *Pool) ReportBlocked(proxyURL string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if pp := p.find(proxyURL); pp != nil {
+		pp.blocks++
+		pp.lastErr = "blocked"
+		p.strike(pp)
+	}
+}
+
+// strike counts a failure or block, quarantining the proxy once it has
+// MaxFailures in a row. Caller holds p.mu.
+func (p *Pool) strike(pp *poolProxy) {
+	pp.consecutive++
+	if pp.consecutive >= p.opts.MaxFailures {
+		pp.consecutive = 0
+		pp.quarantinedUntil = time.Now().Add(p.opts.Quarantine)
+	}
+}
+
+// IsBlocked reports whether a response is a block page per PoolOptions.Blocked
+func (p *Pool) IsBlocked(statusCode int, headers map[string][]string) bool {
+	return p.opts.Blocked(statusCode, headers)
+}
+
+// Release takes a proxy out of quarantine
+func (p *Pool) Release(proxyURL string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if pp := p.find(proxyURL); pp != nil {
+		pp.quarantinedUntil = time.Time{}
+		pp.consecutive = 0
+	}
+}
+
+// Stats returns the counters of every proxy, in the order they were added
+func (p *Pool) Stats() []ProxyStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	stats := make([]ProxyStats, 0, len(p.proxies))
+	for _, pp := range p.proxies {
+		s := ProxyStats{
+			URL:         pp.label,
+			Successes:   pp.successes,
+			Failures:    pp.failures,
+			Blocks:      pp.blocks,
+			Quarantined: !pp.available(now),
+			LastError:   pp.lastErr,
+		}
+		if s.Quarantined {
+			s.QuarantinedUntil = pp.quarantinedUntil
+		}
+		if pp.successes > 0 {
+			s.AvgLatency = pp.latencyTotal / time.Duration(pp.successes)
+		}
+		stats = append(stats, s)
+	}
+	return stats
+}
+
+// Check runs a health check against every proxy: a proxy that fails it is
+// quarantined at once, one that passes is released from quarantine. check
+// typically sends a small request through the proxy.
+func (p *Pool) Check(ctx context.Context, check func(ctx context.Context, proxyURL string) error) {
+	p.mu.Lock()
+	urls := make([]string, len(p.proxies))
+	for i, pp := range p.proxies {
+		urls[i] = pp.url
+	}
+	p.mu.Unlock()
+
+	for _, u := range urls {
+		if ctx.Err() != nil {
+			return
+		}
+		err := check(ctx, u)
+		p.mu.Lock()
+		if pp := p.find(u); pp != nil {
+			if err != nil {
+				pp.failures++
+				pp.lastErr = err.Error()
+				pp.consecutive = 0
+				pp.quarantinedUntil = time.Now().Add(p.opts.Quarantine)
+			} else {
+				pp.consecutive = 0
+				pp.quarantinedUntil = time.Time{}
+			}
+		}
+		p.mu.Unlock()
+	}
+}
+
+// Watch runs Check every interval until ctx is done
+func (p *Pool) Watch(ctx context.Context, interval time.Duration, check func(ctx context.Context, proxyURL string) error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			p.Check(ctx, check)
+		}
+	}
+}
+
+// DefaultBlocked recognizes block pages by status and headers: 429 responses
+// and the challenge markers of Cloudflare, AWS WAF and DataDome
+func DefaultBlocked(statusCode int, headers map[string][]string) bool {
+	value := func(name string) string {
+		for key, values := range headers {
+			if strings.EqualFold(key, name) && len(values) > 0 {
+				return strings.ToLower(values[0])
+			}
+		}
+		return ""
+	}
+	switch {
+	case statusCode == 429:
+		return true
+	case value("cf-mitigated") == "challenge":
+		return true
+	case value("x-amzn-waf-action") == "challenge" || value("x-amzn-waf-action") == "captcha":
+		return true
+	case statusCode == 403 && value("x-datadome") != "":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,95 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestPoolStrategies(t *testing.T) {
+	urls := []string{"http://a:1", "http://b:1", "http://c:1"}
+
+	rr, err := NewPool(urls, PoolOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 6; i++ {
+		if got, _ := rr.Next("example.com"); got != urls[i%3] {
+			t.Errorf("round robin pick %d = %s, want %s", i, got, urls[i%3])
+		}
+	}
+
+	sticky, _ := NewPool(urls, PoolOptions{Strategy: StickyPerHost, MaxFailures: 1})
+	first, _ := sticky.Next("example.com")
+	other, _ := sticky.Next("example.org")
+	if first == other {
+		t.Error("two hosts were given the same proxy")
+	}
+	if again, _ := sticky.Next("EXAMPLE.com"); again != first {
+		t.Errorf("sticky proxy changed from %s to %s", first, again)
+	}
+	sticky.ReportFailure(first, errors.New("refused"))
+	if moved, _ := sticky.Next("example.com"); moved == first {
+		t.Error("host stayed on a quarantined proxy")
+	}
+
+	random, _ := NewPool(urls, PoolOptions{Strategy: Random, MaxFailures: 1})
+	random.ReportBlocked("http://a:1")
+	random.ReportBlocked("http://b:1")
+	for i := 0; i < 10; i++ {
+		if got, _ := random.Next("example.com"); got != "http://c:1" {
+			t.Fatalf("random picked quarantined %s", got)
+		}
+	}
+
+	if _, err := NewPool([]string{"ftp://x:1"}, PoolOptions{}); err == nil {
+		t.Error("unsupported scheme accepted")
+	}
+}
+
+func TestPoolQuarantine(t *testing.T) {
+	pool, _ := NewPool([]string{"http://user:secret@a:1"}, PoolOptions{})
+	const u = "http://user:secret@a:1"
+
+	// A success in between resets the run of failures
+	pool.ReportFailure(u, errors.New("refused"))
+	pool.ReportFailure(u, errors.New("refused"))
+	pool.ReportSuccess(u, 0)
+	pool.ReportFailure(u, errors.New("refused"))
+	if _, err := pool.Next("example.com"); err != nil {
+		t.Fatalf("quarantined before MaxFailures in a row: %v", err)
+	}
+	pool.ReportFailure(u, errors.New("refused"))
+	pool.ReportBlocked(u)
+	if _, err := pool.Next("example.com"); !errors.Is(err, ErrNoProxy) {
+		t.Fatalf("Next = %v, want ErrNoProxy", err)
+	}
+
+	s := pool.Stats()[0]
+	if s.URL != "http://a:1" || s.Successes != 1 || s.Failures != 4 || s.Blocks != 1 || !s.Quarantined || s.SuccessRate() != 1.0/6 {
+		t.Errorf("stats = %+v", s)
+	}
+
+	// A passing health check releases it, a failing one quarantines it
+	pool.Check(context.Background(), func(ctx context.Context, proxyURL string) error { return nil })
+	if _, err := pool.Next("example.com"); err != nil {
+		t.Errorf("not released by a passing check: %v", err)
+	}
+	pool.Check(context.Background(), func(ctx context.Context, proxyURL string) error { return errors.New("down") })
+	if _, err := pool.Next("example.com"); err == nil {
+		t.Error("not quarantined by a failing check")
+	}
+	pool.Release(u)
+	if !pool.Remove(u) || pool.Len() != 0 {
+		t.Error("Remove did not take the proxy out")
+	}
+}
+
+func TestDefaultBlocked(t *testing.T) {
+	if !DefaultBlocked(429, nil) || !DefaultBlocked(403, map[string][]string{"Cf-Mitigated": {"challenge"}}) {
+		t.Error("block pages not recognized")
+	}
+	if DefaultBlocked(403, nil) || DefaultBlocked(200, map[string][]string{"x-datadome": {"1"}}) {
+		t.Error("ordinary responses taken for block pages")
+	}
+}
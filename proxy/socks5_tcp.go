@@ -26,10 +26,17 @@ type SOCKS5Dialer struct {
 
 	// Local address to bind outgoing connections
 	localAddr string
+
+	// remoteDNS sends target hostnames to the proxy to resolve (socks5h);
+	// otherwise they are resolved locally with resolve
+	remoteDNS bool
+	resolve   func(ctx context.Context, host string) ([]net.IP, error)
 }
 
 // NewSOCKS5Dialer creates a new SOCKS5 dialer from a proxy URL
 // URL format: socks5://[user:pass@]host:port or socks5h://[user:pass@]host:port
+// As in curl, socks5h has the proxy resolve target hostnames; socks5
+// resolves them locally and connects the proxy to an IP address.
 func NewSOCKS5Dialer(proxyURL string) (*SOCKS5Dialer, error) {
 	parsed, err := url.Parse(proxyURL)
 	if err != nil {
@@ -50,6 +57,7 @@ func NewSOCKS5Dialer(proxyURL string) (*SOCKS5Dialer, error) {
 		proxyHost: host,
 		proxyPort: port,
 		timeout:   30 * time.Second,
+		remoteDNS: parsed.Scheme == "socks5h",
 	}
 
 	// Extract credentials if present
@@ -66,6 +74,39 @@ func (d *SOCKS5Dialer) SetLocalAddr(addr string) {
 	d.localAddr = addr
 }
 
+// SetResolver sets the resolver for target hostnames of a socks5:// proxy,
+// replacing the system resolver. Unused with socks5h://.
+func (d *SOCKS5Dialer) SetResolver(resolve func(ctx context.Context, host string) ([]net.IP, error)) {
+	d.resolve = resolve
+}
+
+// RemoteDNS reports whether the proxy resolves target hostnames (socks5h)
+func (d *SOCKS5Dialer) RemoteDNS() bool {
+	return d.remoteDNS
+}
+
+// resolveTarget resolves a target hostname locally for a socks5:// proxy.
+// IP addresses, and any host under socks5h://, pass through unchanged.
+func (d *SOCKS5Dialer) resolveTarget(ctx context.Context, host string) (string, error) {
+	if d.remoteDNS || net.ParseIP(host) != nil {
+		return host, nil
+	}
+	var ips []net.IP
+	var err error
+	if d.resolve != nil {
+		ips, err = d.resolve(ctx, host)
+	} else {
+		ips, err = (&net.Resolver{PreferGo: false}).LookupIP(ctx, "ip", host)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve %s: %w", host, err)
+	}
+	if len(ips) == 0 {
+		return "", fmt.Errorf("no IP addresses found for %s", host)
+	}
+	return ips[0].String(), nil
+}
+
 // DialContext connects to the target through the SOCKS5 proxy using TCP CONNECT
 func (d *SOCKS5Dialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
 	// Parse target address
@@ -73,6 +114,10 @@ func (d *SOCKS5Dialer) DialContext(ctx context.Context, network, addr string) (n
 	if err != nil {
 		return nil, fmt.Errorf("invalid target address: %w", err)
 	}
+	targetHost, err = d.resolveTarget(ctx, targetHost)
+	if err != nil {
+		return nil, err
+	}
 
 	// Resolve proxy hostname using CGO-compatible resolver
 	resolver := &net.Resolver{PreferGo: false}
@@ -0,0 +1,89 @@
+package proxy
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+)
+
+// serveSOCKS5Once accepts one no-auth CONNECT and sends its address type and
+// address on the returned channel
+func serveSOCKS5Once(ln net.Listener) <-chan string {
+	got := make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		greeting := make([]byte, 3)
+		if _, err := io.ReadFull(conn, greeting); err != nil {
+			return
+		}
+		conn.Write([]byte{socks5Version, authNone})
+
+		header := make([]byte, 4)
+		if _, err := io.ReadFull(conn, header); err != nil {
+			return
+		}
+		var addr string
+		switch header[3] {
+		case atypIPv4:
+			ip := make([]byte, 4)
+			io.ReadFull(conn, ip)
+			addr = "ip " + net.IP(ip).String()
+		case atypDomain:
+			n := make([]byte, 1)
+			io.ReadFull(conn, n)
+			name := make([]byte, n[0])
+			io.ReadFull(conn, name)
+			addr = "domain " + string(name)
+		}
+		io.ReadFull(conn, make([]byte, 2))
+		conn.Write([]byte{socks5Version, replySuccess, 0x00, atypIPv4, 0, 0, 0, 0, 0, 0})
+		got <- addr
+	}()
+	return got
+}
+
+func TestSOCKS5DialerDNS(t *testing.T) {
+	tests := []struct {
+		scheme string
+		want   string
+	}{
+		{"socks5", "ip 192.0.2.7"},
+		{"socks5h", "domain example.com"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.scheme, func(t *testing.T) {
+			ln, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer ln.Close()
+			got := serveSOCKS5Once(ln)
+
+			d, err := NewSOCKS5Dialer(tt.scheme + "://" + ln.Addr().String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			d.SetResolver(func(ctx context.Context, host string) ([]net.IP, error) {
+				return []net.IP{net.ParseIP("192.0.2.7")}, nil
+			})
+			if d.RemoteDNS() != (tt.scheme == "socks5h") {
+				t.Errorf("RemoteDNS() = %v", d.RemoteDNS())
+			}
+
+			conn, err := d.DialContext(context.Background(), "tcp", "example.com:443")
+			if err != nil {
+				t.Fatal(err)
+			}
+			conn.Close()
+			if addr := <-got; addr != tt.want {
+				t.Errorf("CONNECT to %q, want %q", addr, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,318 @@
+package proxy
+
+import (
+	"context"
+	"net/netip"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"golang.org/x/net/http/httpproxy"
+)
+
+// SystemSettings is the operating system's proxy configuration
+type SystemSettings struct {
+	// HTTP, HTTPS and SOCKS are the manually configured proxy URLs, "" when
+	// unset. SOCKS is used for schemes without a proxy of their own.
+	HTTP  string
+	HTTPS string
+	SOCKS string
+
+	// Bypass lists the hosts reached without the manual proxies: names with
+	// * and ? wildcards ("*.example.com"), CIDRs ("10.0.0.0/8") and
+	// "<local>" for names without a dot
+	Bypass []string
+
+	// AutoConfigURL is the PAC file to use, "" for none
+	AutoConfigURL string
+
+	// AutoDetect looks for a PAC file with WPAD
+	AutoDetect bool
+}
+
+// LoadSystemSettings reads the proxy configuration of the operating system:
+// the Internet Settings of the current user on Windows, scutil --proxy on
+// macOS, and GNOME's org.gnome.system.proxy elsewhere, falling back to the
+// HTTP_PROXY family of environment variables when GNOME's isn't set.
+func LoadSystemSettings() (*SystemSettings, error) {
+	return loadSystemSettings()
+}
+
+// System returns a Selector that follows the operating system's proxy
+// settings, as read by LoadSystemSettings on first use. A PAC file, named or
+// found with WPAD, takes precedence over the manual proxies, which are used
+// when it cannot be loaded. Loopback hosts are always reached directly.
+func System() Selector {
+	return &systemSelector{}
+}
+
+type systemSelector struct {
+	once     sync.Once
+	settings *SystemSettings
+	pac      Selector
+	err      error
+}
+
+func (s *systemSelector) Select(ctx context.Context, u *url.URL) ([]string, error) {
+	s.once.Do(func() {
+		s.settings, s.err = LoadSystemSettings()
+		if s.err != nil {
+			return
+		}
+		switch {
+		case s.settings.AutoConfigURL != "":
+			s.pac = AutoConfigURL(s.settings.AutoConfigURL)
+		case s.settings.AutoDetect:
+			s.pac = WPAD()
+		}
+	})
+	if s.err != nil {
+		return nil, s.err
+	}
+	if isLoopbackHost(u.Hostname()) {
+		return []string{""}, nil
+	}
+	if s.pac != nil {
+		proxies, err := s.pac.Select(ctx, u)
+		if err == nil || !s.settings.hasManual() {
+			return proxies, err
+		}
+	}
+	return s.settings.manual(u), nil
+}
+
+func (s *SystemSettings) hasManual() bool {
+	return s.HTTP != "" || s.HTTPS != "" || s.SOCKS != ""
+}
+
+// manual returns the manually configured proxy for u
+func (s *SystemSettings) manual(u *url.URL) []string {
+	host := u.Hostname()
+	if isLoopbackHost(host) || bypassed(host, s.Bypass) {
+		return []string{""}
+	}
+	proxy := s.HTTP
+	if u.Scheme == "https" || u.Scheme == "wss" {
+		proxy = s.HTTPS
+	}
+	if proxy == "" {
+		proxy = s.SOCKS
+	}
+	return []string{proxy}
+}
+
+func isLoopbackHost(host string) bool {
+	if strings.EqualFold(host, "localhost") || strings.HasSuffix(strings.ToLower(host), ".localhost") {
+		return true
+	}
+	ip, err := netip.ParseAddr(host)
+	return err == nil && ip.IsLoopback()
+}
+
+// bypassed reports whether host matches one of the bypass patterns
+func bypassed(host string, patterns []string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	ip, ipErr := netip.ParseAddr(host)
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(strings.TrimSpace(pattern))
+		switch {
+		case pattern == "":
+		case pattern == "<local>":
+			if ipErr != nil && !strings.Contains(host, ".") {
+				return true
+			}
+		case strings.Contains(pattern, "/"):
+			if prefix, ok := parseBypassPrefix(pattern); ok && ipErr == nil && prefix.Contains(ip.Unmap()) {
+				return true
+			}
+		case shExpMatch(host, pattern):
+			return true
+		}
+	}
+	return false
+}
+
+// parseBypassPrefix parses a CIDR, including macOS's shortened IPv4 form
+// "169.254/16"
+func parseBypassPrefix(s string) (netip.Prefix, bool) {
+	if prefix, err := netip.ParsePrefix(s); err == nil {
+		return prefix.Masked(), true
+	}
+	addr, bits, _ := strings.Cut(s, "/")
+	if strings.Contains(addr, ":") {
+		return netip.Prefix{}, false
+	}
+	for strings.Count(addr, ".") < 3 {
+		addr += ".0"
+	}
+	prefix, err := netip.ParsePrefix(addr + "/" + bits)
+	return prefix.Masked(), err == nil
+}
+
+// proxyURL adds a scheme to a host:port proxy address
+func proxyURL(scheme, addr string) string {
+	addr = strings.TrimSpace(addr)
+	if addr == "" || strings.Contains(addr, "://") {
+		return addr
+	}
+	return scheme + "://" + addr
+}
+
+// environmentSettings reads HTTP_PROXY, HTTPS_PROXY, ALL_PROXY and NO_PROXY
+// (or their lowercase forms)
+func environmentSettings() *SystemSettings {
+	cfg := httpproxy.FromEnvironment()
+	s := &SystemSettings{
+		HTTP:  proxyURL("http", cfg.HTTPProxy),
+		HTTPS: proxyURL("http", cfg.HTTPSProxy),
+		SOCKS: proxyURL("socks5", firstEnv("ALL_PROXY", "all_proxy")),
+	}
+	// NO_PROXY's "example.com" covers subdomains, ".example.com" only them
+	for _, entry := range strings.Split(cfg.NoProxy, ",") {
+		entry = strings.TrimSpace(entry)
+		switch {
+		case entry == "":
+		case strings.HasPrefix(entry, "."):
+			s.Bypass = append(s.Bypass, "*"+entry)
+		case strings.Contains(entry, "/") || entry == "*":
+			s.Bypass = append(s.Bypass, entry)
+		default:
+			s.Bypass = append(s.Bypass, entry, "*."+entry)
+		}
+	}
+	return s
+}
+
+func firstEnv(names ...string) string {
+	for _, name := range names {
+		if value := os.Getenv(name); value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// parseWindowsProxy applies a ProxyServer value, "host:port" for every
+// scheme or "http=host:port;https=host:port;socks=host:port", and a
+// ProxyOverride list separated by semicolons
+func (s *SystemSettings) parseWindowsProxy(server, override string) {
+	for _, entry := range strings.Split(server, ";") {
+		scheme, addr, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if !ok {
+			addr = proxyURL("http", scheme)
+			s.HTTP, s.HTTPS = addr, addr
+			continue
+		}
+		switch strings.ToLower(scheme) {
+		case "http":
+			s.HTTP = proxyURL("http", addr)
+		case "https":
+			s.HTTPS = proxyURL("http", addr)
+		case "socks":
+			s.SOCKS = proxyURL("socks5", addr)
+		}
+	}
+	for _, entry := range strings.Split(override, ";") {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			s.Bypass = append(s.Bypass, entry)
+		}
+	}
+}
+
+// parseScutilProxy reads the output of macOS's scutil --proxy
+func parseScutilProxy(out string) *SystemSettings {
+	values := make(map[string]string)
+	var exceptions []string
+	inExceptions := false
+	for _, line := range strings.Split(out, "\n") {
+		key, value, ok := strings.Cut(strings.TrimSpace(line), " : ")
+		switch {
+		case inExceptions && strings.TrimSpace(line) == "}":
+			inExceptions = false
+		case !ok:
+		case inExceptions:
+			exceptions = append(exceptions, strings.TrimSpace(value))
+		case key == "ExceptionsList":
+			inExceptions = true
+		default:
+			values[key] = strings.TrimSpace(value)
+		}
+	}
+
+	s := &SystemSettings{Bypass: exceptions}
+	manual := func(prefix, scheme string) string {
+		if values[prefix+"Enable"] != "1" || values[prefix+"Proxy"] == "" {
+			return ""
+		}
+		addr := values[prefix+"Proxy"]
+		if port := values[prefix+"Port"]; port != "" {
+			addr += ":" + port
+		}
+		return proxyURL(scheme, addr)
+	}
+	s.HTTP = manual("HTTP", "http")
+	s.HTTPS = manual("HTTPS", "http")
+	s.SOCKS = manual("SOCKS", "socks5")
+	if values["ProxyAutoConfigEnable"] == "1" {
+		s.AutoConfigURL = values["ProxyAutoConfigURLString"]
+	}
+	s.AutoDetect = values["ProxyAutoDiscoveryEnable"] == "1"
+	if values["ExcludeSimpleHostnames"] == "1" {
+		s.Bypass = append(s.Bypass, "<local>")
+	}
+	return s
+}
+
+// parseGNOMEProxy reads GNOME's proxy settings through get, which returns
+// the output of gsettings get for a schema and key. It reports false when
+// GNOME has no proxy configured.
+func parseGNOMEProxy(get func(schema, key string) string) (*SystemSettings, bool) {
+	const base = "org.gnome.system.proxy"
+	s := &SystemSettings{}
+	switch gsettingsString(get(base, "mode")) {
+	case "manual":
+		manual := func(kind, scheme string) string {
+			host := gsettingsString(get(base+"."+kind, "host"))
+			port, _ := strconv.Atoi(strings.TrimSpace(get(base+"."+kind, "port")))
+			if host == "" || port == 0 {
+				return ""
+			}
+			return proxyURL(scheme, host+":"+strconv.Itoa(port))
+		}
+		s.HTTP = manual("http", "http")
+		s.HTTPS = manual("https", "http")
+		s.SOCKS = manual("socks", "socks5")
+		s.Bypass = gsettingsList(get(base, "ignore-hosts"))
+	case "auto":
+		if s.AutoConfigURL = gsettingsString(get(base, "autoconfig-url")); s.AutoConfigURL == "" {
+			s.AutoDetect = true
+		}
+	default:
+		return nil, false
+	}
+	return s, true
+}
+
+// gsettingsString unquotes a GVariant string such as 'manual'
+func gsettingsString(v string) string {
+	v = strings.TrimSpace(v)
+	if len(v) >= 2 && (v[0] == '\'' || v[0] == '"') && v[len(v)-1] == v[0] {
+		return v[1 : len(v)-1]
+	}
+	return v
+}
+
+// gsettingsList parses a GVariant string array such as ['localhost', '::1']
+func gsettingsList(v string) []string {
+	v = strings.TrimPrefix(strings.TrimSpace(v), "@as ")
+	v = strings.TrimSuffix(strings.TrimPrefix(v, "["), "]")
+	var list []string
+	for _, item := range strings.Split(v, ",") {
+		if item = gsettingsString(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
@@ -0,0 +1,16 @@
+//go:build darwin
+
+package proxy
+
+import (
+	"fmt"
+	"os/exec"
+)
+
+func loadSystemSettings() (*SystemSettings, error) {
+	out, err := exec.Command("scutil", "--proxy").Output()
+	if err != nil {
+		return nil, fmt.Errorf("proxy: running scutil --proxy: %w", err)
+	}
+	return parseScutilProxy(string(out)), nil
+}
@@ -0,0 +1,21 @@
+//go:build !windows && !darwin
+
+package proxy
+
+import (
+	"os/exec"
+	"strings"
+)
+
+func loadSystemSettings() (*SystemSettings, error) {
+	if _, err := exec.LookPath("gsettings"); err == nil {
+		get := func(schema, key string) string {
+			out, _ := exec.Command("gsettings", "get", schema, key).Output()
+			return strings.TrimSpace(string(out))
+		}
+		if s, ok := parseGNOMEProxy(get); ok {
+			return s, nil
+		}
+	}
+	return environmentSettings(), nil
+}
@@ -0,0 +1,37 @@
+//go:build windows
+
+package proxy
+
+import (
+	"fmt"
+
+	"golang.org/x/sys/windows/registry"
+)
+
+const internetSettingsKey = `Software\Microsoft\Windows\CurrentVersion\Internet Settings`
+
+func loadSystemSettings() (*SystemSettings, error) {
+	k, err := registry.OpenKey(registry.CURRENT_USER, internetSettingsKey, registry.QUERY_VALUE)
+	if err != nil {
+		return nil, fmt.Errorf("proxy: reading Internet Settings: %w", err)
+	}
+	defer k.Close()
+
+	s := &SystemSettings{}
+	if enabled, _, err := k.GetIntegerValue("ProxyEnable"); err == nil && enabled != 0 {
+		server, _, _ := k.GetStringValue("ProxyServer")
+		override, _, _ := k.GetStringValue("ProxyOverride")
+		s.parseWindowsProxy(server, override)
+	}
+	s.AutoConfigURL, _, _ = k.GetStringValue("AutoConfigURL")
+
+	// "Automatically detect settings" is a flag in the binary connection
+	// settings blob rather than a value of its own
+	if conn, err := registry.OpenKey(k, "Connections", registry.QUERY_VALUE); err == nil {
+		if blob, _, err := conn.GetBinaryValue("DefaultConnectionSettings"); err == nil && len(blob) > 8 {
+			s.AutoDetect = blob[8]&0x08 != 0
+		}
+		conn.Close()
+	}
+	return s, nil
+}
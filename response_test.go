@@ -0,0 +1,127 @@
+package httpcloak
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// jsonArray returns a JSON array of n numbers, larger than it looks
+func jsonArray(n int) string {
+	return "[" + strings.TrimSuffix(strings.Repeat("12345678,", n), ",") + "]"
+}
+
+func TestResponseJSON(t *testing.T) {
+	respond := func(body string) *Response {
+		return &Response{Body: io.NopCloser(strings.NewReader(body)), Headers: map[string][]string{}}
+	}
+
+	// Small bodies stay cached for Bytes
+	r := respond(`{"a":1}`)
+	var small map[string]int
+	if err := r.JSON(&small); err != nil || small["a"] != 1 {
+		t.Fatalf("JSON = %v, %v", small, err)
+	}
+	if data, err := r.Bytes(); err != nil || string(data) != `{"a":1}` {
+		t.Errorf("Bytes after JSON = %q, %v", data, err)
+	}
+
+	// Large bodies are decoded from the body and not cached
+	big := jsonArray(200000)
+	r = respond(big)
+	var numbers []int
+	if err := r.JSON(&numbers); err != nil || len(numbers) != 200000 {
+		t.Fatalf("streamed JSON decoded %d numbers, err %v", len(numbers), err)
+	}
+	if _, err := r.Bytes(); !errors.Is(err, ErrBodyStreamed) {
+		t.Errorf("Bytes after streamed JSON: err = %v, want ErrBodyStreamed", err)
+	}
+	if err := respond(big + " x").JSON(&numbers); err == nil {
+		t.Error("trailing data after a streamed value was accepted")
+	}
+}
+
+func TestJSONSizeLimit(t *testing.T) {
+	const limit = 1 << 20
+	const huge = 64 << 20
+	var hits atomic.Int32
+	written := make(chan int, 1)
+	gzipped := gzipBody(t, bytes.Repeat([]byte(" "), 4*limit))
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		switch r.URL.Path {
+		case "/small":
+			w.Write([]byte(`{"a":1}`))
+		case "/length":
+			w.Header().Set("Content-Length", "4194304")
+			w.Write(make([]byte, 4<<20))
+		case "/gzip":
+			// Small on the wire, over the limit once decoded
+			w.Header().Set("Content-Encoding", "gzip")
+			w.Write(gzipped)
+		case "/chunked":
+			chunk := bytes.Repeat([]byte("1,"), 16<<10)
+			n := 0
+			for n < huge {
+				m, err := w.Write(chunk)
+				n += m
+				if err != nil {
+					break
+				}
+				w.(http.Flusher).Flush()
+			}
+			written <- n
+		}
+	}))
+	defer srv.Close()
+
+	s := NewSession("chrome-latest", WithJSONSizeLimit(limit))
+	defer s.Close()
+	ctx := context.Background()
+
+	resp, err := s.Get(ctx, srv.URL+"/small")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var small map[string]int
+	if err := resp.JSON(&small); err != nil || small["a"] != 1 {
+		t.Fatalf("JSON under the limit = %v, %v", small, err)
+	}
+
+	for _, path := range []string{"/length", "/gzip", "/chunked"} {
+		hits.Store(0)
+		resp, err := s.Get(ctx, srv.URL+path)
+		if err == nil {
+			resp.Close()
+		}
+		if !errors.Is(err, ErrJSONTooLarge) {
+			t.Errorf("%s: err = %v, want ErrJSONTooLarge", path, err)
+		}
+		if n := hits.Load(); n != 1 {
+			t.Errorf("%s: sent %d times, want no retry", path, n)
+		}
+	}
+	// The download stopped near the limit
+	if n := <-written; n >= huge {
+		t.Errorf("server wrote all %d bytes of the body", n)
+	}
+}
+
+func gzipBody(t *testing.T, data []byte) []byte {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
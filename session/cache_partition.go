@@ -0,0 +1,43 @@
+package session
+
+import (
+	"context"
+	"net/url"
+	"strings"
+)
+
+// topFrameKey is the context key carrying the URL of the page a request is
+// made for
+type topFrameKey struct{}
+
+// withTopFrame marks requests made with ctx as subresources of pageURL
+func withTopFrame(ctx context.Context, pageURL string) context.Context {
+	return context.WithValue(ctx, topFrameKey{}, pageURL)
+}
+
+// cacheKey returns the key of rawURL's cache validators. With
+// PartitionHTTPCache they are keyed like Chrome's partitioned HTTP cache,
+// by the top-frame site as well as the URL: the page's site for Warmup
+// subresources, the URL's own site for other requests. A cross-site
+// resource cached under one site is then fetched afresh from another, and
+// revalidated only where a browser would.
+func (s *Session) cacheKey(ctx context.Context, rawURL string) string {
+	if s.Config == nil || !s.Config.PartitionHTTPCache {
+		return rawURL
+	}
+	topFrame, _ := ctx.Value(topFrameKey{}).(string)
+	if topFrame == "" {
+		topFrame = rawURL
+	}
+	return schemefulSite(topFrame) + " " + rawURL
+}
+
+// schemefulSite returns the scheme and registrable domain of rawURL, e.g.
+// https://example.com for https://www.example.com/page
+func schemefulSite(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	return strings.ToLower(u.Scheme) + "://" + cookieSite(strings.ToLower(u.Hostname()))
+}
@@ -0,0 +1,58 @@
+package session
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+)
+
+// DefaultCompressThreshold is the size above which Save gzips session state.
+// Small states stay plain JSON so they remain easy to inspect by hand; states
+// carrying many TLS tickets and cookies grow quickly and compress well.
+const DefaultCompressThreshold = 64 * 1024
+
+// gzipMagic is the two-byte header every gzip stream starts with
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// IsCompressed reports whether data is a gzip stream
+func IsCompressed(data []byte) bool {
+	return bytes.HasPrefix(data, gzipMagic)
+}
+
+// Compress gzips data when it is at least threshold bytes long.
+// A negative threshold disables compression; zero always compresses.
+func Compress(data []byte, threshold int) ([]byte, error) {
+	if threshold < 0 || len(data) < threshold {
+		return data, nil
+	}
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		return nil, fmt.Errorf("failed to compress: %w", err)
+	}
+	if err := zw.Close(); err != nil {
+		return nil, fmt.Errorf("failed to compress: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// Decompress returns data un-gzipped if it is a gzip stream, or unchanged otherwise
+func Decompress(data []byte) ([]byte, error) {
+	if !IsCompressed(data) {
+		return data, nil
+	}
+
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress: %w", err)
+	}
+	defer zr.Close()
+
+	out, err := io.ReadAll(zr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress: %w", err)
+	}
+	return out, nil
+}
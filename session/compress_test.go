@@ -0,0 +1,33 @@
+package session
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestCompressRoundTrip(t *testing.T) {
+	data := bytes.Repeat([]byte(`{"cookies":{}}`), 100)
+
+	plain, err := Compress(data, len(data)+1)
+	if err != nil || IsCompressed(plain) {
+		t.Fatalf("data below threshold should stay plain (err=%v)", err)
+	}
+
+	packed, err := Compress(data, 0)
+	if err != nil {
+		t.Fatalf("Compress failed: %v", err)
+	}
+	if !IsCompressed(packed) || len(packed) >= len(data) {
+		t.Fatalf("expected smaller gzip output, got %d bytes", len(packed))
+	}
+
+	for _, in := range [][]byte{packed, data} {
+		out, err := Decompress(in)
+		if err != nil {
+			t.Fatalf("Decompress failed: %v", err)
+		}
+		if !bytes.Equal(out, data) {
+			t.Error("round trip mismatch")
+		}
+	}
+}
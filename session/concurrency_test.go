@@ -0,0 +1,116 @@
+package session
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sardanioss/httpcloak/protocol"
+)
+
+// TestSessionConcurrentUse hammers one session with requests while it is being
+// reconfigured. Run with -race; failures show up as race reports or deadlocks.
+func TestSessionConcurrentUse(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: "visit", Value: r.URL.Path})
+		fmt.Fprint(w, "ok")
+	}))
+	defer server.Close()
+
+	s := NewSession("", &protocol.SessionConfig{Preset: "chrome-latest", Timeout: 10000})
+	defer s.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				resp, err := s.Get(ctx, fmt.Sprintf("%s/%d/%d", server.URL, i, j), nil)
+				if err != nil {
+					t.Errorf("request failed: %v", err)
+					return
+				}
+				resp.Close()
+			}
+		}(i)
+	}
+
+	reconfigure := []func(){
+		func() { s.SetProxy("") },
+		func() { s.SetHeaderOrder([]string{"accept", "user-agent"}) },
+		func() { s.SetHeaderOrder(nil) },
+		func() { s.Refresh() },
+		func() { s.SetCookie("manual", "1") },
+		func() { _ = s.GetCookies() },
+		func() { _ = s.GetHeaderOrder() },
+		func() { _ = s.Stats() },
+		func() { _ = s.GetProxy() },
+	}
+	for _, fn := range reconfigure {
+		wg.Add(1)
+		go func(fn func()) {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				fn()
+			}
+		}(fn)
+	}
+
+	wg.Wait()
+
+	if got := s.Stats().RequestCount; got != 160 {
+		t.Errorf("RequestCount = %d, want 160", got)
+	}
+}
+
+// TestSwitchPresetDuringRequests switches presets while requests are running
+// and updating the session
+func TestSwitchPresetDuringRequests(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: "visit", Value: r.URL.Path})
+		time.Sleep(5 * time.Millisecond)
+		fmt.Fprint(w, "ok")
+	}))
+	defer server.Close()
+
+	s := NewSession("", &protocol.SessionConfig{Preset: "chrome-latest", Timeout: 10000})
+	defer s.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				resp, err := s.Get(ctx, fmt.Sprintf("%s/%d/%d", server.URL, i, j), nil)
+				if err != nil {
+					t.Errorf("request failed: %v", err)
+					return
+				}
+				resp.Close()
+			}
+		}(i)
+	}
+	presets := []string{"firefox-133", "chrome-145", "safari-18"}
+	for j := 0; j < 15; j++ {
+		if err := s.SwitchPreset(presets[j%len(presets)]); err != nil {
+			t.Fatalf("SwitchPreset: %v", err)
+		}
+	}
+	wg.Wait()
+
+	if got := s.Config.Preset; got != presets[14%len(presets)] {
+		t.Errorf("Config.Preset = %q, want %q", got, presets[14%len(presets)])
+	}
+}
@@ -0,0 +1,124 @@
+package session
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// CookieIssueKind classifies a cookie found by Audit
+type CookieIssueKind string
+
+const (
+	// CookiePublicSuffix is a domain cookie scoped to a public suffix such as
+	// .com or .co.uk, so every site under it receives the cookie
+	CookiePublicSuffix CookieIssueKind = "public-suffix"
+	// CookieUnscoped has no domain at all (SetCookie, SetCookies) and is sent
+	// to every host the session talks to
+	CookieUnscoped CookieIssueKind = "unscoped"
+	// CookieCrossSiteRedirect was set by a site the session only reached by
+	// following a redirect from another site. It will be sent when that site
+	// is requested directly, linking the two visits.
+	CookieCrossSiteRedirect CookieIssueKind = "cross-site-redirect"
+)
+
+// CookieIssue is a cookie whose scope may leak session identity between sites
+type CookieIssue struct {
+	Kind   CookieIssueKind
+	Name   string
+	Domain string
+	Path   string
+	Detail string
+}
+
+func (i CookieIssue) String() string {
+	return fmt.Sprintf("%s: %s (domain %q, path %s): %s", i.Kind, i.Name, i.Domain, i.Path, i.Detail)
+}
+
+// Audit reports cookies scoped more broadly than a browser would allow or
+// picked up from sites visited only through cross-site redirects. Expired
+// cookies are skipped. Issues are sorted by domain, name and kind.
+func (j *CookieJar) Audit() []CookieIssue {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+
+	now := time.Now()
+	var issues []CookieIssue
+	for domain, domainCookies := range j.cookies {
+		for _, c := range domainCookies {
+			if j.expired(c.Expires, now) {
+				continue
+			}
+			issue := CookieIssue{Name: c.Name, Domain: domain, Path: c.Path}
+			if domain == "" {
+				issue.Kind = CookieUnscoped
+				issue.Detail = "no domain, sent to every host"
+				issues = append(issues, issue)
+				continue
+			}
+			if !c.HostOnly && isPublicSuffix(strings.TrimPrefix(domain, ".")) {
+				issue.Kind = CookiePublicSuffix
+				issue.Detail = fmt.Sprintf("domain is a public suffix, sent to every site under %s", domain)
+				issues = append(issues, issue)
+			}
+			if c.RedirectedFrom != "" && c.SetBy != "" {
+				from := redirectHost(c.RedirectedFrom)
+				if from != "" && cookieSite(from) != cookieSite(c.SetBy) {
+					issue.Kind = CookieCrossSiteRedirect
+					issue.Detail = fmt.Sprintf("set by %s after a redirect from %s", c.SetBy, c.RedirectedFrom)
+					issues = append(issues, issue)
+				}
+			}
+		}
+	}
+
+	sort.Slice(issues, func(a, b int) bool {
+		if issues[a].Domain != issues[b].Domain {
+			return issues[a].Domain < issues[b].Domain
+		}
+		if issues[a].Name != issues[b].Name {
+			return issues[a].Name < issues[b].Name
+		}
+		return issues[a].Kind < issues[b].Kind
+	})
+	return issues
+}
+
+// isPublicSuffix reports whether domain is a public suffix. Single-label
+// names without a listed rule (localhost, intranet hosts) don't count.
+func isPublicSuffix(domain string) bool {
+	if net.ParseIP(domain) != nil {
+		return false
+	}
+	suffix, icann := publicsuffix.PublicSuffix(domain)
+	return suffix == domain && (icann || strings.Contains(domain, "."))
+}
+
+// cookieSite returns the registrable domain (eTLD+1) of host, or host itself
+// for IPs and names without one
+func cookieSite(host string) string {
+	if site, err := publicsuffix.EffectiveTLDPlusOne(host); err == nil {
+		return site
+	}
+	return host
+}
+
+// redirectHost returns the lowercased hostname of rawURL
+func redirectHost(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(u.Hostname())
+}
+
+// AuditCookies reports cookies in the session's jar that may leak identity
+// between sites (see CookieJar.Audit)
+func (s *Session) AuditCookies() []CookieIssue {
+	return s.cookies.Audit()
+}
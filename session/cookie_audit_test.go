@@ -0,0 +1,56 @@
+package session
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sardanioss/httpcloak/transport"
+)
+
+func TestCookieJarAudit(t *testing.T) {
+	j := NewCookieJar()
+	j.Set("www.example.com", &CookieData{Name: "ok", Value: "1", Domain: "example.com"}, true)
+	j.Set("www.example.com", &CookieData{Name: "broad", Value: "1", Domain: ".com"}, true)
+	j.Set("shop.example.co.uk", &CookieData{Name: "broad", Value: "1", Domain: "co.uk"}, true)
+	j.Set("localhost", &CookieData{Name: "local", Value: "1", Domain: "localhost"}, false)
+	j.SetSimple("global", "1")
+
+	past := time.Now().Add(-time.Hour)
+	j.Set("www.example.com", &CookieData{Name: "gone", Value: "1", Domain: ".com", Expires: &past}, true)
+
+	got := map[string]CookieIssueKind{}
+	for _, issue := range j.Audit() {
+		got[issue.Domain+" "+issue.Name] = issue.Kind
+	}
+	want := map[string]CookieIssueKind{
+		".com broad":   CookiePublicSuffix,
+		".co.uk broad": CookiePublicSuffix,
+		" global":      CookieUnscoped,
+	}
+	if len(got) != len(want) {
+		t.Fatalf("issues = %v, want %v", got, want)
+	}
+	for key, kind := range want {
+		if got[key] != kind {
+			t.Errorf("%q: kind = %q, want %q", key, got[key], kind)
+		}
+	}
+}
+
+func TestAuditCrossSiteRedirect(t *testing.T) {
+	s := NewSession("", nil)
+	defer s.Close()
+
+	setCookie := map[string][]string{"Set-Cookie": {"uid=42; Path=/"}}
+	s.extractCookies(setCookie, "https://tracker.example.net/sync", []*transport.RedirectInfo{{StatusCode: 302, URL: "https://shop.example.com/"}})
+	s.extractCookies(setCookie, "https://cdn.example.com/a", []*transport.RedirectInfo{{StatusCode: 302, URL: "https://www.example.com/"}})
+	s.extractCookies(setCookie, "https://direct.example.org/", nil)
+
+	issues := s.AuditCookies()
+	if len(issues) != 1 {
+		t.Fatalf("issues = %v, want one cross-site redirect", issues)
+	}
+	if issues[0].Kind != CookieCrossSiteRedirect || issues[0].Domain != "tracker.example.net" {
+		t.Errorf("issue = %v", issues[0])
+	}
+}
@@ -14,6 +14,9 @@ type CookieJar struct {
 	// Primary key: domain (normalized)
 	// Secondary key: path + "\x00" + name
 	cookies map[string]map[string]*CookieData
+
+	// skewTolerance keeps cookies past their expiry for this long
+	skewTolerance time.Duration
 }
 
 // CookieData extends CookieState with creation time for sorting
@@ -29,6 +32,12 @@ type CookieData struct {
 	HttpOnly  bool
 	SameSite  string
 	CreatedAt time.Time
+
+	// SetBy is the host whose response set the cookie and RedirectedFrom the
+	// URL that started the redirect chain leading there, if any. Neither is
+	// kept across Export/Import.
+	SetBy          string
+	RedirectedFrom string
 }
 
 // NewCookieJar creates a new empty cookie jar
@@ -38,6 +47,21 @@ func NewCookieJar() *CookieJar {
 	}
 }
 
+// SetSkewTolerance keeps cookies for d past their expiry, so a client clock
+// running ahead of the server's doesn't expire them early. Cookies the
+// server deletes with an expiry further in the past than d still go.
+func (j *CookieJar) SetSkewTolerance(d time.Duration) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.skewTolerance = d
+}
+
+// expired reports whether a cookie expiring at expires has expired by now,
+// allowing for the skew tolerance. Caller holds j.mu.
+func (j *CookieJar) expired(expires *time.Time, now time.Time) bool {
+	return expires != nil && expires.Add(j.skewTolerance).Before(now)
+}
+
 // cookieKey generates a unique key for a cookie within a domain
 func cookieKey(path, name string) string {
 	return path + "\x00" + name
@@ -95,6 +119,18 @@ func (j *CookieJar) Set(requestHost string, cookie *CookieData, requestSecure bo
 		path = "/"
 	}
 
+	// An expiry in the past deletes the cookie
+	key := cookieKey(path, cookie.Name)
+	if j.expired(cookie.Expires, time.Now()) {
+		if domainCookies := j.cookies[domain]; domainCookies != nil {
+			delete(domainCookies, key)
+			if len(domainCookies) == 0 {
+				delete(j.cookies, domain)
+			}
+		}
+		return
+	}
+
 	// Create the stored cookie
 	stored := &CookieData{
 		Name:      cookie.Name,
@@ -108,13 +144,16 @@ func (j *CookieJar) Set(requestHost string, cookie *CookieData, requestSecure bo
 		HttpOnly:  cookie.HttpOnly,
 		SameSite:  cookie.SameSite,
 		CreatedAt: time.Now(),
+
+		SetBy:          requestHost,
+		RedirectedFrom: cookie.RedirectedFrom,
 	}
 
 	// Store the cookie
 	if j.cookies[domain] == nil {
 		j.cookies[domain] = make(map[string]*CookieData)
 	}
-	j.cookies[domain][cookieKey(path, cookie.Name)] = stored
+	j.cookies[domain][key] = stored
 }
 
 // Get returns all cookies that should be sent for a request
@@ -164,7 +203,7 @@ func (j *CookieJar) Get(requestHost, requestPath string, requestSecure bool) []*
 			}
 
 			// Expiration check
-			if cookie.Expires != nil && cookie.Expires.Before(now) {
+			if j.expired(cookie.Expires, now) {
 				continue
 			}
 
@@ -234,7 +273,7 @@ func (j *CookieJar) ClearExpired() {
 	now := time.Now()
 	for domain, domainCookies := range j.cookies {
 		for key, cookie := range domainCookies {
-			if cookie.Expires != nil && cookie.Expires.Before(now) {
+			if j.expired(cookie.Expires, now) {
 				delete(domainCookies, key)
 			}
 		}
@@ -268,7 +307,7 @@ func (j *CookieJar) Export() map[string][]CookieState {
 		var cookies []CookieState
 		for _, c := range domainCookies {
 			// Skip expired cookies
-			if c.Expires != nil && c.Expires.Before(now) {
+			if j.expired(c.Expires, now) {
 				continue
 			}
 
@@ -308,7 +347,7 @@ func (j *CookieJar) Import(cookies map[string][]CookieState) {
 
 		for _, c := range domainCookies {
 			// Skip expired cookies
-			if c.Expires != nil && c.Expires.Before(now) {
+			if j.expired(c.Expires, now) {
 				continue
 			}
 
@@ -352,7 +391,7 @@ func (j *CookieJar) ImportV4(cookies []CookieState) {
 
 	for _, c := range cookies {
 		// Skip expired cookies
-		if c.Expires != nil && c.Expires.Before(now) {
+		if j.expired(c.Expires, now) {
 			continue
 		}
 
@@ -0,0 +1,91 @@
+package session
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/sardanioss/httpcloak/protocol"
+)
+
+func TestCookieExpiry(t *testing.T) {
+	s := NewSession("", nil)
+	defer s.Close()
+	const url = "https://www.example.com/"
+	set := func(date string, cookies ...string) {
+		headers := map[string][]string{"Set-Cookie": cookies}
+		if date != "" {
+			headers["Date"] = []string{date}
+		}
+		s.extractCookies(headers, url, nil)
+	}
+	has := func(name string) bool {
+		for _, c := range s.cookies.Get("www.example.com", "/", true) {
+			if c.Name == name {
+				return true
+			}
+		}
+		return false
+	}
+
+	// The server's clock is an hour behind: its one-minute cookie expires
+	// an hour ago by the local clock
+	serverNow := time.Now().Add(-time.Hour)
+	set(serverNow.UTC().Format(http.TimeFormat), "skewed=1; Expires="+serverNow.Add(time.Minute).UTC().Format(http.TimeFormat))
+	if !has("skewed") {
+		t.Error("cookie expired by clock skew")
+	}
+
+	// Max-Age wins over Expires in either order
+	past := time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat)
+	set("", "a=1; Expires="+past+"; Max-Age=60", "b=1; Max-Age=60; Expires="+past)
+	if !has("a") || !has("b") {
+		t.Error("Max-Age did not take precedence over Expires")
+	}
+
+	// Max-Age=0 and an Expires in the past delete, an invalid Max-Age is ignored
+	set("", "a=1; Max-Age=0", "b=1; Expires=Thu, 01 Jan 1970 00:00:00 GMT", "c=1; Max-Age=soon")
+	if has("a") || has("b") || !has("c") {
+		t.Error("cookies not deleted by Max-Age=0 or a past Expires")
+	}
+	if n := s.cookies.Count(); n != 2 {
+		t.Errorf("jar holds %d cookies, want 2", n)
+	}
+}
+
+func TestCookieSkewTolerance(t *testing.T) {
+	s := NewSession("", &protocol.SessionConfig{CookieSkewTolerance: 300})
+	defer s.Close()
+
+	recent := time.Now().Add(-time.Minute).UTC().Format(http.TimeFormat)
+	s.extractCookies(map[string][]string{"Set-Cookie": {
+		"recent=1; Expires=" + recent,
+		"deleted=1; Expires=Thu, 01 Jan 1970 00:00:00 GMT",
+	}}, "https://www.example.com/", nil)
+
+	cookies := s.cookies.Get("www.example.com", "/", true)
+	if len(cookies) != 1 || cookies[0].Name != "recent" {
+		t.Errorf("cookies = %v, want the one within the tolerance", cookies)
+	}
+}
+
+// FuzzExtractCookies feeds malformed Set-Cookie and Date headers to the
+// cookie parser
+func FuzzExtractCookies(f *testing.F) {
+	f.Add("id=1; Path=/; Domain=example.com; Secure; HttpOnly; SameSite=Lax", "Mon, 02 Jan 2006 15:04:05 GMT")
+	f.Add("id=1; Max-Age=-5; Expires=Thu, 01 Jan 1970 00:00:00 GMT", "")
+	f.Add("=; ;;=x; Domain=.; Path", "garbage")
+
+	s := NewSession("", nil)
+	defer s.Close()
+	f.Fuzz(func(t *testing.T, setCookie, date string) {
+		s.ClearCookies()
+		s.extractCookies(map[string][]string{"set-cookie": {setCookie}, "date": {date}}, "https://www.example.com/a/b", nil)
+		for _, c := range s.cookies.Get("www.example.com", "/a/b", true) {
+			if c.Name == "" {
+				t.Fatalf("stored a cookie without a name from %q", setCookie)
+			}
+		}
+		s.cookies.BuildCookieHeader("www.example.com", "/", true)
+	})
+}
@@ -0,0 +1,64 @@
+package session
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sardanioss/httpcloak/protocol"
+	"github.com/sardanioss/httpcloak/transport"
+)
+
+func TestNoRetryNoRedirect(t *testing.T) {
+	hits := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		switch r.URL.Path {
+		case "/pay":
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case "/old":
+			http.Redirect(w, r, "/new", http.StatusMovedPermanently)
+		case "/new":
+			w.Write([]byte("new"))
+		}
+	}))
+	defer srv.Close()
+
+	s := NewSession("", &protocol.SessionConfig{
+		Preset:                  "chrome-latest",
+		FollowRedirects:         true,
+		CachePermanentRedirects: true,
+		ForceHTTP1:              true,
+		RetryEnabled:            true,
+		MaxRetries:              3,
+		RetryWaitMin:            1,
+		RetryWaitMax:            1,
+	})
+	defer s.Close()
+	do := func(req *transport.Request) *transport.Response {
+		hits = 0
+		resp, err := s.Request(context.Background(), req)
+		if err != nil {
+			t.Fatalf("%s: %v", req.URL, err)
+		}
+		return resp
+	}
+
+	if resp := do(&transport.Request{Method: "POST", URL: srv.URL + "/pay", NoRetry: true}); resp.StatusCode != 503 || hits != 1 {
+		t.Errorf("NoRetry: status %d after %d requests, want one 503", resp.StatusCode, hits)
+	}
+	if do(&transport.Request{Method: "POST", URL: srv.URL + "/pay"}); hits != 4 {
+		t.Errorf("session retries: %d requests, want 4", hits)
+	}
+
+	resp := do(&transport.Request{Method: "GET", URL: srv.URL + "/old", NoRedirect: true})
+	if resp.StatusCode != 301 || hits != 1 || resp.Redirects != 0 {
+		t.Errorf("NoRedirect: status %d after %d requests", resp.StatusCode, hits)
+	}
+	// The first followed 301 is remembered; NoRedirect still asks /old
+	do(&transport.Request{Method: "GET", URL: srv.URL + "/old"})
+	if resp := do(&transport.Request{Method: "GET", URL: srv.URL + "/old", NoRedirect: true}); resp.StatusCode != 301 || len(resp.History) != 0 {
+		t.Errorf("NoRedirect with a cached 301: status %d, history %d", resp.StatusCode, len(resp.History))
+	}
+}
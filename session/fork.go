@@ -1,8 +1,10 @@
 package session
 
 import (
+	"slices"
 	"time"
 
+	"github.com/sardanioss/httpcloak/dns"
 	"github.com/sardanioss/httpcloak/transport"
 )
 
@@ -59,7 +61,7 @@ func (s *Session) forkOne() *Session {
 		transportConfig = &cfgCopy
 	} else {
 		needsConfig := len(cfgCopy.ConnectTo) > 0 || cfgCopy.ECHConfigDomain != "" ||
-			cfgCopy.TLSOnly || cfgCopy.QuicIdleTimeout > 0 || cfgCopy.LocalAddress != "" ||
+			cfgCopy.TLSOnly || cfgCopy.QuicIdleTimeout > 0 || cfgCopy.QuicKeepAlive != 0 || cfgCopy.LocalAddress != "" ||
 			cfgCopy.EnableSpeculativeTLS
 		if needsConfig {
 			transportConfig = &transport.TransportConfig{
@@ -67,6 +69,7 @@ func (s *Session) forkOne() *Session {
 				ECHConfigDomain:       cfgCopy.ECHConfigDomain,
 				TLSOnly:              cfgCopy.TLSOnly,
 				QuicIdleTimeout:      time.Duration(cfgCopy.QuicIdleTimeout) * time.Second,
+				QuicKeepAlive:        time.Duration(cfgCopy.QuicKeepAlive) * time.Millisecond,
 				LocalAddr:            cfgCopy.LocalAddress,
 				EnableSpeculativeTLS: cfgCopy.EnableSpeculativeTLS,
 			}
@@ -95,6 +98,11 @@ func (s *Session) forkOne() *Session {
 			dnsCache.SetPreferIPv4(true)
 		}
 	}
+	if family, err := dns.ParseIPFamily(cfgCopy.IPFamily); err == nil && family != dns.IPFamilyAny {
+		if dnsCache := t.GetDNSCache(); dnsCache != nil {
+			dnsCache.SetIPFamily(family)
+		}
+	}
 
 	if cfgCopy.DisableECH {
 		t.SetDisableECH(true)
@@ -124,6 +132,13 @@ func (s *Session) forkOne() *Session {
 		cacheEntries[k] = &entryCopy
 	}
 
+	// Snapshot-copy permanentRedirects
+	permanentRedirects := make(map[string]PermanentRedirect, len(s.permanentRedirects))
+	for k, v := range s.permanentRedirects {
+		permanentRedirects[k] = v
+	}
+	redirectOrder := slices.Clone(s.redirectOrder)
+
 	// Snapshot-copy clientHints
 	clientHints := make(map[string]map[string]bool, len(s.clientHints))
 	for host, hints := range s.clientHints {
@@ -143,18 +158,30 @@ func (s *Session) forkOne() *Session {
 		}
 	}
 
-	return &Session{
-		ID:             generateID(),
-		CreatedAt:      time.Now(),
-		LastUsed:       time.Now(),
-		RequestCount:   0,
-		Config:         &cfgCopy,
-		transport:      t,
-		cookies:        s.cookies, // shared pointer — thread-safe CookieJar
-		cacheEntries:   cacheEntries,
-		clientHints:    clientHints,
-		keyLogWriter:   nil, // no key log on fork to avoid double-close
-		switchProtocol: switchProto,
-		active:         true,
-	}
+	fork := &Session{
+		ID:                 generateID(),
+		CreatedAt:          time.Now(),
+		LastUsed:           time.Now(),
+		RequestCount:       0,
+		Config:             &cfgCopy,
+		transport:          t,
+		cookies:            s.cookies, // shared pointer — thread-safe CookieJar
+		cacheEntries:       cacheEntries,
+		permanentRedirects: permanentRedirects,
+		redirectOrder:      redirectOrder,
+		clientHints:        clientHints,
+		keyLogWriter:       nil,      // no key log on fork to avoid double-close
+		harLog:             s.harLog, // shared writer, closed by the parent
+		warc:               s.warc,   // shared writer, closed by the parent
+		contentRoutes:      append([]contentRoute(nil), s.contentRoutes...),
+		switchProtocol:     switchProto,
+		trafficBudgets:     s.trafficBudgets, // shared - forks spend the parent's budget
+		hostHeaders:        s.hostHeaders,    // replaced, never modified, by SetHostHeaders
+		challengeCheck:     s.challengeCheck,
+		active:             true,
+	}
+	if cfgCopy.TicketRefreshAfter > 0 {
+		fork.startTicketRefresh(time.Duration(cfgCopy.TicketRefreshAfter) * time.Second)
+	}
+	return fork
 }
@@ -0,0 +1,293 @@
+package session
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sardanioss/httpcloak/protocol"
+	"github.com/sardanioss/httpcloak/transport"
+)
+
+// HAREntry is a single request/response pair in HAR 1.2 format.
+// Response bodies are not captured; the body belongs to the caller.
+type HAREntry struct {
+	StartedDateTime time.Time   `json:"startedDateTime"`
+	Time            float64     `json:"time"` // Total elapsed time in milliseconds
+	Request         HARRequest  `json:"request"`
+	Response        HARResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         HARTimings  `json:"timings"`
+}
+
+// HARRequest is the request part of a HAR entry
+type HARRequest struct {
+	Method      string         `json:"method"`
+	URL         string         `json:"url"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []HARNameValue `json:"cookies"`
+	Headers     []HARNameValue `json:"headers"`
+	QueryString []HARNameValue `json:"queryString"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+// HARResponse is the response part of a HAR entry
+type HARResponse struct {
+	Status      int            `json:"status"`
+	StatusText  string         `json:"statusText"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []HARNameValue `json:"cookies"`
+	Headers     []HARNameValue `json:"headers"`
+	Content     HARContent     `json:"content"`
+	RedirectURL string         `json:"redirectURL"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int64          `json:"bodySize"`
+}
+
+// HARContent describes the response body
+type HARContent struct {
+	Size     int64  `json:"size"`
+	MimeType string `json:"mimeType"`
+}
+
+// HARNameValue is a header, cookie or query parameter
+type HARNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// HARTimings breaks down the entry time in milliseconds (-1 = not applicable)
+type HARTimings struct {
+	DNS     float64 `json:"dns"`
+	Connect float64 `json:"connect"`
+	SSL     float64 `json:"ssl"`
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+}
+
+// HARWriter appends one HAR entry per completed round trip as a line of JSON
+// (NDJSON). Entries are flushed as they are written, so long-running sessions
+// don't hold the capture in memory and a crash loses at most the entry in flight.
+// Use WriteHAR to turn the log into a regular HAR file.
+type HARWriter struct {
+	mu     sync.Mutex
+	w      *bufio.Writer
+	closer io.Closer
+}
+
+// NewHARWriter creates a HARWriter on top of w. Close does not close w.
+func NewHARWriter(w io.Writer) *HARWriter {
+	return &HARWriter{w: bufio.NewWriter(w)}
+}
+
+// OpenHARLog opens path for appending and returns a HARWriter that owns the file
+func OpenHARLog(path string) (*HARWriter, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open HAR log: %w", err)
+	}
+	return &HARWriter{w: bufio.NewWriter(f), closer: f}, nil
+}
+
+// WriteEntry appends an entry and flushes it to the underlying writer
+func (h *HARWriter) WriteEntry(entry *HAREntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.w == nil {
+		return os.ErrClosed
+	}
+	if _, err := h.w.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	return h.w.Flush()
+}
+
+// Close flushes pending data and closes the file if the writer owns one
+func (h *HARWriter) Close() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.w == nil {
+		return nil
+	}
+	err := h.w.Flush()
+	h.w = nil
+	if h.closer != nil {
+		if cerr := h.closer.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// WriteHAR converts an NDJSON log written by HARWriter into a HAR 1.2 document.
+// Entries are copied one at a time, so logs larger than memory can be converted.
+func WriteHAR(dst io.Writer, src io.Reader) error {
+	bw := bufio.NewWriter(dst)
+	if _, err := io.WriteString(bw, `{"log":{"version":"1.2","creator":{"name":"httpcloak","version":"1"},"entries":[`); err != nil {
+		return err
+	}
+
+	scanner := bufio.NewScanner(src)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	first := true
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		if !json.Valid(line) {
+			// Skip a torn final line left by an interrupted write
+			continue
+		}
+		if !first {
+			bw.WriteByte(',')
+		}
+		first = false
+		bw.Write(line)
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read HAR log: %w", err)
+	}
+
+	if _, err := io.WriteString(bw, "]}}\n"); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// newHAREntry builds a HAR entry for a completed round trip
+func newHAREntry(req *transport.Request, started time.Time, statusCode int, headers map[string][]string, proto string, timing *protocol.Timing) *HAREntry {
+	version := harHTTPVersion(proto)
+	entry := &HAREntry{
+		StartedDateTime: started,
+		Request: HARRequest{
+			Method:      req.Method,
+			URL:         req.URL,
+			HTTPVersion: version,
+			Cookies:     []HARNameValue{},
+			Headers:     harHeaders(req.Headers),
+			QueryString: harQuery(req.URL),
+			HeadersSize: -1,
+			BodySize:    len(req.Body),
+		},
+		Response: HARResponse{
+			Status:      statusCode,
+			StatusText:  http.StatusText(statusCode),
+			HTTPVersion: version,
+			Cookies:     []HARNameValue{},
+			Headers:     harHeaders(headers),
+			HeadersSize: -1,
+			BodySize:    -1,
+			Content:     HARContent{Size: -1},
+		},
+		Timings: HARTimings{DNS: -1, Connect: -1, SSL: -1, Send: 0, Wait: 0, Receive: 0},
+	}
+
+	if ct := firstHeader(headers, "content-type"); ct != "" {
+		entry.Response.Content.MimeType = ct
+	}
+	if cl := firstHeader(headers, "content-length"); cl != "" {
+		if n, err := strconv.ParseInt(cl, 10, 64); err == nil {
+			entry.Response.BodySize = n
+			entry.Response.Content.Size = n
+		}
+	}
+	if isRedirectStatus(statusCode) {
+		entry.Response.RedirectURL = firstHeader(headers, "location")
+	}
+
+	if timing != nil {
+		entry.Time = timing.Total
+		if timing.DNSLookup > 0 {
+			entry.Timings.DNS = timing.DNSLookup
+		}
+		if timing.TCPConnect > 0 || timing.TLSHandshake > 0 {
+			// HAR counts the TLS handshake as part of connect
+			entry.Timings.Connect = timing.TCPConnect + timing.TLSHandshake
+		}
+		if timing.TLSHandshake > 0 {
+			entry.Timings.SSL = timing.TLSHandshake
+		}
+		if wait := timing.FirstByte - timing.DNSLookup - timing.TCPConnect - timing.TLSHandshake; wait > 0 {
+			entry.Timings.Wait = wait
+		}
+		if receive := timing.Total - timing.FirstByte; receive > 0 {
+			entry.Timings.Receive = receive
+		}
+	}
+	return entry
+}
+
+// logTraffic appends a HAR entry for a completed round trip if a HAR log is configured
+func (s *Session) logTraffic(req *transport.Request, started time.Time, statusCode int, headers map[string][]string, proto string, timing *protocol.Timing) {
+	s.mu.RLock()
+	harLog := s.harLog
+	s.mu.RUnlock()
+	if harLog == nil {
+		return
+	}
+	if timing == nil {
+		timing = &protocol.Timing{Total: float64(time.Since(started)) / float64(time.Millisecond)}
+	}
+	// Logging must never fail the request
+	harLog.WriteEntry(newHAREntry(req, started, statusCode, headers, proto, timing))
+}
+
+func harHTTPVersion(proto string) string {
+	switch proto {
+	case "h2":
+		return "h2"
+	case "h3":
+		return "h3"
+	default:
+		return "HTTP/1.1"
+	}
+}
+
+func harHeaders(headers map[string][]string) []HARNameValue {
+	pairs := make([]HARNameValue, 0, len(headers))
+	for name, values := range headers {
+		for _, value := range values {
+			pairs = append(pairs, HARNameValue{Name: name, Value: value})
+		}
+	}
+	return pairs
+}
+
+func harQuery(rawURL string) []HARNameValue {
+	pairs := []HARNameValue{}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return pairs
+	}
+	for name, values := range u.Query() {
+		for _, value := range values {
+			pairs = append(pairs, HARNameValue{Name: name, Value: value})
+		}
+	}
+	return pairs
+}
+
+func firstHeader(headers map[string][]string, name string) string {
+	for key, values := range headers {
+		if len(values) > 0 && strings.EqualFold(key, name) {
+			return values[0]
+		}
+	}
+	return ""
+}
@@ -0,0 +1,77 @@
+package session
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/sardanioss/httpcloak/protocol"
+	"github.com/sardanioss/httpcloak/transport"
+)
+
+func TestHARWriter(t *testing.T) {
+	var log bytes.Buffer
+	w := NewHARWriter(&log)
+
+	req := &transport.Request{Method: "GET", URL: "https://example.com/a?q=1"}
+	headers := map[string][]string{"Location": {"/b"}, "Content-Length": {"0"}}
+	timing := &protocol.Timing{DNSLookup: 5, TCPConnect: 10, TLSHandshake: 20, FirstByte: 50, Total: 60}
+	if err := w.WriteEntry(newHAREntry(req, time.Now(), 302, headers, "h2", timing)); err != nil {
+		t.Fatalf("WriteEntry failed: %v", err)
+	}
+	req.URL = "https://example.com/b"
+	if err := w.WriteEntry(newHAREntry(req, time.Now(), 200, nil, "h2", nil)); err != nil {
+		t.Fatalf("WriteEntry failed: %v", err)
+	}
+	w.Close()
+
+	// Entries are flushed immediately, one per line
+	if lines := bytes.Count(log.Bytes(), []byte("\n")); lines != 2 {
+		t.Fatalf("expected 2 NDJSON lines, got %d", lines)
+	}
+
+	// A torn trailing line is skipped during conversion
+	log.WriteString(`{"startedDateTime":`)
+
+	var out bytes.Buffer
+	if err := WriteHAR(&out, &log); err != nil {
+		t.Fatalf("WriteHAR failed: %v", err)
+	}
+	var har struct {
+		Log struct {
+			Version string     `json:"version"`
+			Entries []HAREntry `json:"entries"`
+		} `json:"log"`
+	}
+	if err := json.Unmarshal(out.Bytes(), &har); err != nil {
+		t.Fatalf("invalid HAR output: %v", err)
+	}
+	if len(har.Log.Entries) != 2 {
+		t.Fatalf("expected 2 entries, got %d", len(har.Log.Entries))
+	}
+	first := har.Log.Entries[0]
+	if first.Response.RedirectURL != "/b" || first.Timings.Connect != 30 || first.Timings.Wait != 15 {
+		t.Errorf("unexpected first entry: %+v", first)
+	}
+	if len(first.Request.QueryString) != 1 || first.Request.QueryString[0].Name != "q" {
+		t.Errorf("unexpected query string: %+v", first.Request.QueryString)
+	}
+}
+
+// FuzzWriteHAR checks that any log, torn or corrupt, converts to valid JSON
+func FuzzWriteHAR(f *testing.F) {
+	f.Add([]byte(`{"startedDateTime":"2024-01-01T00:00:00Z","request":{"method":"GET"}}` + "\n"))
+	f.Add([]byte(`{"a":1}` + "\n" + `{"b":`))
+	f.Add([]byte("\n\n[]\n"))
+
+	f.Fuzz(func(t *testing.T, log []byte) {
+		var out bytes.Buffer
+		if err := WriteHAR(&out, bytes.NewReader(log)); err != nil {
+			return
+		}
+		if !json.Valid(out.Bytes()) {
+			t.Fatalf("invalid HAR from %q: %s", log, out.Bytes())
+		}
+	})
+}
@@ -0,0 +1,63 @@
+package session
+
+import (
+	"net/http"
+	"strings"
+)
+
+// SetHostHeaders sets headers every request to host must carry, e.g. a
+// Referer or an API key the site checks for. They are added to requests
+// that don't set the header themselves, redirects and retries included.
+// Nil headers removes the host's entry.
+func (s *Session) SetHostHeaders(host string, headers map[string][]string) {
+	host = strings.ToLower(host)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Copy on write: forks share the map
+	updated := make(map[string]map[string][]string, len(s.hostHeaders)+1)
+	for h, hdrs := range s.hostHeaders {
+		updated[h] = hdrs
+	}
+	if len(headers) == 0 {
+		delete(updated, host)
+	} else {
+		hdrs := make(map[string][]string, len(headers))
+		for name, values := range headers {
+			hdrs[name] = append([]string(nil), values...)
+		}
+		updated[host] = hdrs
+	}
+	s.hostHeaders = updated
+}
+
+// HostHeaders returns the headers set with SetHostHeaders, keyed by hostname
+func (s *Session) HostHeaders() map[string]map[string][]string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	result := make(map[string]map[string][]string, len(s.hostHeaders))
+	for host, hdrs := range s.hostHeaders {
+		result[host] = hdrs
+	}
+	return result
+}
+
+// applyHostHeaders adds the headers required by host that headers lacks
+func (s *Session) applyHostHeaders(host string, headers map[string][]string) {
+	s.mu.RLock()
+	required := s.hostHeaders[strings.ToLower(host)]
+	s.mu.RUnlock()
+
+	for name, values := range required {
+		present := false
+		for existing := range headers {
+			if strings.EqualFold(existing, name) {
+				present = true
+				break
+			}
+		}
+		if !present {
+			headers[http.CanonicalHeaderKey(name)] = values
+		}
+	}
+}
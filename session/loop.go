@@ -0,0 +1,142 @@
+package session
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/sardanioss/httpcloak/transport"
+)
+
+var (
+	// ErrRequestLoop matches every *LoopError
+	ErrRequestLoop = errors.New("request loop")
+
+	// ErrTooManyRedirects is returned when a redirect chain exceeds the
+	// redirect limit without repeating itself
+	ErrTooManyRedirects = errors.New("too many redirects")
+)
+
+// LoopKind classifies a LoopError
+type LoopKind string
+
+const (
+	// LoopRedirect is a redirect back to a URL the chain already requested
+	// with the same cookies, so the server would answer the same way again
+	LoopRedirect LoopKind = "redirect"
+	// LoopCookieRedirect is a server that keeps setting cookies and
+	// redirecting back to the same URL, usually because the cookies it
+	// expects are rejected (Domain, Secure or SameSite mismatch) or not
+	// enough to pass a check
+	LoopCookieRedirect LoopKind = "cookie-redirect"
+	// LoopChallenge is a retry that kept getting the same challenge page
+	// (Cloudflare, AWS WAF, DataDome), which retrying won't solve
+	LoopChallenge LoopKind = "challenge"
+)
+
+// cookieRedirectRevisits is how often a chain may come back to a URL with
+// new cookies before it counts as a cookie redirect loop. One revisit is the
+// common set-cookie-and-reload handshake.
+const cookieRedirectRevisits = 2
+
+// LoopError is returned instead of exhausting the redirect limit or the
+// retries when a request is going in circles. It matches ErrRequestLoop
+// with errors.Is.
+type LoopError struct {
+	Kind LoopKind
+
+	// URL is the URL the loop came back to, or the challenged URL
+	URL string
+
+	// StatusCode is the status of the last response
+	StatusCode int
+
+	// History is the redirect chain up to and including the hop that
+	// closed the loop
+	History []*transport.RedirectInfo
+
+	// Attempts is the number of round trips spent on the request
+	Attempts int
+}
+
+func (e *LoopError) Error() string {
+	switch e.Kind {
+	case LoopCookieRedirect:
+		return fmt.Sprintf("cookie redirect loop: %s keeps setting cookies and redirecting back (%d redirects)", e.URL, len(e.History))
+	case LoopChallenge:
+		return fmt.Sprintf("challenge loop: %s kept answering with a challenge (status %d, %d attempts)", e.URL, e.StatusCode, e.Attempts)
+	}
+	return fmt.Sprintf("redirect loop: %s was already requested with the same cookies (%d redirects)", e.URL, len(e.History))
+}
+
+func (e *LoopError) Is(target error) bool {
+	return target == ErrRequestLoop
+}
+
+// redirectVisit is one request of a redirect chain
+type redirectVisit struct {
+	method  string
+	url     string
+	cookies string // session cookies sent
+}
+
+// checkRedirectLoop reports the loop following a redirect to next would
+// close, given the requests the chain already made
+func checkRedirectLoop(visits []redirectVisit, next redirectVisit) (LoopKind, bool) {
+	revisits := 0
+	for _, v := range visits {
+		if v.method != next.method || v.url != next.url {
+			continue
+		}
+		if v.cookies == next.cookies {
+			return LoopRedirect, true
+		}
+		revisits++
+	}
+	if revisits >= cookieRedirectRevisits {
+		return LoopCookieRedirect, true
+	}
+	return "", false
+}
+
+// SetChallengeCheck adds a check for the challenge pages of specific sites
+// to the built-in ones, which only look at headers. The response body has
+// been read and is available through resp.Bytes. Nil removes the check.
+func (s *Session) SetChallengeCheck(check func(resp *transport.Response) bool) {
+	s.mu.Lock()
+	s.challengeCheck = check
+	s.mu.Unlock()
+}
+
+// isChallenge reports whether resp is a challenge page
+func (s *Session) isChallenge(resp *transport.Response) bool {
+	if isChallengeResponse(resp.StatusCode, resp.Headers) {
+		return true
+	}
+	s.mu.RLock()
+	check := s.challengeCheck
+	s.mu.RUnlock()
+	return check != nil && check(resp)
+}
+
+// isChallengeResponse reports responses that are challenge pages by their
+// headers alone
+func isChallengeResponse(status int, headers map[string][]string) bool {
+	value := func(name string) string {
+		for key, values := range headers {
+			if strings.EqualFold(key, name) && len(values) > 0 {
+				return strings.ToLower(values[0])
+			}
+		}
+		return ""
+	}
+	switch {
+	case value("cf-mitigated") == "challenge":
+		return true
+	case value("x-amzn-waf-action") == "challenge" || value("x-amzn-waf-action") == "captcha":
+		return true
+	case status == 403 && value("x-datadome") != "":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,79 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/sardanioss/httpcloak/protocol"
+	"github.com/sardanioss/httpcloak/transport"
+)
+
+func TestRequestLoops(t *testing.T) {
+	hits := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		switch r.URL.Path {
+		case "/a":
+			http.Redirect(w, r, "/b", http.StatusFound)
+		case "/b":
+			http.Redirect(w, r, "/a", http.StatusFound)
+		case "/handshake":
+			// Sets a cookie and reloads once, as bot checks commonly do
+			if _, err := r.Cookie("ok"); err != nil {
+				http.SetCookie(w, &http.Cookie{Name: "ok", Value: "1"})
+				http.Redirect(w, r, "/handshake", http.StatusFound)
+				return
+			}
+			w.Write([]byte("done"))
+		case "/cookie-loop":
+			http.SetCookie(w, &http.Cookie{Name: "n", Value: strconv.Itoa(hits)})
+			http.Redirect(w, r, "/cookie-loop", http.StatusFound)
+		case "/challenge":
+			w.Header().Set("cf-mitigated", "challenge")
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case "/challenge-200":
+			w.Header().Set("cf-mitigated", "challenge")
+		case "/challenge-403":
+			w.Header().Set("x-datadome", "protected")
+			w.WriteHeader(http.StatusForbidden)
+		}
+	}))
+	defer srv.Close()
+
+	config := &protocol.SessionConfig{
+		Preset:          "chrome-latest",
+		FollowRedirects: true,
+		ForceHTTP1:      true,
+		RetryEnabled:    true,
+		MaxRetries:      5,
+		RetryWaitMin:    1,
+		RetryWaitMax:    1,
+	}
+	s := NewSession("", config)
+	defer s.Close()
+	get := func(path string) (*transport.Response, error) {
+		hits = 0
+		return s.Request(context.Background(), &transport.Request{Method: "GET", URL: srv.URL + path})
+	}
+
+	var loop *LoopError
+	if _, err := get("/a"); !errors.As(err, &loop) || loop.Kind != LoopRedirect || len(loop.History) != 2 || !errors.Is(err, ErrRequestLoop) {
+		t.Errorf("/a: got %v", err)
+	}
+	if resp, err := get("/handshake"); err != nil || resp.StatusCode != 200 {
+		t.Errorf("/handshake: got %v", err)
+	}
+	if _, err := get("/cookie-loop"); !errors.As(err, &loop) || loop.Kind != LoopCookieRedirect {
+		t.Errorf("/cookie-loop: got %v", err)
+	}
+	// Challenges are detected whether or not their status is retryable
+	for _, path := range []string{"/challenge", "/challenge-200", "/challenge-403"} {
+		if _, err := get(path); !errors.As(err, &loop) || loop.Kind != LoopChallenge || hits != 2 {
+			t.Errorf("%s: got %v after %d requests", path, err, hits)
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/sardanioss/httpcloak/protocol"
+	"github.com/sardanioss/httpcloak/transport"
+)
+
+func TestPermanentRedirectCache(t *testing.T) {
+	var mu sync.Mutex
+	hits := make(map[string]int)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		hits[r.URL.Path]++
+		mu.Unlock()
+		switch r.URL.Path {
+		case "/old":
+			http.Redirect(w, r, "/new", http.StatusMovedPermanently)
+		case "/moved":
+			http.Redirect(w, r, "/dest", http.StatusPermanentRedirect)
+		case "/a":
+			http.Redirect(w, r, "/b", http.StatusMovedPermanently)
+		case "/b":
+			http.Redirect(w, r, "/a", http.StatusMovedPermanently)
+		default:
+			body, _ := io.ReadAll(r.Body)
+			w.Write([]byte(r.Method + " " + string(body)))
+		}
+	}))
+	defer srv.Close()
+	hitsFor := func(path string) int {
+		mu.Lock()
+		defer mu.Unlock()
+		return hits[path]
+	}
+
+	s := NewSession("", &protocol.SessionConfig{
+		Preset:                  "chrome-latest",
+		FollowRedirects:         true,
+		CachePermanentRedirects: true,
+		ForceHTTP1:              true,
+	})
+	defer s.Close()
+	do := func(method, path string, body []byte) *transport.Response {
+		t.Helper()
+		resp, err := s.Request(context.Background(), &transport.Request{Method: method, URL: srv.URL + path, Body: body})
+		if err != nil {
+			t.Fatalf("%s %s: %v", method, path, err)
+		}
+		return resp
+	}
+
+	// The first GET follows the 301, the second goes straight to the target
+	do("GET", "/old", nil)
+	resp := do("GET", "/old", nil)
+	if hitsFor("/old") != 1 || hitsFor("/new") != 2 {
+		t.Errorf("cache hit: /old asked %d times, /new %d", hitsFor("/old"), hitsFor("/new"))
+	}
+	if len(resp.History) != 1 || resp.History[0].StatusCode != 301 || resp.History[0].URL != srv.URL+"/old" {
+		t.Errorf("cache hit history = %+v, want the remembered 301", resp.History)
+	}
+	if got := s.PermanentRedirects()[srv.URL+"/old"]; got.StatusCode != 301 || got.Location != srv.URL+"/new" {
+		t.Errorf("PermanentRedirects[/old] = %+v", got)
+	}
+
+	// A 301 may turn POST into GET, so it's not applied to a POST
+	do("POST", "/old", []byte("x"))
+	if hitsFor("/old") != 2 {
+		t.Errorf("POST used the cached 301: /old asked %d times, want 2", hitsFor("/old"))
+	}
+
+	// A 308 keeps the method and body, so it is
+	do("POST", "/moved", []byte("first"))
+	resp = do("POST", "/moved", []byte("second"))
+	if hitsFor("/moved") != 1 {
+		t.Errorf("POST did not use the cached 308: /moved asked %d times, want 1", hitsFor("/moved"))
+	}
+	if data, _ := resp.Bytes(); string(data) != "POST second" {
+		t.Errorf("308 cache hit got %q, want POST second", data)
+	}
+
+	// A cached loop ends after one round instead of spinning
+	var loopErr *LoopError
+	if _, err := s.Request(context.Background(), &transport.Request{Method: "GET", URL: srv.URL + "/a"}); !errors.As(err, &loopErr) {
+		t.Fatalf("GET /a: err = %v, want a LoopError", err)
+	}
+	s.mu.Lock()
+	target, hops := s.resolvePermanentRedirect(srv.URL+"/a", "GET")
+	s.mu.Unlock()
+	if target != srv.URL+"/a" || len(hops) != 2 {
+		t.Errorf("resolvePermanentRedirect(/a) = %s after %d hops, want /a after 2", target, len(hops))
+	}
+	if _, err := s.Request(context.Background(), &transport.Request{Method: "GET", URL: srv.URL + "/a"}); !errors.As(err, &loopErr) {
+		t.Errorf("GET /a with the loop cached: err = %v, want a LoopError", err)
+	}
+
+	// Forks get a copy of the cache
+	fork := s.Fork(1)[0]
+	defer fork.Close()
+	if _, ok := fork.PermanentRedirects()[srv.URL+"/old"]; !ok {
+		t.Fatal("fork did not inherit the cached redirects")
+	}
+	fork.ForgetPermanentRedirect(srv.URL + "/moved")
+	if _, ok := s.PermanentRedirects()[srv.URL+"/moved"]; !ok || len(fork.PermanentRedirects()) != 3 {
+		t.Errorf("forgetting on the fork: fork has %d redirects, parent kept /moved: %v", len(fork.PermanentRedirects()), ok)
+	}
+
+	// Forgetting a redirect sends the next request to the original URL
+	s.ForgetPermanentRedirect(srv.URL + "/old")
+	do("GET", "/old", nil)
+	if hitsFor("/old") != 3 {
+		t.Errorf("after ForgetPermanentRedirect /old asked %d times, want 3", hitsFor("/old"))
+	}
+	s.ClearPermanentRedirects()
+	if n := len(s.PermanentRedirects()); n != 0 {
+		t.Errorf("%d redirects after ClearPermanentRedirects", n)
+	}
+	do("POST", "/moved", nil)
+	if hitsFor("/moved") != 2 {
+		t.Errorf("after ClearPermanentRedirects /moved asked %d times, want 2", hitsFor("/moved"))
+	}
+}
+
+func TestPermanentRedirectCacheLimits(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/old" {
+			http.Redirect(w, r, "/new", http.StatusMovedPermanently)
+		}
+	}))
+	defer srv.Close()
+
+	// Nothing is remembered while the option is off
+	s := NewSession("", &protocol.SessionConfig{Preset: "chrome-latest", FollowRedirects: true, ForceHTTP1: true})
+	defer s.Close()
+	if _, err := s.Request(context.Background(), &transport.Request{Method: "GET", URL: srv.URL + "/old"}); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(s.PermanentRedirects()); n != 0 {
+		t.Errorf("%d redirects remembered with CachePermanentRedirects off", n)
+	}
+
+	// Past the cap the least recently used redirect goes first
+	s.mu.Lock()
+	for i := 0; i < maxPermanentRedirects; i++ {
+		s.rememberPermanentRedirect(fmt.Sprintf("https://example.com/%d", i), PermanentRedirect{StatusCode: 308, Location: "https://example.com/"})
+	}
+	s.resolvePermanentRedirect("https://example.com/0", "GET")
+	s.rememberPermanentRedirect("https://example.com/new", PermanentRedirect{StatusCode: 308, Location: "https://example.com/"})
+	s.mu.Unlock()
+	redirects := s.PermanentRedirects()
+	if len(redirects) != maxPermanentRedirects {
+		t.Errorf("%d redirects remembered, want %d", len(redirects), maxPermanentRedirects)
+	}
+	for url, want := range map[string]bool{"https://example.com/0": true, "https://example.com/1": false, "https://example.com/new": true} {
+		if _, ok := redirects[url]; ok != want {
+			t.Errorf("%s remembered = %v, want %v", url, ok, want)
+		}
+	}
+}
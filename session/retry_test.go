@@ -0,0 +1,60 @@
+package session
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/sardanioss/httpcloak/protocol"
+	"github.com/sardanioss/httpcloak/transport"
+)
+
+func TestRetryDeadlineAndHistory(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	newSession := func(waitMs int) *Session {
+		s := NewSession("", &protocol.SessionConfig{
+			Preset:       "chrome-latest",
+			ForceHTTP1:   true,
+			RetryEnabled: true,
+			MaxRetries:   2,
+			RetryWaitMin: waitMs,
+			RetryWaitMax: waitMs,
+		})
+		t.Cleanup(s.Close)
+		return s
+	}
+
+	resp, err := newSession(1).Request(context.Background(), &transport.Request{Method: "GET", URL: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.RetryHistory) != 3 {
+		t.Fatalf("RetryHistory = %+v, want 3 attempts", resp.RetryHistory)
+	}
+	for i, a := range resp.RetryHistory {
+		if a.StatusCode != 503 || a.Protocol != "h1" || a.Proxy != transport.ViaDirect || a.Latency <= 0 {
+			t.Errorf("attempt %d = %+v", i, a)
+		}
+		if last := i == len(resp.RetryHistory)-1; last != (a.Backoff == 0) {
+			t.Errorf("attempt %d backoff = %v", i, a.Backoff)
+		}
+	}
+
+	// A 10s backoff doesn't fit a 500ms deadline: the 503 comes back at once
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	started := time.Now()
+	resp, err = newSession(10000).Request(ctx, &transport.Request{Method: "GET", URL: srv.URL})
+	if err != nil {
+		t.Fatalf("err = %v, want the 503", err)
+	}
+	if resp.StatusCode != 503 || len(resp.RetryHistory) != 1 || time.Since(started) > 400*time.Millisecond {
+		t.Errorf("status %d after %d attempts in %v", resp.StatusCode, len(resp.RetryHistory), time.Since(started))
+	}
+}
@@ -11,11 +11,15 @@ import (
 	"io"
 	"net/url"
 	"os"
+	"slices"
+	"strconv"
 	"sync"
 	"time"
 
+	"github.com/sardanioss/httpcloak/dns"
 	"github.com/sardanioss/httpcloak/fingerprint"
 	"github.com/sardanioss/httpcloak/protocol"
+	"github.com/sardanioss/httpcloak/proxy"
 	"github.com/sardanioss/httpcloak/transport"
 )
 
@@ -28,6 +32,10 @@ func generateID() string {
 
 var (
 	ErrSessionClosed = errors.New("session is closed")
+
+	// ErrAttemptBudgetExceeded is returned when redirects and retries for a single
+	// request would exceed the shared attempt ceiling (SessionConfig.MaxAttempts)
+	ErrAttemptBudgetExceeded = errors.New("request attempt budget exceeded")
 )
 
 // SessionOptions contains additional options that can't be expressed in protocol.SessionConfig
@@ -45,11 +53,88 @@ type SessionOptions struct {
 	// CustomJA3Extras provides extension data that JA3 cannot capture
 	CustomJA3Extras *fingerprint.JA3Extras
 
+	// CustomClientHello is a captured raw ClientHello to replay (see fingerprint.FromRawClientHello)
+	CustomClientHello []byte
+
+	// ExtensionControl tunes GREASE and TLS extension order
+	ExtensionControl *fingerprint.ExtensionControl
+
+	// H2Ping schedules HTTP/2 keepalive PINGs
+	H2Ping *transport.H2PingConfig
+
+	// QUIC tunes HTTP/3 connections (per-host limit, handshake timeout, early data)
+	QUIC *transport.QUICOptions
+
+	// ProxyFallback retries through backup proxies or directly when the proxy fails
+	ProxyFallback *transport.ProxyFallback
+
+	// ProxyPool rotates requests across proxies when no proxy is set
+	ProxyPool *proxy.Pool
+
+	// ProxyNegotiate answers an HTTP proxy's Negotiate challenges with Kerberos tokens
+	ProxyNegotiate proxy.NegotiateFunc
+
+	// ProxyFromEnvironment uses HTTP_PROXY/HTTPS_PROXY/NO_PROXY/ALL_PROXY when no proxy is set
+	ProxyFromEnvironment bool
+
+	// ProxySelector picks each request's proxies when no proxy is set
+	ProxySelector proxy.Selector
+
+	// ProxyTLS configures the TLS connection to https:// proxies
+	ProxyTLS *transport.ProxyTLSConfig
+
+	// ClientCertificates are presented to servers that request one (mTLS)
+	ClientCertificates *transport.ClientCertificates
+
+	// CertPinner verifies server certificates (e.g., SPKI pins) on every handshake
+	CertPinner transport.CertificatePinner
+
+	// RevocationCheck verifies OCSP staples and optionally checks revocation online
+	RevocationCheck *transport.RevocationCheck
+
+	// LowFootprint closes idle connections sooner (see transport.TransportConfig.LowFootprint)
+	LowFootprint bool
+
+	// TrafficBudgets cap the bytes exchanged per time window, session-wide or per host
+	TrafficBudgets []TrafficBudget
+
+	// DisableECHHosts turns ECH off for specific hosts (GREASE ECH is still sent)
+	DisableECHHosts map[string]bool
+
+	// PostQuantum overrides the preset's X25519MLKEM768 key share, session-wide and per host
+	PostQuantum      *bool
+	PostQuantumHosts map[string]bool
+
 	// CustomH2Settings overrides the preset's HTTP/2 settings (from Akamai fingerprint)
 	CustomH2Settings *fingerprint.HTTP2Settings
 
+	// CustomH2Spec overrides the preset's full HTTP/2 fingerprint
+	CustomH2Spec *fingerprint.H2Spec
+
+	// CustomH3Settings overrides the preset's HTTP/3 SETTINGS frame
+	CustomH3Settings *fingerprint.H3Settings
+
+	// H2PriorityScheme overrides how HTTP/2 requests signal priority
+	H2PriorityScheme fingerprint.H2PriorityScheme
+
 	// CustomPseudoOrder overrides the pseudo-header order (from Akamai fingerprint)
 	CustomPseudoOrder []string
+
+	// HostPolicy restricts which hosts the session may contact (SSRF guard)
+	HostPolicy *transport.HostPolicy
+
+	// HeaderLimits bounds response header blocks per protocol
+	HeaderLimits *transport.ResponseHeaderLimits
+
+	// TCPOptions aligns direct TCP connections with the preset's OS
+	TCPOptions *transport.TCPOptions
+
+	// PoolLimits bounds the connection pools
+	PoolLimits *transport.PoolLimits
+
+	// HARLog receives a HAR entry for every round trip. The caller keeps
+	// ownership; Close on the session does not close it.
+	HARLog *HARWriter
 }
 
 // cacheEntry stores cache validation headers for a URL
@@ -58,7 +143,28 @@ type cacheEntry struct {
 	lastModified string // Last-Modified header value
 }
 
-// Session represents a persistent HTTP session with connection affinity
+// PermanentRedirect is a remembered 301/308 redirect
+type PermanentRedirect struct {
+	StatusCode int    // 301 or 308
+	Location   string // Absolute target URL
+}
+
+// maxPermanentRedirects caps the permanent redirects a session remembers;
+// the least recently used one is dropped first
+const maxPermanentRedirects = 256
+
+// Session represents a persistent HTTP session with connection affinity.
+//
+// All methods are safe for concurrent use. Reconfiguration (SetProxy,
+// SetTCPProxy, SetUDPProxy) doesn't wait for in-flight requests: they finish
+// on the old transports, which are closed once the requests return, while new
+// requests use the new ones. Streaming responses that are still being read
+// are cut off when their connection is closed, as are requests in flight
+// during Refresh and RefreshWithProtocol. Close does not wait - cancel
+// request contexts to abort in-flight requests. The exported
+// ID, CreatedAt, LastUsed, RequestCount and Config fields are guarded by the
+// session lock - read them through Stats rather than directly while requests
+// are running.
 type Session struct {
 	ID           string
 	CreatedAt    time.Time
@@ -73,6 +179,14 @@ type Session struct {
 	// Cache validation headers per URL (for If-None-Match, If-Modified-Since)
 	cacheEntries map[string]*cacheEntry
 
+	// Permanent redirects (301/308) seen by this session, keyed by source URL,
+	// and their LRU order: oldest at front, newest at back
+	permanentRedirects map[string]PermanentRedirect
+	redirectOrder      []string
+
+	// Parsed sitemaps keyed by URL, replayed when a refresh gets 304
+	sitemaps map[string]*sitemapDoc
+
 	// Client hints requested by each host via Accept-CH header
 	// Key: host (e.g., "example.com"), Value: set of requested hint names
 	clientHints map[string]map[string]bool
@@ -80,12 +194,37 @@ type Session struct {
 	// Key log writer for TLS traffic decryption (Wireshark)
 	keyLogWriter io.WriteCloser
 
+	// HAR traffic log; ownsHARLog is set when the session opened it from HARLogFile
+	harLog     *HARWriter
+	ownsHARLog bool
+
+	// WARC archive; ownsWARC is set when EnableWARC opened it
+	warc     *WARCWriter
+	ownsWARC bool
+
+	// Content-Type handlers for Warmup responses (see OnContentType)
+	contentRoutes []contentRoute
+
 	// refreshed indicates Refresh() was called - adds cache-control: max-age=0 to requests
 	refreshed bool
 
 	// switchProtocol is the protocol to switch to on Refresh()
 	switchProtocol transport.Protocol
 
+	// Background ticket refresh (see TicketRefreshAfter); hostUse counts
+	// requests per host:port and is nil when refresh is off
+	hostUse           map[string]int
+	stopTicketRefresh chan struct{}
+
+	// Byte and request caps per time window (see TrafficBudget)
+	trafficBudgets []*trafficBudget
+
+	// Headers required per hostname (see SetHostHeaders)
+	hostHeaders map[string]map[string][]string
+
+	// challengeCheck recognizes challenge pages beyond the built-in ones
+	challengeCheck func(resp *transport.Response) bool
+
 	mu     sync.RWMutex
 	active bool
 }
@@ -124,10 +263,23 @@ func NewSessionWithOptions(id string, config *protocol.SessionConfig, opts *Sess
 		}
 	}
 
+	// Open HAR traffic log if requested (an explicit writer takes precedence)
+	var harLog *HARWriter
+	ownsHARLog := false
+	if opts != nil && opts.HARLog != nil {
+		harLog = opts.HARLog
+	} else if config.HARLogFile != "" {
+		if w, err := OpenHARLog(config.HARLogFile); err == nil {
+			// Traffic logging is optional - continue without it on error
+			harLog = w
+			ownsHARLog = true
+		}
+	}
+
 	// Create transport config with ConnectTo, ECH, TLS-only, QUIC timeout, localAddr, and session cache settings
 	var transportConfig *transport.TransportConfig
-	needsConfig := len(config.ConnectTo) > 0 || config.ECHConfigDomain != "" || config.TLSOnly || config.QuicIdleTimeout > 0 || config.LocalAddress != "" || keyLogWriter != nil || config.EnableSpeculativeTLS
-	if opts != nil && (opts.SessionCacheBackend != nil || opts.CustomJA3 != "" || opts.CustomH2Settings != nil || len(opts.CustomPseudoOrder) > 0) {
+	needsConfig := len(config.ConnectTo) > 0 || config.ECHConfigDomain != "" || config.TLSOnly || config.QuicIdleTimeout > 0 || config.QuicKeepAlive != 0 || config.LocalAddress != "" || keyLogWriter != nil || config.EnableSpeculativeTLS || config.SSRFProtection || config.TargetJA4 != "" || config.TargetJA4H != "" || config.StrictConformance || config.FirstByteTimeout > 0 || config.StallTimeout > 0
+	if opts != nil && (opts.SessionCacheBackend != nil || opts.CustomJA3 != "" || len(opts.CustomClientHello) > 0 || opts.ExtensionControl != nil || opts.H2Ping != nil || opts.QUIC != nil || opts.ProxyFallback != nil || opts.ProxyPool != nil || opts.ProxyNegotiate != nil || opts.ProxyFromEnvironment || opts.ProxySelector != nil || opts.ProxyTLS != nil || opts.ClientCertificates != nil || opts.CertPinner != nil || opts.RevocationCheck != nil || opts.LowFootprint || len(opts.DisableECHHosts) > 0 || opts.PostQuantum != nil || len(opts.PostQuantumHosts) > 0 || opts.CustomH2Settings != nil || opts.CustomH2Spec != nil || opts.CustomH3Settings != nil || opts.H2PriorityScheme != "" || len(opts.CustomPseudoOrder) > 0 || opts.HostPolicy != nil || opts.HeaderLimits != nil || opts.TCPOptions != nil || opts.PoolLimits != nil) {
 		needsConfig = true
 	}
 
@@ -137,9 +289,16 @@ func NewSessionWithOptions(id string, config *protocol.SessionConfig, opts *Sess
 			ECHConfigDomain:       config.ECHConfigDomain,
 			TLSOnly:              config.TLSOnly,
 			QuicIdleTimeout:      time.Duration(config.QuicIdleTimeout) * time.Second,
+			QuicKeepAlive:        time.Duration(config.QuicKeepAlive) * time.Millisecond,
 			LocalAddr:            config.LocalAddress,
 			KeyLogWriter:         keyLogWriter,
 			EnableSpeculativeTLS: config.EnableSpeculativeTLS,
+			SSRFProtection:       config.SSRFProtection,
+			TargetJA4:            config.TargetJA4,
+			TargetJA4H:           config.TargetJA4H,
+			StrictConformance:    config.StrictConformance,
+			FirstByteTimeout:     time.Duration(config.FirstByteTimeout) * time.Millisecond,
+			StallTimeout:         time.Duration(config.StallTimeout) * time.Millisecond,
 		}
 		// Add session cache backend if provided
 		if opts != nil {
@@ -148,8 +307,32 @@ func NewSessionWithOptions(id string, config *protocol.SessionConfig, opts *Sess
 			// Add custom fingerprint settings
 			transportConfig.CustomJA3 = opts.CustomJA3
 			transportConfig.CustomJA3Extras = opts.CustomJA3Extras
+			transportConfig.CustomClientHello = opts.CustomClientHello
+			transportConfig.ExtensionControl = opts.ExtensionControl
+			transportConfig.H2Ping = opts.H2Ping
+			transportConfig.QUIC = opts.QUIC
+			transportConfig.ProxyFallback = opts.ProxyFallback
+			transportConfig.ProxyPool = opts.ProxyPool
+			transportConfig.ProxyNegotiate = opts.ProxyNegotiate
+			transportConfig.ProxyFromEnvironment = opts.ProxyFromEnvironment
+			transportConfig.ProxySelector = opts.ProxySelector
+			transportConfig.ProxyTLS = opts.ProxyTLS
+			transportConfig.ClientCertificates = opts.ClientCertificates
+			transportConfig.CertPinner = opts.CertPinner
+			transportConfig.RevocationCheck = opts.RevocationCheck
+			transportConfig.LowFootprint = opts.LowFootprint
+			transportConfig.DisableECHHosts = opts.DisableECHHosts
+			transportConfig.PostQuantum = opts.PostQuantum
+			transportConfig.PostQuantumHosts = opts.PostQuantumHosts
 			transportConfig.CustomH2Settings = opts.CustomH2Settings
+			transportConfig.CustomH2Spec = opts.CustomH2Spec
+			transportConfig.CustomH3Settings = opts.CustomH3Settings
+			transportConfig.H2PriorityScheme = opts.H2PriorityScheme
 			transportConfig.CustomPseudoOrder = opts.CustomPseudoOrder
+			transportConfig.HostPolicy = opts.HostPolicy
+			transportConfig.HeaderLimits = opts.HeaderLimits
+			transportConfig.TCPOptions = opts.TCPOptions
+			transportConfig.PoolLimits = opts.PoolLimits
 		}
 	}
 
@@ -187,6 +370,11 @@ func NewSessionWithOptions(id string, config *protocol.SessionConfig, opts *Sess
 			dnsCache.SetPreferIPv4(true)
 		}
 	}
+	if family, err := dns.ParseIPFamily(config.IPFamily); err == nil && family != dns.IPFamilyAny {
+		if dnsCache := t.GetDNSCache(); dnsCache != nil {
+			dnsCache.SetIPFamily(family)
+		}
+	}
 
 	// Disable ECH lookup for faster first request
 	if config.DisableECH {
@@ -202,29 +390,91 @@ func NewSessionWithOptions(id string, config *protocol.SessionConfig, opts *Sess
 		}
 	}
 
-	return &Session{
-		ID:             id,
-		CreatedAt:      time.Now(),
-		LastUsed:       time.Now(),
-		RequestCount:   0,
-		Config:         config,
-		transport:      t,
-		cookies:        NewCookieJar(),
-		cacheEntries:   make(map[string]*cacheEntry),
-		clientHints:    make(map[string]map[string]bool),
-		keyLogWriter:   keyLogWriter,
-		switchProtocol: switchProto,
-		active:         true,
+	s := &Session{
+		ID:                 id,
+		CreatedAt:          time.Now(),
+		LastUsed:           time.Now(),
+		RequestCount:       0,
+		Config:             config,
+		transport:          t,
+		cookies:            NewCookieJar(),
+		cacheEntries:       make(map[string]*cacheEntry),
+		permanentRedirects: make(map[string]PermanentRedirect),
+		clientHints:        make(map[string]map[string]bool),
+		keyLogWriter:       keyLogWriter,
+		harLog:             harLog,
+		ownsHARLog:         ownsHARLog,
+		switchProtocol:     switchProto,
+		active:             true,
+	}
+	if opts != nil {
+		s.trafficBudgets = newTrafficBudgets(opts.TrafficBudgets)
+	}
+	if config.CookieSkewTolerance > 0 {
+		s.cookies.SetSkewTolerance(time.Duration(config.CookieSkewTolerance) * time.Second)
+	}
+	if config.TicketRefreshAfter > 0 {
+		s.startTicketRefresh(time.Duration(config.TicketRefreshAfter) * time.Second)
 	}
+	return s
 }
 
-// Request executes an HTTP request within this session
-func (s *Session) Request(ctx context.Context, req *transport.Request) (*transport.Response, error) {
-	return s.requestWithRedirects(ctx, req, 0, nil)
+// Request executes an HTTP request within this session. A panic while
+// executing it is returned as a *transport.PanicError.
+func (s *Session) Request(ctx context.Context, req *transport.Request) (resp *transport.Response, err error) {
+	defer transport.RecoverPanic(&resp, &err)
+	s.captureUpload(req)
+	return s.requestWithRedirects(ctx, req, 0, 0, &requestTraffic{}, nil)
 }
 
-// requestWithRedirects handles the actual request with redirect following
-func (s *Session) requestWithRedirects(ctx context.Context, req *transport.Request, redirectCount int, history []*transport.RedirectInfo) (*transport.Response, error) {
+// retryAttempt describes a round trip for Response.RetryHistory
+func (s *Session) retryAttempt(url string, started time.Time, resp *transport.Response, err error) transport.RetryAttempt {
+	a := transport.RetryAttempt{URL: url, Err: err, Latency: time.Since(started), Proxy: s.transport.ProxyLabel()}
+	if resp != nil {
+		a.StatusCode = resp.StatusCode
+		a.Protocol = resp.Protocol
+		if resp.Via != "" {
+			a.Proxy = resp.Via
+		}
+	}
+	var te *transport.TransportError
+	if errors.As(err, &te) {
+		a.Protocol = te.Protocol
+	}
+	return a
+}
+
+// maxAttempts returns the ceiling on transport round trips for a single request,
+// shared between retries and redirects
+func (s *Session) maxAttempts() int {
+	if s.Config == nil {
+		return 11 // Default redirect limit + initial request
+	}
+	if s.Config.MaxAttempts > 0 {
+		return s.Config.MaxAttempts
+	}
+	maxRedirects := 10
+	if s.Config.MaxRedirects > 0 {
+		maxRedirects = s.Config.MaxRedirects
+	}
+	maxRetries := 0
+	if s.Config.RetryEnabled && s.Config.MaxRetries > 0 {
+		maxRetries = s.Config.MaxRetries
+	}
+	return maxRedirects + maxRetries + 1
+}
+
+// requestTraffic sums the bytes a request exchanged across retries and
+// redirects and records the requests its redirect chain made and each round trip
+type requestTraffic struct {
+	sent, received int64
+	visits         []redirectVisit
+	attempts       []transport.RetryAttempt
+}
+
+// requestWithRedirects handles the actual request with redirect following.
+// attempts is the number of round trips already spent on this request by earlier hops.
+func (s *Session) requestWithRedirects(ctx context.Context, req *transport.Request, redirectCount, attempts int, traffic *requestTraffic, history []*transport.RedirectInfo) (*transport.Response, error) {
 	s.mu.Lock()
 	if !s.active {
 		s.mu.Unlock()
@@ -232,11 +482,22 @@ func (s *Session) requestWithRedirects(ctx context.Context, req *transport.Reque
 	}
 	s.LastUsed = time.Now()
 	s.RequestCount++
+	if s.hostUse != nil {
+		s.recordHostUse(req.URL)
+	}
 
 	if req.Headers == nil {
 		req.Headers = make(map[string][]string)
 	}
 
+	// Jump straight to the target of a remembered permanent redirect
+	if s.Config != nil && s.Config.CachePermanentRedirects && !req.NoRedirect {
+		if target, hops := s.resolvePermanentRedirect(req.URL, req.Method); hops != nil {
+			history = append(history, hops...)
+			req.URL = target
+		}
+	}
+
 	// Add cache-control: max-age=0 if session was refreshed (simulates browser F5)
 	if s.refreshed {
 		req.Headers["cache-control"] = []string{"max-age=0"}
@@ -244,7 +505,7 @@ func (s *Session) requestWithRedirects(ctx context.Context, req *transport.Reque
 
 	// Add cache validation headers (If-None-Match, If-Modified-Since)
 	// This makes requests look like a real browser that caches resources
-	if cached, exists := s.cacheEntries[req.URL]; exists {
+	if cached, exists := s.cacheEntries[s.cacheKey(ctx, req.URL)]; exists {
 		if cached.etag != "" {
 			req.Headers["If-None-Match"] = []string{cached.etag}
 		}
@@ -263,7 +524,7 @@ func (s *Session) requestWithRedirects(ctx context.Context, req *transport.Reque
 	retryWaitMax := 10 * time.Second
 	var retryOnStatus []int
 
-	if s.Config != nil && s.Config.RetryEnabled && s.Config.MaxRetries > 0 {
+	if s.Config != nil && s.Config.RetryEnabled && s.Config.MaxRetries > 0 && !req.NoRetry {
 		maxRetries = s.Config.MaxRetries
 		if s.Config.RetryWaitMin > 0 {
 			retryWaitMin = time.Duration(s.Config.RetryWaitMin) * time.Millisecond
@@ -293,9 +554,17 @@ func (s *Session) requestWithRedirects(ctx context.Context, req *transport.Reque
 		origCookie = c[0]
 	}
 
+	attemptBudget := s.maxAttempts()
+	if attempts >= attemptBudget {
+		return nil, fmt.Errorf("%w: %d attempts after %d redirects", ErrAttemptBudgetExceeded, attempts, redirectCount)
+	}
+
+	var sentCookies string
+	challenges := 0
 	for attempt := 0; attempt <= maxRetries; attempt++ {
 		// Build Cookie header fresh each attempt from original + session cookies
 		sessionCookies := s.cookies.BuildCookieHeader(requestHost, requestPath, requestSecure)
+		sentCookies = sessionCookies
 		if sessionCookies != "" {
 			if origCookie != "" {
 				req.Headers["Cookie"] = []string{origCookie + "; " + sessionCookies}
@@ -307,9 +576,24 @@ func (s *Session) requestWithRedirects(ctx context.Context, req *transport.Reque
 		}
 
 		// Apply high-entropy client hints if the host requested them via Accept-CH
+		s.applyHostHeaders(host, req.Headers)
 		s.applyClientHints(host, req.Headers)
 
+		if err := s.waitTrafficBudget(ctx, host); err != nil {
+			return nil, err
+		}
+
+		started := time.Now()
 		resp, err = s.transport.Do(ctx, req)
+		attempts++
+		traffic.attempts = append(traffic.attempts, s.retryAttempt(req.URL, started, resp, err))
+		if resp != nil {
+			s.logTraffic(req, started, resp.StatusCode, resp.Headers, resp.Protocol, resp.Timing)
+			s.archiveExchange(req, started, resp)
+			traffic.sent += resp.BytesSent
+			traffic.received += resp.BytesReceived
+			s.chargeTrafficBudget(host, resp.BytesSent+resp.BytesReceived)
+		}
 
 		// If no error and no retry config, or this is the last attempt, break
 		if maxRetries == 0 {
@@ -319,16 +603,36 @@ func (s *Session) requestWithRedirects(ctx context.Context, req *transport.Reque
 		// Extract cookies from EVERY response (even 429s, 500s, etc.)
 		// This mimics browser behavior where cookies are stored regardless of status
 		if resp != nil {
-			s.extractCookies(resp.Headers, req.URL)
+			s.extractCookies(resp.Headers, req.URL, history)
 			// Also parse Accept-CH from intermediate responses
 			s.parseAcceptCH(host, resp.Headers)
 		}
 
+		// A challenge page is retried whatever its status, as the cookies it
+		// sets may pass it, but one that comes back won't go away by retrying
+		challenged := resp != nil && s.isChallenge(resp)
+		if challenged {
+			challenges++
+		} else {
+			challenges = 0
+		}
+		if challenges >= 2 {
+			if resp.Body != nil {
+				resp.Body.Close()
+			}
+			return nil, &LoopError{Kind: LoopChallenge, URL: req.URL, StatusCode: resp.StatusCode, History: history, Attempts: attempts}
+		}
+
 		// Check if we should retry
 		shouldRetry := false
-		if err != nil {
+		if errors.Is(err, transport.ErrHostBlocked) || errors.Is(err, transport.ErrFingerprintMismatch) || errors.Is(err, transport.ErrHeaderLimit) || errors.Is(err, transport.ErrRequestHeadersTooLarge) || errors.Is(err, transport.ErrBodyTooLarge) {
+			// Policy rejections, fingerprint mismatches and oversized headers or bodies won't change on retry
+			shouldRetry = false
+		} else if err != nil {
 			// Retry on network errors
 			shouldRetry = true
+		} else if challenged {
+			shouldRetry = true
 		} else if resp != nil {
 			// Check if status code is in retry list
 			for _, status := range retryOnStatus {
@@ -339,7 +643,8 @@ func (s *Session) requestWithRedirects(ctx context.Context, req *transport.Reque
 			}
 		}
 
-		if !shouldRetry || attempt >= maxRetries {
+		// Retries share the attempt budget with redirects
+		if !shouldRetry || attempt >= maxRetries || attempts >= attemptBudget {
 			break
 		}
 
@@ -353,6 +658,16 @@ func (s *Session) requestWithRedirects(ctx context.Context, req *transport.Reque
 		jitter := time.Duration(float64(waitTime) * 0.25)
 		waitTime = waitTime - jitter + time.Duration(randInt64(int64(jitter*2)))
 
+		// Don't sleep into the deadline: an attempt that can't start in
+		// time would only turn the last result into a context error
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) <= waitTime {
+			if err != nil {
+				err = fmt.Errorf("%w (retry skipped: %v backoff exceeds the deadline)", err, waitTime.Round(time.Millisecond))
+			}
+			break
+		}
+		traffic.attempts[len(traffic.attempts)-1].Backoff = waitTime
+
 		select {
 		case <-ctx.Done():
 			return nil, ctx.Err()
@@ -366,13 +681,13 @@ func (s *Session) requestWithRedirects(ctx context.Context, req *transport.Reque
 	}
 
 	// Extract cookies from final response (in case we didn't retry or it's a success)
-	s.extractCookies(resp.Headers, req.URL)
+	s.extractCookies(resp.Headers, req.URL, history)
 
 	// Parse Accept-CH header to store requested client hints for this host
 	s.parseAcceptCH(host, resp.Headers)
 
 	// Store cache validation headers from response for future requests
-	s.storeCacheHeaders(req.URL, resp.Headers)
+	s.storeCacheHeaders(s.cacheKey(ctx, req.URL), resp.Headers)
 
 	// Handle redirects
 	if isRedirectStatus(resp.StatusCode) {
@@ -385,10 +700,13 @@ func (s *Session) requestWithRedirects(ctx context.Context, req *transport.Reque
 				maxRedirects = s.Config.MaxRedirects
 			}
 		}
+		if req.NoRedirect {
+			followRedirects = false
+		}
 
 		if followRedirects {
 			if redirectCount >= maxRedirects {
-				return nil, errors.New("too many redirects")
+				return nil, fmt.Errorf("%w (limit %d)", ErrTooManyRedirects, maxRedirects)
 			}
 
 			// Get Location header (first value from slice)
@@ -404,6 +722,10 @@ func (s *Session) requestWithRedirects(ctx context.Context, req *transport.Reque
 			if location == "" {
 				// No Location header, set history and return as-is
 				resp.History = history
+				resp.Attempts = attempts
+				resp.Redirects = redirectCount
+				resp.RetryHistory = traffic.attempts
+				resp.BytesSent, resp.BytesReceived = traffic.sent, traffic.received
 				return resp, nil
 			}
 
@@ -418,17 +740,41 @@ func (s *Session) requestWithRedirects(ctx context.Context, req *transport.Reque
 			// Resolve relative URL
 			redirectURL := resolveURL(req.URL, location)
 
+			// Remember permanent redirects so later requests can skip the hop
+			if (resp.StatusCode == 301 || resp.StatusCode == 308) && s.Config != nil && s.Config.CachePermanentRedirects {
+				s.mu.Lock()
+				s.rememberPermanentRedirect(req.URL, PermanentRedirect{StatusCode: resp.StatusCode, Location: redirectURL})
+				s.mu.Unlock()
+			}
+
 			// Determine new method
 			newMethod := req.Method
 			if resp.StatusCode == 303 || ((resp.StatusCode == 301 || resp.StatusCode == 302) && req.Method == "POST") {
 				newMethod = "GET"
 			}
 
+			// Stop at loops rather than running into the redirect limit
+			traffic.visits = append(traffic.visits, redirectVisit{method: req.Method, url: req.URL, cookies: sentCookies})
+			next := redirectVisit{
+				method:  newMethod,
+				url:     redirectURL,
+				cookies: s.cookies.BuildCookieHeader(extractHost(redirectURL), extractPath(redirectURL), isSecureURL(redirectURL)),
+			}
+			if kind, loop := checkRedirectLoop(traffic.visits, next); loop {
+				return nil, &LoopError{Kind: kind, URL: redirectURL, StatusCode: resp.StatusCode, History: history, Attempts: attempts}
+			}
+
 			// Create redirect request
 			newReq := &transport.Request{
 				Method:  newMethod,
 				URL:     redirectURL,
 				Headers: make(map[string][]string),
+
+				PseudoHeaderOrder: req.PseudoHeaderOrder,
+				HTTP10:            req.HTTP10,
+				NoRetry:           req.NoRetry,
+				FirstByteTimeout:  req.FirstByteTimeout,
+				MaxBodySize:       req.MaxBodySize,
 			}
 
 			// Copy safe headers
@@ -450,15 +796,98 @@ func (s *Session) requestWithRedirects(ctx context.Context, req *transport.Reque
 			}
 
 			// Follow redirect with accumulated history
-			return s.requestWithRedirects(ctx, newReq, redirectCount+1, history)
+			return s.requestWithRedirects(ctx, newReq, redirectCount+1, attempts, traffic, history)
 		}
 	}
 
-	// Set history on final response
+	// Set history and attempt accounting on final response
 	resp.History = history
+	resp.Attempts = attempts
+	resp.Redirects = redirectCount
+	resp.RetryHistory = traffic.attempts
+	resp.BytesSent, resp.BytesReceived = traffic.sent, traffic.received
 	return resp, nil
 }
 
+// resolvePermanentRedirect follows the cached permanent redirect chain for a URL.
+// 301s are only applied to GET/HEAD since browsers may change the method for them.
+// Returns the final URL and a synthetic history entry per hop, or nil if nothing is cached.
+// Caller must hold s.mu.
+func (s *Session) resolvePermanentRedirect(url, method string) (string, []*transport.RedirectInfo) {
+	var hops []*transport.RedirectInfo
+	visited := make(map[string]bool)
+	for !visited[url] && len(hops) < 10 {
+		visited[url] = true
+		redirect, ok := s.permanentRedirects[url]
+		if !ok {
+			break
+		}
+		if redirect.StatusCode == 301 && method != "GET" && method != "HEAD" {
+			break
+		}
+		s.touchPermanentRedirect(url)
+		hops = append(hops, &transport.RedirectInfo{
+			StatusCode: redirect.StatusCode,
+			URL:        url,
+			Headers:    map[string][]string{"location": {redirect.Location}},
+		})
+		url = redirect.Location
+	}
+	return url, hops
+}
+
+// rememberPermanentRedirect stores a permanent redirect, dropping the least
+// recently used ones past maxPermanentRedirects. Caller must hold s.mu.
+func (s *Session) rememberPermanentRedirect(url string, redirect PermanentRedirect) {
+	if _, ok := s.permanentRedirects[url]; ok {
+		s.touchPermanentRedirect(url)
+	} else {
+		s.redirectOrder = append(s.redirectOrder, url)
+	}
+	s.permanentRedirects[url] = redirect
+	for len(s.permanentRedirects) > maxPermanentRedirects && len(s.redirectOrder) > 0 {
+		delete(s.permanentRedirects, s.redirectOrder[0])
+		s.redirectOrder = s.redirectOrder[1:]
+	}
+}
+
+// touchPermanentRedirect marks a remembered redirect as most recently used.
+// Caller must hold s.mu.
+func (s *Session) touchPermanentRedirect(url string) {
+	if i := slices.Index(s.redirectOrder, url); i >= 0 {
+		s.redirectOrder = append(slices.Delete(s.redirectOrder, i, i+1), url)
+	}
+}
+
+// PermanentRedirects returns a copy of the permanent redirects remembered by this session
+func (s *Session) PermanentRedirects() map[string]PermanentRedirect {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	redirects := make(map[string]PermanentRedirect, len(s.permanentRedirects))
+	for from, redirect := range s.permanentRedirects {
+		redirects[from] = redirect
+	}
+	return redirects
+}
+
+// ForgetPermanentRedirect removes the remembered permanent redirect for a URL
+func (s *Session) ForgetPermanentRedirect(url string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.permanentRedirects, url)
+	if i := slices.Index(s.redirectOrder, url); i >= 0 {
+		s.redirectOrder = slices.Delete(s.redirectOrder, i, i+1)
+	}
+}
+
+// ClearPermanentRedirects removes all remembered permanent redirects
+func (s *Session) ClearPermanentRedirects() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.permanentRedirects = make(map[string]PermanentRedirect)
+	s.redirectOrder = nil
+}
+
 // randInt64 generates a random int64 in range [0, n)
 func randInt64(n int64) int64 {
 	if n <= 0 {
@@ -492,7 +921,8 @@ func (s *Session) Post(ctx context.Context, url string, body []byte, headers map
 
 // extractCookies extracts cookies with full metadata from response headers
 // requestURL is the URL that was requested (needed for domain scoping)
-func (s *Session) extractCookies(headers map[string][]string, requestURL string) {
+// history is the redirect chain that led to requestURL, if any
+func (s *Session) extractCookies(headers map[string][]string, requestURL string, history []*transport.RedirectInfo) {
 	// Try both cases - some responses might have different casing
 	setCookies, exists := headers["set-cookie"]
 	if !exists {
@@ -504,6 +934,25 @@ func (s *Session) extractCookies(headers map[string][]string, requestURL string)
 
 	requestHost := extractHost(requestURL)
 	requestSecure := isSecureURL(requestURL)
+	var redirectedFrom string
+	if len(history) > 0 {
+		redirectedFrom = history[0].URL
+	}
+
+	// Expires is a time on the server's clock. Shifting it by the server's
+	// offset from the response Date keeps a cookie its intended lifetime
+	// when the two clocks disagree.
+	now := time.Now()
+	var skew time.Duration
+	date, ok := headers["date"]
+	if !ok {
+		date = headers["Date"]
+	}
+	if len(date) > 0 {
+		if serverNow, err := parseHTTPDate(trim(date[0])); err == nil {
+			skew = now.Sub(serverNow)
+		}
+	}
 
 	// Each Set-Cookie header is now a separate element in the slice
 	for _, line := range setCookies {
@@ -512,7 +961,8 @@ func (s *Session) extractCookies(headers map[string][]string, requestURL string)
 			continue
 		}
 
-		cookie := &CookieData{}
+		cookie := &CookieData{RedirectedFrom: redirectedFrom}
+		hasMaxAge := false
 
 		// Split by semicolon to get name=value and attributes
 		parts := splitBySemicolon(line)
@@ -571,7 +1021,11 @@ func (s *Session) extractCookies(headers map[string][]string, requestURL string)
 					cookie.Expires = &t
 				}
 			case "max-age":
-				cookie.MaxAge = parseIntSimple(attrValue)
+				// Ignored unless a valid integer (RFC 6265 section 5.2.2)
+				if n, err := strconv.Atoi(attrValue); err == nil {
+					cookie.MaxAge = n
+					hasMaxAge = true
+				}
 			case "samesite":
 				// Normalize to capitalized form
 				sameSiteLower := toLowerASCII(attrValue)
@@ -588,6 +1042,19 @@ func (s *Session) extractCookies(headers map[string][]string, requestURL string)
 			}
 		}
 
+		// Max-Age takes precedence over Expires and counts from now on the
+		// local clock; zero or negative deletes the cookie
+		if hasMaxAge {
+			expires := time.Unix(0, 0)
+			if cookie.MaxAge > 0 {
+				expires = now.Add(time.Duration(cookie.MaxAge) * time.Second)
+			}
+			cookie.Expires = &expires
+		} else if cookie.Expires != nil && skew != 0 {
+			expires := cookie.Expires.Add(skew)
+			cookie.Expires = &expires
+		}
+
 		// Use CookieJar to store with proper domain scoping
 		s.cookies.Set(requestHost, cookie, requestSecure)
 	}
@@ -611,28 +1078,6 @@ func splitBySemicolon(s string) []string {
 	return result
 }
 
-// parseIntSimple parses an integer from a string, returns 0 on error
-func parseIntSimple(s string) int {
-	result := 0
-	negative := false
-	start := 0
-	if len(s) > 0 && s[0] == '-' {
-		negative = true
-		start = 1
-	}
-	for i := start; i < len(s); i++ {
-		if s[i] >= '0' && s[i] <= '9' {
-			result = result*10 + int(s[i]-'0')
-		} else {
-			break
-		}
-	}
-	if negative {
-		result = -result
-	}
-	return result
-}
-
 // parseHTTPDate parses an HTTP date string (RFC1123 format)
 func parseHTTPDate(s string) (time.Time, error) {
 	// Try RFC1123 format first (most common)
@@ -655,8 +1100,9 @@ func parseHTTPDate(s string) (time.Time, error) {
 }
 
 // storeCacheHeaders extracts and stores cache validation headers from response
-// These headers will be sent on subsequent requests to the same URL
-func (s *Session) storeCacheHeaders(url string, headers map[string][]string) {
+// These headers will be sent on subsequent requests to the same URL (key
+// is from cacheKey)
+func (s *Session) storeCacheHeaders(key string, headers map[string][]string) {
 	// Helper to get first value from header (case-insensitive)
 	getHeader := func(key string) string {
 		if values := headers[key]; len(values) > 0 {
@@ -685,7 +1131,7 @@ func (s *Session) storeCacheHeaders(url string, headers map[string][]string) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	s.cacheEntries[url] = &cacheEntry{
+	s.cacheEntries[key] = &cacheEntry{
 		etag:         etag,
 		lastModified: lastModified,
 	}
@@ -922,6 +1368,10 @@ func (s *Session) Close() {
 	}
 	s.active = false
 
+	if s.stopTicketRefresh != nil {
+		close(s.stopTicketRefresh)
+	}
+
 	if s.transport != nil {
 		s.transport.Close()
 	}
@@ -931,6 +1381,18 @@ func (s *Session) Close() {
 		s.keyLogWriter.Close()
 		s.keyLogWriter = nil
 	}
+
+	// Close HAR log if we opened it
+	if s.harLog != nil && s.ownsHARLog {
+		s.harLog.Close()
+	}
+	s.harLog = nil
+
+	// Close WARC archive if we opened it
+	if s.warc != nil && s.ownsWARC {
+		s.warc.Close()
+	}
+	s.warc = nil
 }
 
 // parseProtocol converts a protocol string to transport.Protocol.
@@ -972,6 +1434,64 @@ func (s *Session) Refresh() {
 	}
 }
 
+// CloseIdleConnections closes the pooled connections no request is using
+func (s *Session) CloseIdleConnections() {
+	s.mu.RLock()
+	t := s.transport
+	s.mu.RUnlock()
+	if t != nil {
+		t.CloseIdleConnections()
+	}
+}
+
+// Preconnect opens a connection to origin without sending a request, so a
+// later request to it skips the DNS, TCP/QUIC and TLS round trips
+func (s *Session) Preconnect(ctx context.Context, origin string, opts transport.PreconnectOptions) error {
+	s.mu.RLock()
+	t, active := s.transport, s.active
+	s.mu.RUnlock()
+	if !active {
+		return ErrSessionClosed
+	}
+	return t.Preconnect(ctx, origin, opts)
+}
+
+// SwitchPreset switches the session to another fingerprint preset mid-run.
+// Only the TLS/HTTP2/HTTP3 layers are rebuilt: cookies, cache validators,
+// client hints, redirect cache, DNS cache and learned protocol support are
+// kept, so the session keeps its identity - like a browser updating itself.
+// Connections and TLS session tickets are not carried over; the next request
+// handshakes afresh with the new fingerprint. In-flight requests finish on
+// the old preset. Config.Preset and the transport switch together under the
+// session lock, so no request sees one changed without the other.
+func (s *Session) SwitchPreset(name string) error {
+	preset, ok := fingerprint.Lookup(name)
+	if !ok {
+		return fmt.Errorf("unknown preset %q", name)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.active {
+		return ErrSessionClosed
+	}
+	forcedH3 := s.switchProtocol == transport.ProtocolHTTP3 || (s.Config != nil && s.Config.ForceHTTP3)
+	if !preset.SupportHTTP3 && forcedH3 {
+		return fmt.Errorf("preset %q does not support HTTP/3", name)
+	}
+
+	// The transport swaps in new protocol transports without waiting for
+	// requests in flight, so holding s.mu here doesn't block on them
+	if s.transport != nil {
+		s.transport.SetPreset(name)
+	}
+	if s.Config != nil {
+		s.Config.Preset = name
+	}
+	return nil
+}
+
 // RefreshWithProtocol closes all connections and switches to a new protocol.
 // The protocol change persists for future Refresh() calls as well.
 // Valid protocols: "h1", "h2", "h3", "auto".
@@ -1208,12 +1728,31 @@ func (s *Session) SetSessionIdentifier(sessionId string) {
 	}
 }
 
+// HostStats returns the traffic exchanged with each host, keyed by hostname
+func (s *Session) HostStats() map[string]transport.HostStats {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.transport == nil {
+		return nil
+	}
+	return s.transport.HostStats()
+}
+
+// ResetHostStats clears the per-host traffic counters, e.g. between billing periods
+func (s *Session) ResetHostStats() {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.transport != nil {
+		s.transport.ResetHostStats()
+	}
+}
+
 // Stats returns session statistics
 func (s *Session) Stats() SessionStats {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	var transportStats map[string]interface{}
+	var transportStats transport.PoolStats
 	if s.transport != nil {
 		transportStats = s.transport.Stats()
 	}
@@ -1245,7 +1784,7 @@ type SessionStats struct {
 	CacheEntryCount int // Number of cached URLs (for If-None-Match/If-Modified-Since)
 	Age             time.Duration
 	IdleTime        time.Duration
-	TransportStats  map[string]interface{}
+	TransportStats  transport.PoolStats
 }
 
 // Helper functions
@@ -1328,7 +1867,8 @@ type StreamResponse = transport.StreamResponse
 // RequestStream executes an HTTP request and returns a streaming response
 // The caller is responsible for closing the response when done
 // Note: Streaming does NOT support redirects - use Request() for redirect handling
-func (s *Session) RequestStream(ctx context.Context, req *transport.Request) (*StreamResponse, error) {
+func (s *Session) RequestStream(ctx context.Context, req *transport.Request) (resp *StreamResponse, err error) {
+	defer transport.RecoverPanic(&resp, &err)
 	s.mu.Lock()
 	if !s.active {
 		s.mu.Unlock()
@@ -1336,6 +1876,9 @@ func (s *Session) RequestStream(ctx context.Context, req *transport.Request) (*S
 	}
 	s.LastUsed = time.Now()
 	s.RequestCount++
+	if s.hostUse != nil {
+		s.recordHostUse(req.URL)
+	}
 
 	if req.Headers == nil {
 		req.Headers = make(map[string][]string)
@@ -1355,15 +1898,20 @@ func (s *Session) RequestStream(ctx context.Context, req *transport.Request) (*S
 		}
 	}
 	s.mu.Unlock()
+	s.applyHostHeaders(requestHost, req.Headers)
 
 	// Execute streaming request (no retry or redirect support for streams)
-	resp, err := s.transport.DoStream(ctx, req)
+	s.captureUpload(req)
+	started := time.Now()
+	resp, err = s.transport.DoStream(ctx, req)
 	if err != nil {
 		return nil, err
 	}
+	s.logTraffic(req, started, resp.StatusCode, resp.Headers, resp.Protocol, resp.Timing)
+	s.archiveStream(req, started, resp)
 
 	// Extract cookies from response
-	s.extractCookies(resp.Headers, req.URL)
+	s.extractCookies(resp.Headers, req.URL, nil)
 
 	return resp, nil
 }
@@ -1509,15 +2057,20 @@ func (s *Session) importTLSSessions(sessions map[string]transport.TLSSessionStat
 	return nil
 }
 
-// exportECHConfigs exports ECH configs from HTTP/3 transport
+// exportECHConfigs exports ECH configs from the HTTP/2 and HTTP/3 transports
 // These are essential for session resumption - the same ECH config must be used
 func (s *Session) exportECHConfigs() map[string]string {
-	h3 := s.transport.GetHTTP3Transport()
-	if h3 == nil {
-		return nil
+	rawConfigs := make(map[string][]byte)
+	if h2 := s.transport.GetHTTP2Transport(); h2 != nil {
+		for host, config := range h2.GetECHConfigCache() {
+			rawConfigs[host] = config
+		}
+	}
+	if h3 := s.transport.GetHTTP3Transport(); h3 != nil {
+		for host, config := range h3.GetECHConfigCache() {
+			rawConfigs[host] = config
+		}
 	}
-
-	rawConfigs := h3.GetECHConfigCache()
 	if len(rawConfigs) == 0 {
 		return nil
 	}
@@ -1530,18 +2083,13 @@ func (s *Session) exportECHConfigs() map[string]string {
 	return result
 }
 
-// importECHConfigs imports ECH configs into HTTP/3 transport
+// importECHConfigs imports ECH configs into the HTTP/2 and HTTP/3 transports
 // This must be called BEFORE importing TLS sessions
 func (s *Session) importECHConfigs(configs map[string]string) {
 	if len(configs) == 0 {
 		return
 	}
 
-	h3 := s.transport.GetHTTP3Transport()
-	if h3 == nil {
-		return
-	}
-
 	// Decode base64 configs
 	rawConfigs := make(map[string][]byte, len(configs))
 	for host, b64Config := range configs {
@@ -1550,7 +2098,12 @@ func (s *Session) importECHConfigs(configs map[string]string) {
 		}
 	}
 
-	h3.SetECHConfigCache(rawConfigs)
+	if h2 := s.transport.GetHTTP2Transport(); h2 != nil {
+		h2.SetECHConfigCache(rawConfigs)
+	}
+	if h3 := s.transport.GetHTTP3Transport(); h3 != nil {
+		h3.SetECHConfigCache(rawConfigs)
+	}
 }
 
 // Marshal exports session state to JSON bytes
@@ -1590,13 +2143,28 @@ func (s *Session) Marshal() ([]byte, error) {
 		TLSSessions: tlsSessions,
 		ECHConfigs:  echConfigs,
 	}
+	if altSvc := s.transport.AltSvc(); len(altSvc) > 0 {
+		state.AltSvc = altSvc
+	}
 
 	return json.MarshalIndent(state, "", "  ")
 }
 
-// Save exports session state to a file
-func (s *Session) Save(path string) error {
+// MarshalCompressed exports session state to JSON bytes, gzipped when the
+// JSON is at least threshold bytes (see Compress). UnmarshalSession detects
+// and decompresses gzipped state automatically.
+func (s *Session) MarshalCompressed(threshold int) ([]byte, error) {
 	data, err := s.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	return Compress(data, threshold)
+}
+
+// Save exports session state to a file.
+// States larger than DefaultCompressThreshold are written gzipped.
+func (s *Session) Save(path string) error {
+	data, err := s.MarshalCompressed(DefaultCompressThreshold)
 	if err != nil {
 		return fmt.Errorf("failed to marshal session: %w", err)
 	}
@@ -1635,8 +2203,13 @@ type sessionStateV3 struct {
 	UDPProxy        string                               `json:"udp_proxy,omitempty"`
 }
 
-// UnmarshalSession loads a session from JSON bytes
+// UnmarshalSession loads a session from JSON bytes (plain or gzipped)
 func UnmarshalSession(data []byte) (*Session, error) {
+	data, err := Decompress(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse session data: %w", err)
+	}
+
 	// First, check the version
 	var versionCheck struct {
 		Version int `json:"version"`
@@ -1675,7 +2248,7 @@ func UnmarshalSession(data []byte) (*Session, error) {
 	}
 
 	session := NewSession("", config)
-	session.CreatedAt = state.CreatedAt
+	session.CreatedAt = transport.Reanchor(state.CreatedAt)
 
 	// Import cookies (v5 format)
 	session.mu.Lock()
@@ -1691,6 +2264,8 @@ func UnmarshalSession(data []byte) (*Session, error) {
 		// Log but don't fail - cookies are the main thing
 	}
 
+	session.transport.SetAltSvc(state.AltSvc)
+
 	return session, nil
 }
 
@@ -1710,7 +2285,7 @@ func unmarshalSessionV4(data []byte) (*Session, error) {
 	}
 
 	session := NewSession("", config)
-	session.CreatedAt = state.CreatedAt
+	session.CreatedAt = transport.Reanchor(state.CreatedAt)
 
 	// Import cookies from v4 format (flat list)
 	session.mu.Lock()
@@ -1746,7 +2321,7 @@ func unmarshalSessionV3(data []byte) (*Session, error) {
 	}
 
 	session := NewSession("", config)
-	session.CreatedAt = state.CreatedAt
+	session.CreatedAt = transport.Reanchor(state.CreatedAt)
 
 	// Import cookies from v3 format (flat list, same as v4)
 	session.mu.Lock()
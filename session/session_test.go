@@ -0,0 +1,32 @@
+package session
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/sardanioss/httpcloak/protocol"
+)
+
+func TestSwitchPreset(t *testing.T) {
+	s := NewSession("", &protocol.SessionConfig{Preset: "chrome-145"})
+	defer s.Close()
+	s.SetCookie("sid", "abc")
+
+	if err := s.SwitchPreset("no-such-preset"); err == nil {
+		t.Error("expected an error for an unknown preset")
+	}
+	if err := s.SwitchPreset("firefox-133"); err != nil {
+		t.Fatalf("SwitchPreset failed: %v", err)
+	}
+	if s.Config.Preset != "firefox-133" {
+		t.Errorf("Config.Preset = %q, want firefox-133", s.Config.Preset)
+	}
+	if got := s.GetCookies()["sid"]; got != "abc" {
+		t.Errorf("cookie lost across preset switch: got %q", got)
+	}
+
+	s.Close()
+	if err := s.SwitchPreset("chrome-145"); !errors.Is(err, ErrSessionClosed) {
+		t.Errorf("SwitchPreset on closed session = %v, want ErrSessionClosed", err)
+	}
+}
@@ -0,0 +1,257 @@
+package session
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"iter"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sardanioss/httpcloak/transport"
+)
+
+// SitemapURL is a page listed in a sitemap.
+type SitemapURL struct {
+	Loc        string
+	LastMod    time.Time // Zero if the sitemap doesn't say
+	ChangeFreq string
+	Priority   float64 // 0 if unset
+	Sitemap    string  // URL of the sitemap file that listed this page
+}
+
+// maxSitemapDepth bounds sitemap index nesting (the protocol allows one level;
+// a little slack covers sites that nest anyway without risking loops).
+const maxSitemapDepth = 4
+
+// sitemapDoc is a parsed sitemap file, kept so 304 responses can be replayed.
+type sitemapDoc struct {
+	urls     []SitemapURL
+	children []string // Sitemaps listed by a sitemap index
+}
+
+// Sitemap discovers the sitemaps of origin (from robots.txt Sitemap: lines,
+// falling back to /sitemap.xml) and iterates over every URL they list.
+// Sitemap index files are followed and .gz sitemaps are decompressed.
+//
+// Sitemaps are fetched through the session, so cookies and fingerprint apply.
+// Parsed sitemaps are remembered on the session; iterating again later sends
+// conditional requests and replays unchanged (304) sitemaps from memory.
+//
+// Iteration stops at the first error, which is yielded with a zero SitemapURL.
+//
+// Example:
+//
+//	for u, err := range sess.Sitemap(ctx, "https://example.com") {
+//	    if err != nil {
+//	        return err
+//	    }
+//	    fmt.Println(u.Loc, u.LastMod)
+//	}
+func (s *Session) Sitemap(ctx context.Context, origin string) iter.Seq2[SitemapURL, error] {
+	return func(yield func(SitemapURL, error) bool) {
+		origin = strings.TrimRight(origin, "/")
+
+		roots, err := s.discoverSitemaps(ctx, origin)
+		if err != nil {
+			yield(SitemapURL{}, err)
+			return
+		}
+
+		visited := make(map[string]bool)
+		var walk func(sitemapURL string, depth int) bool
+		walk = func(sitemapURL string, depth int) bool {
+			if visited[sitemapURL] || depth > maxSitemapDepth {
+				return true
+			}
+			visited[sitemapURL] = true
+
+			doc, err := s.fetchSitemap(ctx, sitemapURL)
+			if err != nil {
+				yield(SitemapURL{}, err)
+				return false
+			}
+			for _, u := range doc.urls {
+				if !yield(u, nil) {
+					return false
+				}
+			}
+			for _, child := range doc.children {
+				if !walk(child, depth+1) {
+					return false
+				}
+			}
+			return true
+		}
+
+		for _, root := range roots {
+			if !walk(root, 0) {
+				return
+			}
+		}
+	}
+}
+
+// discoverSitemaps returns the sitemap URLs advertised in robots.txt,
+// or origin/sitemap.xml if there are none.
+func (s *Session) discoverSitemaps(ctx context.Context, origin string) ([]string, error) {
+	resp, err := s.Request(ctx, &transport.Request{Method: "GET", URL: origin + "/robots.txt"})
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, err
+		}
+		// No usable robots.txt - fall back to the conventional location
+		return []string{origin + "/sitemap.xml"}, nil
+	}
+	defer resp.Close()
+
+	var sitemaps []string
+	if resp.StatusCode == 200 && resp.Body != nil {
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if len(line) > 8 && strings.EqualFold(line[:8], "sitemap:") {
+				if loc := strings.TrimSpace(line[8:]); loc != "" {
+					sitemaps = append(sitemaps, resolveURL(origin+"/", loc))
+				}
+			}
+		}
+	}
+	if len(sitemaps) == 0 {
+		sitemaps = []string{origin + "/sitemap.xml"}
+	}
+	return sitemaps, nil
+}
+
+// fetchSitemap fetches and parses one sitemap file, replaying the remembered
+// copy when the server answers a conditional request with 304.
+func (s *Session) fetchSitemap(ctx context.Context, sitemapURL string) (*sitemapDoc, error) {
+	for attempt := 0; attempt < 2; attempt++ {
+		resp, err := s.Request(ctx, &transport.Request{Method: "GET", URL: sitemapURL})
+		if err != nil {
+			return nil, fmt.Errorf("sitemap %s: %w", sitemapURL, err)
+		}
+
+		if resp.StatusCode == 304 {
+			resp.Close()
+			s.mu.Lock()
+			doc := s.sitemaps[sitemapURL]
+			if doc == nil {
+				// Validators are cached but the parsed sitemap isn't; fetch it fresh
+				delete(s.cacheEntries, s.cacheKey(ctx, sitemapURL))
+			}
+			s.mu.Unlock()
+			if doc != nil {
+				return doc, nil
+			}
+			continue
+		}
+
+		if resp.StatusCode != 200 {
+			resp.Close()
+			return nil, fmt.Errorf("sitemap %s: unexpected status %d", sitemapURL, resp.StatusCode)
+		}
+
+		if resp.Body == nil {
+			return nil, fmt.Errorf("sitemap %s: empty response", sitemapURL)
+		}
+		doc, err := parseSitemap(resp.Body, sitemapURL)
+		resp.Close()
+		if err != nil {
+			return nil, fmt.Errorf("sitemap %s: %w", sitemapURL, err)
+		}
+
+		s.mu.Lock()
+		if s.sitemaps == nil {
+			s.sitemaps = make(map[string]*sitemapDoc)
+		}
+		s.sitemaps[sitemapURL] = doc
+		s.mu.Unlock()
+		return doc, nil
+	}
+	return nil, fmt.Errorf("sitemap %s: server keeps answering 304 without validators", sitemapURL)
+}
+
+// parseSitemap parses a urlset or sitemapindex document, gzipped or not.
+func parseSitemap(body io.Reader, sitemapURL string) (*sitemapDoc, error) {
+	br := bufio.NewReader(body)
+	if magic, err := br.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		body = zr
+	} else {
+		body = br
+	}
+
+	doc := &sitemapDoc{}
+	dec := xml.NewDecoder(body)
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			return doc, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid sitemap XML: %w", err)
+		}
+		start, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+
+		switch start.Name.Local {
+		case "url":
+			var entry struct {
+				Loc        string `xml:"loc"`
+				LastMod    string `xml:"lastmod"`
+				ChangeFreq string `xml:"changefreq"`
+				Priority   string `xml:"priority"`
+			}
+			if err := dec.DecodeElement(&entry, &start); err != nil {
+				return nil, fmt.Errorf("invalid sitemap XML: %w", err)
+			}
+			loc := strings.TrimSpace(entry.Loc)
+			if loc == "" {
+				continue
+			}
+			u := SitemapURL{
+				Loc:        loc,
+				LastMod:    parseLastMod(entry.LastMod),
+				ChangeFreq: strings.TrimSpace(entry.ChangeFreq),
+				Sitemap:    sitemapURL,
+			}
+			if p, err := strconv.ParseFloat(strings.TrimSpace(entry.Priority), 64); err == nil {
+				u.Priority = p
+			}
+			doc.urls = append(doc.urls, u)
+
+		case "sitemap":
+			var entry struct {
+				Loc string `xml:"loc"`
+			}
+			if err := dec.DecodeElement(&entry, &start); err != nil {
+				return nil, fmt.Errorf("invalid sitemap XML: %w", err)
+			}
+			if loc := strings.TrimSpace(entry.Loc); loc != "" {
+				doc.children = append(doc.children, resolveURL(sitemapURL, loc))
+			}
+		}
+	}
+}
+
+// parseLastMod parses the W3C datetime formats allowed in <lastmod>.
+func parseLastMod(value string) time.Time {
+	value = strings.TrimSpace(value)
+	for _, layout := range []string{time.RFC3339, "2006-01-02T15:04Z07:00", "2006-01-02", "2006-01", "2006"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
@@ -0,0 +1,59 @@
+package session
+
+import (
+	"bytes"
+	"compress/gzip"
+	"strings"
+	"testing"
+)
+
+func TestParseSitemap(t *testing.T) {
+	urlset := `<?xml version="1.0" encoding="UTF-8"?>
+<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <url><loc>https://example.com/a</loc><lastmod>2025-03-01</lastmod><priority>0.8</priority></url>
+  <url><loc> https://example.com/b </loc><lastmod>2025-03-02T10:00:00+00:00</lastmod><changefreq>daily</changefreq></url>
+</urlset>`
+
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	zw.Write([]byte(urlset))
+	zw.Close()
+
+	for name, body := range map[string][]byte{"plain": []byte(urlset), "gzip": gz.Bytes()} {
+		doc, err := parseSitemap(bytes.NewReader(body), "https://example.com/sitemap.xml")
+		if err != nil {
+			t.Fatalf("%s: parseSitemap failed: %v", name, err)
+		}
+		if len(doc.urls) != 2 {
+			t.Fatalf("%s: got %d urls, want 2", name, len(doc.urls))
+		}
+		a, b := doc.urls[0], doc.urls[1]
+		if a.Loc != "https://example.com/a" || a.Priority != 0.8 || a.LastMod.Day() != 1 {
+			t.Errorf("%s: unexpected first entry %+v", name, a)
+		}
+		if b.Loc != "https://example.com/b" || b.ChangeFreq != "daily" || b.LastMod.Hour() != 10 {
+			t.Errorf("%s: unexpected second entry %+v", name, b)
+		}
+	}
+}
+
+func TestParseSitemapIndex(t *testing.T) {
+	index := `<sitemapindex xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <sitemap><loc>https://example.com/sitemap-posts.xml.gz</loc></sitemap>
+  <sitemap><loc>/sitemap-pages.xml</loc></sitemap>
+</sitemapindex>`
+
+	doc, err := parseSitemap(strings.NewReader(index), "https://example.com/sitemap.xml")
+	if err != nil {
+		t.Fatalf("parseSitemap failed: %v", err)
+	}
+	want := []string{"https://example.com/sitemap-posts.xml.gz", "https://example.com/sitemap-pages.xml"}
+	if len(doc.children) != len(want) || len(doc.urls) != 0 {
+		t.Fatalf("unexpected index parse: %+v", doc)
+	}
+	for i := range want {
+		if doc.children[i] != want[i] {
+			t.Errorf("child %d = %q, want %q", i, doc.children[i], want[i])
+		}
+	}
+}
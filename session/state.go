@@ -30,6 +30,11 @@ type SessionState struct {
 	// This is essential for session resumption - the same ECH config must be used
 	// when resuming as was used when creating the session ticket
 	ECHConfigs map[string]string `json:"ech_configs,omitempty"`
+
+	// AltSvc stores the unexpired Alt-Svc advertisements per origin
+	// ("host:port"), so a loaded session goes straight to HTTP/3 where
+	// the server offered it
+	AltSvc map[string][]transport.AltService `json:"alt_svc,omitempty"`
 }
 
 // SessionStateV4 represents the v4 format for migration
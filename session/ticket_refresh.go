@@ -0,0 +1,93 @@
+package session
+
+import (
+	"context"
+	"net"
+	"net/url"
+	"sort"
+	"time"
+)
+
+const (
+	// ticketRefreshMinRequests is how many requests a host needs within the
+	// recent past (counts halve every check) to count as frequently used
+	ticketRefreshMinRequests = 2
+
+	// ticketRefreshPerCheck throttles refreshes to a few handshakes per check
+	ticketRefreshPerCheck = 2
+
+	ticketRefreshTimeout = 15 * time.Second
+)
+
+// startTicketRefresh starts the background task that refreshes the TLS session
+// tickets of frequently used hosts once they are older than after
+func (s *Session) startTicketRefresh(after time.Duration) {
+	s.hostUse = make(map[string]int)
+	s.stopTicketRefresh = make(chan struct{})
+
+	interval := max(min(after/4, time.Minute), time.Second)
+	go func(stop <-chan struct{}) {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				s.refreshTickets(after)
+			}
+		}
+	}(s.stopTicketRefresh)
+}
+
+// recordHostUse counts a request to the host of rawURL. Caller holds s.mu.
+func (s *Session) recordHostUse(rawURL string) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Scheme != "https" || u.Hostname() == "" {
+		return
+	}
+	port := u.Port()
+	if port == "" {
+		port = "443"
+	}
+	s.hostUse[net.JoinHostPort(u.Hostname(), port)]++
+}
+
+// refreshTickets re-handshakes with the busiest hosts whose tickets are stale
+func (s *Session) refreshTickets(after time.Duration) {
+	s.mu.Lock()
+	if !s.active {
+		s.mu.Unlock()
+		return
+	}
+	var hosts []string
+	for hostPort, count := range s.hostUse {
+		if count >= ticketRefreshMinRequests {
+			hosts = append(hosts, hostPort)
+		}
+	}
+	sort.Slice(hosts, func(i, j int) bool { return s.hostUse[hosts[i]] > s.hostUse[hosts[j]] })
+	for hostPort, count := range s.hostUse {
+		if count /= 2; count == 0 {
+			delete(s.hostUse, hostPort)
+		} else {
+			s.hostUse[hostPort] = count
+		}
+	}
+	t := s.transport
+	s.mu.Unlock()
+
+	refreshed := 0
+	for _, hostPort := range hosts {
+		if refreshed == ticketRefreshPerCheck {
+			return
+		}
+		host, port, _ := net.SplitHostPort(hostPort)
+		// The transport applies the host policy and the session's proxies
+		ctx, cancel := context.WithTimeout(context.Background(), ticketRefreshTimeout)
+		if handshake, _ := t.RefreshTicket(ctx, host, port, after); handshake {
+			refreshed++
+		}
+		cancel()
+	}
+}
@@ -0,0 +1,92 @@
+package session
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sardanioss/httpcloak/protocol"
+	"github.com/sardanioss/httpcloak/transport"
+)
+
+func TestRecordHostUse(t *testing.T) {
+	s := &Session{hostUse: make(map[string]int)}
+	for _, u := range []string{
+		"https://example.com/a",
+		"https://example.com:443/b",
+		"https://api.example.com:8443/",
+		"http://example.com/", // No TLS ticket to keep fresh
+		"://bad",
+	} {
+		s.recordHostUse(u)
+	}
+
+	if got := s.hostUse["example.com:443"]; got != 2 {
+		t.Errorf("example.com:443 count = %d, want 2", got)
+	}
+	if got := s.hostUse["api.example.com:8443"]; got != 1 {
+		t.Errorf("api.example.com:8443 count = %d, want 1", got)
+	}
+	if len(s.hostUse) != 2 {
+		t.Errorf("hostUse = %v, want 2 hosts", s.hostUse)
+	}
+}
+
+func TestRefreshTicketsHostPolicy(t *testing.T) {
+	var conns atomic.Int32
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	srv.EnableHTTP2 = true
+	srv.Config.ConnState = func(c net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			conns.Add(1)
+		}
+	}
+	srv.StartTLS()
+	defer srv.Close()
+
+	s := NewSession("", &protocol.SessionConfig{Preset: "chrome-latest", ForceHTTP2: true, InsecureSkipVerify: true})
+	defer s.Close()
+	s.hostUse = make(map[string]int)
+	for i := 0; i < 2; i++ {
+		resp, err := s.Request(context.Background(), &transport.Request{Method: "GET", URL: srv.URL})
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Close()
+	}
+	waitConns := func(want int32) bool {
+		for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+			if conns.Load() == want {
+				return true
+			}
+		}
+		return false
+	}
+
+	// A stale ticket is renewed with a new handshake
+	s.mu.Lock()
+	s.hostUse[srv.Listener.Addr().String()] = ticketRefreshMinRequests
+	s.mu.Unlock()
+	s.refreshTickets(0)
+	if !waitConns(2) {
+		t.Fatalf("%d connections after a refresh, want 2", conns.Load())
+	}
+
+	// A host the policy denies is not dialed
+	policy, err := transport.NewHostPolicy(nil, []string{"127.0.0.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.transport.SetHostPolicy(policy)
+	s.mu.Lock()
+	s.hostUse[srv.Listener.Addr().String()] = ticketRefreshMinRequests
+	s.mu.Unlock()
+	s.refreshTickets(0)
+	if waitConns(3) {
+		t.Error("refreshed the ticket of a host the policy denies")
+	}
+}
@@ -0,0 +1,148 @@
+package session
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/sardanioss/httpcloak/transport"
+)
+
+// TLSSessionsVersion is the format version written by ExportTLSSessions
+const TLSSessionsVersion = 1
+
+// handoffAddressTTL is how long imported addresses are trusted before the
+// importing session resolves the host itself
+const handoffAddressTTL = 5 * time.Minute
+
+// TLSSessions is the portable set of TLS session tickets exported by
+// ExportTLSSessions. Unlike SessionState it carries no cookies or config,
+// so a warmup process can hand tickets to workers without their identity.
+//
+// Live TCP and QUIC connections can't move between processes: their keys and
+// congestion state belong to the process that opened them. The handoff
+// instead carries what makes reconnecting cheap - tickets for PSK resumption,
+// resolved addresses and the protocol each host speaks - so a restarted
+// worker resumes without DNS lookups or protocol racing.
+type TLSSessions struct {
+	Version    int       `json:"version"`
+	ExportedAt time.Time `json:"exported_at"`
+
+	// Preset the tickets were issued to. Resuming them with another
+	// fingerprint would link two different-looking clients.
+	Preset string `json:"preset,omitempty"`
+
+	// Keyed by "protocol:host:port", as in SessionState
+	TLSSessions map[string]transport.TLSSessionState `json:"tls_sessions"`
+
+	// ECH configs the tickets were issued under (base64), needed to resume
+	ECHConfigs map[string]string `json:"ech_configs,omitempty"`
+
+	// Addresses are the resolved IPs per hostname. Imported ones are used
+	// for a few minutes (less the age of the export).
+	Addresses map[string][]string `json:"addresses,omitempty"`
+
+	// Protocols is the protocol ("h1", "h2", "h3") learned per hostname
+	Protocols map[string]string `json:"protocols,omitempty"`
+
+	// AltSvc is the unexpired Alt-Svc advertisements per origin ("host:port")
+	AltSvc map[string][]transport.AltService `json:"alt_svc,omitempty"`
+}
+
+// ExportTLSSessions exports the session's TLS tickets and ECH configs as JSON
+func (s *Session) ExportTLSSessions() ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	tlsSessions, err := s.exportTLSSessions()
+	if err != nil {
+		return nil, err
+	}
+	sessions := &TLSSessions{
+		Version:     TLSSessionsVersion,
+		ExportedAt:  time.Now(),
+		Preset:      s.presetName(),
+		TLSSessions: tlsSessions,
+		ECHConfigs:  s.exportECHConfigs(),
+		Addresses:   make(map[string][]string),
+		Protocols:   make(map[string]string),
+	}
+	if dnsCache := s.transport.GetDNSCache(); dnsCache != nil {
+		for host, ips := range dnsCache.Snapshot() {
+			for _, ip := range ips {
+				sessions.Addresses[host] = append(sessions.Addresses[host], ip.String())
+			}
+		}
+	}
+	for host, p := range s.transport.ProtocolHints() {
+		sessions.Protocols[host] = p.String()
+	}
+	if altSvc := s.transport.AltSvc(); len(altSvc) > 0 {
+		sessions.AltSvc = altSvc
+	}
+	return json.Marshal(sessions)
+}
+
+// ImportTLSSessions adds tickets exported by ExportTLSSessions to the session,
+// so its next connections to those hosts resume with PSK. Existing tickets for
+// other hosts are kept; expired tickets are skipped. Tickets exported from a
+// session with a different preset are rejected.
+func (s *Session) ImportTLSSessions(data []byte) error {
+	var sessions TLSSessions
+	if err := json.Unmarshal(data, &sessions); err != nil {
+		return fmt.Errorf("invalid TLS sessions: %w", err)
+	}
+	if sessions.Version > TLSSessionsVersion {
+		return fmt.Errorf("unsupported TLS sessions version %d", sessions.Version)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if preset := s.presetName(); sessions.Preset != "" && sessions.Preset != preset {
+		return fmt.Errorf("TLS sessions were issued to preset %q, session uses %q", sessions.Preset, preset)
+	}
+	// ECH configs first: resumption must offer the config the ticket was issued under
+	s.importECHConfigs(sessions.ECHConfigs)
+	if err := s.importTLSSessions(sessions.TLSSessions); err != nil {
+		return err
+	}
+	s.importHandoffHints(&sessions)
+	return nil
+}
+
+// importHandoffHints seeds the DNS cache, protocol hints and Alt-Svc cache.
+// Caller holds s.mu.
+func (s *Session) importHandoffHints(sessions *TLSSessions) {
+	if ttl := handoffAddressTTL - time.Since(sessions.ExportedAt); ttl > 0 {
+		if dnsCache := s.transport.GetDNSCache(); dnsCache != nil {
+			for host, addrs := range sessions.Addresses {
+				var ips []net.IP
+				for _, addr := range addrs {
+					if ip := net.ParseIP(addr); ip != nil {
+						ips = append(ips, ip)
+					}
+				}
+				dnsCache.Seed(host, ips, ttl)
+			}
+		}
+	}
+
+	hints := make(map[string]transport.Protocol, len(sessions.Protocols))
+	for host, name := range sessions.Protocols {
+		if p, err := parseProtocol(name); err == nil {
+			hints[host] = p
+		}
+	}
+	s.transport.SetProtocolHints(hints)
+	s.transport.SetAltSvc(sessions.AltSvc)
+}
+
+// presetName returns the session's preset name. Caller holds s.mu.
+func (s *Session) presetName() string {
+	if s.Config == nil {
+		return ""
+	}
+	return s.Config.Preset
+}
@@ -0,0 +1,83 @@
+package session
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sardanioss/httpcloak/protocol"
+	"github.com/sardanioss/httpcloak/transport"
+)
+
+func TestTLSSessionsExportImport(t *testing.T) {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	defer srv.Close()
+
+	config := &protocol.SessionConfig{Preset: "chrome-latest", InsecureSkipVerify: true, ForceHTTP2: true}
+	warm := NewSession("warm", config)
+	defer warm.Close()
+	resp, err := warm.Request(context.Background(), &transport.Request{Method: "GET", URL: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Close()
+
+	data, err := warm.ExportTLSSessions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"h2:`) {
+		t.Skipf("server issued no ticket: %s", data)
+	}
+
+	worker := NewSession("worker", config)
+	defer worker.Close()
+	if err := worker.ImportTLSSessions(data); err != nil {
+		t.Fatal(err)
+	}
+	sessions, err := worker.exportTLSSessions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sessions) == 0 {
+		t.Error("worker has no tickets after import")
+	}
+
+	other := NewSession("other", &protocol.SessionConfig{Preset: "firefox-latest"})
+	defer other.Close()
+	if err := other.ImportTLSSessions(data); err == nil {
+		t.Error("import into a session with another preset should fail")
+	}
+}
+
+func TestImportHandoffHints(t *testing.T) {
+	s := NewSession("", nil)
+	defer s.Close()
+	s.importHandoffHints(&TLSSessions{
+		ExportedAt: time.Now(),
+		Addresses:  map[string][]string{"handoff.example": {"192.0.2.1", "bogus"}},
+		Protocols:  map[string]string{"handoff.example": "h3"},
+	})
+
+	ips, err := s.GetTransport().GetDNSCache().Resolve(context.Background(), "handoff.example")
+	if err != nil || len(ips) != 1 || ips[0].String() != "192.0.2.1" {
+		t.Errorf("Resolve = %v, %v; want the imported address", ips, err)
+	}
+	if got := s.GetTransport().ProtocolHints()["handoff.example"]; got != transport.ProtocolHTTP3 {
+		t.Errorf("protocol hint = %s, want h3", got)
+	}
+
+	// Addresses from an old export are not trusted
+	s.importHandoffHints(&TLSSessions{
+		ExportedAt: time.Now().Add(-time.Hour),
+		Addresses:  map[string][]string{"stale.example": {"192.0.2.2"}},
+	})
+	if _, ok := s.GetTransport().GetDNSCache().Snapshot()["stale.example"]; ok {
+		t.Error("stale addresses were imported")
+	}
+}
@@ -0,0 +1,174 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrTrafficBudgetExceeded is returned when a request would start after the
+// traffic budget for the current window is used up
+var ErrTrafficBudgetExceeded = errors.New("traffic budget exceeded")
+
+// TrafficBudget caps the bytes a session exchanges per time window, counted
+// like transport.HostStats (headers plus bodies before decompression).
+// Requests are checked before they start, so the request that crosses the
+// limit completes; the ones after it wait or fail until the window resets.
+// Streaming requests are not counted.
+type TrafficBudget struct {
+	Bytes int64
+	Per   time.Duration
+
+	// Requests caps the requests started per window, counting retries and
+	// redirects. A budget sets Bytes, Requests or both.
+	Requests int
+
+	// Host limits the budget to requests to this hostname. Empty counts
+	// every request of the session.
+	Host string
+
+	// Wait pauses requests until the next window instead of failing them
+	// with ErrTrafficBudgetExceeded
+	Wait bool
+}
+
+// trafficBudget is a TrafficBudget with its usage in the current window
+type trafficBudget struct {
+	TrafficBudget
+
+	mu          sync.Mutex
+	windowStart time.Time
+	used        int64
+	started     int
+}
+
+func newTrafficBudgets(budgets []TrafficBudget) []*trafficBudget {
+	var result []*trafficBudget
+	for _, b := range budgets {
+		if (b.Bytes <= 0 && b.Requests <= 0) || b.Per <= 0 {
+			continue
+		}
+		b.Host = strings.ToLower(b.Host)
+		result = append(result, &trafficBudget{TrafficBudget: b})
+	}
+	return result
+}
+
+func (b *trafficBudget) applies(host string) bool {
+	return b.Host == "" || b.Host == strings.ToLower(host)
+}
+
+// remaining returns how long until the budget has room again, 0 if it has
+// room now. Starts a new window when the current one has passed.
+func (b *trafficBudget) remaining(now time.Time) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.wait(now)
+}
+
+// take is remaining that also counts a request started when there is room
+func (b *trafficBudget) take(now time.Time) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	wait := b.wait(now)
+	if wait == 0 {
+		b.started++
+	}
+	return wait
+}
+
+// wait implements remaining. Caller holds b.mu.
+func (b *trafficBudget) wait(now time.Time) time.Duration {
+	if now.Sub(b.windowStart) >= b.Per {
+		b.windowStart = now
+		b.used = 0
+		b.started = 0
+	}
+	if (b.Bytes <= 0 || b.used < b.Bytes) && (b.Requests <= 0 || b.started < b.Requests) {
+		return 0
+	}
+	return b.windowStart.Add(b.Per).Sub(now)
+}
+
+// limit describes the budget for errors
+func (b *trafficBudget) limit() string {
+	var parts []string
+	if b.Bytes > 0 {
+		parts = append(parts, fmt.Sprintf("%d bytes", b.Bytes))
+	}
+	if b.Requests > 0 {
+		parts = append(parts, fmt.Sprintf("%d requests", b.Requests))
+	}
+	return strings.Join(parts, " and ") + " per " + b.Per.String()
+}
+
+func (b *trafficBudget) charge(n int64) {
+	b.mu.Lock()
+	b.used += n
+	b.mu.Unlock()
+}
+
+// waitTrafficBudget blocks until every budget that applies to host has room,
+// or fails with ErrTrafficBudgetExceeded for budgets that don't wait
+func (s *Session) waitTrafficBudget(ctx context.Context, host string) error {
+	for _, b := range s.budgets() {
+		if !b.applies(host) {
+			continue
+		}
+		for {
+			wait := b.take(time.Now())
+			if wait == 0 {
+				break
+			}
+			if !b.Wait {
+				return fmt.Errorf("%w: %s, next window in %s", ErrTrafficBudgetExceeded, b.limit(), wait.Round(time.Second))
+			}
+			timer := time.NewTimer(wait)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return ctx.Err()
+			case <-timer.C:
+			}
+		}
+	}
+	return nil
+}
+
+// chargeTrafficBudget counts n bytes exchanged with host against the budgets
+func (s *Session) chargeTrafficBudget(host string, n int64) {
+	for _, b := range s.budgets() {
+		if b.applies(host) {
+			b.charge(n)
+		}
+	}
+}
+
+func (s *Session) budgets() []*trafficBudget {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.trafficBudgets
+}
+
+// AddTrafficBudgets adds budgets to the session. Forks made earlier keep
+// the budgets they were forked with.
+func (s *Session) AddTrafficBudgets(budgets ...TrafficBudget) {
+	added := newTrafficBudgets(budgets)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// Copy so forks sharing the old slice don't see the additions
+	s.trafficBudgets = append(s.trafficBudgets[:len(s.trafficBudgets):len(s.trafficBudgets)], added...)
+}
+
+// TrafficBudgets returns the session's budgets
+func (s *Session) TrafficBudgets() []TrafficBudget {
+	budgets := s.budgets()
+	result := make([]TrafficBudget, len(budgets))
+	for i, b := range budgets {
+		result[i] = b.TrafficBudget
+	}
+	return result
+}
@@ -0,0 +1,61 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sardanioss/httpcloak/protocol"
+	"github.com/sardanioss/httpcloak/transport"
+)
+
+func TestTrafficBudget(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(strings.Repeat("x", 1000)))
+	}))
+	defer srv.Close()
+
+	s := NewSessionWithOptions("", &protocol.SessionConfig{ForceHTTP1: true}, &SessionOptions{
+		TrafficBudgets: []TrafficBudget{
+			{Bytes: 2500, Per: time.Hour},
+			{Bytes: 1, Per: time.Hour, Host: "other.example"},
+		},
+	})
+	defer s.Close()
+
+	get := func() error {
+		resp, err := s.Request(context.Background(), &transport.Request{Method: "GET", URL: srv.URL})
+		if err == nil {
+			resp.Close()
+		}
+		return err
+	}
+	// The first request fits; the second crosses the limit but still completes
+	for i := 0; i < 2; i++ {
+		if err := get(); err != nil {
+			t.Fatalf("request %d: %v", i, err)
+		}
+	}
+	if err := get(); !errors.Is(err, ErrTrafficBudgetExceeded) {
+		t.Fatalf("request over budget: err = %v, want ErrTrafficBudgetExceeded", err)
+	}
+}
+
+func TestTrafficBudgetWindow(t *testing.T) {
+	b := newTrafficBudgets([]TrafficBudget{{Bytes: 100, Per: time.Minute}})[0]
+	now := time.Now()
+	if b.remaining(now) != 0 {
+		t.Fatal("fresh budget should have room")
+	}
+	b.charge(100)
+	if wait := b.remaining(now.Add(10 * time.Second)); wait != 50*time.Second {
+		t.Errorf("remaining = %s, want 50s", wait)
+	}
+	if b.remaining(now.Add(time.Minute)) != 0 {
+		t.Error("budget should reset in the next window")
+	}
+}
@@ -0,0 +1,534 @@
+package session
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sardanioss/httpcloak/transport"
+)
+
+const (
+	defaultWARCMaxFileSize = 1 << 30
+	defaultWARCPrefix      = "httpcloak"
+
+	// warcSpoolMemory is how much of a streamed body is held in memory
+	// before it is spooled to a temporary file in the archive directory
+	warcSpoolMemory = 1 << 20
+)
+
+// WARCOptions configures a WARCWriter
+type WARCOptions struct {
+	// MaxFileSize is the size after which the next exchange starts a new
+	// file (default 1 GiB). An exchange is never split across files.
+	MaxFileSize int64
+
+	// Prefix starts the file names: prefix-YYYYMMDDhhmmss-00000.warc
+	// (default "httpcloak")
+	Prefix string
+
+	// Compress writes .warc.gz files, each record its own gzip member
+	Compress bool
+}
+
+// WARCWriter archives request/response exchanges as WARC 1.1 records in
+// rotating files. Each exchange is a request record and a response record
+// written back to back with SHA-1 block and payload digests, so files can
+// be replayed and deduplicated by standard WARC tools. It is safe for
+// concurrent use.
+//
+// Records hold HTTP/1.1 messages whatever protocol carried the exchange.
+// Request headers are those given to the session (preset headers added by
+// the transport are not seen), and response bodies are archived decoded,
+// with Content-Encoding, Transfer-Encoding and the then wrong Content-Length
+// kept as X-Archive-Orig-* headers.
+type WARCWriter struct {
+	dir  string
+	opts WARCOptions
+
+	mu     sync.Mutex
+	f      *os.File
+	size   int64
+	serial int
+	closed bool
+}
+
+// NewWARCWriter creates dir if needed and returns a writer archiving into
+// it. The first file is created with the first exchange.
+func NewWARCWriter(dir string, opts WARCOptions) (*WARCWriter, error) {
+	if opts.MaxFileSize <= 0 {
+		opts.MaxFileSize = defaultWARCMaxFileSize
+	}
+	if opts.Prefix == "" {
+		opts.Prefix = defaultWARCPrefix
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create WARC directory: %w", err)
+	}
+	return &WARCWriter{dir: dir, opts: opts}, nil
+}
+
+// Close closes the current file. Exchanges written afterwards fail with
+// os.ErrClosed.
+func (w *WARCWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	if w.f == nil {
+		return nil
+	}
+	err := w.f.Close()
+	w.f = nil
+	return err
+}
+
+// warcPayload is the block of a record: an HTTP head followed by a body
+type warcPayload struct {
+	head      []byte
+	body      io.Reader
+	size      int64 // Body length
+	block     string
+	payload   string
+	truncated bool
+}
+
+func (p *warcPayload) length() int64 {
+	return int64(len(p.head)) + p.size
+}
+
+// bytesPayload returns the payload for a body held in memory
+func bytesPayload(head, body []byte) *warcPayload {
+	block := sha1.New()
+	block.Write(head)
+	block.Write(body)
+	payload := sha1.Sum(body)
+	return &warcPayload{
+		head:    head,
+		body:    bytes.NewReader(body),
+		size:    int64(len(body)),
+		block:   warcDigest(block.Sum(nil)),
+		payload: warcDigest(payload[:]),
+	}
+}
+
+// warcSpool collects a streamed body and its digests. The body stays in
+// memory up to warcSpoolMemory and moves to a temporary file beyond that.
+type warcSpool struct {
+	dir     string
+	head    []byte
+	buf     bytes.Buffer
+	file    *os.File
+	size    int64
+	block   hash.Hash
+	payload hash.Hash
+}
+
+func newWARCSpool(dir string, head []byte) *warcSpool {
+	s := &warcSpool{dir: dir, head: head, block: sha1.New(), payload: sha1.New()}
+	s.block.Write(head)
+	return s
+}
+
+func (s *warcSpool) Write(p []byte) (int, error) {
+	if s.file == nil && s.buf.Len()+len(p) > warcSpoolMemory {
+		f, err := os.CreateTemp(s.dir, ".spool-*")
+		if err != nil {
+			return 0, err
+		}
+		s.file = f
+		if _, err := s.buf.WriteTo(f); err != nil {
+			return 0, err
+		}
+	}
+	var err error
+	if s.file != nil {
+		_, err = s.file.Write(p)
+	} else {
+		s.buf.Write(p)
+	}
+	if err != nil {
+		return 0, err
+	}
+	s.block.Write(p)
+	s.payload.Write(p)
+	s.size += int64(len(p))
+	return len(p), nil
+}
+
+// finish returns the collected payload, valid until release
+func (s *warcSpool) finish(truncated bool) (*warcPayload, error) {
+	p := &warcPayload{
+		head:      s.head,
+		body:      bytes.NewReader(s.buf.Bytes()),
+		size:      s.size,
+		block:     warcDigest(s.block.Sum(nil)),
+		payload:   warcDigest(s.payload.Sum(nil)),
+		truncated: truncated,
+	}
+	if s.file != nil {
+		if _, err := s.file.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+		p.body = s.file
+	}
+	return p, nil
+}
+
+func (s *warcSpool) release() {
+	if s.file != nil {
+		s.file.Close()
+		os.Remove(s.file.Name())
+		s.file = nil
+	}
+}
+
+// writeExchange archives a request and its response as a record pair
+func (w *WARCWriter) writeExchange(date time.Time, targetURI string, req, resp *warcPayload) error {
+	respID := warcRecordID()
+	reqID := warcRecordID()
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return os.ErrClosed
+	}
+	if w.f == nil || w.size >= w.opts.MaxFileSize {
+		if err := w.rotate(); err != nil {
+			return err
+		}
+	}
+
+	// Response first: it is the record replay tools look up
+	err := w.writeRecord([][2]string{
+		{"WARC-Type", "response"},
+		{"WARC-Record-ID", respID},
+		{"WARC-Date", warcDate(date)},
+		{"WARC-Target-URI", targetURI},
+		{"Content-Type", "application/http;msgtype=response"},
+	}, resp)
+	if err != nil {
+		return err
+	}
+	return w.writeRecord([][2]string{
+		{"WARC-Type", "request"},
+		{"WARC-Record-ID", reqID},
+		{"WARC-Date", warcDate(date)},
+		{"WARC-Target-URI", targetURI},
+		{"WARC-Concurrent-To", respID},
+		{"Content-Type", "application/http;msgtype=request"},
+	}, req)
+}
+
+// rotate closes the current file and opens the next one, starting it with
+// a warcinfo record. Caller holds w.mu.
+func (w *WARCWriter) rotate() error {
+	if w.f != nil {
+		if err := w.f.Close(); err != nil {
+			return err
+		}
+		w.f = nil
+	}
+
+	ext := ".warc"
+	if w.opts.Compress {
+		ext = ".warc.gz"
+	}
+	now := time.Now().UTC()
+	var (
+		f    *os.File
+		name string
+		err  error
+	)
+	// Another writer may be using the same directory and prefix
+	for tries := 0; tries < 100; tries++ {
+		name = fmt.Sprintf("%s-%s-%05d%s", w.opts.Prefix, now.Format("20060102150405"), w.serial, ext)
+		w.serial++
+		f, err = os.OpenFile(filepath.Join(w.dir, name), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if !errors.Is(err, os.ErrExist) {
+			break
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create WARC file: %w", err)
+	}
+	w.f = f
+	w.size = 0
+
+	info := []byte("software: httpcloak\r\n" +
+		"format: WARC File Format 1.1\r\n" +
+		"conformsTo: http://iipc.github.io/warc-specifications/specifications/warc-format/warc-1.1/\r\n")
+	return w.writeRecord([][2]string{
+		{"WARC-Type", "warcinfo"},
+		{"WARC-Record-ID", warcRecordID()},
+		{"WARC-Date", warcDate(now)},
+		{"WARC-Filename", name},
+		{"Content-Type", "application/warc-fields"},
+	}, &warcPayload{head: info, body: bytes.NewReader(nil)})
+}
+
+// writeRecord appends one record to the current file. Caller holds w.mu.
+func (w *WARCWriter) writeRecord(fields [][2]string, p *warcPayload) error {
+	var header bytes.Buffer
+	header.WriteString("WARC/1.1\r\n")
+	for _, f := range fields {
+		header.WriteString(f[0] + ": " + f[1] + "\r\n")
+	}
+	if p.block != "" {
+		header.WriteString("WARC-Block-Digest: " + p.block + "\r\n")
+		header.WriteString("WARC-Payload-Digest: " + p.payload + "\r\n")
+	}
+	if p.truncated {
+		header.WriteString("WARC-Truncated: unspecified\r\n")
+	}
+	header.WriteString("Content-Length: " + strconv.FormatInt(p.length(), 10) + "\r\n\r\n")
+
+	counter := &countingWriter{w: w.f}
+	var out io.Writer = counter
+	var gz *gzip.Writer
+	if w.opts.Compress {
+		gz = gzip.NewWriter(counter)
+		out = gz
+	}
+	_, err := header.WriteTo(out)
+	if err == nil {
+		_, err = out.Write(p.head)
+	}
+	if err == nil {
+		_, err = io.Copy(out, p.body)
+	}
+	if err == nil {
+		_, err = io.WriteString(out, "\r\n\r\n")
+	}
+	if gz != nil {
+		if cerr := gz.Close(); err == nil {
+			err = cerr
+		}
+	}
+	w.size += counter.n
+	return err
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func warcDigest(sum []byte) string {
+	return "sha1:" + base32.StdEncoding.EncodeToString(sum)
+}
+
+func warcDate(t time.Time) string {
+	return t.UTC().Format("2006-01-02T15:04:05.000000Z")
+}
+
+// warcRecordID returns a random (version 4) UUID URN
+func warcRecordID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("<urn:uuid:%x-%x-%x-%x-%x>", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// warcRequestHead renders the request line and headers as HTTP/1.1
+func warcRequestHead(req *transport.Request) []byte {
+	target, host := "/", ""
+	if u, err := url.Parse(req.URL); err == nil {
+		target, host = u.RequestURI(), u.Host
+	}
+	var b bytes.Buffer
+	b.WriteString(req.Method + " " + target + " HTTP/1.1\r\n")
+	if _, ok := req.Headers["Host"]; !ok && host != "" {
+		b.WriteString("Host: " + host + "\r\n")
+	}
+	writeWARCHeaders(&b, req.Headers, false)
+	b.WriteString("\r\n")
+	return b.Bytes()
+}
+
+// warcResponseHead renders the status line and headers as HTTP/1.1
+func warcResponseHead(statusCode int, headers map[string][]string) []byte {
+	var b bytes.Buffer
+	b.WriteString("HTTP/1.1 " + strconv.Itoa(statusCode) + " " + http.StatusText(statusCode) + "\r\n")
+	writeWARCHeaders(&b, headers, true)
+	b.WriteString("\r\n")
+	return b.Bytes()
+}
+
+// writeWARCHeaders writes headers sorted by canonical name. For response
+// headers the framing and coding headers that don't describe the archived
+// (decoded, unchunked) body are renamed to X-Archive-Orig-*.
+func writeWARCHeaders(b *bytes.Buffer, headers map[string][]string, response bool) {
+	decoded := false
+	if response {
+		for name, values := range headers {
+			if http.CanonicalHeaderKey(name) == "Content-Encoding" && len(values) > 0 &&
+				!strings.EqualFold(values[0], "identity") && values[0] != "" {
+				decoded = true
+			}
+		}
+	}
+
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		if !strings.HasPrefix(name, ":") {
+			names = append(names, name)
+		}
+	}
+	sort.Slice(names, func(i, j int) bool {
+		return http.CanonicalHeaderKey(names[i]) < http.CanonicalHeaderKey(names[j])
+	})
+	for _, name := range names {
+		key := http.CanonicalHeaderKey(name)
+		if response {
+			switch key {
+			case "Transfer-Encoding":
+				key = "X-Archive-Orig-" + key
+			case "Content-Encoding", "Content-Length":
+				if decoded {
+					key = "X-Archive-Orig-" + key
+				}
+			}
+		}
+		for _, v := range headers[name] {
+			b.WriteString(key + ": " + v + "\r\n")
+		}
+	}
+}
+
+// EnableWARC archives every exchange of the session, including those of
+// its forks, as WARC 1.1 files in dir. A writer previously opened by
+// EnableWARC is closed.
+func (s *Session) EnableWARC(dir string) error {
+	w, err := NewWARCWriter(dir, WARCOptions{})
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	old, owned := s.warc, s.ownsWARC
+	s.warc, s.ownsWARC = w, true
+	s.mu.Unlock()
+	if old != nil && owned {
+		old.Close()
+	}
+	return nil
+}
+
+// SetWARCWriter archives the session's exchanges with w, which may be shared
+// between sessions and stays open when the session closes. Nil stops
+// archiving.
+func (s *Session) SetWARCWriter(w *WARCWriter) {
+	s.mu.Lock()
+	old, owned := s.warc, s.ownsWARC
+	s.warc, s.ownsWARC = w, false
+	s.mu.Unlock()
+	if old != nil && owned && old != w {
+		old.Close()
+	}
+}
+
+func (s *Session) warcWriter() *WARCWriter {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.warc
+}
+
+// archiveExchange writes a buffered response to the WARC archive, if any.
+// Archiving must never fail the request.
+func (s *Session) archiveExchange(req *transport.Request, started time.Time, resp *transport.Response) {
+	w := s.warcWriter()
+	if w == nil {
+		return
+	}
+	body, err := resp.Bytes()
+	respPayload := bytesPayload(warcResponseHead(resp.StatusCode, resp.Headers), body)
+	respPayload.truncated = err != nil
+	w.writeExchange(started, req.URL, warcRequestPayload(req), respPayload)
+}
+
+// archiveStream tees a streamed response into the WARC archive, if any.
+// The records are written once the caller has read the body to the end or
+// closed it, marked truncated in the latter case.
+func (s *Session) archiveStream(req *transport.Request, started time.Time, resp *StreamResponse) {
+	w := s.warcWriter()
+	if w == nil {
+		return
+	}
+	reqPayload := warcRequestPayload(req)
+	spool := newWARCSpool(w.dir, warcResponseHead(resp.StatusCode, resp.Headers))
+	resp.Tee(spool, func(err error) {
+		defer spool.release()
+		if p, perr := spool.finish(err != nil); perr == nil {
+			w.writeExchange(started, req.URL, reqPayload, p)
+		}
+	})
+}
+
+func warcRequestPayload(req *transport.Request) *warcPayload {
+	if u, ok := req.BodyReader.(*warcUpload); ok {
+		p := bytesPayload(warcRequestHead(req), u.buf.Bytes())
+		p.truncated = !u.done
+		return p
+	}
+	p := bytesPayload(warcRequestHead(req), req.Body)
+	p.truncated = req.BodyReader != nil
+	return p
+}
+
+// captureUpload keeps a copy of a streamed upload for the request record
+// when archiving. Readers of known length become req.Body, which sends the
+// same Content-Length; others are copied as the transport reads them.
+func (s *Session) captureUpload(req *transport.Request) {
+	if req.BodyReader == nil || s.warcWriter() == nil {
+		return
+	}
+	switch req.BodyReader.(type) {
+	case *bytes.Reader, *bytes.Buffer, *strings.Reader:
+		if data, err := io.ReadAll(req.BodyReader); err == nil {
+			req.Body, req.BodyReader = data, nil
+		}
+	case *warcUpload:
+	default:
+		req.BodyReader = &warcUpload{r: req.BodyReader}
+	}
+}
+
+// warcUpload copies an upload of unknown length as it is sent
+type warcUpload struct {
+	r    io.Reader
+	buf  bytes.Buffer
+	done bool
+}
+
+func (u *warcUpload) Read(p []byte) (int, error) {
+	n, err := u.r.Read(p)
+	u.buf.Write(p[:n])
+	if err == io.EOF {
+		u.done = true
+	}
+	return n, err
+}
@@ -0,0 +1,170 @@
+package session
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha1"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/sardanioss/httpcloak/protocol"
+	"github.com/sardanioss/httpcloak/transport"
+)
+
+type warcTestRecord struct {
+	fields map[string]string
+	block  []byte
+}
+
+// readWARC parses every record in the files of dir, checking lengths and
+// block digests
+func readWARC(t *testing.T, dir string) (records []warcTestRecord, files int) {
+	t.Helper()
+	paths, _ := filepath.Glob(filepath.Join(dir, "*.warc*"))
+	for _, path := range paths {
+		f, err := os.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		var r io.Reader = f
+		if strings.HasSuffix(path, ".gz") {
+			if r, err = gzip.NewReader(f); err != nil {
+				t.Fatal(err)
+			}
+		}
+		br := bufio.NewReader(r)
+		for {
+			line, err := br.ReadString('\n')
+			if err == io.EOF && line == "" {
+				break
+			}
+			if line != "WARC/1.1\r\n" {
+				t.Fatalf("%s: record starts with %q", path, line)
+			}
+			rec := warcTestRecord{fields: make(map[string]string)}
+			for {
+				line, _ = br.ReadString('\n')
+				if line == "\r\n" {
+					break
+				}
+				name, value, _ := strings.Cut(strings.TrimRight(line, "\r\n"), ": ")
+				rec.fields[name] = value
+			}
+			n, _ := strconv.Atoi(rec.fields["Content-Length"])
+			rec.block = make([]byte, n)
+			if _, err := io.ReadFull(br, rec.block); err != nil {
+				t.Fatalf("%s: short block: %v", path, err)
+			}
+			end := make([]byte, 4)
+			if io.ReadFull(br, end); string(end) != "\r\n\r\n" {
+				t.Fatalf("%s: record not terminated", path)
+			}
+			if digest := rec.fields["WARC-Block-Digest"]; digest != "" {
+				sum := sha1.Sum(rec.block)
+				if digest != warcDigest(sum[:]) {
+					t.Errorf("%s: block digest mismatch", path)
+				}
+			}
+			records = append(records, rec)
+		}
+		files++
+	}
+	return records, files
+}
+
+func TestWARCExchange(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "text/plain")
+		fmt.Fprintf(w, "echo %s", body)
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	s := NewSession("", &protocol.SessionConfig{Preset: "chrome-latest", ForceHTTP1: true})
+	if err := s.EnableWARC(dir); err != nil {
+		t.Fatal(err)
+	}
+	_, err := s.Request(context.Background(), &transport.Request{Method: "POST", URL: srv.URL + "/a?q=1", BodyReader: strings.NewReader("hello")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream, err := s.RequestStream(context.Background(), &transport.Request{Method: "GET", URL: srv.URL + "/b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.Copy(io.Discard, stream)
+	stream.Close()
+	s.Close()
+
+	records, files := readWARC(t, dir)
+	if files != 1 || len(records) != 5 {
+		t.Fatalf("%d records in %d files, want warcinfo and two pairs in one", len(records), files)
+	}
+	if records[0].fields["WARC-Type"] != "warcinfo" {
+		t.Errorf("first record is %q", records[0].fields["WARC-Type"])
+	}
+	resp, req := records[1], records[2]
+	if resp.fields["WARC-Type"] != "response" || req.fields["WARC-Type"] != "request" ||
+		req.fields["WARC-Concurrent-To"] != resp.fields["WARC-Record-ID"] {
+		t.Errorf("records not paired: %v / %v", resp.fields, req.fields)
+	}
+	if !bytes.HasPrefix(req.block, []byte("POST /a?q=1 HTTP/1.1\r\n")) || !bytes.HasSuffix(req.block, []byte("\r\n\r\nhello")) {
+		t.Errorf("request block = %q", req.block)
+	}
+	if !bytes.HasPrefix(resp.block, []byte("HTTP/1.1 200 OK\r\n")) || !bytes.HasSuffix(resp.block, []byte("\r\n\r\necho hello")) {
+		t.Errorf("response block = %q", resp.block)
+	}
+	payload := sha1.Sum([]byte("echo hello"))
+	if resp.fields["WARC-Payload-Digest"] != warcDigest(payload[:]) {
+		t.Errorf("payload digest = %s", resp.fields["WARC-Payload-Digest"])
+	}
+	if uri := records[3].fields["WARC-Target-URI"]; uri != srv.URL+"/b" || !bytes.HasSuffix(records[3].block, []byte("echo ")) {
+		t.Errorf("streamed response %s = %q", uri, records[3].block)
+	}
+}
+
+func TestWARCRotation(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(bytes.Repeat([]byte("x"), 2000))
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	w, err := NewWARCWriter(dir, WARCOptions{MaxFileSize: 10000, Compress: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewSession("", &protocol.SessionConfig{Preset: "chrome-latest", ForceHTTP1: true})
+	defer s.Close()
+	s.SetWARCWriter(w)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 40; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := s.Request(context.Background(), &transport.Request{Method: "GET", URL: srv.URL}); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	w.Close()
+
+	records, files := readWARC(t, dir)
+	if files < 2 || len(records) != 80+files {
+		t.Errorf("%d records in %d files, want 80 plus a warcinfo per file", len(records), files)
+	}
+}
@@ -28,12 +28,119 @@ type subresource struct {
 	typ  resourceType
 }
 
+// String returns the fetch destination for the resource type.
+func (t resourceType) String() string {
+	switch t {
+	case resourceCSS:
+		return "style"
+	case resourceJS:
+		return "script"
+	case resourceImage:
+		return "image"
+	case resourceFont:
+		return "font"
+	}
+	return ""
+}
+
+// Subresource is a resource referenced by an HTML page.
+type Subresource struct {
+	URL  string // Absolute URL
+	Type string // Fetch destination: "style", "script", "image" or "font"
+}
+
+// ExtractSubresources returns the stylesheets, scripts, images, icons and
+// preloaded fonts referenced by an HTML document, in document order, with URLs
+// resolved against baseURL and duplicates removed. This is the same parsing
+// Warmup uses, without its cap on the number of resources.
+func ExtractSubresources(baseURL string, body []byte) []Subresource {
+	resources := extractSubresources(body, baseURL, 0)
+	out := make([]Subresource, len(resources))
+	for i, r := range resources {
+		out[i] = Subresource{URL: r.url, Type: r.typ.String()}
+	}
+	return out
+}
+
 // maxSubresources caps how many subresources we fetch.
 const maxSubresources = 50
 
 // concurrencyLimit matches Chrome's per-host H1 connection limit.
 const concurrencyLimit = 6
 
+// ContentHandler receives responses fetched during Warmup whose Content-Type
+// matches a registered pattern. Handlers for subresources run concurrently,
+// so they must be safe for concurrent use.
+type ContentHandler func(url, contentType string, body []byte)
+
+// contentRoute is a registered OnContentType handler.
+type contentRoute struct {
+	pattern string
+	handler ContentHandler
+}
+
+// OnContentType registers a handler for Warmup responses (the page itself and
+// its subresources) whose media type matches pattern. Patterns are an exact
+// type ("application/json"), a type wildcard ("image/*"), or "*/*" for all.
+// Parameters such as charset are ignored when matching. Registering a pattern
+// again replaces its handler; a nil handler removes it.
+func (s *Session) OnContentType(pattern string, handler ContentHandler) {
+	pattern = strings.ToLower(strings.TrimSpace(pattern))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, route := range s.contentRoutes {
+		if route.pattern == pattern {
+			if handler == nil {
+				s.contentRoutes = append(s.contentRoutes[:i:i], s.contentRoutes[i+1:]...)
+			} else {
+				s.contentRoutes[i].handler = handler
+			}
+			return
+		}
+	}
+	if handler != nil {
+		s.contentRoutes = append(s.contentRoutes, contentRoute{pattern: pattern, handler: handler})
+	}
+}
+
+// contentHandlersFor returns the handlers whose pattern matches contentType.
+func (s *Session) contentHandlersFor(contentType string) []ContentHandler {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if len(s.contentRoutes) == 0 {
+		return nil
+	}
+
+	mediaType := strings.ToLower(strings.TrimSpace(strings.SplitN(contentType, ";", 2)[0]))
+	var handlers []ContentHandler
+	for _, route := range s.contentRoutes {
+		if matchMediaType(route.pattern, mediaType) {
+			handlers = append(handlers, route.handler)
+		}
+	}
+	return handlers
+}
+
+// matchMediaType reports whether mediaType matches an OnContentType pattern.
+func matchMediaType(pattern, mediaType string) bool {
+	if pattern == "*/*" || pattern == "*" || pattern == mediaType {
+		return true
+	}
+	if prefix, ok := strings.CutSuffix(pattern, "/*"); ok {
+		return strings.HasPrefix(mediaType, prefix+"/")
+	}
+	return false
+}
+
+// dispatchContent hands a fetched body to every matching handler.
+func dispatchContent(handlers []ContentHandler, url, contentType string, body []byte) {
+	for _, handler := range handlers {
+		handler(url, contentType, body)
+	}
+}
+
 // Warmup simulates a real browser page load: fetches the HTML, discovers
 // subresources (CSS, JS, images, fonts), and fetches them in batches with
 // realistic timing. Cookies, TLS sessions, cache state, and client hints
@@ -58,11 +165,17 @@ func (s *Session) Warmup(ctx context.Context, url string) error {
 		return err
 	}
 
-	// Non-HTML response — still warmed TLS/cookies, return success
 	ct := ""
 	if vals, ok := resp.Headers["content-type"]; ok && len(vals) > 0 {
 		ct = vals[0]
 	}
+	navURL := resp.FinalURL
+	if navURL == "" {
+		navURL = url
+	}
+	dispatchContent(s.contentHandlersFor(ct), navURL, ct, body)
+
+	// Non-HTML response — still warmed TLS/cookies, return success
 	if !strings.Contains(ct, "text/html") {
 		return nil
 	}
@@ -74,10 +187,7 @@ func (s *Session) Warmup(ctx context.Context, url string) error {
 	cssAndFonts, scripts, images := groupByPriority(resources)
 
 	// 4. Fetch batches with inter-batch delays
-	pageURL := resp.FinalURL
-	if pageURL == "" {
-		pageURL = url
-	}
+	pageURL := navURL
 
 	batches := [][]subresource{cssAndFonts, scripts, images}
 	delays := []struct{ min, max int }{{0, 0}, {50, 150}, {100, 300}}
@@ -105,8 +215,14 @@ func (s *Session) Warmup(ctx context.Context, url string) error {
 	return nil
 }
 
-// parseSubresources tokenizes HTML and extracts subresource URLs.
+// parseSubresources tokenizes HTML and extracts subresource URLs for Warmup.
 func parseSubresources(body []byte, baseURL string) []subresource {
+	return extractSubresources(body, baseURL, maxSubresources)
+}
+
+// extractSubresources tokenizes HTML and extracts up to limit subresource URLs
+// (0 = no limit).
+func extractSubresources(body []byte, baseURL string, limit int) []subresource {
 	tokenizer := html.NewTokenizer(strings.NewReader(string(body)))
 	seen := make(map[string]bool)
 	var resources []subresource
@@ -185,7 +301,7 @@ func parseSubresources(body []byte, baseURL string) []subresource {
 			}
 		}
 
-		if len(resources) >= maxSubresources {
+		if limit > 0 && len(resources) >= limit {
 			break
 		}
 	}
@@ -271,10 +387,27 @@ func fetchBatch(ctx context.Context, s *Session, batch []subresource, pageURL st
 				Headers: headers,
 			}
 
-			resp, err := s.Request(ctx, req)
+			resp, err := s.Request(withTopFrame(ctx, pageURL), req)
 			if err != nil {
 				return
 			}
+
+			// Hand the body to matching OnContentType handlers
+			ct := resp.GetHeader("content-type")
+			if handlers := s.contentHandlersFor(ct); len(handlers) > 0 {
+				body, err := resp.Bytes()
+				if err != nil {
+					resp.Close()
+					return
+				}
+				finalURL := resp.FinalURL
+				if finalURL == "" {
+					finalURL = r.url
+				}
+				dispatchContent(handlers, finalURL, ct, body)
+				return
+			}
+
 			// Discard body — side effects (cookies/cache/TLS) already captured
 			if resp.Body != nil {
 				io.Copy(io.Discard, resp.Body)
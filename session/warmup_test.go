@@ -2,9 +2,16 @@ package session
 
 import (
 	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
 	"testing"
 
 	"github.com/sardanioss/httpcloak/fingerprint"
+	"github.com/sardanioss/httpcloak/protocol"
 )
 
 func TestParseSubresources(t *testing.T) {
@@ -290,3 +297,99 @@ func assertHeader(t *testing.T, headers map[string][]string, key, want string) {
 		t.Errorf("header %q = %q, want %q", key, vals[0], want)
 	}
 }
+
+func TestOnContentType(t *testing.T) {
+	s := &Session{}
+	var got []string
+	s.OnContentType("application/json", func(url, contentType string, body []byte) { got = append(got, "json") })
+	s.OnContentType("image/*", func(url, contentType string, body []byte) { got = append(got, "image") })
+
+	tests := []struct {
+		contentType string
+		want        int
+	}{
+		{"application/json; charset=utf-8", 1},
+		{"Image/PNG", 1},
+		{"text/html", 0},
+		{"", 0},
+	}
+	for _, tt := range tests {
+		if n := len(s.contentHandlersFor(tt.contentType)); n != tt.want {
+			t.Errorf("contentHandlersFor(%q) = %d handlers, want %d", tt.contentType, n, tt.want)
+		}
+	}
+
+	dispatchContent(s.contentHandlersFor("application/json"), "https://example.com/api", "application/json", nil)
+	if len(got) != 1 || got[0] != "json" {
+		t.Errorf("unexpected dispatch: %v", got)
+	}
+
+	s.OnContentType("application/json", nil)
+	if n := len(s.contentHandlersFor("application/json")); n != 0 {
+		t.Errorf("handler still registered after removal")
+	}
+}
+
+func TestWarmupCachePartitioning(t *testing.T) {
+	var mu sync.Mutex
+	var revalidated []bool
+	var port string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/lib.js" {
+			mu.Lock()
+			revalidated = append(revalidated, r.Header.Get("If-None-Match") != "")
+			mu.Unlock()
+			w.Header().Set("ETag", `"v1"`)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprintf(w, `<script src="http://cdn.test:%s/lib.js"></script>`, port)
+	}))
+	defer srv.Close()
+	port = srv.URL[strings.LastIndex(srv.URL, ":")+1:]
+
+	for _, partition := range []bool{false, true} {
+		revalidated = nil
+		s := NewSession("", &protocol.SessionConfig{Preset: "chrome-latest", ForceHTTP1: true, PartitionHTTPCache: partition})
+		for _, host := range []string{"a.test", "b.test", "cdn.test"} {
+			s.transport.GetDNSCache().SetOverride(host, []net.IP{net.IPv4(127, 0, 0, 1)})
+		}
+		for _, page := range []string{"a.test", "a.test", "b.test"} {
+			if err := s.Warmup(context.Background(), "http://"+page+":"+port+"/"); err != nil {
+				t.Fatal(err)
+			}
+		}
+		s.Close()
+
+		// The script is cached on a.test's first visit; b.test's page only
+		// reuses the entry without partitioning
+		want := fmt.Sprint([]bool{false, true, !partition})
+		if got := fmt.Sprint(revalidated); got != want {
+			t.Errorf("partition=%v: revalidated %s, want %s", partition, got, want)
+		}
+	}
+}
+
+func TestExtractSubresources(t *testing.T) {
+	html := []byte(`<html><head>
+	<link rel="stylesheet" href="/main.css">
+	<link rel="preload" href="/font.woff2" as="font">
+	<script src="app.js"></script>
+	</head><body><img src="https://cdn.example.com/logo.png"><img src="/main.css"></body></html>`)
+
+	got := ExtractSubresources("https://example.com/page/", html)
+	want := []Subresource{
+		{URL: "https://example.com/main.css", Type: "style"},
+		{URL: "https://example.com/font.woff2", Type: "font"},
+		{URL: "https://example.com/page/app.js", Type: "script"},
+		{URL: "https://cdn.example.com/logo.png", Type: "image"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d resources, want %d: %+v", len(got), len(want), got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("resource %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
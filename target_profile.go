@@ -0,0 +1,273 @@
+package httpcloak
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sardanioss/httpcloak/session"
+	"github.com/sardanioss/httpcloak/transport"
+	"gopkg.in/yaml.v3"
+)
+
+// TargetProfile bundles what is known about how to reach one site, so the
+// knowledge travels between jobs and teammates instead of living in code.
+// Files are YAML or JSON (by extension: .json is JSON, anything else YAML):
+//
+//	name: example-shop
+//	hosts:
+//	  www.example.com:
+//	    addresses: [203.0.113.10, 203.0.113.11]
+//	    protocol: h2
+//	    rate_limit:
+//	      requests: 60
+//	      per: 1m
+//	      wait: true
+//	    headers:
+//	      Referer: https://www.example.com/
+//	  static.example.com:
+//	    connect_to: cdn.example.net
+//	challenge_rules:
+//	  - vendor: example
+//	    status: [403]
+//	    body: Please verify you are a human
+//	    challenge: true
+type TargetProfile struct {
+	Name string `json:"name,omitempty"`
+
+	// Hosts is keyed by hostname
+	Hosts map[string]TargetHostProfile `json:"hosts,omitempty"`
+
+	// ChallengeRules recognize the site's challenge pages. Rules marked
+	// challenge extend the built-in detection that stops retries when a
+	// challenge keeps coming back (session.LoopChallenge).
+	ChallengeRules []BlockRule `json:"challenge_rules,omitempty"`
+}
+
+// TargetHostProfile is what a TargetProfile knows about one hostname
+type TargetHostProfile struct {
+	// Addresses pins the hostname to these IPs instead of resolving it
+	Addresses []string `json:"addresses,omitempty"`
+
+	// ConnectTo dials this host instead, keeping the hostname for SNI and
+	// the Host header (see WithConnectTo)
+	ConnectTo string `json:"connect_to,omitempty"`
+
+	// Protocol the host is known to speak ("h1", "h2" or "h3"), used by auto
+	// mode instead of racing. Protocols the session already learned win.
+	Protocol string `json:"protocol,omitempty"`
+
+	RateLimit *TargetRateLimit `json:"rate_limit,omitempty"`
+
+	// Headers are added to every request to the host that doesn't set them
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+// TargetRateLimit caps the requests and/or bytes exchanged with a host per
+// window (see session.TrafficBudget)
+type TargetRateLimit struct {
+	Requests int      `json:"requests,omitempty"`
+	Bytes    int64    `json:"bytes,omitempty"`
+	Per      Duration `json:"per"`
+
+	// Wait delays requests over the limit instead of failing them
+	Wait bool `json:"wait,omitempty"`
+}
+
+// LoadTargetProfile reads a TargetProfile from a YAML or JSON file
+func LoadTargetProfile(path string) (*TargetProfile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var p TargetProfile
+	if err := decodeConfigFile(data, strings.EqualFold(filepath.Ext(path), ".json"), &p); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &p, nil
+}
+
+// Save writes the profile to path as YAML or JSON (by extension)
+func (p *TargetProfile) Save(path string) error {
+	data, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return err
+	}
+	if !strings.EqualFold(filepath.Ext(path), ".json") {
+		var doc interface{}
+		if err := json.Unmarshal(data, &doc); err != nil {
+			return err
+		}
+		if data, err = yaml.Marshal(doc); err != nil {
+			return err
+		}
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// LoadTargetProfile reads a TargetProfile file and applies it to the session
+func (s *Session) LoadTargetProfile(path string) error {
+	p, err := LoadTargetProfile(path)
+	if err != nil {
+		return err
+	}
+	if err := s.ApplyTargetProfile(p); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+// ApplyTargetProfile applies a profile to the session. Nothing is applied
+// if any part of it is invalid. Profiles add to what earlier ones set, and
+// forks see only the profiles applied before they were made.
+func (s *Session) ApplyTargetProfile(p *TargetProfile) error {
+	// Validate everything before changing the session
+	addresses := make(map[string][]net.IP)
+	hints := make(map[string]transport.Protocol)
+	var budgets []session.TrafficBudget
+	for host, h := range p.Hosts {
+		for _, addr := range h.Addresses {
+			ip := net.ParseIP(addr)
+			if ip == nil {
+				return fmt.Errorf("host %s: invalid address %q", host, addr)
+			}
+			addresses[host] = append(addresses[host], ip)
+		}
+		if h.Protocol != "" {
+			proto, ok := targetProtocols[strings.ToLower(h.Protocol)]
+			if !ok {
+				return fmt.Errorf("host %s: unknown protocol %q (want h1, h2 or h3)", host, h.Protocol)
+			}
+			hints[host] = proto
+		}
+		if r := h.RateLimit; r != nil {
+			if r.Per <= 0 || (r.Requests <= 0 && r.Bytes <= 0) {
+				return fmt.Errorf("host %s: rate limit needs per and requests or bytes", host)
+			}
+			budgets = append(budgets, session.TrafficBudget{Host: host, Requests: r.Requests, Bytes: r.Bytes, Per: time.Duration(r.Per), Wait: r.Wait})
+		}
+	}
+
+	s.profileMu.Lock()
+	defer s.profileMu.Unlock()
+	rules := append(append([]BlockRule(nil), s.challengeRules...), p.ChallengeRules...)
+	classifier, err := NewBlockClassifier(rules)
+	if err != nil {
+		return fmt.Errorf("challenge rules: %w", err)
+	}
+
+	t := s.inner.GetTransport()
+	if dnsCache := t.GetDNSCache(); dnsCache != nil {
+		for host, ips := range addresses {
+			dnsCache.SetOverride(host, ips)
+		}
+	}
+	t.SetProtocolHints(hints)
+	s.inner.AddTrafficBudgets(budgets...)
+	for host, h := range p.Hosts {
+		if h.ConnectTo != "" {
+			t.SetConnectTo(host, h.ConnectTo)
+		}
+		if len(h.Headers) > 0 {
+			headers := s.inner.HostHeaders()[strings.ToLower(host)]
+			merged := make(map[string][]string, len(headers)+len(h.Headers))
+			for name, values := range headers {
+				merged[name] = values
+			}
+			for name, value := range h.Headers {
+				merged[name] = []string{value}
+			}
+			s.inner.SetHostHeaders(host, merged)
+		}
+	}
+	if len(p.ChallengeRules) > 0 {
+		s.challengeRules = rules
+		s.inner.SetChallengeCheck(func(resp *transport.Response) bool {
+			body, _ := resp.Bytes()
+			match, _ := classifier.Classify(&Response{StatusCode: resp.StatusCode, Headers: resp.Headers, bodyBytes: body, bodyRead: true})
+			return match != nil && match.Challenge
+		})
+	}
+	return nil
+}
+
+var targetProtocols = map[string]transport.Protocol{
+	"h1": transport.ProtocolHTTP1,
+	"h2": transport.ProtocolHTTP2,
+	"h3": transport.ProtocolHTTP3,
+}
+
+// TargetProfile exports what the session knows about hosts (all hosts when
+// none are given): pinned addresses, connect-to mappings, learned
+// protocols, per-host rate limits and headers, and the challenge rules of
+// applied profiles
+func (s *Session) TargetProfile(hosts ...string) *TargetProfile {
+	p := &TargetProfile{Hosts: make(map[string]TargetHostProfile)}
+	wanted := func(host string) bool {
+		if len(hosts) == 0 {
+			return true
+		}
+		for _, h := range hosts {
+			if strings.EqualFold(h, host) {
+				return true
+			}
+		}
+		return false
+	}
+	update := func(host string, f func(h *TargetHostProfile)) {
+		if !wanted(host) {
+			return
+		}
+		h := p.Hosts[host]
+		f(&h)
+		p.Hosts[host] = h
+	}
+
+	t := s.inner.GetTransport()
+	if dnsCache := t.GetDNSCache(); dnsCache != nil {
+		for host, ips := range dnsCache.Overrides() {
+			update(host, func(h *TargetHostProfile) {
+				for _, ip := range ips {
+					h.Addresses = append(h.Addresses, ip.String())
+				}
+			})
+		}
+	}
+	for host, connectHost := range t.ConnectTo() {
+		update(host, func(h *TargetHostProfile) { h.ConnectTo = connectHost })
+	}
+	for host, proto := range t.ProtocolHints() {
+		update(host, func(h *TargetHostProfile) { h.Protocol = proto.String() })
+	}
+	for _, b := range s.inner.TrafficBudgets() {
+		if b.Host == "" {
+			continue
+		}
+		update(b.Host, func(h *TargetHostProfile) {
+			h.RateLimit = &TargetRateLimit{Requests: b.Requests, Bytes: b.Bytes, Per: Duration(b.Per), Wait: b.Wait}
+		})
+	}
+	for host, headers := range s.inner.HostHeaders() {
+		update(host, func(h *TargetHostProfile) {
+			h.Headers = make(map[string]string, len(headers))
+			for name, values := range headers {
+				if len(values) > 0 {
+					h.Headers[name] = values[0]
+				}
+			}
+		})
+	}
+	for _, h := range p.Hosts {
+		sort.Strings(h.Addresses)
+	}
+
+	s.profileMu.Lock()
+	p.ChallengeRules = append([]BlockRule(nil), s.challengeRules...)
+	s.profileMu.Unlock()
+	return p
+}
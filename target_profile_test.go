@@ -0,0 +1,94 @@
+package httpcloak
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sardanioss/httpcloak/session"
+)
+
+func TestTargetProfile(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Shop-Client") != "web" {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte("please verify you are a human"))
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+	port := srv.URL[strings.LastIndex(srv.URL, ":"):]
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "shop.yaml")
+	os.WriteFile(path, []byte(`
+name: shop
+hosts:
+  shop.test:
+    addresses: [127.0.0.1]
+    protocol: h1
+    rate_limit:
+      requests: 2
+      per: 1h
+    headers:
+      X-Shop-Client: web
+  other.test:
+    addresses: [127.0.0.1]
+challenge_rules:
+  - vendor: shop
+    status: [403]
+    body: verify you are a human
+    challenge: true
+`), 0644)
+
+	sess := NewSession("chrome-latest", WithForceHTTP1(), WithRetryConfig(2, time.Millisecond, time.Millisecond, []int{403}))
+	defer sess.Close()
+	if err := sess.LoadTargetProfile(path); err != nil {
+		t.Fatal(err)
+	}
+
+	// Pinned address and required header; the second request uses up the limit
+	for i := 0; i < 2; i++ {
+		resp, err := sess.Get(context.Background(), "http://shop.test"+port)
+		if err != nil || resp.StatusCode != 200 {
+			t.Fatalf("request %d: %v", i, err)
+		}
+	}
+	if _, err := sess.Get(context.Background(), "http://shop.test"+port); !errors.Is(err, session.ErrTrafficBudgetExceeded) {
+		t.Errorf("over the rate limit: err = %v", err)
+	}
+
+	// Without the header other.test gets the site's challenge, which stops retrying
+	_, err := sess.Get(context.Background(), "http://other.test"+port)
+	var loop *session.LoopError
+	if !errors.As(err, &loop) || loop.Kind != session.LoopChallenge {
+		t.Errorf("challenge: err = %v, want a challenge loop", err)
+	}
+
+	// Export round trip
+	exported := filepath.Join(dir, "exported.json")
+	if err := sess.TargetProfile("shop.test").Save(exported); err != nil {
+		t.Fatal(err)
+	}
+	p, err := LoadTargetProfile(exported)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := p.Hosts["shop.test"]
+	if len(p.Hosts) != 1 || len(h.Addresses) != 1 || h.Protocol != "h1" || h.Headers["X-Shop-Client"] != "web" ||
+		h.RateLimit == nil || h.RateLimit.Requests != 2 || len(p.ChallengeRules) != 1 {
+		t.Errorf("exported profile = %+v", p)
+	}
+
+	bad := &TargetProfile{Hosts: map[string]TargetHostProfile{"x.test": {Protocol: "h4"}}}
+	if err := sess.ApplyTargetProfile(bad); err == nil {
+		t.Error("unknown protocol accepted")
+	}
+}
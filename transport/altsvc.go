@@ -0,0 +1,197 @@
+package transport
+
+import (
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Alt-Svc defaults (RFC 7838)
+const (
+	altSvcDefaultMaxAge = 24 * time.Hour
+	altSvcMaxEntries    = 10 // Alternatives kept per origin
+)
+
+// AltService is an alternative service an origin advertised in an Alt-Svc
+// response header (RFC 7838), e.g. h3=":443"; ma=86400
+type AltService struct {
+	Protocol string    `json:"protocol"`       // ALPN protocol ID, e.g. "h3"
+	Host     string    `json:"host,omitempty"` // Alternative host, empty for the origin's own
+	Port     int       `json:"port"`
+	Expires  time.Time `json:"expires"`
+}
+
+// parseAltSvc parses the values of Alt-Svc headers. clear reports the
+// "clear" value, which withdraws all of the origin's alternatives.
+// Malformed alternatives are skipped.
+func parseAltSvc(values []string, now time.Time) (services []AltService, clear bool) {
+	for _, value := range values {
+		for _, alt := range splitAltSvc(value) {
+			alt = strings.TrimSpace(alt)
+			if alt == "clear" {
+				return nil, true
+			}
+			params := strings.Split(alt, ";")
+			protocol, authority, ok := strings.Cut(params[0], "=")
+			if !ok {
+				continue
+			}
+			protocol, err := url.PathUnescape(strings.TrimSpace(protocol))
+			if err != nil {
+				continue
+			}
+			host, portStr, err := net.SplitHostPort(strings.Trim(strings.TrimSpace(authority), `"`))
+			if err != nil {
+				continue
+			}
+			port, err := strconv.Atoi(portStr)
+			if err != nil || port <= 0 || port > 65535 {
+				continue
+			}
+			maxAge := altSvcDefaultMaxAge
+			for _, param := range params[1:] {
+				name, v, _ := strings.Cut(strings.TrimSpace(param), "=")
+				if strings.EqualFold(name, "ma") {
+					if secs, err := strconv.ParseInt(strings.Trim(v, `"`), 10, 64); err == nil && secs >= 0 {
+						maxAge = time.Duration(secs) * time.Second
+					}
+				}
+			}
+			services = append(services, AltService{Protocol: protocol, Host: host, Port: port, Expires: now.Add(maxAge)})
+		}
+	}
+	return services, false
+}
+
+// splitAltSvc splits an Alt-Svc value at the commas outside quoted strings
+func splitAltSvc(value string) []string {
+	var parts []string
+	quoted := false
+	start := 0
+	for i := 0; i < len(value); i++ {
+		switch value[i] {
+		case '"':
+			quoted = !quoted
+		case ',':
+			if !quoted {
+				parts = append(parts, value[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, value[start:])
+}
+
+// altSvcOrigin returns the host:port origin key of an https URL
+func altSvcOrigin(rawURL string) (string, bool) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Scheme != "https" || u.Hostname() == "" {
+		return "", false
+	}
+	port := u.Port()
+	if port == "" {
+		port = "443"
+	}
+	return net.JoinHostPort(strings.ToLower(u.Hostname()), port), true
+}
+
+// altSvcCache holds the alternative services advertised per origin. The
+// zero value is ready to use.
+type altSvcCache struct {
+	mu       sync.Mutex
+	services map[string][]AltService
+}
+
+// update records the Alt-Svc headers of a response from origin. A new
+// advertisement replaces the origin's previous alternatives.
+func (c *altSvcCache) update(origin string, values []string, now time.Time) {
+	if len(values) == 0 {
+		return
+	}
+	services, clear := parseAltSvc(values, now)
+	if !clear && len(services) == 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if clear {
+		delete(c.services, origin)
+		return
+	}
+	if c.services == nil {
+		c.services = make(map[string][]AltService)
+	}
+	c.services[origin] = services[:min(len(services), altSvcMaxEntries)]
+}
+
+// h3 reports whether origin advertised an unexpired HTTP/3 alternative
+// the transport can use: same host and port, as QUIC connections are
+// dialed to the origin itself
+func (c *altSvcCache) h3(origin string, now time.Time) bool {
+	host, port, _ := net.SplitHostPort(origin)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, s := range c.services[origin] {
+		if s.Protocol == "h3" && (s.Host == "" || strings.EqualFold(s.Host, host)) && strconv.Itoa(s.Port) == port && now.Before(s.Expires) {
+			return true
+		}
+	}
+	return false
+}
+
+// snapshot returns the unexpired alternatives per origin
+func (c *altSvcCache) snapshot(now time.Time) map[string][]AltService {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	result := make(map[string][]AltService, len(c.services))
+	for origin, services := range c.services {
+		var live []AltService
+		for _, s := range services {
+			if now.Before(s.Expires) {
+				live = append(live, s)
+			}
+		}
+		if len(live) > 0 {
+			result[origin] = live
+		}
+	}
+	return result
+}
+
+// AltSvc returns the alternative services origins (host:port) advertised
+// with Alt-Svc that have not expired, e.g. to save them with the session
+func (t *Transport) AltSvc() map[string][]AltService {
+	return t.altSvc.snapshot(time.Now())
+}
+
+// SetAltSvc records alternative services learned elsewhere (e.g., a saved
+// session). Origins the transport has already heard from are kept.
+func (t *Transport) SetAltSvc(services map[string][]AltService) {
+	t.altSvc.mu.Lock()
+	defer t.altSvc.mu.Unlock()
+	if t.altSvc.services == nil {
+		t.altSvc.services = make(map[string][]AltService)
+	}
+	for origin, s := range services {
+		if _, known := t.altSvc.services[origin]; !known && len(s) > 0 {
+			t.altSvc.services[origin] = append([]AltService(nil), s[:min(len(s), altSvcMaxEntries)]...)
+		}
+	}
+}
+
+// recordAltSvc caches the Alt-Svc advertisement of a response to rawURL
+func (t *Transport) recordAltSvc(rawURL string, headers map[string][]string) {
+	if origin, ok := altSvcOrigin(rawURL); ok {
+		t.altSvc.update(origin, headers["alt-svc"], time.Now())
+	}
+}
+
+// altSvcH3 reports whether the origin of rawURL advertised HTTP/3 and the
+// preset speaks it
+func (t *Transport) altSvcH3(rawURL string) bool {
+	origin, ok := altSvcOrigin(rawURL)
+	return ok && t.preset.SupportHTTP3 && t.altSvc.h3(origin, time.Now())
+}
@@ -0,0 +1,103 @@
+package transport
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestParseAltSvc(t *testing.T) {
+	now := time.Now()
+	services, clear := parseAltSvc([]string{`h3=":443"; ma=3600, h3-29="alt.example:8443", h2="a,b:1"`, `bogus, h3=":x"`}, now)
+	if clear || len(services) != 3 {
+		t.Fatalf("services = %+v, clear = %v", services, clear)
+	}
+	if s := services[0]; s.Protocol != "h3" || s.Host != "" || s.Port != 443 || !s.Expires.Equal(now.Add(time.Hour)) {
+		t.Errorf("first alternative = %+v", s)
+	}
+	if s := services[1]; s.Protocol != "h3-29" || s.Host != "alt.example" || s.Port != 8443 || !s.Expires.Equal(now.Add(altSvcDefaultMaxAge)) {
+		t.Errorf("second alternative = %+v", s)
+	}
+	if s := services[2]; s.Host != "a,b" || s.Port != 1 {
+		t.Errorf("quoted comma split the alternative: %+v", s)
+	}
+
+	if _, clear := parseAltSvc([]string{"clear"}, now); !clear {
+		t.Error(`"clear" not reported`)
+	}
+}
+
+func TestAltSvcCache(t *testing.T) {
+	now := time.Now()
+	var c altSvcCache
+	c.update("example.com:443", []string{`h3=":443"; ma=60`}, now)
+	c.update("other.example:443", []string{`h3=":8443"`, `h3="elsewhere.example:443"`}, now)
+
+	tests := []struct {
+		origin string
+		at     time.Time
+		want   bool
+	}{
+		{"example.com:443", now, true},
+		{"example.com:443", now.Add(time.Minute), false}, // Expired
+		{"other.example:443", now, false},                // Other port or host
+		{"unknown.example:443", now, false},
+	}
+	for _, tt := range tests {
+		if got := c.h3(tt.origin, tt.at); got != tt.want {
+			t.Errorf("h3(%s, +%v) = %v, want %v", tt.origin, tt.at.Sub(now), got, tt.want)
+		}
+	}
+
+	c.update("example.com:443", []string{"clear"}, now)
+	if snap := c.snapshot(now); len(snap) != 1 {
+		t.Errorf("snapshot after clear = %v", snap)
+	}
+}
+
+func TestDoAutoWaitsForAltSvc(t *testing.T) {
+	altSvc := ""
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if altSvc != "" {
+			w.Header().Set("Alt-Svc", altSvc)
+		}
+	}))
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	defer srv.Close()
+
+	tr := NewTransport("chrome-latest")
+	defer tr.Close()
+	tr.SetInsecureSkipVerify(true)
+	do := func() {
+		resp, err := tr.Do(context.Background(), &Request{Method: "GET", URL: srv.URL})
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Close()
+	}
+
+	// Without an advertisement HTTP/2 is used and not pinned
+	do()
+	if hints := tr.ProtocolHints(); len(hints) != 0 {
+		t.Errorf("protocol hints = %v, want none before Alt-Svc", hints)
+	}
+	if tr.altSvcH3(srv.URL) {
+		t.Error("HTTP/3 assumed without Alt-Svc")
+	}
+
+	altSvc = `h3=":` + srv.URL[len("https://127.0.0.1:"):] + `"; ma=60`
+	do()
+	if !tr.altSvcH3(srv.URL) {
+		t.Errorf("Alt-Svc %q not cached: %v", altSvc, tr.AltSvc())
+	}
+
+	restored := NewTransport("chrome-latest")
+	defer restored.Close()
+	restored.SetAltSvc(tr.AltSvc())
+	if !restored.altSvcH3(srv.URL) {
+		t.Error("SetAltSvc did not restore the advertisement")
+	}
+}
@@ -0,0 +1,151 @@
+package transport
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"runtime/pprof"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+	shttp "github.com/sardanioss/http"
+	"github.com/sardanioss/httpcloak/fingerprint"
+	"github.com/sardanioss/quic-go/http3"
+	utls "github.com/sardanioss/utls"
+)
+
+var benchBody = bytes.Repeat([]byte(`{"id":1,"name":"httpcloak","tags":["a","b","c"]},`), 400)
+
+func benchmarkDo(b *testing.B, tr *Transport, url string) {
+	b.Helper()
+	ctx := context.Background()
+	req := &Request{Method: "GET", URL: url}
+
+	// Warm the connection so the loop measures request cost, not the handshake
+	resp, err := tr.Do(ctx, req)
+	if err != nil {
+		b.Fatal(err)
+	}
+	resp.Close()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		resp, err := tr.Do(ctx, req)
+		if err != nil {
+			b.Fatal(err)
+		}
+		resp.Close()
+	}
+}
+
+func BenchmarkDoH1(b *testing.B) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(benchBody)
+	}))
+	defer srv.Close()
+
+	tr := NewTransport("chrome-latest")
+	defer tr.Close()
+	tr.SetProtocol(ProtocolHTTP1)
+	benchmarkDo(b, tr, srv.URL)
+}
+
+func BenchmarkDoH2(b *testing.B) {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(benchBody)
+	}))
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	defer srv.Close()
+
+	tr := NewTransport("chrome-latest")
+	defer tr.Close()
+	tr.SetProtocol(ProtocolHTTP2)
+	tr.SetInsecureSkipVerify(true)
+	benchmarkDo(b, tr, srv.URL)
+}
+
+func BenchmarkDoH3(b *testing.B) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		b.Skipf("udp unavailable: %v", err)
+	}
+	srv := &http3.Server{
+		TLSConfig: http3.ConfigureTLSConfig(&utls.Config{Certificates: []utls.Certificate{selfSignedCert(b)}}),
+		Handler: shttp.HandlerFunc(func(w shttp.ResponseWriter, r *shttp.Request) {
+			w.Write(benchBody)
+		}),
+	}
+	go srv.Serve(pc)
+	defer srv.Close()
+
+	tr := NewTransport("chrome-latest")
+	defer tr.Close()
+	tr.SetProtocol(ProtocolHTTP3)
+	tr.SetInsecureSkipVerify(true)
+	benchmarkDo(b, tr, "https://"+pc.LocalAddr().String()+"/")
+}
+
+func BenchmarkDecompress(b *testing.B) {
+	var gz, br, zs bytes.Buffer
+	gw := gzip.NewWriter(&gz)
+	gw.Write(benchBody)
+	gw.Close()
+	bw := brotli.NewWriter(&br)
+	bw.Write(benchBody)
+	bw.Close()
+	zw, _ := zstd.NewWriter(&zs)
+	zw.Write(benchBody)
+	zw.Close()
+
+	for _, tc := range []struct {
+		encoding string
+		data     []byte
+	}{
+		{"gzip", gz.Bytes()},
+		{"br", br.Bytes()},
+		{"zstd", zs.Bytes()},
+	} {
+		b.Run(tc.encoding, func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetBytes(int64(len(benchBody)))
+			for i := 0; i < b.N; i++ {
+				if _, err := decompress(tc.data, tc.encoding); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkHeaderBuild(b *testing.B) {
+	preset := fingerprint.Get("chrome-latest")
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		req, _ := shttp.NewRequest("GET", "https://example.com/", nil)
+		applyPresetHeaders(req, preset, nil, nil, false, "h2")
+	}
+}
+
+func TestProfilerLabels(t *testing.T) {
+	fn := func(ctx context.Context, req *Request) (string, error) {
+		host, _ := pprof.Label(ctx, "httpcloak.host")
+		return host, nil
+	}
+	req := &Request{URL: "https://example.com/path"}
+
+	if host, _ := labeled(context.Background(), req, fn); host != "" {
+		t.Errorf("label set while disabled: %q", host)
+	}
+
+	SetProfilerLabels(true)
+	defer SetProfilerLabels(false)
+	if host, _ := labeled(context.Background(), req, fn); host != "example.com" {
+		t.Errorf("httpcloak.host = %q, want example.com", host)
+	}
+}
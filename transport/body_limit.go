@@ -0,0 +1,72 @@
+package transport
+
+import (
+	"errors"
+	"io"
+	"strings"
+
+	http "github.com/sardanioss/http"
+)
+
+// ErrBodyTooLarge is returned for a response body over Request.MaxBodySize
+var ErrBodyTooLarge = errors.New("response body exceeds the size limit")
+
+// readResponseBody reads and decodes the body of resp, returning it with the
+// size of the response. With req.MaxBodySize set the body is decoded as it
+// arrives and the read stops with ErrBodyTooLarge once it passes the limit,
+// leaving the rest undownloaded.
+func (t *Transport) readResponseBody(req *Request, resp *http.Response, host, port, protocol string) ([]byte, int64, error) {
+	body := watchStall(resp.Body, t.stallTimeout(), host, port, protocol)
+	contentEncoding := resp.Header.Get("Content-Encoding")
+	if req.MaxBodySize > 0 {
+		return readLimitedBody(resp, body, contentEncoding, req.MaxBodySize, host, port, protocol)
+	}
+
+	// Read response body with pre-allocation for known content length
+	data, releaseBody, err := readBodyOptimized(body, resp.ContentLength)
+	if err != nil {
+		return nil, 0, readBodyError(host, port, protocol, err)
+	}
+	bytesReceived := responseSize(resp, len(data))
+
+	// Decompress if needed
+	if contentEncoding != "" {
+		decompressed, err := decompress(data, contentEncoding)
+		releaseBody() // Decompressed buffer is not pooled
+		if err != nil {
+			return nil, 0, NewRequestError("decompress", host, port, protocol, err)
+		}
+		data = decompressed
+	}
+	return data, bytesReceived, nil
+}
+
+// readLimitedBody reads body through a streaming decoder, failing as soon as
+// the decoded body passes limit
+func readLimitedBody(resp *http.Response, body io.ReadCloser, encoding string, limit int64, host, port, protocol string) ([]byte, int64, error) {
+	tooLarge := func() ([]byte, int64, error) {
+		// Closing would drain the rest of an HTTP/1.1 body
+		if a, ok := resp.Body.(bodyAborter); ok {
+			a.abort()
+		}
+		return nil, 0, NewRequestError("read_body", host, port, protocol, ErrBodyTooLarge)
+	}
+	identity := encoding == "" || strings.EqualFold(encoding, "identity")
+	if identity && resp.ContentLength > limit {
+		return tooLarge()
+	}
+
+	wire := &countingBody{ReadCloser: body}
+	decoded, decompressor := setupStreamDecompressor(wire, encoding)
+	if decompressor != nil {
+		defer decompressor.Close()
+	}
+	data, err := io.ReadAll(io.LimitReader(decoded, limit+1))
+	if int64(len(data)) > limit {
+		return tooLarge()
+	}
+	if err != nil {
+		return nil, 0, readBodyError(host, port, protocol, err)
+	}
+	return data, responseSize(resp, int(wire.n.Load())), nil
+}
@@ -0,0 +1,40 @@
+package transport
+
+import (
+	"crypto/x509"
+
+	tls "github.com/sardanioss/utls"
+)
+
+// CertificatePinner checks the certificate chain a server presents, e.g.
+// against SPKI pins. *client.CertPinner implements it.
+type CertificatePinner interface {
+	Verify(host string, certs []*x509.Certificate) error
+}
+
+// applyCertPinner makes cfg abort handshakes with host when the pinner
+// rejects the server's chain. VerifyConnection runs on every handshake,
+// including resumed ones and with InsecureSkipVerify set. QUIC connections
+// are checked by checkQUICPins instead.
+func applyCertPinner(config *TransportConfig, cfg *tls.Config, host string) {
+	if config == nil || config.CertPinner == nil {
+		return
+	}
+	pinner := config.CertPinner
+	cfg.VerifyConnection = func(cs tls.ConnectionState) error {
+		return pinner.Verify(host, cs.PeerCertificates)
+	}
+}
+
+// checkQUICPins verifies the chain of a dialed QUIC connection with the
+// pinner. quic-go builds its own uTLS config and leaves VerifyConnection out,
+// so applyCertPinner doesn't reach QUIC handshakes.
+func checkQUICPins(config *TransportConfig, host string, cs tls.ConnectionState) error {
+	if config == nil || config.CertPinner == nil {
+		return nil
+	}
+	if cs.ServerName != "" {
+		host = cs.ServerName
+	}
+	return config.CertPinner.Verify(host, cs.PeerCertificates)
+}
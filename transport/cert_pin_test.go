@@ -0,0 +1,119 @@
+package transport
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	shttp "github.com/sardanioss/http"
+	"github.com/sardanioss/quic-go/http3"
+	utls "github.com/sardanioss/utls"
+)
+
+var errPinMismatch = errors.New("pin mismatch")
+
+// spkiPinner accepts chains containing a certificate with the given public key
+type spkiPinner struct {
+	spki  []byte
+	hosts []string
+}
+
+func (p *spkiPinner) Verify(host string, certs []*x509.Certificate) error {
+	p.hosts = append(p.hosts, host)
+	for _, cert := range certs {
+		if string(cert.RawSubjectPublicKeyInfo) == string(p.spki) {
+			return nil
+		}
+	}
+	return errPinMismatch
+}
+
+func TestCertPinner(t *testing.T) {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	defer srv.Close()
+
+	for _, protocol := range []Protocol{ProtocolHTTP1, ProtocolHTTP2} {
+		for _, match := range []bool{true, false} {
+			pinner := &spkiPinner{spki: []byte("other key")}
+			if match {
+				pinner.spki = srv.Certificate().RawSubjectPublicKeyInfo
+			}
+			tr := NewTransportWithConfig("chrome-latest", nil, &TransportConfig{CertPinner: pinner})
+			tr.SetProtocol(protocol)
+			tr.SetInsecureSkipVerify(true)
+
+			resp, err := tr.Do(context.Background(), &Request{Method: "GET", URL: srv.URL})
+			if match && err != nil {
+				t.Errorf("protocol %v: pinned key rejected: %v", protocol, err)
+			}
+			if !match && !errors.Is(err, errPinMismatch) {
+				t.Errorf("protocol %v: err = %v, want the pinner's error", protocol, err)
+			}
+			if err == nil {
+				resp.Close()
+			}
+			if len(pinner.hosts) == 0 || pinner.hosts[0] != "127.0.0.1" {
+				t.Errorf("protocol %v: pinner called for %v, want 127.0.0.1", protocol, pinner.hosts)
+			}
+			tr.Close()
+		}
+	}
+}
+
+// TestCertPinnerHTTP3AfterReconfigure checks that pins still hold over QUIC
+// once SetPreset and SetProxy have rebuilt the HTTP/3 transport
+func TestCertPinnerHTTP3AfterReconfigure(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("udp unavailable: %v", err)
+	}
+	cert := selfSignedCert(t)
+	srv := &http3.Server{
+		TLSConfig: http3.ConfigureTLSConfig(&utls.Config{Certificates: []utls.Certificate{cert}}),
+		Handler:   shttp.HandlerFunc(func(w shttp.ResponseWriter, r *shttp.Request) {}),
+	}
+	go srv.Serve(pc)
+	defer srv.Close()
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	url := "https://" + pc.LocalAddr().String()
+
+	for _, match := range []bool{false, true} {
+		pinner := &spkiPinner{spki: []byte("other key")}
+		if match {
+			pinner.spki = leaf.RawSubjectPublicKeyInfo
+		}
+		tr := NewTransportWithConfig("chrome-latest", nil, &TransportConfig{CertPinner: pinner})
+		tr.SetPreset("chrome-latest")
+		tr.SetProxy(nil)
+		tr.SetProtocol(ProtocolHTTP3)
+		tr.SetInsecureSkipVerify(true)
+
+		if match {
+			// A handshake only: the pinner runs on it, as for a request
+			if err := tr.Preconnect(context.Background(), url, PreconnectOptions{}); err != nil {
+				t.Errorf("pinned key rejected over h3: %v", err)
+			}
+		} else {
+			resp, err := tr.Do(context.Background(), &Request{Method: "GET", URL: url})
+			if !errors.Is(err, errPinMismatch) {
+				t.Errorf("h3 after SetPreset and SetProxy: err = %v, want the pinner's error", err)
+			}
+			if err == nil {
+				resp.Close()
+			}
+		}
+		if len(pinner.hosts) == 0 {
+			t.Errorf("match %v: pinner not called over h3", match)
+		}
+		tr.Close()
+	}
+}
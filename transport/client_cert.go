@@ -0,0 +1,56 @@
+package transport
+
+import (
+	"strings"
+
+	tls "github.com/sardanioss/utls"
+)
+
+// ClientCertificates selects the certificate presented to servers that ask
+// for one (mutual TLS). It applies to HTTP/1.1, HTTP/2 and HTTP/3. Servers
+// that don't send a CertificateRequest never see the certificate.
+type ClientCertificates struct {
+	// Default is presented to hosts without an entry in Hosts (nil = none)
+	Default *tls.Certificate
+
+	// Hosts maps hostnames to certificates. "*.example.com" matches
+	// example.com and its subdomains; exact names win over wildcards and
+	// longer wildcards over shorter ones.
+	Hosts map[string]tls.Certificate
+}
+
+// forHost returns the certificate for host, or nil
+func (c *ClientCertificates) forHost(host string) *tls.Certificate {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	var best *tls.Certificate
+	bestLen := -1
+	for pattern, cert := range c.Hosts {
+		pattern = strings.TrimSuffix(strings.ToLower(pattern), ".")
+		if pattern == host {
+			return &cert
+		}
+		if suffix, ok := strings.CutPrefix(pattern, "*."); ok && len(suffix) > bestLen &&
+			(host == suffix || strings.HasSuffix(host, "."+suffix)) {
+			best, bestLen = &cert, len(suffix)
+		}
+	}
+	if best != nil {
+		return best
+	}
+	return c.Default
+}
+
+// applyClientCert makes cfg present host's client certificate when the
+// server requests one
+func applyClientCert(config *TransportConfig, cfg *tls.Config, host string) {
+	if config == nil || config.ClientCertificates == nil {
+		return
+	}
+	cert := config.ClientCertificates.forHost(host)
+	if cert == nil {
+		return
+	}
+	cfg.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+		return cert, nil
+	}
+}
@@ -0,0 +1,110 @@
+package transport
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	stdtls "crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	tls "github.com/sardanioss/utls"
+)
+
+func TestClientCertificatesForHost(t *testing.T) {
+	cert := func(name string) tls.Certificate {
+		return tls.Certificate{Certificate: [][]byte{[]byte(name)}}
+	}
+	def := cert("default")
+	c := &ClientCertificates{
+		Default: &def,
+		Hosts: map[string]tls.Certificate{
+			"api.example.com":    cert("api"),
+			"*.example.com":      cert("wild"),
+			"*.corp.example.com": cert("deep"),
+		},
+	}
+
+	for host, want := range map[string]string{
+		"API.example.com":     "api",
+		"www.example.com":     "wild",
+		"example.com":         "wild",
+		"db.corp.example.com": "deep",
+		"other.org":           "default",
+	} {
+		got := c.forHost(host)
+		if got == nil || string(got.Certificate[0]) != want {
+			t.Errorf("forHost(%q) = %v, want %s", host, got, want)
+		}
+	}
+
+	if (&ClientCertificates{}).forHost("example.com") != nil {
+		t.Error("empty ClientCertificates should select no certificate")
+	}
+}
+
+func TestClientCertificateHandshake(t *testing.T) {
+	var gotCerts int
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotCerts = len(r.TLS.PeerCertificates)
+	}))
+	srv.TLS = &stdtls.Config{ClientAuth: stdtls.RequireAnyClientCert}
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	defer srv.Close()
+
+	cert := selfSignedCert(t)
+	tr := NewTransportWithConfig("chrome-latest", nil, &TransportConfig{
+		ClientCertificates: &ClientCertificates{Default: &cert},
+	})
+	defer tr.Close()
+	tr.SetInsecureSkipVerify(true)
+	tr.SetProtocol(ProtocolHTTP2)
+
+	resp, err := tr.Do(context.Background(), &Request{Method: "GET", URL: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Close()
+	if gotCerts != 1 {
+		t.Errorf("server saw %d client certificates, want 1", gotCerts)
+	}
+}
+
+func selfSignedCert(t testing.TB) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "client"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := tls.X509KeyPair(
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
@@ -0,0 +1,21 @@
+package transport
+
+import "time"
+
+// Reanchor puts a time read back from serialized state on the monotonic
+// clock. Such times only carry a wall-clock reading, so measuring against
+// them with time.Since follows every NTP step or suspend/resume jump of the
+// wall clock for as long as they live; reanchoring converts the age once,
+// when loading, and later checks measure elapsed time only. A time in the
+// future, left by a clock set back since it was saved, is taken as now.
+func Reanchor(t time.Time) time.Time {
+	if t.IsZero() {
+		return t
+	}
+	now := time.Now()
+	age := now.Sub(t)
+	if age < 0 {
+		age = 0
+	}
+	return now.Add(-age)
+}
@@ -0,0 +1,26 @@
+package transport
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReanchor(t *testing.T) {
+	// Round(0) strips the monotonic reading, as a JSON round trip does
+	saved := time.Now().Add(-time.Hour).Round(0)
+	got := Reanchor(saved)
+	if !strings.Contains(got.String(), "m=") {
+		t.Errorf("Reanchor(%v) has no monotonic reading", saved)
+	}
+	if age := time.Since(got); age < time.Hour || age > time.Hour+time.Second {
+		t.Errorf("age = %v, want an hour", age)
+	}
+
+	if age := time.Since(Reanchor(time.Now().Add(time.Hour).Round(0))); age < 0 || age > time.Second {
+		t.Errorf("future time: age = %v, want 0", age)
+	}
+	if !Reanchor(time.Time{}).IsZero() {
+		t.Error("zero time not kept zero")
+	}
+}
@@ -0,0 +1,352 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/sardanioss/httpcloak/fingerprint"
+	"github.com/sardanioss/net/http2"
+	"github.com/sardanioss/quic-go/http3"
+)
+
+// ErrProtocolViolation matches every *ProtocolViolationError
+var ErrProtocolViolation = errors.New("protocol violation")
+
+// ViolationKind classifies a ProtocolViolation
+type ViolationKind string
+
+const (
+	// ViolationMessageFraming is a body whose length can't be trusted:
+	// malformed chunked encoding, conflicting Content-Length values,
+	// Content-Length together with Transfer-Encoding, or a body shorter
+	// than its Content-Length (HTTP/1)
+	ViolationMessageFraming ViolationKind = "message-framing"
+	// ViolationHeaderSyntax is a malformed status or header line: obsolete
+	// line folding, bare LF line endings, whitespace before the colon or
+	// invalid characters in a field name (HTTP/1)
+	ViolationHeaderSyntax ViolationKind = "header-syntax"
+	// ViolationHeaderSize is a header section larger than the limit the
+	// client advertised (SETTINGS_MAX_HEADER_LIST_SIZE on HTTP/2,
+	// SETTINGS_MAX_FIELD_SECTION_SIZE on HTTP/3) or than Chrome accepts on
+	// HTTP/1 (256 KiB)
+	ViolationHeaderSize ViolationKind = "header-size"
+	// ViolationDuplicateHeader is a field that may appear once (e.g.
+	// Content-Type, Location) repeated with different values
+	ViolationDuplicateHeader ViolationKind = "duplicate-header"
+	// ViolationConnectionHeader is a connection-specific field (Connection,
+	// Keep-Alive, Transfer-Encoding, ...) in an HTTP/2 or HTTP/3 response
+	ViolationConnectionHeader ViolationKind = "connection-header"
+	// ViolationFrame is an HTTP/2 or HTTP/3 frame or stream the client
+	// rejected as a protocol error
+	ViolationFrame ViolationKind = "frame"
+)
+
+// ProtocolViolation is one deviation from the HTTP specs by a server,
+// reported in strict conformance mode (TransportConfig.StrictConformance)
+type ProtocolViolation struct {
+	Protocol string // "h1", "h2" or "h3"
+	Kind     ViolationKind
+	Detail   string
+}
+
+func (v ProtocolViolation) String() string {
+	return fmt.Sprintf("%s %s: %s", v.Protocol, v.Kind, v.Detail)
+}
+
+// ProtocolViolationError is returned in strict conformance mode when a
+// violation leaves no usable response. It matches ErrProtocolViolation with
+// errors.Is and unwraps to the parser's error.
+type ProtocolViolationError struct {
+	Violation ProtocolViolation
+	Err       error
+}
+
+func (e *ProtocolViolationError) Error() string {
+	return e.Violation.String()
+}
+
+func (e *ProtocolViolationError) Unwrap() error {
+	return e.Err
+}
+
+func (e *ProtocolViolationError) Is(target error) bool {
+	return target == ErrProtocolViolation
+}
+
+// chromeMaxHeadersSize is the largest HTTP/1 response head Chrome accepts
+// (ERR_RESPONSE_HEADERS_TOO_BIG beyond it)
+const chromeMaxHeadersSize = 256 << 10
+
+// violationLog collects the violations of one request. Its presence in the
+// request context turns on the strict HTTP/1 parsing.
+type violationLog struct {
+	mu         sync.Mutex
+	violations []ProtocolViolation
+}
+
+type violationLogKey struct{}
+
+func withViolationLog(ctx context.Context) (context.Context, *violationLog) {
+	log := &violationLog{}
+	return context.WithValue(ctx, violationLogKey{}, log), log
+}
+
+func violationLogFrom(ctx context.Context) *violationLog {
+	log, _ := ctx.Value(violationLogKey{}).(*violationLog)
+	return log
+}
+
+func (l *violationLog) add(v ...ProtocolViolation) {
+	l.mu.Lock()
+	l.violations = append(l.violations, v...)
+	l.mu.Unlock()
+}
+
+func (l *violationLog) list() []ProtocolViolation {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]ProtocolViolation(nil), l.violations...)
+}
+
+// strictConformance reports whether the transport runs in strict mode
+func (t *Transport) strictConformance() bool {
+	return t.config != nil && t.config.StrictConformance
+}
+
+// headerListLimit is the header section size the client accepts on proto
+func (t *Transport) headerListLimit(proto string) int {
+	switch proto {
+	case "h2":
+		for _, s := range t.preset.H2().Settings {
+			if s.ID == fingerprint.H2SettingMaxHeaderListSize && s.Value > 0 {
+				return int(s.Value)
+			}
+		}
+	case "h3":
+		if t.h3Transport != nil {
+			if size := t.h3Transport.h3Settings().MaxFieldSectionSize; size > 0 {
+				return int(size)
+			}
+		}
+	}
+	return chromeMaxHeadersSize
+}
+
+// singletonHeaders may only appear once in a response (RFC 9110)
+var singletonHeaders = []string{"content-length", "content-type", "content-encoding", "location", "etag", "last-modified", "date", "age", "expires", "retry-after", "content-location"}
+
+// connectionHeaders are forbidden on HTTP/2 and HTTP/3 (RFC 9113 8.2.2,
+// RFC 9114 4.2)
+var connectionHeaders = []string{"connection", "keep-alive", "proxy-connection", "transfer-encoding", "upgrade"}
+
+// headerViolations checks response headers (lowercase keys) for violations
+// shared by all protocols. HTTP/1 head size and syntax are checked on the
+// raw bytes instead (h1HeadViolations).
+func headerViolations(proto string, headers map[string][]string, limit int) []ProtocolViolation {
+	var violations []ProtocolViolation
+	for _, name := range singletonHeaders {
+		values := headers[name]
+		for _, v := range values[min(1, len(values)):] {
+			if v != values[0] {
+				violations = append(violations, ProtocolViolation{proto, ViolationDuplicateHeader, fmt.Sprintf("%s sent %d times with different values", name, len(values))})
+				break
+			}
+		}
+	}
+	if proto == "h1" {
+		return violations
+	}
+	for _, name := range connectionHeaders {
+		if _, ok := headers[name]; ok {
+			violations = append(violations, ProtocolViolation{proto, ViolationConnectionHeader, name + " is connection-specific"})
+		}
+	}
+	// Field section size as defined in RFC 9113 6.5.2, :status included
+	size := len(":status") + 3 + 32
+	for name, values := range headers {
+		for _, v := range values {
+			size += len(name) + len(v) + 32
+		}
+	}
+	if size > limit {
+		violations = append(violations, ProtocolViolation{proto, ViolationHeaderSize, fmt.Sprintf("header list is %d bytes, advertised limit %d", size, limit)})
+	}
+	return violations
+}
+
+// h1HeadViolations checks a raw HTTP/1 response head. net/http tolerates
+// most of these, and drops Content-Length when Transfer-Encoding is set, so
+// they are only visible before parsing.
+func h1HeadViolations(head []byte) []ProtocolViolation {
+	var violations []ProtocolViolation
+	add := func(kind ViolationKind, format string, args ...any) {
+		violations = append(violations, ProtocolViolation{"h1", kind, fmt.Sprintf(format, args...)})
+	}
+	if len(head) > chromeMaxHeadersSize {
+		add(ViolationHeaderSize, "response head is %d bytes, Chrome accepts %d", len(head), chromeMaxHeadersSize)
+	}
+
+	lines := strings.SplitAfter(string(head), "\n")
+	bareLF := false
+	var contentLengths []string
+	transferEncoding := false
+	for i, line := range lines {
+		if line == "" {
+			continue
+		}
+		if !strings.HasSuffix(line, "\r\n") {
+			bareLF = true
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if i == 0 {
+			if !validStatusLine(line) {
+				add(ViolationHeaderSyntax, "malformed status line %q", line)
+			}
+			continue
+		}
+		if line == "" {
+			break
+		}
+		if line[0] == ' ' || line[0] == '\t' {
+			add(ViolationHeaderSyntax, "obsolete line folding: %q", line)
+			continue
+		}
+		name, value, ok := strings.Cut(line, ":")
+		switch {
+		case !ok:
+			add(ViolationHeaderSyntax, "header line without a colon: %q", line)
+			continue
+		case strings.TrimRight(name, " \t") != name:
+			add(ViolationHeaderSyntax, "whitespace before the colon in %q", name)
+			name = strings.TrimRight(name, " \t")
+		case !validFieldName(name):
+			add(ViolationHeaderSyntax, "invalid field name %q", name)
+		}
+		value = strings.TrimSpace(value)
+		switch strings.ToLower(name) {
+		case "content-length":
+			for _, v := range strings.Split(value, ",") {
+				contentLengths = append(contentLengths, strings.TrimSpace(v))
+			}
+		case "transfer-encoding":
+			transferEncoding = true
+		}
+	}
+	if bareLF {
+		add(ViolationHeaderSyntax, "lines end with a bare LF")
+	}
+	for _, v := range contentLengths {
+		if n, err := strconv.ParseUint(v, 10, 63); err != nil || strconv.FormatUint(n, 10) != v {
+			add(ViolationMessageFraming, "invalid Content-Length %q", v)
+		} else if v != contentLengths[0] {
+			add(ViolationMessageFraming, "conflicting Content-Length values %s", strings.Join(contentLengths, ", "))
+			break
+		}
+	}
+	if transferEncoding && len(contentLengths) > 0 {
+		add(ViolationMessageFraming, "Content-Length sent with Transfer-Encoding")
+	}
+	return violations
+}
+
+func validStatusLine(line string) bool {
+	proto, rest, ok := strings.Cut(line, " ")
+	if !ok || (proto != "HTTP/1.1" && proto != "HTTP/1.0") {
+		return false
+	}
+	code, _, _ := strings.Cut(rest, " ")
+	if len(code) != 3 {
+		return false
+	}
+	for _, c := range code {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// validFieldName reports whether name is an RFC 9110 token
+func validFieldName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, c := range []byte(name) {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case strings.IndexByte("!#$%&'*+-.^_`|~", c) >= 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// strictBody turns HTTP/1 body read errors caused by the server into
+// ProtocolViolationErrors
+type strictBody struct {
+	io.ReadCloser
+	chunked bool
+}
+
+func (b *strictBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err == nil || err == io.EOF {
+		return n, err
+	}
+	detail := ""
+	switch {
+	case b.chunked && (strings.Contains(err.Error(), "chunk") || errors.Is(err, io.ErrUnexpectedEOF)):
+		detail = "malformed chunked encoding: " + err.Error()
+	case !b.chunked && errors.Is(err, io.ErrUnexpectedEOF):
+		detail = "body shorter than Content-Length"
+	default:
+		return n, err
+	}
+	return n, &ProtocolViolationError{Violation: ProtocolViolation{"h1", ViolationMessageFraming, detail}, Err: err}
+}
+
+// h3ProtocolErrors are the HTTP/3 error codes the client raises on frames
+// and streams that break the protocol
+var h3ProtocolErrors = []http3.ErrCode{
+	http3.ErrCodeGeneralProtocolError,
+	http3.ErrCodeStreamCreationError,
+	http3.ErrCodeClosedCriticalStream,
+	http3.ErrCodeFrameUnexpected,
+	http3.ErrCodeFrameError,
+	http3.ErrCodeIDError,
+	http3.ErrCodeSettingsError,
+	http3.ErrCodeMissingSettings,
+	http3.ErrCodeMessageError,
+	http3.ErrCodeQPACKDecompressionFailed,
+}
+
+// frameViolation returns err as a ProtocolViolationError when it is an
+// HTTP/2 or HTTP/3 protocol error the client raised on the server's frames
+func frameViolation(err error) error {
+	var pve *ProtocolViolationError
+	if err == nil || errors.As(err, &pve) || errors.Is(err, ErrHeaderLimit) {
+		return err
+	}
+	var v ProtocolViolation
+	var streamErr http2.StreamError
+	var connErr http2.ConnectionError
+	var h3Err *http3.Error
+	switch {
+	case errors.As(err, &streamErr) && streamErr.Code == http2.ErrCodeProtocol:
+		v = ProtocolViolation{"h2", ViolationFrame, streamErr.Error()}
+	case errors.As(err, &connErr) && (http2.ErrCode(connErr) == http2.ErrCodeProtocol || http2.ErrCode(connErr) == http2.ErrCodeFrameSize || http2.ErrCode(connErr) == http2.ErrCodeCompression):
+		v = ProtocolViolation{"h2", ViolationFrame, connErr.Error()}
+	case errors.As(err, &h3Err) && !h3Err.Remote && slices.Contains(h3ProtocolErrors, h3Err.ErrorCode):
+		v = ProtocolViolation{"h3", ViolationFrame, h3Err.Error()}
+	default:
+		return err
+	}
+	return &ProtocolViolationError{Violation: v, Err: err}
+}
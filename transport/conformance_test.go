@@ -0,0 +1,104 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func hasViolation(violations []ProtocolViolation, kind ViolationKind) bool {
+	for _, v := range violations {
+		if v.Kind == kind {
+			return true
+		}
+	}
+	return false
+}
+
+func TestH1HeadViolations(t *testing.T) {
+	clean := "HTTP/1.1 200 OK\r\nContent-Type: text/html\r\nContent-Length: 5\r\n\r\n"
+	if v := h1HeadViolations([]byte(clean)); len(v) != 0 {
+		t.Errorf("clean head reported %v", v)
+	}
+
+	tests := []struct {
+		head string
+		kind ViolationKind
+	}{
+		{"HTTP/1.1 200 OK\r\nX-Long: a\r\n continued\r\n\r\n", ViolationHeaderSyntax},
+		{"HTTP/1.1 200 OK\nServer: embedded\n\n", ViolationHeaderSyntax},
+		{"HTTP/1.1 200 OK\r\nServer : embedded\r\n\r\n", ViolationHeaderSyntax},
+		{"HTTP/1.1 OK\r\n\r\n", ViolationHeaderSyntax},
+		{"HTTP/1.1 200 OK\r\nContent-Length: 5\r\nTransfer-Encoding: chunked\r\n\r\n", ViolationMessageFraming},
+		{"HTTP/1.1 200 OK\r\nContent-Length: 5\r\nContent-Length: 6\r\n\r\n", ViolationMessageFraming},
+		{"HTTP/1.1 200 OK\r\nContent-Length: +5\r\n\r\n", ViolationMessageFraming},
+	}
+	for _, tt := range tests {
+		if v := h1HeadViolations([]byte(tt.head)); !hasViolation(v, tt.kind) {
+			t.Errorf("%q: got %v, want a %s violation", tt.head, v, tt.kind)
+		}
+	}
+}
+
+func TestHeaderViolations(t *testing.T) {
+	headers := map[string][]string{
+		"content-type": {"text/html", "application/json"},
+		"set-cookie":   {"a=1", "b=2"},
+		"connection":   {"keep-alive"},
+	}
+	v := headerViolations("h2", headers, 65536)
+	if !hasViolation(v, ViolationDuplicateHeader) || !hasViolation(v, ViolationConnectionHeader) {
+		t.Errorf("got %v, want duplicate-header and connection-header", v)
+	}
+	if hasViolation(v, ViolationHeaderSize) {
+		t.Errorf("small header list reported as too large: %v", v)
+	}
+	if v := headerViolations("h2", headers, 64); !hasViolation(v, ViolationHeaderSize) {
+		t.Errorf("got %v, want header-size over a 64 byte limit", v)
+	}
+	if v := headerViolations("h1", headers, 65536); hasViolation(v, ViolationConnectionHeader) {
+		t.Error("Connection is valid on HTTP/1")
+	}
+}
+
+func TestStrictConformance(t *testing.T) {
+	const tolerated = "HTTP/1.1 200 OK\r\nContent-Length: 99\r\nTransfer-Encoding: chunked\r\nX-Folded: a\r\n b\r\n\r\n5\r\nhello\r\n0\r\n\r\n"
+	seen := make(chan *http.Request, 8)
+	url := rawH1Server(t, tolerated, seen)
+
+	do := func(strict bool, url string) (*Response, error) {
+		tr := NewTransportWithConfig("chrome-latest", nil, &TransportConfig{StrictConformance: strict})
+		t.Cleanup(func() { tr.Close() })
+		return tr.Do(context.Background(), &Request{Method: "GET", URL: url})
+	}
+
+	resp, err := do(false, url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-seen
+	if len(resp.Violations) != 0 {
+		t.Errorf("violations reported without strict mode: %v", resp.Violations)
+	}
+
+	resp, err = do(true, url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-seen
+	if body, _ := resp.Bytes(); string(body) != "hello" {
+		t.Errorf("body = %q", body)
+	}
+	if !hasViolation(resp.Violations, ViolationMessageFraming) || !hasViolation(resp.Violations, ViolationHeaderSyntax) {
+		t.Errorf("violations = %v, want message-framing and header-syntax", resp.Violations)
+	}
+
+	badChunks := rawH1Server(t, "HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\nzz\r\nhello\r\n0\r\n\r\n", seen)
+	_, err = do(true, badChunks)
+	<-seen
+	var pve *ProtocolViolationError
+	if !errors.As(err, &pve) || pve.Violation.Kind != ViolationMessageFraming || !errors.Is(err, ErrProtocolViolation) {
+		t.Errorf("bad chunk framing: err = %v, want a message-framing *ProtocolViolationError", err)
+	}
+}
@@ -0,0 +1,122 @@
+package transport
+
+import (
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	http "github.com/sardanioss/http"
+)
+
+// HostStats is the traffic exchanged with one host. Bytes are HTTP message
+// bytes: the request/status line, headers as name and value text, and bodies
+// as transferred, before decompression. HTTP/2 and HTTP/3 header compression,
+// framing, TLS and TCP/UDP overhead are not included, so proxy-metered totals
+// run somewhat higher; the ratio between hosts and jobs is what's accurate.
+type HostStats struct {
+	Requests      int64
+	BytesSent     int64
+	BytesReceived int64
+}
+
+// hostStatsTable accumulates HostStats per hostname
+type hostStatsTable struct {
+	mu    sync.Mutex
+	hosts map[string]*HostStats
+}
+
+// record adds a completed request to the host's stats
+func (h *hostStatsTable) record(host string, sent, received int64) {
+	host = strings.ToLower(host)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.hosts == nil {
+		h.hosts = make(map[string]*HostStats)
+	}
+	stats, ok := h.hosts[host]
+	if !ok {
+		stats = &HostStats{}
+		h.hosts[host] = stats
+	}
+	stats.Requests++
+	stats.BytesSent += sent
+	stats.BytesReceived += received
+}
+
+// HostStats returns a copy of the traffic per hostname since the transport
+// was created or ResetHostStats was called. Only completed, non-streaming
+// requests are counted.
+func (t *Transport) HostStats() map[string]HostStats {
+	t.hostStats.mu.Lock()
+	defer t.hostStats.mu.Unlock()
+	result := make(map[string]HostStats, len(t.hostStats.hosts))
+	for host, stats := range t.hostStats.hosts {
+		result[host] = *stats
+	}
+	return result
+}
+
+// ResetHostStats clears the per-host traffic counters
+func (t *Transport) ResetHostStats() {
+	t.hostStats.mu.Lock()
+	defer t.hostStats.mu.Unlock()
+	t.hostStats.hosts = nil
+}
+
+// countingBody counts the request body bytes the transport actually reads
+type countingBody struct {
+	io.ReadCloser
+	n atomic.Int64
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.n.Add(int64(n))
+	return n, err
+}
+
+// countRequestBody wraps the request body and returns a function reporting
+// the size of the request once it has been sent
+func countRequestBody(req *http.Request) func() int64 {
+	var body *countingBody
+	if req.Body != nil && req.Body != http.NoBody {
+		body = &countingBody{ReadCloser: req.Body}
+		req.Body = body
+	}
+	return func() int64 {
+		n := requestHeaderSize(req)
+		if body != nil {
+			n += body.n.Load()
+		}
+		return n
+	}
+}
+
+// requestHeaderSize is the size of the request line and headers in HTTP/1.1 form
+func requestHeaderSize(req *http.Request) int64 {
+	// "GET /path HTTP/1.1\r\n" and "Host: example.com\r\n"
+	n := len(req.Method) + 1 + len(req.URL.RequestURI()) + len(" HTTP/1.1\r\n")
+	n += len("Host: \r\n") + len(req.URL.Host)
+	return int64(n) + headerSize(req.Header) + 2
+}
+
+// responseSize is the size of a response with a body of bodyLen raw bytes
+func responseSize(resp *http.Response, bodyLen int) int64 {
+	// "HTTP/1.1 200 OK\r\n"
+	n := len(resp.Proto) + 1 + len(resp.Status) + 2
+	return int64(n) + headerSize(resp.Header) + 2 + int64(bodyLen)
+}
+
+func headerSize(h http.Header) int64 {
+	var n int64
+	for name, values := range h {
+		if name == http.HeaderOrderKey || name == http.PHeaderOrderKey {
+			continue
+		}
+		for _, v := range values {
+			n += int64(len(name) + len(": ") + len(v) + len("\r\n"))
+		}
+	}
+	return n
+}
@@ -0,0 +1,53 @@
+package transport
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestRequestCost(t *testing.T) {
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	zw.Write(bytes.Repeat([]byte("a"), 10000))
+	zw.Close()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Write(gz.Bytes())
+	}))
+	defer srv.Close()
+
+	tr := NewTransport("chrome-latest")
+	defer tr.Close()
+	tr.SetProtocol(ProtocolHTTP1)
+
+	body := bytes.Repeat([]byte("b"), 500)
+	resp, err := tr.Do(context.Background(), &Request{Method: "POST", URL: srv.URL, BodyReader: bytes.NewReader(body)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Close()
+
+	if resp.BytesSent <= int64(len(body)) {
+		t.Errorf("BytesSent = %d, want body plus headers (> %d)", resp.BytesSent, len(body))
+	}
+	// Counted before decompression: well under the 10000 decoded bytes
+	if resp.BytesReceived <= int64(gz.Len()) || resp.BytesReceived >= 10000 {
+		t.Errorf("BytesReceived = %d, want compressed body plus headers (%d + headers)", resp.BytesReceived, gz.Len())
+	}
+
+	u, _ := url.Parse(srv.URL)
+	stats := tr.HostStats()[u.Hostname()]
+	if stats.Requests != 1 || stats.BytesSent != resp.BytesSent || stats.BytesReceived != resp.BytesReceived {
+		t.Errorf("HostStats = %+v, want the request's counts", stats)
+	}
+	tr.ResetHostStats()
+	if len(tr.HostStats()) != 0 {
+		t.Error("ResetHostStats left counters behind")
+	}
+}
@@ -0,0 +1,78 @@
+package transport
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"sync"
+)
+
+// DecoderFunc wraps a compressed response body and returns a reader that yields
+// the decoded bytes. Closing the returned reader must release any decoder state;
+// the underlying body is closed separately by the response.
+type DecoderFunc func(io.Reader) io.ReadCloser
+
+// Registry of custom content decoders keyed by lowercase Content-Encoding token
+var (
+	customDecoders   = make(map[string]DecoderFunc)
+	customDecodersMu sync.RWMutex
+)
+
+// RegisterDecoder registers a content decoder for the given Content-Encoding name.
+// Registered decoders are consulted before the built-in ones (gzip, br, zstd, deflate),
+// so they can be used both to add new encodings and to replace a built-in for
+// experiments. Passing a nil decoder removes the registration.
+//
+// Example:
+//
+//	transport.RegisterDecoder("xz", func(r io.Reader) io.ReadCloser {
+//	    xr, _ := xz.NewReader(r)
+//	    return io.NopCloser(xr)
+//	})
+func RegisterDecoder(name string, decoder DecoderFunc) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" {
+		return
+	}
+
+	customDecodersMu.Lock()
+	defer customDecodersMu.Unlock()
+
+	if decoder == nil {
+		delete(customDecoders, name)
+		return
+	}
+	customDecoders[name] = decoder
+}
+
+// GetDecoder returns the custom decoder registered for the given Content-Encoding name.
+func GetDecoder(name string) (DecoderFunc, bool) {
+	customDecodersMu.RLock()
+	defer customDecodersMu.RUnlock()
+	decoder, ok := customDecoders[strings.ToLower(strings.TrimSpace(name))]
+	return decoder, ok
+}
+
+// RegisteredDecoders returns the names of all custom decoders.
+func RegisteredDecoders() []string {
+	customDecodersMu.RLock()
+	defer customDecodersMu.RUnlock()
+	names := make([]string, 0, len(customDecoders))
+	for name := range customDecoders {
+		names = append(names, name)
+	}
+	return names
+}
+
+// decodeWithRegistered decodes a buffered body using a custom decoder if one is registered.
+// Returns handled=false when no custom decoder exists for the encoding.
+func decodeWithRegistered(data []byte, encoding string) (result []byte, handled bool, err error) {
+	decoder, ok := GetDecoder(encoding)
+	if !ok {
+		return nil, false, nil
+	}
+	reader := decoder(bytes.NewReader(data))
+	defer reader.Close()
+	result, err = io.ReadAll(reader)
+	return result, true, err
+}
@@ -0,0 +1,83 @@
+package transport
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"testing"
+
+	shttp "github.com/sardanioss/http"
+)
+
+func TestSendEarly(t *testing.T) {
+	tr := &HTTP3Transport{}
+	get, _ := shttp.NewRequest("GET", "https://example.com/", nil)
+	post, _ := shttp.NewRequest("POST", "https://example.com/", nil)
+
+	if !tr.sendEarly(get, "example.com") {
+		t.Error("GET without a body should go out in 0-RTT")
+	}
+	if tr.sendEarly(post, "example.com") {
+		t.Error("POST must not be sent in 0-RTT")
+	}
+
+	tr.earlyDataRejected.Store("example.com", true)
+	if tr.sendEarly(get, "example.com") {
+		t.Error("host that rejected 0-RTT still gets early requests")
+	}
+	if !tr.sendEarly(get, "other.example") {
+		t.Error("rejection leaked to another host")
+	}
+
+	tr.config = &TransportConfig{QUIC: &QUICOptions{DisableEarlyData: true}}
+	if tr.sendEarly(get, "other.example") {
+		t.Error("DisableEarlyData is ignored")
+	}
+}
+
+// TestTCPResumptionWithoutEarlyData checks that a resumed TLS session over
+// TCP offers the ticket but not early data
+func TestTCPResumptionWithoutEarlyData(t *testing.T) {
+	var mu sync.Mutex
+	var hellos [][]uint16
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	srv.EnableHTTP2 = true
+	srv.TLS = &tls.Config{
+		GetConfigForClient: func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+			mu.Lock()
+			hellos = append(hellos, hello.Extensions)
+			mu.Unlock()
+			return nil, nil
+		},
+	}
+	srv.StartTLS()
+	defer srv.Close()
+
+	tr := NewTransport("chrome-latest")
+	defer tr.Close()
+	tr.SetInsecureSkipVerify(true)
+	tr.SetProtocol(ProtocolHTTP2)
+	for i := 0; i < 2; i++ {
+		resp, err := tr.Do(context.Background(), &Request{Method: "GET", URL: srv.URL})
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Close()
+		tr.Refresh()
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(hellos) != 2 {
+		t.Fatalf("server saw %d handshakes, want 2", len(hellos))
+	}
+	if !slices.Contains(hellos[1], 41) {
+		t.Fatal("second handshake did not offer the session ticket")
+	}
+	if slices.Contains(hellos[1], 42) {
+		t.Error("resumed TCP handshake offered early data")
+	}
+}
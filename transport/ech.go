@@ -0,0 +1,164 @@
+package transport
+
+import (
+	"context"
+	"errors"
+
+	"github.com/sardanioss/httpcloak/dns"
+	utls "github.com/sardanioss/utls"
+)
+
+// ECH works like Chrome's fallback state machine, per host:
+//
+//   - no config known (no HTTPS record, lookup disabled or ECH disabled for
+//     the host): the preset's GREASE ECH extension is sent
+//   - config known: real ECH is offered with it
+//   - accepted: the config is kept in the per-host cache (and SessionState)
+//   - rejected with retry_configs: they replace the config and the
+//     connection is retried once
+//   - rejected without retry_configs (server disabled ECH): the host falls
+//     back to GREASE ECH for the rest of the session and is retried once
+
+// specHasECH reports whether a ClientHelloSpec carries an ECH extension (real
+// or GREASE), i.e. the browser it imitates would use ECH when configs exist
+func specHasECH(spec *utls.ClientHelloSpec) bool {
+	if spec == nil {
+		return false
+	}
+	for _, ext := range spec.Extensions {
+		if _, ok := ext.(utls.EncryptedClientHelloExtension); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// echRejection reports whether a handshake error is the server rejecting our
+// ECH config, along with the retry_configs it sent (empty if none)
+func echRejection(err error) (retryConfigs []byte, rejected bool) {
+	var echErr *utls.ECHRejectionError
+	if errors.As(err, &echErr) {
+		return echErr.RetryConfigList, true
+	}
+	return nil, false
+}
+
+// echDisabledForHost reports whether ECH is turned off for host in the config
+func (c *TransportConfig) echDisabledForHost(host string) bool {
+	return c != nil && c.DisableECHHosts[host]
+}
+
+// getECHConfig returns the ECH config list for host. A config set on the
+// transport always wins; otherwise the HTTPS record is fetched (over DoH)
+// only when the preset sends ECH. Nil means GREASE ECH (or no ECH at all).
+func (t *HTTP2Transport) getECHConfig(ctx context.Context, host string, spec *utls.ClientHelloSpec) []byte {
+	if t.config.echDisabledForHost(host) {
+		return nil
+	}
+	if t.hasFixedECHConfig() {
+		if len(t.config.ECHConfig) > 0 {
+			return t.config.ECHConfig
+		}
+		// ECH fetch failed - continue without ECH (SNI will be visible)
+		echConfig, _ := dns.FetchECHConfigs(ctx, t.config.ECHConfigDomain)
+		return echConfig
+	}
+	if t.disableECH || !specHasECH(spec) {
+		return nil
+	}
+
+	t.echConfigCacheMu.RLock()
+	cached, ok := t.echConfigCache[host]
+	rejected := t.echRejectedHosts[host]
+	t.echConfigCacheMu.RUnlock()
+	if rejected {
+		return nil
+	}
+	if ok {
+		return cached
+	}
+
+	echConfig, _ := dns.FetchECHConfigs(ctx, host)
+	return echConfig
+}
+
+// hasFixedECHConfig reports whether the ECH config comes from the transport
+// config rather than the per-host cache
+func (t *HTTP2Transport) hasFixedECHConfig() bool {
+	return t.config != nil && (len(t.config.ECHConfig) > 0 || t.config.ECHConfigDomain != "")
+}
+
+// storeAcceptedECH keeps a config the server accepted for session resumption
+func (t *HTTP2Transport) storeAcceptedECH(host string, configList []byte) {
+	if len(configList) == 0 || t.hasFixedECHConfig() {
+		return
+	}
+	t.echConfigCacheMu.Lock()
+	t.echConfigCache[host] = configList
+	t.echConfigCacheMu.Unlock()
+}
+
+// handleECHRejection updates the host's ECH state after the server rejected
+// our config: retry_configs replace it, no retry_configs disable ECH
+func (t *HTTP2Transport) handleECHRejection(host string, retryConfigs []byte) {
+	t.echConfigCacheMu.Lock()
+	if len(retryConfigs) > 0 {
+		t.echConfigCache[host] = retryConfigs
+	} else {
+		delete(t.echConfigCache, host)
+		if t.echRejectedHosts == nil {
+			t.echRejectedHosts = make(map[string]bool)
+		}
+		t.echRejectedHosts[host] = true
+	}
+	t.echConfigCacheMu.Unlock()
+	if len(retryConfigs) > 0 {
+		dns.StoreECHConfigs(host, retryConfigs, 0)
+	}
+}
+
+// SetDisableECH disables the automatic ECH config lookup for presets that use ECH
+func (t *HTTP2Transport) SetDisableECH(disable bool) {
+	t.disableECH = disable
+}
+
+// GetECHConfigCache returns all cached ECH configs (for session persistence)
+func (t *HTTP2Transport) GetECHConfigCache() map[string][]byte {
+	t.echConfigCacheMu.RLock()
+	defer t.echConfigCacheMu.RUnlock()
+
+	result := make(map[string][]byte, len(t.echConfigCache))
+	for k, v := range t.echConfigCache {
+		result[k] = v
+	}
+	return result
+}
+
+// SetECHConfigCache imports ECH configs from session persistence
+func (t *HTTP2Transport) SetECHConfigCache(configs map[string][]byte) {
+	t.echConfigCacheMu.Lock()
+	defer t.echConfigCacheMu.Unlock()
+
+	for k, v := range configs {
+		t.echConfigCache[k] = v
+	}
+}
+
+// handleECHRejection updates the host's ECH state after the server rejected
+// our config: retry_configs replace it, no retry_configs disable ECH
+func (t *HTTP3Transport) handleECHRejection(host string, retryConfigs []byte) {
+	t.echConfigCacheMu.Lock()
+	if len(retryConfigs) > 0 {
+		t.echConfigCache[host] = retryConfigs
+	} else {
+		delete(t.echConfigCache, host)
+		if t.echRejectedHosts == nil {
+			t.echRejectedHosts = make(map[string]bool)
+		}
+		t.echRejectedHosts[host] = true
+	}
+	t.echConfigCacheMu.Unlock()
+	if len(retryConfigs) > 0 {
+		dns.StoreECHConfigs(host, retryConfigs, 0)
+	}
+}
@@ -0,0 +1,49 @@
+package transport
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	utls "github.com/sardanioss/utls"
+)
+
+func TestSpecHasECH(t *testing.T) {
+	spec, err := utls.UTLSIdToSpec(utls.HelloChrome_131)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !specHasECH(&spec) {
+		t.Error("Chrome spec should carry GREASE ECH")
+	}
+	if specHasECH(nil) {
+		t.Error("nil spec should not report ECH")
+	}
+}
+
+func TestHTTP2ECHStateMachine(t *testing.T) {
+	tr := &HTTP2Transport{
+		echConfigCache: make(map[string][]byte),
+		config:         &TransportConfig{DisableECHHosts: map[string]bool{"off.example": true}},
+	}
+
+	err := fmt.Errorf("TLS handshake failed: %w", &utls.ECHRejectionError{RetryConfigList: []byte{1, 2}})
+	retry, rejected := echRejection(err)
+	if !rejected || !bytes.Equal(retry, []byte{1, 2}) {
+		t.Fatalf("echRejection = %x, %v", retry, rejected)
+	}
+	tr.handleECHRejection("a.example", retry)
+	if got := tr.GetECHConfigCache()["a.example"]; !bytes.Equal(got, retry) {
+		t.Errorf("retry_configs not cached: %x", got)
+	}
+
+	// Rejection without retry_configs falls back to GREASE ECH for the host
+	tr.handleECHRejection("a.example", nil)
+	spec, _ := utls.UTLSIdToSpec(utls.HelloChrome_131)
+	if got := tr.getECHConfig(t.Context(), "a.example", &spec); got != nil {
+		t.Errorf("expected no ECH config after rejection, got %x", got)
+	}
+	if got := tr.getECHConfig(t.Context(), "off.example", &spec); got != nil {
+		t.Errorf("expected no ECH config for disabled host, got %x", got)
+	}
+}
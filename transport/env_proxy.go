@@ -0,0 +1,58 @@
+package transport
+
+import (
+	"net/url"
+	"os"
+
+	"golang.org/x/net/http/httpproxy"
+)
+
+// environmentProxyFunc reads HTTP_PROXY, HTTPS_PROXY, NO_PROXY and ALL_PROXY
+// (or their lowercase forms) with the semantics of Go's net/http:
+// HTTPS_PROXY for https URLs, HTTP_PROXY for http URLs, NO_PROXY listing
+// hosts, domains (".example.com" or "example.com" covers subdomains), CIDRs
+// and "*" to reach directly, and loopback addresses always reached directly.
+// ALL_PROXY (typically socks5://) is used for schemes whose variable is unset.
+func environmentProxyFunc() func(*url.URL) (*url.URL, error) {
+	cfg := httpproxy.FromEnvironment()
+	if all := firstEnv("ALL_PROXY", "all_proxy"); all != "" {
+		if cfg.HTTPProxy == "" {
+			cfg.HTTPProxy = all
+		}
+		if cfg.HTTPSProxy == "" {
+			cfg.HTTPSProxy = all
+		}
+	}
+	if cfg.HTTPProxy == "" && cfg.HTTPSProxy == "" {
+		return nil
+	}
+	return cfg.ProxyFunc()
+}
+
+func firstEnv(names ...string) string {
+	for _, name := range names {
+		if value := os.Getenv(name); value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// environmentTransport returns the transport for a request routed by the
+// environment proxy settings, or nil when the request goes through this
+// transport (no environment proxy, an explicit proxy set, or a direct host).
+// Runs on a request snapshot.
+func (t *Transport) environmentTransport(rawURL string) *Transport {
+	if t.envProxy == nil || t.proxy != nil {
+		return nil
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil
+	}
+	proxyURL, err := t.envProxy(u)
+	if err != nil || proxyURL == nil {
+		return nil
+	}
+	return t.proxyTransport(proxyURL.String())
+}
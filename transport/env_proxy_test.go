@@ -0,0 +1,76 @@
+package transport
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestProxyFromEnvironment(t *testing.T) {
+	var mu sync.Mutex
+	var seen []string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		seen = append(seen, r.Host)
+		mu.Unlock()
+	}))
+	defer proxy.Close()
+
+	for _, name := range []string{"HTTP_PROXY", "HTTPS_PROXY", "ALL_PROXY", "NO_PROXY", "http_proxy", "https_proxy", "all_proxy", "no_proxy", "REQUEST_METHOD"} {
+		t.Setenv(name, "")
+	}
+	t.Setenv("HTTP_PROXY", proxy.URL)
+	t.Setenv("NO_PROXY", "direct.invalid")
+
+	tr := NewTransportWithConfig("chrome-latest", nil, &TransportConfig{ProxyFromEnvironment: true})
+	defer tr.Close()
+	tr.SetProtocol(ProtocolHTTP1)
+
+	resp, err := tr.Do(context.Background(), &Request{Method: "GET", URL: "http://proxied.invalid/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Close()
+
+	// NO_PROXY hosts are dialed directly, which fails for .invalid
+	if _, err := tr.Do(context.Background(), &Request{Method: "GET", URL: "http://direct.invalid/"}); err == nil {
+		t.Error("NO_PROXY host was not dialed directly")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(seen) == 0 {
+		t.Fatal("request did not go through HTTP_PROXY")
+	}
+	for _, host := range seen {
+		if !strings.HasPrefix(host, "proxied.invalid") {
+			t.Errorf("proxy saw %s, want only proxied.invalid", host)
+		}
+	}
+}
+
+func TestEnvironmentProxyFuncAllProxy(t *testing.T) {
+	for _, name := range []string{"HTTP_PROXY", "HTTPS_PROXY", "ALL_PROXY", "NO_PROXY", "http_proxy", "https_proxy", "all_proxy", "no_proxy", "REQUEST_METHOD"} {
+		t.Setenv(name, "")
+	}
+	if environmentProxyFunc() != nil {
+		t.Fatal("proxy func returned without any proxy variable")
+	}
+
+	t.Setenv("all_proxy", "socks5://127.0.0.1:1080")
+	t.Setenv("HTTPS_PROXY", "http://127.0.0.1:3128")
+	proxyFunc := environmentProxyFunc()
+	for rawURL, want := range map[string]string{
+		"https://example.com/": "http://127.0.0.1:3128",
+		"http://example.com/":  "socks5://127.0.0.1:1080",
+	} {
+		u, _ := http.NewRequest("GET", rawURL, nil)
+		got, err := proxyFunc(u.URL)
+		if err != nil || got == nil || got.String() != want {
+			t.Errorf("%s: proxy = %v, %v; want %s", rawURL, got, err, want)
+		}
+	}
+}
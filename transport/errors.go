@@ -40,6 +40,15 @@ var (
 
 	// ErrALPNMismatch represents ALPN protocol negotiation mismatch
 	ErrALPNMismatch = errors.New("ALPN mismatch")
+
+	// ErrHostBlocked represents requests rejected by the host allow/deny policy
+	ErrHostBlocked = errors.New("host blocked by policy")
+
+	// ErrFingerprintMismatch represents a produced fingerprint that differs from the target
+	ErrFingerprintMismatch = errors.New("fingerprint mismatch")
+
+	// ErrPanic represents a panic recovered while executing a request
+	ErrPanic = errors.New("panic during request")
 )
 
 // ALPNMismatchError is returned when ALPN negotiates a different protocol than expected.
@@ -60,6 +69,24 @@ func (e *ALPNMismatchError) Unwrap() error {
 	return ErrALPNMismatch
 }
 
+// FingerprintMismatchError is returned when the fingerprint a connection or
+// request actually produced differs from the configured target
+// (TransportConfig.TargetJA4 / TargetJA4H). It is never retried.
+type FingerprintMismatchError struct {
+	Kind   string // "ja4" or "ja4h"
+	Target string // Expected fingerprint
+	Actual string // Fingerprint actually produced
+	Host   string // Target host
+}
+
+func (e *FingerprintMismatchError) Error() string {
+	return fmt.Sprintf("%s mismatch for %s: target %s, produced %s", e.Kind, e.Host, e.Target, e.Actual)
+}
+
+func (e *FingerprintMismatchError) Unwrap() error {
+	return ErrFingerprintMismatch
+}
+
 // TransportError provides detailed error information
 type TransportError struct {
 	Op       string // Operation that failed (e.g., "dial", "tls_handshake", "request")
@@ -0,0 +1,109 @@
+package transport
+
+import (
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	http "github.com/sardanioss/http"
+	"github.com/sardanioss/httpcloak/fingerprint"
+	utls "github.com/sardanioss/utls"
+)
+
+// verifyJA4 compares the ClientHello sent on a completed handshake against
+// config.TargetJA4. Only the first full handshake is checked: resumed
+// handshakes add pre_shared_key (like browsers do) and would never match.
+func verifyJA4(tlsConn *utls.UConn, config *TransportConfig, verified *atomic.Bool, host string) error {
+	if config == nil || config.TargetJA4 == "" || verified.Load() {
+		return nil
+	}
+	hello := tlsConn.HandshakeState.Hello
+	if hello == nil || len(hello.Raw) == 0 || len(hello.PskIdentities) > 0 {
+		return nil
+	}
+
+	actual, err := fingerprint.JA4(hello.Raw, false)
+	if err != nil {
+		return err
+	}
+	if actual != config.TargetJA4 {
+		return &FingerprintMismatchError{Kind: "ja4", Target: config.TargetJA4, Actual: actual, Host: host}
+	}
+	verified.Store(true)
+	return nil
+}
+
+// ja4h returns the JA4H of the headers about to be sent and compares it
+// against config.TargetJA4H. Only the first request is checked.
+func (t *Transport) ja4h(httpReq *http.Request, proto string) (string, error) {
+	actual := fingerprint.JA4H(httpReq.Method, proto, sentHeaders(httpReq.Header))
+	if t.config == nil || t.config.TargetJA4H == "" || t.ja4hVerified.Load() {
+		return actual, nil
+	}
+	if actual != t.config.TargetJA4H {
+		return "", &FingerprintMismatchError{Kind: "ja4h", Target: t.config.TargetJA4H, Actual: actual, Host: httpReq.URL.Hostname()}
+	}
+	t.ja4hVerified.Store(true)
+	return actual, nil
+}
+
+// sentHeaders lists request headers in wire order: headers named in the
+// header order key first, then the rest sorted by name
+func sentHeaders(header http.Header) []fingerprint.HeaderPair {
+	pairs := make([]fingerprint.HeaderPair, 0, len(header))
+	seen := make([]string, 0, len(header))
+	add := func(key string, values []string) {
+		for _, v := range values {
+			pairs = append(pairs, fingerprint.HeaderPair{Key: headerKeyForms(key).lower, Value: v})
+		}
+	}
+
+	for _, name := range header[http.HeaderOrderKey] {
+		key := headerKeyForms(name).canonical
+		if values, ok := header[key]; ok && !slices.Contains(seen, key) {
+			seen = append(seen, key)
+			add(key, values)
+		}
+	}
+
+	rest := make([]string, 0, len(header)-len(seen))
+	for key := range header {
+		if !slices.Contains(seen, key) && key != http.HeaderOrderKey && key != http.PHeaderOrderKey {
+			rest = append(rest, key)
+		}
+	}
+	sort.Strings(rest)
+	for _, key := range rest {
+		add(key, header[key])
+	}
+	return pairs
+}
+
+// headerKeys caches the canonical and lowercase forms of header names,
+// which come from a small set and are needed on every request. It stops
+// growing at maxHeaderKeys entries in case names are generated.
+var (
+	headerKeys      sync.Map
+	headerKeysCount atomic.Int32
+)
+
+const maxHeaderKeys = 1024
+
+type headerKey struct {
+	canonical, lower string
+}
+
+func headerKeyForms(name string) headerKey {
+	if forms, ok := headerKeys.Load(name); ok {
+		return forms.(headerKey)
+	}
+	forms := headerKey{canonical: http.CanonicalHeaderKey(name), lower: strings.ToLower(name)}
+	if headerKeysCount.Load() < maxHeaderKeys {
+		if _, loaded := headerKeys.LoadOrStore(name, forms); !loaded {
+			headerKeysCount.Add(1)
+		}
+	}
+	return forms
+}
@@ -0,0 +1,68 @@
+package transport
+
+import (
+	"context"
+	stdhttp "net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	http "github.com/sardanioss/http"
+	"github.com/sardanioss/httpcloak/fingerprint"
+)
+
+func TestSentHeaders(t *testing.T) {
+	h := http.Header{}
+	h.Set("Accept", "*/*")
+	h.Set("User-Agent", "test")
+	h.Set("X-Extra", "1")
+	h.Set("Cookie", "a=1")
+	h[http.HeaderOrderKey] = []string{"user-agent", "accept", "missing"}
+
+	got := sentHeaders(h)
+	want := []string{"user-agent", "accept", "cookie", "x-extra"}
+	if len(got) != len(want) {
+		t.Fatalf("sentHeaders = %v, want keys %v", got, want)
+	}
+	for i, key := range want {
+		if got[i].Key != key {
+			t.Errorf("header %d = %s, want %s", i, got[i].Key, key)
+		}
+	}
+}
+
+func TestSentFingerprints(t *testing.T) {
+	srv := httptest.NewUnstartedServer(stdhttp.HandlerFunc(func(w stdhttp.ResponseWriter, r *stdhttp.Request) {}))
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	defer srv.Close()
+
+	for _, tc := range []struct {
+		protocol Protocol
+		ja4h     string
+	}{{ProtocolHTTP1, "ge11"}, {ProtocolHTTP2, "ge20"}} {
+		tr := NewTransport("chrome-latest")
+		tr.SetProtocol(tc.protocol)
+		tr.SetInsecureSkipVerify(true)
+
+		resp, err := tr.Do(context.Background(), &Request{Method: "GET", URL: srv.URL})
+		if err != nil {
+			t.Fatalf("protocol %v: %v", tc.protocol, err)
+		}
+		resp.Close()
+		sent := resp.SentFingerprints
+		if !strings.HasPrefix(sent.JA4H, tc.ja4h) {
+			t.Errorf("protocol %v: JA4H = %q, want prefix %q", tc.protocol, sent.JA4H, tc.ja4h)
+		}
+		if !strings.HasPrefix(sent.JA4, "t13") {
+			t.Errorf("protocol %v: JA4 = %q, want a TLS 1.3 TCP fingerprint", tc.protocol, sent.JA4)
+		}
+		if want := fingerprint.JA4X(srv.Certificate()); sent.JA4X != want {
+			t.Errorf("protocol %v: JA4X = %q, want %q", tc.protocol, sent.JA4X, want)
+		}
+		if got := len(sent.PseudoHeaderOrder) > 0; got != (tc.protocol == ProtocolHTTP2) {
+			t.Errorf("protocol %v: pseudo-header order = %v", tc.protocol, sent.PseudoHeaderOrder)
+		}
+		tr.Close()
+	}
+}
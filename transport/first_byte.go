@@ -0,0 +1,114 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	http "github.com/sardanioss/http"
+	"github.com/sardanioss/http/httptrace"
+)
+
+// ErrFirstByteTimeout represents a server that took the request but sent no
+// response headers within the first-byte timeout
+var ErrFirstByteTimeout = errors.New("no response headers within the first-byte timeout")
+
+// firstByteKey is the context key carrying the request's first-byte timeout
+type firstByteKey struct{}
+
+// withFirstByteTimeout makes ctx carry the first-byte timeout for req: the
+// request's own, else TransportConfig.FirstByteTimeout
+func (t *Transport) withFirstByteTimeout(ctx context.Context, req *Request) context.Context {
+	d := req.FirstByteTimeout
+	if d == 0 && t.config != nil {
+		d = t.config.FirstByteTimeout
+	}
+	if d <= 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, firstByteKey{}, d)
+}
+
+// firstByteTimeout returns the first-byte timeout carried by ctx, 0 for none
+func firstByteTimeout(ctx context.Context) time.Duration {
+	d, _ := ctx.Value(firstByteKey{}).(time.Duration)
+	return d
+}
+
+// firstByteError is the error of a request aborted by the first-byte timeout
+func firstByteError(req *http.Request, protocol string) error {
+	return NewTimeoutError("first_byte", req.URL.Hostname(), req.URL.Port(), protocol, ErrFirstByteTimeout)
+}
+
+// firstByteErr reports an HTTP/1.1 head read that failed on the first-byte
+// read deadline fb as a first-byte timeout
+func firstByteErr(req *http.Request, err error, fb time.Time) error {
+	var ne net.Error
+	if fb.IsZero() || !errors.As(err, &ne) || !ne.Timeout() || time.Now().Before(fb) || req.Context().Err() != nil {
+		return err
+	}
+	return firstByteError(req, "h1")
+}
+
+// firstByteWatch aborts an HTTP/2 or HTTP/3 request whose response headers
+// don't arrive within the first-byte timeout. The clock starts once the
+// request, body included, is written, so slow uploads don't count.
+type firstByteWatch struct {
+	ctx    context.Context
+	cancel context.CancelCauseFunc
+
+	mu       sync.Mutex
+	timer    *time.Timer
+	finished bool
+}
+
+// watchFirstByte arms the first-byte timeout carried by req's context. It
+// returns req unchanged and a nil watch when there is none.
+func watchFirstByte(req *http.Request) (*http.Request, *firstByteWatch) {
+	d := firstByteTimeout(req.Context())
+	if d <= 0 {
+		return req, nil
+	}
+	ctx, cancel := context.WithCancelCause(req.Context())
+	w := &firstByteWatch{ctx: ctx, cancel: cancel}
+	trace := &httptrace.ClientTrace{
+		WroteRequest: func(httptrace.WroteRequestInfo) {
+			w.mu.Lock()
+			defer w.mu.Unlock()
+			if !w.finished && w.timer == nil {
+				w.timer = time.AfterFunc(d, func() { cancel(ErrFirstByteTimeout) })
+			}
+		},
+	}
+	return req.WithContext(httptrace.WithClientTrace(ctx, trace)), w
+}
+
+// done disarms the watch once the round trip returns. A request the watch
+// aborted fails with a timeout error wrapping ErrFirstByteTimeout; a
+// response's body keeps the request alive until it is read or closed.
+func (w *firstByteWatch) done(req *http.Request, resp *http.Response, err error, protocol string) (*http.Response, error) {
+	if w == nil {
+		return resp, err
+	}
+	w.mu.Lock()
+	w.finished = true
+	if w.timer != nil {
+		w.timer.Stop()
+	}
+	w.mu.Unlock()
+
+	if context.Cause(w.ctx) == ErrFirstByteTimeout {
+		if resp != nil {
+			resp.Body.Close()
+		}
+		return nil, firstByteError(req, protocol)
+	}
+	if err != nil {
+		w.cancel(nil)
+		return nil, err
+	}
+	resp.Body = &doneBody{ReadCloser: resp.Body, done: func() { w.cancel(nil) }}
+	return resp, nil
+}
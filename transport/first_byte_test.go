@@ -0,0 +1,61 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	stdhttp "net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestFirstByteTimeout(t *testing.T) {
+	srv := httptest.NewUnstartedServer(stdhttp.HandlerFunc(func(w stdhttp.ResponseWriter, r *stdhttp.Request) {
+		if r.URL.Path == "/stall" {
+			time.Sleep(500 * time.Millisecond)
+		}
+		// Headers now, then a body slower than the first-byte timeout
+		w.(stdhttp.Flusher).Flush()
+		for i := 0; i < 3; i++ {
+			time.Sleep(100 * time.Millisecond)
+			w.Write([]byte("chunk"))
+			w.(stdhttp.Flusher).Flush()
+		}
+	}))
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	defer srv.Close()
+
+	for _, p := range []Protocol{ProtocolHTTP1, ProtocolHTTP2} {
+		tr := NewTransportWithConfig("chrome-latest", nil, &TransportConfig{FirstByteTimeout: 150 * time.Millisecond})
+		tr.SetProtocol(p)
+		tr.SetInsecureSkipVerify(true)
+
+		started := time.Now()
+		_, err := tr.Do(context.Background(), &Request{Method: "GET", URL: srv.URL + "/stall"})
+		if !errors.Is(err, ErrFirstByteTimeout) || !IsTimeout(err) {
+			t.Errorf("protocol %v: stalled server: err = %v", p, err)
+		}
+		if elapsed := time.Since(started); elapsed > 400*time.Millisecond {
+			t.Errorf("protocol %v: aborted after %v", p, elapsed)
+		}
+
+		resp, err := tr.Do(context.Background(), &Request{Method: "GET", URL: srv.URL + "/download"})
+		if err != nil {
+			t.Fatalf("protocol %v: slow body: %v", p, err)
+		}
+		if body, _ := resp.Text(); body != "chunkchunkchunk" {
+			t.Errorf("protocol %v: body = %q", p, body)
+		}
+		resp.Close()
+
+		// A per-request timeout overrides the transport's
+		resp, err = tr.Do(context.Background(), &Request{Method: "GET", URL: srv.URL + "/stall", FirstByteTimeout: time.Second})
+		if err != nil {
+			t.Errorf("protocol %v: per-request override: %v", p, err)
+		} else {
+			resp.Close()
+		}
+		tr.Close()
+	}
+}
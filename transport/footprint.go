@@ -0,0 +1,90 @@
+package transport
+
+import "time"
+
+// Settings used when TransportConfig.LowFootprint is set
+const (
+	lowFootprintIdleTime        = 15 * time.Second
+	lowFootprintCleanupInterval = 5 * time.Second
+	lowFootprintQUICIdleTimeout = 10 * time.Second
+
+	defaultIdleTime        = 90 * time.Second
+	defaultCleanupInterval = 30 * time.Second
+	defaultQUICIdleTimeout = 30 * time.Second
+)
+
+// ConnCounts is the number of pooled connections per protocol. Each HTTP/2
+// connection holds one reader goroutine and each QUIC connection a few;
+// idle HTTP/1.1 connections hold none.
+type ConnCounts struct {
+	HTTP1Idle int // Idle HTTP/1.1 connections waiting for reuse
+	HTTP2     int // Open HTTP/2 connections
+	HTTP3     int // Open QUIC connections
+}
+
+// ConnCounts returns the number of connections held by the transport
+func (t *Transport) ConnCounts() ConnCounts {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.connCounts()
+}
+
+// connCounts counts connections. Caller holds t.mu.RLock.
+func (t *Transport) connCounts() ConnCounts {
+	var counts ConnCounts
+	t.h1Transport.idleConnsMu.Lock()
+	for _, conns := range t.h1Transport.idleConns {
+		counts.HTTP1Idle += len(conns)
+	}
+	t.h1Transport.idleConnsMu.Unlock()
+
+	t.h2Transport.connsMu.RLock()
+	counts.HTTP2 = len(t.h2Transport.conns)
+	t.h2Transport.connsMu.RUnlock()
+
+	if t.h3Transport != nil {
+		counts.HTTP3 = int(t.h3Transport.openConns.Load())
+	}
+	return counts
+}
+
+// idleTime is how long pooled HTTP/1.1 and HTTP/2 connections may sit idle
+func idleTime(config *TransportConfig) time.Duration {
+	if config != nil && config.LowFootprint {
+		return lowFootprintIdleTime
+	}
+	return defaultIdleTime
+}
+
+// cleanupInterval is how often idle HTTP/1.1 and HTTP/2 connections are swept
+func cleanupInterval(config *TransportConfig) time.Duration {
+	if config != nil && config.PoolLimits != nil && config.PoolLimits.IdleEvictionInterval > 0 {
+		return config.PoolLimits.IdleEvictionInterval
+	}
+	if config != nil && config.LowFootprint {
+		return lowFootprintCleanupInterval
+	}
+	return defaultCleanupInterval
+}
+
+// quicTimeouts returns the QUIC idle timeout and keepalive period.
+// Keepalives (half the idle timeout unless QuicKeepAlive is set) stop idle
+// connections from closing; low-footprint mode turns them off so idle
+// connections time out.
+func quicTimeouts(config *TransportConfig) (idle, keepAlive time.Duration) {
+	idle = defaultQUICIdleTimeout
+	if config != nil && config.LowFootprint {
+		idle = lowFootprintQUICIdleTimeout
+	}
+	if config != nil && config.QuicIdleTimeout > 0 {
+		idle = config.QuicIdleTimeout
+	}
+	if config != nil && config.QuicKeepAlive != 0 {
+		// quic-go sends them at most every half idle timeout anyway
+		return idle, min(max(config.QuicKeepAlive, 0), idle/2)
+	}
+	if config != nil && config.LowFootprint {
+		return idle, 0
+	}
+	return idle, idle / 2
+}
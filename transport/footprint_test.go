@@ -0,0 +1,67 @@
+package transport
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestQUICTimeouts(t *testing.T) {
+	tests := []struct {
+		name      string
+		config    *TransportConfig
+		idle      time.Duration
+		keepAlive time.Duration
+	}{
+		{"default", nil, 30 * time.Second, 15 * time.Second},
+		{"configured", &TransportConfig{QuicIdleTimeout: time.Minute}, time.Minute, 30 * time.Second},
+		{"low footprint", &TransportConfig{LowFootprint: true}, 10 * time.Second, 0},
+		{"low footprint configured", &TransportConfig{LowFootprint: true, QuicIdleTimeout: time.Minute}, time.Minute, 0},
+		{"keepalive", &TransportConfig{QuicIdleTimeout: time.Hour, QuicKeepAlive: 20 * time.Second}, time.Hour, 20 * time.Second},
+		{"keepalive capped", &TransportConfig{QuicKeepAlive: time.Minute}, 30 * time.Second, 15 * time.Second},
+		{"keepalive off", &TransportConfig{QuicKeepAlive: -1}, 30 * time.Second, 0},
+		{"low footprint keepalive", &TransportConfig{LowFootprint: true, QuicKeepAlive: time.Second}, 10 * time.Second, time.Second},
+	}
+	for _, tt := range tests {
+		idle, keepAlive := quicTimeouts(tt.config)
+		if idle != tt.idle || keepAlive != tt.keepAlive {
+			t.Errorf("%s: quicTimeouts = %v, %v; want %v, %v", tt.name, idle, keepAlive, tt.idle, tt.keepAlive)
+		}
+	}
+}
+
+func TestConnCounts(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	h1 := httptest.NewServer(handler)
+	defer h1.Close()
+	h2 := httptest.NewUnstartedServer(handler)
+	h2.EnableHTTP2 = true
+	h2.StartTLS()
+	defer h2.Close()
+
+	tr := NewTransportWithConfig("chrome-latest", nil, &TransportConfig{LowFootprint: true})
+	defer tr.Close()
+	tr.SetInsecureSkipVerify(true)
+	if tr.h1Transport.maxIdleTime != lowFootprintIdleTime || tr.h2Transport.maxIdleTime != lowFootprintIdleTime {
+		t.Error("LowFootprint did not shorten the idle time")
+	}
+
+	for _, tc := range []struct {
+		protocol Protocol
+		url      string
+	}{{ProtocolHTTP1, h1.URL}, {ProtocolHTTP2, h2.URL}} {
+		tr.SetProtocol(tc.protocol)
+		resp, err := tr.Do(context.Background(), &Request{Method: "GET", URL: tc.url})
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Close()
+	}
+
+	counts := tr.ConnCounts()
+	if counts.HTTP1Idle != 1 || counts.HTTP2 != 1 || counts.HTTP3 != 0 {
+		t.Errorf("ConnCounts = %+v, want one idle HTTP/1.1 and one HTTP/2 connection", counts)
+	}
+}
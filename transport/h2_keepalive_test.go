@@ -0,0 +1,229 @@
+package transport
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/hpack"
+)
+
+// h2PingServer is a minimal HTTP/2 server that counts the client's PINGs.
+// Requests for /hold get their headers at once and the end of the stream
+// when unhold is called, keeping a stream open until then.
+type h2PingServer struct {
+	addr     string
+	pings    atomic.Int32
+	held     chan struct{} // Receives when a /hold request arrives
+	release  chan struct{}
+	unhold   func()
+	ackPings bool
+}
+
+func newH2PingServer(t *testing.T, ackPings bool) *h2PingServer {
+	t.Helper()
+	cert := selfSignedCert(t)
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: cert.Certificate, PrivateKey: cert.PrivateKey}},
+		NextProtos:   []string{"h2"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &h2PingServer{
+		addr:     ln.Addr().String(),
+		held:     make(chan struct{}, 1),
+		release:  make(chan struct{}),
+		ackPings: ackPings,
+	}
+	s.unhold = sync.OnceFunc(func() { close(s.release) })
+	t.Cleanup(func() {
+		s.unhold()
+		ln.Close()
+	})
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *h2PingServer) serve(conn net.Conn) {
+	defer conn.Close()
+	if _, err := io.ReadFull(conn, make([]byte, len(http2.ClientPreface))); err != nil {
+		return
+	}
+	var mu sync.Mutex
+	fr := http2.NewFramer(conn, conn)
+	fr.ReadMetaHeaders = hpack.NewDecoder(4096, nil)
+	mu.Lock()
+	fr.WriteSettings()
+	mu.Unlock()
+
+	var status bytes.Buffer
+	hpack.NewEncoder(&status).WriteField(hpack.HeaderField{Name: ":status", Value: "200"})
+	for {
+		f, err := fr.ReadFrame()
+		if err != nil {
+			return
+		}
+		mu.Lock()
+		switch f := f.(type) {
+		case *http2.SettingsFrame:
+			if !f.IsAck() {
+				fr.WriteSettingsAck()
+			}
+		case *http2.PingFrame:
+			if !f.IsAck() {
+				s.pings.Add(1)
+				if s.ackPings {
+					fr.WritePing(true, f.Data)
+				}
+			}
+		case *http2.MetaHeadersFrame:
+			hold := f.PseudoValue("path") == "/hold"
+			fr.WriteHeaders(http2.HeadersFrameParam{
+				StreamID:      f.StreamID,
+				BlockFragment: status.Bytes(),
+				EndHeaders:    true,
+				EndStream:     !hold,
+			})
+			if hold {
+				s.held <- struct{}{}
+				go func() {
+					<-s.release
+					mu.Lock()
+					fr.WriteData(f.StreamID, true, nil)
+					mu.Unlock()
+				}()
+			}
+		}
+		mu.Unlock()
+	}
+}
+
+// newH2PingTransport returns an HTTP/2-only transport for the test server
+func newH2PingTransport(t *testing.T, ping *H2PingConfig) *Transport {
+	t.Helper()
+	tr := NewTransportWithConfig("chrome-latest", nil, &TransportConfig{H2Ping: ping})
+	t.Cleanup(tr.Close)
+	tr.SetProtocol(ProtocolHTTP2)
+	tr.SetInsecureSkipVerify(true)
+	return tr
+}
+
+func h2Get(t *testing.T, tr *Transport, url string) {
+	t.Helper()
+	resp, err := tr.Do(context.Background(), &Request{Method: "GET", URL: url})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Close()
+}
+
+// waitFor polls cond for up to 2s
+func waitFor(cond func() bool) bool {
+	for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if cond() {
+			return true
+		}
+	}
+	return cond()
+}
+
+func TestH2KeepAlivePingsIdleConn(t *testing.T) {
+	srv := newH2PingServer(t, true)
+	tr := newH2PingTransport(t, &H2PingConfig{Interval: 50 * time.Millisecond, Timeout: time.Second})
+	h2Get(t, tr, "https://"+srv.addr+"/")
+
+	if !waitFor(func() bool { return srv.pings.Load() >= 2 }) {
+		t.Fatalf("%d PINGs on an idle connection, want a PING per interval", srv.pings.Load())
+	}
+	if n := len(tr.h2Transport.Stats()); n != 1 {
+		t.Errorf("%d pooled connections after acknowledged PINGs, want 1", n)
+	}
+}
+
+func TestH2KeepAliveOnlyWhenIdle(t *testing.T) {
+	for _, onlyWhenIdle := range []bool{true, false} {
+		srv := newH2PingServer(t, true)
+		tr := newH2PingTransport(t, &H2PingConfig{Interval: 50 * time.Millisecond, OnlyWhenIdle: onlyWhenIdle})
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			h2Get(t, tr, "https://"+srv.addr+"/hold")
+		}()
+		<-srv.held
+		time.Sleep(300 * time.Millisecond)
+		pings := srv.pings.Load()
+		if onlyWhenIdle && pings != 0 {
+			t.Errorf("OnlyWhenIdle: %d PINGs while a stream was open, want 0", pings)
+		}
+		if !onlyWhenIdle && pings == 0 {
+			t.Error("no PINGs while a stream was open without OnlyWhenIdle")
+		}
+		srv.unhold()
+		<-done
+
+		// Once the stream ends the connection is idle and PINGed
+		if !waitFor(func() bool { return srv.pings.Load() > pings }) {
+			t.Errorf("OnlyWhenIdle %v: no PING after the stream ended", onlyWhenIdle)
+		}
+	}
+}
+
+func TestH2KeepAliveDropsUnansweredConn(t *testing.T) {
+	srv := newH2PingServer(t, false)
+	tr := newH2PingTransport(t, &H2PingConfig{Interval: 50 * time.Millisecond, Timeout: 100 * time.Millisecond})
+	h2Get(t, tr, "https://"+srv.addr+"/")
+
+	pooled := func() int {
+		tr.h2Transport.connsMu.RLock()
+		defer tr.h2Transport.connsMu.RUnlock()
+		return len(tr.h2Transport.conns)
+	}
+	if pooled() != 1 {
+		t.Fatalf("%d pooled connections after the request, want 1", pooled())
+	}
+	if !waitFor(func() bool { return pooled() == 0 }) {
+		t.Fatal("connection stayed pooled after an unanswered PING")
+	}
+	if srv.pings.Load() != 1 {
+		t.Errorf("%d PINGs, want 1 before the connection was dropped", srv.pings.Load())
+	}
+}
+
+// TestH2PingReplacesReadIdleCheck checks that H2Ping turns off Go's read-idle
+// health check, which would otherwise PING on its own schedule
+func TestH2PingReplacesReadIdleCheck(t *testing.T) {
+	for _, ping := range []*H2PingConfig{nil, {BeforeReuse: time.Hour}} {
+		srv := newH2PingServer(t, true)
+		tr := newH2PingTransport(t, ping)
+		tr.h2Transport.maxIdleTime = 50 * time.Millisecond // Read-idle timeout of new connections
+		h2Get(t, tr, "https://"+srv.addr+"/")
+
+		if ping == nil {
+			if !waitFor(func() bool { return srv.pings.Load() > 0 }) {
+				t.Error("no read-idle PING without H2Ping")
+			}
+			continue
+		}
+		time.Sleep(300 * time.Millisecond)
+		if n := srv.pings.Load(); n != 0 {
+			t.Errorf("%d read-idle PINGs with H2Ping set, want 0", n)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package transport
+
+import (
+	"context"
+	"math/rand"
+	"net"
+	"time"
+
+	"github.com/sardanioss/httpcloak/fingerprint"
+)
+
+// defaultH2PingTimeout is how long a keepalive PING may go unacknowledged
+const defaultH2PingTimeout = 15 * time.Second
+
+// H2PingConfig controls the HTTP/2 PING frames sent to keep connections alive.
+// By default the transport uses Go's health check (a PING after 90s without
+// reading a frame); set this to shape PING traffic like the imitated browser
+// or to keep NAT mappings open on long-lived idle connections.
+type H2PingConfig struct {
+	// Interval is how long a connection must go without a request before a
+	// PING is sent, repeated every Interval while it stays quiet. 0 sends no
+	// PINGs at all.
+	Interval time.Duration
+
+	// OnlyWhenIdle skips PINGs while streams are open, e.g. during a long
+	// download, where the data frames already prove the connection is alive
+	OnlyWhenIdle bool
+
+	// Timeout closes the connection when a PING isn't acknowledged in time
+	// (default 15s)
+	Timeout time.Duration
+
+	// Jitter varies each wait by up to this fraction of Interval in either
+	// direction (0.1 = ±10%), so PINGs don't tick like a metronome
+	Jitter float64
+
+	// BeforeReuse PINGs a connection that has gone this long without a
+	// request before sending the next request on it, as Chrome does. When
+	// the PING fails the request goes out on a new connection. 0 disables
+	// the check.
+	BeforeReuse time.Duration
+}
+
+// BrowserH2Ping returns the keepalive cadence of the browser preset imitates:
+//
+//   - Chromium: a PING before reusing a connection idle for 10s or more,
+//     plus one per 45s on idle connections
+//   - Firefox: a PING after 58s of idleness, 8s to answer
+//     (network.http.http2.ping-threshold and ping-timeout)
+//   - Safari: a PING per 60s on idle connections
+//
+// Presets of unknown browsers get the Chromium cadence.
+func BrowserH2Ping(preset *fingerprint.Preset) H2PingConfig {
+	family := ""
+	if preset != nil {
+		family = preset.BrowserFamily()
+	}
+	switch family {
+	case "firefox":
+		return H2PingConfig{Interval: 58 * time.Second, OnlyWhenIdle: true, Timeout: 8 * time.Second, Jitter: 0.05}
+	case "webkit":
+		return H2PingConfig{Interval: 60 * time.Second, OnlyWhenIdle: true, Jitter: 0.1}
+	default:
+		return H2PingConfig{Interval: 45 * time.Second, OnlyWhenIdle: true, Timeout: 10 * time.Second, Jitter: 0.1, BeforeReuse: 10 * time.Second}
+	}
+}
+
+// wait returns the time until the next PING check
+func (cfg *H2PingConfig) wait() time.Duration {
+	d := cfg.Interval
+	if cfg.Jitter > 0 {
+		d += time.Duration((rand.Float64()*2 - 1) * cfg.Jitter * float64(d))
+	}
+	if d <= 0 {
+		d = cfg.Interval
+	}
+	return d
+}
+
+func (cfg *H2PingConfig) timeout() time.Duration {
+	if cfg.Timeout <= 0 {
+		return defaultH2PingTimeout
+	}
+	return cfg.Timeout
+}
+
+// keepAlive sends PINGs on conn per the config until the connection closes.
+// A failed PING closes the connection and drops it from the pool.
+func (t *HTTP2Transport) keepAlive(key string, conn *persistentConn, cfg *H2PingConfig) {
+	wait := cfg.wait()
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	for range timer.C {
+		conn.mu.Lock()
+		h2Conn := conn.h2Conn
+		quiet := time.Since(conn.lastUsedAt) >= wait
+		conn.mu.Unlock()
+		wait = cfg.wait()
+		timer.Reset(wait)
+		if h2Conn == nil {
+			return
+		}
+		state := h2Conn.State()
+		if state.Closed || state.Closing {
+			return
+		}
+		if !quiet || (cfg.OnlyWhenIdle && state.StreamsActive > 0) {
+			continue
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), cfg.timeout())
+		err := h2Conn.Ping(ctx)
+		cancel()
+		if err != nil {
+			t.dropConn(key, conn)
+			return
+		}
+	}
+}
+
+// checkBeforeReuse PINGs conn first if it has been idle for BeforeReuse. A
+// connection that doesn't answer is dropped and false returned.
+func (t *HTTP2Transport) checkBeforeReuse(ctx context.Context, key string, conn *persistentConn) bool {
+	cfg := t.h2PingConfig()
+	if cfg == nil || cfg.BeforeReuse <= 0 {
+		return true
+	}
+	conn.mu.Lock()
+	h2Conn := conn.h2Conn
+	idle := conn.inFlight == 0 && time.Since(conn.lastUsedAt) >= cfg.BeforeReuse
+	conn.mu.Unlock()
+	if !idle || h2Conn == nil {
+		return true
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, cfg.timeout())
+	err := h2Conn.Ping(ctx)
+	cancel()
+	if err != nil {
+		t.dropConn(key, conn)
+		return false
+	}
+	conn.mu.Lock()
+	conn.lastUsedAt = time.Now()
+	conn.mu.Unlock()
+	return true
+}
+
+// dropConn closes conn and removes it from the pool if it is still pooled
+func (t *HTTP2Transport) dropConn(key string, conn *persistentConn) {
+	t.connsMu.Lock()
+	if t.conns[key] == conn {
+		delete(t.conns, key)
+	}
+	t.connsMu.Unlock()
+	conn.close()
+}
+
+// h2PingConfig returns the configured keepalive, or nil for Go's health check
+func (t *HTTP2Transport) h2PingConfig() *H2PingConfig {
+	if t.config == nil {
+		return nil
+	}
+	return t.config.H2Ping
+}
+
+// startKeepAlive starts PINGs for a newly pooled connection if configured
+func (t *HTTP2Transport) startKeepAlive(host, port string, conn *persistentConn) {
+	if cfg := t.h2PingConfig(); cfg != nil && cfg.Interval > 0 {
+		go t.keepAlive(net.JoinHostPort(t.getConnectHost(host), port), conn, cfg)
+	}
+}
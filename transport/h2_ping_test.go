@@ -0,0 +1,70 @@
+package transport
+
+import (
+	"context"
+	stdhttp "net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/sardanioss/httpcloak/fingerprint"
+)
+
+func TestBrowserH2Ping(t *testing.T) {
+	tests := []struct {
+		preset      string
+		interval    time.Duration
+		beforeReuse time.Duration
+	}{
+		{"chrome-latest", 45 * time.Second, 10 * time.Second},
+		{"firefox-133", 58 * time.Second, 0},
+		{"safari-18", 60 * time.Second, 0},
+	}
+	for _, tt := range tests {
+		cfg := BrowserH2Ping(fingerprint.Get(tt.preset))
+		if cfg.Interval != tt.interval || cfg.BeforeReuse != tt.beforeReuse {
+			t.Errorf("%s: Interval %v, BeforeReuse %v; want %v, %v", tt.preset, cfg.Interval, cfg.BeforeReuse, tt.interval, tt.beforeReuse)
+		}
+	}
+}
+
+func TestH2PingJitter(t *testing.T) {
+	cfg := H2PingConfig{Interval: time.Minute, Jitter: 0.1}
+	for i := 0; i < 100; i++ {
+		if d := cfg.wait(); d < 54*time.Second || d > 66*time.Second {
+			t.Fatalf("wait() = %v, want within 10%% of 1m", d)
+		}
+	}
+}
+
+func TestH2PingBeforeReuse(t *testing.T) {
+	srv := httptest.NewUnstartedServer(stdhttp.HandlerFunc(func(w stdhttp.ResponseWriter, r *stdhttp.Request) {}))
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	defer srv.Close()
+
+	tr := NewTransportWithConfig("chrome-latest", nil, &TransportConfig{
+		H2Ping: &H2PingConfig{BeforeReuse: 10 * time.Millisecond},
+	})
+	defer tr.Close()
+	tr.SetProtocol(ProtocolHTTP2)
+	tr.SetInsecureSkipVerify(true)
+
+	for i := 0; i < 2; i++ {
+		resp, err := tr.Do(context.Background(), &Request{Method: "GET", URL: srv.URL})
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Close()
+		time.Sleep(20 * time.Millisecond)
+	}
+	stats := tr.h2Transport.Stats()
+	if len(stats) != 1 {
+		t.Fatalf("%d connections, want 1", len(stats))
+	}
+	for _, cs := range stats {
+		if cs.UseCount != 2 {
+			t.Errorf("UseCount = %d, want 2 (connection reused after the PING)", cs.UseCount)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package transport
+
+import (
+	"net"
+	"sync"
+	"sync/atomic"
+
+	"github.com/sardanioss/httpcloak/fingerprint"
+)
+
+// h2WireLimit bounds how much of a connection is buffered while waiting for
+// its first HEADERS frame
+const h2WireLimit = 64 << 10
+
+// h2WireRecorder wraps an HTTP/2 connection and reads the client's preface
+// and first HEADERS frame as they are written, to report the Akamai
+// fingerprint the connection actually sent. After that, writes pass through
+// untouched.
+type h2WireRecorder struct {
+	net.Conn
+	done     atomic.Bool
+	onResult func(akamai string)
+
+	mu     sync.Mutex
+	buf    []byte
+	result string
+}
+
+func newH2WireRecorder(conn net.Conn, onResult func(akamai string)) *h2WireRecorder {
+	return &h2WireRecorder{Conn: conn, onResult: onResult}
+}
+
+func (r *h2WireRecorder) Write(p []byte) (int, error) {
+	if !r.done.Load() {
+		r.observe(p)
+	}
+	return r.Conn.Write(p)
+}
+
+func (r *h2WireRecorder) observe(p []byte) {
+	r.mu.Lock()
+	if r.done.Load() {
+		r.mu.Unlock()
+		return
+	}
+	r.buf = append(r.buf, p...)
+	spec, _, err := fingerprint.ParseH2Preface(r.buf)
+	if err == fingerprint.ErrH2PrefaceIncomplete && len(r.buf) < h2WireLimit {
+		r.mu.Unlock()
+		return
+	}
+	if err == nil {
+		r.result = spec.Akamai()
+	}
+	r.buf = nil
+	r.done.Store(true)
+	result := r.result
+	r.mu.Unlock()
+
+	if result != "" && r.onResult != nil {
+		r.onResult(result)
+	}
+}
+
+// akamai returns the fingerprint, empty until the first HEADERS frame has
+// been written
+func (r *h2WireRecorder) akamai() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.result
+}
@@ -0,0 +1,237 @@
+package transport
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	stdhttp "net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/sardanioss/httpcloak/fingerprint"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/hpack"
+)
+
+// h2Preface is what the server saw of a client's HTTP/2 connection preface
+type h2Preface struct {
+	settings       []http2.Setting
+	windowUpdate   uint32
+	headerPriority bool
+	pseudoOrder    []string
+	priorities     []http2.PriorityFrame
+	priorityHeader string
+}
+
+// captureH2Preface accepts one HTTP/2 connection and records its fingerprint
+func captureH2Preface(t *testing.T) (addr string, result <-chan h2Preface) {
+	t.Helper()
+	cert := selfSignedCert(t)
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: cert.Certificate, PrivateKey: cert.PrivateKey}},
+		NextProtos:   []string{"h2"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	ch := make(chan h2Preface, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		if _, err := io.ReadFull(conn, make([]byte, len(http2.ClientPreface))); err != nil {
+			return
+		}
+		var p h2Preface
+		fr := http2.NewFramer(conn, conn)
+		for {
+			f, err := fr.ReadFrame()
+			if err != nil {
+				return
+			}
+			switch f := f.(type) {
+			case *http2.SettingsFrame:
+				if !f.IsAck() {
+					f.ForeachSetting(func(s http2.Setting) error {
+						p.settings = append(p.settings, s)
+						return nil
+					})
+				}
+			case *http2.WindowUpdateFrame:
+				if f.StreamID == 0 {
+					p.windowUpdate = f.Increment
+				}
+			case *http2.PriorityFrame:
+				p.priorities = append(p.priorities, *f)
+			case *http2.HeadersFrame:
+				p.headerPriority = f.HasPriority()
+				hpack.NewDecoder(4096, func(hf hpack.HeaderField) {
+					if hf.IsPseudo() {
+						p.pseudoOrder = append(p.pseudoOrder, hf.Name)
+					}
+					if hf.Name == "priority" {
+						p.priorityHeader = hf.Value
+					}
+				}).Write(f.HeaderBlockFragment())
+				ch <- p
+				return
+			}
+		}
+	}()
+	return ln.Addr().String(), ch
+}
+
+func TestH2SpecOnTheWire(t *testing.T) {
+	addr, result := captureH2Preface(t)
+
+	spec := fingerprint.H2Spec{
+		Settings: []fingerprint.H2Setting{
+			{ID: fingerprint.H2SettingInitialWindowSize, Value: 131072},
+			{ID: fingerprint.H2SettingHeaderTableSize, Value: 65536},
+		},
+		ConnectionWindowUpdate: 12517377,
+		PseudoHeaderOrder:      []string{":method", ":path", ":authority", ":scheme"},
+	}
+	tr := NewTransportWithConfig("chrome-latest", nil, &TransportConfig{CustomH2Spec: &spec})
+	defer tr.Close()
+	tr.SetProtocol(ProtocolHTTP2)
+	tr.SetInsecureSkipVerify(true)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go tr.Do(ctx, &Request{Method: "GET", URL: "https://" + addr + "/"})
+
+	p := <-result
+	wantSettings := []http2.Setting{{ID: http2.SettingInitialWindowSize, Val: 131072}, {ID: http2.SettingHeaderTableSize, Val: 65536}}
+	if !reflect.DeepEqual(p.settings, wantSettings) {
+		t.Errorf("SETTINGS = %v, want %v", p.settings, wantSettings)
+	}
+	if p.windowUpdate != 12517377 {
+		t.Errorf("WINDOW_UPDATE = %d, want 12517377", p.windowUpdate)
+	}
+	if p.headerPriority {
+		t.Error("HEADERS carried a PRIORITY flag with HeaderPriority nil")
+	}
+	if !reflect.DeepEqual(p.pseudoOrder, spec.PseudoHeaderOrder) {
+		t.Errorf("pseudo-header order = %v, want %v", p.pseudoOrder, spec.PseudoHeaderOrder)
+	}
+}
+
+// fetchH2Preface makes one request with config and returns what the server saw
+func fetchH2Preface(t *testing.T, preset string, config *TransportConfig) h2Preface {
+	t.Helper()
+	addr, result := captureH2Preface(t)
+	tr := NewTransportWithConfig(preset, nil, config)
+	defer tr.Close()
+	tr.SetProtocol(ProtocolHTTP2)
+	tr.SetInsecureSkipVerify(true)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go tr.Do(ctx, &Request{Method: "GET", URL: "https://" + addr + "/"})
+	return <-result
+}
+
+func TestH2PriorityTreeOnTheWire(t *testing.T) {
+	spec := fingerprint.Get("firefox-133").H2().FirefoxPriorityTree()
+	p := fetchH2Preface(t, "firefox-133", &TransportConfig{CustomH2Spec: &spec})
+
+	var got []string
+	for _, f := range p.priorities {
+		got = append(got, fmt.Sprintf("%d:%t:%d:%d", f.StreamID, f.Exclusive, f.StreamDep, int(f.Weight)+1))
+	}
+	want := []string{"3:false:0:201", "5:false:0:101", "7:false:0:1", "9:false:7:1", "11:false:3:1", "13:false:0:241"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("PRIORITY frames = %v, want %v", got, want)
+	}
+	if !p.headerPriority {
+		t.Error("HEADERS carried no priority")
+	}
+	if p.priorityHeader != "" {
+		t.Errorf("priority header %q sent under RFC 7540 priorities", p.priorityHeader)
+	}
+}
+
+func TestH2PriorityRFC9218OnTheWire(t *testing.T) {
+	p := fetchH2Preface(t, "chrome-latest", &TransportConfig{H2PriorityScheme: fingerprint.H2PriorityRFC9218})
+	if p.headerPriority {
+		t.Error("HEADERS carried a PRIORITY flag under RFC 9218 priorities")
+	}
+	if len(p.priorities) > 0 {
+		t.Errorf("sent %d PRIORITY frames under RFC 9218 priorities", len(p.priorities))
+	}
+	if p.priorityHeader == "" {
+		t.Error("priority header missing under RFC 9218 priorities")
+	}
+}
+
+func TestAkamaiSpecOnTheWire(t *testing.T) {
+	spec, err := fingerprint.ParseAkamaiSpec("1:65536;3:1000;4:6291456|15663105|0|m,a,s,p")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := fetchH2Preface(t, "chrome-latest", &TransportConfig{CustomH2Spec: spec})
+	want := []http2.Setting{{ID: http2.SettingHeaderTableSize, Val: 65536}, {ID: http2.SettingMaxConcurrentStreams, Val: 1000}, {ID: http2.SettingInitialWindowSize, Val: 6291456}}
+	if !reflect.DeepEqual(p.settings, want) {
+		t.Errorf("SETTINGS = %v, want %v", p.settings, want)
+	}
+	if p.windowUpdate != 15663105 || len(p.priorities) > 0 {
+		t.Errorf("WINDOW_UPDATE = %d with %d PRIORITY frames, want 15663105 and none", p.windowUpdate, len(p.priorities))
+	}
+}
+
+func TestRequestPseudoHeaderOrder(t *testing.T) {
+	addr, result := captureH2Preface(t)
+	tr := NewTransportWithConfig("chrome-latest", nil, &TransportConfig{
+		CustomPseudoOrder: []string{":method", ":path", ":authority", ":scheme"},
+	})
+	defer tr.Close()
+	tr.SetProtocol(ProtocolHTTP2)
+	tr.SetInsecureSkipVerify(true)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	safari := []string{":method", ":scheme", ":path", ":authority"}
+	go tr.Do(ctx, &Request{Method: "GET", URL: "https://" + addr + "/", PseudoHeaderOrder: safari})
+	if p := <-result; !reflect.DeepEqual(p.pseudoOrder, safari) {
+		t.Errorf("pseudo-header order = %v, want %v", p.pseudoOrder, safari)
+	}
+
+	_, err := tr.Do(ctx, &Request{Method: "GET", URL: "https://" + addr + "/", PseudoHeaderOrder: []string{":method", ":path"}})
+	if err == nil {
+		t.Error("incomplete pseudo-header order accepted")
+	}
+}
+
+func TestEmittedAkamai(t *testing.T) {
+	srv := httptest.NewUnstartedServer(stdhttp.HandlerFunc(func(w stdhttp.ResponseWriter, r *stdhttp.Request) {}))
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	defer srv.Close()
+
+	spec := fingerprint.Get("firefox-133").H2().FirefoxPriorityTree()
+	tr := NewTransportWithConfig("firefox-133", nil, &TransportConfig{CustomH2Spec: &spec})
+	defer tr.Close()
+	tr.SetProtocol(ProtocolHTTP2)
+	tr.SetInsecureSkipVerify(true)
+
+	resp, err := tr.Do(context.Background(), &Request{Method: "GET", URL: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Close()
+	if got, want := resp.SentFingerprints.Akamai, spec.Akamai(); got != want {
+		t.Errorf("emitted Akamai = %q, want %q", got, want)
+	}
+	for _, cs := range tr.h2Transport.Stats() {
+		if cs.Akamai != spec.Akamai() {
+			t.Errorf("ConnStats.Akamai = %q, want %q", cs.Akamai, spec.Akamai())
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/sardanioss/quic-go"
+)
+
+// isQUICPathFailure reports whether err means the QUIC connection lost its
+// network path: a stateless reset from the server (e.g., after a load
+// balancer or server restart) or a path that could not be validated (e.g.,
+// a NAT rebinding the server never acknowledged). TCP is likely to work.
+func isQUICPathFailure(err error) bool {
+	var resetErr *quic.StatelessResetError
+	if errors.As(err, &resetErr) {
+		return true
+	}
+	var transportErr *quic.TransportError
+	if errors.As(err, &transportErr) && transportErr.ErrorCode == quic.NoViablePathError {
+		return true
+	}
+	return errors.Is(err, quic.ErrPathNotValidated) || errors.Is(err, quic.ErrPathClosed)
+}
+
+// canReplayRequest reports whether a request that failed mid-flight can be
+// sent again on another protocol: its body must be replayable and the
+// method idempotent, since the server may have processed the first attempt
+func canReplayRequest(req *Request) bool {
+	if req.BodyReader != nil {
+		return false
+	}
+	switch req.Method {
+	case "", http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// doHTTP3WithFallback sends the request over HTTP/3. If the QUIC connection
+// dies from a stateless reset or path failure, the host is marked as
+// HTTP/2 only and the request is resent over TCP when that is safe.
+func (t *Transport) doHTTP3WithFallback(ctx context.Context, req *Request) (*Response, error) {
+	resp, err := t.doHTTP3(ctx, req)
+	if err == nil || !isQUICPathFailure(err) {
+		return resp, err
+	}
+
+	t.protocolSupportMu.Lock()
+	t.protocolSupport[extractHost(req.URL)] = ProtocolHTTP2
+	t.protocolSupportMu.Unlock()
+
+	if !canReplayRequest(req) || ctx.Err() != nil {
+		return nil, err
+	}
+	resp, h2Err := t.doHTTP2(ctx, req)
+	var alpnErr *ALPNMismatchError
+	if errors.As(h2Err, &alpnErr) {
+		return t.doHTTP1WithTLSConn(ctx, req, alpnErr)
+	}
+	return resp, h2Err
+}
+
+// responseProtocol returns the protocol a response was received over
+func responseProtocol(resp *Response, fallback Protocol) Protocol {
+	if resp == nil {
+		return fallback
+	}
+	switch resp.Protocol {
+	case "h1":
+		return ProtocolHTTP1
+	case "h2":
+		return ProtocolHTTP2
+	case "h3":
+		return ProtocolHTTP3
+	}
+	return fallback
+}
@@ -0,0 +1,48 @@
+package transport
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/sardanioss/quic-go"
+)
+
+func TestIsQUICPathFailure(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{WrapError("roundtrip", "example.com", "443", "h3", &quic.StatelessResetError{}), true},
+		{fmt.Errorf("wrapped: %w", &quic.TransportError{ErrorCode: quic.NoViablePathError}), true},
+		{quic.ErrPathNotValidated, true},
+		{&quic.TransportError{ErrorCode: quic.ProtocolViolation}, false},
+		{&quic.IdleTimeoutError{}, false},
+		{errors.New("connection refused"), false},
+	}
+	for _, tt := range tests {
+		if got := isQUICPathFailure(tt.err); got != tt.want {
+			t.Errorf("isQUICPathFailure(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestCanReplayRequest(t *testing.T) {
+	tests := []struct {
+		req  *Request
+		want bool
+	}{
+		{&Request{Method: "GET"}, true},
+		{&Request{Method: "PUT", Body: []byte("x")}, true},
+		{&Request{Method: "POST", Body: []byte("x")}, false},
+		{&Request{Method: "PUT", BodyReader: strings.NewReader("x")}, false},
+		{&Request{Method: "GET", BodyReader: io.LimitReader(nil, 0)}, false},
+	}
+	for _, tt := range tests {
+		if got := canReplayRequest(tt.req); got != tt.want {
+			t.Errorf("canReplayRequest(%s) = %v, want %v", tt.req.Method, got, tt.want)
+		}
+	}
+}
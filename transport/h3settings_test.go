@@ -0,0 +1,29 @@
+package transport
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/sardanioss/httpcloak/fingerprint"
+)
+
+func TestCustomH3Settings(t *testing.T) {
+	settings := fingerprint.H3Settings{QPACKMaxTableCapacity: 4096, QPACKBlockedStreams: 20}
+	tr := NewTransportWithConfig("chrome-latest", nil, &TransportConfig{CustomH3Settings: &settings})
+	defer tr.Close()
+
+	check := func(when string) {
+		t.Helper()
+		if tr.h3Transport == nil {
+			t.Fatalf("%s: no HTTP/3 transport", when)
+		}
+		h3 := tr.h3Transport.transport
+		want := map[uint64]uint64{fingerprint.H3SettingQPACKMaxTableCapacity: 4096, fingerprint.H3SettingQPACKBlockedStreams: 20}
+		if !reflect.DeepEqual(h3.AdditionalSettings, want) || h3.SendGreaseFrames {
+			t.Errorf("%s: AdditionalSettings = %v, SendGreaseFrames = %v", when, h3.AdditionalSettings, h3.SendGreaseFrames)
+		}
+	}
+	check("new transport")
+	tr.SetPreset("chrome-latest")
+	check("after SetPreset")
+}
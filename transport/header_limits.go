@@ -0,0 +1,221 @@
+package transport
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrHeaderLimit represents a response header block over a configured limit
+var ErrHeaderLimit = errors.New("response header limit exceeded")
+
+// HeaderLimits bounds the response header block of one protocol. Zero
+// fields use the defaults (DefaultHeaderLimits).
+type HeaderLimits struct {
+	// MaxBytes is the largest header block: the raw head (status line
+	// included) on HTTP/1, the field section size on HTTP/2 and HTTP/3
+	MaxBytes int
+
+	// MaxCount is the largest number of header fields
+	MaxCount int
+
+	// MaxLineLength is the longest single header line on HTTP/1, or name
+	// plus value on HTTP/2 and HTTP/3
+	MaxLineLength int
+}
+
+// ResponseHeaderLimits are the response header limits per protocol
+type ResponseHeaderLimits struct {
+	HTTP1 HeaderLimits
+	HTTP2 HeaderLimits
+	HTTP3 HeaderLimits
+}
+
+// DefaultHeaderLimits are the limits used for unset HeaderLimits fields.
+// MaxBytes is Chrome's limit (ERR_RESPONSE_HEADERS_TOO_BIG and
+// MAX_FIELD_SECTION_SIZE), so no response a browser accepts is refused.
+var DefaultHeaderLimits = HeaderLimits{
+	MaxBytes:      256 << 10,
+	MaxCount:      1000,
+	MaxLineLength: 128 << 10,
+}
+
+// HeaderLimitError is returned when a response header block exceeds a
+// limit in TransportConfig.HeaderLimits. It is never retried.
+type HeaderLimitError struct {
+	Protocol string // h1, h2 or h3
+	Limit    string // "bytes", "count" or "line"
+	Max      int    // Configured limit
+	Actual   int    // Size seen, 0 when the decoder stopped before counting
+	Err      error  // Underlying decoder error, if any
+}
+
+func (e *HeaderLimitError) Error() string {
+	if e.Actual == 0 {
+		return fmt.Sprintf("%s response header %s over limit %d", e.Protocol, e.Limit, e.Max)
+	}
+	return fmt.Sprintf("%s response header %s %d over limit %d", e.Protocol, e.Limit, e.Actual, e.Max)
+}
+
+func (e *HeaderLimitError) Unwrap() error {
+	return e.Err
+}
+
+func (e *HeaderLimitError) Is(target error) bool {
+	return target == ErrHeaderLimit
+}
+
+// headerLimits returns the limits for proto with defaults filled in
+func headerLimits(config *TransportConfig, proto string) HeaderLimits {
+	var limits HeaderLimits
+	if config != nil && config.HeaderLimits != nil {
+		switch proto {
+		case "h1":
+			limits = config.HeaderLimits.HTTP1
+		case "h2":
+			limits = config.HeaderLimits.HTTP2
+		case "h3":
+			limits = config.HeaderLimits.HTTP3
+		}
+	}
+	if limits.MaxBytes <= 0 {
+		limits.MaxBytes = DefaultHeaderLimits.MaxBytes
+	}
+	if limits.MaxCount <= 0 {
+		limits.MaxCount = DefaultHeaderLimits.MaxCount
+	}
+	if limits.MaxLineLength <= 0 {
+		limits.MaxLineLength = DefaultHeaderLimits.MaxLineLength
+	}
+	return limits
+}
+
+// checkHeaderLimits applies the count and line limits to decoded HTTP/2
+// and HTTP/3 headers. Their byte limit is enforced by the decoders.
+func checkHeaderLimits(proto string, headers map[string][]string, limits HeaderLimits) error {
+	count := 0
+	for name, values := range headers {
+		for _, v := range values {
+			count++
+			if n := len(name) + len(v); n > limits.MaxLineLength {
+				return &HeaderLimitError{Protocol: proto, Limit: "line", Max: limits.MaxLineLength, Actual: n}
+			}
+		}
+	}
+	if count > limits.MaxCount {
+		return &HeaderLimitError{Protocol: proto, Limit: "count", Max: limits.MaxCount, Actual: count}
+	}
+	return nil
+}
+
+// headerLimitError turns the HTTP/2 and HTTP/3 decoders' size errors into
+// a *HeaderLimitError
+func headerLimitError(config *TransportConfig, err error) error {
+	if err == nil || errors.Is(err, ErrHeaderLimit) {
+		return err
+	}
+	var proto string
+	switch msg := err.Error(); {
+	case strings.Contains(msg, "http2: response header list larger than advertised limit"):
+		proto = "h2"
+	case strings.Contains(msg, "http3: HEADERS frame too large"):
+		proto = "h3"
+	default:
+		return err
+	}
+	return &HeaderLimitError{Protocol: proto, Limit: "bytes", Max: headerLimits(config, proto).MaxBytes, Err: err}
+}
+
+// headScanner checks an HTTP/1 response head against HeaderLimits as its
+// bytes arrive
+type headScanner struct {
+	limits    HeaderLimits
+	scanned   int // Bytes of the head checked so far
+	lineStart int
+	lines     int
+}
+
+// scan checks head from where the last call stopped and reports whether
+// head ends with the empty line closing the head. head must extend the
+// head of earlier calls.
+func (s *headScanner) scan(head []byte) (bool, error) {
+	for ; s.scanned < len(head); s.scanned++ {
+		if s.scanned+1 > s.limits.MaxBytes {
+			return false, &HeaderLimitError{Protocol: "h1", Limit: "bytes", Max: s.limits.MaxBytes, Actual: s.scanned + 1}
+		}
+		if head[s.scanned] != '\n' {
+			if s.scanned-s.lineStart >= s.limits.MaxLineLength+1 {
+				return false, &HeaderLimitError{Protocol: "h1", Limit: "line", Max: s.limits.MaxLineLength}
+			}
+			continue
+		}
+		line := head[s.lineStart:s.scanned]
+		start := s.lineStart
+		s.lineStart = s.scanned + 1
+		if len(line) == 0 || len(line) == 1 && line[0] == '\r' {
+			if start > 0 {
+				s.scanned++
+				return true, nil
+			}
+			continue
+		}
+		if n := len(strings.TrimSuffix(string(line), "\r")); n > s.limits.MaxLineLength {
+			return false, &HeaderLimitError{Protocol: "h1", Limit: "line", Max: s.limits.MaxLineLength, Actual: n}
+		}
+		// The status line is not a header field
+		if start > 0 {
+			s.lines++
+			if s.lines > s.limits.MaxCount {
+				return false, &HeaderLimitError{Protocol: "h1", Limit: "count", Max: s.limits.MaxCount, Actual: s.lines}
+			}
+		}
+	}
+	return false, nil
+}
+
+// checkResponseHead checks the response head waiting on br against limits.
+// A head that fits br's buffer is only peeked at and stays in br, so the
+// usual case costs no copy; a longer head is read out and returned, and the
+// response must be parsed from it followed by br. Strict conformance always
+// wants the raw head, so readAll reads it out even when it fits.
+func checkResponseHead(br *bufio.Reader, limits HeaderLimits, readAll bool) ([]byte, error) {
+	s := &headScanner{limits: limits}
+	if !readAll {
+		for {
+			// Check what is buffered, or wait for more once that is checked
+			n := br.Buffered()
+			if n <= s.scanned {
+				n = s.scanned + 1
+			}
+			buf, err := br.Peek(min(n, br.Size()))
+			done, limitErr := s.scan(buf)
+			if limitErr != nil {
+				return nil, limitErr
+			}
+			if done || err != nil {
+				// Read errors are left for the response parser to report
+				return nil, nil
+			}
+			if len(buf) == br.Size() {
+				break
+			}
+		}
+	}
+
+	var head []byte
+	for {
+		chunk, err := br.ReadSlice('\n')
+		head = append(head, chunk...)
+		done, limitErr := s.scan(head)
+		if limitErr != nil {
+			return nil, limitErr
+		}
+		if done {
+			return head, nil
+		}
+		if err != nil && err != bufio.ErrBufferFull {
+			return nil, err
+		}
+	}
+}
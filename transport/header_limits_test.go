@@ -0,0 +1,107 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestHeadScanner(t *testing.T) {
+	limits := HeaderLimits{MaxBytes: 200, MaxCount: 3, MaxLineLength: 40}
+	tests := []struct {
+		head  string
+		limit string // "" when the head is within limits
+	}{
+		{"HTTP/1.1 200 OK\r\nA: 1\r\nB: 2\r\nC: 3\r\n\r\n", ""},
+		{"HTTP/1.1 200 OK\nA: 1\n\n", ""},
+		{"HTTP/1.1 200 OK\r\nA: 1\r\nB: 2\r\nC: 3\r\nD: 4\r\n\r\n", "count"},
+		{"HTTP/1.1 200 OK\r\nA: " + strings.Repeat("x", 40) + "\r\n\r\n", "line"},
+		{"HTTP/1.1 200 OK\r\nA: " + strings.Repeat("x", 300), "line"},
+		{"HTTP/1.1 200 OK\r\n" + strings.Repeat("A: "+strings.Repeat("x", 30)+"\r\n", 3) + "B: " + strings.Repeat("x", 30) + "\r\n", "count"},
+	}
+	for _, tt := range tests {
+		s := &headScanner{limits: limits}
+		done, err := s.scan([]byte(tt.head))
+		var hle *HeaderLimitError
+		switch {
+		case tt.limit == "" && (err != nil || !done):
+			t.Errorf("%q: done=%v err=%v, want a complete head", tt.head, done, err)
+		case tt.limit != "" && (!errors.As(err, &hle) || hle.Limit != tt.limit):
+			t.Errorf("%q: err = %v, want a %s limit error", tt.head, err, tt.limit)
+		}
+	}
+
+	s := &headScanner{limits: HeaderLimits{MaxBytes: 64, MaxCount: 100, MaxLineLength: 100}}
+	if _, err := s.scan([]byte("HTTP/1.1 200 OK\r\n" + strings.Repeat("A: 1\r\n", 20))); !errors.Is(err, ErrHeaderLimit) {
+		t.Errorf("err = %v, want the byte limit", err)
+	}
+}
+
+func TestCheckHeaderLimits(t *testing.T) {
+	limits := HeaderLimits{MaxBytes: 1 << 10, MaxCount: 2, MaxLineLength: 16}
+	if err := checkHeaderLimits("h2", map[string][]string{"a": {"1", "2"}}, limits); err != nil {
+		t.Errorf("err = %v", err)
+	}
+	if err := checkHeaderLimits("h2", map[string][]string{"a": {"1", "2"}, "b": {"3"}}, limits); !errors.Is(err, ErrHeaderLimit) {
+		t.Errorf("err = %v, want the count limit", err)
+	}
+	if err := checkHeaderLimits("h3", map[string][]string{"a": {strings.Repeat("x", 16)}}, limits); !errors.Is(err, ErrHeaderLimit) {
+		t.Errorf("err = %v, want the line limit", err)
+	}
+
+	err := headerLimitError(nil, fmt.Errorf("roundtrip: %w", errors.New("http2: response header list larger than advertised limit")))
+	var hle *HeaderLimitError
+	if !errors.As(err, &hle) || hle.Protocol != "h2" || hle.Max != DefaultHeaderLimits.MaxBytes {
+		t.Errorf("err = %v, want an h2 *HeaderLimitError", err)
+	}
+}
+
+func TestHTTP1HeaderLimits(t *testing.T) {
+	// 100KB of headers: past the 64KB connection buffer but within the
+	// default limits
+	var big strings.Builder
+	big.WriteString("HTTP/1.1 200 OK\r\nContent-Length: 2\r\n")
+	for i := 0; i < 100; i++ {
+		fmt.Fprintf(&big, "X-Filler-%d: %s\r\n", i, strings.Repeat("x", 1000))
+	}
+	big.WriteString("\r\nok")
+	seen := make(chan *http.Request, 8)
+	url := rawH1Server(t, big.String(), seen)
+
+	do := func(limits *ResponseHeaderLimits, strict bool) (*Response, error) {
+		tr := NewTransportWithConfig("chrome-latest", nil, &TransportConfig{HeaderLimits: limits, StrictConformance: strict})
+		t.Cleanup(func() { tr.Close() })
+		resp, err := tr.Do(context.Background(), &Request{Method: "GET", URL: url})
+		<-seen
+		return resp, err
+	}
+
+	for _, strict := range []bool{false, true} {
+		resp, err := do(nil, strict)
+		if err != nil {
+			t.Fatalf("strict=%v: %v", strict, err)
+		}
+		if body, _ := resp.Bytes(); string(body) != "ok" || len(resp.Headers["x-filler-99"]) != 1 {
+			t.Errorf("strict=%v: body = %q, headers = %d", strict, body, len(resp.Headers))
+		}
+	}
+
+	tests := []struct {
+		limits HeaderLimits
+		limit  string
+	}{
+		{HeaderLimits{MaxBytes: 32 << 10}, "bytes"},
+		{HeaderLimits{MaxCount: 50}, "count"},
+		{HeaderLimits{MaxLineLength: 512}, "line"},
+	}
+	for _, tt := range tests {
+		_, err := do(&ResponseHeaderLimits{HTTP1: tt.limits}, false)
+		var hle *HeaderLimitError
+		if !errors.As(err, &hle) || hle.Limit != tt.limit || hle.Protocol != "h1" {
+			t.Errorf("%+v: err = %v, want an h1 %s *HeaderLimitError", tt.limits, err, tt.limit)
+		}
+	}
+}
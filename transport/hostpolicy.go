@@ -0,0 +1,305 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/sardanioss/httpcloak/dns"
+)
+
+// HostPolicy restricts which hosts a transport may connect to.
+// It is checked before dialing for every request, so redirects and
+// Warmup subresources are covered too.
+//
+// Patterns can be:
+//   - exact hostnames: "api.example.com"
+//   - wildcard subdomains: "*.example.com" (matches example.com and any subdomain)
+//   - IP addresses: "169.254.169.254"
+//   - CIDR ranges: "10.0.0.0/8", "fd00::/8"
+//
+// Deny patterns always win. When the allow list is non-empty, a host must match
+// at least one allow pattern. IP and CIDR patterns are matched against the resolved
+// addresses of the connection host, so a hostname pointing at an internal
+// range is blocked as well.
+type HostPolicy struct {
+	allow []hostPattern
+	deny  []hostPattern
+
+	// needsDNS is set when any pattern must be matched against resolved IPs
+	needsDNS bool
+}
+
+// hostPattern is a single compiled allow/deny entry
+type hostPattern struct {
+	host     string     // Lowercase hostname (without "*." prefix for wildcards)
+	wildcard bool       // Match subdomains of host
+	network  *net.IPNet // Non-nil for IP/CIDR patterns
+}
+
+// NewHostPolicy compiles allow and deny patterns into a HostPolicy.
+// Returns an error if a CIDR pattern is malformed.
+func NewHostPolicy(allow, deny []string) (*HostPolicy, error) {
+	p := &HostPolicy{}
+	var err error
+	if p.allow, err = compileHostPatterns(allow); err != nil {
+		return nil, err
+	}
+	if p.deny, err = compileHostPatterns(deny); err != nil {
+		return nil, err
+	}
+	p.needsDNS = hasNetworkPattern(p.allow) || hasNetworkPattern(p.deny)
+	return p, nil
+}
+
+func hasNetworkPattern(patterns []hostPattern) bool {
+	for _, pattern := range patterns {
+		if pattern.network != nil {
+			return true
+		}
+	}
+	return false
+}
+
+func compileHostPatterns(patterns []string) ([]hostPattern, error) {
+	compiled := make([]hostPattern, 0, len(patterns))
+	for _, raw := range patterns {
+		pattern := strings.ToLower(strings.TrimSpace(raw))
+		if pattern == "" {
+			continue
+		}
+
+		if strings.Contains(pattern, "/") {
+			_, network, err := net.ParseCIDR(pattern)
+			if err != nil {
+				return nil, fmt.Errorf("invalid host pattern %q: %w", raw, err)
+			}
+			compiled = append(compiled, hostPattern{network: network})
+			continue
+		}
+
+		if ip := net.ParseIP(strings.Trim(pattern, "[]")); ip != nil {
+			bits := 128
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 32
+			}
+			compiled = append(compiled, hostPattern{network: &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}})
+			continue
+		}
+
+		if strings.HasPrefix(pattern, "*.") {
+			compiled = append(compiled, hostPattern{host: strings.TrimSuffix(pattern[2:], "."), wildcard: true})
+			continue
+		}
+		compiled = append(compiled, hostPattern{host: strings.TrimSuffix(pattern, ".")})
+	}
+	return compiled, nil
+}
+
+// matchesHost reports whether the pattern matches a hostname
+func (hp hostPattern) matchesHost(host string) bool {
+	if hp.network != nil {
+		return false
+	}
+	if host == hp.host {
+		return true
+	}
+	return hp.wildcard && strings.HasSuffix(host, "."+hp.host)
+}
+
+// matchesIP reports whether the pattern matches an address
+func (hp hostPattern) matchesIP(ip net.IP) bool {
+	return hp.network != nil && hp.network.Contains(ip)
+}
+
+// Check returns an error wrapping ErrHostBlocked if requests to host are not permitted.
+// connectHost is the host actually dialed (differs from host with ConnectTo mappings).
+// The resolver is only used when the policy contains IP or CIDR patterns.
+func (p *HostPolicy) Check(ctx context.Context, host, connectHost string, resolver *dns.Cache) error {
+	if p == nil {
+		return nil
+	}
+
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	connectHost = strings.TrimSuffix(strings.ToLower(connectHost), ".")
+	if connectHost == "" {
+		connectHost = host
+	}
+
+	var ips []net.IP
+	if ip := net.ParseIP(connectHost); ip != nil {
+		ips = []net.IP{ip}
+	} else if p.needsDNS {
+		if resolver == nil {
+			resolver = dns.NewCache()
+		}
+		resolved, err := resolver.Resolve(ctx, connectHost)
+		if err != nil {
+			// Fail closed: without addresses we can't prove the host is safe
+			return fmt.Errorf("%w: %s: cannot resolve for policy check: %v", ErrHostBlocked, host, err)
+		}
+		ips = resolved
+	}
+
+	for _, pattern := range p.deny {
+		if pattern.matchesHost(host) || pattern.matchesHost(connectHost) {
+			return fmt.Errorf("%w: %s matches deny list", ErrHostBlocked, host)
+		}
+		for _, ip := range ips {
+			if pattern.matchesIP(ip) {
+				return fmt.Errorf("%w: %s resolves to denied address %s", ErrHostBlocked, host, ip)
+			}
+		}
+	}
+
+	if len(p.allow) == 0 {
+		return nil
+	}
+	for _, pattern := range p.allow {
+		if pattern.matchesHost(host) {
+			return nil
+		}
+	}
+	// Every resolved address must fall inside an allowed range
+	if len(ips) > 0 {
+		allAllowed := true
+		for _, ip := range ips {
+			allowed := false
+			for _, pattern := range p.allow {
+				if pattern.matchesIP(ip) {
+					allowed = true
+					break
+				}
+			}
+			if !allowed {
+				allAllowed = false
+				break
+			}
+		}
+		if allAllowed {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s is not in allow list", ErrHostBlocked, host)
+}
+
+// privateNetworks are the ranges blocked by SSRF protection: loopback, RFC 1918,
+// carrier-grade NAT, link-local (including cloud metadata at 169.254.169.254),
+// unique-local IPv6, local-use NAT64, multicast and reserved space.
+var privateNetworks = func() []*net.IPNet {
+	cidrs := []string{
+		"0.0.0.0/8",
+		"10.0.0.0/8",
+		"100.64.0.0/10",
+		"127.0.0.0/8",
+		"169.254.0.0/16",
+		"172.16.0.0/12",
+		"192.0.0.0/24",
+		"192.168.0.0/16",
+		"198.18.0.0/15",
+		"224.0.0.0/4",
+		"240.0.0.0/4",
+		"::/128",
+		"::1/128",
+		"64:ff9b:1::/48",
+		"fc00::/7",
+		"fe80::/10",
+		"ff00::/8",
+	}
+	networks := make([]*net.IPNet, len(cidrs))
+	for i, cidr := range cidrs {
+		_, networks[i], _ = net.ParseCIDR(cidr)
+	}
+	return networks
+}()
+
+// Translation prefixes that carry an IPv4 address the packets end up at
+var (
+	_, nat64Prefix, _ = net.ParseCIDR("64:ff9b::/96") // NAT64 well-known prefix, IPv4 in the last 32 bits (RFC 6052)
+	_, sixToFour, _   = net.ParseCIDR("2002::/16")    // 6to4, IPv4 in bits 16-47 (RFC 3056)
+)
+
+// IsPrivateAddress reports whether ip is in a range blocked by SSRF protection.
+// IPv4-mapped IPv6 addresses are checked as IPv4, as are NAT64 and 6to4
+// addresses, by the IPv4 address they embed.
+func IsPrivateAddress(ip net.IP) bool {
+	switch {
+	case nat64Prefix.Contains(ip):
+		ip = ip[12:16]
+	case sixToFour.Contains(ip):
+		ip = ip[2:6]
+	}
+	for _, network := range privateNetworks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ssrfAddressFilter is installed on the DNS cache when SSRF protection is on
+func ssrfAddressFilter(host string, ip net.IP) error {
+	if IsPrivateAddress(ip) {
+		return fmt.Errorf("%w: %s resolves to private address %s", ErrHostBlocked, host, ip)
+	}
+	return nil
+}
+
+// SetSSRFProtection blocks connections to private, loopback, link-local and
+// cloud metadata addresses. The check runs on the addresses returned by DNS,
+// which are the same addresses that get dialed, so DNS rebinding can't slip an
+// internal address past it.
+//
+// With a proxy configured the proxy resolves the target itself; the target is
+// then resolved locally and checked before the request is sent, which can't
+// rule out the proxy seeing a different answer.
+func (t *Transport) SetSSRFProtection(enabled bool) {
+	t.hostPolicyMu.Lock()
+	t.ssrfProtection = enabled
+	t.hostPolicyMu.Unlock()
+
+	if enabled {
+		t.dnsCache.SetAddressFilter(ssrfAddressFilter)
+	} else {
+		t.dnsCache.SetAddressFilter(nil)
+	}
+}
+
+// SetHostPolicy sets the allow/deny policy enforced before every request.
+// Pass nil to remove the policy.
+func (t *Transport) SetHostPolicy(policy *HostPolicy) {
+	t.hostPolicyMu.Lock()
+	defer t.hostPolicyMu.Unlock()
+	t.hostPolicy = policy
+}
+
+// checkHostPolicy enforces the configured host policy and, for proxied
+// requests, SSRF protection for a request URL
+func (t *Transport) checkHostPolicy(ctx context.Context, rawURL string) error {
+	t.hostPolicyMu.RLock()
+	policy := t.hostPolicy
+	ssrfProtection := t.ssrfProtection
+	t.hostPolicyMu.RUnlock()
+	if policy == nil && !ssrfProtection {
+		return nil
+	}
+
+	host := extractHost(rawURL)
+	connectHost := t.config.GetConnectHost(host)
+	if err := policy.Check(ctx, host, connectHost, t.dnsCache); err != nil {
+		return NewRequestError("host_policy", host, "", "", err)
+	}
+
+	// Direct connections are checked at resolution time; proxies resolve remotely
+	if ssrfProtection && t.proxy != nil && (t.proxy.URL != "" || t.proxy.TCPProxy != "" || t.proxy.UDPProxy != "") {
+		if _, err := t.dnsCache.Resolve(ctx, connectHost); err != nil {
+			if errors.Is(err, ErrHostBlocked) {
+				return NewRequestError("host_policy", host, "", "", err)
+			}
+			return NewRequestError("host_policy", host, "", "", fmt.Errorf("%w: %s: cannot resolve for SSRF check: %v", ErrHostBlocked, host, err))
+		}
+	}
+	return nil
+}
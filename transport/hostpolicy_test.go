@@ -0,0 +1,104 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+)
+
+func TestHostPolicy(t *testing.T) {
+	policy, err := NewHostPolicy(
+		[]string{"*.example.com", "203.0.113.0/24"},
+		[]string{"internal.example.com", "169.254.169.254", "10.0.0.0/8"},
+	)
+	if err != nil {
+		t.Fatalf("NewHostPolicy failed: %v", err)
+	}
+
+	// Hostname patterns only, so no DNS lookups are needed
+	namePolicy, err := NewHostPolicy([]string{"*.example.com"}, []string{"internal.example.com"})
+	if err != nil {
+		t.Fatalf("NewHostPolicy failed: %v", err)
+	}
+	for _, tt := range []struct {
+		host    string
+		allowed bool
+	}{
+		{"example.com", true},
+		{"api.example.com", true},
+		{"API.Example.com.", true},
+		{"internal.example.com", false},
+		{"notexample.com", false},
+	} {
+		err := namePolicy.Check(context.Background(), tt.host, "", nil)
+		if tt.allowed && err != nil {
+			t.Errorf("%s: expected allowed, got %v", tt.host, err)
+		}
+		if !tt.allowed && !errors.Is(err, ErrHostBlocked) {
+			t.Errorf("%s: expected ErrHostBlocked, got %v", tt.host, err)
+		}
+	}
+
+	tests := []struct {
+		host    string
+		connect string
+		allowed bool
+	}{
+		{"203.0.113.7", "", true},
+		{"169.254.169.254", "", false},
+		{"10.1.2.3", "", false},
+		{"api.example.com", "10.0.0.5", false}, // ConnectTo into a denied range
+	}
+
+	for _, tt := range tests {
+		err := policy.Check(context.Background(), tt.host, tt.connect, nil)
+		if tt.allowed && err != nil {
+			t.Errorf("%s (connect %q): expected allowed, got %v", tt.host, tt.connect, err)
+		}
+		if !tt.allowed && !errors.Is(err, ErrHostBlocked) {
+			t.Errorf("%s (connect %q): expected ErrHostBlocked, got %v", tt.host, tt.connect, err)
+		}
+	}
+}
+
+func TestHostPolicy_InvalidCIDR(t *testing.T) {
+	if _, err := NewHostPolicy(nil, []string{"10.0.0.0/99"}); err == nil {
+		t.Error("Expected error for invalid CIDR pattern")
+	}
+}
+
+func TestIsPrivateAddress(t *testing.T) {
+	private := []string{
+		"10.0.0.1", "172.16.5.4", "192.168.1.1", "127.0.0.1", "169.254.169.254", "100.64.0.1",
+		"::1", "fd00:ec2::254", "fe80::1", "::ffff:10.0.0.1",
+		// NAT64 and 6to4 reach the IPv4 address they embed
+		"64:ff9b::127.0.0.1", "64:ff9b::a9fe:a9fe", "64:ff9b::10.1.2.3", "64:ff9b:1::8.8.8.8",
+		"2002:7f00:1::", "2002:a9fe:a9fe::1", "2002:c0a8:101:1::1",
+	}
+	public := []string{
+		"1.1.1.1", "8.8.8.8", "203.0.113.1", "2606:4700:4700::1111",
+		"64:ff9b::8.8.8.8", "2002:808:808::1",
+	}
+
+	for _, addr := range private {
+		if !IsPrivateAddress(net.ParseIP(addr)) {
+			t.Errorf("Expected %s to be private", addr)
+		}
+	}
+	for _, addr := range public {
+		if IsPrivateAddress(net.ParseIP(addr)) {
+			t.Errorf("Expected %s to be public", addr)
+		}
+	}
+}
+
+func TestSSRFProtection_BlocksResolvedAddress(t *testing.T) {
+	tr := NewTransportWithConfig("chrome-latest", nil, &TransportConfig{SSRFProtection: true})
+	defer tr.Close()
+
+	_, err := tr.GetDNSCache().Resolve(context.Background(), "127.0.0.1")
+	if !errors.Is(err, ErrHostBlocked) {
+		t.Errorf("Expected ErrHostBlocked for loopback, got %v", err)
+	}
+}
@@ -0,0 +1,111 @@
+package transport
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// rawH1Server answers every connection with response, read until close,
+// and hands each request it got to seen
+func rawH1Server(t *testing.T, response string, seen chan<- *http.Request) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				req, err := http.ReadRequest(bufio.NewReader(conn))
+				if err != nil {
+					return
+				}
+				body, _ := io.ReadAll(req.Body)
+				req.Body = io.NopCloser(strings.NewReader(string(body)))
+				seen <- req
+				io.WriteString(conn, response)
+			}()
+		}
+	}()
+	return "http://" + ln.Addr().String()
+}
+
+// unsizedBody hides the length of a body so it would be sent chunked
+func unsizedBody(s string) io.Reader {
+	return io.MultiReader(strings.NewReader(s))
+}
+
+func TestHTTP10Request(t *testing.T) {
+	seen := make(chan *http.Request, 4)
+	url := rawH1Server(t, "HTTP/1.0 200 OK\r\nContent-Type: text/plain\r\n\r\nhello", seen)
+
+	tr := NewTransport("chrome-latest")
+	defer tr.Close()
+
+	resp, err := tr.Do(context.Background(), &Request{Method: "POST", URL: url + "/cgi", BodyReader: unsizedBody("a=1"), HTTP10: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body, _ := resp.Bytes(); string(body) != "hello" {
+		t.Errorf("body = %q, want the bytes up to the close", body)
+	}
+	req := <-seen
+	if req.Proto != "HTTP/1.0" {
+		t.Errorf("request proto = %s, want HTTP/1.0", req.Proto)
+	}
+	if len(req.TransferEncoding) > 0 || req.ContentLength != 3 {
+		t.Errorf("body framing = %v / %d, want Content-Length: 3", req.TransferEncoding, req.ContentLength)
+	}
+	if got := req.Header.Get("Connection"); got != "close" {
+		t.Errorf("Connection = %q, want close", got)
+	}
+
+	// The origin answered with HTTP/1.0, so later HTTP/1.1 uploads to it
+	// are not chunked either
+	resp, err = tr.Do(context.Background(), &Request{Method: "POST", URL: url + "/cgi", BodyReader: unsizedBody("b=2")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Close()
+	req = <-seen
+	if req.Proto != "HTTP/1.1" || len(req.TransferEncoding) > 0 || req.ContentLength != 3 {
+		t.Errorf("request to HTTP/1.0 origin = %s %v / %d, want HTTP/1.1 with Content-Length: 3", req.Proto, req.TransferEncoding, req.ContentLength)
+	}
+}
+
+func TestHTTP11CloseDelimitedBody(t *testing.T) {
+	seen := make(chan *http.Request, 4)
+	url := rawH1Server(t, "HTTP/1.1 200 OK\r\nContent-Type: text/plain\r\n\r\nuntil close", seen)
+
+	tr := NewTransport("chrome-latest")
+	defer tr.Close()
+
+	for i := 0; i < 2; i++ {
+		resp, err := tr.Do(context.Background(), &Request{Method: "GET", URL: url})
+		if err != nil {
+			t.Fatalf("request %d: %v", i, err)
+		}
+		if body, _ := resp.Bytes(); string(body) != "until close" {
+			t.Errorf("request %d: body = %q", i, body)
+		}
+		<-seen
+	}
+
+	tr.h1Transport.idleConnsMu.Lock()
+	defer tr.h1Transport.idleConnsMu.Unlock()
+	for key, conns := range tr.h1Transport.idleConns {
+		if len(conns) > 0 {
+			t.Errorf("%s: %d connections pooled after a body delimited by close", key, len(conns))
+		}
+	}
+}
@@ -2,17 +2,23 @@ package transport
 
 import (
 	"bufio"
+	"bytes"
 	"context"
+	crand "crypto/rand"
 	tls "github.com/sardanioss/utls"
+	"encoding/binary"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"io"
 	"net"
 	http "github.com/sardanioss/http"
 	"net/textproto"
 	"net/url"
+	"slices"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/sardanioss/httpcloak/dns"
@@ -39,10 +45,34 @@ type HTTP1Transport struct {
 	// Configuration
 	maxIdleConnsPerHost int
 	maxIdleTime         time.Duration
+	maxConnAge          time.Duration // 0 means no limit
 	connectTimeout      time.Duration
 	responseTimeout     time.Duration
 	insecureSkipVerify  bool
 	localAddr           string // Local IP to bind outgoing connections
+	shuffleSeed         int64  // Extension order seed when config.ExtensionControl is set
+
+	// Set once a handshake has matched config.TargetJA4
+	ja4Verified atomic.Bool
+
+	// Revocation status of each host's certificate (config.RevocationCheck)
+	revocation revocationStatuses
+
+	// TLS fingerprints of each host's latest handshake
+	fingerprints tlsFingerprints
+
+	// Origins (scheme://host:port) that answered with HTTP/1.0, which don't
+	// understand chunked request bodies
+	http10Origins sync.Map
+
+	// Idle timeouts servers were seen to enforce, per pool key
+	idleScores idleScoreboard
+
+	// Shared PoolLimits.MaxConns limiter, nil without one
+	limiter *connLimiter
+
+	// Transport's per-host connection stats, nil when used standalone
+	connStats *connStatsTable
 
 	// Cleanup
 	stopCleanup chan struct{}
@@ -61,6 +91,7 @@ type http1Conn struct {
 	createdAt  time.Time
 	lastUsedAt time.Time
 	useCount   int64
+	release    func() // Frees the connection's limiter slot and stats entry, nil when it has none
 	mu         sync.Mutex
 	closed     bool
 }
@@ -97,13 +128,18 @@ func NewHTTP1TransportWithConfig(preset *fingerprint.Preset, dnsCache *dns.Cache
 		config:              config,
 		idleConns:           make(map[string][]*http1Conn),
 		sessionCache:        sessionCache,
-		maxIdleConnsPerHost: 6, // Browser-like limit
-		maxIdleTime:         90 * time.Second,
+		maxIdleConnsPerHost: maxIdleConnsPerHost(config),
+		maxIdleTime:         idleTime(config),
+		maxConnAge:          maxConnAge(config, 0),
 		connectTimeout:      30 * time.Second,
 		responseTimeout:     60 * time.Second,
 		stopCleanup:         make(chan struct{}),
 	}
 
+	var seedBytes [8]byte
+	crand.Read(seedBytes[:])
+	t.shuffleSeed = int64(binary.LittleEndian.Uint64(seedBytes[:]))
+
 	// Apply localAddr from config
 	if config != nil && config.LocalAddr != "" {
 		t.localAddr = config.LocalAddr
@@ -180,6 +216,7 @@ func (t *HTTP1Transport) RoundTrip(req *http.Request) (*http.Response, error) {
 	// Try to get an idle connection
 	conn, err := t.getIdleConn(key)
 	if err == nil && conn != nil {
+		idle := time.Since(conn.lastUsedAt)
 		resp, err := t.doRequest(conn, req)
 		if err == nil {
 			// Wrap the body to handle connection lifecycle
@@ -195,6 +232,17 @@ func (t *HTTP1Transport) RoundTrip(req *http.Request) (*http.Response, error) {
 		}
 		// Connection failed, close it and try new one
 		conn.close()
+		if isPeerClosed(err) {
+			t.idleScores.closed(key, idle)
+		}
+		if errors.Is(err, ErrHeaderLimit) {
+			// The server answered; a new connection gets the same headers
+			return nil, WrapError("request", host, port, "h1", err)
+		}
+		if errors.Is(err, ErrFirstByteTimeout) {
+			// Retrying is up to the session's policy
+			return nil, err
+		}
 	}
 
 	// Create new connection (pass request host for SNI, connectHost used internally for DNS)
@@ -301,6 +349,11 @@ func (w *pooledBodyWrapper) Close() error {
 	return nil
 }
 
+// abort drops the connection without draining the body
+func (w *pooledBodyWrapper) abort() {
+	w.once.Do(func() { w.conn.close() })
+}
+
 func (w *pooledBodyWrapper) handleClose() {
 	w.once.Do(func() {
 		// Clear deadline before returning conn to pool — the next request
@@ -325,6 +378,11 @@ func (w *streamBodyWrapper) Read(p []byte) (n int, err error) {
 	return w.body.Read(p)
 }
 
+// abort drops the connection without draining the body
+func (w *streamBodyWrapper) abort() {
+	w.conn.close()
+}
+
 func (w *streamBodyWrapper) Close() error {
 	err := w.body.Close()
 	w.conn.close()
@@ -380,9 +438,24 @@ func (t *HTTP1Transport) StreamRoundTrip(req *http.Request) (*http.Response, err
 	return resp, nil
 }
 
-// createConn creates a new HTTP/1.1 connection
-// host is the request host (used for TLS SNI), DNS resolution uses getConnectHost
+// createConn creates a new HTTP/1.1 connection within the connection limit
 func (t *HTTP1Transport) createConn(ctx context.Context, host, port, scheme string) (*http1Conn, error) {
+	release, err := t.limiter.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := t.dialConn(ctx, host, port, scheme)
+	if err != nil {
+		release()
+		return nil, err
+	}
+	conn.release = t.connStats.opened(host, release)
+	return conn, nil
+}
+
+// dialConn dials a new HTTP/1.1 connection
+// host is the request host (used for TLS SNI), DNS resolution uses getConnectHost
+func (t *HTTP1Transport) dialConn(ctx context.Context, host, port, scheme string) (*http1Conn, error) {
 	var rawConn net.Conn
 	var err error
 
@@ -410,6 +483,7 @@ func (t *HTTP1Transport) createConn(ctx context.Context, host, port, scheme stri
 			Timeout:   t.connectTimeout,
 			KeepAlive: 30 * time.Second,
 		}
+		tcpOptions(t.config).applyTo(dialer)
 		if t.localAddr != "" {
 			localIP := net.ParseIP(t.localAddr)
 			dialer.LocalAddr = &net.TCPAddr{IP: localIP}
@@ -459,9 +533,11 @@ func (t *HTTP1Transport) createConn(ctx context.Context, host, port, scheme stri
 
 	// Set TCP options
 	if tcpConn, ok := rawConn.(*net.TCPConn); ok {
-		tcpConn.SetKeepAlive(true)
-		tcpConn.SetKeepAlivePeriod(30 * time.Second)
+		tcpConn.SetKeepAliveConfig(tcpOptions(t.config).keepAlive())
 		tcpConn.SetNoDelay(true)
+		if t.proxy == nil || t.proxy.URL == "" {
+			tcpOptions(t.config).applyConn(tcpConn)
+		}
 	}
 
 	conn := &http1Conn{
@@ -492,19 +568,22 @@ func (t *HTTP1Transport) createConn(ctx context.Context, host, port, scheme stri
 			KeyLogWriter:                       keyLogWriter,
 		}
 		// Only set session cache when not using custom JA3 without PSK extension
-		if t.config == nil || t.config.CustomJA3 == "" || ja3HasExtension(t.config.CustomJA3, "41") {
+		if !hasCustomTLS(t.config) || customTLSHasPSK(t.config) {
 			tlsConfig.ClientSessionCache = t.sessionCache
 		}
+		applyClientCert(t.config, tlsConfig, host)
+		applyCertPinner(t.config, tlsConfig, host)
 
 		// Create TLS connection with appropriate fingerprint
 		var tlsConn *utls.UConn
-		if t.config != nil && t.config.CustomJA3 != "" {
-			// Custom JA3: parse to spec and apply with HelloCustom
-			spec, parseErr := fingerprint.ParseJA3(t.config.CustomJA3, t.config.CustomJA3Extras)
+		if hasCustomTLS(t.config) {
+			// Custom JA3 or raw ClientHello: parse to spec and apply with HelloCustom
+			spec, parseErr := customTLSSpec(t.config)
 			if parseErr != nil {
 				rawConn.Close()
 				return nil, NewTLSError("parse_ja3", host, port, "h1", parseErr)
 			}
+			hostPostQuantum(t.config, host, spec)
 			// Force HTTP/1.1 ALPN in the spec
 			for _, ext := range spec.Extensions {
 				if alpn, ok := ext.(*utls.ALPNExtension); ok {
@@ -517,6 +596,14 @@ func (t *HTTP1Transport) createConn(ctx context.Context, host, port, scheme stri
 				rawConn.Close()
 				return nil, NewTLSError("apply_ja3_preset", host, port, "h1", err)
 			}
+		} else if t.preset.HasTLSOverrides() || needsPresetSpec(t.config, host) {
+			// Custom preset with cipher/ALPN overrides or extension control: rewrite the ClientHelloID's spec
+			var overrideErr error
+			tlsConn, overrideErr = t.newOverriddenTLSConn(rawConn, tlsConfig)
+			if overrideErr != nil {
+				rawConn.Close()
+				return nil, NewTLSError("apply_preset_overrides", host, port, "h1", overrideErr)
+			}
 		} else {
 			// Use preset's ClientHelloID directly
 			// Note: ClientHelloID includes ALPN with [h2, http/1.1], so we must modify it
@@ -540,10 +627,11 @@ func (t *HTTP1Transport) createConn(ctx context.Context, host, port, scheme stri
 		}
 		// Only set session cache for preset path or custom JA3 with PSK extension.
 		// Setting session cache on a spec without PSK extension can cause handshake failures.
-		if t.config == nil || t.config.CustomJA3 == "" || ja3HasExtension(t.config.CustomJA3, "41") {
+		if !hasCustomTLS(t.config) || customTLSHasPSK(t.config) {
 			tlsConn.SetSessionCache(t.sessionCache)
 		}
 
+		handshakeStart := time.Now()
 		if err := tlsConn.HandshakeContext(ctx); err != nil {
 			rawConn.Close()
 
@@ -558,12 +646,13 @@ func (t *HTTP1Transport) createConn(ctx context.Context, host, port, scheme stri
 				}
 
 				// Redo TLS setup on the clean connection
-				if t.config != nil && t.config.CustomJA3 != "" {
-					spec, parseErr := fingerprint.ParseJA3(t.config.CustomJA3, t.config.CustomJA3Extras)
+				if hasCustomTLS(t.config) {
+					spec, parseErr := customTLSSpec(t.config)
 					if parseErr != nil {
 						rawConn.Close()
 						return nil, NewTLSError("parse_ja3", host, port, "h1", parseErr)
 					}
+					hostPostQuantum(t.config, host, spec)
 					for _, ext := range spec.Extensions {
 						if alpn, ok := ext.(*utls.ALPNExtension); ok {
 							alpn.AlpnProtocols = []string{"http/1.1"}
@@ -575,6 +664,13 @@ func (t *HTTP1Transport) createConn(ctx context.Context, host, port, scheme stri
 						rawConn.Close()
 						return nil, NewTLSError("apply_ja3_preset", host, port, "h1", applyErr)
 					}
+				} else if t.preset.HasTLSOverrides() || needsPresetSpec(t.config, host) {
+					var applyErr error
+					tlsConn, applyErr = t.newOverriddenTLSConn(rawConn, tlsConfig)
+					if applyErr != nil {
+						rawConn.Close()
+						return nil, NewTLSError("apply_preset_overrides", host, port, "h1", applyErr)
+					}
 				} else {
 					tlsConn = utls.UClient(rawConn, tlsConfig, t.preset.ClientHelloID)
 					if buildErr := tlsConn.BuildHandshakeState(); buildErr != nil {
@@ -589,7 +685,7 @@ func (t *HTTP1Transport) createConn(ctx context.Context, host, port, scheme stri
 					}
 				}
 				// Only set session cache when not using custom JA3 without PSK extension
-				if t.config == nil || t.config.CustomJA3 == "" || ja3HasExtension(t.config.CustomJA3, "41") {
+				if !hasCustomTLS(t.config) || customTLSHasPSK(t.config) {
 					tlsConn.SetSessionCache(t.sessionCache)
 				}
 				if hsErr := tlsConn.HandshakeContext(ctx); hsErr != nil {
@@ -604,6 +700,17 @@ func (t *HTTP1Transport) createConn(ctx context.Context, host, port, scheme stri
 			}
 		}
 
+		if err := verifyJA4(tlsConn, t.config, &t.ja4Verified, host); err != nil {
+			tlsConn.Close()
+			return nil, err
+		}
+		if err := t.revocation.check(ctx, t.config, t.proxy != nil, host, tlsConn.ConnectionState()); err != nil {
+			tlsConn.Close()
+			return nil, err
+		}
+		t.fingerprints.recordConn(host, tlsConn)
+		t.connStats.handshake(host, tlsConn.ConnectionState().DidResume, time.Since(handshakeStart))
+
 		conn.tlsConn = tlsConn
 		conn.conn = tlsConn
 	}
@@ -616,6 +723,35 @@ func (t *HTTP1Transport) createConn(ctx context.Context, host, port, scheme stri
 	return conn, nil
 }
 
+// newOverriddenTLSConn creates a TLS client from the preset's ClientHelloID with its
+// cipher/ALPN overrides, the config's ExtensionControl and post-quantum settings
+// applied. ALPN is still forced to http/1.1.
+func (t *HTTP1Transport) newOverriddenTLSConn(rawConn net.Conn, tlsConfig *utls.Config) (*utls.UConn, error) {
+	var spec utls.ClientHelloSpec
+	var err error
+	if needsPresetSpec(t.config, tlsConfig.ServerName) {
+		spec, err = presetSpec(t.config, t.preset.ClientHelloID, t.shuffleSeed)
+	} else {
+		spec, err = utls.UTLSIdToSpec(t.preset.ClientHelloID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	t.preset.ApplyTLSOverrides(&spec)
+	hostPostQuantum(t.config, tlsConfig.ServerName, &spec)
+	for _, ext := range spec.Extensions {
+		if alpn, ok := ext.(*utls.ALPNExtension); ok {
+			alpn.AlpnProtocols = []string{"http/1.1"}
+			break
+		}
+	}
+	tlsConn := utls.UClient(rawConn, tlsConfig, utls.HelloCustom)
+	if err := tlsConn.ApplyPreset(&spec); err != nil {
+		return nil, err
+	}
+	return tlsConn, nil
+}
+
 // dialThroughProxy establishes a connection through a proxy
 // Supports both HTTP proxies (HTTP CONNECT) and SOCKS5 proxies (SOCKS5 CONNECT)
 func (t *HTTP1Transport) dialThroughProxy(ctx context.Context, targetHost, targetPort string) (net.Conn, error) {
@@ -637,6 +773,8 @@ func (t *HTTP1Transport) dialThroughSOCKS5(ctx context.Context, targetHost, targ
 	if t.localAddr != "" {
 		socks5Dialer.SetLocalAddr(t.localAddr)
 	}
+	// socks5:// resolves targets with the session's DNS cache and overrides
+	socks5Dialer.SetResolver(t.dnsCache.ResolveAllSorted)
 
 	targetAddr := net.JoinHostPort(targetHost, targetPort)
 	conn, err := socks5Dialer.DialContext(ctx, "tcp", targetAddr)
@@ -691,6 +829,11 @@ func (t *HTTP1Transport) dialThroughHTTPProxy(ctx context.Context, targetHost, t
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to proxy: %w", err)
 	}
+	if proxyURL.Scheme == "https" {
+		if conn, err = dialProxyTLS(ctx, conn, proxyURL, t.config, t.preset); err != nil {
+			return nil, err
+		}
+	}
 
 	// Build CONNECT request
 	targetAddr := net.JoinHostPort(targetHost, targetPort)
@@ -755,6 +898,11 @@ func (t *HTTP1Transport) dialHTTPProxyBlockingFresh(ctx context.Context, targetH
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to proxy: %w", err)
 	}
+	if proxyURL.Scheme == "https" {
+		if conn, err = dialProxyTLS(ctx, conn, proxyURL, t.config, t.preset); err != nil {
+			return nil, err
+		}
+	}
 
 	targetAddr := net.JoinHostPort(targetHost, targetPort)
 	connectReq := fmt.Sprintf("CONNECT %s HTTP/1.1\r\nHost: %s\r\n", targetAddr, targetAddr)
@@ -792,9 +940,17 @@ func (t *HTTP1Transport) dialHTTPProxyBlocking(ctx context.Context, conn net.Con
 	}
 	resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
+	statusCode, status := resp.StatusCode, resp.Status
+	if statusCode == http.StatusProxyAuthRequired {
+		statusCode, status, err = answerProxyAuth(ctx, conn, br, connectReq, resp.Header.Values("Proxy-Authenticate"), t.proxy, t.config, statusCode, status)
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	if statusCode != http.StatusOK {
 		conn.Close()
-		return nil, fmt.Errorf("proxy CONNECT failed: %s", resp.Status)
+		return nil, fmt.Errorf("proxy CONNECT failed: %s", status)
 	}
 
 	// If the bufio.Reader read ahead past the HTTP response (e.g., start of
@@ -840,6 +996,15 @@ func (t *HTTP1Transport) getProxyAuth(proxyURL *url.URL) string {
 	return base64.StdEncoding.EncodeToString([]byte(auth))
 }
 
+// cancelledErr reports the request's context error in place of the I/O
+// error its cancellation caused
+func cancelledErr(req *http.Request, err error) error {
+	if ctxErr := req.Context().Err(); ctxErr != nil {
+		return ctxErr
+	}
+	return err
+}
+
 // doRequest performs the HTTP request on the connection
 func (t *HTTP1Transport) doRequest(conn *http1Conn, req *http.Request) (*http.Response, error) {
 	conn.mu.Lock()
@@ -863,20 +1028,72 @@ func (t *HTTP1Transport) doRequest(conn *http1Conn, req *http.Request) (*http.Re
 	// (body is returned to caller via pooledBodyWrapper). The deadline is
 	// cleared in handleClose() when the body is done and conn returns to pool.
 
+	// Cancelling the request unblocks the write and the wait for the head
+	stop := context.AfterFunc(req.Context(), func() { conn.conn.SetDeadline(time.Now()) })
+	defer stop()
+
 	// Write request
 	if err := t.writeRequest(conn, req); err != nil {
-		return nil, err
+		return nil, cancelledErr(req, err)
+	}
+
+	// The head must arrive within the first-byte timeout; the body may
+	// take until the deadline
+	var fb time.Time
+	if d := firstByteTimeout(req.Context()); d > 0 && time.Now().Add(d).Before(deadline) {
+		fb = time.Now().Add(d)
+		conn.conn.SetReadDeadline(fb)
+		defer conn.conn.SetReadDeadline(deadline)
 	}
 
-	// Read response
-	resp, err := http.ReadResponse(conn.br, req)
+	// Read response. Strict conformance checks the raw head, then parses
+	// it as usual.
+	br := conn.br
+	violations := violationLogFrom(req.Context())
+	head, err := checkResponseHead(conn.br, headerLimits(t.config, "h1"), violations != nil)
 	if err != nil {
-		return nil, err
+		return nil, cancelledErr(req, firstByteErr(req, err, fb))
+	}
+	if head != nil {
+		if violations != nil {
+			violations.add(h1HeadViolations(head)...)
+		}
+		br = bufio.NewReader(io.MultiReader(bytes.NewReader(head), conn.br))
+	}
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		if violations != nil {
+			kind := ViolationHeaderSyntax
+			if strings.Contains(err.Error(), "Content-Length") || strings.Contains(err.Error(), "Transfer-Encoding") {
+				kind = ViolationMessageFraming
+			}
+			return nil, &ProtocolViolationError{Violation: ProtocolViolation{"h1", kind, err.Error()}, Err: err}
+		}
+		return nil, cancelledErr(req, firstByteErr(req, err, fb))
+	}
+	if violations != nil {
+		resp.Body = &strictBody{ReadCloser: resp.Body, chunked: slices.Contains(resp.TransferEncoding, "chunked")}
+	}
+	if resp.ProtoMajor == 1 && resp.ProtoMinor == 0 {
+		t.http10Origins.Store(requestOrigin(req), true)
 	}
 
 	return resp, nil
 }
 
+// requestOrigin returns scheme://host:port of req
+func requestOrigin(req *http.Request) string {
+	port := req.URL.Port()
+	if port == "" {
+		if req.URL.Scheme == "https" {
+			port = "443"
+		} else {
+			port = "80"
+		}
+	}
+	return req.URL.Scheme + "://" + net.JoinHostPort(req.URL.Hostname(), port)
+}
+
 // writeRequest writes an HTTP/1.1 request with browser-like header ordering
 func (t *HTTP1Transport) writeRequest(conn *http1Conn, req *http.Request) error {
 	// Request line
@@ -884,7 +1101,12 @@ func (t *HTTP1Transport) writeRequest(conn *http1Conn, req *http.Request) error
 	if uri == "" {
 		uri = "/"
 	}
-	fmt.Fprintf(conn.bw, "%s %s HTTP/1.1\r\n", req.Method, uri)
+	http10 := req.ProtoMajor == 1 && req.ProtoMinor == 0
+	proto := "HTTP/1.1"
+	if http10 {
+		proto = "HTTP/1.0"
+	}
+	fmt.Fprintf(conn.bw, "%s %s %s\r\n", req.Method, uri, proto)
 
 	// Host header first (browser behavior)
 	host := req.Host
@@ -897,6 +1119,26 @@ func (t *HTTP1Transport) writeRequest(conn *http1Conn, req *http.Request) error
 	// http.NoBody is an explicit "no body" sentinel — don't use chunked for it
 	useChunked := req.Body != nil && req.Body != http.NoBody && req.ContentLength <= 0 && req.Header.Get("Content-Length") == ""
 
+	// HTTP/1.0 has no chunked encoding: buffer the body and send its length
+	// instead, for HTTP/1.0 requests and for origins that answered with
+	// HTTP/1.0 before
+	if useChunked && (http10 || t.isHTTP10Origin(req)) {
+		body, err := io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return err
+		}
+		req.Body = io.NopCloser(bytes.NewReader(body))
+		req.ContentLength = int64(len(body))
+		useChunked = false
+	}
+
+	// Connection: close unless the caller set a Connection header. The
+	// connection is not reused either way.
+	if http10 && req.Header.Get("Connection") == "" {
+		req.Header.Set("Connection", "close")
+	}
+
 	// Write headers in browser-like order
 	t.writeHeadersInOrder(conn.bw, req, useChunked)
 
@@ -1105,8 +1347,25 @@ func (t *HTTP1Transport) writeHeadersInOrder(w *bufio.Writer, req *http.Request,
 	}
 }
 
+// isHTTP10Origin reports whether req's origin answered with HTTP/1.0 before
+func (t *HTTP1Transport) isHTTP10Origin(req *http.Request) bool {
+	_, ok := t.http10Origins.Load(requestOrigin(req))
+	return ok
+}
+
 // shouldKeepAlive determines if connection should be reused
 func (t *HTTP1Transport) shouldKeepAlive(req *http.Request, resp *http.Response) bool {
+	// Requests sent as HTTP/1.0 get their own connection
+	if req.ProtoMajor == 1 && req.ProtoMinor == 0 {
+		return false
+	}
+
+	// Response body delimited by closing the connection (no Content-Length
+	// and not chunked), which servers breaking HTTP/1.1 keep-alive do
+	if resp.Close {
+		return false
+	}
+
 	// Check response Connection header
 	if strings.EqualFold(resp.Header.Get("Connection"), "close") {
 		return false
@@ -1144,8 +1403,9 @@ func (t *HTTP1Transport) getIdleConn(key string) (*http1Conn, error) {
 	conn := conns[len(conns)-1]
 	t.idleConns[key] = conns[:len(conns)-1]
 
-	// Check if connection is still valid
-	if time.Since(conn.lastUsedAt) > t.maxIdleTime {
+	// Check if connection is still valid, and not about to be closed by
+	// the server
+	if idle := time.Since(conn.lastUsedAt); idle > t.maxIdleTime || t.idleScores.stale(key, idle) || t.expired(conn) {
 		conn.close()
 		return nil, nil
 	}
@@ -1166,6 +1426,11 @@ func (t *HTTP1Transport) putIdleConn(key string, conn *http1Conn) {
 	}
 	t.closedMu.RUnlock()
 
+	if t.expired(conn) {
+		go conn.close()
+		return
+	}
+
 	conns := t.idleConns[key]
 	if len(conns) >= t.maxIdleConnsPerHost {
 		// Pool is full, close oldest connection
@@ -1193,11 +1458,19 @@ func (c *http1Conn) close() {
 	} else if c.conn != nil {
 		c.conn.Close()
 	}
+	if c.release != nil {
+		c.release()
+	}
+}
+
+// expired reports whether conn is past PoolLimits.MaxConnAge
+func (t *HTTP1Transport) expired(conn *http1Conn) bool {
+	return t.maxConnAge > 0 && time.Since(conn.createdAt) > t.maxConnAge
 }
 
 // cleanupLoop periodically removes stale connections
 func (t *HTTP1Transport) cleanupLoop() {
-	ticker := time.NewTicker(30 * time.Second)
+	ticker := time.NewTicker(cleanupInterval(t.config))
 	defer ticker.Stop()
 
 	for {
@@ -1218,7 +1491,7 @@ func (t *HTTP1Transport) cleanup() {
 	for key, conns := range t.idleConns {
 		var active []*http1Conn
 		for _, conn := range conns {
-			if time.Since(conn.lastUsedAt) > t.maxIdleTime {
+			if time.Since(conn.lastUsedAt) > t.maxIdleTime || t.expired(conn) {
 				go conn.close()
 			} else {
 				active = append(active, conn)
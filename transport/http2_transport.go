@@ -6,12 +6,14 @@ import (
 	crand "crypto/rand"
 	"encoding/base64"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"io"
 	"net"
 	"net/url"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	http "github.com/sardanioss/http"
@@ -55,6 +57,30 @@ type HTTP2Transport struct {
 	insecureSkipVerify bool
 	localAddr          string // Local IP to bind outgoing connections
 
+	// Set once a handshake has matched config.TargetJA4
+	ja4Verified atomic.Bool
+
+	// Revocation status of each host's certificate (config.RevocationCheck)
+	revocation revocationStatuses
+
+	// TLS fingerprints of each host's latest handshake
+	fingerprints tlsFingerprints
+
+	// ECH configs accepted per host, and hosts whose server disabled ECH
+	echConfigCache   map[string][]byte
+	echRejectedHosts map[string]bool
+	echConfigCacheMu sync.RWMutex
+	disableECH       bool
+
+	// Idle timeouts servers were seen to enforce, per pool key
+	idleScores idleScoreboard
+
+	// Shared PoolLimits.MaxConns limiter, nil without one
+	limiter *connLimiter
+
+	// Transport's per-host connection stats, nil when used standalone
+	connStats *connStatsTable
+
 	// Cleanup
 	stopCleanup chan struct{}
 	closed      bool
@@ -72,6 +98,8 @@ type persistentConn struct {
 	sessionResumed  bool  // True if TLS session was resumed (faster handshake)
 	tlsVersion      uint16
 	cipherSuite     uint16
+	wire            *h2WireRecorder // what the connection's preface looked like on the wire
+	release         func()          // Frees the connection's limiter slot and stats entry, nil when it has none
 	mu              sync.Mutex
 }
 
@@ -109,8 +137,8 @@ func NewHTTP2TransportWithConfig(preset *fingerprint.Preset, dnsCache *dns.Cache
 
 	// Check if PSK spec is available for this preset or custom JA3
 	hasPSKSpec := preset.PSKClientHelloID.Client != ""
-	if !hasPSKSpec && config != nil && config.CustomJA3 != "" {
-		hasPSKSpec = ja3HasExtension(config.CustomJA3, "41")
+	if !hasPSKSpec && hasCustomTLS(config) {
+		hasPSKSpec = customTLSHasPSK(config)
 	}
 
 	t := &HTTP2Transport{
@@ -122,8 +150,9 @@ func NewHTTP2TransportWithConfig(preset *fingerprint.Preset, dnsCache *dns.Cache
 		sessionCache:   sessionCache,
 		shuffleSeed:    shuffleSeed,
 		hasPSKSpec:     hasPSKSpec,
-		maxIdleTime:    90 * time.Second,
-		maxConnAge:     5 * time.Minute,
+		echConfigCache: make(map[string][]byte),
+		maxIdleTime:    idleTime(config),
+		maxConnAge:     maxConnAge(config, 5*time.Minute),
 		connectTimeout: 30 * time.Second,
 		stopCleanup:    make(chan struct{}),
 	}
@@ -165,16 +194,30 @@ func (t *HTTP2Transport) RoundTrip(req *http.Request) (*http.Response, error) {
 
 	// Mark conn as in-use so cleanup() doesn't close it mid-flight
 	conn.mu.Lock()
+	var idle time.Duration
+	if conn.inFlight == 0 && conn.useCount > 0 {
+		idle = time.Since(conn.lastUsedAt)
+	}
 	conn.lastUsedAt = time.Now()
 	conn.inFlight++
 	conn.mu.Unlock()
 
 	// Make request
-	resp, err := conn.h2Conn.RoundTrip(req)
+	wreq, watch := watchFirstByte(req)
+	resp, err := conn.h2Conn.RoundTrip(wreq)
+	resp, err = watch.done(req, resp, err, "h2")
 	if err != nil {
 		conn.mu.Lock()
 		conn.inFlight--
 		conn.mu.Unlock()
+		if isPeerClosed(err) {
+			t.idleScores.closed(key, idle)
+		}
+		// Headers over the server's limit fail on any connection, and a
+		// stalled server is for the session's retry policy
+		if isRequestHeaderListSize(err) || errors.Is(err, ErrFirstByteTimeout) {
+			return nil, err
+		}
 
 		// Connection might be dead, remove it and retry once
 		t.removeConn(key)
@@ -193,7 +236,9 @@ func (t *HTTP2Transport) RoundTrip(req *http.Request) (*http.Response, error) {
 		conn.inFlight++
 		conn.mu.Unlock()
 
-		resp, err = conn.h2Conn.RoundTrip(req)
+		wreq, watch = watchFirstByte(req)
+		resp, err = conn.h2Conn.RoundTrip(wreq)
+		resp, err = watch.done(req, resp, err, "h2")
 		if err != nil {
 			conn.mu.Lock()
 			conn.inFlight--
@@ -222,7 +267,7 @@ func (t *HTTP2Transport) getOrCreateConn(ctx context.Context, host, port, key st
 	conn, exists := t.conns[key]
 	t.connsMu.RUnlock()
 
-	if exists && t.isConnUsable(conn) {
+	if exists && t.isConnUsable(conn) && t.checkIdleScore(key, conn) && t.checkBeforeReuse(ctx, key, conn) {
 		return conn, nil
 	}
 
@@ -263,6 +308,35 @@ func (t *HTTP2Transport) getOrCreateConn(ctx context.Context, host, port, key st
 	return newConn, nil
 }
 
+// checkIdleScore checks an idle connection against the idle scoreboard. One
+// the server has closed is recorded as a closure, and one about to reach
+// the server's learned idle limit is dropped so the request goes out on a
+// new connection.
+func (t *HTTP2Transport) checkIdleScore(key string, conn *persistentConn) bool {
+	conn.mu.Lock()
+	h2Conn := conn.h2Conn
+	idle := time.Since(conn.lastUsedAt)
+	busy := conn.inFlight > 0
+	conn.mu.Unlock()
+	if busy || h2Conn == nil {
+		return true
+	}
+	state := h2Conn.State()
+	if state.StreamsActive > 0 {
+		return true
+	}
+	if state.Closed || state.Closing {
+		t.idleScores.closed(key, idle)
+		t.dropConn(key, conn)
+		return false
+	}
+	if t.idleScores.stale(key, idle) {
+		t.dropConn(key, conn)
+		return false
+	}
+	return true
+}
+
 // isConnUsable checks if a connection is still usable
 // Note: We don't check CanTakeNewRequest() here because it can return false
 // even when the connection is fine. We'll handle errors during actual use.
@@ -289,8 +363,29 @@ func (t *HTTP2Transport) isConnUsable(conn *persistentConn) bool {
 	return true
 }
 
-// createConn creates a new persistent connection
+// createConn creates a new persistent connection within the connection
+// limit. If the server rejects our ECH config, it reconnects once with the
+// retry_configs (or GREASE ECH).
 func (t *HTTP2Transport) createConn(ctx context.Context, host, port string) (*persistentConn, error) {
+	release, err := t.limiter.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := t.dialConn(ctx, host, port)
+	if retry, rejected := echRejection(err); rejected && !t.hasFixedECHConfig() {
+		t.handleECHRejection(host, retry)
+		conn, err = t.dialConn(ctx, host, port)
+	}
+	if err != nil {
+		release()
+		return nil, err
+	}
+	conn.release = t.connStats.opened(host, release)
+	return conn, nil
+}
+
+// dialConn dials and handshakes a new persistent connection
+func (t *HTTP2Transport) dialConn(ctx context.Context, host, port string) (*persistentConn, error) {
 	var rawConn net.Conn
 	var err error
 
@@ -320,6 +415,7 @@ func (t *HTTP2Transport) createConn(ctx context.Context, host, port string) (*pe
 			Timeout:   t.connectTimeout,
 			KeepAlive: 30 * time.Second,
 		}
+		tcpOptions(t.config).applyTo(dialer)
 		if t.localAddr != "" {
 			localIP := net.ParseIP(t.localAddr)
 			dialer.LocalAddr = &net.TCPAddr{IP: localIP}
@@ -375,21 +471,21 @@ func (t *HTTP2Transport) createConn(ctx context.Context, host, port string) (*pe
 			}
 			return nil, fmt.Errorf("TCP connect failed: all connection attempts failed")
 		}
+		tcpOptions(t.config).applyConn(rawConn)
 	}
 
 	// Set TCP keepalive
 	if tcpConn, ok := rawConn.(*net.TCPConn); ok {
-		tcpConn.SetKeepAlive(true)
-		tcpConn.SetKeepAlivePeriod(30 * time.Second)
+		tcpConn.SetKeepAliveConfig(tcpOptions(t.config).keepAlive())
 	}
 
 	// Generate fresh spec for this connection to avoid race condition
 	// utls's ApplyPreset mutates the spec (clears KeyShares.Data, etc.), so each
 	// connection needs its own copy. Use same shuffleSeed for consistent ordering.
 	var specToUse *utls.ClientHelloSpec
-	if t.config != nil && t.config.CustomJA3 != "" {
-		// Custom JA3: parse to fresh spec each connection (ApplyPreset mutates)
-		spec, parseErr := fingerprint.ParseJA3(t.config.CustomJA3, t.config.CustomJA3Extras)
+	if hasCustomTLS(t.config) {
+		// Custom JA3 or raw ClientHello: parse to fresh spec each connection (ApplyPreset mutates)
+		spec, parseErr := customTLSSpec(t.config)
 		if parseErr != nil {
 			rawConn.Close()
 			return nil, fmt.Errorf("failed to parse custom JA3: %w", parseErr)
@@ -397,28 +493,24 @@ func (t *HTTP2Transport) createConn(ctx context.Context, host, port string) (*pe
 		specToUse = spec
 	} else if t.hasPSKSpec {
 		// Generate fresh PSK spec for this connection
-		if spec, err := utls.UTLSIdToSpecWithSeed(t.preset.PSKClientHelloID, t.shuffleSeed); err == nil {
+		if spec, err := presetSpec(t.config, t.preset.PSKClientHelloID, t.shuffleSeed); err == nil {
 			specToUse = &spec
 		}
 	}
 	if specToUse == nil {
 		// Generate fresh regular spec
-		if spec, err := utls.UTLSIdToSpecWithSeed(t.preset.ClientHelloID, t.shuffleSeed); err == nil {
+		if spec, err := presetSpec(t.config, t.preset.ClientHelloID, t.shuffleSeed); err == nil {
 			specToUse = &spec
 		}
 	}
+	if !hasCustomTLS(t.config) {
+		// Cipher/ALPN overrides from custom presets (e.g., fingerprint.Builder)
+		t.preset.ApplyTLSOverrides(specToUse)
+	}
+	hostPostQuantum(t.config, host, specToUse)
 
 	// Fetch ECH config if needed
-	var echConfigList []byte
-	if t.config != nil {
-		if len(t.config.ECHConfig) > 0 {
-			echConfigList = t.config.ECHConfig
-		} else if t.config.ECHConfigDomain != "" {
-			// Fetch ECH config from DNS
-			echConfigList, _ = dns.FetchECHConfigs(ctx, t.config.ECHConfigDomain)
-			// ECH fetch failed - continue without ECH (SNI will be visible)
-		}
-	}
+	echConfigList := t.getECHConfig(ctx, host, specToUse)
 
 	// Determine MinVersion based on ECH usage
 	// ECH requires TLS 1.3, so set MinVersion accordingly
@@ -449,9 +541,19 @@ func (t *HTTP2Transport) createConn(ctx context.Context, host, port string) (*pe
 
 	// Only enable session cache if we have PSK spec - prevents panic when session
 	// is cached but spec doesn't have PSK extension (TOCTOU race mitigation)
+	//
+	// Resumption over TCP is always 1-RTT: no early_data extension and no 0-RTT
+	// request, by design rather than as a missing feature. Chrome ships TCP
+	// early data disabled and only sends 0-RTT over QUIC (see sendEarly in the
+	// HTTP/3 transport), so offering it would be a fingerprint no browser
+	// has. utls also has no TCP early data path: it only marks tickets as
+	// early data capable on QUIC connections, and can't write application
+	// data before the Finished or send EndOfEarlyData outside QUIC.
 	if t.hasPSKSpec {
 		tlsConfig.ClientSessionCache = t.sessionCache
 	}
+	applyClientCert(t.config, tlsConfig, host)
+	applyCertPinner(t.config, tlsConfig, host)
 
 	// Create UClient with HelloCustom and apply our fresh spec
 	// This ensures the TLS extension order is consistent across all connections (same seed)
@@ -474,6 +576,7 @@ func (t *HTTP2Transport) createConn(ctx context.Context, host, port string) (*pe
 	}
 
 	// Perform TLS handshake
+	handshakeStart := time.Now()
 	if err := tlsConn.HandshakeContext(ctx); err != nil {
 		rawConn.Close()
 
@@ -492,23 +595,27 @@ func (t *HTTP2Transport) createConn(ctx context.Context, host, port string) (*pe
 
 			// Regenerate fresh TLS spec (the previous one was consumed)
 			var fallbackSpec *utls.ClientHelloSpec
-			if t.config != nil && t.config.CustomJA3 != "" {
-				spec, parseErr := fingerprint.ParseJA3(t.config.CustomJA3, t.config.CustomJA3Extras)
+			if hasCustomTLS(t.config) {
+				spec, parseErr := customTLSSpec(t.config)
 				if parseErr != nil {
 					rawConn.Close()
 					return nil, fmt.Errorf("speculative TLS fallback: failed to parse custom JA3: %w", parseErr)
 				}
 				fallbackSpec = spec
 			} else if t.hasPSKSpec {
-				if spec, specErr := utls.UTLSIdToSpecWithSeed(t.preset.PSKClientHelloID, t.shuffleSeed); specErr == nil {
+				if spec, specErr := presetSpec(t.config, t.preset.PSKClientHelloID, t.shuffleSeed); specErr == nil {
 					fallbackSpec = &spec
 				}
 			}
 			if fallbackSpec == nil {
-				if spec, specErr := utls.UTLSIdToSpecWithSeed(t.preset.ClientHelloID, t.shuffleSeed); specErr == nil {
+				if spec, specErr := presetSpec(t.config, t.preset.ClientHelloID, t.shuffleSeed); specErr == nil {
 					fallbackSpec = &spec
 				}
 			}
+			if !hasCustomTLS(t.config) {
+				t.preset.ApplyTLSOverrides(fallbackSpec)
+			}
+			hostPostQuantum(t.config, host, fallbackSpec)
 
 			// Redo TLS handshake on the clean connection
 			if fallbackSpec != nil {
@@ -536,8 +643,22 @@ func (t *HTTP2Transport) createConn(ctx context.Context, host, port string) (*pe
 	}
 
 alpnCheck:
+	if err := verifyJA4(tlsConn, t.config, &t.ja4Verified, host); err != nil {
+		tlsConn.Close()
+		return nil, err
+	}
+	if err := t.revocation.check(ctx, t.config, t.proxy != nil, host, tlsConn.ConnectionState()); err != nil {
+		tlsConn.Close()
+		return nil, err
+	}
+	t.fingerprints.recordConn(host, tlsConn)
+	t.connStats.handshake(host, tlsConn.ConnectionState().DidResume, time.Since(handshakeStart))
+
 	// Check ALPN negotiation result
 	state := tlsConn.ConnectionState()
+	if state.ECHAccepted {
+		t.storeAcceptedECH(host, echConfigList)
+	}
 	if state.NegotiatedProtocol != "h2" {
 		// Return ALPNMismatchError with the TLS connection so caller can reuse it for H1
 		// DO NOT close the connection - caller is responsible for closing or reusing
@@ -550,8 +671,8 @@ alpnCheck:
 		}
 	}
 
-	// Build HTTP/2 settings from preset
-	settings := t.preset.HTTP2Settings
+	// Build HTTP/2 fingerprint from preset
+	spec := t.preset.H2()
 
 	// Check TLSOnly mode - disables automatic compression and user-agent
 	tlsOnly := t.config != nil && t.config.TLSOnly
@@ -560,38 +681,41 @@ alpnCheck:
 		userAgent = "" // Don't set default User-Agent in TLS-only mode
 	}
 
-	// Build SETTINGS map and order dynamically to include all non-zero settings
-	h2Settings := map[http2.SettingID]uint32{
-		http2.SettingHeaderTableSize:   settings.HeaderTableSize,
-		http2.SettingEnablePush:        boolToUint32(settings.EnablePush),
-		http2.SettingInitialWindowSize: settings.InitialWindowSize,
-		http2.SettingMaxHeaderListSize: settings.MaxHeaderListSize,
-	}
-	h2SettingsOrder := []http2.SettingID{
-		http2.SettingHeaderTableSize,
-		http2.SettingEnablePush,
-		http2.SettingInitialWindowSize,
-		http2.SettingMaxHeaderListSize,
-	}
-	if settings.MaxConcurrentStreams > 0 {
-		h2Settings[http2.SettingMaxConcurrentStreams] = settings.MaxConcurrentStreams
-		h2SettingsOrder = append(h2SettingsOrder, http2.SettingMaxConcurrentStreams)
+	// SETTINGS frame, in wire order
+	h2Settings := make(map[http2.SettingID]uint32, len(spec.Settings))
+	h2SettingsOrder := make([]http2.SettingID, 0, len(spec.Settings))
+	for _, setting := range spec.Settings {
+		h2Settings[http2.SettingID(setting.ID)] = setting.Value
+		h2SettingsOrder = append(h2SettingsOrder, http2.SettingID(setting.ID))
 	}
-	if settings.MaxFrameSize > 0 {
-		h2Settings[http2.SettingMaxFrameSize] = settings.MaxFrameSize
-		h2SettingsOrder = append(h2SettingsOrder, http2.SettingMaxFrameSize)
-	}
-	if settings.NoRFC7540Priorities {
-		h2Settings[http2.SettingNoRFC7540Priorities] = 1
-		h2SettingsOrder = append(h2SettingsOrder, http2.SettingNoRFC7540Priorities)
+
+	// HEADERS priority and PRIORITY frames; a nil HEADERS priority leaves
+	// the PRIORITY flag unset
+	var headerPriority *http2.PriorityParam
+	var priorityFrames []http2.Priority
+	if spec.SendsPriorityFraming() {
+		if p := spec.HeaderPriority; p != nil {
+			param := h2PriorityParam(*p)
+			headerPriority = &param
+		}
+		for _, f := range spec.PriorityFrames {
+			priorityFrames = append(priorityFrames, http2.Priority{
+				StreamID:      f.StreamID,
+				PriorityParam: h2PriorityParam(f.Priority),
+			})
+		}
 	}
 
-	// Pseudo-header order: use custom (Akamai), or browser-type heuristic
-	pseudoOrder := []string{":method", ":authority", ":scheme", ":path"} // Chrome default
+	// Pseudo-header order: custom (Akamai) wins over the preset's
+	pseudoOrder := spec.PseudoHeaderOrder
 	if t.config != nil && len(t.config.CustomPseudoOrder) > 0 {
 		pseudoOrder = t.config.CustomPseudoOrder
-	} else if settings.NoRFC7540Priorities {
-		pseudoOrder = []string{":method", ":scheme", ":path", ":authority"} // Safari order
+	}
+
+	// Go's read-idle health check, unless PINGs are scheduled by H2Ping instead
+	readIdleTimeout := t.maxIdleTime
+	if t.h2PingConfig() != nil {
+		readIdleTimeout = 0
 	}
 
 	// Create HTTP/2 transport with native fingerprinting (no frame interception needed)
@@ -599,19 +723,17 @@ alpnCheck:
 		AllowHTTP:                  false,
 		DisableCompression:         tlsOnly, // Disable auto Accept-Encoding in TLS-only mode
 		StrictMaxConcurrentStreams: false,
-		ReadIdleTimeout:            t.maxIdleTime,
+		ReadIdleTimeout:            readIdleTimeout,
 		PingTimeout:                15 * time.Second,
+		MaxHeaderListSize:          uint32(headerLimits(t.config, "h2").MaxBytes),
 
 		// Native fingerprinting via sardanioss/net
-		ConnectionFlow: settings.ConnectionWindowUpdate,
+		ConnectionFlow: spec.ConnectionWindowUpdate,
 		Settings:       h2Settings,
 		SettingsOrder:  h2SettingsOrder,
 		PseudoHeaderOrder: pseudoOrder,
-		HeaderPriority: &http2.PriorityParam{
-			Weight:    uint8(settings.StreamWeight - 1), // Wire format is weight-1
-			Exclusive: settings.StreamExclusive,
-			StreamDep: 0,
-		},
+		HeaderPriority: headerPriority,
+		Priorities:     priorityFrames,
 		HeaderOrder: []string{
 			// Chrome 143 header order (verified via tls.peet.ws)
 			"cache-control", // appears on reload/session resumption
@@ -629,7 +751,10 @@ alpnCheck:
 		HPACKIndexingPolicy: hpack.IndexingChrome,
 	}
 
-	h2Conn, err := h2Transport.NewClientConn(tlsConn)
+	wire := newH2WireRecorder(tlsConn, func(akamai string) {
+		t.fingerprints.recordAkamai(host, akamai)
+	})
+	h2Conn, err := h2Transport.NewClientConn(wire)
 	if err != nil {
 		tlsConn.Close()
 		return nil, fmt.Errorf("HTTP/2 setup failed: %w", err)
@@ -641,7 +766,7 @@ alpnCheck:
 	connState := tlsConn.ConnectionState()
 	sessionResumed := connState.DidResume
 
-	return &persistentConn{
+	conn := &persistentConn{
 		host:           host,
 		tlsConn:        tlsConn,
 		h2Conn:         h2Conn,
@@ -651,7 +776,10 @@ alpnCheck:
 		sessionResumed: sessionResumed,
 		tlsVersion:     connState.Version,
 		cipherSuite:    connState.CipherSuite,
-	}, nil
+		wire:           wire,
+	}
+	t.startKeepAlive(host, port, conn)
+	return conn, nil
 }
 
 // dialThroughProxy establishes a connection through a proxy using CONNECT
@@ -675,6 +803,8 @@ func (t *HTTP2Transport) dialThroughSOCKS5(ctx context.Context, targetHost, targ
 	if t.localAddr != "" {
 		socks5Dialer.SetLocalAddr(t.localAddr)
 	}
+	// socks5:// resolves targets with the session's DNS cache and overrides
+	socks5Dialer.SetResolver(t.dnsCache.ResolveAllSorted)
 
 	targetAddr := net.JoinHostPort(targetHost, targetPort)
 	conn, err := socks5Dialer.DialContext(ctx, "tcp", targetAddr)
@@ -731,6 +861,11 @@ func (t *HTTP2Transport) dialThroughHTTPProxy(ctx context.Context, targetHost, t
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to proxy: %w", err)
 	}
+	if proxyURL.Scheme == "https" {
+		if conn, err = dialProxyTLS(ctx, conn, proxyURL, t.config, t.preset); err != nil {
+			return nil, err
+		}
+	}
 
 	// Build CONNECT request
 	targetAddr := net.JoinHostPort(targetHost, targetPort)
@@ -795,6 +930,11 @@ func (t *HTTP2Transport) dialHTTPProxyBlockingFresh(ctx context.Context, targetH
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to proxy: %w", err)
 	}
+	if proxyURL.Scheme == "https" {
+		if conn, err = dialProxyTLS(ctx, conn, proxyURL, t.config, t.preset); err != nil {
+			return nil, err
+		}
+	}
 
 	targetAddr := net.JoinHostPort(targetHost, targetPort)
 	connectReq := fmt.Sprintf("CONNECT %s HTTP/1.1\r\nHost: %s\r\n", targetAddr, targetAddr)
@@ -832,9 +972,17 @@ func (t *HTTP2Transport) dialHTTPProxyBlocking(ctx context.Context, conn net.Con
 	}
 	resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
+	statusCode, status := resp.StatusCode, resp.Status
+	if statusCode == http.StatusProxyAuthRequired {
+		statusCode, status, err = answerProxyAuth(ctx, conn, reader, connectReq, resp.Header.Values("Proxy-Authenticate"), t.proxy, t.config, statusCode, status)
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	if statusCode != http.StatusOK {
 		conn.Close()
-		return nil, fmt.Errorf("proxy CONNECT failed with status %d: %s", resp.StatusCode, resp.Status)
+		return nil, fmt.Errorf("proxy CONNECT failed with status %d: %s", statusCode, status)
 	}
 
 	// Connection established - tunnel is now open
@@ -897,11 +1045,14 @@ func (c *persistentConn) close() {
 	if c.tlsConn != nil {
 		c.tlsConn.Close()
 	}
+	if c.release != nil {
+		c.release()
+	}
 }
 
 // cleanupLoop periodically cleans up stale connections
 func (t *HTTP2Transport) cleanupLoop() {
-	ticker := time.NewTicker(30 * time.Second)
+	ticker := time.NewTicker(cleanupInterval(t.config))
 	defer ticker.Stop()
 
 	for {
@@ -991,7 +1142,7 @@ func (t *HTTP2Transport) Stats() map[string]ConnStats {
 	stats := make(map[string]ConnStats)
 	for key, conn := range t.conns {
 		conn.mu.Lock()
-		stats[key] = ConnStats{
+		cs := ConnStats{
 			Host:           conn.host,
 			CreatedAt:      conn.createdAt,
 			LastUsedAt:     conn.lastUsedAt,
@@ -1003,7 +1154,11 @@ func (t *HTTP2Transport) Stats() map[string]ConnStats {
 			TLSVersion:     conn.tlsVersion,
 			CipherSuite:    conn.cipherSuite,
 		}
+		if conn.wire != nil {
+			cs.Akamai = conn.wire.akamai()
+		}
 		conn.mu.Unlock()
+		stats[key] = cs
 	}
 
 	return stats
@@ -1051,6 +1206,10 @@ type ConnStats struct {
 	SessionResumed bool   // True if TLS session was resumed
 	TLSVersion     uint16 // TLS version (e.g., 0x0304 for TLS 1.3)
 	CipherSuite    uint16 // Negotiated cipher suite
+
+	// Akamai is the HTTP/2 fingerprint computed from the frames the
+	// connection wrote, empty until its first request was sent
+	Akamai string
 }
 
 // GetDNSCache returns the DNS cache
@@ -1147,12 +1306,75 @@ func (t *HTTP2Transport) Connect(ctx context.Context, host, port string) error {
 	return nil
 }
 
-// boolToUint32 converts a bool to uint32 (for HTTP/2 SETTINGS)
-func boolToUint32(b bool) uint32 {
-	if b {
-		return 1
+// TicketAge returns the age of the cached TLS session ticket for host, and
+// whether one is cached.
+func (t *HTTP2Transport) TicketAge(host string) (time.Duration, bool) {
+	cache, ok := t.sessionCache.(*PersistableSessionCache)
+	if !ok {
+		return 0, false
+	}
+	return cache.Age(host)
+}
+
+// RefreshTicket replaces the pooled connection to host with a fresh one, so the
+// server issues a new session ticket before the cached one expires. The new
+// handshake resumes with the old ticket, and no request is sent. The old
+// connection finishes its in-flight requests before closing.
+func (t *HTTP2Transport) RefreshTicket(ctx context.Context, host, port string) error {
+	connectHost := t.getConnectHost(host)
+	key := net.JoinHostPort(connectHost, port)
+
+	conn, err := t.createConn(ctx, host, port)
+	if err != nil {
+		return err
+	}
+
+	t.connsMu.Lock()
+	old := t.conns[key]
+	t.conns[key] = conn
+	t.connsMu.Unlock()
+
+	if old != nil {
+		go func() {
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), time.Minute)
+			defer cancel()
+			old.mu.Lock()
+			h2Conn := old.h2Conn
+			old.mu.Unlock()
+			if h2Conn != nil {
+				h2Conn.Shutdown(shutdownCtx)
+			}
+			old.close()
+		}()
+	}
+	return nil
+}
+
+// RefreshTicket renews the TLS session ticket of host:port over HTTP/2 once
+// the cached one is at least maxAge old (see HTTP2Transport.RefreshTicket),
+// and reports whether it made a handshake. Like a request it is refused by
+// the host policy and goes through the proxy a request to the host would
+// use, whose transport holds the ticket.
+func (t *Transport) RefreshTicket(ctx context.Context, host, port string, maxAge time.Duration) (bool, error) {
+	origin := "https://" + net.JoinHostPort(host, port)
+	s := t.acquire()
+	defer s.release()
+
+	if err := s.checkHostPolicy(ctx, origin); err != nil {
+		return false, err
+	}
+	if rt, err := s.routedTransport(ctx, origin); err != nil {
+		return false, err
+	} else if rt != nil {
+		return rt.RefreshTicket(ctx, host, port, maxAge)
+	}
+	if s.h2Transport == nil {
+		return false, nil
+	}
+	if age, ok := s.h2Transport.TicketAge(host); !ok || age < maxAge {
+		return false, nil
 	}
-	return 0
+	return true, s.h2Transport.RefreshTicket(ctx, host, port)
 }
 
 // ja3HasExtension checks if a JA3 string contains a specific extension ID.
@@ -1168,3 +1390,85 @@ func ja3HasExtension(ja3, extID string) bool {
 	}
 	return false
 }
+
+// hasCustomTLS reports whether the config replaces the preset's ClientHello
+// with a custom JA3 or a captured raw ClientHello.
+func hasCustomTLS(config *TransportConfig) bool {
+	return config != nil && (config.CustomJA3 != "" || len(config.CustomClientHello) > 0)
+}
+
+// customTLSSpec builds a fresh spec from the custom ClientHello. A raw
+// ClientHello takes precedence over JA3 since it describes the hello exactly.
+func customTLSSpec(config *TransportConfig) (*utls.ClientHelloSpec, error) {
+	var spec *utls.ClientHelloSpec
+	var err error
+	if len(config.CustomClientHello) > 0 {
+		spec, err = fingerprint.FromRawClientHello(config.CustomClientHello)
+	} else {
+		spec, err = fingerprint.ParseJA3(config.CustomJA3, config.CustomJA3Extras)
+	}
+	if err != nil {
+		return nil, err
+	}
+	config.ExtensionControl.Apply(spec)
+	if config.PostQuantum != nil {
+		fingerprint.SetPostQuantum(spec, *config.PostQuantum)
+	}
+	return spec, nil
+}
+
+// customTLSHasPSK reports whether the custom ClientHello has the pre_shared_key extension.
+func customTLSHasPSK(config *TransportConfig) bool {
+	if len(config.CustomClientHello) > 0 {
+		return fingerprint.RawClientHelloHasExtension(config.CustomClientHello, 41)
+	}
+	return ja3HasExtension(config.CustomJA3, "41")
+}
+
+// presetSpec builds the spec for a preset ClientHelloID with the config's
+// ExtensionControl (GREASE, shuffle mode, pinned positions) and session-wide
+// PostQuantum setting applied.
+func presetSpec(config *TransportConfig, id utls.ClientHelloID, seed int64) (utls.ClientHelloSpec, error) {
+	var ctl *fingerprint.ExtensionControl
+	if config != nil {
+		ctl = config.ExtensionControl
+	}
+	spec, err := ctl.Spec(id, seed)
+	if err == nil && config != nil && config.PostQuantum != nil {
+		fingerprint.SetPostQuantum(&spec, *config.PostQuantum)
+	}
+	return spec, err
+}
+
+// hostPostQuantum applies the post-quantum setting for host to spec: the
+// per-host override (PostQuantumHosts) or else PostQuantum. It runs after the
+// preset's TLS overrides, so the session's choice wins over the preset's.
+func hostPostQuantum(config *TransportConfig, host string, spec *utls.ClientHelloSpec) {
+	if config == nil {
+		return
+	}
+	if enabled, ok := config.PostQuantumHosts[host]; ok {
+		fingerprint.SetPostQuantum(spec, enabled)
+	} else if config.PostQuantum != nil {
+		fingerprint.SetPostQuantum(spec, *config.PostQuantum)
+	}
+}
+
+// needsPresetSpec reports whether connections to host must build the preset's
+// ClientHelloSpec explicitly instead of letting utls expand the ClientHelloID.
+func needsPresetSpec(config *TransportConfig, host string) bool {
+	if config == nil {
+		return false
+	}
+	_, perHost := config.PostQuantumHosts[host]
+	return config.ExtensionControl != nil || config.PostQuantum != nil || perHost
+}
+
+// h2PriorityParam converts a priority to its wire form
+func h2PriorityParam(p fingerprint.H2Priority) http2.PriorityParam {
+	return http2.PriorityParam{
+		Weight:    uint8(p.Weight - 1), // Wire format is weight-1
+		Exclusive: p.Exclusive,
+		StreamDep: p.DependsOn,
+	}
+}
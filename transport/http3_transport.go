@@ -12,6 +12,7 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	http "github.com/sardanioss/http"
@@ -25,14 +26,6 @@ import (
 	utls "github.com/sardanioss/utls"
 )
 
-// HTTP/3 SETTINGS identifiers
-const (
-	settingQPACKMaxTableCapacity = 0x1
-	settingMaxFieldSectionSize   = 0x6
-	settingQPACKBlockedStreams   = 0x7
-	settingH3Datagram            = 0x33
-)
-
 // QUIC transport parameter IDs (Chrome-specific)
 const (
 	tpVersionInformation = 0x11   // RFC 9368 version negotiation
@@ -41,30 +34,35 @@ const (
 
 func init() {
 	// Set Chrome-like additional transport parameters
-	quic.SetAdditionalTransportParameters(buildChromeTransportParams())
+	quic.SetAdditionalTransportParameters(buildChromeTransportParams([]quic.Version{quic.Version1}, true))
 }
 
 // buildChromeTransportParams creates Chrome-like QUIC transport parameters
-func buildChromeTransportParams() map[uint64][]byte {
+// for the offered versions (first = chosen version)
+func buildChromeTransportParams(versions []quic.Version, grease bool) map[uint64][]byte {
 	params := make(map[uint64][]byte)
 
 	// version_information (0x11) - RFC 9368
 	// Format: chosen_version (4 bytes) + available_versions (4 bytes each)
 	// Chrome sends: QUICv1 (chosen) + [GREASE, QUICv1] (available)
-	versionInfo := make([]byte, 0, 12)
-	// Chosen version: QUICv1 (0x00000001)
-	versionInfo = binary.BigEndian.AppendUint32(versionInfo, 0x00000001)
+	versionInfo := make([]byte, 0, 4*(len(versions)+2))
+	// Chosen version: the one used for the Initial packet
+	versionInfo = binary.BigEndian.AppendUint32(versionInfo, uint32(versions[0]))
 	// Available versions: GREASE first (Chrome puts GREASE before QUICv1)
-	greaseVersion := generateGREASEVersion()
-	versionInfo = binary.BigEndian.AppendUint32(versionInfo, greaseVersion)
-	// Available versions: QUICv1
-	versionInfo = binary.BigEndian.AppendUint32(versionInfo, 0x00000001)
+	if grease {
+		greaseVersion := generateGREASEVersion()
+		versionInfo = binary.BigEndian.AppendUint32(versionInfo, greaseVersion)
+	}
+	// Available versions: everything we offer, in preference order
+	for _, v := range versions {
+		versionInfo = binary.BigEndian.AppendUint32(versionInfo, uint32(v))
+	}
 	params[tpVersionInformation] = versionInfo
 
 	// google_version (0x4752 / 18258) - Google's custom parameter
 	// Format: 4-byte version
 	googleVersion := make([]byte, 4)
-	binary.BigEndian.PutUint32(googleVersion, 0x00000001) // QUICv1
+	binary.BigEndian.PutUint32(googleVersion, uint32(versions[0]))
 	params[tpGoogleVersion] = googleVersion
 
 	return params
@@ -100,6 +98,10 @@ type HTTP3Transport struct {
 	// TLS session cache for 0-RTT resumption
 	sessionCache tls.ClientSessionCache
 
+	// Connect hosts that rejected 0-RTT; requests to them wait for the
+	// handshake
+	earlyDataRejected sync.Map
+
 	// Cached ClientHelloSpec for consistent TLS fingerprint
 	// Chrome shuffles TLS extensions once per session, not per connection
 	cachedClientHelloSpec *utls.ClientHelloSpec
@@ -117,6 +119,7 @@ type HTTP3Transport struct {
 	// Track requests for timing
 	requestCount int64
 	dialCount    int64 // Number of times dialQUIC was called (new connections)
+	openConns    atomic.Int64 // QUIC connections currently open
 	mu           sync.RWMutex
 
 	// Configuration
@@ -140,6 +143,7 @@ type HTTP3Transport struct {
 	// When resuming a session, we must use the same ECH config that was used
 	// to create the original session ticket, not a fresh one from DNS
 	echConfigCache   map[string][]byte
+	echRejectedHosts map[string]bool // Hosts whose server disabled ECH (GREASE ECH only)
 	echConfigCacheMu sync.RWMutex
 
 	// Skip TLS certificate verification (for testing)
@@ -150,6 +154,29 @@ type HTTP3Transport struct {
 
 	// Local address for binding outgoing connections (IPv6 rotation)
 	localAddr string
+
+	// Per-host connection slots when QUICOptions.MaxConnsPerHost is set
+	connSlots   map[string]chan struct{}
+	connSlotsMu sync.Mutex
+
+	// Revocation status of each host's certificate (config.RevocationCheck)
+	revocation revocationStatuses
+
+	// TLS fingerprints of each host's latest handshake
+	fingerprints tlsFingerprints
+
+	// Connections and requests per pool address (see pool_limits.go), and
+	// the shared PoolLimits.MaxConns limiter, nil without one
+	poolAddrs map[string]*h3PoolAddr
+	poolMu    sync.Mutex
+	limiter   *connLimiter
+
+	// Transport's per-host connection stats, nil when used standalone
+	connStats *connStatsTable
+
+	// Connections opened by Preconnect, handed to the next dial of their
+	// address (see preconnect.go). Guarded by poolMu.
+	preconnected map[string]*quic.Conn
 }
 
 // SetInsecureSkipVerify sets whether to skip TLS certificate verification
@@ -257,7 +284,7 @@ func NewHTTP3TransportWithTransportConfig(preset *fingerprint.Preset, dnsCache *
 	// Chrome shuffles TLS extensions once per session, not per connection
 	// Use the shuffle seed for deterministic ordering
 	if clientHelloID != nil {
-		spec, err := utls.UTLSIdToSpecWithSeed(*clientHelloID, shuffleSeed)
+		spec, err := presetSpec(config, *clientHelloID, shuffleSeed)
 		if err == nil {
 			t.cachedClientHelloSpec = &spec
 		}
@@ -266,7 +293,7 @@ func NewHTTP3TransportWithTransportConfig(preset *fingerprint.Preset, dnsCache *
 	// Also cache the PSK spec for session resumption (includes pre_shared_key extension)
 	// Chrome uses a different TLS extension set when resuming with PSK
 	if preset.QUICPSKClientHelloID.Client != "" {
-		if pskSpec, err := utls.UTLSIdToSpecWithSeed(preset.QUICPSKClientHelloID, shuffleSeed); err == nil {
+		if pskSpec, err := presetSpec(config, preset.QUICPSKClientHelloID, shuffleSeed); err == nil {
 			t.cachedClientHelloSpecPSK = &pskSpec
 		}
 	}
@@ -292,18 +319,13 @@ func NewHTTP3TransportWithTransportConfig(preset *fingerprint.Preset, dnsCache *
 		t.tlsConfig.ClientSessionCache = t.sessionCache
 	}
 
-	// Determine QUIC idle timeout (default 30s, configurable)
-	quicIdleTimeout := 30 * time.Second
-	if config != nil && config.QuicIdleTimeout > 0 {
-		quicIdleTimeout = config.QuicIdleTimeout
-	}
-	// Keepalive should be half of idle timeout to prevent connection closure
-	keepAlivePeriod := quicIdleTimeout / 2
+	// Determine QUIC idle timeout and keepalive (default 30s and 15s, configurable)
+	quicIdleTimeout, keepAlivePeriod := quicTimeouts(config)
 
 	// Create QUIC config with connection reuse settings and TLS fingerprinting
 	t.quicConfig = &quic.Config{
 		MaxIdleTimeout:               quicIdleTimeout,  // Default 30s (Chrome), configurable
-		KeepAlivePeriod:              keepAlivePeriod,  // Half of idle timeout
+		KeepAlivePeriod:              keepAlivePeriod,  // Half of idle timeout, off in low-footprint mode
 		MaxIncomingStreams:           100,
 		MaxIncomingUniStreams:        103, // Chrome uses 103
 		Allow0RTT:                    true,
@@ -317,36 +339,9 @@ func NewHTTP3TransportWithTransportConfig(preset *fingerprint.Preset, dnsCache *
 		TransportParameterOrder:       quic.TransportParameterOrderChrome, // Chrome transport param ordering with large GREASE IDs
 		TransportParameterShuffleSeed: shuffleSeed, // Consistent transport param shuffle per session
 	}
+	applyQUICOptions(t.quicConfig, config)
 
-	// Generate GREASE setting ID (must be of form 0x1f * N + 0x21)
-	// Chrome uses random GREASE values
-	greaseSettingID := generateGREASESettingID()
-	// Generate non-zero random 32-bit value (Chrome never sends 0)
-	greaseSettingValue := uint64(1 + rand.Uint32()%(1<<32-1))
-
-	// HTTP/3 QPACK settings - Safari/iOS uses different values than Chrome
-	// Safari/iOS: QPACK_MAX_TABLE_CAPACITY=16383 (0x3fff)
-	// Chrome: QPACK_MAX_TABLE_CAPACITY=65536 (0x10000)
-	qpackMaxTableCapacity := uint64(65536) // Chrome default
-	if t.preset != nil && t.preset.HTTP2Settings.NoRFC7540Priorities {
-		// Safari/iOS uses smaller QPACK table
-		qpackMaxTableCapacity = 16383
-	}
-
-	// HTTP/3 settings - browser-specific configuration
-	// Chrome sends: QPACK_MAX_TABLE_CAPACITY, MAX_FIELD_SECTION_SIZE, QPACK_BLOCKED_STREAMS, H3_DATAGRAM, GREASE
-	// Safari/iOS sends: QPACK_MAX_TABLE_CAPACITY, QPACK_BLOCKED_STREAMS, GREASE (no MAX_FIELD_SECTION_SIZE or H3_DATAGRAM)
-	additionalSettings := map[uint64]uint64{
-		settingQPACKMaxTableCapacity: qpackMaxTableCapacity, // Browser-specific QPACK table capacity
-		settingQPACKBlockedStreams:   100,                   // Both Chrome and Safari use 100
-		greaseSettingID:              greaseSettingValue,    // GREASE setting
-	}
-
-	// Add Chrome-specific settings (not sent by Safari/iOS)
-	if t.preset == nil || !t.preset.HTTP2Settings.NoRFC7540Priorities {
-		additionalSettings[settingMaxFieldSectionSize] = 262144 // Chrome's MAX_FIELD_SECTION_SIZE
-		additionalSettings[settingH3Datagram] = 1               // Chrome enables H3_DATAGRAM
-	}
+	h3Settings := t.h3Settings()
 
 	// Apply localAddr from config
 	if config != nil && config.LocalAddr != "" {
@@ -383,11 +378,11 @@ func NewHTTP3TransportWithTransportConfig(preset *fingerprint.Preset, dnsCache *
 	t.transport = &http3.Transport{
 		TLSClientConfig:        t.tlsConfig,
 		QUICConfig:             t.quicConfig,
-		Dial:                   t.dialQUIC, // Just for DNS resolution
+		Dial:                   t.wrapDial(t.dialQUIC), // Just for DNS resolution
 		EnableDatagrams:        true,       // Chrome enables H3_DATAGRAM
-		AdditionalSettings:     additionalSettings,
-		MaxResponseHeaderBytes: 262144,     // Chrome's MAX_FIELD_SECTION_SIZE
-		SendGreaseFrames:       true,       // Chrome sends GREASE frames on control stream
+		AdditionalSettings:     h3Settings.AdditionalSettings(),
+		MaxResponseHeaderBytes: headerLimits(t.config, "h3").MaxBytes,
+		SendGreaseFrames:       h3Settings.GreaseFrames,
 	}
 
 	return t, nil
@@ -460,7 +455,7 @@ func NewHTTP3TransportWithConfig(preset *fingerprint.Preset, dnsCache *dns.Cache
 
 	// Cache ClientHelloSpec for consistent fingerprint
 	if clientHelloID != nil {
-		spec, err := utls.UTLSIdToSpecWithSeed(*clientHelloID, shuffleSeed)
+		spec, err := presetSpec(config, *clientHelloID, shuffleSeed)
 		if err == nil {
 			t.cachedClientHelloSpec = &spec
 		}
@@ -468,7 +463,7 @@ func NewHTTP3TransportWithConfig(preset *fingerprint.Preset, dnsCache *dns.Cache
 
 	// Also cache the PSK spec for session resumption (includes pre_shared_key extension)
 	if preset.QUICPSKClientHelloID.Client != "" {
-		if pskSpec, err := utls.UTLSIdToSpecWithSeed(preset.QUICPSKClientHelloID, shuffleSeed); err == nil {
+		if pskSpec, err := presetSpec(config, preset.QUICPSKClientHelloID, shuffleSeed); err == nil {
 			t.cachedClientHelloSpecPSK = &pskSpec
 		}
 	}
@@ -494,12 +489,8 @@ func NewHTTP3TransportWithConfig(preset *fingerprint.Preset, dnsCache *dns.Cache
 		t.tlsConfig.ClientSessionCache = t.sessionCache
 	}
 
-	// Determine QUIC idle timeout (default 30s, configurable)
-	quicIdleTimeout := 30 * time.Second
-	if config != nil && config.QuicIdleTimeout > 0 {
-		quicIdleTimeout = config.QuicIdleTimeout
-	}
-	keepAlivePeriod := quicIdleTimeout / 2
+	// Determine QUIC idle timeout and keepalive (default 30s and 15s, configurable)
+	quicIdleTimeout, keepAlivePeriod := quicTimeouts(config)
 
 	// Create QUIC config
 	t.quicConfig = &quic.Config{
@@ -518,6 +509,7 @@ func NewHTTP3TransportWithConfig(preset *fingerprint.Preset, dnsCache *dns.Cache
 		TransportParameterOrder:       quic.TransportParameterOrderChrome,
 		TransportParameterShuffleSeed: shuffleSeed,
 	}
+	applyQUICOptions(t.quicConfig, config)
 
 	// Set up SOCKS5 UDP relay via udpbara if proxy is configured
 	// udpbara creates local UDP socket pairs so quic-go gets real *net.UDPConn with OOB/ECN support
@@ -536,27 +528,7 @@ func NewHTTP3TransportWithConfig(preset *fingerprint.Preset, dnsCache *dns.Cache
 		// Note: quicTransport is NOT created here — each dial creates its own per-connection
 	}
 
-	// Generate GREASE settings
-	greaseSettingID := generateGREASESettingID()
-	greaseSettingValue := uint64(1 + rand.Uint32()%(1<<32-1))
-
-	// HTTP/3 QPACK settings - Safari/iOS uses different values than Chrome
-	qpackMaxTableCapacity := uint64(65536) // Chrome default
-	if t.preset != nil && t.preset.HTTP2Settings.NoRFC7540Priorities {
-		qpackMaxTableCapacity = 16383 // Safari/iOS uses smaller QPACK table
-	}
-
-	additionalSettings := map[uint64]uint64{
-		settingQPACKMaxTableCapacity: qpackMaxTableCapacity,
-		settingQPACKBlockedStreams:   100,
-		greaseSettingID:              greaseSettingValue,
-	}
-
-	// Add Chrome-specific settings (not sent by Safari/iOS)
-	if t.preset == nil || !t.preset.HTTP2Settings.NoRFC7540Priorities {
-		additionalSettings[settingMaxFieldSectionSize] = 262144 // Chrome's MAX_FIELD_SECTION_SIZE
-		additionalSettings[settingH3Datagram] = 1               // Chrome enables H3_DATAGRAM
-	}
+	h3Settings := t.h3Settings()
 
 	// Create HTTP/3 transport with appropriate dial function
 	var dialFunc func(ctx context.Context, addr string, tlsCfg *tls.Config, cfg *quic.Config) (*quic.Conn, error)
@@ -568,11 +540,11 @@ func NewHTTP3TransportWithConfig(preset *fingerprint.Preset, dnsCache *dns.Cache
 	t.transport = &http3.Transport{
 		TLSClientConfig:        t.tlsConfig,
 		QUICConfig:             t.quicConfig,
-		Dial:                   dialFunc,
+		Dial:                   t.wrapDial(dialFunc),
 		EnableDatagrams:        true,
-		AdditionalSettings:     additionalSettings,
-		MaxResponseHeaderBytes: 262144,
-		SendGreaseFrames:       true,
+		AdditionalSettings:     h3Settings.AdditionalSettings(),
+		MaxResponseHeaderBytes: headerLimits(t.config, "h3").MaxBytes,
+		SendGreaseFrames:       h3Settings.GreaseFrames,
 	}
 
 	return t, nil
@@ -625,13 +597,13 @@ func NewHTTP3TransportWithMASQUE(preset *fingerprint.Preset, dnsCache *dns.Cache
 
 	// Cache ClientHelloSpec for consistent fingerprint (outer connection to proxy)
 	if clientHelloID != nil {
-		spec, err := utls.UTLSIdToSpecWithSeed(*clientHelloID, shuffleSeed)
+		spec, err := presetSpec(config, *clientHelloID, shuffleSeed)
 		if err == nil {
 			t.cachedClientHelloSpec = &spec
 		}
 		// Create separate cached spec for inner connections (not shared with outer)
 		// This ensures JA4 hash is consistent across inner requests
-		innerSpec, err := utls.UTLSIdToSpecWithSeed(*clientHelloID, shuffleSeed)
+		innerSpec, err := presetSpec(config, *clientHelloID, shuffleSeed)
 		if err == nil {
 			t.cachedClientHelloSpecInner = &innerSpec
 		}
@@ -640,11 +612,11 @@ func NewHTTP3TransportWithMASQUE(preset *fingerprint.Preset, dnsCache *dns.Cache
 	// Also cache PSK specs for session resumption (includes pre_shared_key extension)
 	if preset.QUICPSKClientHelloID.Client != "" {
 		// Outer PSK spec
-		if pskSpec, err := utls.UTLSIdToSpecWithSeed(preset.QUICPSKClientHelloID, shuffleSeed); err == nil {
+		if pskSpec, err := presetSpec(config, preset.QUICPSKClientHelloID, shuffleSeed); err == nil {
 			t.cachedClientHelloSpecPSK = &pskSpec
 		}
 		// Inner PSK spec for MASQUE connections
-		if innerPskSpec, err := utls.UTLSIdToSpecWithSeed(preset.QUICPSKClientHelloID, shuffleSeed); err == nil {
+		if innerPskSpec, err := presetSpec(config, preset.QUICPSKClientHelloID, shuffleSeed); err == nil {
 			t.cachedClientHelloSpecInnerPSK = &innerPskSpec
 		}
 	}
@@ -670,12 +642,8 @@ func NewHTTP3TransportWithMASQUE(preset *fingerprint.Preset, dnsCache *dns.Cache
 		t.tlsConfig.ClientSessionCache = t.sessionCache
 	}
 
-	// Determine QUIC idle timeout (default 30s, configurable)
-	quicIdleTimeout := 30 * time.Second
-	if config != nil && config.QuicIdleTimeout > 0 {
-		quicIdleTimeout = config.QuicIdleTimeout
-	}
-	keepAlivePeriod := quicIdleTimeout / 2
+	// Determine QUIC idle timeout and keepalive (default 30s and 15s, configurable)
+	quicIdleTimeout, keepAlivePeriod := quicTimeouts(config)
 
 	// Create QUIC config with MASQUE-specific settings
 	// IMPORTANT: InitialPacketSize must be >= 1350 for MASQUE outer connection.
@@ -698,6 +666,7 @@ func NewHTTP3TransportWithMASQUE(preset *fingerprint.Preset, dnsCache *dns.Cache
 		TransportParameterOrder:       quic.TransportParameterOrderChrome,
 		TransportParameterShuffleSeed: shuffleSeed,
 	}
+	applyQUICOptions(t.quicConfig, config)
 
 	// Create MASQUE connection
 	masqueConn, err := proxy.NewMASQUEConn(proxyConfig.URL)
@@ -706,37 +675,17 @@ func NewHTTP3TransportWithMASQUE(preset *fingerprint.Preset, dnsCache *dns.Cache
 	}
 	t.masqueConn = masqueConn
 
-	// Generate GREASE settings
-	greaseSettingID := generateGREASESettingID()
-	greaseSettingValue := uint64(1 + rand.Uint32()%(1<<32-1))
-
-	// HTTP/3 QPACK settings - Safari/iOS uses different values than Chrome
-	qpackMaxTableCapacityMASQUE := uint64(65536) // Chrome default
-	if t.preset != nil && t.preset.HTTP2Settings.NoRFC7540Priorities {
-		qpackMaxTableCapacityMASQUE = 16383 // Safari/iOS uses smaller QPACK table
-	}
-
-	additionalSettings := map[uint64]uint64{
-		settingQPACKMaxTableCapacity: qpackMaxTableCapacityMASQUE,
-		settingQPACKBlockedStreams:   100,
-		greaseSettingID:              greaseSettingValue,
-	}
-
-	// Add Chrome-specific settings (not sent by Safari/iOS)
-	if t.preset == nil || !t.preset.HTTP2Settings.NoRFC7540Priorities {
-		additionalSettings[settingMaxFieldSectionSize] = 262144 // Chrome's MAX_FIELD_SECTION_SIZE
-		additionalSettings[settingH3Datagram] = 1               // Chrome enables H3_DATAGRAM
-	}
+	h3Settings := t.h3Settings()
 
 	// Create HTTP/3 transport with MASQUE dial function
 	t.transport = &http3.Transport{
 		TLSClientConfig:        t.tlsConfig,
 		QUICConfig:             t.quicConfig,
-		Dial:                   t.dialQUICWithMASQUE,
+		Dial:                   t.wrapDial(t.dialQUICWithMASQUE),
 		EnableDatagrams:        true,
-		AdditionalSettings:     additionalSettings,
-		MaxResponseHeaderBytes: 262144,
-		SendGreaseFrames:       true,
+		AdditionalSettings:     h3Settings.AdditionalSettings(),
+		MaxResponseHeaderBytes: headerLimits(t.config, "h3").MaxBytes,
+		SendGreaseFrames:       h3Settings.GreaseFrames,
 	}
 
 	return t, nil
@@ -785,6 +734,8 @@ func (t *HTTP3Transport) dialQUICWithMASQUE(ctx context.Context, addr string, tl
 	// Set ServerName in TLS config - use request host (SNI), not connection host
 	tlsCfgCopy := tlsCfg.Clone()
 	tlsCfgCopy.ServerName = host
+	applyClientCert(t.config, tlsCfgCopy, host)
+	applyCertPinner(t.config, tlsCfgCopy, host)
 	// Clone() doesn't preserve ClientSessionCache, restore it for session resumption
 	// Only if we have PSK spec to prevent TOCTOU race
 	if t.cachedClientHelloSpecPSK != nil {
@@ -816,12 +767,8 @@ func (t *HTTP3Transport) dialQUICWithMASQUE(ctx context.Context, addr string, tl
 	// This tells utls to actually load and use the cached session for 0-RTT
 	innerSpec := t.getInnerSpecForHost(host)
 
-	// Determine QUIC idle timeout (default 30s, configurable)
-	quicIdleTimeout := 30 * time.Second
-	if t.config != nil && t.config.QuicIdleTimeout > 0 {
-		quicIdleTimeout = t.config.QuicIdleTimeout
-	}
-	keepAlivePeriod := quicIdleTimeout / 2
+	// Determine QUIC idle timeout and keepalive (default 30s and 15s, configurable)
+	quicIdleTimeout, keepAlivePeriod := quicTimeouts(t.config)
 
 	cfgCopy := &quic.Config{
 		MaxIdleTimeout:                  quicIdleTimeout,
@@ -888,6 +835,8 @@ func (t *HTTP3Transport) dialQUICWithProxy(ctx context.Context, addr string, tls
 	// Clone TLS config — ServerName is the actual host (not connectHost)
 	tlsCfgCopy := t.tlsConfig.Clone()
 	tlsCfgCopy.ServerName = host
+	applyClientCert(t.config, tlsCfgCopy, host)
+	applyCertPinner(t.config, tlsCfgCopy, host)
 	if t.cachedClientHelloSpecPSK != nil {
 		tlsCfgCopy.ClientSessionCache = t.sessionCache
 	}
@@ -910,11 +859,10 @@ func (t *HTTP3Transport) dialQUICWithProxy(ctx context.Context, addr string, tls
 	// Auto-cleanup when the QUIC connection closes (timeout, error, idle, explicit).
 	// Without this, failed requests leave quic.Transport goroutines + udpbara relay
 	// goroutines running until session.Close(), burning CPU on Linux (ECN/GSO syscalls).
-	go func() {
-		<-conn.Context().Done()
+	context.AfterFunc(conn.Context(), func() {
 		closeProxyConn(pc)
 		t.removeProxyConn(pc)
-	}()
+	})
 
 	return conn, nil
 }
@@ -928,7 +876,7 @@ func (t *HTTP3Transport) raceQUICDial(ctx context.Context, host string, ipv6Addr
 }
 
 // raceQUICDialWithECH implements Happy Eyeballs-style connection racing with pre-fetched ECH config
-// Tries IPv6 first with a short timeout, then falls back to IPv4 if needed
+// Tries IPv6 first with a short timeout (IPv4 if preferred), then falls back to the other family if needed
 func (t *HTTP3Transport) raceQUICDialWithECH(ctx context.Context, host string, ipv6Addrs, ipv4Addrs []*net.UDPAddr, tlsCfg *tls.Config, cfg *quic.Config, echConfigList []byte) (*quic.Conn, error) {
 	// If only one address family available, just dial it directly
 	if len(ipv6Addrs) == 0 && len(ipv4Addrs) == 0 {
@@ -959,20 +907,24 @@ func (t *HTTP3Transport) raceQUICDialWithECH(ctx context.Context, host string, i
 		return t.dialFirstSuccessful(ctx, ipv6Addrs, tlsCfg, makeConfig())
 	}
 
-	// Try IPv6 first with a short timeout (Happy Eyeballs style)
-	// If IPv6 fails or times out quickly, fall back to IPv4
-	ipv6Timeout := 2 * time.Second // Give IPv6 a reasonable chance
-	ipv6Ctx, ipv6Cancel := context.WithTimeout(ctx, ipv6Timeout)
+	// Try the preferred family first with a short timeout (Happy Eyeballs style)
+	// If it fails or times out quickly, fall back to the other
+	preferred, fallback := ipv6Addrs, ipv4Addrs
+	if t.dnsCache != nil && t.dnsCache.PreferIPv4() {
+		preferred, fallback = ipv4Addrs, ipv6Addrs
+	}
+	preferredTimeout := 2 * time.Second // Give the preferred family a reasonable chance
+	preferredCtx, preferredCancel := context.WithTimeout(ctx, preferredTimeout)
 
-	conn, _ := t.dialFirstSuccessful(ipv6Ctx, ipv6Addrs, tlsCfg, makeConfig())
-	ipv6Cancel()
+	conn, _ := t.dialFirstSuccessful(preferredCtx, preferred, tlsCfg, makeConfig())
+	preferredCancel()
 
 	if conn != nil {
 		return conn, nil
 	}
 
-	// IPv6 failed, try IPv4 with fresh config
-	return t.dialFirstSuccessful(ctx, ipv4Addrs, tlsCfg, makeConfig())
+	// Preferred family failed, try the other with fresh config
+	return t.dialFirstSuccessful(ctx, fallback, tlsCfg, makeConfig())
 }
 
 // dialFirstSuccessful tries each address in order until one succeeds.
@@ -1006,13 +958,13 @@ func (t *HTTP3Transport) dialFirstSuccessful(ctx context.Context, addrs []*net.U
 	return nil, lastErr
 }
 
-// generateGREASESettingID generates a valid GREASE setting ID
-// GREASE IDs are of the form 0x1f * N + 0x21 where N is random
-// Chrome uses very large N values, producing setting IDs like 57836956465
-func generateGREASESettingID() uint64 {
-	// Generate large N values similar to Chrome (produces 10-11 digit IDs)
-	n := uint64(1000000000 + rand.Int63n(9000000000))
-	return 0x1f*n + 0x21
+// h3Settings returns the HTTP/3 SETTINGS to send: the preset's, or
+// Chrome's when there is none
+func (t *HTTP3Transport) h3Settings() fingerprint.H3Settings {
+	if t.preset == nil {
+		return (&fingerprint.Preset{}).H3()
+	}
+	return t.preset.H3()
 }
 
 // dialQUIC provides DNS resolution and ECH config fetching with Happy Eyeballs
@@ -1121,6 +1073,8 @@ func (t *HTTP3Transport) dialQUIC(ctx context.Context, addr string, tlsCfg *tls.
 	// http3.Transport may not include ClientSessionCache in the config it passes
 	tlsCfgCopy := t.tlsConfig.Clone()
 	tlsCfgCopy.ServerName = host
+	applyClientCert(t.config, tlsCfgCopy, host)
+	applyCertPinner(t.config, tlsCfgCopy, host)
 	// Clone() doesn't preserve ClientSessionCache, restore it for session resumption
 	// Only if we have PSK spec to prevent TOCTOU race
 	if t.cachedClientHelloSpecPSK != nil {
@@ -1140,7 +1094,14 @@ func (t *HTTP3Transport) dialQUIC(ctx context.Context, addr string, tlsCfg *tls.
 	// Race IPv6 and IPv4 connections (Happy Eyeballs style)
 	// Try IPv6 first, then IPv4 after short timeout
 	// Pass pre-fetched ECH config (fetched in parallel with DNS)
-	return t.raceQUICDialWithECH(ctx, host, ipv6Addrs, ipv4Addrs, tlsCfgCopy, cfgCopy, echConfigList)
+	conn, err := t.raceQUICDialWithECH(ctx, host, ipv6Addrs, ipv4Addrs, tlsCfgCopy, cfgCopy, echConfigList)
+	if retry, rejected := echRejection(err); rejected && echConfigList != nil {
+		// Server rejected our ECH config - retry once with its retry_configs,
+		// or with GREASE ECH if it sent none
+		t.handleECHRejection(host, retry)
+		return t.raceQUICDialWithECH(ctx, host, ipv6Addrs, ipv4Addrs, tlsCfgCopy, cfgCopy, t.getECHConfig(ctx, host))
+	}
+	return conn, err
 }
 
 // RoundTrip implements http.RoundTripper
@@ -1178,6 +1139,8 @@ func (t *HTTP3Transport) RoundTrip(req *http.Request) (*http.Response, error) {
 		}
 	}
 
+	splitCookies(req.Header)
+
 	// For domain fronting: swap req.URL.Host to connectHost so http3.Transport
 	// pools connections by connect host (multiple request hosts share one QUIC connection).
 	// Preserve original host in req.Host for the :authority pseudo-header.
@@ -1204,6 +1167,20 @@ func (t *HTTP3Transport) RoundTrip(req *http.Request) (*http.Response, error) {
 	transport := t.transport
 	t.mu.RUnlock()
 
+	// Send the request in 0-RTT when the connection resumes a session
+	method := req.Method
+	if t.sendEarly(req, connectHost) {
+		req.Method = earlyMethods[method]
+		defer func() { req.Method = method }()
+	}
+
+	origReq := req
+	req, watch := watchFirstByte(req)
+
+	// Track the request until its body is done, so idle connections can be
+	// told apart from busy ones
+	end := t.beginRequest(poolAddr(req))
+
 	// Retry up to 3 times on 0-RTT rejection (can happen multiple times after Refresh)
 	var resp *http.Response
 	var err error
@@ -1212,6 +1189,12 @@ func (t *HTTP3Transport) RoundTrip(req *http.Request) (*http.Response, error) {
 		if err == nil || !is0RTTRejectedError(err) {
 			break
 		}
+		// The server refused early data: retry after the handshake, and
+		// stop sending early requests to it
+		if req.Method != method {
+			t.earlyDataRejected.Store(connectHost, true)
+			req.Method = method
+		}
 		// 0-RTT rejected - close unusable connection and recreate transport
 		// Use timeout to prevent blocking if QUIC drain takes too long
 		closeWithTimeout(transport, 3*time.Second)
@@ -1233,7 +1216,33 @@ func (t *HTTP3Transport) RoundTrip(req *http.Request) (*http.Response, error) {
 	_ = dialsBefore
 	_ = dialsAfter
 
-	return resp, err
+	resp, err = watch.done(origReq, resp, err, "h3")
+	if err != nil {
+		end()
+		return nil, err
+	}
+	resp.Body = &doneBody{ReadCloser: resp.Body, done: end}
+	return resp, nil
+}
+
+// doneBody calls done once the body is read to the end or closed
+type doneBody struct {
+	io.ReadCloser
+	done func()
+}
+
+func (b *doneBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err != nil {
+		b.done()
+	}
+	return n, err
+}
+
+func (b *doneBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.done()
+	return err
 }
 
 // IsConnectionReused returns true if requests > dials (meaning reuse happened)
@@ -1365,27 +1374,7 @@ func (t *HTTP3Transport) Refresh() error {
 		t.closeAllProxyConns()
 	}
 
-	// Generate GREASE values matching constructor (Chrome-like 10-11 digit IDs, non-zero values)
-	greaseSettingID := generateGREASESettingID()
-	greaseSettingValue := uint64(1 + rand.Uint32()%(1<<32-1))
-
-	// QPACK capacity: Safari/iOS uses 16383, Chrome uses 65536
-	qpackMaxTableCapacity := uint64(65536)
-	if t.preset != nil && t.preset.HTTP2Settings.NoRFC7540Priorities {
-		qpackMaxTableCapacity = 16383
-	}
-
-	// Build additional settings matching original creation
-	additionalSettings := map[uint64]uint64{
-		settingQPACKMaxTableCapacity: qpackMaxTableCapacity,
-		settingQPACKBlockedStreams:   100,
-		greaseSettingID:              greaseSettingValue,
-	}
-	// Add Chrome-specific settings (not sent by Safari/iOS)
-	if t.preset == nil || !t.preset.HTTP2Settings.NoRFC7540Priorities {
-		additionalSettings[settingMaxFieldSectionSize] = 262144
-		additionalSettings[settingH3Datagram] = 1
-	}
+	h3Settings := t.h3Settings()
 
 	// Determine which dial function to use and recreate transport
 	var dialFunc func(ctx context.Context, addr string, tlsCfg *tls.Config, cfg *quic.Config) (*quic.Conn, error)
@@ -1401,11 +1390,11 @@ func (t *HTTP3Transport) Refresh() error {
 	t.transport = &http3.Transport{
 		TLSClientConfig:        t.tlsConfig,
 		QUICConfig:             t.quicConfig,
-		Dial:                   dialFunc,
+		Dial:                   t.wrapDial(dialFunc),
 		EnableDatagrams:        true,
-		AdditionalSettings:     additionalSettings,
-		MaxResponseHeaderBytes: 262144,
-		SendGreaseFrames:       true,
+		AdditionalSettings:     h3Settings.AdditionalSettings(),
+		MaxResponseHeaderBytes: headerLimits(t.config, "h3").MaxBytes,
+		SendGreaseFrames:       h3Settings.GreaseFrames,
 	}
 
 	return nil
@@ -1425,6 +1414,29 @@ func closeWithTimeout(c io.Closer, timeout time.Duration) {
 	}
 }
 
+// earlyMethods maps the methods sent in 0-RTT to the http3 methods that skip
+// waiting for the handshake. Like Chrome, only safe methods go out early since
+// early data can be replayed.
+var earlyMethods = map[string]string{
+	http.MethodGet:  http3.MethodGet0RTT,
+	http.MethodHead: http3.MethodHead0RTT,
+}
+
+// sendEarly reports whether req may be sent in 0-RTT: a GET or HEAD without
+// a body, with early data enabled, to a host that hasn't rejected it. On a
+// connection without a session ticket the request still waits for the
+// handshake, as quic-go only hands out the connection once it can send.
+func (t *HTTP3Transport) sendEarly(req *http.Request, connectHost string) bool {
+	if t.config != nil && t.config.QUIC != nil && t.config.QUIC.DisableEarlyData {
+		return false
+	}
+	if _, ok := earlyMethods[req.Method]; !ok || (req.Body != nil && req.Body != http.NoBody) {
+		return false
+	}
+	_, rejected := t.earlyDataRejected.Load(connectHost)
+	return !rejected
+}
+
 // is0RTTRejectedError checks if the error is due to 0-RTT rejection.
 // Only matches actual 0-RTT rejection, not generic "conn unusable" errors
 // (which can also be caused by idle timeout, peer reset, etc.).
@@ -1441,27 +1453,7 @@ func (t *HTTP3Transport) recreateTransport() {
 	t.mu.Lock()
 	defer t.mu.Unlock()
 
-	// Generate fresh GREASE values matching constructor (Chrome-like 10-11 digit IDs, non-zero values)
-	greaseSettingID := generateGREASESettingID()
-	greaseSettingValue := uint64(1 + rand.Uint32()%(1<<32-1))
-
-	// QPACK capacity: Safari/iOS uses 16383, Chrome uses 65536
-	qpackMaxTableCapacity := uint64(65536)
-	if t.preset != nil && t.preset.HTTP2Settings.NoRFC7540Priorities {
-		qpackMaxTableCapacity = 16383
-	}
-
-	// Build additional settings
-	additionalSettings := map[uint64]uint64{
-		settingQPACKMaxTableCapacity: qpackMaxTableCapacity,
-		settingQPACKBlockedStreams:   100,
-		greaseSettingID:              greaseSettingValue,
-	}
-	// Add Chrome-specific settings (not sent by Safari/iOS)
-	if t.preset == nil || !t.preset.HTTP2Settings.NoRFC7540Priorities {
-		additionalSettings[settingMaxFieldSectionSize] = 262144
-		additionalSettings[settingH3Datagram] = 1
-	}
+	h3Settings := t.h3Settings()
 
 	// Determine which dial function to use
 	var dialFunc func(ctx context.Context, addr string, tlsCfg *tls.Config, cfg *quic.Config) (*quic.Conn, error)
@@ -1477,11 +1469,11 @@ func (t *HTTP3Transport) recreateTransport() {
 	t.transport = &http3.Transport{
 		TLSClientConfig:        t.tlsConfig,
 		QUICConfig:             t.quicConfig,
-		Dial:                   dialFunc,
+		Dial:                   t.wrapDial(dialFunc),
 		EnableDatagrams:        true,
-		AdditionalSettings:     additionalSettings,
-		MaxResponseHeaderBytes: 262144,
-		SendGreaseFrames:       true,
+		AdditionalSettings:     h3Settings.AdditionalSettings(),
+		MaxResponseHeaderBytes: headerLimits(t.config, "h3").MaxBytes,
+		SendGreaseFrames:       h3Settings.GreaseFrames,
 	}
 }
 
@@ -1556,17 +1548,15 @@ func (t *HTTP3Transport) Connect(ctx context.Context, host, port string) error {
 		InsecureSkipVerify: t.insecureSkipVerify,
 		KeyLogWriter:       keyLogWriter,
 	}
+	applyClientCert(t.config, tlsCfg, host)
+	applyCertPinner(t.config, tlsCfg, host)
 
 	// Fetch ECH configs from DNS HTTPS records (use request host for ECH)
 	// This is non-blocking - if it fails, we proceed without ECH
 	echConfigList, _ := dns.FetchECHConfigs(ctx, host)
 
-	// Determine QUIC idle timeout (default 30s, configurable)
-	quicIdleTimeout := 30 * time.Second
-	if t.config != nil && t.config.QuicIdleTimeout > 0 {
-		quicIdleTimeout = t.config.QuicIdleTimeout
-	}
-	keepAlivePeriod := quicIdleTimeout / 2
+	// Determine QUIC idle timeout and keepalive (default 30s and 15s, configurable)
+	quicIdleTimeout, keepAlivePeriod := quicTimeouts(t.config)
 
 	// QUIC config with Chrome-like settings and ECH
 	quicCfg := &quic.Config{
@@ -1675,6 +1665,14 @@ func (t *HTTP3Transport) getConnectHost(requestHost string) string {
 
 // getECHConfig returns the ECH config for a host
 func (t *HTTP3Transport) getECHConfig(ctx context.Context, targetHost string) []byte {
+	// ECH disabled for this host, by config or by the server: GREASE ECH only
+	t.echConfigCacheMu.RLock()
+	rejected := t.echRejectedHosts[targetHost]
+	t.echConfigCacheMu.RUnlock()
+	if rejected || t.config.echDisabledForHost(targetHost) {
+		return nil
+	}
+
 	// First, check if we have a cached ECH config for this host
 	// This is critical for session resumption - we must use the same ECH config
 	// that was used when creating the original session ticket
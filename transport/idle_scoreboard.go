@@ -0,0 +1,132 @@
+package transport
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// minIdleClosure is the shortest idle time a closure is learned from.
+// Connections dropped sooner say more about a failing server than about
+// its idle timeout.
+const minIdleClosure = time.Second
+
+// IdleScore is what a connection pool learned about the server's idle
+// timeout, with the idle ages of its pooled connections
+type IdleScore struct {
+	// Limit is the shortest idle time after which the server was seen to
+	// close a connection, 0 if it hasn't been. Servers close at this age or
+	// earlier, so connections are re-dialed from 3/4 of it.
+	Limit time.Duration
+
+	Closures int // Idle connections the server closed
+	Redials  int // Connections replaced before reuse because they neared Limit
+
+	// Idle is the idle age of each pooled connection not serving a request
+	Idle []time.Duration
+}
+
+// idleScoreboard learns per pool key how long the server lets connections
+// sit idle, so a connection it is about to close is replaced before a
+// request is sent on it rather than after the request fails. The zero
+// value is ready to use.
+type idleScoreboard struct {
+	mu     sync.Mutex
+	scores map[string]*IdleScore
+}
+
+// closed records that the server closed a connection idle for idle
+func (b *idleScoreboard) closed(key string, idle time.Duration) {
+	if idle < minIdleClosure {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	score := b.score(key)
+	score.Closures++
+	if score.Limit == 0 || idle < score.Limit {
+		score.Limit = idle
+	}
+}
+
+// stale reports whether a connection idle for idle is close enough to the
+// server's learned limit to be re-dialed instead of reused
+func (b *idleScoreboard) stale(key string, idle time.Duration) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	score, ok := b.scores[key]
+	if !ok || score.Limit == 0 || idle < score.Limit-score.Limit/4 {
+		return false
+	}
+	score.Redials++
+	return true
+}
+
+// score returns the entry for key, creating it. Caller holds b.mu.
+func (b *idleScoreboard) score(key string) *IdleScore {
+	if b.scores == nil {
+		b.scores = make(map[string]*IdleScore)
+	}
+	score, ok := b.scores[key]
+	if !ok {
+		score = &IdleScore{}
+		b.scores[key] = score
+	}
+	return score
+}
+
+// snapshot returns copies of the entries keyed by prefix + key
+func (b *idleScoreboard) snapshot(prefix string, into map[string]IdleScore) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for key, score := range b.scores {
+		into[prefix+key] = IdleScore{Limit: score.Limit, Closures: score.Closures, Redials: score.Redials}
+	}
+}
+
+// isPeerClosed reports whether err means the peer closed the connection
+func isPeerClosed(err error) bool {
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.EPIPE) {
+		return true
+	}
+	return err != nil && strings.Contains(err.Error(), "http2: client connection lost")
+}
+
+// IdleScoreboard returns the idle timeouts learned per connection pool,
+// keyed by "h1:scheme://host:port" or "h2:host:port", with the idle ages
+// of the pooled connections
+func (t *Transport) IdleScoreboard() map[string]IdleScore {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	scores := make(map[string]IdleScore)
+	t.h1Transport.idleScores.snapshot("h1:", scores)
+	t.h2Transport.idleScores.snapshot("h2:", scores)
+
+	t.h1Transport.idleConnsMu.Lock()
+	for key, conns := range t.h1Transport.idleConns {
+		score := scores["h1:"+key]
+		for _, conn := range conns {
+			score.Idle = append(score.Idle, time.Since(conn.lastUsedAt))
+		}
+		scores["h1:"+key] = score
+	}
+	t.h1Transport.idleConnsMu.Unlock()
+
+	t.h2Transport.connsMu.RLock()
+	for key, conn := range t.h2Transport.conns {
+		score := scores["h2:"+key]
+		conn.mu.Lock()
+		if conn.inFlight == 0 {
+			score.Idle = append(score.Idle, time.Since(conn.lastUsedAt))
+		}
+		conn.mu.Unlock()
+		scores["h2:"+key] = score
+	}
+	t.h2Transport.connsMu.RUnlock()
+	return scores
+}
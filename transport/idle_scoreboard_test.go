@@ -0,0 +1,68 @@
+package transport
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIdleScoreboard(t *testing.T) {
+	var b idleScoreboard
+	b.closed("a", 500*time.Millisecond) // Too soon to be an idle timeout
+	if b.stale("a", time.Hour) {
+		t.Error("stale without a learned limit")
+	}
+	b.closed("a", 40*time.Second)
+	b.closed("a", 20*time.Second)
+	b.closed("a", 30*time.Second)
+	if b.stale("a", 14*time.Second) || !b.stale("a", 15*time.Second) || b.stale("b", time.Hour) {
+		t.Error("want re-dials from 3/4 of the shortest closure (15s) on a only")
+	}
+
+	scores := make(map[string]IdleScore)
+	b.snapshot("h2:", scores)
+	if s := scores["h2:a"]; s.Limit != 20*time.Second || s.Closures != 3 || s.Redials != 1 {
+		t.Errorf("score = %+v", s)
+	}
+}
+
+func TestIdleRedial(t *testing.T) {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	srv.Config.IdleTimeout = 1200 * time.Millisecond
+	srv.Start()
+	defer srv.Close()
+
+	tr := NewTransport("chrome-latest")
+	defer tr.Close()
+	tr.SetProtocol(ProtocolHTTP1)
+	do := func() {
+		resp, err := tr.Do(context.Background(), &Request{Method: "GET", URL: srv.URL})
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Bytes()
+	}
+	key := "h1:http://" + strings.TrimPrefix(srv.URL, "http://")
+
+	// The server closes the connection while it idles; the next request
+	// finds it dead and teaches the scoreboard the timeout
+	do()
+	time.Sleep(1500 * time.Millisecond)
+	do()
+	score := tr.IdleScoreboard()[key]
+	if score.Closures != 1 || score.Limit < 1200*time.Millisecond || len(score.Idle) != 1 {
+		t.Fatalf("score = %+v, want one closure", score)
+	}
+
+	// Now a connection nearing the limit is replaced before use
+	time.Sleep(1200 * time.Millisecond)
+	do()
+	if score := tr.IdleScoreboard()[key]; score.Closures != 1 || score.Redials != 1 {
+		t.Errorf("score = %+v, want a re-dial and no new closure", score)
+	}
+}
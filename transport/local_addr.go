@@ -0,0 +1,50 @@
+package transport
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/sardanioss/httpcloak/dns"
+)
+
+// InterfaceAddr returns the address of the network interface name for
+// TransportConfig.LocalAddr: its first IPv4 address, or IPv6 when family
+// asks for it or the interface has no IPv4 address. Link-local addresses
+// are skipped, as they can't reach other networks.
+func InterfaceAddr(name string, family dns.IPFamily) (string, error) {
+	iface, err := net.InterfaceByName(name)
+	if err != nil {
+		return "", fmt.Errorf("interface %q: %w", name, err)
+	}
+	if iface.Flags&net.FlagUp == 0 {
+		return "", fmt.Errorf("interface %q is down", name)
+	}
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return "", fmt.Errorf("interface %q: %w", name, err)
+	}
+
+	var ipv4, ipv6 net.IP
+	for _, addr := range addrs {
+		ipNet, ok := addr.(*net.IPNet)
+		if !ok || !(ipNet.IP.IsGlobalUnicast() || ipNet.IP.IsLoopback()) {
+			continue
+		}
+		if ipNet.IP.To4() != nil {
+			if ipv4 == nil {
+				ipv4 = ipNet.IP
+			}
+		} else if ipv6 == nil {
+			ipv6 = ipNet.IP
+		}
+	}
+
+	ip := ipv4
+	if family == dns.IPFamilyIPv6 || (ip == nil && family != dns.IPFamilyIPv4) {
+		ip = ipv6
+	}
+	if ip == nil {
+		return "", fmt.Errorf("interface %q has no usable address (family %s)", name, family)
+	}
+	return ip.String(), nil
+}
@@ -0,0 +1,28 @@
+package transport
+
+import (
+	"net"
+	"testing"
+
+	"github.com/sardanioss/httpcloak/dns"
+)
+
+func TestInterfaceAddr(t *testing.T) {
+	ifaces, _ := net.Interfaces()
+	var loopback string
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagLoopback != 0 && iface.Flags&net.FlagUp != 0 {
+			loopback = iface.Name
+		}
+	}
+	if loopback == "" {
+		t.Skip("no loopback interface")
+	}
+
+	if addr, err := InterfaceAddr(loopback, dns.IPFamilyAny); err != nil || !net.ParseIP(addr).IsLoopback() || net.ParseIP(addr).To4() == nil {
+		t.Errorf("InterfaceAddr(%s) = %q, %v; want its IPv4 address", loopback, addr, err)
+	}
+	if _, err := InterfaceAddr("no-such-interface0", dns.IPFamilyAny); err == nil {
+		t.Error("unknown interface accepted")
+	}
+}
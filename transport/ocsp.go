@@ -0,0 +1,274 @@
+package transport
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	stdhttp "net/http"
+	"sync"
+	"time"
+
+	utls "github.com/sardanioss/utls"
+	"golang.org/x/crypto/ocsp"
+)
+
+// OCSPStatus is the revocation status of a server certificate
+type OCSPStatus string
+
+const (
+	// OCSPNotChecked means no revocation check ran (RevocationCheck is nil)
+	OCSPNotChecked OCSPStatus = ""
+	// OCSPGood means the CA vouched for the certificate
+	OCSPGood OCSPStatus = "good"
+	// OCSPRevoked means the CA revoked the certificate
+	OCSPRevoked OCSPStatus = "revoked"
+	// OCSPUnknown means the OCSP responder doesn't know the certificate
+	OCSPUnknown OCSPStatus = "unknown"
+	// OCSPInvalid means the stapled response didn't verify or had expired
+	OCSPInvalid OCSPStatus = "invalid"
+	// OCSPUnavailable means there was no staple and no online answer (soft fail)
+	OCSPUnavailable OCSPStatus = "unavailable"
+)
+
+// ErrCertificateRevoked is returned when RevocationCheck.RejectRevoked is set
+// and the server's certificate is revoked
+var ErrCertificateRevoked = errors.New("server certificate is revoked")
+
+// RevocationCheck enables revocation checking of server certificates.
+// Stapled OCSP responses (presets request them with status_request) are
+// verified against the issuer on every full handshake.
+type RevocationCheck struct {
+	// Online asks the certificate's OCSP responder when the server didn't
+	// staple a response, then falls back to its CRL. Answers are cached
+	// until their NextUpdate. Checks are soft-fail: errors give
+	// OCSPUnavailable and the request proceeds. Online checks use a plain Go
+	// HTTP client over a direct connection, so they are skipped when the
+	// transport uses a proxy.
+	Online bool
+
+	// RejectRevoked fails connections to servers with revoked certificates
+	// with ErrCertificateRevoked. Other statuses never fail a connection.
+	RejectRevoked bool
+
+	// Timeout bounds each online check (default 5s)
+	Timeout time.Duration
+}
+
+// TLSInfo describes the certificate checks of the connection that served a response
+type TLSInfo struct {
+	// OCSPStatus is the revocation status of the server certificate on the
+	// latest handshake with the host
+	OCSPStatus OCSPStatus
+
+	// OCSPStapled reports whether the server stapled an OCSP response
+	OCSPStapled bool
+}
+
+// revocationStatuses remembers the latest revocation result per host
+type revocationStatuses struct {
+	mu    sync.Mutex
+	hosts map[string]TLSInfo
+}
+
+// info returns the TLSInfo for host, or nil when host wasn't checked
+func (r *revocationStatuses) info(host string) *TLSInfo {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	info, ok := r.hosts[host]
+	if !ok {
+		return nil
+	}
+	return &info
+}
+
+// check runs the configured revocation check on a completed handshake and
+// records the result for host. It fails only for revoked certificates when
+// RejectRevoked is set.
+func (r *revocationStatuses) check(ctx context.Context, config *TransportConfig, proxied bool, host string, state utls.ConnectionState) error {
+	if config == nil || config.RevocationCheck == nil {
+		return nil
+	}
+	rc := config.RevocationCheck
+	info := TLSInfo{OCSPStapled: len(state.OCSPResponse) > 0}
+	info.OCSPStatus = certificateStatus(ctx, rc, !proxied, state)
+
+	r.mu.Lock()
+	if r.hosts == nil {
+		r.hosts = make(map[string]TLSInfo)
+	}
+	r.hosts[host] = info
+	r.mu.Unlock()
+
+	if info.OCSPStatus == OCSPRevoked && rc.RejectRevoked {
+		return fmt.Errorf("%w: %s", ErrCertificateRevoked, host)
+	}
+	return nil
+}
+
+// revocationCache caches online results by issuer and certificate serial
+var revocationCache = struct {
+	sync.Mutex
+	entries map[string]cachedRevocation
+}{entries: make(map[string]cachedRevocation)}
+
+type cachedRevocation struct {
+	status  OCSPStatus
+	expires time.Time
+}
+
+// certificateStatus works out the revocation status of the leaf certificate
+func certificateStatus(ctx context.Context, rc *RevocationCheck, online bool, state utls.ConnectionState) OCSPStatus {
+	leaf, issuer := leafAndIssuer(state)
+	if leaf == nil || issuer == nil {
+		return OCSPUnavailable
+	}
+
+	if len(state.OCSPResponse) > 0 {
+		resp, err := ocsp.ParseResponseForCert(state.OCSPResponse, leaf, issuer)
+		if err != nil || (!resp.NextUpdate.IsZero() && time.Now().After(resp.NextUpdate)) {
+			return OCSPInvalid
+		}
+		return ocspStatus(resp.Status)
+	}
+
+	key := string(issuer.RawSubject) + "/" + leaf.SerialNumber.String()
+	revocationCache.Lock()
+	cached, ok := revocationCache.entries[key]
+	revocationCache.Unlock()
+	if ok && time.Now().Before(cached.expires) {
+		return cached.status
+	}
+	if !rc.Online || !online {
+		return OCSPUnavailable
+	}
+
+	timeout := rc.Timeout
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	status, expires, err := queryOCSP(ctx, leaf, issuer)
+	if err != nil {
+		status, expires, err = checkCRL(ctx, leaf, issuer)
+	}
+	if err != nil {
+		return OCSPUnavailable
+	}
+	revocationCache.Lock()
+	revocationCache.entries[key] = cachedRevocation{status: status, expires: expires}
+	revocationCache.Unlock()
+	return status
+}
+
+// leafAndIssuer returns the server certificate and the certificate that signed it
+func leafAndIssuer(state utls.ConnectionState) (leaf, issuer *x509.Certificate) {
+	chain := state.PeerCertificates
+	if len(state.VerifiedChains) > 0 {
+		chain = state.VerifiedChains[0]
+	}
+	if len(chain) < 2 {
+		return nil, nil
+	}
+	return chain[0], chain[1]
+}
+
+func ocspStatus(status int) OCSPStatus {
+	switch status {
+	case ocsp.Good:
+		return OCSPGood
+	case ocsp.Revoked:
+		return OCSPRevoked
+	default:
+		return OCSPUnknown
+	}
+}
+
+// maxRevocationResponse bounds OCSP responses and CRLs read from the network
+const maxRevocationResponse = 10 << 20
+
+// queryOCSP asks the certificate's OCSP responder for its status
+func queryOCSP(ctx context.Context, leaf, issuer *x509.Certificate) (OCSPStatus, time.Time, error) {
+	if len(leaf.OCSPServer) == 0 {
+		return "", time.Time{}, errors.New("certificate has no OCSP responder")
+	}
+	reqBytes, err := ocsp.CreateRequest(leaf, issuer, nil)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	req, err := stdhttp.NewRequestWithContext(ctx, "POST", leaf.OCSPServer[0], bytes.NewReader(reqBytes))
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	req.Header.Set("Content-Type", "application/ocsp-request")
+	body, err := fetchRevocationData(req)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	resp, err := ocsp.ParseResponseForCert(body, leaf, issuer)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return ocspStatus(resp.Status), revocationExpiry(resp.NextUpdate), nil
+}
+
+// checkCRL looks the certificate up in its issuer's CRL
+func checkCRL(ctx context.Context, leaf, issuer *x509.Certificate) (OCSPStatus, time.Time, error) {
+	if len(leaf.CRLDistributionPoints) == 0 {
+		return "", time.Time{}, errors.New("certificate has no CRL distribution point")
+	}
+	req, err := stdhttp.NewRequestWithContext(ctx, "GET", leaf.CRLDistributionPoints[0], nil)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	body, err := fetchRevocationData(req)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	crl, err := x509.ParseRevocationList(body)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	if err := crl.CheckSignatureFrom(issuer); err != nil {
+		return "", time.Time{}, err
+	}
+	for _, entry := range crl.RevokedCertificateEntries {
+		if entry.SerialNumber.Cmp(leaf.SerialNumber) == 0 {
+			return OCSPRevoked, revocationExpiry(crl.NextUpdate), nil
+		}
+	}
+	return OCSPGood, revocationExpiry(crl.NextUpdate), nil
+}
+
+func fetchRevocationData(req *stdhttp.Request) ([]byte, error) {
+	resp, err := stdhttp.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != stdhttp.StatusOK {
+		return nil, fmt.Errorf("%s: status %d", req.URL, resp.StatusCode)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, maxRevocationResponse))
+}
+
+// tlsInfo returns the revocation check result for host's latest handshake
+func (t *HTTP1Transport) tlsInfo(host string) *TLSInfo { return t.revocation.info(host) }
+
+// tlsInfo returns the revocation check result for host's latest handshake
+func (t *HTTP2Transport) tlsInfo(host string) *TLSInfo { return t.revocation.info(host) }
+
+// tlsInfo returns the revocation check result for host's latest handshake
+func (t *HTTP3Transport) tlsInfo(host string) *TLSInfo { return t.revocation.info(host) }
+
+// revocationExpiry caches results until nextUpdate, for an hour when unset
+func revocationExpiry(nextUpdate time.Time) time.Time {
+	if nextUpdate.IsZero() {
+		return time.Now().Add(time.Hour)
+	}
+	return nextUpdate
+}
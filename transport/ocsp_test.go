@@ -0,0 +1,142 @@
+package transport
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	stdtls "crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	utls "github.com/sardanioss/utls"
+	"golang.org/x/crypto/ocsp"
+)
+
+// testPKI is a CA and a server certificate it issued
+type testPKI struct {
+	ca, leaf       *x509.Certificate
+	caKey, leafKey *ecdsa.PrivateKey
+}
+
+func newTestPKI(t *testing.T) *testPKI {
+	t.Helper()
+	p := &testPKI{}
+	var err error
+	if p.caKey, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader); err != nil {
+		t.Fatal(err)
+	}
+	if p.leafKey, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader); err != nil {
+		t.Fatal(err)
+	}
+	caTmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTmpl, caTmpl, &p.caKey.PublicKey, p.caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.ca, _ = x509.ParseCertificate(caDER)
+	leafTmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "127.0.0.1"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		DNSNames:     []string{"localhost"},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	leafDER, err := x509.CreateCertificate(rand.Reader, leafTmpl, p.ca, &p.leafKey.PublicKey, p.caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.leaf, _ = x509.ParseCertificate(leafDER)
+	return p
+}
+
+func (p *testPKI) staple(t *testing.T, status int, nextUpdate time.Time) []byte {
+	t.Helper()
+	resp, err := ocsp.CreateResponse(p.ca, p.ca, ocsp.Response{
+		Status:       status,
+		SerialNumber: p.leaf.SerialNumber,
+		ThisUpdate:   time.Now().Add(-time.Minute),
+		NextUpdate:   nextUpdate,
+		RevokedAt:    time.Now().Add(-time.Minute),
+	}, p.caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+func TestCertificateStatus(t *testing.T) {
+	p := newTestPKI(t)
+	rc := &RevocationCheck{}
+	state := func(staple []byte) utls.ConnectionState {
+		return utls.ConnectionState{PeerCertificates: []*x509.Certificate{p.leaf, p.ca}, OCSPResponse: staple}
+	}
+	later := time.Now().Add(time.Hour)
+
+	tests := []struct {
+		name   string
+		staple []byte
+		want   OCSPStatus
+	}{
+		{"good", p.staple(t, ocsp.Good, later), OCSPGood},
+		{"revoked", p.staple(t, ocsp.Revoked, later), OCSPRevoked},
+		{"expired", p.staple(t, ocsp.Good, time.Now().Add(-time.Second)), OCSPInvalid},
+		{"garbage", []byte("not ocsp"), OCSPInvalid},
+		{"no staple offline", nil, OCSPUnavailable},
+	}
+	for _, tt := range tests {
+		if got := certificateStatus(context.Background(), rc, true, state(tt.staple)); got != tt.want {
+			t.Errorf("%s: status = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRevocationCheckStapled(t *testing.T) {
+	p := newTestPKI(t)
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	srv.TLS = &stdtls.Config{Certificates: []stdtls.Certificate{{
+		Certificate: [][]byte{p.leaf.Raw, p.ca.Raw},
+		PrivateKey:  crypto.Signer(p.leafKey),
+		OCSPStaple:  p.staple(t, ocsp.Revoked, time.Now().Add(time.Hour)),
+	}}}
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	defer srv.Close()
+
+	do := func(rc *RevocationCheck) (*Response, error) {
+		tr := NewTransportWithConfig("chrome-latest", nil, &TransportConfig{RevocationCheck: rc})
+		defer tr.Close()
+		tr.SetInsecureSkipVerify(true)
+		tr.SetProtocol(ProtocolHTTP2)
+		return tr.Do(context.Background(), &Request{Method: "GET", URL: srv.URL})
+	}
+
+	resp, err := do(&RevocationCheck{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Close()
+	if resp.TLS == nil || resp.TLS.OCSPStatus != OCSPRevoked || !resp.TLS.OCSPStapled {
+		t.Errorf("TLS = %+v, want stapled revoked status", resp.TLS)
+	}
+
+	if _, err := do(&RevocationCheck{RejectRevoked: true}); !errors.Is(err, ErrCertificateRevoked) {
+		t.Errorf("err = %v, want ErrCertificateRevoked", err)
+	}
+}
@@ -0,0 +1,53 @@
+package transport
+
+import (
+	"fmt"
+	"io"
+	"runtime/debug"
+)
+
+// PanicError is a panic in a hook, decoder or parser that was recovered and
+// returned as the error of the request it happened in, so one bad response
+// can't take down a process serving many concurrent requests
+type PanicError struct {
+	Value any    // The value passed to panic
+	Stack []byte // Stack of the panicking goroutine
+}
+
+// NewPanicError creates a PanicError for a recovered value, capturing the
+// current stack. Call it from the deferred function that recovered.
+func NewPanicError(value any) *PanicError {
+	return &PanicError{Value: value, Stack: debug.Stack()}
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic during request: %v", e.Value)
+}
+
+// Unwrap matches ErrPanic and, when the panic value is an error, that error
+func (e *PanicError) Unwrap() []error {
+	if err, ok := e.Value.(error); ok {
+		return []error{ErrPanic, err}
+	}
+	return []error{ErrPanic}
+}
+
+// RecoverPanic recovers a panic in the function that defers it, replacing
+// its results with the zero value and a PanicError. It must be deferred
+// directly: defer RecoverPanic(&resp, &err).
+func RecoverPanic[T any](result *T, err *error) {
+	if v := recover(); v != nil {
+		var zero T
+		*result, *err = zero, NewPanicError(v)
+	}
+}
+
+// panicSafeReader recovers panics in the Read of a custom decoder
+type panicSafeReader struct {
+	io.ReadCloser
+}
+
+func (r panicSafeReader) Read(p []byte) (n int, err error) {
+	defer RecoverPanic(&n, &err)
+	return r.ReadCloser.Read(p)
+}
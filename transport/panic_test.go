@@ -0,0 +1,58 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type panicReader struct{}
+
+func (panicReader) Read([]byte) (int, error) { panic("decoder bug") }
+func (panicReader) Close() error             { return nil }
+
+func TestPanicIsolation(t *testing.T) {
+	RegisterDecoder("x-panic", func(io.Reader) io.ReadCloser { return panicReader{} })
+	defer RegisterDecoder("x-panic", nil)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Encoding", "x-panic")
+		w.Write([]byte("body"))
+	}))
+	defer srv.Close()
+
+	tr := NewTransport("chrome-latest")
+	defer tr.Close()
+	tr.SetProtocol(ProtocolHTTP1)
+
+	_, err := tr.Do(context.Background(), &Request{Method: "GET", URL: srv.URL})
+	var pe *PanicError
+	if !errors.As(err, &pe) || !errors.Is(err, ErrPanic) {
+		t.Fatalf("Do: err = %v, want a PanicError", err)
+	}
+	if pe.Value != "decoder bug" || !strings.Contains(string(pe.Stack), "panicReader") {
+		t.Errorf("PanicError value %v, stack:\n%s", pe.Value, pe.Stack)
+	}
+
+	// Streams decode on Read, after DoStream has returned
+	resp, err := tr.DoStream(context.Background(), &Request{Method: "GET", URL: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Close()
+	if _, err := io.ReadAll(resp); !errors.Is(err, ErrPanic) {
+		t.Errorf("stream Read: err = %v, want ErrPanic", err)
+	}
+
+	// The transport keeps serving requests
+	RegisterDecoder("x-panic", nil)
+	if resp, err := tr.Do(context.Background(), &Request{Method: "GET", URL: srv.URL}); err != nil {
+		t.Errorf("request after a panic: %v", err)
+	} else {
+		resp.Close()
+	}
+}
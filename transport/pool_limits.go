@@ -0,0 +1,446 @@
+package transport
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+
+	http "github.com/sardanioss/http"
+	"github.com/sardanioss/quic-go"
+	"github.com/sardanioss/quic-go/http3"
+)
+
+// PoolLimits bounds the connection pools of the HTTP/1.1, HTTP/2 and HTTP/3
+// transports, so long crawls over many hosts don't grow them without end.
+// Zero fields keep the defaults.
+type PoolLimits struct {
+	// MaxIdleConnsPerHost caps the idle HTTP/1.1 connections kept per host
+	// (default 6, like browsers). HTTP/2 and HTTP/3 use one connection per
+	// host.
+	MaxIdleConnsPerHost int
+
+	// MaxConns caps the connections open at once across hosts and
+	// protocols. A new connection over the cap first closes the least
+	// recently used idle one, and waits for one to close if none is idle.
+	// 0 means unlimited.
+	MaxConns int
+
+	// MaxConnAge retires connections this old: HTTP/1.1 and HTTP/2
+	// connections take no new requests, and connections close once idle.
+	// Defaults to 5m for HTTP/2 and no limit for HTTP/1.1 and HTTP/3.
+	MaxConnAge time.Duration
+
+	// IdleEvictionInterval is how often idle HTTP/1.1 and HTTP/2
+	// connections are swept (default 30s, 5s with LowFootprint). QUIC
+	// connections close on their own idle timeout.
+	IdleEvictionInterval time.Duration
+}
+
+// defaultMaxIdleConnsPerHost is the HTTP/1.1 idle connection cap per host
+const defaultMaxIdleConnsPerHost = 6
+
+// maxIdleConnsPerHost returns the HTTP/1.1 idle connection cap per host
+func maxIdleConnsPerHost(config *TransportConfig) int {
+	if config != nil && config.PoolLimits != nil && config.PoolLimits.MaxIdleConnsPerHost > 0 {
+		return config.PoolLimits.MaxIdleConnsPerHost
+	}
+	return defaultMaxIdleConnsPerHost
+}
+
+// maxConnAge returns PoolLimits.MaxConnAge, or def when it is unset
+func maxConnAge(config *TransportConfig, def time.Duration) time.Duration {
+	if config != nil && config.PoolLimits != nil && config.PoolLimits.MaxConnAge > 0 {
+		return config.PoolLimits.MaxConnAge
+	}
+	return def
+}
+
+// idlePool is a connection pool the connLimiter can close idle
+// connections of
+type idlePool interface {
+	// oldestIdle returns when the least recently used idle connection was
+	// last used, and false if no connection is idle
+	oldestIdle() (time.Time, bool)
+
+	// evictIdle closes the least recently used idle connection and reports
+	// whether there was one
+	evictIdle() bool
+
+	// closeIdle closes every idle connection
+	closeIdle()
+}
+
+// connLimiter enforces PoolLimits.MaxConns over the pools of one Transport
+type connLimiter struct {
+	max   int
+	pools []idlePool
+
+	mu       sync.Mutex
+	open     int
+	released chan struct{} // Closed when a connection closes
+}
+
+// newConnLimiter returns a limiter for config, nil without MaxConns
+func newConnLimiter(config *TransportConfig) *connLimiter {
+	if config == nil || config.PoolLimits == nil || config.PoolLimits.MaxConns <= 0 {
+		return nil
+	}
+	return &connLimiter{max: config.PoolLimits.MaxConns, released: make(chan struct{})}
+}
+
+// acquire takes a slot for a new connection, closing the least recently
+// used idle connection when the pools are full. The returned function
+// frees the slot once the connection closes; it may be called repeatedly.
+func (l *connLimiter) acquire(ctx context.Context) (func(), error) {
+	if l == nil {
+		return func() {}, nil
+	}
+	for {
+		l.mu.Lock()
+		if l.open < l.max {
+			l.open++
+			l.mu.Unlock()
+			var once sync.Once
+			return func() { once.Do(l.release) }, nil
+		}
+		released := l.released
+		pools := l.pools
+		l.mu.Unlock()
+
+		if !evictOldestIdle(pools) {
+			select {
+			case <-released:
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+	}
+}
+
+func (l *connLimiter) release() {
+	l.mu.Lock()
+	l.open--
+	close(l.released)
+	l.released = make(chan struct{})
+	l.mu.Unlock()
+}
+
+// evictOldestIdle closes the least recently used idle connection across
+// pools and reports whether there was one
+func evictOldestIdle(pools []idlePool) bool {
+	var oldest idlePool
+	var oldestUsed time.Time
+	for _, p := range pools {
+		if used, ok := p.oldestIdle(); ok && (oldest == nil || used.Before(oldestUsed)) {
+			oldest, oldestUsed = p, used
+		}
+	}
+	return oldest != nil && oldest.evictIdle()
+}
+
+// attachConnLimiter shares one connection limiter among the protocol
+// transports. Called whenever they are (re)created; caller holds t.mu.
+func (t *Transport) attachConnLimiter() {
+	if t.limiter == nil {
+		t.limiter = newConnLimiter(t.config)
+		if t.limiter == nil {
+			return
+		}
+	}
+	pools := []idlePool{t.h1Transport, t.h2Transport}
+	t.h1Transport.limiter = t.limiter
+	t.h2Transport.limiter = t.limiter
+	if t.h3Transport != nil {
+		t.h3Transport.limiter = t.limiter
+		pools = append(pools, t.h3Transport)
+	}
+	t.limiter.mu.Lock()
+	t.limiter.pools = pools
+	t.limiter.mu.Unlock()
+}
+
+// CloseIdleConnections closes the pooled connections no request is using,
+// on every protocol. Requests in flight are not affected.
+func (t *Transport) CloseIdleConnections() {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	t.h1Transport.closeIdle()
+	t.h2Transport.closeIdle()
+	if t.h3Transport != nil {
+		t.h3Transport.closeIdle()
+	}
+}
+
+func (t *HTTP1Transport) oldestIdle() (time.Time, bool) {
+	t.idleConnsMu.Lock()
+	defer t.idleConnsMu.Unlock()
+	var oldest time.Time
+	found := false
+	for _, conns := range t.idleConns {
+		// Pools are appended to, so the first is the least recently used
+		if len(conns) > 0 && (!found || conns[0].lastUsedAt.Before(oldest)) {
+			oldest, found = conns[0].lastUsedAt, true
+		}
+	}
+	return oldest, found
+}
+
+func (t *HTTP1Transport) evictIdle() bool {
+	t.idleConnsMu.Lock()
+	var oldestKey string
+	var oldest *http1Conn
+	for key, conns := range t.idleConns {
+		if len(conns) > 0 && (oldest == nil || conns[0].lastUsedAt.Before(oldest.lastUsedAt)) {
+			oldestKey, oldest = key, conns[0]
+		}
+	}
+	if oldest != nil {
+		if conns := t.idleConns[oldestKey][1:]; len(conns) > 0 {
+			t.idleConns[oldestKey] = conns
+		} else {
+			delete(t.idleConns, oldestKey)
+		}
+	}
+	t.idleConnsMu.Unlock()
+
+	if oldest == nil {
+		return false
+	}
+	oldest.close()
+	return true
+}
+
+func (t *HTTP1Transport) closeIdle() {
+	t.idleConnsMu.Lock()
+	idle := t.idleConns
+	t.idleConns = make(map[string][]*http1Conn)
+	t.idleConnsMu.Unlock()
+	for _, conns := range idle {
+		for _, conn := range conns {
+			conn.close()
+		}
+	}
+}
+
+// idle reports whether no request is using the connection
+func (c *persistentConn) idle() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.inFlight == 0 && (c.h2Conn == nil || c.h2Conn.State().StreamsActive == 0)
+}
+
+func (t *HTTP2Transport) oldestIdle() (time.Time, bool) {
+	_, conn := t.oldestIdleConn()
+	if conn == nil {
+		return time.Time{}, false
+	}
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+	return conn.lastUsedAt, true
+}
+
+// oldestIdleConn returns the least recently used idle connection
+func (t *HTTP2Transport) oldestIdleConn() (string, *persistentConn) {
+	t.connsMu.RLock()
+	defer t.connsMu.RUnlock()
+	var oldestKey string
+	var oldest *persistentConn
+	var oldestUsed time.Time
+	for key, conn := range t.conns {
+		if !conn.idle() {
+			continue
+		}
+		conn.mu.Lock()
+		used := conn.lastUsedAt
+		conn.mu.Unlock()
+		if oldest == nil || used.Before(oldestUsed) {
+			oldestKey, oldest, oldestUsed = key, conn, used
+		}
+	}
+	return oldestKey, oldest
+}
+
+func (t *HTTP2Transport) evictIdle() bool {
+	key, conn := t.oldestIdleConn()
+	if conn == nil {
+		return false
+	}
+	t.dropConn(key, conn)
+	return true
+}
+
+func (t *HTTP2Transport) closeIdle() {
+	t.connsMu.Lock()
+	defer t.connsMu.Unlock()
+	for key, conn := range t.conns {
+		if conn.idle() {
+			delete(t.conns, key)
+			go conn.close()
+		}
+	}
+}
+
+// h3PoolAddr tracks the QUIC connections to one address, which http3.Transport
+// pools out of sight, and the requests using them
+type h3PoolAddr struct {
+	conns    []*quic.Conn
+	retired  map[*quic.Conn]bool // Past MaxConnAge, closed once idle
+	inFlight int
+	lastUsed time.Time
+}
+
+// h3PoolAddrs returns the tracked address state, creating it. Caller holds
+// t.poolMu.
+func (t *HTTP3Transport) h3PoolAddrs(addr string) *h3PoolAddr {
+	if t.poolAddrs == nil {
+		t.poolAddrs = make(map[string]*h3PoolAddr)
+	}
+	a, ok := t.poolAddrs[addr]
+	if !ok {
+		a = &h3PoolAddr{lastUsed: time.Now()}
+		t.poolAddrs[addr] = a
+	}
+	return a
+}
+
+// trackConn tracks a new QUIC connection to addr until it closes, and
+// retires it after MaxConnAge
+func (t *HTTP3Transport) trackConn(addr string, conn *quic.Conn) {
+	t.poolMu.Lock()
+	a := t.h3PoolAddrs(addr)
+	a.conns = append(a.conns, conn)
+	t.poolMu.Unlock()
+
+	var retire *time.Timer
+	if age := maxConnAge(t.config, 0); age > 0 {
+		retire = time.AfterFunc(age, func() {
+			t.poolMu.Lock()
+			idle := a.inFlight == 0
+			if !idle {
+				if a.retired == nil {
+					a.retired = make(map[*quic.Conn]bool)
+				}
+				a.retired[conn] = true
+			}
+			t.poolMu.Unlock()
+			if idle {
+				closeQUICConn(conn)
+			}
+		})
+	}
+	context.AfterFunc(conn.Context(), func() {
+		if retire != nil {
+			retire.Stop()
+		}
+		t.poolMu.Lock()
+		defer t.poolMu.Unlock()
+		for i, c := range a.conns {
+			if c == conn {
+				a.conns = append(a.conns[:i], a.conns[i+1:]...)
+				break
+			}
+		}
+		delete(a.retired, conn)
+		if len(a.conns) == 0 && a.inFlight == 0 && t.poolAddrs[addr] == a {
+			delete(t.poolAddrs, addr)
+		}
+	})
+}
+
+// beginRequest marks a request to addr in flight. The returned function
+// ends it and closes retired connections left idle; it may be called
+// repeatedly.
+func (t *HTTP3Transport) beginRequest(addr string) func() {
+	t.poolMu.Lock()
+	a := t.h3PoolAddrs(addr)
+	a.inFlight++
+	a.lastUsed = time.Now()
+	t.poolMu.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			t.poolMu.Lock()
+			a.inFlight--
+			a.lastUsed = time.Now()
+			var retired []*quic.Conn
+			if a.inFlight == 0 {
+				for conn := range a.retired {
+					retired = append(retired, conn)
+				}
+			}
+			t.poolMu.Unlock()
+			for _, conn := range retired {
+				closeQUICConn(conn)
+			}
+		})
+	}
+}
+
+func (t *HTTP3Transport) oldestIdle() (time.Time, bool) {
+	_, a := t.oldestIdleAddr()
+	if a == nil {
+		return time.Time{}, false
+	}
+	t.poolMu.Lock()
+	defer t.poolMu.Unlock()
+	return a.lastUsed, true
+}
+
+// oldestIdleAddr returns the least recently used address with open
+// connections and no requests
+func (t *HTTP3Transport) oldestIdleAddr() (string, *h3PoolAddr) {
+	t.poolMu.Lock()
+	defer t.poolMu.Unlock()
+	var oldestAddr string
+	var oldest *h3PoolAddr
+	for addr, a := range t.poolAddrs {
+		if a.inFlight == 0 && len(a.conns) > 0 && (oldest == nil || a.lastUsed.Before(oldest.lastUsed)) {
+			oldestAddr, oldest = addr, a
+		}
+	}
+	return oldestAddr, oldest
+}
+
+func (t *HTTP3Transport) evictIdle() bool {
+	_, a := t.oldestIdleAddr()
+	if a == nil {
+		return false
+	}
+	t.poolMu.Lock()
+	conns := append([]*quic.Conn(nil), a.conns...)
+	t.poolMu.Unlock()
+	for _, conn := range conns {
+		closeQUICConn(conn)
+	}
+	return true
+}
+
+func (t *HTTP3Transport) closeIdle() {
+	var conns []*quic.Conn
+	t.poolMu.Lock()
+	for _, a := range t.poolAddrs {
+		if a.inFlight == 0 {
+			conns = append(conns, a.conns...)
+		}
+	}
+	t.poolMu.Unlock()
+	for _, conn := range conns {
+		closeQUICConn(conn)
+	}
+}
+
+// closeQUICConn closes an idle QUIC connection. http3.Transport notices on
+// the next request and dials a new one.
+func closeQUICConn(conn *quic.Conn) {
+	conn.CloseWithError(quic.ApplicationErrorCode(http3.ErrCodeNoError), "")
+}
+
+// poolAddr is the address http3.Transport pools the request's connection by
+func poolAddr(req *http.Request) string {
+	if req.URL.Port() == "" {
+		return net.JoinHostPort(req.URL.Hostname(), "443")
+	}
+	return req.URL.Host
+}
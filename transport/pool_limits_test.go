@@ -0,0 +1,94 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"net"
+	stdhttp "net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPoolLimits(t *testing.T) {
+	var dials atomic.Int32
+	newServer := func() *httptest.Server {
+		srv := httptest.NewUnstartedServer(stdhttp.HandlerFunc(func(w stdhttp.ResponseWriter, r *stdhttp.Request) {
+			if r.URL.Path == "/hold" {
+				w.(stdhttp.Flusher).Flush()
+				time.Sleep(300 * time.Millisecond)
+			}
+		}))
+		srv.Config.ConnState = func(c net.Conn, state stdhttp.ConnState) {
+			if state == stdhttp.StateNew {
+				dials.Add(1)
+			}
+		}
+		srv.Start()
+		return srv
+	}
+	a, b, c := newServer(), newServer(), newServer()
+	defer a.Close()
+	defer b.Close()
+	defer c.Close()
+
+	tr := NewTransportWithConfig("chrome-latest", nil, &TransportConfig{
+		PoolLimits: &PoolLimits{MaxConns: 2, MaxConnAge: 300 * time.Millisecond},
+	})
+	defer tr.Close()
+	tr.SetProtocol(ProtocolHTTP1)
+	get := func(ctx context.Context, url string) error {
+		resp, err := tr.Do(ctx, &Request{Method: "GET", URL: url})
+		if err == nil {
+			resp.Close()
+		}
+		return err
+	}
+
+	// A third host evicts the least recently used idle connection
+	for _, srv := range []*httptest.Server{a, b, c} {
+		if err := get(context.Background(), srv.URL); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := tr.ConnCounts().HTTP1Idle; n != 2 {
+		t.Errorf("%d idle connections, want 2", n)
+	}
+	if err := get(context.Background(), c.URL); err != nil || dials.Load() != 3 {
+		t.Errorf("err = %v after %d dials, want c's connection reused", err, dials.Load())
+	}
+
+	// With every connection busy, a new one waits
+	tr.CloseIdleConnections()
+	if n := tr.ConnCounts().HTTP1Idle; n != 0 {
+		t.Errorf("%d idle connections after CloseIdleConnections", n)
+	}
+	var streams []*StreamResponse
+	for _, srv := range []*httptest.Server{a, b} {
+		stream, err := tr.DoStream(context.Background(), &Request{Method: "GET", URL: srv.URL + "/hold"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		streams = append(streams, stream)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := get(ctx, c.URL); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("err = %v, want to wait for a connection", err)
+	}
+	streams[0].Close()
+	if err := get(context.Background(), c.URL); err != nil {
+		t.Errorf("after a connection closed: %v", err)
+	}
+	streams[1].Close()
+
+	// Connections past MaxConnAge are not reused
+	before := dials.Load()
+	get(context.Background(), a.URL)
+	time.Sleep(400 * time.Millisecond)
+	get(context.Background(), a.URL)
+	if n := dials.Load() - before; n != 2 {
+		t.Errorf("%d dials, want a new connection after MaxConnAge", n)
+	}
+}
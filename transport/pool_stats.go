@@ -0,0 +1,217 @@
+package transport
+
+import (
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PoolStats is a snapshot of the transport's connections, returned by Stats
+type PoolStats struct {
+	// Conns counts the pooled connections per protocol
+	Conns ConnCounts
+
+	// Hosts has the connections and traffic per hostname
+	Hosts map[string]HostPoolStats
+
+	// Per-connection detail of each protocol's pool
+	HTTP1 map[string]HTTP1ConnStats // Idle connections per scheme://host:port
+	HTTP2 map[string]ConnStats      // Per host:port
+	HTTP3 HTTP3Stats
+}
+
+// HostPoolStats is the state of the connections to one host. Requests and
+// bytes are counted as in HostStats and reset with ResetHostStats; the other
+// counters run for the life of the transport.
+type HostPoolStats struct {
+	Protocol      string        // Protocol of the latest request: "h1", "h2" or "h3"
+	OpenConns     int           // Connections open, busy or idle
+	IdleConns     int           // Open connections no request is using
+	Handshakes    int64         // TLS handshakes, QUIC included
+	Resumed       int64         // Handshakes that resumed a TLS session
+	Requests      int64         // Completed requests
+	BytesSent     int64         // Request bytes, see HostStats
+	BytesReceived int64         // Response bytes, see HostStats
+	RTT           time.Duration // Average round-trip time, see below
+}
+
+// ResumptionRate returns the share of handshakes that resumed a session,
+// 0 before the first handshake
+func (s HostPoolStats) ResumptionRate() float64 {
+	if s.Handshakes == 0 {
+		return 0
+	}
+	return float64(s.Resumed) / float64(s.Handshakes)
+}
+
+// connStatsTable tracks connections per hostname. RTT samples are the
+// duration of each TCP TLS handshake, which takes one round trip end to end
+// (through any proxy), and the QUIC stack's smoothed RTT once a QUIC
+// handshake completes. Plain-HTTP connections give no sample.
+type connStatsTable struct {
+	mu    sync.Mutex
+	hosts map[string]*connStats
+}
+
+type connStats struct {
+	protocol   string
+	open       int
+	handshakes int64
+	resumed    int64
+	rttTotal   time.Duration
+	rttSamples int64
+}
+
+// get returns the host's entry, creating it. Caller holds c.mu.
+func (c *connStatsTable) get(host string) *connStats {
+	host = strings.ToLower(host)
+	if c.hosts == nil {
+		c.hosts = make(map[string]*connStats)
+	}
+	s, ok := c.hosts[host]
+	if !ok {
+		s = &connStats{}
+		c.hosts[host] = s
+	}
+	return s
+}
+
+// opened counts a new connection to host. It returns the function to call
+// when the connection closes, which also calls release; the function may be
+// called repeatedly.
+func (c *connStatsTable) opened(host string, release func()) func() {
+	if c == nil {
+		return release
+	}
+	c.mu.Lock()
+	c.get(host).open++
+	c.mu.Unlock()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			c.mu.Lock()
+			c.get(host).open--
+			c.mu.Unlock()
+			if release != nil {
+				release()
+			}
+		})
+	}
+}
+
+// handshake records a completed TLS handshake with host
+func (c *connStatsTable) handshake(host string, resumed bool, rtt time.Duration) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s := c.get(host)
+	s.handshakes++
+	if resumed {
+		s.resumed++
+	}
+	if rtt > 0 {
+		s.rttTotal += rtt
+		s.rttSamples++
+	}
+}
+
+// used records the protocol of a completed request to host
+func (c *connStatsTable) used(host, protocol string) {
+	c.mu.Lock()
+	c.get(host).protocol = protocol
+	c.mu.Unlock()
+}
+
+// attachConnStats shares the connection stats table with the protocol
+// transports. Called whenever they are (re)created; caller holds t.mu.
+func (t *Transport) attachConnStats() {
+	t.h1Transport.connStats = &t.connStats
+	t.h2Transport.connStats = &t.connStats
+	if t.h3Transport != nil {
+		t.h3Transport.connStats = &t.connStats
+	}
+}
+
+// Stats returns a snapshot of the transport's connection pools
+func (t *Transport) Stats() PoolStats {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	stats := PoolStats{
+		Conns: t.connCounts(),
+		Hosts: make(map[string]HostPoolStats),
+		HTTP1: t.h1Transport.Stats(),
+		HTTP2: t.h2Transport.Stats(),
+	}
+	if t.h3Transport != nil {
+		stats.HTTP3 = t.h3Transport.Stats()
+	}
+
+	t.connStats.mu.Lock()
+	for host, s := range t.connStats.hosts {
+		hs := HostPoolStats{
+			Protocol:   s.protocol,
+			OpenConns:  s.open,
+			Handshakes: s.handshakes,
+			Resumed:    s.resumed,
+		}
+		if s.rttSamples > 0 {
+			hs.RTT = s.rttTotal / time.Duration(s.rttSamples)
+		}
+		stats.Hosts[host] = hs
+	}
+	t.connStats.mu.Unlock()
+
+	for host, traffic := range t.HostStats() {
+		hs := stats.Hosts[host]
+		hs.Requests = traffic.Requests
+		hs.BytesSent = traffic.BytesSent
+		hs.BytesReceived = traffic.BytesReceived
+		stats.Hosts[host] = hs
+	}
+	for host, idle := range t.idleConnsPerHost() {
+		hs := stats.Hosts[host]
+		hs.IdleConns = idle
+		stats.Hosts[host] = hs
+	}
+	return stats
+}
+
+// idleConnsPerHost counts the idle connections of every protocol per
+// hostname. Caller holds t.mu.RLock.
+func (t *Transport) idleConnsPerHost() map[string]int {
+	idle := make(map[string]int)
+
+	t.h1Transport.idleConnsMu.Lock()
+	for _, conns := range t.h1Transport.idleConns {
+		for _, conn := range conns {
+			idle[strings.ToLower(conn.host)]++
+		}
+	}
+	t.h1Transport.idleConnsMu.Unlock()
+
+	t.h2Transport.connsMu.RLock()
+	for _, conn := range t.h2Transport.conns {
+		conn.mu.Lock()
+		if conn.inFlight == 0 {
+			idle[strings.ToLower(conn.host)]++
+		}
+		conn.mu.Unlock()
+	}
+	t.h2Transport.connsMu.RUnlock()
+
+	if h3 := t.h3Transport; h3 != nil {
+		h3.poolMu.Lock()
+		for addr, a := range h3.poolAddrs {
+			if a.inFlight == 0 {
+				host, _, _ := net.SplitHostPort(addr)
+				idle[strings.ToLower(host)] += len(a.conns)
+			}
+		}
+		h3.poolMu.Unlock()
+	}
+	return idle
+}
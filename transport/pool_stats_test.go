@@ -0,0 +1,44 @@
+package transport
+
+import (
+	"context"
+	stdhttp "net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestPoolStats(t *testing.T) {
+	srv := httptest.NewUnstartedServer(stdhttp.HandlerFunc(func(w stdhttp.ResponseWriter, r *stdhttp.Request) {
+		w.Write([]byte("hello"))
+	}))
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	defer srv.Close()
+
+	tr := NewTransport("chrome-latest")
+	defer tr.Close()
+	tr.SetProtocol(ProtocolHTTP2)
+	tr.SetInsecureSkipVerify(true)
+	get := func() {
+		resp, err := tr.Do(context.Background(), &Request{Method: "GET", URL: srv.URL})
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Close()
+	}
+
+	get()
+	get()
+	hs := tr.Stats().Hosts["127.0.0.1"]
+	if hs.Protocol != "h2" || hs.OpenConns != 1 || hs.IdleConns != 1 || hs.Handshakes != 1 || hs.Requests != 2 || hs.BytesReceived == 0 || hs.RTT <= 0 {
+		t.Errorf("stats after two requests: %+v", hs)
+	}
+
+	// A new connection resumes the TLS session
+	tr.Refresh()
+	get()
+	hs = tr.Stats().Hosts["127.0.0.1"]
+	if hs.OpenConns != 1 || hs.Handshakes != 2 || hs.ResumptionRate() != 0.5 {
+		t.Errorf("stats after refresh: %+v", hs)
+	}
+}
@@ -0,0 +1,312 @@
+package transport
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"time"
+
+	"github.com/sardanioss/net/http2"
+	"github.com/sardanioss/quic-go"
+	"github.com/sardanioss/quic-go/http3"
+	utls "github.com/sardanioss/utls"
+)
+
+// PreconnectOptions tunes Preconnect
+type PreconnectOptions struct {
+	// AwaitSettings waits for the server's SETTINGS frame on a new HTTP/2
+	// connection, so the first request goes out knowing the server's
+	// limits. Without it Preconnect returns once TLS is done; our preface
+	// and SETTINGS are sent either way.
+	AwaitSettings bool
+}
+
+// Preconnect opens a connection to origin (scheme://host[:port]) without
+// sending a request, as a browser does for <link rel=preconnect>: DNS, TCP
+// or QUIC, and TLS. The connection is pooled for the next request to origin,
+// taking the handshakes off that request's critical path. The protocol is
+// the one a request would use; in auto mode HTTP/3 falls back to HTTP/2, and
+// an HTTP/1.1-only server gets an HTTP/1.1 connection. Nothing is dialed
+// when a connection to origin is already open.
+//
+// Like a request, Preconnect is refused by the host policy and goes through
+// the proxy a request to origin would use: the explicit, environment, PAC or
+// pool proxy. A pool picks its proxy per request, so the connection only
+// helps a later request that gets the same proxy.
+func (t *Transport) Preconnect(ctx context.Context, origin string, opts PreconnectOptions) error {
+	u, err := url.Parse(origin)
+	if err != nil {
+		return NewRequestError("parse_url", "", "", "", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" || u.Host == "" {
+		return NewRequestError("parse_url", "", "", "", fmt.Errorf("preconnect: invalid origin %q", origin))
+	}
+	host, port := u.Hostname(), u.Port()
+	if port == "" {
+		port = "443"
+		if u.Scheme == "http" {
+			port = "80"
+		}
+	}
+
+	s := t.acquire()
+	defer s.release()
+
+	if err := s.checkHostPolicy(ctx, origin); err != nil {
+		return err
+	}
+	if rt, err := s.routedTransport(ctx, origin); err != nil {
+		return err
+	} else if rt != nil {
+		return rt.Preconnect(ctx, origin, opts)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	if u.Scheme == "http" {
+		return s.h1Transport.Preconnect(ctx, host, port, "http")
+	}
+
+	auto := s.protocol == ProtocolAuto
+	p, err := s.preconnectProtocol(origin, host)
+	if err != nil {
+		return err
+	}
+	if p == ProtocolHTTP3 {
+		err = errors.New("HTTP/3 transport unavailable")
+		if s.h3Transport != nil {
+			err = s.h3Transport.Preconnect(ctx, host, port)
+		}
+		if err == nil || !auto {
+			return WrapError("preconnect", host, port, "h3", err)
+		}
+		p = ProtocolHTTP2
+	}
+	if p == ProtocolHTTP2 {
+		err = s.h2Transport.Preconnect(ctx, host, port, opts.AwaitSettings)
+		var alpnErr *ALPNMismatchError
+		if errors.As(err, &alpnErr) {
+			if !auto {
+				alpnErr.TLSConn.Close()
+				return WrapError("preconnect", host, port, "h2", err)
+			}
+			// Keep the handshake for HTTP/1.1, as a request would
+			s.h1Transport.adoptTLSConn(alpnErr.TLSConn, host, port)
+			s.protocolSupportMu.Lock()
+			s.protocolSupport[host] = ProtocolHTTP1
+			s.protocolSupportMu.Unlock()
+			return nil
+		}
+		if err == nil || !auto {
+			return WrapError("preconnect", host, port, "h2", err)
+		}
+	}
+	return s.h1Transport.Preconnect(ctx, host, port, "https")
+}
+
+// routedTransport returns the transport of the environment, PAC or pool
+// proxy a request to rawURL would go through, following doRequest, or nil
+// when it goes through this transport. Of the proxies a selector returns,
+// only the first is used. Runs on a request snapshot.
+func (t *Transport) routedTransport(ctx context.Context, rawURL string) (*Transport, error) {
+	if et := t.environmentTransport(rawURL); et != nil {
+		return et, nil
+	}
+	if selector := t.proxySelector(); selector != nil {
+		paths, err := selectProxies(ctx, selector, rawURL)
+		if err != nil {
+			return nil, err
+		}
+		return t.proxyTransport(paths[0]), nil
+	}
+	if pool := t.proxyPool(); pool != nil {
+		proxyURL, err := nextPoolProxy(pool, rawURL)
+		if err != nil {
+			return nil, err
+		}
+		return t.proxyTransport(proxyURL), nil
+	}
+	return nil, nil
+}
+
+// preconnectProtocol returns the protocol a request to origin would start
+// with, following do and doAuto
+func (t *Transport) preconnectProtocol(origin, host string) (Protocol, error) {
+	if t.proxy != nil && (t.proxy.URL != "" || t.proxy.TCPProxy != "" || t.proxy.UDPProxy != "") {
+		switch t.protocol {
+		case ProtocolHTTP1:
+			return ProtocolHTTP1, nil
+		case ProtocolHTTP3:
+			if err := t.checkH3Proxy(); err != nil {
+				return 0, err
+			}
+			return ProtocolHTTP3, nil
+		case ProtocolAuto:
+			if t.h3ProxyError == nil && t.checkH3Proxy() == nil {
+				return ProtocolHTTP3, nil
+			}
+		}
+		return ProtocolHTTP2, nil
+	}
+
+	switch t.protocol {
+	case ProtocolHTTP1, ProtocolHTTP2, ProtocolHTTP3:
+		return t.protocol, nil
+	case ProtocolAuto:
+		t.protocolSupportMu.RLock()
+		known, ok := t.protocolSupport[host]
+		t.protocolSupportMu.RUnlock()
+		if ok {
+			return known, nil
+		}
+		if t.altSvcH3(origin) {
+			return ProtocolHTTP3, nil
+		}
+	}
+	return ProtocolHTTP2, nil
+}
+
+// Preconnect dials a connection to host:port into the idle pool, unless one
+// is idle there already
+func (t *HTTP1Transport) Preconnect(ctx context.Context, host, port, scheme string) error {
+	key := fmt.Sprintf("%s://%s:%s", scheme, t.getConnectHost(host), port)
+	t.idleConnsMu.Lock()
+	idle := len(t.idleConns[key])
+	t.idleConnsMu.Unlock()
+	if idle > 0 {
+		return nil
+	}
+
+	conn, err := t.createConn(ctx, host, port, scheme)
+	if err != nil {
+		return WrapError("preconnect", host, port, "h1", err)
+	}
+	t.putIdleConn(key, conn)
+	return nil
+}
+
+// adoptTLSConn pools a TLS connection whose server chose HTTP/1.1 over
+// HTTP/2 as an idle HTTP/1.1 connection
+func (t *HTTP1Transport) adoptTLSConn(tlsConn *utls.UConn, host, port string) {
+	key := fmt.Sprintf("https://%s:%s", t.getConnectHost(host), port)
+	t.putIdleConn(key, &http1Conn{
+		host:       host,
+		port:       port,
+		conn:       tlsConn,
+		tlsConn:    tlsConn,
+		createdAt:  time.Now(),
+		lastUsedAt: time.Now(),
+		br:         bufio.NewReaderSize(tlsConn, 64*1024),
+		bw:         bufio.NewWriterSize(tlsConn, 256*1024),
+		release:    t.connStats.opened(host, nil),
+	})
+}
+
+// Preconnect opens (or reuses) the pooled connection to host:port. With
+// awaitSettings it also waits for the server's SETTINGS frame.
+func (t *HTTP2Transport) Preconnect(ctx context.Context, host, port string, awaitSettings bool) error {
+	t.connsMu.RLock()
+	closed := t.closed
+	t.connsMu.RUnlock()
+	if closed {
+		return fmt.Errorf("http2: transport closed")
+	}
+
+	key := net.JoinHostPort(t.getConnectHost(host), port)
+	conn, err := t.getOrCreateConn(ctx, host, port, key)
+	if err != nil || !awaitSettings {
+		return err
+	}
+	return awaitPeerSettings(ctx, conn.h2Conn)
+}
+
+// awaitPeerSettings waits until cc has read the server's first SETTINGS
+// frame. The client connection exposes this only through State, which
+// reports MaxConcurrentStreams as 0 until then.
+func awaitPeerSettings(ctx context.Context, cc *http2.ClientConn) error {
+	tick := time.NewTicker(5 * time.Millisecond)
+	defer tick.Stop()
+	for {
+		state := cc.State()
+		if state.MaxConcurrentStreams > 0 {
+			return nil
+		}
+		if state.Closed {
+			return errors.New("http2: connection closed before the server's SETTINGS")
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-tick.C:
+		}
+	}
+}
+
+// Preconnect opens a QUIC connection to host:port and completes its
+// handshake. http3.Transport pools connections out of reach, so the
+// connection is parked until http3.Transport next dials the address, which
+// then gets it instead of a new one.
+func (t *HTTP3Transport) Preconnect(ctx context.Context, host, port string) error {
+	addr := net.JoinHostPort(t.getConnectHost(host), port)
+	t.poolMu.Lock()
+	open := t.poolAddrs[addr] != nil && len(t.poolAddrs[addr].conns) > 0
+	t.poolMu.Unlock()
+	if open {
+		return nil
+	}
+
+	t.mu.RLock()
+	transport := t.transport
+	t.mu.RUnlock()
+
+	// Dial with the configs http3.Transport would use for addr
+	tlsCfg := transport.TLSClientConfig.Clone()
+	if tlsCfg.ServerName == "" {
+		tlsCfg.ServerName, _, _ = net.SplitHostPort(addr)
+	}
+	tlsCfg.NextProtos = []string{http3.NextProtoH3}
+	quicCfg := transport.QUICConfig
+	if len(quicCfg.Versions) == 0 {
+		quicCfg = quicCfg.Clone()
+		quicCfg.Versions = []quic.Version{quic.SupportedVersions()[0]}
+	}
+
+	conn, err := transport.Dial(ctx, addr, tlsCfg, quicCfg)
+	if err != nil {
+		return err
+	}
+	select {
+	case <-conn.HandshakeComplete():
+	case <-ctx.Done():
+		closeQUICConn(conn)
+		return ctx.Err()
+	}
+
+	t.poolMu.Lock()
+	if t.preconnected == nil {
+		t.preconnected = make(map[string]*quic.Conn)
+	}
+	old := t.preconnected[addr]
+	t.preconnected[addr] = conn
+	t.poolMu.Unlock()
+	if old != nil {
+		closeQUICConn(old)
+	}
+	return nil
+}
+
+// takePreconnected returns the open preconnected connection to addr, if any
+func (t *HTTP3Transport) takePreconnected(addr string) *quic.Conn {
+	t.poolMu.Lock()
+	defer t.poolMu.Unlock()
+	conn := t.preconnected[addr]
+	delete(t.preconnected, addr)
+	if conn == nil || conn.Context().Err() != nil {
+		return nil
+	}
+	return conn
+}
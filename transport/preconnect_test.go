@@ -0,0 +1,159 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"net"
+	stdhttp "net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	shttp "github.com/sardanioss/http"
+	"github.com/sardanioss/httpcloak/proxy"
+	"github.com/sardanioss/quic-go/http3"
+	utls "github.com/sardanioss/utls"
+)
+
+func TestPreconnect(t *testing.T) {
+	var dials atomic.Int32
+	newServer := func(h2 bool) *httptest.Server {
+		srv := httptest.NewUnstartedServer(stdhttp.HandlerFunc(func(w stdhttp.ResponseWriter, r *stdhttp.Request) {}))
+		srv.EnableHTTP2 = h2
+		srv.Config.ConnState = func(c net.Conn, state stdhttp.ConnState) {
+			if state == stdhttp.StateNew {
+				dials.Add(1)
+			}
+		}
+		srv.StartTLS()
+		return srv
+	}
+
+	for _, tc := range []struct {
+		name     string
+		protocol Protocol
+		h2       bool
+	}{
+		{"h2", ProtocolHTTP2, true},
+		{"auto h2", ProtocolAuto, true},
+		{"auto h1 server", ProtocolAuto, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dials.Store(0)
+			srv := newServer(tc.h2)
+			defer srv.Close()
+			tr := NewTransport("chrome-latest")
+			defer tr.Close()
+			tr.SetProtocol(tc.protocol)
+			tr.SetInsecureSkipVerify(true)
+
+			for i := 0; i < 2; i++ {
+				if err := tr.Preconnect(context.Background(), srv.URL, PreconnectOptions{AwaitSettings: true}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if tc.h2 {
+				key := srv.Listener.Addr().String()
+				if n := tr.h2Transport.conns[key].h2Conn.State().MaxConcurrentStreams; n == 0 {
+					t.Error("preconnected without the server's SETTINGS")
+				}
+			}
+			resp, err := tr.Do(context.Background(), &Request{Method: "GET", URL: srv.URL})
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Close()
+			if n := dials.Load(); n != 1 {
+				t.Errorf("%d connections, want the preconnected one only", n)
+			}
+		})
+	}
+}
+
+// TestPreconnectRouting checks that Preconnect is held to the host policy and
+// sent through the proxy a request would use, never straight to the origin
+func TestPreconnectRouting(t *testing.T) {
+	var dials atomic.Int32
+	srv := httptest.NewUnstartedServer(stdhttp.HandlerFunc(func(w stdhttp.ResponseWriter, r *stdhttp.Request) {}))
+	srv.Config.ConnState = func(c net.Conn, state stdhttp.ConnState) {
+		if state == stdhttp.StateNew {
+			dials.Add(1)
+		}
+	}
+	srv.StartTLS()
+	defer srv.Close()
+
+	policy, err := NewHostPolicy(nil, []string{"127.0.0.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := NewTransport("chrome-latest")
+	defer tr.Close()
+	tr.SetInsecureSkipVerify(true)
+	tr.SetHostPolicy(policy)
+	if _, err := tr.Do(context.Background(), &Request{Method: "GET", URL: srv.URL}); !errors.Is(err, ErrHostBlocked) {
+		t.Fatalf("request to a denied host: err = %v", err)
+	}
+	if err := tr.Preconnect(context.Background(), srv.URL, PreconnectOptions{}); !errors.Is(err, ErrHostBlocked) {
+		t.Errorf("preconnect to a denied host: err = %v, want ErrHostBlocked", err)
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dead := "http://" + ln.Addr().String()
+	ln.Close()
+	pool, err := proxy.NewPool([]string{dead}, proxy.PoolOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr = NewTransportWithConfig("chrome-latest", nil, &TransportConfig{ProxyPool: pool})
+	defer tr.Close()
+	tr.SetInsecureSkipVerify(true)
+	if err := tr.Preconnect(context.Background(), srv.URL, PreconnectOptions{}); !IsProxyError(err) {
+		t.Errorf("preconnect through a dead pool proxy: err = %v, want a proxy error", err)
+	}
+
+	if n := dials.Load(); n != 0 {
+		t.Errorf("%d direct connections to the origin, want 0", n)
+	}
+}
+
+func TestPreconnectH3(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("udp unavailable: %v", err)
+	}
+	srv := &http3.Server{
+		TLSConfig: http3.ConfigureTLSConfig(&utls.Config{Certificates: []utls.Certificate{selfSignedCert(t)}}),
+		Handler:   shttp.HandlerFunc(func(w shttp.ResponseWriter, r *shttp.Request) {}),
+	}
+	go srv.Serve(pc)
+	defer srv.Close()
+
+	tr := NewTransport("chrome-latest")
+	defer tr.Close()
+	tr.SetProtocol(ProtocolHTTP3)
+	tr.SetInsecureSkipVerify(true)
+	addr := pc.LocalAddr().String()
+
+	for i := 0; i < 2; i++ {
+		if err := tr.Preconnect(context.Background(), "https://"+addr, PreconnectOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := tr.h3Transport.GetDialCount(); n != 1 {
+		t.Errorf("%d QUIC dials, want 1", n)
+	}
+	// http3.Transport's next dial of the address gets the connection
+	conn, err := tr.h3Transport.transport.Dial(context.Background(), addr, nil, nil)
+	if err != nil || tr.h3Transport.GetDialCount() != 1 {
+		t.Fatalf("dial after preconnect: err = %v, %d dials", err, tr.h3Transport.GetDialCount())
+	}
+	select {
+	case <-conn.HandshakeComplete():
+	default:
+		t.Error("preconnected connection handed out before its handshake")
+	}
+}
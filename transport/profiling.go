@@ -0,0 +1,39 @@
+package transport
+
+import (
+	"context"
+	"runtime/pprof"
+	"sync/atomic"
+)
+
+// profilerLabels is set by SetProfilerLabels
+var profilerLabels atomic.Bool
+
+// SetProfilerLabels tags the goroutines running each request with the pprof
+// labels "httpcloak.host" and "httpcloak.method". Goroutines started for the
+// request (dials, protocol racing) inherit them, so CPU, goroutine and
+// allocation-heavy profiles can be split by target host:
+//
+//	go tool pprof -tagfocus httpcloak.host=example.com cpu.pprof
+//
+// Off by default; enabling it costs a few small allocations per request.
+func SetProfilerLabels(enabled bool) {
+	profilerLabels.Store(enabled)
+}
+
+// labeled runs fn under the request's profiler labels when they are enabled
+func labeled[T any](ctx context.Context, req *Request, fn func(context.Context, *Request) (T, error)) (T, error) {
+	if !profilerLabels.Load() {
+		return fn(ctx, req)
+	}
+	method := req.Method
+	if method == "" {
+		method = "GET"
+	}
+	var resp T
+	var err error
+	pprof.Do(ctx, pprof.Labels("httpcloak.host", extractHost(req.URL), "httpcloak.method", method), func(ctx context.Context) {
+		resp, err = fn(ctx, req)
+	})
+	return resp, err
+}
@@ -0,0 +1,43 @@
+package transport
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"net/url"
+
+	"github.com/sardanioss/httpcloak/proxy"
+)
+
+// answerProxyAuth continues a CONNECT the proxy refused with 407 when it asks
+// for NTLM or Negotiate, on the same connection. It returns the status of
+// the final response, or the 407's when its challenges can't be answered.
+func answerProxyAuth(ctx context.Context, conn net.Conn, br *bufio.Reader, connectReq string, challenges []string, cfg *ProxyConfig, config *TransportConfig, statusCode int, status string) (int, string, error) {
+	if cfg == nil {
+		return statusCode, status, nil
+	}
+	proxyURL, err := url.Parse(cfg.URL)
+	if err != nil {
+		return statusCode, status, nil
+	}
+
+	creds := proxy.Credentials{Username: cfg.Username, Password: cfg.Password}
+	if proxyURL.User != nil {
+		if u := proxyURL.User.Username(); u != "" {
+			creds.Username = u
+		}
+		if p, ok := proxyURL.User.Password(); ok {
+			creds.Password = p
+		}
+	}
+	if config != nil {
+		creds.Negotiate = config.ProxyNegotiate
+	}
+
+	resp, err := proxy.AuthenticateConnect(ctx, conn, br, connectReq, challenges, proxyURL.Hostname(), creds)
+	if err != nil || resp == nil {
+		return statusCode, status, err
+	}
+	resp.Body.Close()
+	return resp.StatusCode, resp.Status, nil
+}
@@ -0,0 +1,278 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// ViaDirect labels responses that were served without a proxy
+const ViaDirect = "direct"
+
+// ProxyFallback decides where a request goes when the configured proxy fails
+// at the connection level. Backups are tried in order, then a direct
+// connection if AllowDirect is set. With Blacklist set, a proxy that fails
+// is skipped for a while, longer each time it fails again.
+type ProxyFallback struct {
+	// Backups are proxy URLs tried in order after the primary proxy fails
+	Backups []string
+
+	// AllowDirect falls back to connecting without any proxy once the primary
+	// proxy and every backup have failed. This exposes the machine's own IP
+	// address to the target, so it must be opted into explicitly.
+	AllowDirect bool
+
+	// On lists the error categories that trigger the fallback, matched with
+	// errors.Is. Nil means ErrProxy and ErrConnection. Errors after the request
+	// reached the server (timeouts, protocol errors) are never retried through
+	// another path unless listed here.
+	On []error
+
+	// Blacklist is how long a proxy that failed with one of the On errors is
+	// skipped, the primary included. The time doubles with every failure in
+	// a row, up to MaxBlacklist, and resets once the proxy serves a request.
+	// Zero tries every proxy on every request.
+	Blacklist time.Duration
+
+	// MaxBlacklist caps the doubling of Blacklist. Default 16 times Blacklist.
+	MaxBlacklist time.Duration
+
+	// OnFailover is called before a request is retried through another path,
+	// with the path that failed, the one tried next (ViaDirect for a direct
+	// connection) and the error. Proxy URLs are stripped of credentials.
+	// It runs on the request's goroutine and must not block.
+	OnFailover func(from, to string, err error)
+
+	// OnBlacklist is called when a proxy is blacklisted, with its URL
+	// stripped of credentials, the time it is skipped until and the error
+	OnBlacklist func(proxy string, until time.Time, err error)
+}
+
+// shouldFallback reports whether err is one of the configured categories
+func (f *ProxyFallback) shouldFallback(err error) bool {
+	on := f.On
+	if on == nil {
+		on = []error{ErrProxy, ErrConnection}
+	}
+	for _, target := range on {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// blacklistFor returns how long a proxy is skipped after strikes failures in a row
+func (f *ProxyFallback) blacklistFor(strikes int) time.Duration {
+	max := f.MaxBlacklist
+	if max <= 0 {
+		max = 16 * f.Blacklist
+	}
+	d := f.Blacklist
+	for i := 1; i < strikes && d < max; i++ {
+		d *= 2
+	}
+	return min(d, max)
+}
+
+// fallbackPaths returns the proxy URLs to try after the primary, with "" for direct
+func (f *ProxyFallback) fallbackPaths() []string {
+	paths := append([]string(nil), f.Backups...)
+	if f.AllowDirect {
+		paths = append(paths, "")
+	}
+	return paths
+}
+
+// proxyLabel returns a proxy URL with credentials stripped, or ViaDirect
+func proxyLabel(proxyURL string) string {
+	if proxyURL == "" {
+		return ViaDirect
+	}
+	u, err := url.Parse(proxyURL)
+	if err != nil || u.Host == "" {
+		return "proxy"
+	}
+	return u.Scheme + "://" + u.Host
+}
+
+// ProxyLabel returns the configured proxy URL without credentials, or
+// ViaDirect when requests go direct
+func (t *Transport) ProxyLabel() string {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return proxyLabel(t.primaryProxyURL())
+}
+
+// primaryProxyURL returns the proxy used for TCP requests, "" when direct
+func (t *Transport) primaryProxyURL() string {
+	if t.proxy == nil {
+		return ""
+	}
+	if t.proxy.TCPProxy != "" {
+		return t.proxy.TCPProxy
+	}
+	return t.proxy.URL
+}
+
+// proxyTransports holds the lazily created transports for other proxy paths
+type proxyTransports struct {
+	mu         sync.Mutex
+	transports map[string]*Transport // keyed by proxy URL, "" for direct
+}
+
+// proxyBlacklist holds the proxies a ProxyFallback skips after failures
+type proxyBlacklist struct {
+	mu      sync.Mutex
+	entries map[string]*blacklistEntry // keyed by proxy URL
+}
+
+type blacklistEntry struct {
+	strikes int
+	until   time.Time
+	err     error
+}
+
+// skipped returns the error that blacklisted proxyURL while it is
+// blacklisted, nil otherwise
+func (b *proxyBlacklist) skipped(proxyURL string, now time.Time) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if e, ok := b.entries[proxyURL]; ok && now.Before(e.until) {
+		return e.err
+	}
+	return nil
+}
+
+// strike blacklists proxyURL for f's time after one more failure in a row
+func (b *proxyBlacklist) strike(f *ProxyFallback, proxyURL string, err error) {
+	if f.Blacklist <= 0 || proxyURL == "" {
+		return
+	}
+	b.mu.Lock()
+	if b.entries == nil {
+		b.entries = make(map[string]*blacklistEntry)
+	}
+	e, ok := b.entries[proxyURL]
+	if !ok {
+		e = &blacklistEntry{}
+		b.entries[proxyURL] = e
+	}
+	e.strikes++
+	e.until = time.Now().Add(f.blacklistFor(e.strikes))
+	e.err = err
+	until := e.until
+	b.mu.Unlock()
+
+	if f.OnBlacklist != nil {
+		f.OnBlacklist(proxyLabel(proxyURL), until, err)
+	}
+}
+
+// recovered clears the failures of a proxy that served a request
+func (b *proxyBlacklist) recovered(proxyURL string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.entries, proxyURL)
+}
+
+// primaryBlacklisted returns the error that blacklisted the primary proxy
+// while it is blacklisted, nil otherwise
+func (t *Transport) primaryBlacklisted() error {
+	return t.proxyBlacklist.skipped(t.primaryProxyURL(), time.Now())
+}
+
+// doWithProxyFallback retries a request that failed on the primary proxy, or
+// that skipped it while blacklisted, through the configured fallback paths.
+// Runs on a request snapshot.
+func (t *Transport) doWithProxyFallback(ctx context.Context, req *Request, err error) (*Response, error) {
+	f := t.config.ProxyFallback
+	// A streaming body may already be partly consumed
+	if req.BodyReader != nil || !f.shouldFallback(err) {
+		return nil, err
+	}
+	from := t.primaryProxyURL()
+	if t.primaryBlacklisted() == nil {
+		t.proxyBlacklist.strike(f, from, err)
+	}
+	for _, path := range f.fallbackPaths() {
+		if ctx.Err() != nil {
+			break
+		}
+		if path != "" && t.proxyBlacklist.skipped(path, time.Now()) != nil {
+			continue
+		}
+		if f.OnFailover != nil {
+			f.OnFailover(proxyLabel(from), proxyLabel(path), err)
+		}
+		resp, fbErr := t.proxyTransport(path).do(ctx, req)
+		if fbErr == nil {
+			t.proxyBlacklist.recovered(path)
+			resp.Via = proxyLabel(path)
+			return resp, nil
+		}
+		err, from = fbErr, path
+		if !f.shouldFallback(fbErr) {
+			break
+		}
+		t.proxyBlacklist.strike(f, path, fbErr)
+	}
+	return nil, err
+}
+
+// proxyTransport returns the transport that sends requests through proxyURL
+// ("" for direct), creating it with this transport's preset and settings on
+// first use
+func (t *Transport) proxyTransport(proxyURL string) *Transport {
+	t.proxyTransports.mu.Lock()
+	defer t.proxyTransports.mu.Unlock()
+
+	if ft, ok := t.proxyTransports.transports[proxyURL]; ok {
+		return ft
+	}
+	if t.proxyTransports.transports == nil {
+		t.proxyTransports.transports = make(map[string]*Transport)
+	}
+
+	cfg := *t.config
+	cfg.ProxyFallback = nil
+	cfg.ProxyPool = nil
+	cfg.ProxyFromEnvironment = false
+	cfg.ProxySelector = nil
+	var proxy *ProxyConfig
+	if proxyURL != "" {
+		proxy = &ProxyConfig{URL: proxyURL}
+	}
+	ft := NewTransportWithConfig(t.preset.Name, proxy, &cfg)
+	ft.protocol = t.protocol
+	ft.timeout = t.timeout
+	t.customHeaderOrderMu.RLock()
+	ft.customHeaderOrder = t.customHeaderOrder
+	t.customHeaderOrderMu.RUnlock()
+	if t.insecureSkipVerify {
+		ft.SetInsecureSkipVerify(true)
+	}
+	t.proxyTransports.transports[proxyURL] = ft
+	return ft
+}
+
+// closeProxyTransports closes and forgets the transports for other proxy paths
+func (t *Transport) closeProxyTransports() {
+	t.detachProxyTransports()()
+}
+
+// detachProxyTransports forgets the transports for other proxy paths, so
+// new requests create them afresh, and returns the function closing them
+func (t *Transport) detachProxyTransports() func() {
+	t.proxyTransports.mu.Lock()
+	defer t.proxyTransports.mu.Unlock()
+	transports := t.proxyTransports.transports
+	t.proxyTransports.transports = nil
+	return func() {
+		for _, ft := range transports {
+			ft.Close()
+		}
+	}
+}
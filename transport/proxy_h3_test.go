@@ -0,0 +1,53 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestCheckH3Proxy(t *testing.T) {
+	tests := []struct {
+		proxy *ProxyConfig
+		ok    bool
+	}{
+		{&ProxyConfig{URL: "socks5://127.0.0.1:1080"}, true},
+		{&ProxyConfig{URL: "http://127.0.0.1:8080"}, false},
+		// The UDP proxy carries QUIC, whatever proxies TCP
+		{&ProxyConfig{TCPProxy: "http://127.0.0.1:8080", UDPProxy: "socks5://127.0.0.1:1080"}, true},
+		{&ProxyConfig{TCPProxy: "socks5://127.0.0.1:1080", UDPProxy: "http://127.0.0.1:8080"}, false},
+	}
+	for _, tt := range tests {
+		tr := &Transport{proxy: tt.proxy}
+		if err := tr.checkH3Proxy(); (err == nil) != tt.ok {
+			t.Errorf("%+v: err = %v, want ok=%v", *tt.proxy, err, tt.ok)
+		}
+	}
+
+	udpErr := errors.New("no UDP ASSOCIATE")
+	tr := &Transport{proxy: &ProxyConfig{URL: "socks5://127.0.0.1:1080"}, h3ProxyError: udpErr}
+	if err := tr.checkH3Proxy(); err != udpErr {
+		t.Errorf("err = %v, want the UDP relay setup error", err)
+	}
+}
+
+func TestForcedH3StreamBehindHTTPProxy(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	deadProxy := "http://" + ln.Addr().String()
+	ln.Close()
+
+	tr := NewTransportWithConfig("chrome-latest", &ProxyConfig{URL: deadProxy}, nil)
+	defer tr.Close()
+	tr.SetProtocol(ProtocolHTTP3)
+
+	// Streams used to fall back to HTTP/2 through the proxy
+	_, err = tr.DoStream(context.Background(), &Request{Method: "GET", URL: "https://example.com/"})
+	if err == nil || !strings.Contains(err.Error(), "HTTP/3") {
+		t.Errorf("err = %v, want HTTP/3 proxy error", err)
+	}
+}
@@ -0,0 +1,86 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"time"
+
+	"github.com/sardanioss/httpcloak/proxy"
+)
+
+// proxyPool returns the pool requests rotate through, nil when there is
+// none or the transport has a proxy of its own
+func (t *Transport) proxyPool() *proxy.Pool {
+	if t.config == nil || t.proxy != nil {
+		return nil
+	}
+	return t.config.ProxyPool
+}
+
+// doWithProxyPool sends a request through the pool's next proxy and reports
+// the outcome back to the pool
+func (t *Transport) doWithProxyPool(ctx context.Context, req *Request) (*Response, error) {
+	pool := t.config.ProxyPool
+	proxyURL, err := nextPoolProxy(pool, req.URL)
+	if err != nil {
+		return nil, err
+	}
+	started := time.Now()
+	resp, err := t.proxyTransport(proxyURL).do(ctx, req)
+	if err != nil {
+		reportPoolResult(pool, proxyURL, started, 0, nil, err)
+		return nil, err
+	}
+	reportPoolResult(pool, proxyURL, started, resp.StatusCode, resp.Headers, nil)
+	resp.Via = proxyLabel(proxyURL)
+	return resp, nil
+}
+
+// doStreamWithProxyPool is doWithProxyPool for streaming requests
+func (t *Transport) doStreamWithProxyPool(ctx context.Context, req *Request) (*StreamResponse, error) {
+	pool := t.config.ProxyPool
+	proxyURL, err := nextPoolProxy(pool, req.URL)
+	if err != nil {
+		return nil, err
+	}
+	started := time.Now()
+	resp, err := t.proxyTransport(proxyURL).doStream(ctx, req)
+	if err != nil {
+		reportPoolResult(pool, proxyURL, started, 0, nil, err)
+		return nil, err
+	}
+	reportPoolResult(pool, proxyURL, started, resp.StatusCode, resp.Headers, nil)
+	return resp, nil
+}
+
+// nextPoolProxy picks the proxy for a request to rawURL
+func nextPoolProxy(pool *proxy.Pool, rawURL string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", NewRequestError("parse_url", "", "", "", err)
+	}
+	proxyURL, err := pool.Next(u.Hostname())
+	if err != nil {
+		return "", NewProxyError("proxy_pool", u.Hostname(), u.Port(), err)
+	}
+	return proxyURL, nil
+}
+
+// reportPoolResult tells the pool how a request through proxyURL went.
+// Connection-level errors and 407 responses count against the proxy, as do
+// block pages; other errors happened past the proxy and aren't counted.
+func reportPoolResult(pool *proxy.Pool, proxyURL string, started time.Time, status int, headers map[string][]string, err error) {
+	switch {
+	case err != nil:
+		if errors.Is(err, ErrProxy) || errors.Is(err, ErrConnection) {
+			pool.ReportFailure(proxyURL, err)
+		}
+	case status == 407:
+		pool.ReportFailure(proxyURL, errors.New("proxy authentication required"))
+	case pool.IsBlocked(status, headers):
+		pool.ReportBlocked(proxyURL)
+	default:
+		pool.ReportSuccess(proxyURL, time.Since(started))
+	}
+}
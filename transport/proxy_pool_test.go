@@ -0,0 +1,70 @@
+package transport
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sardanioss/httpcloak/proxy"
+)
+
+func TestProxyPool(t *testing.T) {
+	// The proxy answers requests itself, with a 429 block for /blocked
+	good := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/blocked" {
+			w.WriteHeader(http.StatusTooManyRequests)
+		}
+	}))
+	defer good.Close()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dead := "http://" + ln.Addr().String()
+	ln.Close()
+
+	pool, err := proxy.NewPool([]string{dead, good.URL}, proxy.PoolOptions{MaxFailures: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := NewTransportWithConfig("chrome-latest", nil, &TransportConfig{ProxyPool: pool})
+	defer tr.Close()
+	tr.SetProtocol(ProtocolHTTP1)
+	get := func(path string) (*Response, error) {
+		return tr.Do(context.Background(), &Request{Method: "GET", URL: "http://target.invalid" + path})
+	}
+
+	// The dead proxy fails once and is quarantined, the rest go to the good one
+	if _, err := get("/"); err == nil || !IsProxyError(err) {
+		t.Fatalf("request through the dead proxy: err = %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		resp, err := get("/")
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Close()
+		if resp.Via != good.URL {
+			t.Errorf("Via = %q, want %q", resp.Via, good.URL)
+		}
+	}
+	resp, err := get("/blocked")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Close()
+
+	stats := pool.Stats()
+	if !stats[0].Quarantined || stats[0].Failures != 1 {
+		t.Errorf("dead proxy stats = %+v", stats[0])
+	}
+	if s := stats[1]; s.Successes != 3 || s.Blocks != 1 || !s.Quarantined {
+		t.Errorf("good proxy stats = %+v", s)
+	}
+	if _, err := get("/"); err == nil {
+		t.Error("request succeeded with every proxy quarantined")
+	}
+}
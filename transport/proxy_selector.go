@@ -0,0 +1,85 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"net/url"
+
+	"github.com/sardanioss/httpcloak/proxy"
+)
+
+// proxySelector returns the selector that picks each request's proxies, nil
+// when there is none or the transport has a proxy of its own
+func (t *Transport) proxySelector() proxy.Selector {
+	if t.config == nil || t.proxy != nil {
+		return nil
+	}
+	return t.config.ProxySelector
+}
+
+// doWithProxySelector sends a request through the proxies the selector
+// picks for it, moving to the next one when a proxy fails at the
+// connection level
+func (t *Transport) doWithProxySelector(ctx context.Context, req *Request) (*Response, error) {
+	paths, err := selectProxies(ctx, t.config.ProxySelector, req.URL)
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range paths {
+		var resp *Response
+		resp, err = t.proxyTransport(path).do(ctx, req)
+		if err == nil {
+			resp.Via = proxyLabel(path)
+			return resp, nil
+		}
+		if !nextSelectedProxy(ctx, req, err) {
+			break
+		}
+	}
+	return nil, err
+}
+
+// doStreamWithProxySelector is doWithProxySelector for streaming requests
+func (t *Transport) doStreamWithProxySelector(ctx context.Context, req *Request) (*StreamResponse, error) {
+	paths, err := selectProxies(ctx, t.config.ProxySelector, req.URL)
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range paths {
+		var resp *StreamResponse
+		resp, err = t.proxyTransport(path).doStream(ctx, req)
+		if err == nil {
+			return resp, nil
+		}
+		if !nextSelectedProxy(ctx, req, err) {
+			break
+		}
+	}
+	return nil, err
+}
+
+// selectProxies asks the selector for the proxies of a request to rawURL
+func selectProxies(ctx context.Context, selector proxy.Selector, rawURL string) ([]string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, NewRequestError("parse_url", "", "", "", err)
+	}
+	paths, err := selector.Select(ctx, u)
+	if err == nil && len(paths) == 0 {
+		err = errors.New("selector returned no proxy")
+	}
+	if err != nil {
+		return nil, NewProxyError("proxy_select", u.Hostname(), u.Port(), err)
+	}
+	return paths, nil
+}
+
+// nextSelectedProxy reports whether a request that failed with err may be
+// retried through the next selected proxy
+func nextSelectedProxy(ctx context.Context, req *Request, err error) bool {
+	// A streaming body may already be partly consumed
+	if ctx.Err() != nil || req.BodyReader != nil || req.NoRetry {
+		return false
+	}
+	return errors.Is(err, ErrProxy) || errors.Is(err, ErrConnection)
+}
@@ -0,0 +1,58 @@
+package transport
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/sardanioss/httpcloak/proxy"
+)
+
+func TestProxySelector(t *testing.T) {
+	good := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer good.Close()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dead := ln.Addr().String()
+	ln.Close()
+
+	goodAddr := strings.TrimPrefix(good.URL, "http://")
+	pac, err := proxy.ParsePAC(`
+		function FindProxyForURL(url, host) {
+			if (dnsDomainIs(host, ".failover.invalid"))
+				return "PROXY ` + dead + `; PROXY ` + goodAddr + `";
+			if (host == "unusable.invalid")
+				return "SOCKS4 ` + goodAddr + `";
+			return "PROXY ` + goodAddr + `";
+		}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := NewTransportWithConfig("chrome-latest", nil, &TransportConfig{ProxySelector: pac})
+	defer tr.Close()
+	tr.SetProtocol(ProtocolHTTP1)
+	get := func(rawURL string) (*Response, error) {
+		return tr.Do(context.Background(), &Request{Method: "GET", URL: rawURL})
+	}
+
+	for _, rawURL := range []string{"http://target.invalid/", "http://www.failover.invalid/"} {
+		resp, err := get(rawURL)
+		if err != nil {
+			t.Fatalf("%s: %v", rawURL, err)
+		}
+		resp.Close()
+		if resp.Via != good.URL {
+			t.Errorf("%s: Via = %q, want %q", rawURL, resp.Via, good.URL)
+		}
+	}
+
+	if _, err := get("http://unusable.invalid/"); err == nil || !IsProxyError(err) {
+		t.Errorf("request with no usable proxy: err = %v, want a proxy error", err)
+	}
+}
@@ -0,0 +1,96 @@
+package transport
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/url"
+
+	"github.com/sardanioss/httpcloak/fingerprint"
+	utls "github.com/sardanioss/utls"
+)
+
+// ProxyTLSFingerprint selects the ClientHello sent to an https:// proxy
+type ProxyTLSFingerprint int
+
+const (
+	// ProxyTLSGo sends Go's crypto/tls ClientHello, as most HTTP libraries
+	// reaching a TLS proxy do
+	ProxyTLSGo ProxyTLSFingerprint = iota
+	// ProxyTLSBrowser sends the preset's browser ClientHello, as a browser
+	// configured with an HTTPS proxy does. ALPN offers only http/1.1, which
+	// the CONNECT exchange uses.
+	ProxyTLSBrowser
+)
+
+// ProxyTLSConfig configures the TLS connection to an https:// proxy. The
+// target's own TLS runs inside that connection with the preset's
+// fingerprint either way.
+type ProxyTLSConfig struct {
+	// Fingerprint is the ClientHello sent to the proxy. Default ProxyTLSGo.
+	Fingerprint ProxyTLSFingerprint
+
+	// ServerName is sent as SNI and verified against the proxy's
+	// certificate. Default the proxy URL's host.
+	ServerName string
+
+	// RootCAs verify the proxy's certificate, nil for the system roots
+	RootCAs *x509.CertPool
+
+	// InsecureSkipVerify accepts any certificate from the proxy
+	InsecureSkipVerify bool
+}
+
+// dialProxyTLS runs the TLS handshake with an https:// proxy over conn,
+// closing conn when it fails
+func dialProxyTLS(ctx context.Context, conn net.Conn, proxyURL *url.URL, config *TransportConfig, preset *fingerprint.Preset) (net.Conn, error) {
+	var cfg ProxyTLSConfig
+	if config != nil && config.ProxyTLS != nil {
+		cfg = *config.ProxyTLS
+	}
+	serverName := cfg.ServerName
+	if serverName == "" {
+		serverName = proxyURL.Hostname()
+	}
+
+	var tlsConn net.Conn
+	var handshake func(context.Context) error
+	switch cfg.Fingerprint {
+	case ProxyTLSBrowser:
+		spec, err := utls.UTLSIdToSpec(preset.ClientHelloID)
+		if err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("proxy TLS fingerprint: %w", err)
+		}
+		for _, ext := range spec.Extensions {
+			if alpn, ok := ext.(*utls.ALPNExtension); ok {
+				alpn.AlpnProtocols = []string{"http/1.1"}
+			}
+		}
+		uconn := utls.UClient(conn, &utls.Config{
+			ServerName:         serverName,
+			RootCAs:            cfg.RootCAs,
+			InsecureSkipVerify: cfg.InsecureSkipVerify,
+		}, utls.HelloCustom)
+		if err := uconn.ApplyPreset(&spec); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("proxy TLS fingerprint: %w", err)
+		}
+		tlsConn, handshake = uconn, uconn.HandshakeContext
+	default:
+		c := tls.Client(conn, &tls.Config{
+			ServerName:         serverName,
+			RootCAs:            cfg.RootCAs,
+			InsecureSkipVerify: cfg.InsecureSkipVerify,
+			NextProtos:         []string{"http/1.1"},
+		})
+		tlsConn, handshake = c, c.HandshakeContext
+	}
+	if err := handshake(ctx); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("TLS handshake with proxy failed: %w", err)
+	}
+	return tlsConn, nil
+}
@@ -0,0 +1,77 @@
+package transport
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+func TestProxyTLS(t *testing.T) {
+	var mu sync.Mutex
+	var greased []bool
+	proxySrv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	proxySrv.TLS = &tls.Config{
+		GetConfigForClient: func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+			grease := false
+			for _, suite := range hello.CipherSuites {
+				grease = grease || suite&0x0f0f == 0x0a0a
+			}
+			mu.Lock()
+			greased = append(greased, grease)
+			mu.Unlock()
+			return nil, nil
+		},
+	}
+	proxySrv.StartTLS()
+	defer proxySrv.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(proxySrv.Certificate())
+
+	tests := []struct {
+		name        string
+		fingerprint ProxyTLSFingerprint
+		wantGrease  bool
+	}{
+		{"go", ProxyTLSGo, false},
+		{"browser", ProxyTLSBrowser, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mu.Lock()
+			greased = nil
+			mu.Unlock()
+
+			tr := NewTransportWithConfig("chrome-latest", &ProxyConfig{URL: proxySrv.URL}, &TransportConfig{
+				ProxyTLS: &ProxyTLSConfig{Fingerprint: tt.fingerprint, RootCAs: roots},
+			})
+			defer tr.Close()
+			tr.SetProtocol(ProtocolHTTP1)
+			resp, err := tr.Do(context.Background(), &Request{Method: "GET", URL: "http://target.invalid/"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Close()
+
+			mu.Lock()
+			defer mu.Unlock()
+			if len(greased) == 0 {
+				t.Fatal("proxy saw no TLS handshake")
+			}
+			if greased[0] != tt.wantGrease {
+				t.Errorf("GREASE in the proxy ClientHello = %v, want %v", greased[0], tt.wantGrease)
+			}
+		})
+	}
+
+	tr := NewTransportWithConfig("chrome-latest", &ProxyConfig{URL: proxySrv.URL}, nil)
+	defer tr.Close()
+	tr.SetProtocol(ProtocolHTTP1)
+	if _, err := tr.Do(context.Background(), &Request{Method: "GET", URL: "http://target.invalid/"}); err == nil {
+		t.Error("proxy with an untrusted certificate: want an error")
+	}
+}
@@ -0,0 +1,211 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"net"
+	"reflect"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/sardanioss/http/httptrace"
+	"github.com/sardanioss/quic-go"
+	tls "github.com/sardanioss/utls"
+)
+
+// QUICOptions tunes the QUIC connections opened by the HTTP/3 transport.
+// Zero fields keep the preset's defaults. The offered QUIC versions are
+// deliberately not among them: they must match the version_information
+// transport parameter, which quic-go only sets process-wide, so a
+// per-transport setting would contradict it (see SetQUICVersions).
+type QUICOptions struct {
+	// MaxConnsPerHost caps the QUIC connections open to one host at a time.
+	// Requests share one connection per host, so extra connections only
+	// appear while an old one drains (e.g., after a 0-RTT rejection); dials
+	// over the cap wait for one to close. 0 means unlimited.
+	MaxConnsPerHost int
+
+	// HandshakeTimeout is how long the QUIC handshake may go without
+	// progress before the dial fails (quic-go's default is 5s)
+	HandshakeTimeout time.Duration
+
+	// DisableEarlyData makes requests wait for the QUIC handshake. By
+	// default a GET or HEAD without a body on a resumed connection is sent
+	// in 0-RTT, like Chrome does; if the server rejects early data the
+	// request is retried after the handshake and later requests to that
+	// host wait for it. Early data is HTTP/3 only: HTTP/1.1 and HTTP/2
+	// resume TLS sessions in 1-RTT, as Chrome does.
+	DisableEarlyData bool
+}
+
+// Process-wide QUIC version preferences (see SetQUICVersions)
+var (
+	quicVersions   = []quic.Version{quic.Version1}
+	quicVersionsMu sync.RWMutex
+)
+
+// SetQUICVersions sets the QUIC versions offered by HTTP/3 transports created
+// afterwards, in order of preference, and rebuilds the Chrome-style
+// version_information and google_version transport parameters to match.
+// grease adds a reserved GREASE version to available_versions like Chrome;
+// turn it off for middleboxes that drop unknown versions.
+//
+// The default is QUIC v1 with GREASE, as sent by current Chrome. Transport
+// parameters are process-wide in quic-go, so this affects every session.
+func SetQUICVersions(versions []quic.Version, grease bool) error {
+	if len(versions) == 0 {
+		return errors.New("at least one QUIC version is required")
+	}
+	for _, v := range versions {
+		if !slices.Contains(quic.SupportedVersions(), v) {
+			return errors.New("unsupported QUIC version " + v.String())
+		}
+	}
+	quicVersionsMu.Lock()
+	defer quicVersionsMu.Unlock()
+	quicVersions = slices.Clone(versions)
+	quic.SetAdditionalTransportParameters(buildChromeTransportParams(quicVersions, grease))
+	return nil
+}
+
+// defaultQUICVersions returns the process-wide version preferences
+func defaultQUICVersions() []quic.Version {
+	quicVersionsMu.RLock()
+	defer quicVersionsMu.RUnlock()
+	return slices.Clone(quicVersions)
+}
+
+type quicDialFunc func(ctx context.Context, addr string, tlsCfg *tls.Config, cfg *quic.Config) (*quic.Conn, error)
+
+// applyQUICOptions copies the process-wide versions and the handshake
+// timeout into cfg
+func applyQUICOptions(cfg *quic.Config, config *TransportConfig) {
+	cfg.Versions = defaultQUICVersions()
+	if config != nil && config.QUIC != nil && config.QUIC.HandshakeTimeout > 0 {
+		cfg.HandshakeIdleTimeout = config.QUIC.HandshakeTimeout
+	}
+}
+
+// wrapDial wraps a dial function to hand out preconnected connections, to
+// enforce QUICOptions.MaxConnsPerHost and PoolLimits.MaxConns, to track
+// connections for the pool limits and stats
+func (t *HTTP3Transport) wrapDial(dial quicDialFunc) quicDialFunc {
+	limited := t.limitConns(dial)
+	return func(ctx context.Context, addr string, tlsCfg *tls.Config, cfg *quic.Config) (*quic.Conn, error) {
+		if conn := t.takePreconnected(addr); conn != nil {
+			return conn, nil
+		}
+		release, err := t.limiter.acquire(ctx)
+		if err != nil {
+			return nil, err
+		}
+		conn, err := limited(ctx, addr, tlsCfg, cfg)
+		if err != nil {
+			release()
+		} else {
+			host, _, _ := net.SplitHostPort(addr)
+			context.AfterFunc(conn.Context(), t.connStats.opened(host, release))
+			go t.recordHandshake(host, conn)
+			t.trackConn(addr, conn)
+			if err := checkQUICPins(t.config, host, conn.ConnectionState().TLS); err != nil {
+				conn.CloseWithError(0, "")
+				return nil, err
+			}
+			proxied := t.proxyConfig != nil || t.masqueConn != nil
+			if err := t.revocation.check(ctx, t.config, proxied, host, conn.ConnectionState().TLS); err != nil {
+				conn.CloseWithError(0, "")
+				return nil, err
+			}
+			t.fingerprints.record(host, nil, true, conn.ConnectionState().TLS.PeerCertificates)
+			t.openConns.Add(1)
+			context.AfterFunc(conn.Context(), func() { t.openConns.Add(-1) })
+		}
+		return conn, err
+	}
+}
+
+// recordHandshake records conn's handshake in the connection stats once it
+// completes
+func (t *HTTP3Transport) recordHandshake(host string, conn *quic.Conn) {
+	select {
+	case <-conn.HandshakeComplete():
+		t.connStats.handshake(host, conn.ConnectionState().TLS.DidResume, conn.ConnectionStats().SmoothedRTT)
+	case <-conn.Context().Done():
+	}
+}
+
+// traceQUICVersion makes ctx record the QUIC version ("v1", "v2") of the
+// connection that carries the request. The returned function reports it, ""
+// before a connection was picked; after a 0-RTT retry it's the connection
+// that served the response.
+func traceQUICVersion(ctx context.Context) (context.Context, func() string) {
+	var mu sync.Mutex
+	var version string
+	ctx = httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			if conn := tracedQUICConn(info.Conn); conn != nil {
+				mu.Lock()
+				version = conn.ConnectionState().Version.String()
+				mu.Unlock()
+			}
+		},
+	})
+	return ctx, func() string {
+		mu.Lock()
+		defer mu.Unlock()
+		return version
+	}
+}
+
+// quicConnType is the type of the connection http3 wraps in GotConnInfo
+var quicConnType = reflect.TypeOf((*quic.Conn)(nil))
+
+// tracedQUICConn returns the QUIC connection behind the net.Conn http3 passes
+// to GotConn. http3 hides it in an unexported wrapper, so it's read by
+// reflection; nil if the wrapper no longer holds one as its first field.
+func tracedQUICConn(c net.Conn) *quic.Conn {
+	v := reflect.ValueOf(c)
+	if v.Kind() != reflect.Pointer || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return nil
+	}
+	v = v.Elem()
+	if v.NumField() == 0 || v.Field(0).Type() != quicConnType || v.Field(0).IsNil() {
+		return nil
+	}
+	return (*quic.Conn)(v.Field(0).UnsafePointer())
+}
+
+// limitConns wraps a dial function to enforce QUICOptions.MaxConnsPerHost.
+// A slot is held from the dial until the connection closes.
+func (t *HTTP3Transport) limitConns(dial quicDialFunc) quicDialFunc {
+	if t.config == nil || t.config.QUIC == nil || t.config.QUIC.MaxConnsPerHost <= 0 {
+		return dial
+	}
+	limit := t.config.QUIC.MaxConnsPerHost
+	return func(ctx context.Context, addr string, tlsCfg *tls.Config, cfg *quic.Config) (*quic.Conn, error) {
+		t.connSlotsMu.Lock()
+		if t.connSlots == nil {
+			t.connSlots = make(map[string]chan struct{})
+		}
+		slots, ok := t.connSlots[addr]
+		if !ok {
+			slots = make(chan struct{}, limit)
+			t.connSlots[addr] = slots
+		}
+		t.connSlotsMu.Unlock()
+
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		conn, err := dial(ctx, addr, tlsCfg, cfg)
+		if err != nil {
+			<-slots
+			return nil, err
+		}
+		context.AfterFunc(conn.Context(), func() { <-slots })
+		return conn, nil
+	}
+}
@@ -0,0 +1,133 @@
+package transport
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"net"
+	"testing"
+	"time"
+
+	shttp "github.com/sardanioss/http"
+	"github.com/sardanioss/quic-go"
+	"github.com/sardanioss/quic-go/http3"
+	utls "github.com/sardanioss/utls"
+)
+
+func TestBuildChromeTransportParamsVersions(t *testing.T) {
+	params := buildChromeTransportParams([]quic.Version{quic.Version2, quic.Version1}, false)
+	info := params[tpVersionInformation]
+	if len(info) != 12 {
+		t.Fatalf("version_information length = %d, want 12", len(info))
+	}
+	want := []uint32{uint32(quic.Version2), uint32(quic.Version2), uint32(quic.Version1)}
+	for i, v := range want {
+		if got := binary.BigEndian.Uint32(info[4*i:]); got != v {
+			t.Errorf("version_information[%d] = %#x, want %#x", i, got, v)
+		}
+	}
+	if got := binary.BigEndian.Uint32(params[tpGoogleVersion]); got != uint32(quic.Version2) {
+		t.Errorf("google_version = %#x, want v2", got)
+	}
+
+	// GREASE goes first in available_versions, like Chrome
+	info = buildChromeTransportParams([]quic.Version{quic.Version1}, true)[tpVersionInformation]
+	if grease := binary.BigEndian.Uint32(info[4:]); grease&0x0f0f0f0f != 0x0a0a0a0a {
+		t.Errorf("expected GREASE version, got %#x", grease)
+	}
+}
+
+func TestSetQUICVersions(t *testing.T) {
+	defer SetQUICVersions([]quic.Version{quic.Version1}, true)
+
+	if err := SetQUICVersions(nil, true); err == nil {
+		t.Error("expected error for empty version list")
+	}
+	if err := SetQUICVersions([]quic.Version{0x1234}, true); err == nil {
+		t.Error("expected error for unsupported version")
+	}
+	if err := SetQUICVersions([]quic.Version{quic.Version2, quic.Version1}, false); err != nil {
+		t.Fatal(err)
+	}
+	// Sessions offer the versions the transport parameters announce
+	cfg := &quic.Config{}
+	applyQUICOptions(cfg, &TransportConfig{QUIC: &QUICOptions{HandshakeTimeout: time.Second}})
+	if len(cfg.Versions) != 2 || cfg.Versions[0] != quic.Version2 {
+		t.Errorf("Versions = %v, want [v2 v1]", cfg.Versions)
+	}
+	if cfg.HandshakeIdleTimeout != time.Second {
+		t.Errorf("HandshakeIdleTimeout = %v, want 1s", cfg.HandshakeIdleTimeout)
+	}
+}
+
+// TestTransportParamsGolden pins the wire bytes of the added transport
+// parameters, so an encoding that depends on the host's byte order fails
+// here on arm64 or s390x instead of changing the QUIC fingerprint
+func TestTransportParamsGolden(t *testing.T) {
+	params := buildChromeTransportParams([]quic.Version{quic.Version1, quic.Version2}, false)
+	golden := map[uint64]string{
+		tpVersionInformation: "00000001" + "00000001" + "6b3343cf",
+		tpGoogleVersion:      "00000001",
+	}
+	for id, want := range golden {
+		if got := hex.EncodeToString(params[id]); got != want {
+			t.Errorf("transport parameter %#x = %s, want %s", id, got, want)
+		}
+	}
+	if len(params) != len(golden) {
+		t.Errorf("%d transport parameters, want %d", len(params), len(golden))
+	}
+
+	for i := 0; i < 32; i++ {
+		v := generateGREASEVersion()
+		var b [4]byte
+		binary.BigEndian.PutUint32(b[:], v)
+		if b[0]&0x0f != 0x0a || b[0] != b[1] || b[1] != b[2] || b[2] != b[3] {
+			t.Fatalf("GREASE version %#x is not of the form 0x?a?a?a?a", v)
+		}
+	}
+}
+
+func TestTraceQUICVersion(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("udp unavailable: %v", err)
+	}
+	defer pc.Close()
+	// A QUIC server that accepts connections and never answers: the
+	// version is known once the request has a connection
+	ln, err := quic.Listen(pc, http3.ConfigureTLSConfig(&utls.Config{Certificates: []utls.Certificate{selfSignedCert(t)}}), &quic.Config{Versions: []quic.Version{quic.Version2, quic.Version1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			if _, err := ln.Accept(context.Background()); err != nil {
+				return
+			}
+		}
+	}()
+
+	for _, version := range []quic.Version{quic.Version1, quic.Version2} {
+		tr := &http3.Transport{
+			TLSClientConfig: &utls.Config{InsecureSkipVerify: true},
+			QUICConfig:      &quic.Config{Versions: []quic.Version{version}},
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+		ctx, quicVersion := traceQUICVersion(ctx)
+		req, _ := shttp.NewRequestWithContext(ctx, "GET", "https://"+pc.LocalAddr().String(), nil)
+		if resp, err := tr.RoundTrip(req); err == nil {
+			resp.Body.Close()
+		}
+		cancel()
+		tr.Close()
+		if got := quicVersion(); got != version.String() {
+			t.Errorf("traced version = %q, want %q", got, version.String())
+		}
+	}
+
+	if tracedQUICConn(&net.TCPConn{}) != nil {
+		t.Error("tracedQUICConn returned a connection for a TCP conn")
+	}
+}
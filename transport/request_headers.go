@@ -0,0 +1,104 @@
+package transport
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	http "github.com/sardanioss/http"
+)
+
+// ErrRequestHeadersTooLarge represents a request whose header block the
+// server said in advance it won't accept
+var ErrRequestHeadersTooLarge = errors.New("request headers larger than the server accepts")
+
+// RequestHeaderSizeError is returned when a request's header block is over
+// the limit the server advertised (HTTP/2 SETTINGS_MAX_HEADER_LIST_SIZE).
+// Nothing is sent and the request is never retried. Cookies are the usual
+// cause, so their share of the block is reported; dropping some of them
+// from the jar is the way out.
+type RequestHeaderSizeError struct {
+	Protocol   string // h2
+	Size       int    // Field section size, counted as in RFC 7541 section 4.1
+	CookieSize int    // Part of Size taken by cookie crumbs
+	Cookies    int    // Number of cookie crumbs
+	Err        error  // Underlying error
+}
+
+func (e *RequestHeaderSizeError) Error() string {
+	return fmt.Sprintf("%s request headers of %d bytes (%d in %d cookies) over the server's advertised limit", e.Protocol, e.Size, e.CookieSize, e.Cookies)
+}
+
+func (e *RequestHeaderSizeError) Unwrap() error {
+	return e.Err
+}
+
+func (e *RequestHeaderSizeError) Is(target error) bool {
+	return target == ErrRequestHeadersTooLarge
+}
+
+// fieldOverhead is the per-field overhead in HPACK and QPACK size accounting
+const fieldOverhead = 32
+
+// isRequestHeaderListSize reports whether err is the HTTP/2 client's
+// refusal to send an oversized header block
+func isRequestHeaderListSize(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "request header list larger than peer's advertised limit")
+}
+
+// requestHeaderSizeError turns the HTTP/2 client's refusal to send the
+// headers h into a *RequestHeaderSizeError
+func requestHeaderSizeError(h http.Header, err error) error {
+	if !isRequestHeaderListSize(err) {
+		return err
+	}
+	e := &RequestHeaderSizeError{Protocol: "h2", Err: err}
+	for name, values := range h {
+		if name == http.HeaderOrderKey || name == http.PHeaderOrderKey {
+			continue
+		}
+		for _, v := range values {
+			if !strings.EqualFold(name, "cookie") {
+				e.Size += len(name) + len(v) + fieldOverhead
+				continue
+			}
+			for _, crumb := range cookieCrumbs(v) {
+				e.CookieSize += len("cookie") + len(crumb) + fieldOverhead
+				e.Cookies++
+			}
+		}
+	}
+	e.Size += e.CookieSize
+	return e
+}
+
+// cookieCrumbs splits a Cookie header value into its cookie-pairs
+func cookieCrumbs(value string) []string {
+	var crumbs []string
+	for _, crumb := range strings.Split(value, ";") {
+		if crumb = strings.TrimSpace(crumb); crumb != "" {
+			crumbs = append(crumbs, crumb)
+		}
+	}
+	return crumbs
+}
+
+// splitCookies sends each cookie-pair of the Cookie header as its own field,
+// as browsers do on HTTP/2 and HTTP/3 (RFC 9113 8.2.3, RFC 9114 4.2.1).
+// A large cookie set then costs one field per cookie instead of one huge
+// literal, and unchanged cookies are indexed by the header compression.
+func splitCookies(h http.Header) {
+	values, ok := h["Cookie"]
+	if !ok {
+		return
+	}
+	var crumbs []string
+	for _, v := range values {
+		crumbs = append(crumbs, cookieCrumbs(v)...)
+	}
+	if len(crumbs) == 0 {
+		delete(h, "Cookie")
+		return
+	}
+	h["Cookie"] = crumbs
+}
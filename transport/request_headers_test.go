@@ -0,0 +1,63 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	stdhttp "net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	http "github.com/sardanioss/http"
+)
+
+func TestLargeCookieHeaders(t *testing.T) {
+	srv := httptest.NewUnstartedServer(stdhttp.HandlerFunc(func(w stdhttp.ResponseWriter, r *stdhttp.Request) {
+		fmt.Fprint(w, len(r.Header.Get("Cookie")))
+	}))
+	srv.EnableHTTP2 = true
+	srv.Config.MaxHeaderBytes = 64 << 10
+	srv.StartTLS()
+	defer srv.Close()
+
+	tr := NewTransport("chrome-latest")
+	defer tr.Close()
+	tr.SetProtocol(ProtocolHTTP2)
+	tr.SetInsecureSkipVerify(true)
+
+	// 40 KB of cookies spans several HEADERS/CONTINUATION frames
+	var crumbs []string
+	for i := 0; i < 40; i++ {
+		crumbs = append(crumbs, fmt.Sprintf("c%02d=%s", i, strings.Repeat("v", 1000)))
+	}
+	cookie := strings.Join(crumbs, "; ")
+	resp, err := tr.Do(context.Background(), &Request{Method: "GET", URL: srv.URL, Headers: map[string][]string{"Cookie": {cookie}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body, _ := resp.Text(); body != fmt.Sprint(len(cookie)) {
+		t.Errorf("server saw %s cookie bytes, want %d", body, len(cookie))
+	}
+	resp.Close()
+
+	// Over the advertised limit: refused before sending, with the cookies' share
+	big := cookie + "; " + cookie
+	_, err = tr.Do(context.Background(), &Request{Method: "GET", URL: srv.URL, Headers: map[string][]string{"Cookie": {big}}})
+	var hse *RequestHeaderSizeError
+	if !errors.As(err, &hse) || !errors.Is(err, ErrRequestHeadersTooLarge) || hse.Cookies != 80 || hse.CookieSize < len(big) || hse.Size <= hse.CookieSize {
+		t.Errorf("err = %#v, want a *RequestHeaderSizeError for 80 cookies", err)
+	}
+}
+
+func TestSplitCookies(t *testing.T) {
+	h := http.Header{"Cookie": {"a=1; b=2", " c=3;"}}
+	splitCookies(h)
+	if got := strings.Join(h["Cookie"], "|"); got != "a=1|b=2|c=3" {
+		t.Errorf("crumbs = %q", got)
+	}
+	h = http.Header{"Cookie": {" ; "}}
+	if splitCookies(h); h["Cookie"] != nil {
+		t.Errorf("empty cookie kept: %q", h["Cookie"])
+	}
+}
@@ -0,0 +1,90 @@
+package transport
+
+import (
+	"crypto/x509"
+	"sync"
+
+	"github.com/sardanioss/httpcloak/fingerprint"
+	utls "github.com/sardanioss/utls"
+)
+
+// SentFingerprints are the fingerprints of what a request put on the wire,
+// for comparing against what a target expects
+type SentFingerprints struct {
+	// JA4H of the request headers as sent
+	JA4H string
+
+	// JA4 of the ClientHello on the latest handshake with the host. Empty
+	// for HTTP/3, whose ClientHello the QUIC stack doesn't expose.
+	JA4 string
+
+	// JA4X of the server's leaf certificate on that handshake
+	JA4X string
+
+	// PseudoHeaderOrder is the order the pseudo-headers were sent in on
+	// HTTP/2 and HTTP/3, nil for HTTP/1.1
+	PseudoHeaderOrder []string
+
+	// Akamai is the HTTP/2 fingerprint of the latest connection to the host,
+	// computed from the frames it wrote (see fingerprint.H2Spec.Akamai).
+	// Empty for HTTP/1.1 and HTTP/3.
+	Akamai string
+}
+
+// tlsFingerprints remembers the TLS fingerprints of the latest handshake per host
+type tlsFingerprints struct {
+	mu    sync.Mutex
+	hosts map[string]tlsFingerprint
+}
+
+type tlsFingerprint struct {
+	ja4, ja4x string
+	akamai    string
+}
+
+// record computes the fingerprints of a completed handshake. hello is the
+// raw ClientHello, nil when unavailable.
+func (f *tlsFingerprints) record(host string, hello []byte, quic bool, certs []*x509.Certificate) {
+	var fp tlsFingerprint
+	if len(hello) > 0 {
+		fp.ja4, _ = fingerprint.JA4(hello, quic)
+	}
+	if len(certs) > 0 {
+		fp.ja4x = fingerprint.JA4X(certs[0])
+	}
+
+	f.mu.Lock()
+	if f.hosts == nil {
+		f.hosts = make(map[string]tlsFingerprint)
+	}
+	f.hosts[host] = fp
+	f.mu.Unlock()
+}
+
+// recordConn records the fingerprints of a completed TCP handshake
+func (f *tlsFingerprints) recordConn(host string, tlsConn *utls.UConn) {
+	var hello []byte
+	if h := tlsConn.HandshakeState.Hello; h != nil {
+		hello = h.Raw
+	}
+	f.record(host, hello, false, tlsConn.ConnectionState().PeerCertificates)
+}
+
+// recordAkamai records the Akamai fingerprint a connection to host emitted
+func (f *tlsFingerprints) recordAkamai(host, akamai string) {
+	f.mu.Lock()
+	if fp, ok := f.hosts[host]; ok {
+		fp.akamai = akamai
+		f.hosts[host] = fp
+	}
+	f.mu.Unlock()
+}
+
+// sent returns the fingerprints of a request to host with the given JA4H
+// and pseudo-header order
+func (f *tlsFingerprints) sent(host, ja4h string, pseudoOrder []string) SentFingerprints {
+	f.mu.Lock()
+	fp := f.hosts[host]
+	f.mu.Unlock()
+	return SentFingerprints{JA4H: ja4h, JA4: fp.ja4, JA4X: fp.ja4x, PseudoHeaderOrder: pseudoOrder, Akamai: fp.akamai}
+}
@@ -0,0 +1,131 @@
+package transport
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// transportShared is the state of a Transport that outlives
+// reconfiguration: learned protocols, host policy, proxy paths and
+// statistics. Every snapshot of the transport points to the same one.
+type transportShared struct {
+	// mu guards the reconfigurable fields of the Transport and current.
+	// Setters hold it while they swap fields and publish a new snapshot;
+	// requests hold it only to pick up the current snapshot.
+	mu sync.RWMutex
+
+	// Snapshot requests run on, replaced by every reconfiguration
+	current *Transport
+
+	// Track protocol support per host
+	protocolSupport   map[string]Protocol // Best known protocol per host
+	protocolSupportMu sync.RWMutex
+
+	// Custom header order (nil = use preset's order)
+	customHeaderOrder   []string
+	customHeaderOrderMu sync.RWMutex
+
+	// Allow/deny policy checked before every request (nil = unrestricted)
+	hostPolicy     *HostPolicy
+	ssrfProtection bool
+	hostPolicyMu   sync.RWMutex
+
+	// Set once a request has matched config.TargetJA4H
+	ja4hVerified atomic.Bool
+
+	// Transports for config.ProxyFallback paths and environment proxies,
+	// created on first use
+	proxyTransports proxyTransports
+	proxyBlacklist  proxyBlacklist
+
+	// Traffic per host, for cost accounting
+	hostStats hostStatsTable
+
+	// Connections, handshakes and RTT per host, for Stats
+	connStats connStatsTable
+
+	// Alt-Svc advertisements per origin, used by auto mode to pick HTTP/3
+	altSvc altSvcCache
+}
+
+// generation counts the requests running on one snapshot, so the
+// transports a reconfiguration replaced are closed once they finish
+type generation struct {
+	inflight sync.WaitGroup
+	prev     *generation   // Snapshot this one replaced, until retired
+	retired  chan struct{} // Closed when no request runs on this or an earlier snapshot
+}
+
+// retire closes g.retired once the requests on g and the earlier snapshots
+// have finished
+func (g *generation) retire() {
+	g.inflight.Wait()
+	if g.prev != nil {
+		<-g.prev.retired
+		g.prev = nil
+	}
+	close(g.retired)
+}
+
+// acquire returns the current snapshot with the request counted against
+// it. The caller runs the request on the snapshot and then calls release.
+func (t *Transport) acquire() *Transport {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	s := t.current
+	s.gen.inflight.Add(1)
+	return s
+}
+
+// release ends a request started with acquire
+func (t *Transport) release() {
+	t.gen.inflight.Done()
+}
+
+// publish makes the transport's fields the snapshot for new requests.
+// closers run once the requests on the earlier snapshots have finished,
+// to close the transports they used. Caller holds t.mu.
+func (t *Transport) publish(closers ...func()) {
+	old := t.current
+	s := *t
+	s.gen = &generation{retired: make(chan struct{})}
+	t.current = &s
+	if old == nil {
+		return
+	}
+	s.gen.prev = old.gen
+	go old.gen.retire()
+	if len(closers) > 0 {
+		go func() {
+			<-old.gen.retired
+			for _, c := range closers {
+				c()
+			}
+		}()
+	}
+}
+
+// drain waits for the requests in flight, for setters that change the
+// protocol transports in place. Caller holds t.mu, so no new request
+// starts meanwhile.
+func (t *Transport) drain() {
+	if t.current == nil {
+		return
+	}
+	g := t.current.gen
+	g.inflight.Wait()
+	if g.prev != nil {
+		<-g.prev.retired
+	}
+}
+
+// protocolClosers returns the functions that close the protocol transports,
+// for setters that replace them
+func (t *Transport) protocolClosers() []func() {
+	h1, h2, h3 := t.h1Transport, t.h2Transport, t.h3Transport
+	return []func(){h1.Close, h2.Close, func() {
+		if h3 != nil {
+			h3.Close()
+		}
+	}}
+}
@@ -0,0 +1,113 @@
+package transport
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestReconfigureDuringRequest(t *testing.T) {
+	entered := make(chan struct{})
+	unblock := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			close(entered)
+			<-unblock
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+	release := sync.OnceFunc(func() { close(unblock) })
+	defer release()
+
+	tr := NewTransport("chrome-latest")
+	defer tr.Close()
+	oldH1 := tr.GetHTTP1Transport()
+
+	slow := make(chan error, 1)
+	go func() {
+		resp, err := tr.Do(context.Background(), &Request{Method: "GET", URL: server.URL + "/slow"})
+		if err == nil {
+			resp.Close()
+		}
+		slow <- err
+	}()
+	<-entered
+
+	// None of these may wait for the slow request
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		tr.SetTimeout(20 * time.Second)
+		tr.SetProxy(nil)
+		tr.SetPreset("firefox-latest")
+		tr.Refresh()
+
+		resp, err := tr.Do(context.Background(), &Request{Method: "GET", URL: server.URL + "/fast"})
+		if err != nil {
+			t.Errorf("request after reconfiguring: %v", err)
+			return
+		}
+		resp.Close()
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("reconfiguring waited for the in-flight request")
+	}
+	if tr.GetHTTP1Transport() == oldH1 {
+		t.Fatal("SetProxy kept the old HTTP/1.1 transport")
+	}
+
+	// The in-flight request finishes on the transports it started with
+	if isClosed(oldH1) {
+		t.Fatal("old transport closed while a request was running on it")
+	}
+	release()
+	if err := <-slow; err != nil {
+		t.Fatalf("in-flight request: %v", err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for !isClosed(oldH1) {
+		if time.Now().After(deadline) {
+			t.Fatal("old transport not closed after its request finished")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func isClosed(t *HTTP1Transport) bool {
+	t.closedMu.RLock()
+	defer t.closedMu.RUnlock()
+	return t.closed
+}
+
+// TestReconfigureKeepsHTTP3Config checks that the HTTP/3 transports rebuilt by
+// SetPreset and SetProxy keep the transport config
+func TestReconfigureKeepsHTTP3Config(t *testing.T) {
+	config := &TransportConfig{
+		CertPinner: &spkiPinner{},
+		QUIC:       &QUICOptions{HandshakeTimeout: 3 * time.Second},
+	}
+	tr := NewTransportWithConfig("chrome-latest", nil, config)
+	defer tr.Close()
+	check := func(step string) {
+		h3 := tr.GetHTTP3Transport()
+		if h3.config != config {
+			t.Errorf("%s: HTTP/3 transport lost the config", step)
+		}
+		if got := h3.quicConfig.HandshakeIdleTimeout; got != 3*time.Second {
+			t.Errorf("%s: QUIC handshake timeout = %v, want 3s", step, got)
+		}
+	}
+	check("NewTransportWithConfig")
+	tr.SetPreset("firefox-latest")
+	check("SetPreset")
+	tr.SetProxy(nil)
+	check("SetProxy(nil)")
+	tr.SetProxy(&ProxyConfig{URL: "http://127.0.0.1:1"})
+	check("SetProxy(http)")
+}
@@ -0,0 +1,87 @@
+package transport
+
+import (
+	"errors"
+	"io"
+	"sync/atomic"
+	"time"
+)
+
+// ErrStalled represents a response body that stopped arriving: a read got
+// no bytes within the stall timeout
+var ErrStalled = errors.New("no response body data within the stall timeout")
+
+// bodyAborter is a body that can drop its connection at once, where Close
+// would first drain what is left of the body
+type bodyAborter interface {
+	abort()
+}
+
+// stallReader aborts a body Read that gets no bytes within d by aborting or
+// closing the body. The clock only runs inside Read, so a consumer that
+// pauses between reads never trips it.
+type stallReader struct {
+	body    io.ReadCloser
+	d       time.Duration
+	timer   *time.Timer
+	stalled atomic.Bool
+	err     error
+}
+
+// watchStall wraps body with the stall timeout d, returning body unchanged
+// when d is 0. Reads aborted by it fail with a timeout error wrapping
+// ErrStalled.
+func watchStall(body io.ReadCloser, d time.Duration, host, port, protocol string) io.ReadCloser {
+	if d <= 0 {
+		return body
+	}
+	r := &stallReader{
+		body: body,
+		d:    d,
+		err:  NewTimeoutError("read_body", host, port, protocol, ErrStalled),
+	}
+	r.timer = time.AfterFunc(d, func() {
+		r.stalled.Store(true)
+		if a, ok := body.(bodyAborter); ok {
+			a.abort()
+		} else {
+			body.Close()
+		}
+	})
+	r.timer.Stop()
+	return r
+}
+
+func (r *stallReader) Read(p []byte) (int, error) {
+	if r.stalled.Load() {
+		return 0, r.err
+	}
+	r.timer.Reset(r.d)
+	n, err := r.body.Read(p)
+	if !r.timer.Stop() && r.stalled.Load() {
+		return n, r.err
+	}
+	return n, err
+}
+
+func (r *stallReader) Close() error {
+	r.timer.Stop()
+	return r.body.Close()
+}
+
+// stallTimeout returns TransportConfig.StallTimeout, 0 when unset
+func (t *Transport) stallTimeout() time.Duration {
+	if t.config == nil {
+		return 0
+	}
+	return t.config.StallTimeout
+}
+
+// readBodyError classifies a failed body read: a stall keeps its retryable
+// timeout error, anything else is a request error
+func readBodyError(host, port, protocol string, err error) error {
+	if errors.Is(err, ErrStalled) {
+		return err
+	}
+	return NewRequestError("read_body", host, port, protocol, err)
+}
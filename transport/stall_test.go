@@ -0,0 +1,61 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestStallTimeout(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "a")
+		w.(http.Flusher).Flush()
+		select {
+		case <-release:
+		case <-r.Context().Done():
+			return
+		case <-time.After(5 * time.Second):
+		}
+		io.WriteString(w, "b")
+	}))
+	defer srv.Close()
+
+	tr := NewTransportWithConfig("chrome-latest", nil, &TransportConfig{StallTimeout: 100 * time.Millisecond})
+	defer tr.Close()
+	tr.SetProtocol(ProtocolHTTP1)
+
+	start := time.Now()
+	_, err := tr.Do(context.Background(), &Request{Method: "GET", URL: srv.URL})
+	if !errors.Is(err, ErrStalled) || !errors.Is(err, ErrTimeout) {
+		t.Fatalf("trickled body: err = %v, want a timeout wrapping ErrStalled", err)
+	}
+	var te *TransportError
+	if !errors.As(err, &te) || !te.IsRetryable() {
+		t.Errorf("stall error %v is not retryable", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("stall detected after %v", elapsed)
+	}
+
+	// A stream consumer pausing between reads is not a stall
+	resp, err := tr.DoStream(context.Background(), &Request{Method: "GET", URL: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Close()
+	buf := make([]byte, 1)
+	if _, err := io.ReadFull(resp, buf); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(300 * time.Millisecond)
+	close(release)
+	rest, err := io.ReadAll(resp)
+	if err != nil || string(rest) != "b" {
+		t.Errorf("after a consumer pause: body = %q, err = %v", rest, err)
+	}
+}
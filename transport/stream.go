@@ -26,9 +26,21 @@ type StreamResponse struct {
 	Timing     *protocol.Timing
 	Protocol   string // "h1", "h2", or "h3"
 
+	// QUICVersion is the negotiated QUIC version for HTTP/3, empty otherwise
+	QUICVersion string
+
 	// ContentLength is the expected total size (-1 if unknown/chunked)
 	ContentLength int64
 
+	// SentFingerprints are the JA4H of the request and the JA4/JA4X of the
+	// TLS handshake it went over
+	SentFingerprints SentFingerprints
+
+	// Violations are the protocol violations of the response head when
+	// TransportConfig.StrictConformance is set. Body violations surface as
+	// *ProtocolViolationError from Read.
+	Violations []ProtocolViolation
+
 	// The underlying response body reader
 	reader       io.ReadCloser
 	decompressor io.Closer
@@ -36,6 +48,12 @@ type StreamResponse struct {
 
 	// Context cancel function - called when response is closed
 	cancel context.CancelFunc
+
+	// tee is the body copy installed by Tee, finished on Close
+	tee io.Closer
+
+	// progress counts the body's reads, see Progress
+	progress *streamProgress
 }
 
 // Read reads data from the response body
@@ -45,6 +63,9 @@ func (r *StreamResponse) Read(p []byte) (n int, err error) {
 
 // Close closes the response body and cancels the context
 func (r *StreamResponse) Close() error {
+	if r.tee != nil {
+		r.tee.Close()
+	}
 	if r.cancel != nil {
 		r.cancel()
 	}
@@ -99,8 +120,63 @@ func (r *StreamResponse) IsSuccess() bool {
 }
 
 // DoStream executes an HTTP request and returns a streaming response
-// The caller is responsible for closing the response when done
+// The caller is responsible for closing the response when done. Panics are
+// returned as a *PanicError, including those of a custom decoder's Read.
 func (t *Transport) DoStream(ctx context.Context, req *Request) (*StreamResponse, error) {
+	s := t.acquire()
+	defer s.release()
+	return s.doStreamRequest(ctx, req)
+}
+
+// doStreamRequest runs DoStream on a snapshot
+func (t *Transport) doStreamRequest(ctx context.Context, req *Request) (resp *StreamResponse, err error) {
+	defer RecoverPanic(&resp, &err)
+
+	if err := t.checkHostPolicy(ctx, req.URL); err != nil {
+		return nil, err
+	}
+	if err := checkPseudoOrder(req); err != nil {
+		return nil, err
+	}
+
+	doStream := t.doStream
+	if et := t.environmentTransport(req.URL); et != nil {
+		doStream = et.doStream
+	} else if t.proxySelector() != nil {
+		doStream = t.doStreamWithProxySelector
+	} else if t.proxyPool() != nil {
+		doStream = t.doStreamWithProxyPool
+	}
+	ctx = t.withFirstByteTimeout(ctx, req)
+	var violations *violationLog
+	if t.strictConformance() {
+		ctx, violations = withViolationLog(ctx)
+	}
+	resp, err = labeled(ctx, req, doStream)
+	err = headerLimitError(t.config, err)
+	if err == nil && resp.Protocol != "h1" {
+		if err = checkHeaderLimits(resp.Protocol, resp.Headers, headerLimits(t.config, resp.Protocol)); err != nil {
+			resp.Close()
+		}
+	}
+	if violations != nil {
+		if err != nil {
+			return nil, frameViolation(err)
+		}
+		resp.Violations = append(violations.list(), headerViolations(resp.Protocol, resp.Headers, t.headerListLimit(resp.Protocol))...)
+	}
+	if err != nil {
+		return nil, err
+	}
+	t.recordAltSvc(req.URL, resp.Headers)
+	if resp.Timing != nil {
+		resp.Timing.Server = protocol.ParseServerTiming(resp.Headers["server-timing"])
+	}
+	return resp, nil
+}
+
+// doStream selects the protocol for the streaming request and executes it
+func (t *Transport) doStream(ctx context.Context, req *Request) (*StreamResponse, error) {
 	// Parse URL to determine scheme
 	parsedURL, err := url.Parse(req.URL)
 	if err != nil {
@@ -108,20 +184,25 @@ func (t *Transport) DoStream(ctx context.Context, req *Request) (*StreamResponse
 	}
 
 	// For HTTP (non-TLS), only HTTP/1.1 is supported
-	if parsedURL.Scheme == "http" {
+	if parsedURL.Scheme == "http" || req.HTTP10 {
 		return t.doStreamHTTP1(ctx, req)
 	}
 
-	// When proxy is configured, select protocol based on proxy capabilities
+	// When proxy is configured, respect the protocol choice like do does and
+	// select by proxy capabilities in auto mode
 	if t.proxy != nil && (t.proxy.URL != "" || t.proxy.TCPProxy != "" || t.proxy.UDPProxy != "") {
-		effectiveProxyURL := t.proxy.URL
-		if effectiveProxyURL == "" {
-			effectiveProxyURL = t.proxy.TCPProxy
-		}
-		if effectiveProxyURL == "" {
-			effectiveProxyURL = t.proxy.UDPProxy
+		switch t.protocol {
+		case ProtocolHTTP1:
+			return t.doStreamHTTP1(ctx, req)
+		case ProtocolHTTP2:
+			return t.doStreamHTTP2(ctx, req)
+		case ProtocolHTTP3:
+			if err := t.checkH3Proxy(); err != nil {
+				return nil, err
+			}
+			return t.doStreamHTTP3(ctx, req)
 		}
-		if SupportsQUIC(effectiveProxyURL) {
+		if t.checkH3Proxy() == nil {
 			resp, err := t.doStreamHTTP3(ctx, req)
 			if err == nil {
 				return resp, nil
@@ -129,7 +210,7 @@ func (t *Transport) DoStream(ctx context.Context, req *Request) (*StreamResponse
 			// Fallback to HTTP/2
 			return t.doStreamHTTP2(ctx, req)
 		}
-		// HTTP/HTTPS proxy - use HTTP/2
+		// HTTP/HTTPS proxy, or a SOCKS5 proxy without UDP relay - use HTTP/2
 		return t.doStreamHTTP2(ctx, req)
 	}
 
@@ -142,8 +223,9 @@ func (t *Transport) DoStream(ctx context.Context, req *Request) (*StreamResponse
 	case ProtocolHTTP3:
 		return t.doStreamHTTP3(ctx, req)
 	default:
-		// Auto mode: try H3 -> H2 with fallback
-		if t.h3Transport != nil {
+		// Auto mode: HTTP/3 once the origin advertised it, falling back to
+		// HTTP/2
+		if t.h3Transport != nil && t.altSvcH3(req.URL) {
 			resp, err := t.doStreamHTTP3(ctx, req)
 			if err == nil {
 				return resp, nil
@@ -206,7 +288,7 @@ func (t *Transport) doStreamHTTP1(ctx context.Context, req *Request) (*StreamRes
 	}
 
 	// Set preset headers
-	applyPresetHeaders(httpReq, t.preset, t.getHeaderOrder(), t.getCustomPseudoOrder(), effectiveTLSOnly, "h1")
+	applyPresetHeaders(httpReq, t.preset, t.getHeaderOrder(), t.pseudoOrder(req), effectiveTLSOnly, "h1")
 
 	// Override with custom headers (multi-value support)
 	// Use Set for first value to replace preset headers, Add for additional values
@@ -220,6 +302,18 @@ func (t *Transport) doStreamHTTP1(ctx context.Context, req *Request) (*StreamRes
 		}
 	}
 
+	ja4hProto := "h1"
+	if req.HTTP10 {
+		httpReq.Proto, httpReq.ProtoMinor = "HTTP/1.0", 0
+		ja4hProto = "http/1.0"
+	}
+
+	ja4h, err := t.ja4h(httpReq, ja4hProto)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
 	// Record timing before request
 	reqStart := time.Now()
 
@@ -237,19 +331,22 @@ func (t *Transport) doStreamHTTP1(ctx context.Context, req *Request) (*StreamRes
 	headers := buildHeadersMap(resp.Header)
 
 	// Setup decompression reader
-	reader, decompressor := setupStreamDecompressor(resp.Body, resp.Header.Get("Content-Encoding"))
+	progress := newStreamProgress()
+	reader, decompressor := setupStreamDecompressor(progress.wire(watchStall(resp.Body, t.stallTimeout(), host, port, "h1")), resp.Header.Get("Content-Encoding"))
 
 	return &StreamResponse{
-		StatusCode:    resp.StatusCode,
-		Headers:       headers,
-		FinalURL:      req.URL,
-		Timing:        timing,
-		Protocol:      "h1",
-		ContentLength: resp.ContentLength,
-		reader:        reader,
-		decompressor:  decompressor,
-		rawReader:     resp.Body,
-		cancel:        cancel,
+		StatusCode:       resp.StatusCode,
+		Headers:          headers,
+		FinalURL:         req.URL,
+		Timing:           timing,
+		Protocol:         "h1",
+		ContentLength:    resp.ContentLength,
+		SentFingerprints: t.h1Transport.fingerprints.sent(host, ja4h, nil),
+		reader:           progress.body(reader),
+		decompressor:     decompressor,
+		progress:         progress,
+		rawReader:        resp.Body,
+		cancel:           cancel,
 	}, nil
 }
 
@@ -305,7 +402,7 @@ func (t *Transport) doStreamHTTP2(ctx context.Context, req *Request) (*StreamRes
 	}
 
 	// Set preset headers
-	applyPresetHeaders(httpReq, t.preset, t.getHeaderOrder(), t.getCustomPseudoOrder(), effectiveTLSOnly, "h2")
+	applyPresetHeaders(httpReq, t.preset, t.getHeaderOrder(), t.pseudoOrder(req), effectiveTLSOnly, "h2")
 
 	// Override with custom headers (multi-value support)
 	// Use Set for first value to replace preset headers, Add for additional values
@@ -319,6 +416,17 @@ func (t *Transport) doStreamHTTP2(ctx context.Context, req *Request) (*StreamRes
 		}
 	}
 
+	// Browsers on RFC 7540 priorities don't send the Priority header
+	if !t.preset.H2().SendsPriorityHeader() {
+		httpReq.Header.Del("Priority")
+	}
+
+	ja4h, err := t.ja4h(httpReq, "h2")
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
 	// Record timing before request
 	reqStart := time.Now()
 
@@ -326,7 +434,7 @@ func (t *Transport) doStreamHTTP2(ctx context.Context, req *Request) (*StreamRes
 	resp, err := t.h2Transport.RoundTrip(httpReq)
 	if err != nil {
 		cancel()
-		return nil, WrapError("roundtrip", host, port, "h2", err)
+		return nil, WrapError("roundtrip", host, port, "h2", requestHeaderSizeError(httpReq.Header, err))
 	}
 
 	timing.FirstByte = float64(time.Since(reqStart).Milliseconds())
@@ -336,19 +444,22 @@ func (t *Transport) doStreamHTTP2(ctx context.Context, req *Request) (*StreamRes
 	headers := buildHeadersMap(resp.Header)
 
 	// Setup decompression reader
-	reader, decompressor := setupStreamDecompressor(resp.Body, resp.Header.Get("Content-Encoding"))
+	progress := newStreamProgress()
+	reader, decompressor := setupStreamDecompressor(progress.wire(watchStall(resp.Body, t.stallTimeout(), host, port, "h2")), resp.Header.Get("Content-Encoding"))
 
 	return &StreamResponse{
-		StatusCode:    resp.StatusCode,
-		Headers:       headers,
-		FinalURL:      req.URL,
-		Timing:        timing,
-		Protocol:      "h2",
-		ContentLength: resp.ContentLength,
-		reader:        reader,
-		decompressor:  decompressor,
-		rawReader:     resp.Body,
-		cancel:        cancel,
+		StatusCode:       resp.StatusCode,
+		Headers:          headers,
+		FinalURL:         req.URL,
+		Timing:           timing,
+		Protocol:         "h2",
+		ContentLength:    resp.ContentLength,
+		SentFingerprints: t.h2Transport.fingerprints.sent(host, ja4h, httpReq.Header[http.PHeaderOrderKey]),
+		reader:           progress.body(reader),
+		decompressor:     decompressor,
+		progress:         progress,
+		rawReader:        resp.Body,
+		cancel:           cancel,
 	}, nil
 }
 
@@ -391,7 +502,8 @@ func (t *Transport) doStreamHTTP3(ctx context.Context, req *Request) (*StreamRes
 		bodyReader = bytes.NewReader([]byte{})
 	}
 
-	httpReq, err := http.NewRequestWithContext(ctx, method, req.URL, bodyReader)
+	reqCtx, quicVersion := traceQUICVersion(ctx)
+	httpReq, err := http.NewRequestWithContext(reqCtx, method, req.URL, bodyReader)
 	if err != nil {
 		cancel()
 		return nil, NewRequestError("create_request", host, port, "h3", err)
@@ -404,7 +516,7 @@ func (t *Transport) doStreamHTTP3(ctx context.Context, req *Request) (*StreamRes
 	}
 
 	// Set preset headers
-	applyPresetHeaders(httpReq, t.preset, t.getHeaderOrder(), t.getCustomPseudoOrder(), effectiveTLSOnly, "h3")
+	applyPresetHeaders(httpReq, t.preset, t.getHeaderOrder(), t.pseudoOrder(req), effectiveTLSOnly, "h3")
 
 	// Override with custom headers (multi-value support)
 	// Use Set for first value to replace preset headers, Add for additional values
@@ -418,6 +530,12 @@ func (t *Transport) doStreamHTTP3(ctx context.Context, req *Request) (*StreamRes
 		}
 	}
 
+	ja4h, err := t.ja4h(httpReq, "h3")
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
 	// Record timing before request
 	reqStart := time.Now()
 
@@ -435,24 +553,34 @@ func (t *Transport) doStreamHTTP3(ctx context.Context, req *Request) (*StreamRes
 	headers := buildHeadersMap(resp.Header)
 
 	// Setup decompression reader
-	reader, decompressor := setupStreamDecompressor(resp.Body, resp.Header.Get("Content-Encoding"))
+	progress := newStreamProgress()
+	reader, decompressor := setupStreamDecompressor(progress.wire(watchStall(resp.Body, t.stallTimeout(), host, port, "h3")), resp.Header.Get("Content-Encoding"))
 
 	return &StreamResponse{
-		StatusCode:    resp.StatusCode,
-		Headers:       headers,
-		FinalURL:      req.URL,
-		Timing:        timing,
-		Protocol:      "h3",
-		ContentLength: resp.ContentLength,
-		reader:        reader,
-		decompressor:  decompressor,
-		rawReader:     resp.Body,
-		cancel:        cancel,
+		StatusCode:       resp.StatusCode,
+		Headers:          headers,
+		FinalURL:         req.URL,
+		Timing:           timing,
+		Protocol:         "h3",
+		QUICVersion:      quicVersion(),
+		ContentLength:    resp.ContentLength,
+		SentFingerprints: t.h3Transport.fingerprints.sent(host, ja4h, httpReq.Header[http.PHeaderOrderKey]),
+		reader:           progress.body(reader),
+		decompressor:     decompressor,
+		progress:         progress,
+		rawReader:        resp.Body,
+		cancel:           cancel,
 	}, nil
 }
 
 // setupStreamDecompressor creates a decompression reader based on Content-Encoding
+// Custom decoders registered via RegisterDecoder take precedence over built-ins.
 func setupStreamDecompressor(body io.ReadCloser, encoding string) (io.ReadCloser, io.Closer) {
+	if decoder, ok := GetDecoder(encoding); ok {
+		reader := decoder(body)
+		return panicSafeReader{reader}, reader
+	}
+
 	switch strings.ToLower(encoding) {
 	case "gzip":
 		reader, err := gzip.NewReader(body)
@@ -0,0 +1,135 @@
+package transport
+
+import (
+	"io"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultStallThreshold is how long a Read of a streaming body has to wait
+// for data to count as a stall
+const DefaultStallThreshold = time.Second
+
+// StreamProgress is a snapshot of the read counters of a streaming body.
+// Download managers poll it, from any goroutine, to detect stalls on their
+// own terms and to size their reads.
+type StreamProgress struct {
+	BytesRead   int64         // Body bytes returned by Read, after decompression
+	WireBytes   int64         // Body bytes received, before decompression
+	Reads       int64         // Read calls
+	Stalls      int64         // Reads that waited longer than the stall threshold
+	LongestWait time.Duration // Longest wait of a single Read
+
+	HeadersAt    time.Time // When the response headers arrived
+	LastActivity time.Time // When body data last arrived, HeadersAt before any
+}
+
+// Idle returns how long no body data has arrived
+func (p StreamProgress) Idle() time.Duration {
+	return time.Since(p.LastActivity)
+}
+
+// Throughput returns the wire bytes per second since the headers arrived
+func (p StreamProgress) Throughput() float64 {
+	elapsed := p.LastActivity.Sub(p.HeadersAt).Seconds()
+	if elapsed <= 0 {
+		return 0
+	}
+	return float64(p.WireBytes) / elapsed
+}
+
+// streamProgress holds the counters behind StreamProgress
+type streamProgress struct {
+	bytesRead      atomic.Int64
+	wireBytes      atomic.Int64
+	reads          atomic.Int64
+	stalls         atomic.Int64
+	longestWait    atomic.Int64
+	stallThreshold atomic.Int64
+	lastActivity   atomic.Int64 // UnixNano
+	headersAt      time.Time
+}
+
+func newStreamProgress() *streamProgress {
+	p := &streamProgress{headersAt: time.Now()}
+	p.stallThreshold.Store(int64(DefaultStallThreshold))
+	p.lastActivity.Store(p.headersAt.UnixNano())
+	return p
+}
+
+// wire counts the bytes read from the body as received
+func (p *streamProgress) wire(body io.ReadCloser) io.ReadCloser {
+	return &wireCounter{ReadCloser: body, p: p}
+}
+
+// body counts the reads of the decoded body
+func (p *streamProgress) body(reader io.ReadCloser) io.ReadCloser {
+	return &readCounter{ReadCloser: reader, p: p}
+}
+
+func (p *streamProgress) snapshot() StreamProgress {
+	return StreamProgress{
+		BytesRead:    p.bytesRead.Load(),
+		WireBytes:    p.wireBytes.Load(),
+		Reads:        p.reads.Load(),
+		Stalls:       p.stalls.Load(),
+		LongestWait:  time.Duration(p.longestWait.Load()),
+		HeadersAt:    p.headersAt,
+		LastActivity: time.Unix(0, p.lastActivity.Load()),
+	}
+}
+
+type wireCounter struct {
+	io.ReadCloser
+	p *streamProgress
+}
+
+func (c *wireCounter) Read(b []byte) (int, error) {
+	n, err := c.ReadCloser.Read(b)
+	if n > 0 {
+		c.p.wireBytes.Add(int64(n))
+		c.p.lastActivity.Store(time.Now().UnixNano())
+	}
+	return n, err
+}
+
+type readCounter struct {
+	io.ReadCloser
+	p *streamProgress
+}
+
+func (c *readCounter) Read(b []byte) (int, error) {
+	start := time.Now()
+	n, err := c.ReadCloser.Read(b)
+	wait := int64(time.Since(start))
+
+	c.p.reads.Add(1)
+	c.p.bytesRead.Add(int64(n))
+	if wait > c.p.stallThreshold.Load() {
+		c.p.stalls.Add(1)
+	}
+	for {
+		longest := c.p.longestWait.Load()
+		if wait <= longest || c.p.longestWait.CompareAndSwap(longest, wait) {
+			break
+		}
+	}
+	return n, err
+}
+
+// Progress returns the body's read counters so far. It is safe to call
+// while another goroutine reads.
+func (r *StreamResponse) Progress() StreamProgress {
+	if r.progress == nil {
+		return StreamProgress{}
+	}
+	return r.progress.snapshot()
+}
+
+// SetStallThreshold sets how long a Read has to wait for data to count in
+// StreamProgress.Stalls. Default DefaultStallThreshold.
+func (r *StreamResponse) SetStallThreshold(d time.Duration) {
+	if r.progress != nil {
+		r.progress.stallThreshold.Store(int64(d))
+	}
+}
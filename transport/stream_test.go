@@ -4,8 +4,12 @@ import (
 	"bytes"
 	"compress/flate"
 	"compress/gzip"
+	"context"
 	"io"
+	"net/http"
+	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/andybalholm/brotli"
 	"github.com/klauspost/compress/zstd"
@@ -139,3 +143,116 @@ func TestSetupStreamDecompressor_CaseInsensitive(t *testing.T) {
 		t.Errorf("Case insensitive test failed")
 	}
 }
+
+func TestRegisterDecoder(t *testing.T) {
+	// Toy "reverse" encoding used only to prove the registry is consulted
+	RegisterDecoder("X-Reverse", func(r io.Reader) io.ReadCloser {
+		data, _ := io.ReadAll(r)
+		for i, j := 0, len(data)-1; i < j; i, j = i+1, j-1 {
+			data[i], data[j] = data[j], data[i]
+		}
+		return io.NopCloser(bytes.NewReader(data))
+	})
+	defer RegisterDecoder("x-reverse", nil)
+
+	body := &mockReadCloser{bytes.NewReader([]byte("olleh"))}
+	reader, closer := setupStreamDecompressor(body, "x-reverse")
+	if closer == nil {
+		t.Error("Expected closer for custom decoder")
+	}
+	result, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("Failed to read custom-decoded stream: %v", err)
+	}
+	if string(result) != "hello" {
+		t.Errorf("Stream decode = %q, want %q", result, "hello")
+	}
+
+	result, err = decompress([]byte("dlrow"), "X-REVERSE")
+	if err != nil {
+		t.Fatalf("decompress failed: %v", err)
+	}
+	if string(result) != "world" {
+		t.Errorf("Buffered decode = %q, want %q", result, "world")
+	}
+
+	RegisterDecoder("x-reverse", nil)
+	if _, ok := GetDecoder("x-reverse"); ok {
+		t.Error("Expected decoder to be removed after registering nil")
+	}
+}
+
+// FuzzDecompress feeds malformed bodies through both decompression paths
+func FuzzDecompress(f *testing.F) {
+	data := []byte("Hello, World! This is test data for compression.")
+	var gz, fl, br, zs bytes.Buffer
+	gw := gzip.NewWriter(&gz)
+	gw.Write(data)
+	gw.Close()
+	fw, _ := flate.NewWriter(&fl, flate.DefaultCompression)
+	fw.Write(data)
+	fw.Close()
+	bw := brotli.NewWriter(&br)
+	bw.Write(data)
+	bw.Close()
+	zw, _ := zstd.NewWriter(&zs)
+	zw.Write(data)
+	zw.Close()
+	f.Add(gz.Bytes(), "gzip")
+	f.Add(fl.Bytes(), "deflate")
+	f.Add(br.Bytes(), "br")
+	f.Add(zs.Bytes(), "zstd")
+	f.Add(data, "identity")
+
+	f.Fuzz(func(t *testing.T, body []byte, encoding string) {
+		decompress(body, encoding)
+
+		reader, closer := setupStreamDecompressor(&mockReadCloser{bytes.NewReader(body)}, encoding)
+		io.Copy(io.Discard, reader)
+		if closer != nil {
+			closer.Close()
+		}
+	})
+}
+
+func TestStreamProgress(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "first ")
+		w.(http.Flusher).Flush()
+		time.Sleep(50 * time.Millisecond)
+		io.WriteString(w, "second")
+	}))
+	defer srv.Close()
+
+	tr := NewTransport("chrome-latest")
+	defer tr.Close()
+	tr.SetProtocol(ProtocolHTTP1)
+	resp, err := tr.DoStream(context.Background(), &Request{Method: "GET", URL: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Close()
+	resp.SetStallThreshold(20 * time.Millisecond)
+
+	before := resp.Progress()
+	if before.HeadersAt.IsZero() || !before.LastActivity.Equal(before.HeadersAt) {
+		t.Errorf("before reading: HeadersAt = %v, LastActivity = %v", before.HeadersAt, before.LastActivity)
+	}
+	body, err := io.ReadAll(resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := resp.Progress()
+	if p.BytesRead != int64(len(body)) || string(body) != "first second" {
+		t.Errorf("BytesRead = %d, body = %q", p.BytesRead, body)
+	}
+	if p.WireBytes < p.BytesRead {
+		t.Errorf("WireBytes = %d, below BytesRead %d", p.WireBytes, p.BytesRead)
+	}
+	if p.Stalls == 0 || p.LongestWait < 20*time.Millisecond {
+		t.Errorf("Stalls = %d, LongestWait = %v, want the 50ms pause counted", p.Stalls, p.LongestWait)
+	}
+	if !p.LastActivity.After(p.HeadersAt) || p.Reads < 2 {
+		t.Errorf("LastActivity = %v, HeadersAt = %v, Reads = %d", p.LastActivity, p.HeadersAt, p.Reads)
+	}
+}
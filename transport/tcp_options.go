@@ -0,0 +1,243 @@
+package transport
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"runtime"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// ErrTCPOptionsUnsupported is returned when dialing with TCPOptions the
+// platform can't apply
+var ErrTCPOptionsUnsupported = errors.New("TCP options not supported on this platform")
+
+// TCPOptions tunes the parameters passive TCP fingerprinting (p0f and the
+// like) reads from the SYN, so the TCP stack doesn't contradict the OS the
+// preset claims. Zero fields keep the system defaults.
+//
+// The options apply to direct connections only: through a proxy the server
+// sees the proxy's TCP stack. The keepalive settings are the exception and
+// apply to proxy connections too. Not every platform can set every option
+// (see Capabilities): a dial with an option the platform can't apply fails
+// with ErrTCPOptionsUnsupported rather than silently sending the host's
+// values. ForPlatform drops those options instead.
+type TCPOptions struct {
+	// TTL is the IP time-to-live (the hop limit on IPv6): 64 for Linux,
+	// Android and macOS, 128 for Windows
+	TTL int
+
+	// WindowSize clamps the receive window advertised in the SYN
+	// (TCP_WINDOW_CLAMP)
+	WindowSize int
+
+	// MSS is the maximum segment size announced in the SYN (TCP_MAXSEG)
+	MSS int
+
+	// ReceiveBuffer sets SO_RCVBUF, from which the kernel derives the
+	// window scale. Values above net.core.rmem_max are capped by the
+	// kernel unless Privileged is set.
+	ReceiveBuffer int
+
+	// SendBuffer sets SO_SNDBUF
+	SendBuffer int
+
+	// Nagle enables Nagle's algorithm. Go sets TCP_NODELAY by default,
+	// which browsers on some systems don't.
+	Nagle bool
+
+	// KeepAliveIdle is how long a connection is idle before the first
+	// keepalive probe, KeepAliveInterval the time between probes and
+	// KeepAliveCount how many unanswered probes drop it. Zero keeps the
+	// defaults: 30 seconds for both durations and the system's count.
+	KeepAliveIdle     time.Duration
+	KeepAliveInterval time.Duration
+	KeepAliveCount    int
+
+	// BindDevice binds direct connections to a network interface by name
+	// (SO_BINDTODEVICE on Linux, IP_BOUND_IF on macOS, IP_UNICAST_IF on
+	// Windows), so they leave through it whatever the routing table says.
+	// On Linux before 5.7 it needs CAP_NET_RAW.
+	BindDevice string
+
+	// Privileged opts in to settings that need CAP_NET_ADMIN: ReceiveBuffer
+	// and SendBuffer are forced past net.core.rmem_max and wmem_max with
+	// SO_RCVBUFFORCE and SO_SNDBUFFORCE. Dials fail without the capability.
+	// Linux only.
+	Privileged bool
+}
+
+// PlatformCapabilities reports which TCPOptions the running platform can
+// apply
+type PlatformCapabilities struct {
+	OS string // runtime.GOOS
+
+	TTL            bool
+	WindowSize     bool
+	MSS            bool
+	ReceiveBuffer  bool
+	SendBuffer     bool
+	KeepAlive      bool // KeepAliveIdle and KeepAliveInterval
+	KeepAliveCount bool
+	BindDevice     bool
+	Privileged     bool
+}
+
+// Capabilities returns the TCPOptions the running platform supports
+func Capabilities() PlatformCapabilities {
+	caps := platformCapabilities
+	caps.OS = runtime.GOOS
+	return caps
+}
+
+// unsupported lists the options set in o that the platform can't apply
+func (o *TCPOptions) unsupported(caps PlatformCapabilities) []string {
+	var names []string
+	check := func(set, supported bool, name string) {
+		if set && !supported {
+			names = append(names, name)
+		}
+	}
+	check(o.TTL > 0, caps.TTL, "TTL")
+	check(o.WindowSize > 0, caps.WindowSize, "WindowSize")
+	check(o.MSS > 0, caps.MSS, "MSS")
+	check(o.ReceiveBuffer > 0, caps.ReceiveBuffer, "ReceiveBuffer")
+	check(o.SendBuffer > 0, caps.SendBuffer, "SendBuffer")
+	check(o.KeepAliveIdle > 0 || o.KeepAliveInterval > 0, caps.KeepAlive, "KeepAlive")
+	check(o.KeepAliveCount > 0, caps.KeepAliveCount, "KeepAliveCount")
+	check(o.BindDevice != "", caps.BindDevice, "BindDevice")
+	check(o.Privileged && (o.ReceiveBuffer > 0 || o.SendBuffer > 0), caps.Privileged, "Privileged")
+	return names
+}
+
+// ForPlatform returns a copy of the options without those the running
+// platform can't apply, which keep the host's values instead of failing
+// dials
+func (o *TCPOptions) ForPlatform() *TCPOptions {
+	if o == nil {
+		return nil
+	}
+	caps := Capabilities()
+	p := *o
+	for _, name := range o.unsupported(caps) {
+		switch name {
+		case "TTL":
+			p.TTL = 0
+		case "WindowSize":
+			p.WindowSize = 0
+		case "MSS":
+			p.MSS = 0
+		case "ReceiveBuffer":
+			p.ReceiveBuffer = 0
+		case "SendBuffer":
+			p.SendBuffer = 0
+		case "KeepAlive":
+			p.KeepAliveIdle, p.KeepAliveInterval = 0, 0
+		case "KeepAliveCount":
+			p.KeepAliveCount = 0
+		case "BindDevice":
+			p.BindDevice = ""
+		case "Privileged":
+			p.Privileged = false
+		}
+	}
+	return &p
+}
+
+// TCPOptionsForOS returns the options matching the default TCP stack of an
+// operating system: "windows", "macos" (or "darwin", "ios"), "linux" or
+// "android". Unknown names return nil.
+func TCPOptionsForOS(name string) *TCPOptions {
+	switch strings.ToLower(name) {
+	case "windows":
+		return &TCPOptions{TTL: 128, WindowSize: 64240}
+	case "macos", "darwin", "ios":
+		return &TCPOptions{TTL: 64, WindowSize: 65535}
+	case "linux", "android":
+		return &TCPOptions{TTL: 64, WindowSize: 64240}
+	}
+	return nil
+}
+
+// TCPOptionsForUserAgent returns TCPOptionsForOS for the operating system
+// named by a User-Agent, nil if it names none
+func TCPOptionsForUserAgent(ua string) *TCPOptions {
+	switch {
+	case strings.Contains(ua, "Windows"):
+		return TCPOptionsForOS("windows")
+	case strings.Contains(ua, "iPhone"), strings.Contains(ua, "iPad"), strings.Contains(ua, "Macintosh"):
+		return TCPOptionsForOS("macos")
+	case strings.Contains(ua, "Android"):
+		return TCPOptionsForOS("android")
+	case strings.Contains(ua, "Linux"), strings.Contains(ua, "X11"):
+		return TCPOptionsForOS("linux")
+	}
+	return nil
+}
+
+// tcpOptions returns the config's TCPOptions, nil without a config
+func tcpOptions(config *TransportConfig) *TCPOptions {
+	if config == nil {
+		return nil
+	}
+	return config.TCPOptions
+}
+
+// needsControl reports whether any option must be set before connecting
+func (o *TCPOptions) needsControl() bool {
+	return o != nil && (o.TTL > 0 || o.WindowSize > 0 || o.MSS > 0 || o.ReceiveBuffer > 0 || o.SendBuffer > 0 || o.BindDevice != "" ||
+		o.KeepAliveIdle > 0 || o.KeepAliveInterval > 0 || o.KeepAliveCount > 0)
+}
+
+// applyTo installs the socket options on a dialer for direct connections
+func (o *TCPOptions) applyTo(d *net.Dialer) {
+	if o.needsControl() {
+		d.Control = o.control
+	}
+}
+
+// keepAlive returns the keepalive settings for a connection: 30 seconds of
+// idle time and between probes unless the options say otherwise
+func (o *TCPOptions) keepAlive() net.KeepAliveConfig {
+	cfg := net.KeepAliveConfig{Enable: true, Idle: 30 * time.Second, Interval: 30 * time.Second, Count: -1}
+	if o != nil {
+		if o.KeepAliveIdle > 0 {
+			cfg.Idle = o.KeepAliveIdle
+		}
+		if o.KeepAliveInterval > 0 {
+			cfg.Interval = o.KeepAliveInterval
+		}
+		if o.KeepAliveCount > 0 {
+			cfg.Count = o.KeepAliveCount
+		}
+	}
+	return cfg
+}
+
+// applyConn sets the options that Go resets once the connection is made
+func (o *TCPOptions) applyConn(conn net.Conn) {
+	if o == nil || !o.Nagle {
+		return
+	}
+	if tcpConn, ok := conn.(*net.TCPConn); ok {
+		tcpConn.SetNoDelay(false)
+	}
+}
+
+// control is a net.Dialer Control function setting the options on the
+// socket before it connects
+func (o *TCPOptions) control(network, address string, c syscall.RawConn) error {
+	if names := o.unsupported(Capabilities()); len(names) > 0 {
+		return fmt.Errorf("%w: %s", ErrTCPOptionsUnsupported, strings.Join(names, ", "))
+	}
+	var serr error
+	err := c.Control(func(fd uintptr) {
+		serr = o.setSockopts(fd, strings.HasSuffix(network, "6"))
+	})
+	if err != nil {
+		return err
+	}
+	return serr
+}
@@ -0,0 +1,60 @@
+package transport
+
+import (
+	"fmt"
+	"net"
+	"syscall"
+)
+
+// macOS has no TCP_WINDOW_CLAMP: the SYN's window follows SO_RCVBUF
+var platformCapabilities = PlatformCapabilities{
+	TTL:            true,
+	MSS:            true,
+	ReceiveBuffer:  true,
+	SendBuffer:     true,
+	KeepAlive:      true,
+	KeepAliveCount: true,
+	BindDevice:     true,
+}
+
+func (o *TCPOptions) setSockopts(fd uintptr, ipv6 bool) error {
+	s := int(fd)
+	if o.TTL > 0 {
+		if ipv6 {
+			if err := syscall.SetsockoptInt(s, syscall.IPPROTO_IPV6, syscall.IPV6_UNICAST_HOPS, o.TTL); err != nil {
+				return fmt.Errorf("set IPV6_UNICAST_HOPS: %w", err)
+			}
+		} else if err := syscall.SetsockoptInt(s, syscall.IPPROTO_IP, syscall.IP_TTL, o.TTL); err != nil {
+			return fmt.Errorf("set IP_TTL: %w", err)
+		}
+	}
+	if o.MSS > 0 {
+		if err := syscall.SetsockoptInt(s, syscall.IPPROTO_TCP, syscall.TCP_MAXSEG, o.MSS); err != nil {
+			return fmt.Errorf("set TCP_MAXSEG: %w", err)
+		}
+	}
+	if o.ReceiveBuffer > 0 {
+		if err := syscall.SetsockoptInt(s, syscall.SOL_SOCKET, syscall.SO_RCVBUF, o.ReceiveBuffer); err != nil {
+			return fmt.Errorf("set SO_RCVBUF: %w", err)
+		}
+	}
+	if o.SendBuffer > 0 {
+		if err := syscall.SetsockoptInt(s, syscall.SOL_SOCKET, syscall.SO_SNDBUF, o.SendBuffer); err != nil {
+			return fmt.Errorf("set SO_SNDBUF: %w", err)
+		}
+	}
+	if o.BindDevice != "" {
+		iface, err := net.InterfaceByName(o.BindDevice)
+		if err != nil {
+			return fmt.Errorf("bind to device: %w", err)
+		}
+		if ipv6 {
+			if err := syscall.SetsockoptInt(s, syscall.IPPROTO_IPV6, syscall.IPV6_BOUND_IF, iface.Index); err != nil {
+				return fmt.Errorf("set IPV6_BOUND_IF: %w", err)
+			}
+		} else if err := syscall.SetsockoptInt(s, syscall.IPPROTO_IP, syscall.IP_BOUND_IF, iface.Index); err != nil {
+			return fmt.Errorf("set IP_BOUND_IF: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package transport
+
+import (
+	"fmt"
+	"syscall"
+)
+
+var platformCapabilities = PlatformCapabilities{
+	TTL:            true,
+	WindowSize:     true,
+	MSS:            true,
+	ReceiveBuffer:  true,
+	SendBuffer:     true,
+	KeepAlive:      true,
+	KeepAliveCount: true,
+	BindDevice:     true,
+	Privileged:     true,
+}
+
+func (o *TCPOptions) setSockopts(fd uintptr, ipv6 bool) error {
+	s := int(fd)
+	if o.TTL > 0 {
+		if ipv6 {
+			if err := syscall.SetsockoptInt(s, syscall.IPPROTO_IPV6, syscall.IPV6_UNICAST_HOPS, o.TTL); err != nil {
+				return fmt.Errorf("set IPV6_UNICAST_HOPS: %w", err)
+			}
+		} else if err := syscall.SetsockoptInt(s, syscall.IPPROTO_IP, syscall.IP_TTL, o.TTL); err != nil {
+			return fmt.Errorf("set IP_TTL: %w", err)
+		}
+	}
+	if o.MSS > 0 {
+		if err := syscall.SetsockoptInt(s, syscall.IPPROTO_TCP, syscall.TCP_MAXSEG, o.MSS); err != nil {
+			return fmt.Errorf("set TCP_MAXSEG: %w", err)
+		}
+	}
+	if o.ReceiveBuffer > 0 {
+		opt, name := syscall.SO_RCVBUF, "SO_RCVBUF"
+		if o.Privileged {
+			opt, name = syscall.SO_RCVBUFFORCE, "SO_RCVBUFFORCE"
+		}
+		if err := syscall.SetsockoptInt(s, syscall.SOL_SOCKET, opt, o.ReceiveBuffer); err != nil {
+			return fmt.Errorf("set %s: %w", name, err)
+		}
+	}
+	if o.SendBuffer > 0 {
+		opt, name := syscall.SO_SNDBUF, "SO_SNDBUF"
+		if o.Privileged {
+			opt, name = syscall.SO_SNDBUFFORCE, "SO_SNDBUFFORCE"
+		}
+		if err := syscall.SetsockoptInt(s, syscall.SOL_SOCKET, opt, o.SendBuffer); err != nil {
+			return fmt.Errorf("set %s: %w", name, err)
+		}
+	}
+	if o.BindDevice != "" {
+		if err := syscall.BindToDevice(s, o.BindDevice); err != nil {
+			return fmt.Errorf("set SO_BINDTODEVICE: %w", err)
+		}
+	}
+	if o.WindowSize > 0 {
+		if err := syscall.SetsockoptInt(s, syscall.IPPROTO_TCP, syscall.TCP_WINDOW_CLAMP, o.WindowSize); err != nil {
+			return fmt.Errorf("set TCP_WINDOW_CLAMP: %w", err)
+		}
+	}
+	return nil
+}
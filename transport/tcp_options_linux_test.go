@@ -0,0 +1,60 @@
+package transport
+
+import (
+	"net"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/sardanioss/httpcloak/fingerprint"
+)
+
+func TestTCPOptions(t *testing.T) {
+	ln, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	opts := &TCPOptions{TTL: 128, WindowSize: 64240, MSS: 1400, SendBuffer: 32768, Nagle: true, KeepAliveIdle: 45 * time.Second, KeepAliveInterval: 5 * time.Second, KeepAliveCount: 4}
+	dialer := &net.Dialer{}
+	opts.applyTo(dialer)
+	conn, err := dialer.Dial("tcp4", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	opts.applyConn(conn)
+	conn.(*net.TCPConn).SetKeepAliveConfig(opts.keepAlive())
+
+	raw, _ := conn.(*net.TCPConn).SyscallConn()
+	raw.Control(func(fd uintptr) {
+		for _, opt := range []struct {
+			name       string
+			level, opt int
+			want       int
+		}{
+			{"IP_TTL", syscall.IPPROTO_IP, syscall.IP_TTL, 128},
+			{"TCP_NODELAY", syscall.IPPROTO_TCP, syscall.TCP_NODELAY, 0},
+			{"SO_SNDBUF", syscall.SOL_SOCKET, syscall.SO_SNDBUF, 2 * 32768}, // The kernel doubles it
+			{"TCP_KEEPIDLE", syscall.IPPROTO_TCP, syscall.TCP_KEEPIDLE, 45},
+			{"TCP_KEEPINTVL", syscall.IPPROTO_TCP, syscall.TCP_KEEPINTVL, 5},
+			{"TCP_KEEPCNT", syscall.IPPROTO_TCP, syscall.TCP_KEEPCNT, 4},
+		} {
+			if got, err := syscall.GetsockoptInt(int(fd), opt.level, opt.opt); err != nil || got != opt.want {
+				t.Errorf("%s = %d, %v, want %d", opt.name, got, err, opt.want)
+			}
+		}
+		// The kernel adjusts the clamp slightly once connected
+		if got, _ := syscall.GetsockoptInt(int(fd), syscall.IPPROTO_TCP, syscall.TCP_WINDOW_CLAMP); got > 64240 || got < 60000 {
+			t.Errorf("TCP_WINDOW_CLAMP = %d, want about 64240", got)
+		}
+	})
+
+	if o := TCPOptionsForUserAgent(fingerprint.Get("chrome-latest-windows").UserAgent); o == nil || o.TTL != 128 {
+		t.Errorf("windows preset options = %+v", o)
+	}
+	if o := TCPOptionsForUserAgent(fingerprint.Get("chrome-latest-mac").UserAgent); o == nil || o.TTL != 64 || o.WindowSize != 65535 {
+		t.Errorf("macOS preset options = %+v", o)
+	}
+}
@@ -0,0 +1,13 @@
+//go:build !linux && !darwin && !windows
+
+package transport
+
+// Keepalive durations are set through the standard library; everything
+// else needs platform socket options
+var platformCapabilities = PlatformCapabilities{
+	KeepAlive: true,
+}
+
+func (o *TCPOptions) setSockopts(fd uintptr, ipv6 bool) error {
+	return nil
+}
@@ -0,0 +1,25 @@
+package transport
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTCPOptionsUnsupported(t *testing.T) {
+	windows := PlatformCapabilities{TTL: true, ReceiveBuffer: true, SendBuffer: true, KeepAlive: true, KeepAliveCount: true, BindDevice: true}
+	opts := TCPOptionsForOS("macos")
+	opts.MSS = 1400
+	opts.Privileged = true
+	opts.ReceiveBuffer = 1 << 20
+	if got, want := opts.unsupported(windows), []string{"WindowSize", "MSS", "Privileged"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("unsupported = %v, want %v", got, want)
+	}
+
+	// ForPlatform keeps exactly what the running platform supports
+	if names := opts.ForPlatform().unsupported(Capabilities()); len(names) != 0 {
+		t.Errorf("ForPlatform left %v", names)
+	}
+	if caps := Capabilities(); caps.OS == "" || !caps.KeepAlive {
+		t.Errorf("Capabilities() = %+v", caps)
+	}
+}
@@ -0,0 +1,65 @@
+package transport
+
+import (
+	"fmt"
+	"math/bits"
+	"net"
+	"syscall"
+)
+
+// IP_UNICAST_IF and IPV6_UNICAST_IF from ws2ipdef.h
+const (
+	ipUnicastIf   = 31
+	ipv6UnicastIf = 31
+)
+
+// Windows can't clamp the window or set the MSS of an unconnected socket
+var platformCapabilities = PlatformCapabilities{
+	TTL:            true,
+	ReceiveBuffer:  true,
+	SendBuffer:     true,
+	KeepAlive:      true,
+	KeepAliveCount: true,
+	BindDevice:     true,
+}
+
+func (o *TCPOptions) setSockopts(fd uintptr, ipv6 bool) error {
+	s := syscall.Handle(fd)
+	if o.TTL > 0 {
+		if ipv6 {
+			if err := syscall.SetsockoptInt(s, syscall.IPPROTO_IPV6, syscall.IPV6_UNICAST_HOPS, o.TTL); err != nil {
+				return fmt.Errorf("set IPV6_UNICAST_HOPS: %w", err)
+			}
+		} else if err := syscall.SetsockoptInt(s, syscall.IPPROTO_IP, syscall.IP_TTL, o.TTL); err != nil {
+			return fmt.Errorf("set IP_TTL: %w", err)
+		}
+	}
+	if o.ReceiveBuffer > 0 {
+		if err := syscall.SetsockoptInt(s, syscall.SOL_SOCKET, syscall.SO_RCVBUF, o.ReceiveBuffer); err != nil {
+			return fmt.Errorf("set SO_RCVBUF: %w", err)
+		}
+	}
+	if o.SendBuffer > 0 {
+		if err := syscall.SetsockoptInt(s, syscall.SOL_SOCKET, syscall.SO_SNDBUF, o.SendBuffer); err != nil {
+			return fmt.Errorf("set SO_SNDBUF: %w", err)
+		}
+	}
+	if o.BindDevice != "" {
+		iface, err := net.InterfaceByName(o.BindDevice)
+		if err != nil {
+			return fmt.Errorf("bind to device: %w", err)
+		}
+		if ipv6 {
+			if err := syscall.SetsockoptInt(s, syscall.IPPROTO_IPV6, ipv6UnicastIf, iface.Index); err != nil {
+				return fmt.Errorf("set IPV6_UNICAST_IF: %w", err)
+			}
+		} else {
+			// The IPv4 option takes the index in network byte order
+			index := int(int32(bits.ReverseBytes32(uint32(iface.Index))))
+			if err := syscall.SetsockoptInt(s, syscall.IPPROTO_IP, ipUnicastIf, index); err != nil {
+				return fmt.Errorf("set IP_UNICAST_IF: %w", err)
+			}
+		}
+	}
+	return nil
+}
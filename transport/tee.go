@@ -0,0 +1,58 @@
+package transport
+
+import (
+	"io"
+	"sync"
+)
+
+// TeeBody returns a body that copies everything read from body to w, e.g.
+// to archive a response while the caller streams it. done is called once:
+// with nil when body reaches EOF, with the error when a read or a write to w
+// fails, or with io.ErrUnexpectedEOF when the body is closed before its end.
+// A failing w stops the copy, never the caller's reads.
+func TeeBody(body io.ReadCloser, w io.Writer, done func(err error)) io.ReadCloser {
+	return &bodyTee{body: body, w: w, done: done}
+}
+
+type bodyTee struct {
+	body io.ReadCloser
+	w    io.Writer
+	done func(err error)
+	once sync.Once
+}
+
+func (t *bodyTee) Read(p []byte) (int, error) {
+	n, err := t.body.Read(p)
+	if n > 0 && t.w != nil {
+		if _, werr := t.w.Write(p[:n]); werr != nil {
+			t.w = nil
+			t.finish(werr)
+		}
+	}
+	if err == io.EOF {
+		t.finish(nil)
+	} else if err != nil {
+		t.finish(err)
+	}
+	return n, err
+}
+
+func (t *bodyTee) Close() error {
+	t.finish(io.ErrUnexpectedEOF)
+	return t.body.Close()
+}
+
+func (t *bodyTee) finish(err error) {
+	t.once.Do(func() {
+		if t.done != nil {
+			t.done(err)
+		}
+	})
+}
+
+// Tee copies the body to w as it is read; see TeeBody for when done is called
+func (r *StreamResponse) Tee(w io.Writer, done func(err error)) {
+	tee := TeeBody(io.NopCloser(r.reader), w, done)
+	r.reader = tee
+	r.tee = tee
+}
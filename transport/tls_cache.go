@@ -308,7 +308,7 @@ func (c *PersistableSessionCache) getFromBackend(sessionKey string) (*tls.Client
 	// Promote to local cache
 	c.sessions[sessionKey] = &cachedSession{
 		state:     clientState,
-		createdAt: sessionState.CreatedAt,
+		createdAt: Reanchor(sessionState.CreatedAt),
 	}
 	c.accessOrder = append(c.accessOrder, sessionKey)
 
@@ -428,6 +428,18 @@ func (c *PersistableSessionCache) putToBackend(sessionKey string, cs *tls.Client
 	}
 }
 
+// Age returns how long ago the session for sessionKey (the server name) was
+// stored, and whether one is cached locally.
+func (c *PersistableSessionCache) Age(sessionKey string) (time.Duration, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	cached, ok := c.sessions[sessionKey]
+	if !ok {
+		return 0, false
+	}
+	return time.Since(cached.createdAt), true
+}
+
 // Export serializes all TLS sessions for persistence
 // Returns a map of session keys to serialized TLS session state
 func (c *PersistableSessionCache) Export() (map[string]TLSSessionState, error) {
@@ -505,7 +517,7 @@ func (c *PersistableSessionCache) Import(sessions map[string]TLSSessionState) er
 
 		c.sessions[key] = &cachedSession{
 			state:     clientState,
-			createdAt: serialized.CreatedAt,
+			createdAt: Reanchor(serialized.CreatedAt),
 		}
 		c.accessOrder = append(c.accessOrder, key)
 	}
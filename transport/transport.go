@@ -19,6 +19,7 @@ import (
 	"github.com/sardanioss/httpcloak/dns"
 	"github.com/sardanioss/httpcloak/fingerprint"
 	"github.com/sardanioss/httpcloak/protocol"
+	"github.com/sardanioss/httpcloak/proxy"
 )
 
 // Protocol represents the HTTP protocol version
@@ -123,6 +124,10 @@ type TransportConfig struct {
 	// ECHConfigDomain is a domain to fetch ECH config from instead of target
 	ECHConfigDomain string
 
+	// DisableECHHosts turns ECH off for specific hosts; they still send
+	// the preset's GREASE ECH extension
+	DisableECHHosts map[string]bool
+
 	// TLSOnly mode: use TLS fingerprint but skip preset HTTP headers
 	// User sets all headers manually
 	TLSOnly bool
@@ -130,6 +135,11 @@ type TransportConfig struct {
 	// QuicIdleTimeout is the idle timeout for QUIC connections (default: 30s)
 	QuicIdleTimeout time.Duration
 
+	// QuicKeepAlive is the period of QUIC keepalive PINGs. Zero means half
+	// the idle timeout (none in LowFootprint mode), negative disables them.
+	// Periods over half the idle timeout are capped to it.
+	QuicKeepAlive time.Duration
+
 	// LocalAddr is the local IP address to bind outgoing connections to.
 	// Used for IPv6 rotation with IP_FREEBIND on Linux.
 	LocalAddr string
@@ -164,12 +174,144 @@ type TransportConfig struct {
 	// algorithms, ALPN). If nil, sensible Chrome-like defaults are used.
 	CustomJA3Extras *fingerprint.JA3Extras
 
+	// CustomClientHello is a captured raw ClientHello (bytes or hex) to replay
+	// instead of the preset's TLS fingerprint. Takes precedence over CustomJA3.
+	// Not applied to H3.
+	CustomClientHello []byte
+
+	// ExtensionControl tunes GREASE and TLS extension order (shuffle mode,
+	// pinned positions). Nil keeps one shuffled order per session.
+	ExtensionControl *fingerprint.ExtensionControl
+
+	// PostQuantum, when set, adds or removes the X25519MLKEM768 key share
+	// regardless of the preset. PostQuantumHosts overrides it per host for
+	// TCP connections (HTTP/3 uses the session-wide setting).
+	PostQuantum      *bool
+	PostQuantumHosts map[string]bool
+
+	// H2Ping schedules HTTP/2 keepalive PINGs. Nil uses Go's read-idle health check.
+	H2Ping *H2PingConfig
+
+	// QUIC tunes HTTP/3 connections (per-host limit, handshake timeout, early data)
+	QUIC *QUICOptions
+
+	// ProxyFallback retries requests through backup proxies, or directly,
+	// when the proxy fails. Nil keeps requests on the configured proxy.
+	ProxyFallback *ProxyFallback
+
+	// ProxyPool rotates requests across a pool of proxies when the transport
+	// has no proxy of its own, reporting failures and block pages to it
+	ProxyPool *proxy.Pool
+
+	// ProxyTLS configures the TLS connection to https:// proxies, including
+	// whether it uses the browser fingerprint. Nil uses Go's fingerprint
+	// and verifies the proxy's certificate against the system roots.
+	ProxyTLS *ProxyTLSConfig
+
+	// ProxyNegotiate answers an HTTP proxy's Negotiate challenges with
+	// Kerberos tokens. Without it, NTLM and Negotiate challenges are
+	// answered with NTLM using the proxy URL's credentials.
+	ProxyNegotiate proxy.NegotiateFunc
+
+	// ClientCertificates are presented to servers that request one (mTLS)
+	ClientCertificates *ClientCertificates
+
+	// ProxyFromEnvironment routes requests through the proxies named by
+	// HTTP_PROXY, HTTPS_PROXY and ALL_PROXY, except for hosts in NO_PROXY.
+	// The variables are read when the transport is created. An explicitly
+	// configured proxy takes precedence.
+	ProxyFromEnvironment bool
+
+	// ProxySelector picks the proxies for each request, such as a PAC file
+	// or the system's settings, trying them in order when one fails at the
+	// connection level. An explicitly configured proxy or ProxyFromEnvironment
+	// takes precedence.
+	ProxySelector proxy.Selector
+
+	// CertPinner verifies server certificates on every TLS and QUIC handshake
+	CertPinner CertificatePinner
+
+	// RevocationCheck verifies stapled OCSP responses and optionally checks
+	// OCSP/CRL online. Results are reported in Response.TLS.
+	RevocationCheck *RevocationCheck
+
+	// PoolLimits bounds the connection pools: idle HTTP/1.1 connections per
+	// host, connections open at once, connection age and the idle sweep
+	// interval. Nil keeps the defaults.
+	PoolLimits *PoolLimits
+
+	// FirstByteTimeout aborts a request whose response headers don't arrive
+	// this long after it was sent, body included, with a timeout error
+	// wrapping ErrFirstByteTimeout. The session retries it like other
+	// network errors. It catches servers that accept a request and stall,
+	// without shortening the overall timeout a long download needs. 0
+	// disables it.
+	FirstByteTimeout time.Duration
+
+	// StallTimeout aborts a response body read that gets no bytes for this
+	// long with a timeout error wrapping ErrStalled, which the session
+	// retries like other network errors. It catches servers that trickle a
+	// body to hold the connection, and unlike the overall timeout doesn't
+	// limit how long a steadily arriving download takes. 0 disables it.
+	StallTimeout time.Duration
+
+	// LowFootprint closes idle connections sooner, for processes holding many
+	// sessions: HTTP/1.1 and HTTP/2 connections after 15s idle instead of 90s,
+	// and QUIC connections after 10s (unless QuicIdleTimeout is set) with
+	// keepalives off. The next request to the host pays a new handshake.
+	LowFootprint bool
+
 	// CustomH2Settings overrides the preset's HTTP/2 settings (from Akamai fingerprint).
 	CustomH2Settings *fingerprint.HTTP2Settings
 
+	// CustomH2Spec overrides the preset's full HTTP/2 fingerprint (SETTINGS,
+	// WINDOW_UPDATE, HEADERS priority, pseudo-header order).
+	CustomH2Spec *fingerprint.H2Spec
+
+	// CustomH3Settings overrides the preset's HTTP/3 SETTINGS frame.
+	CustomH3Settings *fingerprint.H3Settings
+
+	// H2PriorityScheme overrides the preset's choice between HTTP/2 priority
+	// framing and the Priority header
+	H2PriorityScheme fingerprint.H2PriorityScheme
+
 	// CustomPseudoOrder overrides the pseudo-header order (from Akamai fingerprint).
 	// Values: [":method", ":authority", ":scheme", ":path"]
 	CustomPseudoOrder []string
+
+	// HostPolicy restricts which hosts may be contacted (SSRF guard).
+	// Checked before dialing for every request, including redirects.
+	HostPolicy *HostPolicy
+
+	// SSRFProtection blocks private, loopback, link-local and metadata addresses
+	// after DNS resolution. See Transport.SetSSRFProtection.
+	SSRFProtection bool
+
+	// TargetJA4 is the JA4 fingerprint TCP connections must produce. The first
+	// full (non-resumed) handshake of each HTTP/1.1 and HTTP/2 transport is
+	// checked, and a mismatch fails with *FingerprintMismatchError.
+	// HTTP/3 handshakes are not checked.
+	TargetJA4 string
+
+	// TargetJA4H is the JA4H fingerprint requests must produce. The first
+	// request is checked before it is sent.
+	TargetJA4H string
+
+	// StrictConformance reports servers' protocol violations instead of
+	// tolerating them silently: violations that still leave a usable
+	// response are listed in Response.Violations, the rest fail with
+	// *ProtocolViolationError. HTTP/1 responses are parsed from the raw
+	// head to see what net/http normalizes away.
+	StrictConformance bool
+
+	// HeaderLimits bounds response header blocks per protocol (size, field
+	// count, line length). Responses over a limit fail with
+	// *HeaderLimitError. Unset limits default to DefaultHeaderLimits.
+	HeaderLimits *ResponseHeaderLimits
+
+	// TCPOptions tunes TTL, window and MSS of direct TCP connections to
+	// match the preset's OS for passive fingerprinting (see TCPOptions)
+	TCPOptions *TCPOptions
 }
 
 // Request represents an HTTP request
@@ -187,6 +329,31 @@ type Request struct {
 	// This is useful for LocalProxy where each request can have different TLS-only settings
 	// via the X-HTTPCloak-TlsOnly header.
 	TLSOnly *bool
+
+	// PseudoHeaderOrder overrides the order of :method, :authority, :scheme
+	// and :path for this request on HTTP/2 and HTTP/3. Nil uses the
+	// transport's order.
+	PseudoHeaderOrder []string
+
+	// HTTP10 sends the request as HTTP/1.0 with Connection: close. It always
+	// goes over HTTP/1, and a body of unknown length is buffered instead of
+	// chunked.
+	HTTP10 bool
+
+	// NoRetry sends the request once: the session does not retry it and
+	// ProxyFallback does not resend it through another path. NoRedirect
+	// makes the session return redirect responses instead of following them.
+	NoRetry    bool
+	NoRedirect bool
+
+	// FirstByteTimeout overrides TransportConfig.FirstByteTimeout for this
+	// request
+	FirstByteTimeout time.Duration
+
+	// MaxBodySize fails the request with ErrBodyTooLarge once its response
+	// body passes this many bytes after decompression, 0 for no limit.
+	// Streaming requests ignore it.
+	MaxBodySize int64
 }
 
 // RedirectInfo contains information about a redirect response
@@ -196,6 +363,17 @@ type RedirectInfo struct {
 	Headers    map[string][]string // Multi-value headers
 }
 
+// RetryAttempt describes one round trip of a session request
+type RetryAttempt struct {
+	URL        string
+	StatusCode int           // 0 when the attempt failed
+	Err        error         // Why the attempt failed, nil when it got a response
+	Protocol   string        // "h1", "h2" or "h3", empty when unknown
+	Proxy      string        // Proxy URL without credentials, or "direct"
+	Latency    time.Duration // Time from sending to the response headers or error
+	Backoff    time.Duration // Wait before the next attempt, 0 for none
+}
+
 // Response represents an HTTP response
 type Response struct {
 	StatusCode int
@@ -206,6 +384,43 @@ type Response struct {
 	Protocol   string // "h1", "h2", or "h3"
 	History    []*RedirectInfo
 
+	// QUICVersion is the QUIC version ("v1", "v2") negotiated by the
+	// connection that served the request, empty for TCP protocols
+	QUICVersion string
+
+	// Via is the path that served the request when a ProxyFallback,
+	// ProxySelector or ProxyPool is configured: the proxy URL without
+	// credentials, or "direct"
+	Via string
+
+	// BytesSent and BytesReceived are the HTTP message bytes exchanged,
+	// bodies counted before decompression (see HostStats for what's left
+	// out). Session requests sum them across retries and redirects.
+	BytesSent     int64
+	BytesReceived int64
+
+	// TLS reports the certificate revocation check for the host when
+	// TransportConfig.RevocationCheck is set, nil otherwise
+	TLS *TLSInfo
+
+	// SentFingerprints are the JA4H of the request and the JA4/JA4X of the
+	// TLS handshake it went over
+	SentFingerprints SentFingerprints
+
+	// Attempts is the number of round trips spent on the request, across
+	// retries and redirects. Redirects is the number of redirects followed.
+	// Both are filled in by session-level requests.
+	Attempts  int
+	Redirects int
+
+	// RetryHistory lists every round trip of a session request in order,
+	// retries and redirect hops included
+	RetryHistory []RetryAttempt
+
+	// Violations are the protocol violations of the response when
+	// TransportConfig.StrictConformance is set
+	Violations []ProtocolViolation
+
 	// bodyBytes caches the body after reading for multiple access
 	bodyBytes []byte
 	bodyRead  bool
@@ -265,7 +480,17 @@ func (r *Response) Text() (string, error) {
 }
 
 // Transport is a unified HTTP transport supporting HTTP/1.1, HTTP/2, and HTTP/3
+//
+// Reconfiguration is copy-on-write: setters change the fields under mu and
+// publish a copy of the transport, and each request runs on the copy current
+// when it started. SetProxy/SetPreset don't wait for in-flight requests; the
+// transports they replace are closed once those requests finish.
 type Transport struct {
+	*transportShared
+
+	// Requests running on this snapshot
+	gen *generation
+
 	h1Transport *HTTP1Transport
 	h2Transport *HTTP2Transport
 	h3Transport *HTTP3Transport
@@ -276,9 +501,8 @@ type Transport struct {
 	proxy       *ProxyConfig
 	config      *TransportConfig
 
-	// Track protocol support per host
-	protocolSupport   map[string]Protocol // Best known protocol per host
-	protocolSupportMu sync.RWMutex
+	// Enforces PoolLimits.MaxConns across the protocol transports
+	limiter *connLimiter
 
 	// Configuration
 	insecureSkipVerify bool
@@ -287,15 +511,14 @@ type Transport struct {
 	// instead of silently bypassing the proxy
 	h3ProxyError error
 
-	// Custom header order (nil = use preset's order)
-	customHeaderOrder   []string
-	customHeaderOrderMu sync.RWMutex
-
 	// Custom pseudo-header order (nil = use preset's browser-type heuristic)
 	customPseudoOrder []string
 
 	// TLS-only mode: skip preset HTTP headers, use TLS fingerprint only
 	tlsOnly bool
+
+	// Proxy selection from HTTP_PROXY/HTTPS_PROXY/NO_PROXY (config.ProxyFromEnvironment)
+	envProxy func(*url.URL) (*url.URL, error)
 }
 
 // NewTransport creates a new unified transport
@@ -322,6 +545,15 @@ func NewTransportWithConfig(presetName string, proxy *ProxyConfig, config *Trans
 		if config.CustomH2Settings != nil {
 			preset.HTTP2Settings = *config.CustomH2Settings
 		}
+		if config.CustomH2Spec != nil {
+			preset.H2Spec = config.CustomH2Spec
+		}
+		if config.CustomH3Settings != nil {
+			preset.H3Settings = config.CustomH3Settings
+		}
+		if config.H2PriorityScheme != "" {
+			preset.SetH2PriorityScheme(config.H2PriorityScheme)
+		}
 	}
 
 	// Capture custom pseudo-header order from config
@@ -331,29 +563,36 @@ func NewTransportWithConfig(presetName string, proxy *ProxyConfig, config *Trans
 	}
 
 	t := &Transport{
+		transportShared: &transportShared{
+			protocolSupport: make(map[string]Protocol),
+		},
 		dnsCache:          dnsCache,
 		preset:            preset,
 		timeout:           30 * time.Second,
 		protocol:          ProtocolAuto,
-		protocolSupport:   make(map[string]Protocol),
 		proxy:             proxy,
 		config:            config,
 		customPseudoOrder: customPseudoOrder,
 		tlsOnly:           tlsOnly,
 	}
+	if config != nil {
+		t.hostPolicy = config.HostPolicy
+		if config.SSRFProtection {
+			t.SetSSRFProtection(true)
+		}
+		if config.ProxyFromEnvironment {
+			t.envProxy = environmentProxyFunc()
+		}
+	}
 
-	// Determine effective TCP and UDP proxy URLs
-	// TCPProxy/UDPProxy take precedence over URL for split proxy configuration
-	var tcpProxyURL, udpProxyURL string
+	// Determine effective TCP proxy URL
+	// TCPProxy takes precedence over URL for split proxy configuration
+	var tcpProxyURL string
 	if proxy != nil {
 		tcpProxyURL = proxy.TCPProxy
 		if tcpProxyURL == "" {
 			tcpProxyURL = proxy.URL
 		}
-		udpProxyURL = proxy.UDPProxy
-		if udpProxyURL == "" {
-			udpProxyURL = proxy.URL
-		}
 	}
 
 	// Create TCP proxy config for H1/H2 transports
@@ -367,52 +606,30 @@ func NewTransportWithConfig(presetName string, proxy *ProxyConfig, config *Trans
 	t.h2Transport = NewHTTP2TransportWithConfig(preset, dnsCache, tcpProxy, config)
 
 	// Create HTTP/3 transport - with UDP proxy support if applicable
-	if udpProxyURL != "" {
-		udpProxy := &ProxyConfig{URL: udpProxyURL}
-		if isSOCKS5Proxy(udpProxyURL) {
-			// SOCKS5 supports UDP relay for HTTP/3
-			h3Transport, err := NewHTTP3TransportWithConfig(preset, dnsCache, udpProxy, config)
-			if err != nil {
-				// Store the error - don't silently fallback to direct connection!
-				// H3 requests will fail with explicit error instead of bypassing proxy
-				t.h3ProxyError = fmt.Errorf("SOCKS5 UDP proxy initialization failed: %w", err)
-				// Still create a basic H3 transport for non-proxied use cases
-				// but h3ProxyError will prevent it from being used when proxy is expected
-				t.h3Transport, _ = NewHTTP3TransportWithTransportConfig(preset, dnsCache, config)
-			} else {
-				t.h3Transport = h3Transport
-			}
-		} else if isMASQUEProxy(udpProxyURL) {
-			// MASQUE supports HTTP/3 through HTTP/3 proxy
-			h3Transport, err := NewHTTP3TransportWithMASQUE(preset, dnsCache, udpProxy, config)
-			if err != nil {
-				// Store the error - don't silently fallback to direct connection!
-				t.h3ProxyError = fmt.Errorf("MASQUE proxy initialization failed: %w", err)
-				t.h3Transport, _ = NewHTTP3TransportWithTransportConfig(preset, dnsCache, config)
-			} else {
-				t.h3Transport = h3Transport
-			}
-		} else {
-			// HTTP proxy - HTTP/3 doesn't work through HTTP proxies
-			// Store error so H3 requests fail explicitly
-			t.h3ProxyError = fmt.Errorf("HTTP proxy does not support HTTP/3 (QUIC requires UDP)")
-			t.h3Transport, _ = NewHTTP3TransportWithTransportConfig(preset, dnsCache, config)
-		}
-	} else {
-		// No proxy - HTTP/3 works directly
-		t.h3Transport, _ = NewHTTP3TransportWithTransportConfig(preset, dnsCache, config)
-	}
+	t.h3Transport, t.h3ProxyError = newHTTP3ForProxy(preset, dnsCache, proxy, config)
+	t.attachConnLimiter()
+	t.attachConnStats()
+	t.publish()
 
 	return t
 }
 
 // SetProtocol sets the preferred protocol
 func (t *Transport) SetProtocol(p Protocol) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
 	t.protocol = p
+	t.publish()
 }
 
-// SetInsecureSkipVerify sets whether to skip TLS certificate verification
+// SetInsecureSkipVerify sets whether to skip TLS certificate verification.
+// It changes the protocol transports in place, so it waits for in-flight
+// requests; set it before sending any.
 func (t *Transport) SetInsecureSkipVerify(skip bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.drain()
+	defer t.publish()
 	t.insecureSkipVerify = skip
 	t.h1Transport.SetInsecureSkipVerify(skip)
 	if t.h2Transport != nil {
@@ -423,23 +640,33 @@ func (t *Transport) SetInsecureSkipVerify(skip bool) {
 	}
 }
 
-// SetDisableECH disables ECH lookup for faster first request
+// SetDisableECH disables ECH lookup for faster first request. Like
+// SetInsecureSkipVerify, it waits for in-flight requests.
 func (t *Transport) SetDisableECH(disable bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.drain()
+	if t.h2Transport != nil {
+		t.h2Transport.SetDisableECH(disable)
+	}
 	if t.h3Transport != nil {
 		t.h3Transport.SetDisableECH(disable)
 	}
 }
 
 // SetProxy sets or updates the proxy configuration
-// Note: This recreates the underlying transports
+// Note: This recreates the underlying transports. Requests started afterwards
+// use the new proxy; in-flight requests finish on the old transports, which
+// are closed once they are done.
 func (t *Transport) SetProxy(proxy *ProxyConfig) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
 	t.proxy = proxy
 	t.h3ProxyError = nil // Clear stale error from previous proxy config
 
-	// Close existing transports
-	t.h1Transport.Close()
-	t.h2Transport.Close()
-	t.h3Transport.Close()
+	// Close existing transports once their requests finish
+	defer t.publish(append(t.protocolClosers(), t.detachProxyTransports())...)
 
 	// Recreate HTTP/1.1 and HTTP/2 with new proxy config, preserving transport config
 	// (custom JA3, H2 settings, speculative TLS, etc.)
@@ -451,43 +678,10 @@ func (t *Transport) SetProxy(proxy *ProxyConfig) {
 	t.h2Transport = NewHTTP2TransportWithConfig(t.preset, t.dnsCache, tcpProxy, t.config)
 
 	// Recreate HTTP/3 - with proxy support if applicable
-	// Check both URL (unified proxy) and UDPProxy (split proxy config)
-	udpProxyURL := ""
-	if proxy != nil {
-		if proxy.UDPProxy != "" {
-			udpProxyURL = proxy.UDPProxy
-		} else if proxy.URL != "" {
-			udpProxyURL = proxy.URL
-		}
-	}
+	t.h3Transport, t.h3ProxyError = newHTTP3ForProxy(t.preset, t.dnsCache, proxy, t.config)
 
-	if udpProxyURL != "" {
-		if isSOCKS5Proxy(udpProxyURL) {
-			h3Proxy := &ProxyConfig{URL: udpProxyURL}
-			h3Transport, err := NewHTTP3TransportWithProxy(t.preset, t.dnsCache, h3Proxy)
-			if err != nil {
-				t.h3ProxyError = fmt.Errorf("SOCKS5 UDP proxy initialization failed: %w", err)
-				t.h3Transport, _ = NewHTTP3Transport(t.preset, t.dnsCache)
-			} else {
-				t.h3Transport = h3Transport
-			}
-		} else if isMASQUEProxy(udpProxyURL) {
-			h3Proxy := &ProxyConfig{URL: udpProxyURL}
-			h3Transport, err := NewHTTP3TransportWithMASQUE(t.preset, t.dnsCache, h3Proxy, nil)
-			if err != nil {
-				t.h3ProxyError = fmt.Errorf("MASQUE proxy initialization failed: %w", err)
-				t.h3Transport, _ = NewHTTP3Transport(t.preset, t.dnsCache)
-			} else {
-				t.h3Transport = h3Transport
-			}
-		} else {
-			// HTTP proxy does not support HTTP/3 (QUIC requires UDP)
-			t.h3ProxyError = fmt.Errorf("HTTP proxy does not support HTTP/3 (QUIC requires UDP)")
-			t.h3Transport, _ = NewHTTP3Transport(t.preset, t.dnsCache)
-		}
-	} else {
-		t.h3Transport, _ = NewHTTP3Transport(t.preset, t.dnsCache)
-	}
+	t.attachConnLimiter()
+	t.attachConnStats()
 
 	// Re-apply insecureSkipVerify to recreated transports
 	if t.insecureSkipVerify {
@@ -499,19 +693,32 @@ func (t *Transport) SetProxy(proxy *ProxyConfig) {
 	}
 }
 
-// SetPreset changes the fingerprint preset
+// SetPreset changes the fingerprint preset.
+// Like SetProxy, it leaves in-flight requests on the old transports. The DNS
+// cache and learned protocol support are kept; hosts learned as HTTP/3 are
+// forgotten if the new preset doesn't support it.
 func (t *Transport) SetPreset(presetName string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
 	t.preset = fingerprint.Get(presetName)
 
 	// Re-apply custom H2 settings to the fresh preset (if any)
 	if t.config != nil && t.config.CustomH2Settings != nil {
 		t.preset.HTTP2Settings = *t.config.CustomH2Settings
 	}
+	if t.config != nil && t.config.CustomH2Spec != nil {
+		t.preset.H2Spec = t.config.CustomH2Spec
+	}
+	if t.config != nil && t.config.CustomH3Settings != nil {
+		t.preset.H3Settings = t.config.CustomH3Settings
+	}
+	if t.config != nil && t.config.H2PriorityScheme != "" {
+		t.preset.SetH2PriorityScheme(t.config.H2PriorityScheme)
+	}
 
-	// Close all transports
-	t.h1Transport.Close()
-	t.h2Transport.Close()
-	t.h3Transport.Close()
+	// Close all transports once their requests finish
+	defer t.publish(t.protocolClosers()...)
 
 	// Recreate HTTP/1.1 and HTTP/2 with new preset, preserving transport config
 	var tcpProxy *ProxyConfig
@@ -526,27 +733,10 @@ func (t *Transport) SetPreset(presetName string) {
 	t.h2Transport = NewHTTP2TransportWithConfig(t.preset, t.dnsCache, tcpProxy, t.config)
 
 	// Recreate HTTP/3 - with proxy support if applicable
-	if t.proxy != nil && t.proxy.URL != "" {
-		if isSOCKS5Proxy(t.proxy.URL) {
-			h3Transport, err := NewHTTP3TransportWithProxy(t.preset, t.dnsCache, t.proxy)
-			if err != nil {
-				t.h3Transport, _ = NewHTTP3Transport(t.preset, t.dnsCache)
-			} else {
-				t.h3Transport = h3Transport
-			}
-		} else if isMASQUEProxy(t.proxy.URL) {
-			h3Transport, err := NewHTTP3TransportWithMASQUE(t.preset, t.dnsCache, t.proxy, nil)
-			if err != nil {
-				t.h3Transport, _ = NewHTTP3Transport(t.preset, t.dnsCache)
-			} else {
-				t.h3Transport = h3Transport
-			}
-		} else {
-			t.h3Transport, _ = NewHTTP3Transport(t.preset, t.dnsCache)
-		}
-	} else {
-		t.h3Transport, _ = NewHTTP3Transport(t.preset, t.dnsCache)
-	}
+	t.h3Transport, t.h3ProxyError = newHTTP3ForProxy(t.preset, t.dnsCache, t.proxy, t.config)
+
+	t.attachConnLimiter()
+	t.attachConnStats()
 
 	// Re-apply insecureSkipVerify to recreated transports
 	if t.insecureSkipVerify {
@@ -556,6 +746,56 @@ func (t *Transport) SetPreset(presetName string) {
 			t.h3Transport.SetInsecureSkipVerify(true)
 		}
 	}
+
+	// Cached HTTP/3 support is useless to a preset that can't speak it
+	if !t.preset.SupportHTTP3 {
+		t.protocolSupportMu.Lock()
+		for host, p := range t.protocolSupport {
+			if p == ProtocolHTTP3 {
+				delete(t.protocolSupport, host)
+			}
+		}
+		t.protocolSupportMu.Unlock()
+	}
+}
+
+// newHTTP3ForProxy creates the HTTP/3 transport for proxy's UDP proxy
+// (UDPProxy, else URL) with the transport config. SOCKS5 and MASQUE proxies
+// carry QUIC; for any other proxy, or when the proxied transport can't be
+// created, it returns a direct transport along with the error HTTP/3
+// requests then fail with, so they don't silently bypass the proxy.
+func newHTTP3ForProxy(preset *fingerprint.Preset, dnsCache *dns.Cache, proxy *ProxyConfig, config *TransportConfig) (*HTTP3Transport, error) {
+	var udpProxyURL string
+	if proxy != nil {
+		udpProxyURL = proxy.UDPProxy
+		if udpProxyURL == "" {
+			udpProxyURL = proxy.URL
+		}
+	}
+	var proxyErr error
+	switch {
+	case udpProxyURL == "":
+		h3, _ := NewHTTP3TransportWithTransportConfig(preset, dnsCache, config)
+		return h3, nil
+	case isSOCKS5Proxy(udpProxyURL):
+		// SOCKS5 supports UDP relay for HTTP/3
+		h3, err := NewHTTP3TransportWithConfig(preset, dnsCache, &ProxyConfig{URL: udpProxyURL}, config)
+		if err == nil {
+			return h3, nil
+		}
+		proxyErr = fmt.Errorf("SOCKS5 UDP proxy initialization failed: %w", err)
+	case isMASQUEProxy(udpProxyURL):
+		// MASQUE supports HTTP/3 through HTTP/3 proxy
+		h3, err := NewHTTP3TransportWithMASQUE(preset, dnsCache, &ProxyConfig{URL: udpProxyURL}, config)
+		if err == nil {
+			return h3, nil
+		}
+		proxyErr = fmt.Errorf("MASQUE proxy initialization failed: %w", err)
+	default:
+		proxyErr = fmt.Errorf("HTTP proxy does not support HTTP/3 (QUIC requires UDP)")
+	}
+	h3, _ := NewHTTP3TransportWithTransportConfig(preset, dnsCache, config)
+	return h3, proxyErr
 }
 
 // isSOCKS5Proxy checks if the proxy URL is a SOCKS5 proxy
@@ -604,6 +844,28 @@ func IsMASQUEProxy(proxyURL string) bool {
 	return false
 }
 
+// checkH3Proxy reports why HTTP/3 can't go through the proxy: an HTTP proxy,
+// or a SOCKS5 proxy without UDP ASSOCIATE. The HTTP/3 transport is direct in
+// that case, so using it would bypass the proxy. With split proxies the UDP
+// proxy decides, so an HTTP proxy for TCP doesn't rule out HTTP/3 over a
+// SOCKS5 UDP proxy.
+func (t *Transport) checkH3Proxy() error {
+	if t.h3ProxyError != nil {
+		return t.h3ProxyError
+	}
+	proxyURL := t.proxy.UDPProxy
+	if proxyURL == "" {
+		proxyURL = t.proxy.URL
+	}
+	if proxyURL == "" {
+		proxyURL = t.proxy.TCPProxy
+	}
+	if !SupportsQUIC(proxyURL) {
+		return fmt.Errorf("HTTP/3 requires a SOCKS5 or MASQUE proxy (current proxy does not support UDP)")
+	}
+	return nil
+}
+
 // SupportsQUIC checks if the proxy URL supports QUIC/HTTP3 tunneling.
 // Returns true for SOCKS5 (UDP relay) or MASQUE (CONNECT-UDP) proxies.
 func SupportsQUIC(proxyURL string) bool {
@@ -612,11 +874,33 @@ func SupportsQUIC(proxyURL string) bool {
 
 // SetTimeout sets the request timeout
 func (t *Transport) SetTimeout(timeout time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
 	t.timeout = timeout
+	t.publish()
 }
 
-// SetConnectTo sets a host mapping for domain fronting
+// ConnectTo returns the host mappings set with SetConnectTo or TransportConfig.ConnectTo
+func (t *Transport) ConnectTo() map[string]string {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	result := make(map[string]string)
+	if t.config != nil {
+		for requestHost, connectHost := range t.config.ConnectTo {
+			result[requestHost] = connectHost
+		}
+	}
+	return result
+}
+
+// SetConnectTo sets a host mapping for domain fronting. Like
+// SetInsecureSkipVerify, it waits for in-flight requests.
 func (t *Transport) SetConnectTo(requestHost, connectHost string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.drain()
+	defer t.publish()
+
 	if t.config == nil {
 		t.config = &TransportConfig{}
 	}
@@ -637,8 +921,14 @@ func (t *Transport) SetConnectTo(requestHost, connectHost string) {
 	}
 }
 
-// SetECHConfig sets a custom ECH configuration
+// SetECHConfig sets a custom ECH configuration. Like SetInsecureSkipVerify,
+// it waits for in-flight requests.
 func (t *Transport) SetECHConfig(echConfig []byte) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.drain()
+	defer t.publish()
+
 	if t.config == nil {
 		t.config = &TransportConfig{}
 	}
@@ -654,8 +944,14 @@ func (t *Transport) SetECHConfig(echConfig []byte) {
 	}
 }
 
-// SetECHConfigDomain sets a domain to fetch ECH config from
+// SetECHConfigDomain sets a domain to fetch ECH config from. Like
+// SetInsecureSkipVerify, it waits for in-flight requests.
 func (t *Transport) SetECHConfigDomain(domain string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.drain()
+	defer t.publish()
+
 	if t.config == nil {
 		t.config = &TransportConfig{}
 	}
@@ -703,6 +999,8 @@ func (t *Transport) GetHeaderOrder() []string {
 	}
 
 	// Return preset's order
+	t.mu.RLock()
+	defer t.mu.RUnlock()
 	if len(t.preset.HeaderOrder) > 0 {
 		result := make([]string, len(t.preset.HeaderOrder))
 		for i, hp := range t.preset.HeaderOrder {
@@ -726,6 +1024,26 @@ func (t *Transport) getCustomPseudoOrder() []string {
 	return t.customPseudoOrder
 }
 
+// checkPseudoOrder rejects invalid per-request pseudo-header orders
+func checkPseudoOrder(req *Request) error {
+	if len(req.PseudoHeaderOrder) == 0 {
+		return nil
+	}
+	if err := fingerprint.ValidatePseudoHeaderOrder(req.PseudoHeaderOrder); err != nil {
+		return fmt.Errorf("request pseudo-header order: %w", err)
+	}
+	return nil
+}
+
+// pseudoOrder returns the pseudo-header order for req: its own, else the
+// custom order
+func (t *Transport) pseudoOrder(req *Request) []string {
+	if len(req.PseudoHeaderOrder) > 0 {
+		return req.PseudoHeaderOrder
+	}
+	return t.customPseudoOrder
+}
+
 // GetConnectHost returns the connection host for a request host.
 // If there's a ConnectTo mapping, returns the mapped host.
 // Otherwise returns the original host.
@@ -764,8 +1082,82 @@ func (c *TransportConfig) GetECHConfig(ctx context.Context, targetHost string) [
 	return echConfig
 }
 
-// Do executes an HTTP request
+// Do executes an HTTP request. A panic while executing it, in a custom
+// decoder for instance, is returned as a *PanicError.
 func (t *Transport) Do(ctx context.Context, req *Request) (*Response, error) {
+	s := t.acquire()
+	defer s.release()
+	return s.doRequest(ctx, req)
+}
+
+// doRequest runs Do on a snapshot
+func (t *Transport) doRequest(ctx context.Context, req *Request) (resp *Response, err error) {
+	defer RecoverPanic(&resp, &err)
+
+	if err := t.checkHostPolicy(ctx, req.URL); err != nil {
+		return nil, err
+	}
+	if err := checkPseudoOrder(req); err != nil {
+		return nil, err
+	}
+
+	do := t.do
+	if et := t.environmentTransport(req.URL); et != nil {
+		do = et.do
+	} else if t.proxySelector() != nil {
+		do = t.doWithProxySelector
+	} else if t.proxyPool() != nil {
+		do = t.doWithProxyPool
+	}
+	ctx = t.withFirstByteTimeout(ctx, req)
+	var violations *violationLog
+	if t.strictConformance() {
+		ctx, violations = withViolationLog(ctx)
+	}
+	fallback := t.config != nil && t.config.ProxyFallback != nil && t.primaryProxyURL() != ""
+	// A blacklisted primary is skipped for the fallback paths
+	if fallback && !req.NoRetry && req.BodyReader == nil {
+		err = t.primaryBlacklisted()
+	}
+	if err == nil {
+		resp, err = labeled(ctx, req, do)
+	}
+	if fallback {
+		if err != nil && !req.NoRetry {
+			resp, err = t.doWithProxyFallback(ctx, req, err)
+		} else if err == nil {
+			t.proxyBlacklist.recovered(t.primaryProxyURL())
+			resp.Via = proxyLabel(t.primaryProxyURL())
+		}
+	}
+	err = headerLimitError(t.config, err)
+	if err == nil && resp.Protocol != "h1" {
+		if err = checkHeaderLimits(resp.Protocol, resp.Headers, headerLimits(t.config, resp.Protocol)); err != nil {
+			resp.Close()
+		}
+	}
+	if violations != nil {
+		if err != nil {
+			return nil, frameViolation(err)
+		}
+		resp.Violations = append(violations.list(), headerViolations(resp.Protocol, resp.Headers, t.headerListLimit(resp.Protocol))...)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if u, err := url.Parse(req.URL); err == nil {
+		t.hostStats.record(u.Hostname(), resp.BytesSent, resp.BytesReceived)
+		t.connStats.used(u.Hostname(), resp.Protocol)
+	}
+	t.recordAltSvc(req.URL, resp.Headers)
+	if resp.Timing != nil {
+		resp.Timing.Server = protocol.ParseServerTiming(resp.Headers["server-timing"])
+	}
+	return resp, nil
+}
+
+// do selects the protocol for the request and executes it
+func (t *Transport) do(ctx context.Context, req *Request) (*Response, error) {
 	// Parse URL to determine scheme
 	parsedURL, err := url.Parse(req.URL)
 	if err != nil {
@@ -773,22 +1165,13 @@ func (t *Transport) Do(ctx context.Context, req *Request) (*Response, error) {
 	}
 
 	// For HTTP (non-TLS), only HTTP/1.1 is supported
-	if parsedURL.Scheme == "http" {
+	if parsedURL.Scheme == "http" || req.HTTP10 {
 		return t.doHTTP1(ctx, req)
 	}
 
 	// When proxy is configured, respect user's protocol choice
 	// Check for any proxy (URL, TCPProxy, or UDPProxy)
 	if t.proxy != nil && (t.proxy.URL != "" || t.proxy.TCPProxy != "" || t.proxy.UDPProxy != "") {
-		// Get effective proxy URL for protocol detection
-		effectiveProxyURL := t.proxy.URL
-		if effectiveProxyURL == "" {
-			effectiveProxyURL = t.proxy.TCPProxy
-		}
-		if effectiveProxyURL == "" {
-			effectiveProxyURL = t.proxy.UDPProxy
-		}
-
 		// Respect user's explicit protocol choice
 		switch t.protocol {
 		case ProtocolHTTP1:
@@ -798,12 +1181,8 @@ func (t *Transport) Do(ctx context.Context, req *Request) (*Response, error) {
 			return t.doHTTP2(ctx, req)
 
 		case ProtocolHTTP3:
-			// Check if H3 is possible with this proxy
-			if t.h3ProxyError != nil {
-				return nil, t.h3ProxyError
-			}
-			if !SupportsQUIC(effectiveProxyURL) {
-				return nil, fmt.Errorf("HTTP/3 requires a SOCKS5 or MASQUE proxy (current proxy does not support UDP)")
+			if err := t.checkH3Proxy(); err != nil {
+				return nil, err
 			}
 			return t.doHTTP3(ctx, req)
 
@@ -823,7 +1202,7 @@ func (t *Transport) Do(ctx context.Context, req *Request) (*Response, error) {
 				return t.doHTTP1(ctx, req)
 			}
 
-			if SupportsQUIC(effectiveProxyURL) {
+			if t.checkH3Proxy() == nil {
 				// SOCKS5 or MASQUE proxy - prefer HTTP/3 for best fingerprinting
 				resp, err := t.doHTTP3(ctx, req)
 				if err == nil {
@@ -872,8 +1251,9 @@ func (t *Transport) Do(ctx context.Context, req *Request) (*Response, error) {
 	}
 }
 
-// doAuto races HTTP/3 and HTTP/2 in parallel, using whichever succeeds first.
-// This avoids the 5-second HTTP/3 timeout delay when QUIC is blocked.
+// doAuto uses HTTP/2 until the origin advertises HTTP/3 with Alt-Svc, then
+// races HTTP/3 and HTTP/2 in parallel, using whichever succeeds first. This
+// avoids the 5-second HTTP/3 timeout delay when QUIC is blocked.
 // When ALPN negotiates HTTP/1.1 instead of HTTP/2, the TLS connection is reused.
 func (t *Transport) doAuto(ctx context.Context, req *Request) (*Response, error) {
 	host := extractHost(req.URL)
@@ -886,7 +1266,7 @@ func (t *Transport) doAuto(ctx context.Context, req *Request) (*Response, error)
 	if known {
 		switch knownProtocol {
 		case ProtocolHTTP3:
-			return t.doHTTP3(ctx, req)
+			return t.doHTTP3WithFallback(ctx, req)
 		case ProtocolHTTP2:
 			resp, err := t.doHTTP2(ctx, req)
 			if err == nil {
@@ -904,8 +1284,11 @@ func (t *Transport) doAuto(ctx context.Context, req *Request) (*Response, error)
 		}
 	}
 
-	// Race HTTP/3 and HTTP/2 in parallel if H3 is supported
-	if t.preset.SupportHTTP3 {
+	// Like Chrome, try HTTP/3 only on origins that advertised it with
+	// Alt-Svc, racing it against HTTP/2 in case UDP is blocked. Without an
+	// advertisement HTTP/2 is used but not remembered, so a later Alt-Svc
+	// header still moves the origin to HTTP/3.
+	if t.altSvcH3(req.URL) {
 		resp, protocol, err := t.raceH3H2(ctx, req)
 		if err == nil {
 			t.protocolSupportMu.Lock()
@@ -926,12 +1309,8 @@ func (t *Transport) doAuto(ctx context.Context, req *Request) (*Response, error)
 		}
 		// Both failed, try HTTP/1.1 with new connection
 	} else {
-		// No H3 support, just try H2
 		resp, err := t.doHTTP2(ctx, req)
 		if err == nil {
-			t.protocolSupportMu.Lock()
-			t.protocolSupport[host] = ProtocolHTTP2
-			t.protocolSupportMu.Unlock()
 			return resp, nil
 		}
 		// Check if ALPN mismatch - reuse connection for H1
@@ -991,9 +1370,12 @@ func (t *Transport) raceH3H2(ctx context.Context, req *Request) (*Response, Prot
 	alpnErrCh := make(chan *ALPNMismatchError, 1)
 	doneCh := make(chan struct{})
 
+	// Capture the transports: the racers may outlive this call
+	h3Transport, h2Transport := t.h3Transport, t.h2Transport
+
 	// Race HTTP/3 connection
 	go func() {
-		err := t.h3Transport.Connect(raceCtx, host, port)
+		err := h3Transport.Connect(raceCtx, host, port)
 		if err == nil {
 			select {
 			case winnerCh <- ProtocolHTTP3:
@@ -1004,7 +1386,7 @@ func (t *Transport) raceH3H2(ctx context.Context, req *Request) (*Response, Prot
 
 	// Race HTTP/2 connection
 	go func() {
-		err := t.h2Transport.Connect(raceCtx, host, port)
+		err := h2Transport.Connect(raceCtx, host, port)
 		if err == nil {
 			select {
 			case winnerCh <- ProtocolHTTP2:
@@ -1086,8 +1468,8 @@ func (t *Transport) raceH3H2(ctx context.Context, req *Request) (*Response, Prot
 	// Make the actual request using the winning protocol
 	switch winningProtocol {
 	case ProtocolHTTP3:
-		resp, err := t.doHTTP3(ctx, req)
-		return resp, ProtocolHTTP3, err
+		resp, err := t.doHTTP3WithFallback(ctx, req)
+		return resp, responseProtocol(resp, ProtocolHTTP3), err
 	case ProtocolHTTP2:
 		resp, err := t.doHTTP2(ctx, req)
 		if err != nil {
@@ -1176,7 +1558,7 @@ func (t *Transport) doHTTP1(ctx context.Context, req *Request) (*Response, error
 
 	// Set preset headers (with ordering for fingerprinting)
 	// Pass "h1" protocol so Chrome presets don't send Priority header on HTTP/1.1
-	applyPresetHeaders(httpReq, t.preset, t.getHeaderOrder(), t.getCustomPseudoOrder(), effectiveTLSOnly, "h1")
+	applyPresetHeaders(httpReq, t.preset, t.getHeaderOrder(), t.pseudoOrder(req), effectiveTLSOnly, "h1")
 
 	// Override with custom headers (multi-value support)
 	// Use Set for first value to replace preset headers, Add for additional values
@@ -1190,10 +1572,22 @@ func (t *Transport) doHTTP1(ctx context.Context, req *Request) (*Response, error
 		}
 	}
 
+	ja4hProto := "h1"
+	if req.HTTP10 {
+		httpReq.Proto, httpReq.ProtoMinor = "HTTP/1.0", 0
+		ja4hProto = "http/1.0"
+	}
+
+	ja4h, err := t.ja4h(httpReq, ja4hProto)
+	if err != nil {
+		return nil, err
+	}
+
 	// Record timing before request
 	reqStart := time.Now()
 
 	// Make request
+	bytesSent := countRequestBody(httpReq)
 	resp, err := t.h1Transport.RoundTrip(httpReq)
 	if err != nil {
 		return nil, WrapError("roundtrip", host, port, "h1", err)
@@ -1202,23 +1596,9 @@ func (t *Transport) doHTTP1(ctx context.Context, req *Request) (*Response, error
 
 	timing.FirstByte = float64(time.Since(reqStart).Milliseconds())
 
-	// Read response body with pre-allocation for known content length
-	body, releaseBody, err := readBodyOptimized(resp.Body, resp.ContentLength)
+	body, bytesReceived, err := t.readResponseBody(req, resp, host, port, "h1")
 	if err != nil {
-		return nil, NewRequestError("read_body", host, port, "h1", err)
-	}
-
-	// Decompress if needed
-	contentEncoding := resp.Header.Get("Content-Encoding")
-	if contentEncoding != "" {
-		decompressed, err := decompress(body, contentEncoding)
-		if err != nil {
-			releaseBody() // Release pooled buffer on error
-			return nil, NewRequestError("decompress", host, port, "h1", err)
-		}
-		releaseBody() // Release original pooled buffer after decompression
-		body = decompressed
-		releaseBody = func() {} // Decompressed buffer is not pooled
+		return nil, err
 	}
 
 	timing.Total = float64(time.Since(startTime).Milliseconds())
@@ -1227,14 +1607,18 @@ func (t *Transport) doHTTP1(ctx context.Context, req *Request) (*Response, error
 	headers := buildHeadersMap(resp.Header)
 
 	return &Response{
-		StatusCode: resp.StatusCode,
-		Headers:    headers,
-		Body:       io.NopCloser(bytes.NewReader(body)),
-		FinalURL:   req.URL,
-		Timing:     timing,
-		Protocol:   "h1",
-		bodyBytes:  body,
-		bodyRead:   true,
+		StatusCode:       resp.StatusCode,
+		Headers:          headers,
+		Body:             io.NopCloser(bytes.NewReader(body)),
+		FinalURL:         req.URL,
+		Timing:           timing,
+		Protocol:         "h1",
+		TLS:              t.h1Transport.tlsInfo(host),
+		SentFingerprints: t.h1Transport.fingerprints.sent(host, ja4h, nil),
+		BytesSent:        bytesSent(),
+		BytesReceived:    bytesReceived,
+		bodyBytes:        body,
+		bodyRead:         true,
 	}, nil
 }
 
@@ -1290,7 +1674,7 @@ func (t *Transport) doHTTP1WithTLSConn(ctx context.Context, req *Request, alpnEr
 	}
 
 	// Set preset headers - pass "h1" protocol so Chrome presets don't send Priority header
-	applyPresetHeaders(httpReq, t.preset, t.getHeaderOrder(), t.getCustomPseudoOrder(), effectiveTLSOnly, "h1")
+	applyPresetHeaders(httpReq, t.preset, t.getHeaderOrder(), t.pseudoOrder(req), effectiveTLSOnly, "h1")
 
 	// Override with custom headers (multi-value support)
 	// Use Set for first value to replace preset headers, Add for additional values
@@ -1304,10 +1688,17 @@ func (t *Transport) doHTTP1WithTLSConn(ctx context.Context, req *Request, alpnEr
 		}
 	}
 
+	ja4h, err := t.ja4h(httpReq, "h1")
+	if err != nil {
+		alpnErr.TLSConn.Close()
+		return nil, err
+	}
+
 	// Record timing before request
 	reqStart := time.Now()
 
 	// Use the existing TLS connection for the HTTP/1.1 request
+	bytesSent := countRequestBody(httpReq)
 	resp, err := t.h1Transport.RoundTripWithTLSConn(httpReq, alpnErr.TLSConn, host, port)
 	if err != nil {
 		return nil, WrapError("roundtrip", host, port, "h1", err)
@@ -1316,23 +1707,9 @@ func (t *Transport) doHTTP1WithTLSConn(ctx context.Context, req *Request, alpnEr
 
 	timing.FirstByte = float64(time.Since(reqStart).Milliseconds())
 
-	// Read response body with pre-allocation for known content length
-	body, releaseBody, err := readBodyOptimized(resp.Body, resp.ContentLength)
+	body, bytesReceived, err := t.readResponseBody(req, resp, host, port, "h1")
 	if err != nil {
-		return nil, NewRequestError("read_body", host, port, "h1", err)
-	}
-
-	// Decompress if needed
-	contentEncoding := resp.Header.Get("Content-Encoding")
-	if contentEncoding != "" {
-		decompressed, err := decompress(body, contentEncoding)
-		if err != nil {
-			releaseBody()
-			return nil, NewRequestError("decompress", host, port, "h1", err)
-		}
-		releaseBody()
-		body = decompressed
-		releaseBody = func() {}
+		return nil, err
 	}
 
 	timing.Total = float64(time.Since(startTime).Milliseconds())
@@ -1341,14 +1718,18 @@ func (t *Transport) doHTTP1WithTLSConn(ctx context.Context, req *Request, alpnEr
 	headers := buildHeadersMap(resp.Header)
 
 	return &Response{
-		StatusCode: resp.StatusCode,
-		Headers:    headers,
-		Body:       io.NopCloser(bytes.NewReader(body)),
-		FinalURL:   parsedURL.String(),
-		Timing:     timing,
-		Protocol:   "h1",
-		bodyBytes:  body,
-		bodyRead:   true,
+		StatusCode:       resp.StatusCode,
+		Headers:          headers,
+		Body:             io.NopCloser(bytes.NewReader(body)),
+		FinalURL:         parsedURL.String(),
+		Timing:           timing,
+		Protocol:         "h1",
+		TLS:              t.h2Transport.tlsInfo(host),
+		SentFingerprints: t.h2Transport.fingerprints.sent(host, ja4h, nil),
+		BytesSent:        bytesSent(),
+		BytesReceived:    bytesReceived,
+		bodyBytes:        body,
+		bodyRead:         true,
 	}, nil
 }
 
@@ -1411,7 +1792,7 @@ func (t *Transport) doHTTP2(ctx context.Context, req *Request) (*Response, error
 	}
 
 	// Set preset headers (with ordering for fingerprinting)
-	applyPresetHeaders(httpReq, t.preset, t.getHeaderOrder(), t.getCustomPseudoOrder(), effectiveTLSOnly, "h2")
+	applyPresetHeaders(httpReq, t.preset, t.getHeaderOrder(), t.pseudoOrder(req), effectiveTLSOnly, "h2")
 
 	// Override with custom headers (multi-value support)
 	// Use Set for first value to replace preset headers, Add for additional values
@@ -1425,35 +1806,32 @@ func (t *Transport) doHTTP2(ctx context.Context, req *Request) (*Response, error
 		}
 	}
 
+	// Browsers on RFC 7540 priorities don't send the Priority header
+	if !t.preset.H2().SendsPriorityHeader() {
+		httpReq.Header.Del("Priority")
+	}
+
+	ja4h, err := t.ja4h(httpReq, "h2")
+	if err != nil {
+		return nil, err
+	}
+
 	// Record timing before request
 	reqStart := time.Now()
 
 	// Make request
+	bytesSent := countRequestBody(httpReq)
 	resp, err := t.h2Transport.RoundTrip(httpReq)
 	if err != nil {
-		return nil, WrapError("roundtrip", host, port, "h2", err)
+		return nil, WrapError("roundtrip", host, port, "h2", requestHeaderSizeError(httpReq.Header, err))
 	}
 	defer resp.Body.Close()
 
 	timing.FirstByte = float64(time.Since(reqStart).Milliseconds())
 
-	// Read response body with pre-allocation for known content length
-	body, releaseBody, err := readBodyOptimized(resp.Body, resp.ContentLength)
+	body, bytesReceived, err := t.readResponseBody(req, resp, host, port, "h2")
 	if err != nil {
-		return nil, NewRequestError("read_body", host, port, "h2", err)
-	}
-
-	// Decompress if needed
-	contentEncoding := resp.Header.Get("Content-Encoding")
-	if contentEncoding != "" {
-		decompressed, err := decompress(body, contentEncoding)
-		if err != nil {
-			releaseBody()
-			return nil, NewRequestError("decompress", host, port, "h2", err)
-		}
-		releaseBody()
-		body = decompressed
-		releaseBody = func() {}
+		return nil, err
 	}
 
 	timing.Total = float64(time.Since(startTime).Milliseconds())
@@ -1477,14 +1855,18 @@ func (t *Transport) doHTTP2(ctx context.Context, req *Request) (*Response, error
 	headers := buildHeadersMap(resp.Header)
 
 	return &Response{
-		StatusCode: resp.StatusCode,
-		Headers:    headers,
-		Body:       io.NopCloser(bytes.NewReader(body)),
-		FinalURL:   req.URL,
-		Timing:     timing,
-		Protocol:   "h2",
-		bodyBytes:  body,
-		bodyRead:   true,
+		StatusCode:       resp.StatusCode,
+		Headers:          headers,
+		Body:             io.NopCloser(bytes.NewReader(body)),
+		FinalURL:         req.URL,
+		Timing:           timing,
+		Protocol:         "h2",
+		TLS:              t.h2Transport.tlsInfo(host),
+		SentFingerprints: t.h2Transport.fingerprints.sent(host, ja4h, httpReq.Header[http.PHeaderOrderKey]),
+		BytesSent:        bytesSent(),
+		BytesReceived:    bytesReceived,
+		bodyBytes:        body,
+		bodyRead:         true,
 	}, nil
 }
 
@@ -1535,7 +1917,8 @@ func (t *Transport) doHTTP3(ctx context.Context, req *Request) (*Response, error
 		bodyReader = bytes.NewReader([]byte{})
 	}
 
-	httpReq, err := http.NewRequestWithContext(ctx, method, req.URL, bodyReader)
+	reqCtx, quicVersion := traceQUICVersion(ctx)
+	httpReq, err := http.NewRequestWithContext(reqCtx, method, req.URL, bodyReader)
 	if err != nil {
 		return nil, NewRequestError("create_request", host, port, "h3", err)
 	}
@@ -1547,7 +1930,7 @@ func (t *Transport) doHTTP3(ctx context.Context, req *Request) (*Response, error
 	}
 
 	// Set preset headers (with ordering for fingerprinting)
-	applyPresetHeaders(httpReq, t.preset, t.getHeaderOrder(), t.getCustomPseudoOrder(), effectiveTLSOnly, "h3")
+	applyPresetHeaders(httpReq, t.preset, t.getHeaderOrder(), t.pseudoOrder(req), effectiveTLSOnly, "h3")
 
 	// Override with custom headers (multi-value support)
 	// Use Set for first value to replace preset headers, Add for additional values
@@ -1561,10 +1944,16 @@ func (t *Transport) doHTTP3(ctx context.Context, req *Request) (*Response, error
 		}
 	}
 
+	ja4h, err := t.ja4h(httpReq, "h3")
+	if err != nil {
+		return nil, err
+	}
+
 	// Record timing before request
 	reqStart := time.Now()
 
 	// Make request
+	bytesSent := countRequestBody(httpReq)
 	resp, err := t.h3Transport.RoundTrip(httpReq)
 	if err != nil {
 		return nil, WrapError("roundtrip", host, port, "h3", err)
@@ -1573,23 +1962,9 @@ func (t *Transport) doHTTP3(ctx context.Context, req *Request) (*Response, error
 
 	timing.FirstByte = float64(time.Since(reqStart).Milliseconds())
 
-	// Read response body with pre-allocation for known content length
-	body, releaseBody, err := readBodyOptimized(resp.Body, resp.ContentLength)
+	body, bytesReceived, err := t.readResponseBody(req, resp, host, port, "h3")
 	if err != nil {
-		return nil, NewRequestError("read_body", host, port, "h3", err)
-	}
-
-	// Decompress if needed
-	contentEncoding := resp.Header.Get("Content-Encoding")
-	if contentEncoding != "" {
-		decompressed, err := decompress(body, contentEncoding)
-		if err != nil {
-			releaseBody()
-			return nil, NewRequestError("decompress", host, port, "h3", err)
-		}
-		releaseBody()
-		body = decompressed
-		releaseBody = func() {}
+		return nil, err
 	}
 
 	timing.Total = float64(time.Since(startTime).Milliseconds())
@@ -1614,31 +1989,42 @@ func (t *Transport) doHTTP3(ctx context.Context, req *Request) (*Response, error
 	headers := buildHeadersMap(resp.Header)
 
 	return &Response{
-		StatusCode: resp.StatusCode,
-		Headers:    headers,
-		Body:       io.NopCloser(bytes.NewReader(body)),
-		FinalURL:   req.URL,
-		Timing:     timing,
-		Protocol:   "h3",
-		bodyBytes:  body,
-		bodyRead:   true,
+		StatusCode:       resp.StatusCode,
+		Headers:          headers,
+		Body:             io.NopCloser(bytes.NewReader(body)),
+		FinalURL:         req.URL,
+		Timing:           timing,
+		Protocol:         "h3",
+		QUICVersion:      quicVersion(),
+		TLS:              t.h3Transport.tlsInfo(host),
+		SentFingerprints: t.h3Transport.fingerprints.sent(host, ja4h, httpReq.Header[http.PHeaderOrderKey]),
+		BytesSent:        bytesSent(),
+		BytesReceived:    bytesReceived,
+		bodyBytes:        body,
+		bodyRead:         true,
 	}, nil
 }
 
 // Close shuts down the transport
 func (t *Transport) Close() {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
 	t.h1Transport.Close()
 	t.h2Transport.Close()
 	t.h3Transport.Close()
+	t.closeProxyTransports()
 }
 
 // Refresh closes all connections but keeps TLS session caches intact.
 // This simulates a browser page refresh - new TCP/QUIC connections but TLS resumption.
 // Useful for resetting connection state without losing session tickets.
 func (t *Transport) Refresh() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
 	t.h1Transport.Refresh()
 	t.h2Transport.Refresh()
 	t.h3Transport.Refresh()
+	t.publish(t.detachProxyTransports())
 }
 
 // RefreshWithProtocol closes all connections and switches to a new protocol.
@@ -1646,19 +2032,38 @@ func (t *Transport) Refresh() {
 // This enables warming up TLS tickets on one protocol (e.g. H3) then serving
 // requests on another (e.g. H2) with session resumption.
 func (t *Transport) RefreshWithProtocol(p Protocol) {
+	t.mu.Lock()
 	t.h1Transport.Refresh()
 	t.h2Transport.Refresh()
 	t.h3Transport.Refresh()
-	t.SetProtocol(p)
+	t.protocol = p
+	t.publish(t.detachProxyTransports())
+	t.mu.Unlock()
 	t.ClearProtocolCache()
 }
 
-// Stats returns transport statistics
-func (t *Transport) Stats() map[string]interface{} {
-	return map[string]interface{}{
-		"http1": t.h1Transport.Stats(),
-		"http2": t.h2Transport.Stats(),
-		"http3": t.h3Transport.Stats(),
+// ProtocolHints returns the protocol learned for each host (by racing
+// HTTP/3 and HTTP/2 or from ALPN), keyed by hostname
+func (t *Transport) ProtocolHints() map[string]Protocol {
+	t.protocolSupportMu.RLock()
+	defer t.protocolSupportMu.RUnlock()
+	hints := make(map[string]Protocol, len(t.protocolSupport))
+	for host, p := range t.protocolSupport {
+		hints[host] = p
+	}
+	return hints
+}
+
+// SetProtocolHints records protocols learned elsewhere (e.g., by another
+// process) so auto mode goes straight to them instead of racing. Hosts the
+// transport has already learned are kept.
+func (t *Transport) SetProtocolHints(hints map[string]Protocol) {
+	t.protocolSupportMu.Lock()
+	defer t.protocolSupportMu.Unlock()
+	for host, p := range hints {
+		if _, known := t.protocolSupport[host]; !known && p != ProtocolAuto {
+			t.protocolSupport[host] = p
+		}
 	}
 }
 
@@ -1676,21 +2081,29 @@ func (t *Transport) ClearProtocolCache() {
 
 // GetHTTP1Transport returns the HTTP/1.1 transport for TLS session cache access
 func (t *Transport) GetHTTP1Transport() *HTTP1Transport {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
 	return t.h1Transport
 }
 
 // GetHTTP2Transport returns the HTTP/2 transport for TLS session cache access
 func (t *Transport) GetHTTP2Transport() *HTTP2Transport {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
 	return t.h2Transport
 }
 
 // GetHTTP3Transport returns the HTTP/3 transport for TLS session cache access
 func (t *Transport) GetHTTP3Transport() *HTTP3Transport {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
 	return t.h3Transport
 }
 
 // GetConfig returns the transport's configuration.
 func (t *Transport) GetConfig() *TransportConfig {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
 	return t.config
 }
 
@@ -1699,6 +2112,8 @@ func (t *Transport) GetConfig() *TransportConfig {
 // different proxies or with different session configurations.
 // The identifier is included in distributed cache keys to prevent session sharing.
 func (t *Transport) SetSessionIdentifier(sessionId string) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
 	if t.h1Transport != nil {
 		if cache := t.h1Transport.GetSessionCache(); cache != nil {
 			if pCache, ok := cache.(*PersistableSessionCache); ok {
@@ -1782,9 +2197,13 @@ func applyPresetHeaders(httpReq *http.Request, preset *fingerprint.Preset, custo
 		}
 	}
 
-	// Set pseudo-header order: custom (Akamai) > browser-type heuristic
+	// Set pseudo-header order: custom (Akamai) > H2Spec > preset > browser-type heuristic
 	if len(customPseudoOrder) > 0 {
 		httpReq.Header[http.PHeaderOrderKey] = customPseudoOrder
+	} else if preset.H2Spec != nil && len(preset.H2Spec.PseudoHeaderOrder) > 0 {
+		httpReq.Header[http.PHeaderOrderKey] = preset.H2Spec.PseudoHeaderOrder
+	} else if len(preset.HTTP2Settings.PseudoHeaderOrder) > 0 {
+		httpReq.Header[http.PHeaderOrderKey] = preset.HTTP2Settings.PseudoHeaderOrder
 	} else if preset.HTTP2Settings.NoRFC7540Priorities {
 		// Safari/iOS uses m,s,p,a
 		httpReq.Header[http.PHeaderOrderKey] = []string{":method", ":scheme", ":path", ":authority"}
@@ -1878,6 +2297,11 @@ func readBodyOptimized(body io.Reader, contentLength int64) ([]byte, func(), err
 }
 
 func decompress(data []byte, encoding string) ([]byte, error) {
+	// Custom decoders take precedence over built-ins
+	if result, handled, err := decodeWithRegistered(data, encoding); handled {
+		return result, err
+	}
+
 	switch strings.ToLower(encoding) {
 	case "gzip":
 		reader, err := gzip.NewReader(bytes.NewReader(data))